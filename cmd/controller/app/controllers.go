@@ -18,13 +18,19 @@ package app
 
 import (
 	"kubesphere.io/devops/controllers/addon"
+	"kubesphere.io/devops/controllers/applicationset"
 	"kubesphere.io/devops/controllers/argocd"
 	"kubesphere.io/devops/controllers/fluxcd"
 	"kubesphere.io/devops/controllers/gitrepository"
 	"kubesphere.io/devops/controllers/jenkins/devopscredential"
 	"kubesphere.io/devops/controllers/jenkins/devopsproject"
+	"kubesphere.io/devops/controllers/metrics"
+	"kubesphere.io/devops/controllers/promotion"
+	"kubesphere.io/devops/controllers/rollout"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	"kubesphere.io/devops/pkg/jwt/token"
 	"kubesphere.io/devops/pkg/server/errors"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 
 	"github.com/jenkins-zh/jenkins-client/pkg/core"
 	"k8s.io/klog/v2"
@@ -34,6 +40,7 @@ import (
 	"kubesphere.io/devops/controllers/jenkins/pipelinerun"
 	"kubesphere.io/devops/pkg/client/devops"
 	"kubesphere.io/devops/pkg/client/k8s"
+	"kubesphere.io/devops/pkg/client/s3"
 	"kubesphere.io/devops/pkg/informers"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -48,6 +55,17 @@ func addControllers(mgr manager.Manager, client k8s.Client, informerFactory info
 	reconcilers := getAllControllers(mgr, client, informerFactory, devopsClient, s, jenkinsCore)
 	reconcilers["pipeline"] = func(mgr manager.Manager) (err error) {
 		tokenIssuer := token.NewTokenIssuer(s.JWTOptions.Secret, s.JWTOptions.MaximumClockSkew)
+		var s3Client s3.Interface
+		if s.FeatureOptions.PipelineRunDataStore == storefactory.TypeS3 {
+			if s.S3Options == nil || s.S3Options.Endpoint == "" {
+				err = errors.New("the s3 options are required by the s3 pipelineRun data store")
+				return
+			}
+			if s3Client, err = s3.NewS3Client(s.S3Options); err != nil {
+				klog.Errorf("unable to create the s3 client, err: %v", err)
+				return
+			}
+		}
 		// add PipelineRun controller
 		if err = (&pipelinerun.Reconciler{
 			Client:               mgr.GetClient(),
@@ -56,6 +74,8 @@ func addControllers(mgr manager.Manager, client k8s.Client, informerFactory info
 			JenkinsCore:          jenkinsCore,
 			TokenIssuer:          tokenIssuer,
 			PipelineRunDataStore: s.FeatureOptions.PipelineRunDataStore,
+			PipelineRunDataDir:   s.FeatureOptions.PipelineRunDataDir,
+			S3Client:             s3Client,
 		}).SetupWithManager(mgr); err != nil {
 			klog.Errorf("unable to create pipelinerun-controller, err: %v", err)
 			return
@@ -70,6 +90,27 @@ func addControllers(mgr manager.Manager, client k8s.Client, informerFactory info
 			return
 		}
 
+		// add PipelineRun retention controller
+		if err = (&pipelinerun.RetentionReconciler{
+			Client:      mgr.GetClient(),
+			JenkinsCore: jenkinsCore,
+			DataStoreFactory: storefactory.NewFactory(&storefactory.Options{
+				Type:    s.FeatureOptions.PipelineRunDataStore,
+				RootDir: s.FeatureOptions.PipelineRunDataDir,
+			}, mgr.GetClient(), s3Client),
+		}).SetupWithManager(mgr); err != nil {
+			klog.Errorf("unable to create pipelinerun-retention-controller, err: %v", err)
+			return
+		}
+
+		// add PipelineRun metrics controller
+		if err = (&metrics.PipelineRunReconciler{
+			Client: mgr.GetClient(),
+		}).SetupWithManager(mgr); err != nil {
+			klog.Errorf("unable to create pipelinerun-metrics-controller, err: %v", err)
+			return
+		}
+
 		// add Pipeline metadata controller
 		err = (&jenkinspipeline.Reconciler{
 			Client:      mgr.GetClient(),
@@ -117,6 +158,10 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 	argcdImageUpdaterReconciler := &argocd.ImageUpdaterReconciler{
 		Client: mgr.GetClient(),
 	}
+	argocdAppMetricsReconciler := &metrics.ApplicationReconciler{
+		Client: mgr.GetClient(),
+		Engine: v1alpha1.ArgoCD,
+	}
 	gitRepoReconcilers := gitrepository.GetReconcilers(mgr.GetClient())
 
 	fluxcdGitRepoReconciler := &fluxcd.GitRepositoryReconciler{
@@ -133,6 +178,11 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 		Client:                   mgr.GetClient(),
 		TargetConfigMapNamespace: s.FeatureOptions.SystemNamespace,
 	}
+	jenkinsAgentTemplate := config.AgentTemplateReconciler{
+		Client:                   mgr.GetClient(),
+		TargetConfigMapNamespace: s.FeatureOptions.SystemNamespace,
+		WorkerNamespace:          s.JenkinsOptions.WorkerNamespace,
+	}
 	fluxcdApplicationReconciler := &fluxcd.ApplicationReconciler{
 		Client: mgr.GetClient(),
 	}
@@ -142,6 +192,13 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 	fluxcdAppStatusReconciler := &fluxcd.ApplicationStatusReconciler{
 		Client: mgr.GetClient(),
 	}
+	fluxcdAppMetricsReconciler := &metrics.ApplicationReconciler{
+		Client: mgr.GetClient(),
+		Engine: v1alpha1.FluxCD,
+	}
+	fluxcdImageUpdaterReconciler := &fluxcd.ImageUpdaterReconciler{
+		Client: mgr.GetClient(),
+	}
 
 	return map[string]func(mgr manager.Manager) error{
 		gitRepoReconcilers.GetName(): func(mgr manager.Manager) error {
@@ -166,8 +223,27 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 			}
 			return err
 		},
-		"jenkinsagent": func(mgr manager.Manager) error {
-			return jenkinsPodTemplate.SetupWithManager(mgr)
+		"applicationset": func(mgr manager.Manager) error {
+			return (&applicationset.Reconciler{
+				Client: mgr.GetClient(),
+			}).SetupWithManager(mgr)
+		},
+		"promotion": func(mgr manager.Manager) error {
+			return (&promotion.Reconciler{
+				Client: mgr.GetClient(),
+			}).SetupWithManager(mgr)
+		},
+		"rollout": func(mgr manager.Manager) error {
+			return (&rollout.Reconciler{
+				Client:            mgr.GetClient(),
+				FlaggerLoadTester: s.FeatureOptions.FlaggerLoadTester,
+			}).SetupWithManager(mgr)
+		},
+		"jenkinsagent": func(mgr manager.Manager) (err error) {
+			if err = jenkinsPodTemplate.SetupWithManager(mgr); err == nil {
+				err = jenkinsAgentTemplate.SetupWithManager(mgr)
+			}
+			return
 		},
 		"jenkinsconfig": func(mgr manager.Manager) error {
 			return mgr.Add(config.NewController(&config.ControllerOptions{
@@ -180,6 +256,7 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 				InformerFactory:   informerFactory,
 
 				ConfigOperator:  devopsClient,
+				Recorder:        mgr.GetEventRecorderFor("jenkins-config"),
 				ReloadCasCDelay: s.JenkinsOptions.ReloadCasCDelay,
 			}, s.JenkinsOptions))
 		},
@@ -227,6 +304,9 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 			if err = argocdGitRepoReconciler.SetupWithManager(mgr); err != nil {
 				return
 			}
+			if err = argocdAppMetricsReconciler.SetupWithManager(mgr); err != nil {
+				return
+			}
 			return argocdAppReconciler.SetupWithManager(mgr)
 		},
 		argcdImageUpdaterReconciler.GetGroupName() + "-image-updater": func(mgr manager.Manager) error {
@@ -242,7 +322,13 @@ func getAllControllers(mgr manager.Manager, client k8s.Client, informerFactory i
 			if err = fluxcdAppStatusReconciler.SetupWithManager(mgr); err != nil {
 				return
 			}
+			if err = fluxcdAppMetricsReconciler.SetupWithManager(mgr); err != nil {
+				return
+			}
 			return fluxcdApplicationReconciler.SetupWithManager(mgr)
 		},
+		fluxcdImageUpdaterReconciler.GetGroupName() + "-image-updater": func(mgr manager.Manager) error {
+			return fluxcdImageUpdaterReconciler.SetupWithManager(mgr)
+		},
 	}
 }
@@ -21,6 +21,7 @@ import (
 
 	"github.com/spf13/pflag"
 	cliflag "k8s.io/component-base/cli/flag"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 	"kubesphere.io/devops/pkg/utils/reflectutils"
 )
 
@@ -31,6 +32,8 @@ type FeatureOptions struct {
 	ExternalAddress      string
 	ClusterName          string
 	PipelineRunDataStore string
+	PipelineRunDataDir   string
+	FlaggerLoadTester    string
 }
 
 // GetControllers returns the controllers map
@@ -61,7 +64,11 @@ func (o *FeatureOptions) GetControllers() map[string]bool {
 
 // NewFeatureOptions provide default options
 func NewFeatureOptions() *FeatureOptions {
-	return &FeatureOptions{}
+	dataStore := storefactory.NewOptions()
+	return &FeatureOptions{
+		PipelineRunDataStore: dataStore.Type,
+		PipelineRunDataDir:   dataStore.RootDir,
+	}
 }
 
 // Validate checks validation of FeatureOptions.
@@ -82,8 +89,16 @@ func (o *FeatureOptions) AddFlags(fs *pflag.FlagSet, c *FeatureOptions) {
 		"The system namespace that contains ConfigMap, Secrets e.g.")
 	fs.StringVarP(&o.ExternalAddress, "external-address", "", "", "The external address for the UI")
 	fs.StringVarP(&o.ClusterName, "cluster-name", "", "default", "Current cluster name")
-	fs.StringVarP(&o.PipelineRunDataStore, "pipelinerun-data-store", "", "configmap",
-		"The data store type of the PipelineRun data, could be empty or configmap")
+	fs.StringVarP(&o.PipelineRunDataStore, "pipelinerun-data-store", "", o.PipelineRunDataStore,
+		"The data store type of the PipelineRun data, could be empty, configmap, s3 or filesystem. "+
+			"The s3 data store requires the s3 options, the existing data in ConfigMaps will be migrated into the s3 or filesystem data store. "+
+			"It defaults to pipelineRunDataStore.type of the configuration file, and it must be the same as the one read by the apiserver")
+	fs.StringVarP(&o.PipelineRunDataDir, "pipelinerun-data-dir", "", o.PipelineRunDataDir,
+		"The root directory of the filesystem data store, it could be a mounted PersistentVolume. "+
+			"It defaults to pipelineRunDataStore.rootDir of the configuration file, and it must be the same as the one read by the apiserver")
+	fs.StringVarP(&o.FlaggerLoadTester, "flagger-load-tester", "", "",
+		"The address of the Flagger load tester, e.g. http://flagger-loadtester.test. "+
+			"It serves the manual promotion gate of the Flagger rollouts")
 }
 
 func (o *FeatureOptions) knownControllers() []string {
@@ -18,6 +18,7 @@ package options
 
 import (
 	"flag"
+	"fmt"
 	"strings"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	"kubesphere.io/devops/pkg/client/devops/jenkins"
 	"kubesphere.io/devops/pkg/client/k8s"
 	"kubesphere.io/devops/pkg/client/s3"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 
 	"k8s.io/apimachinery/pkg/labels"
 
@@ -46,6 +48,9 @@ type DevOpsControllerManagerOptions struct {
 	JWTOptions        *JWTOptions
 	ArgoCDOption      *config.ArgoCDOption
 
+	// PipelineRunDataStore is the data store options in the configuration file which is shared with the apiserver
+	PipelineRunDataStore *storefactory.Options
+
 	// KubeSphere is using sigs.k8s.io/application as fundamental object to implement Application Management.
 	// There are other projects also built on sigs.k8s.io/application, when KubeSphere installed along side
 	// them, conflicts happen. So we leave an option to only reconcile applications  matched with the given
@@ -117,6 +122,13 @@ func (s *DevOpsControllerManagerOptions) Validate() []error {
 	errs = append(errs, s.KubernetesOptions.Validate()...)
 	errs = append(errs, s.FeatureOptions.Validate()...)
 
+	// the apiserver reads the data which is written by the controller
+	if dataStore := s.PipelineRunDataStore; dataStore != nil && (dataStore.Type != s.FeatureOptions.PipelineRunDataStore ||
+		(dataStore.Type == storefactory.TypeFileSystem && dataStore.RootDir != s.FeatureOptions.PipelineRunDataDir)) {
+		errs = append(errs, fmt.Errorf("the pipelineRun data store %q (%s) is different from %q (%s) in the configuration file",
+			s.FeatureOptions.PipelineRunDataStore, s.FeatureOptions.PipelineRunDataDir, dataStore.Type, dataStore.RootDir))
+	}
+
 	if len(s.ApplicationSelector) != 0 {
 		_, err := labels.Parse(s.ApplicationSelector)
 		if err != nil {
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 )
 
 func TestOption(t *testing.T) {
@@ -42,3 +43,17 @@ func TestOption(t *testing.T) {
 	opt.ApplicationSelector = "!@#$"
 	assert.NotNil(t, opt.Validate())
 }
+
+func TestOption_PipelineRunDataStore(t *testing.T) {
+	opt := NewDevOpsControllerManagerOptions()
+	opt.PipelineRunDataStore = &storefactory.Options{Type: storefactory.TypeFileSystem, RootDir: "/data"}
+	opt.FeatureOptions.PipelineRunDataStore = storefactory.TypeFileSystem
+	opt.FeatureOptions.PipelineRunDataDir = "/data"
+	assert.Nil(t, opt.Validate())
+
+	// different from the one of the apiserver
+	opt.FeatureOptions.PipelineRunDataDir = "/other"
+	assert.NotNil(t, opt.Validate())
+	opt.FeatureOptions.PipelineRunDataStore = storefactory.TypeS3
+	assert.NotNil(t, opt.Validate())
+}
@@ -60,11 +60,17 @@ func NewControllerManagerCommand() *cobra.Command {
 				Secret:           conf.AuthenticationOptions.JwtSecret,
 				MaximumClockSkew: conf.AuthenticationOptions.MaximumClockSkew,
 			},
-			ArgoCDOption:   conf.ArgoCDOption,
-			FeatureOptions: s.FeatureOptions,
-			LeaderElection: s.LeaderElection,
-			LeaderElect:    s.LeaderElect,
-			WebhookCertDir: s.WebhookCertDir,
+			ArgoCDOption:         conf.ArgoCDOption,
+			FeatureOptions:       s.FeatureOptions,
+			LeaderElection:       s.LeaderElection,
+			LeaderElect:          s.LeaderElect,
+			WebhookCertDir:       s.WebhookCertDir,
+			PipelineRunDataStore: conf.PipelineRunDataStore,
+		}
+		// the same data store as the apiserver's by default
+		if conf.PipelineRunDataStore != nil {
+			s.FeatureOptions.PipelineRunDataStore = conf.PipelineRunDataStore.Type
+			s.FeatureOptions.PipelineRunDataDir = conf.PipelineRunDataStore.RootDir
 		}
 	} else {
 		klog.Fatal("Failed to load configuration from disk", err)
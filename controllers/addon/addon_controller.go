@@ -19,8 +19,10 @@ package addon
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"html/template"
+	"regexp"
+	"text/template"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
@@ -63,8 +65,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ct
 		return r.cleanup(addon)
 	}
 
-	err = r.addonHandle(ctx, addon)
-	return
+	return r.addonHandle(ctx, addon)
 }
 
 func beingDeleting(addon *v1alpha3.Addon) bool {
@@ -72,14 +73,29 @@ func beingDeleting(addon *v1alpha3.Addon) bool {
 }
 
 func (r *Reconciler) cleanup(addon *v1alpha3.Addon) (result ctrl.Result, err error) {
-	var obj *unstructured.Unstructured
-	if obj, _, err = r.findTemplateInstance(context.Background(), addon); err != nil && !apierrors.IsNotFound(err) {
-		return
+	ctx := context.Background()
+	resources := addon.Status.Resources
+	if len(resources) == 0 && addon.Status.Phase == "" {
+		// the addon was installed before its resources were recorded
+		var obj *unstructured.Unstructured
+		if obj, _, err = r.findTemplateInstance(ctx, addon); err == nil {
+			resources = []corev1.ObjectReference{getObjectReference(obj)}
+		} else if !apierrors.IsNotFound(err) {
+			return
+		}
+		err = nil
 	}
 
-	if err = r.Client.Delete(context.Background(), obj); err == nil {
+	if addon.Status.Phase != v1alpha3.AddonPhaseTerminating {
+		addon.Status.Phase = v1alpha3.AddonPhaseTerminating
+		if err = r.Client.Update(ctx, addon); err != nil {
+			return
+		}
+	}
+
+	if err = r.deleteResources(ctx, resources); err == nil {
 		k8sutil.RemoveFinalizer(&addon.ObjectMeta, v1alpha3.AddonFinalizerName)
-		err = r.Client.Update(context.Background(), addon)
+		err = r.Client.Update(ctx, addon)
 	}
 	return
 }
@@ -87,9 +103,62 @@ func (r *Reconciler) cleanup(addon *v1alpha3.Addon) (result ctrl.Result, err err
 const (
 	// EventReasonMissing represents the reason because of missing something
 	EventReasonMissing = "Missing"
+	// EventReasonFailedInstall represents the reason because of failing to install or upgrade the addon
+	EventReasonFailedInstall = "FailedInstall"
 )
 
-func (r *Reconciler) addonHandle(ctx context.Context, addon *v1alpha3.Addon) (err error) {
+func (r *Reconciler) addonHandle(ctx context.Context, addon *v1alpha3.Addon) (result ctrl.Result, err error) {
+	addonStrategy := &v1alpha3.AddonStrategy{}
+	if err = r.Client.Get(ctx, types.NamespacedName{Name: addon.Spec.Strategy.Name}, addonStrategy); err != nil {
+		r.recorder.Eventf(addon, corev1.EventTypeWarning, EventReasonMissing, "failed to get AddonStrategy with: %s", addon.Spec.Strategy.Name)
+		return
+	}
+
+	health := checkHealth(ctx, addon, addonStrategy.Spec.HealthCheck)
+	// install the addon with the version of the current step of the upgrade path
+	target := addon.DeepCopy()
+	target.Spec.Version = getTargetVersion(addonStrategy.Spec.UpgradePath, &addon.Status, addon.Spec.Version, health)
+
+	var resources []corev1.ObjectReference
+	switch addonStrategy.Spec.Type {
+	case v1alpha3.AddonInstallStrategySimpleOperator:
+		resources, err = r.simpleOperatorHandle(ctx, target)
+	case v1alpha3.AddonInstallStrategySimple:
+		resources, err = r.simpleHandle(ctx, target, addonStrategy)
+	case v1alpha3.AddonInstallStrategyHelm:
+		resources, err = r.helmHandle(ctx, target, addonStrategy)
+	case v1alpha3.AddonInstallStrategyOperator:
+		resources, err = r.operatorHandle(ctx, target, addonStrategy)
+	default:
+		err = fmt.Errorf("not supported addon strategy: %s", addonStrategy.Name)
+	}
+
+	// remove the resources which are not part of the addon anymore
+	if err == nil {
+		err = r.deleteResources(ctx, subtractResources(addon.Status.Resources, resources))
+	}
+
+	if err != nil {
+		r.recorder.Eventf(addon, corev1.EventTypeWarning, EventReasonFailedInstall, "failed to install addon: %v", err)
+		// keep the resources which were installed before, then they still can be removed
+		resources = mergeResources(addon.Status.Resources, resources)
+	}
+	previous := addon.Status.DeepCopy().Conditions
+	setAddonStatus(&addon.Status, addon.Spec.Version, resources, target.Spec.Version, err, health)
+	r.recordConditionEvents(addon, previous)
+
+	// add finalizer
+	k8sutil.AddFinalizer(&addon.ObjectMeta, v1alpha3.AddonFinalizerName)
+	if updateErr := r.Update(ctx, addon); err == nil {
+		err = updateErr
+	}
+	if err == nil {
+		result.RequeueAfter = getProbePeriod(addon, addonStrategy)
+	}
+	return
+}
+
+func (r *Reconciler) simpleOperatorHandle(ctx context.Context, addon *v1alpha3.Addon) (resources []corev1.ObjectReference, err error) {
 	var tpl string
 	var obj *unstructured.Unstructured
 	if obj, tpl, err = r.findTemplateInstance(ctx, addon); err != nil {
@@ -109,10 +178,8 @@ func (r *Reconciler) addonHandle(ctx context.Context, addon *v1alpha3.Addon) (er
 		err = r.Client.Update(ctx, obj)
 	}
 
-	// add finalizer
 	if err == nil {
-		k8sutil.AddFinalizer(&addon.ObjectMeta, v1alpha3.AddonFinalizerName)
-		err = r.Update(ctx, addon)
+		resources = []corev1.ObjectReference{getObjectReference(obj)}
 	}
 	return
 }
@@ -154,21 +221,48 @@ func (r *Reconciler) findTemplateInstance(ctx context.Context, addon *v1alpha3.A
 	return
 }
 
+// getTemplate renders the template with the addon. The values given by users are escaped first,
+// so they can only become YAML scalars instead of injecting anything else into the YAML.
 func getTemplate(tpl string, addon *v1alpha3.Addon) (result string, err error) {
 	var addonTpl *template.Template
 	if addonTpl, err = template.New("addon").Parse(tpl); err == nil {
 		buf := bytes.NewBuffer([]byte{})
-		if err = addonTpl.Execute(buf, addon); err == nil {
+		if err = addonTpl.Execute(buf, escapeAddon(addon)); err == nil {
 			result = buf.String()
 		}
 	}
 	return
 }
 
+// plainYAMLScalar matches the values which are safe to be a plain YAML scalar, e.g. v1.2.3, 8080, nginx:latest
+var plainYAMLScalar = regexp.MustCompile(`^[A-Za-z0-9_./+-]([A-Za-z0-9_./@+:-]*[A-Za-z0-9_./@+-])?$`)
+
+func escapeAddon(addon *v1alpha3.Addon) *v1alpha3.Addon {
+	if addon == nil {
+		return nil
+	}
+	escaped := addon.DeepCopy()
+	escaped.Spec.Version = escapeYAMLValue(escaped.Spec.Version)
+	escaped.Spec.ExternalAddress = escapeYAMLValue(escaped.Spec.ExternalAddress)
+	for key, value := range escaped.Spec.Parameters {
+		escaped.Spec.Parameters[key] = escapeYAMLValue(value)
+	}
+	return escaped
+}
+
+// escapeYAMLValue returns the value as a double-quoted YAML scalar if it cannot be a plain one
+func escapeYAMLValue(value string) string {
+	if value == "" || plainYAMLScalar.MatchString(value) {
+		return value
+	}
+	// a JSON string is a valid double-quoted YAML scalar
+	quoted, _ := json.Marshal(value)
+	return string(quoted)
+}
+
 func (r *Reconciler) supportedStrategy(strategy *v1alpha3.AddonStrategy) bool {
-	// TODO support more types in the future
 	if strategy != nil {
-		return strategy.Spec.Type == v1alpha3.AddonInstallStrategySimpleOperator
+		return strategy.Spec.Type.IsValid()
 	}
 	return false
 }
@@ -60,6 +60,12 @@ func TestReconciler_supportedStrategy(t *testing.T) {
 			Spec: v1alpha3.AddStrategySpec{Type: "simple-operator"},
 		}},
 		want: true,
+	}, {
+		name: "helm",
+		args: args{strategy: &v1alpha3.AddonStrategy{
+			Spec: v1alpha3.AddStrategySpec{Type: "helm"},
+		}},
+		want: true,
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -247,7 +253,8 @@ spec:
 				log:      logr.Discard(),
 				recorder: record.NewFakeRecorder(100),
 			}
-			tt.wantErr(t, r.addonHandle(tt.args.ctx, tt.args.addon), fmt.Sprintf("addonHandle(%v, %v)", tt.args.ctx, tt.args.addon))
+			_, err := r.addonHandle(tt.args.ctx, tt.args.addon)
+			tt.wantErr(t, err, fmt.Sprintf("addonHandle(%v, %v)", tt.args.ctx, tt.args.addon))
 			if tt.verify != nil {
 				tt.verify(t, tt.fields.Client)
 			}
@@ -288,3 +295,15 @@ func Test_beingDeleting(t *testing.T) {
 		})
 	}
 }
+
+func Test_escapeYAMLValue(t *testing.T) {
+	assert.Equal(t, "", escapeYAMLValue(""))
+	assert.Equal(t, "8080", escapeYAMLValue("8080"))
+	assert.Equal(t, "v1.2.3", escapeYAMLValue("v1.2.3"))
+	assert.Equal(t, "ghcr.io/kubesphere/ks-devops:latest", escapeYAMLValue("ghcr.io/kubesphere/ks-devops:latest"))
+	assert.Equal(t, `"a: b"`, escapeYAMLValue("a: b"))
+	assert.Equal(t, `"a:"`, escapeYAMLValue("a:"))
+	assert.Equal(t, `"@a"`, escapeYAMLValue("@a"))
+	assert.Equal(t, `"a\n---\nkind: Secret"`, escapeYAMLValue("a\n---\nkind: Secret"))
+	assert.Nil(t, escapeAddon(nil))
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+)
+
+const (
+	defaultProbePeriod  = time.Minute
+	defaultProbeTimeout = 10 * time.Second
+	// maxVersionResponseSize is the maximum size of the response of the version path
+	maxVersionResponseSize = 16 * 1024
+)
+
+// versionRegexp matches the running versions, the other values in the response are not taken as versions
+var versionRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+-]{0,63}$`)
+
+// probeClient probes the external addresses of the addons. The addresses are provided by the tenants,
+// so it does not follow the redirects and refuses to connect to the loopback and link-local addresses,
+// such as the cloud metadata service.
+var probeClient = newProbeClient(isProbeTargetAllowed)
+
+func newProbeClient(allowed func(ip net.IP) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: defaultProbeTimeout,
+		// check the resolved address right before connecting, so the DNS could not be used to bypass it
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("the address %s is not allowed to be probed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: defaultProbeTimeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isProbeTargetAllowed(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// healthResult is the result of the health check
+type healthResult struct {
+	// checked indicates whether the health check was performed
+	checked bool
+	ready   bool
+	version string
+	message string
+}
+
+// checkHealth performs the readiness probe against the external address of the addon
+func checkHealth(ctx context.Context, addon *v1alpha3.Addon, healthCheck *v1alpha3.AddonHealthCheck) (result healthResult) {
+	if healthCheck == nil || addon.Spec.ExternalAddress == "" {
+		return
+	}
+	result.checked = true
+
+	timeout := defaultProbeTimeout
+	if healthCheck.TimeoutSeconds > 0 {
+		timeout = time.Duration(healthCheck.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp, err := probe(ctx, addon.Spec.ExternalAddress, healthCheck.Path)
+	if err != nil {
+		result.message = err.Error()
+		return
+	}
+	if healthCheck.VersionHeader != "" {
+		result.version, err = validateVersion(resp.Header.Get(healthCheck.VersionHeader))
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		result.message = fmt.Sprintf("the readiness probe returned status code %d", resp.StatusCode)
+		return
+	}
+	result.ready = true
+	result.message = "the readiness probe succeeded"
+	if err != nil && healthCheck.VersionPath == "" {
+		result.message = fmt.Sprintf("failed to get the running version, error: %v", err)
+	}
+
+	if healthCheck.VersionPath != "" {
+		if result.version, err = probeVersion(ctx, addon.Spec.ExternalAddress, healthCheck); err != nil {
+			result.message = fmt.Sprintf("failed to get the running version, error: %v", err)
+		}
+	}
+	return
+}
+
+func probe(ctx context.Context, address, path string) (resp *http.Response, err error) {
+	var target *url.URL
+	if target, err = url.Parse(strings.TrimSuffix(address, "/") + "/" + strings.TrimPrefix(path, "/")); err != nil {
+		return
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.User != nil {
+		err = fmt.Errorf("the external address must be an HTTP or HTTPS URL without the user info")
+		return
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil); err != nil {
+		return
+	}
+	resp, err = probeClient.Do(req)
+	return
+}
+
+// validateVersion makes sure the running version is short and looks like a version
+func validateVersion(version string) (string, error) {
+	if version = strings.TrimSpace(version); version == "" || versionRegexp.MatchString(version) {
+		return version, nil
+	}
+	return "", fmt.Errorf("invalid version %q", truncate(version, 64))
+}
+
+func truncate(str string, length int) string {
+	if len(str) > length {
+		return str[:length] + "..."
+	}
+	return str
+}
+
+func probeVersion(ctx context.Context, address string, healthCheck *v1alpha3.AddonHealthCheck) (version string, err error) {
+	var resp *http.Response
+	if resp, err = probe(ctx, address, healthCheck.VersionPath); err != nil {
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		return
+	}
+
+	var data []byte
+	if data, err = io.ReadAll(io.LimitReader(resp.Body, maxVersionResponseSize)); err != nil {
+		return
+	}
+	if healthCheck.VersionField == "" {
+		version, err = validateVersion(string(data))
+		return
+	}
+
+	content := map[string]interface{}{}
+	if err = json.Unmarshal(data, &content); err != nil {
+		return
+	}
+	var found bool
+	if version, found, err = unstructured.NestedString(content, strings.Split(healthCheck.VersionField, ".")...); err == nil && !found {
+		err = fmt.Errorf("cannot find field %s from the response", healthCheck.VersionField)
+	}
+	if err == nil {
+		version, err = validateVersion(version)
+	}
+	return
+}
+
+// getProbePeriod returns how often to check the addon, zero means there is no need to check it
+func getProbePeriod(addon *v1alpha3.Addon, strategy *v1alpha3.AddonStrategy) time.Duration {
+	healthCheck := strategy.Spec.HealthCheck
+	if healthCheck == nil || addon.Spec.ExternalAddress == "" {
+		return 0
+	}
+	if healthCheck.PeriodSeconds > 0 {
+		return time.Duration(healthCheck.PeriodSeconds) * time.Second
+	}
+	return defaultProbePeriod
+}
+
+// getTargetVersion returns the version to be installed. An upgrade goes through the versions of the upgrade path
+// in order, and it moves to the next version only if the installed one is ready and running. The old pods might
+// still pass the readiness probe, so the running version reported by the health check is required.
+func getTargetVersion(upgradePath []string, status *v1alpha3.AddonStatus, desired string, health healthResult) string {
+	installed := status.InstalledVersion
+	if installed == "" || sameVersion(installed, desired) {
+		return desired
+	}
+
+	from, to := indexOfVersion(upgradePath, installed), indexOfVersion(upgradePath, desired)
+	if from < 0 || to < from {
+		// a downgrade or a version out of the upgrade path
+		return desired
+	}
+	if !health.ready || !sameVersion(health.version, installed) {
+		// wait for the installed version
+		return installed
+	}
+	return upgradePath[from+1]
+}
+
+func indexOfVersion(versions []string, version string) int {
+	for i, item := range versions {
+		if sameVersion(item, version) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameVersion compares two versions, the prefix "v" is ignored
+func sameVersion(a, b string) bool {
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
+
+// setAddonStatus sets the phase and conditions of the addon according to the installation and the health check
+func setAddonStatus(status *v1alpha3.AddonStatus, desired string, resources []corev1.ObjectReference,
+	installed string, installErr error, health healthResult) {
+	status.Resources = resources
+	if installErr == nil {
+		status.InstalledVersion = installed
+	}
+	if health.checked {
+		status.RunningVersion = health.version
+	}
+
+	installedCond := metav1.Condition{
+		Type:    v1alpha3.AddonConditionTypeInstalled,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Succeeded",
+		Message: fmt.Sprintf("%d resources were installed", len(resources)),
+	}
+	if installErr != nil {
+		installedCond.Status = metav1.ConditionFalse
+		installedCond.Reason = "Failed"
+		installedCond.Message = installErr.Error()
+	}
+
+	readyCond := metav1.Condition{
+		Type:    v1alpha3.AddonConditionTypeReady,
+		Status:  metav1.ConditionUnknown,
+		Reason:  "NoHealthCheck",
+		Message: "the health check or the external address is not provided",
+	}
+	if health.checked {
+		readyCond.Status, readyCond.Reason, readyCond.Message = metav1.ConditionFalse, "ProbeFailed", health.message
+		if health.ready {
+			readyCond.Status, readyCond.Reason = metav1.ConditionTrue, "ProbeSucceeded"
+		}
+	}
+
+	upgradeCond := metav1.Condition{
+		Type:    v1alpha3.AddonConditionTypeUpgradeInProgress,
+		Status:  metav1.ConditionFalse,
+		Reason:  "UpToDate",
+		Message: fmt.Sprintf("the version is %s", desired),
+	}
+	switch {
+	case status.InstalledVersion != "" && !sameVersion(status.InstalledVersion, desired):
+		upgradeCond.Status, upgradeCond.Reason = metav1.ConditionTrue, "Upgrading"
+		upgradeCond.Message = fmt.Sprintf("upgrading from %s to %s", status.InstalledVersion, desired)
+		if health.version == "" {
+			upgradeCond.Reason = "UnknownRunningVersion"
+			upgradeCond.Message += ", waiting for the running version reported by the health check"
+		}
+	case status.RunningVersion != "" && !sameVersion(status.RunningVersion, desired):
+		upgradeCond.Status, upgradeCond.Reason = metav1.ConditionTrue, "WaitingForRollout"
+		upgradeCond.Message = fmt.Sprintf("the running version is %s, the desired version is %s", status.RunningVersion, desired)
+	}
+
+	// the addon which was installed before does not work
+	degradedCond := metav1.Condition{
+		Type:   v1alpha3.AddonConditionTypeDegraded,
+		Status: metav1.ConditionFalse,
+		Reason: "AsExpected",
+	}
+	if status.InstalledVersion != "" {
+		switch {
+		case installErr != nil:
+			degradedCond.Status, degradedCond.Reason, degradedCond.Message = metav1.ConditionTrue, "InstallFailed", installErr.Error()
+		case health.checked && !health.ready:
+			degradedCond.Status, degradedCond.Reason, degradedCond.Message = metav1.ConditionTrue, "ProbeFailed", health.message
+		}
+	}
+
+	for _, condition := range []metav1.Condition{installedCond, readyCond, upgradeCond, degradedCond} {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+
+	switch {
+	case installErr != nil && status.InstalledVersion == "":
+		status.Phase = v1alpha3.AddonPhaseFailed
+	case degradedCond.Status == metav1.ConditionTrue:
+		status.Phase = v1alpha3.AddonPhaseDegraded
+	case upgradeCond.Status == metav1.ConditionTrue:
+		status.Phase = v1alpha3.AddonPhaseUpgrading
+	case readyCond.Status == metav1.ConditionTrue:
+		status.Phase = v1alpha3.AddonPhaseReady
+	default:
+		status.Phase = v1alpha3.AddonPhaseInstalled
+	}
+}
+
+const (
+	// EventReasonReady represents the reason because of the addon becoming ready
+	EventReasonReady = "Ready"
+	// EventReasonDegraded represents the reason because of the addon becoming degraded
+	EventReasonDegraded = "Degraded"
+	// EventReasonUpgrading represents the reason because of starting to upgrade the addon
+	EventReasonUpgrading = "Upgrading"
+	// EventReasonUpgraded represents the reason because of finishing the upgrade of the addon
+	EventReasonUpgraded = "Upgraded"
+)
+
+// recordConditionEvents records the events if the conditions were changed
+func (r *Reconciler) recordConditionEvents(addon *v1alpha3.Addon, previous []metav1.Condition) {
+	changed := func(conditionType string) (condition *metav1.Condition, ok bool) {
+		condition = meta.FindStatusCondition(addon.Status.Conditions, conditionType)
+		old := meta.FindStatusCondition(previous, conditionType)
+		ok = condition != nil && (old == nil || old.Status != condition.Status)
+		return
+	}
+
+	if condition, ok := changed(v1alpha3.AddonConditionTypeReady); ok && condition.Status == metav1.ConditionTrue {
+		r.recorder.Event(addon, corev1.EventTypeNormal, EventReasonReady, condition.Message)
+	}
+	if condition, ok := changed(v1alpha3.AddonConditionTypeDegraded); ok && condition.Status == metav1.ConditionTrue {
+		r.recorder.Event(addon, corev1.EventTypeWarning, EventReasonDegraded, condition.Message)
+	}
+	if condition, ok := changed(v1alpha3.AddonConditionTypeUpgradeInProgress); ok {
+		if condition.Status == metav1.ConditionTrue {
+			r.recorder.Event(addon, corev1.EventTypeNormal, EventReasonUpgrading, condition.Message)
+		} else if meta.FindStatusCondition(previous, v1alpha3.AddonConditionTypeUpgradeInProgress) != nil {
+			r.recorder.Event(addon, corev1.EventTypeNormal, EventReasonUpgraded, condition.Message)
+		}
+	}
+}
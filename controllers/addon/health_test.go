@@ -0,0 +1,326 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are listening on the loopback address
+	probeClient = newProbeClient(func(net.IP) bool { return true })
+	os.Exit(m.Run())
+}
+
+func Test_checkHealth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Header().Set("X-Jenkins", "2.346.1")
+		case "/api/version":
+			_, _ = w.Write([]byte(`{"Version":"v2.4.0+91aefab"}`))
+		case "/api/server/version":
+			_, _ = w.Write([]byte("9.4.0\n"))
+		case "/api/invalid/version":
+			_, _ = w.Write([]byte("<html>the version page</html>"))
+		case "/redirect":
+			http.Redirect(w, r, "/login", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	addon := &v1alpha3.Addon{Spec: v1alpha3.AddonSpec{ExternalAddress: server.URL + "/"}}
+
+	tests := []struct {
+		name        string
+		addon       *v1alpha3.Addon
+		healthCheck *v1alpha3.AddonHealthCheck
+		want        healthResult
+	}{{
+		name:  "without the health check",
+		addon: addon,
+	}, {
+		name:        "without the external address",
+		addon:       &v1alpha3.Addon{},
+		healthCheck: &v1alpha3.AddonHealthCheck{},
+	}, {
+		name:        "version from the header",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "login", VersionHeader: "X-Jenkins"},
+		want:        healthResult{checked: true, ready: true, version: "2.346.1", message: "the readiness probe succeeded"},
+	}, {
+		name:        "version from the field of the JSON response",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "/api/version", VersionPath: "/api/version", VersionField: "Version"},
+		want:        healthResult{checked: true, ready: true, version: "v2.4.0+91aefab", message: "the readiness probe succeeded"},
+	}, {
+		name:        "version from the response",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "/api/server/version", VersionPath: "/api/server/version"},
+		want:        healthResult{checked: true, ready: true, version: "9.4.0", message: "the readiness probe succeeded"},
+	}, {
+		name:        "not ready",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "/health"},
+		want:        healthResult{checked: true, message: "the readiness probe returned status code 503"},
+	}, {
+		name:        "do not follow the redirects",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "/redirect"},
+		want:        healthResult{checked: true, message: "the readiness probe returned status code 302"},
+	}, {
+		name:        "invalid version",
+		addon:       addon,
+		healthCheck: &v1alpha3.AddonHealthCheck{Path: "/login", VersionPath: "/api/invalid/version"},
+		want: healthResult{checked: true, ready: true,
+			message: `failed to get the running version, error: invalid version "<html>the version page</html>"`},
+	}, {
+		name:        "not an HTTP address",
+		addon:       &v1alpha3.Addon{Spec: v1alpha3.AddonSpec{ExternalAddress: "file:///etc"}},
+		healthCheck: &v1alpha3.AddonHealthCheck{},
+		want:        healthResult{checked: true, message: "the external address must be an HTTP or HTTPS URL without the user info"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, checkHealth(context.Background(), tt.addon, tt.healthCheck))
+		})
+	}
+}
+
+func Test_isProbeTargetAllowed(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "::1", "169.254.169.254", "fe80::1", "0.0.0.0"} {
+		assert.False(t, isProbeTargetAllowed(net.ParseIP(ip)), ip)
+	}
+	for _, ip := range []string{"10.96.0.10", "192.168.1.1", "8.8.8.8"} {
+		assert.True(t, isProbeTargetAllowed(net.ParseIP(ip)), ip)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := newProbeClient(isProbeTargetAllowed).Do(req)
+	assert.NotNil(t, err)
+}
+
+func Test_getTargetVersion(t *testing.T) {
+	upgradePath := []string{"v1", "v2", "v3"}
+	tests := []struct {
+		name      string
+		installed string
+		desired   string
+		health    healthResult
+		want      string
+	}{{
+		name:    "first installation",
+		desired: "v3",
+		want:    "v3",
+	}, {
+		name:      "up to date",
+		installed: "v3",
+		desired:   "3",
+		want:      "3",
+	}, {
+		name:      "the next version",
+		installed: "v1",
+		desired:   "v2",
+		health:    healthResult{checked: true, ready: true, version: "v1"},
+		want:      "v2",
+	}, {
+		name:      "no health check",
+		installed: "v1",
+		desired:   "v2",
+		want:      "v1",
+	}, {
+		name:      "the old pods pass the readiness probe without the running version",
+		installed: "v2",
+		desired:   "v3",
+		health:    healthResult{checked: true, ready: true},
+		want:      "v2",
+	}, {
+		name:      "go through the upgrade path",
+		installed: "v1",
+		desired:   "v3",
+		health:    healthResult{checked: true, ready: true, version: "v1"},
+		want:      "v2",
+	}, {
+		name:      "wait for the installed version to be ready",
+		installed: "v1",
+		desired:   "v3",
+		health:    healthResult{checked: true},
+		want:      "v1",
+	}, {
+		name:      "wait for the installed version to be running",
+		installed: "v2",
+		desired:   "v3",
+		health:    healthResult{checked: true, ready: true, version: "v1"},
+		want:      "v2",
+	}, {
+		name:      "downgrade",
+		installed: "v3",
+		desired:   "v1",
+		want:      "v1",
+	}, {
+		name:      "out of the upgrade path",
+		installed: "v1",
+		desired:   "v4",
+		want:      "v4",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &v1alpha3.AddonStatus{InstalledVersion: tt.installed}
+			assert.Equal(t, tt.want, getTargetVersion(upgradePath, status, tt.desired, tt.health))
+		})
+	}
+}
+
+func Test_setAddonStatus_unknownRunningVersion(t *testing.T) {
+	status := &v1alpha3.AddonStatus{}
+	setAddonStatus(status, "v3", nil, "v1", nil, healthResult{checked: true, ready: true})
+	cond := meta.FindStatusCondition(status.Conditions, v1alpha3.AddonConditionTypeUpgradeInProgress)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "UnknownRunningVersion", cond.Reason)
+	assert.Equal(t, v1alpha3.AddonPhaseUpgrading, status.Phase)
+}
+
+func TestReconciler_upgrade(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	runningVersion, healthy := "v1", true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Version", runningVersion)
+	}))
+	defer server.Close()
+
+	strategy := &v1alpha3.AddonStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple"},
+		Spec: v1alpha3.AddStrategySpec{
+			Type: v1alpha3.AddonInstallStrategySimple,
+			YAML: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fake-config
+data:
+  version: {{.Spec.Version}}`,
+			HealthCheck: &v1alpha3.AddonHealthCheck{VersionHeader: "X-Version", PeriodSeconds: 30},
+			UpgradePath: []string{"v1", "v2", "v3"},
+		},
+	}
+	addon := &v1alpha3.Addon{
+		ObjectMeta: metav1.ObjectMeta{Name: "fake-addon", Namespace: "default"},
+		Spec: v1alpha3.AddonSpec{
+			ExternalAddress: server.URL,
+			Version:         "v3",
+			Strategy:        v1.LocalObjectReference{Name: "simple"},
+		},
+		Status: v1alpha3.AddonStatus{InstalledVersion: "v1"},
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(v1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	c := fake.NewClientBuilder().WithScheme(schema).WithRESTMapper(mapper).WithObjects(strategy, addon).Build()
+	recorder := record.NewFakeRecorder(100)
+	r := &Reconciler{Client: c, log: logr.Discard(), recorder: recorder}
+
+	reconcile := func() *v1alpha3.Addon {
+		latest := &v1alpha3.Addon{}
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fake-addon"}, latest)
+		assert.Nil(t, err)
+		result, err := r.addonHandle(context.Background(), latest)
+		assert.Nil(t, err)
+		assert.Equal(t, 30*time.Second, result.RequeueAfter)
+		return latest
+	}
+	installedVersion := func(c client.Client) string {
+		cm := &unstructured.Unstructured{}
+		cm.SetAPIVersion("v1")
+		cm.SetKind("ConfigMap")
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fake-config"}, cm)
+		assert.Nil(t, err)
+		version, _, _ := unstructured.NestedString(cm.Object, "data", "version")
+		return version
+	}
+
+	// v1 is ready, move to v2
+	result := reconcile()
+	assert.Equal(t, "v2", installedVersion(c))
+	assert.Equal(t, "v2", result.Status.InstalledVersion)
+	assert.Equal(t, v1alpha3.AddonPhaseUpgrading, result.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(result.Status.Conditions, v1alpha3.AddonConditionTypeUpgradeInProgress))
+
+	// v2 is not running yet
+	result = reconcile()
+	assert.Equal(t, "v2", installedVersion(c))
+	assert.Equal(t, "v1", result.Status.RunningVersion)
+
+	// v2 is running, move to v3
+	runningVersion = "v2"
+	result = reconcile()
+	assert.Equal(t, "v3", installedVersion(c))
+	cond := meta.FindStatusCondition(result.Status.Conditions, v1alpha3.AddonConditionTypeUpgradeInProgress)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "WaitingForRollout", cond.Reason)
+
+	// v3 is running
+	runningVersion = "v3"
+	result = reconcile()
+	assert.Equal(t, v1alpha3.AddonPhaseReady, result.Status.Phase)
+	assert.False(t, meta.IsStatusConditionTrue(result.Status.Conditions, v1alpha3.AddonConditionTypeUpgradeInProgress))
+	assert.True(t, meta.IsStatusConditionTrue(result.Status.Conditions, v1alpha3.AddonConditionTypeReady))
+
+	// the addon does not work
+	healthy = false
+	result = reconcile()
+	assert.Equal(t, v1alpha3.AddonPhaseDegraded, result.Status.Phase)
+	assert.True(t, meta.IsStatusConditionTrue(result.Status.Conditions, v1alpha3.AddonConditionTypeDegraded))
+	assert.False(t, meta.IsStatusConditionTrue(result.Status.Conditions, v1alpha3.AddonConditionTypeReady))
+
+	var reasons []string
+	for len(recorder.Events) > 0 {
+		reasons = append(reasons, <-recorder.Events)
+	}
+	assert.Equal(t, []string{
+		"Normal Ready the readiness probe succeeded",
+		"Normal Upgrading upgrading from v2 to v3",
+		"Normal Upgraded the version is v3",
+		"Warning Degraded the readiness probe returned status code 500",
+	}, reasons)
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;services;serviceaccounts,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups="helm.toolkit.fluxcd.io",resources=helmreleases,verbs=get;create;update;delete
+//+kubebuilder:rbac:groups="source.toolkit.fluxcd.io",resources=helmrepositories,verbs=get;create;update;delete
+
+// simpleHandle applies the multi-document YAML of the AddonStrategy
+func (r *Reconciler) simpleHandle(ctx context.Context, addon *v1alpha3.Addon, strategy *v1alpha3.AddonStrategy) (
+	resources []corev1.ObjectReference, err error) {
+	if strategy.Spec.YAML == "" {
+		r.recorder.Eventf(addon, corev1.EventTypeWarning, EventReasonMissing, "no yaml found from %s", strategy.Name)
+		err = fmt.Errorf("no yaml found from %s", strategy.Name)
+		return
+	}
+	resources, err = r.applyManifests(ctx, addon, strategy)
+	return
+}
+
+// operatorHandle applies the YAML of the operator if it exists, then creates the custom resource from the template
+func (r *Reconciler) operatorHandle(ctx context.Context, addon *v1alpha3.Addon, strategy *v1alpha3.AddonStrategy) (
+	resources []corev1.ObjectReference, err error) {
+	if resources, err = r.applyManifests(ctx, addon, strategy); err != nil {
+		return
+	}
+
+	if strategy.Spec.Template == "" {
+		r.recorder.Eventf(addon, corev1.EventTypeWarning, EventReasonMissing, "no template found from %s", strategy.Name)
+		err = fmt.Errorf("no template found from %s", strategy.Name)
+		return
+	}
+
+	var tpl string
+	if tpl, err = getTemplate(strategy.Spec.Template, addon); err != nil {
+		err = fmt.Errorf("failed to render template: %s, error: %v", strategy.Spec.Template, err)
+		return
+	}
+
+	// the apiVersion and kind could be omitted in the template
+	content := map[string]interface{}{}
+	if err = yaml.Unmarshal([]byte(tpl), &content); err != nil {
+		err = fmt.Errorf("failed parse template to addon, error is %v", err)
+		return
+	}
+	if content == nil {
+		content = map[string]interface{}{}
+	}
+	instance := &unstructured.Unstructured{Object: content}
+	if instance.GetAPIVersion() == "" {
+		instance.SetAPIVersion(strategy.Spec.Operator.APIVersion)
+	}
+	if instance.GetKind() == "" {
+		instance.SetKind(strategy.Spec.Operator.Kind)
+	}
+	instance.SetName(addon.Name)
+	instance.SetNamespace(getInstallNamespace(addon))
+
+	if err = r.apply(ctx, instance); err == nil {
+		resources = append(resources, getObjectReference(instance))
+	}
+	return
+}
+
+// helmHandle installs or upgrades the chart through a FluxCD HelmRelease, the parameters are taken as the values
+func (r *Reconciler) helmHandle(ctx context.Context, addon *v1alpha3.Addon, strategy *v1alpha3.AddonStrategy) (
+	resources []corev1.ObjectReference, err error) {
+	var repoURL, chart string
+	if repoURL, chart, err = parseHelmRepo(strategy.Spec.HelmRepo, strategy.Spec.Chart); err != nil {
+		return
+	}
+
+	var values *apiextensionsv1.JSON
+	if values, err = getHelmValues(strategy.Spec.Parameters, addon.Spec.Parameters); err != nil {
+		return
+	}
+
+	ns := getInstallNamespace(addon)
+	helmRepo := &unstructured.Unstructured{}
+	helmRepo.SetAPIVersion("source.toolkit.fluxcd.io/v1beta2")
+	helmRepo.SetKind("HelmRepository")
+	helmRepo.SetNamespace(ns)
+	helmRepo.SetName(addon.Name)
+	_ = unstructured.SetNestedField(helmRepo.Object, repoURL, "spec", "url")
+	_ = unstructured.SetNestedField(helmRepo.Object, "10m", "spec", "interval")
+	if strings.HasPrefix(repoURL, "oci://") {
+		_ = unstructured.SetNestedField(helmRepo.Object, "oci", "spec", "type")
+	}
+	if err = r.apply(ctx, helmRepo); err != nil {
+		return
+	}
+	resources = append(resources, getObjectReference(helmRepo))
+
+	version := addon.Spec.Version
+	if version == "" {
+		version = "*"
+	}
+	release := &helmv2.HelmRelease{
+		Spec: helmv2.HelmReleaseSpec{
+			Chart: helmv2.HelmChartTemplate{
+				Spec: helmv2.HelmChartTemplateSpec{
+					Chart:   chart,
+					Version: version,
+					SourceRef: helmv2.CrossNamespaceObjectReference{
+						Kind:      "HelmRepository",
+						Name:      helmRepo.GetName(),
+						Namespace: ns,
+					},
+				},
+			},
+			Interval: metav1.Duration{Duration: 10 * time.Minute},
+			Values:   values,
+		},
+	}
+	var releaseObj map[string]interface{}
+	if releaseObj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(release); err != nil {
+		return
+	}
+	helmRelease := &unstructured.Unstructured{Object: releaseObj}
+	helmRelease.SetGroupVersionKind(helmv2.GroupVersion.WithKind("HelmRelease"))
+	helmRelease.SetNamespace(ns)
+	helmRelease.SetName(addon.Name)
+	unstructured.RemoveNestedField(helmRelease.Object, "status")
+	if err = r.apply(ctx, helmRelease); err == nil {
+		resources = append(resources, getObjectReference(helmRelease))
+	}
+	return
+}
+
+// applyManifests creates or updates the objects of a multi-document YAML, the template is rendered with the addon.
+// The namespaced objects are always put into the install namespace of the addon, and the cluster-scoped ones
+// are rejected unless the AddonStrategy allows them.
+func (r *Reconciler) applyManifests(ctx context.Context, addon *v1alpha3.Addon, strategy *v1alpha3.AddonStrategy) (
+	resources []corev1.ObjectReference, err error) {
+	manifests := strategy.Spec.YAML
+	if manifests == "" {
+		return
+	}
+
+	var tpl string
+	if tpl, err = getTemplate(manifests, addon); err != nil {
+		err = fmt.Errorf("failed to render yaml, error: %v", err)
+		return
+	}
+
+	var objs []*unstructured.Unstructured
+	if objs, err = parseManifests(tpl); err != nil {
+		return
+	}
+	// check all the objects before applying any of them
+	for _, obj := range objs {
+		var namespaced bool
+		if namespaced, err = r.isNamespaced(obj); err != nil {
+			err = fmt.Errorf("failed to get the scope of %s %s, error: %v", obj.GetKind(), obj.GetName(), err)
+			return
+		}
+		if namespaced {
+			obj.SetNamespace(getInstallNamespace(addon))
+		} else if strategy.Spec.AllowClusterScoped {
+			obj.SetNamespace("")
+		} else {
+			err = fmt.Errorf("the cluster-scoped %s %s is not allowed by the AddonStrategy %s",
+				obj.GetKind(), obj.GetName(), strategy.Name)
+			return
+		}
+	}
+	for _, obj := range objs {
+		if err = r.apply(ctx, obj); err != nil {
+			err = fmt.Errorf("failed to apply %s %s, error: %v", obj.GetKind(), obj.GetName(), err)
+			return
+		}
+		resources = append(resources, getObjectReference(obj))
+	}
+	return
+}
+
+// isNamespaced checks if the kind of the object is namespaced
+func (r *Reconciler) isNamespaced(obj *unstructured.Unstructured) (namespaced bool, err error) {
+	gvk := obj.GroupVersionKind()
+	var mapping *meta.RESTMapping
+	if mapping, err = r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+		namespaced = mapping.Scope.Name() == meta.RESTScopeNameNamespace
+	}
+	return
+}
+
+func parseManifests(manifests string) (objs []*unstructured.Unstructured, err error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(manifests), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err = decoder.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				err = nil
+			} else {
+				err = fmt.Errorf("failed to parse yaml, error: %v", err)
+			}
+			return
+		}
+		if len(obj.Object) == 0 {
+			// skip the empty document
+			continue
+		}
+		if obj.GetAPIVersion() == "" || obj.GetKind() == "" || obj.GetName() == "" {
+			err = fmt.Errorf("apiVersion, kind and name are required in every document of the yaml")
+			return
+		}
+		objs = append(objs, obj)
+	}
+}
+
+// apply creates the object if it does not exist, or updates it
+func (r *Reconciler) apply(ctx context.Context, obj *unstructured.Unstructured) (err error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	if err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = r.Client.Create(ctx, obj)
+		}
+		return
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	err = r.Client.Update(ctx, obj)
+	return
+}
+
+// deleteResources deletes the objects, the ones which do not exist are ignored
+func (r *Reconciler) deleteResources(ctx context.Context, resources []corev1.ObjectReference) (err error) {
+	for _, resource := range resources {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(resource.APIVersion)
+		obj.SetKind(resource.Kind)
+		obj.SetNamespace(resource.Namespace)
+		obj.SetName(resource.Name)
+		if err = r.Client.Delete(ctx, obj); err != nil {
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				err = nil
+				continue
+			}
+			return
+		}
+		r.log.Info(fmt.Sprintf("deleted %s %s/%s", resource.Kind, resource.Namespace, resource.Name))
+	}
+	return
+}
+
+func getObjectReference(obj *unstructured.Unstructured) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+	}
+}
+
+// subtractResources returns the resources which belong to a but not b
+func subtractResources(a, b []corev1.ObjectReference) (result []corev1.ObjectReference) {
+	for _, resource := range a {
+		if !containsResource(b, resource) {
+			result = append(result, resource)
+		}
+	}
+	return
+}
+
+// mergeResources returns the resources which belong to a or b
+func mergeResources(a, b []corev1.ObjectReference) []corev1.ObjectReference {
+	return append(append([]corev1.ObjectReference{}, a...), subtractResources(b, a)...)
+}
+
+func containsResource(resources []corev1.ObjectReference, resource corev1.ObjectReference) bool {
+	for _, item := range resources {
+		if item.APIVersion == resource.APIVersion && item.Kind == resource.Kind &&
+			item.Namespace == resource.Namespace && item.Name == resource.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func getInstallNamespace(addon *v1alpha3.Addon) string {
+	if addon.Namespace != "" {
+		return addon.Namespace
+	}
+	return defaultNamespace
+}
+
+// parseHelmRepo returns the repository URL and the chart name
+func parseHelmRepo(helmRepo, chart string) (repoURL, chartName string, err error) {
+	if helmRepo == "" {
+		err = fmt.Errorf("helmRepo is required by the helm strategy")
+		return
+	}
+	if chart != "" {
+		return helmRepo, chart, nil
+	}
+
+	var repo *url.URL
+	if repo, err = url.Parse(helmRepo); err != nil {
+		return
+	}
+	if name := path.Base(repo.Path); name == "/" || name == "." {
+		err = fmt.Errorf("cannot find the chart name from %s", helmRepo)
+		return
+	} else {
+		chartName = name
+	}
+	repo.Path = path.Dir(repo.Path)
+	repoURL = strings.TrimSuffix(repo.String(), "/")
+	return
+}
+
+// getHelmValues converts the parameters to Helm values, the dot in a key stands for the nested field,
+// e.g. "image.tag=v1" is {"image":{"tag":"v1"}}. The parameters of the addon override the ones of the strategy.
+func getHelmValues(parameterSets ...map[string]string) (values *apiextensionsv1.JSON, err error) {
+	result := map[string]interface{}{}
+	for _, parameters := range parameterSets {
+		keys := make([]string, 0, len(parameters))
+		for key := range parameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fields := strings.Split(key, ".")
+			if err = unstructured.SetNestedField(result, parseHelmValue(parameters[key]), fields...); err != nil {
+				err = fmt.Errorf("invalid parameter %s, error: %v", key, err)
+				return
+			}
+		}
+	}
+	if len(result) == 0 {
+		return
+	}
+
+	var raw []byte
+	if raw, err = json.Marshal(result); err == nil {
+		values = &apiextensionsv1.JSON{Raw: raw}
+	}
+	return
+}
+
+func parseHelmValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return v
+	}
+	return value
+}
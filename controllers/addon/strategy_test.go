@@ -0,0 +1,389 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package addon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconciler_installStrategies(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
+	err = rbacv1.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	simple := &v1alpha3.AddonStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple"},
+		Spec: v1alpha3.AddStrategySpec{
+			Type: v1alpha3.AddonInstallStrategySimple,
+			YAML: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fake-config
+data:
+  version: {{.Spec.Version}}
+  image: {{index .Spec.Parameters "image"}}
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: fake-account
+  namespace: fake-ns`,
+		},
+	}
+	helm := &v1alpha3.AddonStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "helm"},
+		Spec: v1alpha3.AddStrategySpec{
+			Type:       v1alpha3.AddonInstallStrategyHelm,
+			HelmRepo:   "https://charts.jenkins.io/jenkins",
+			Parameters: map[string]string{"controller.image.tag": "lts", "persistence.enabled": "true"},
+		},
+	}
+	operator := &v1alpha3.AddonStrategy{
+		ObjectMeta: metav1.ObjectMeta{Name: "operator"},
+		Spec: v1alpha3.AddStrategySpec{
+			Type: v1alpha3.AddonInstallStrategyOperator,
+			Operator: v1.ObjectReference{
+				APIVersion: "devops.kubesphere.io/v1alpha1",
+				Kind:       "ReleaserController",
+			},
+			YAML: `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: releaser-controller`,
+			Template: `spec:
+  version: {{.Spec.Version}}`,
+		},
+	}
+	newAddon := func(strategy string) *v1alpha3.Addon {
+		return &v1alpha3.Addon{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fake-addon",
+				Namespace: "default",
+			},
+			Spec: v1alpha3.AddonSpec{
+				Version:    "v0.0.1",
+				Strategy:   v1.LocalObjectReference{Name: strategy},
+				Parameters: map[string]string{"controller.image.tag": "2.346.1", "image": "nginx:1.23"},
+			},
+		}
+	}
+	clusterScopedYAML := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fake-config
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: fake-role
+  namespace: fake-ns`
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, kind := range []string{"ConfigMap", "ServiceAccount", "Secret"} {
+		mapper.Add(v1.SchemeGroupVersion.WithKind(kind), meta.RESTScopeNamespace)
+	}
+	mapper.Add(rbacv1.SchemeGroupVersion.WithKind("ClusterRole"), meta.RESTScopeRoot)
+	getObject := func(c client.Client, apiVersion, kind, namespace, name string) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, obj)
+		return obj, err
+	}
+	getAddon := func(c client.Client) *v1alpha3.Addon {
+		addon := &v1alpha3.Addon{}
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fake-addon"}, addon)
+		assert.Nil(t, err)
+		return addon
+	}
+
+	tests := []struct {
+		name    string
+		addon   *v1alpha3.Addon
+		objects []client.Object
+		wantErr bool
+		verify  func(t *testing.T, c client.Client)
+	}{{
+		name:    "simple",
+		addon:   newAddon("simple"),
+		objects: []client.Object{simple.DeepCopy()},
+		verify: func(t *testing.T, c client.Client) {
+			cm, err := getObject(c, "v1", "ConfigMap", "default", "fake-config")
+			assert.Nil(t, err)
+			version, _, _ := unstructured.NestedString(cm.Object, "data", "version")
+			assert.Equal(t, "v0.0.1", version)
+			image, _, _ := unstructured.NestedString(cm.Object, "data", "image")
+			assert.Equal(t, "nginx:1.23", image)
+			// the namespaced objects are always installed into the namespace of the addon
+			_, err = getObject(c, "v1", "ServiceAccount", "default", "fake-account")
+			assert.Nil(t, err)
+			_, err = getObject(c, "v1", "ServiceAccount", "fake-ns", "fake-account")
+			assert.True(t, apierrors.IsNotFound(err))
+
+			addon := getAddon(c)
+			assert.Equal(t, v1alpha3.AddonPhaseInstalled, addon.Status.Phase)
+			assert.Len(t, addon.Status.Resources, 2)
+			assert.True(t, meta.IsStatusConditionTrue(addon.Status.Conditions, v1alpha3.AddonConditionTypeInstalled))
+			assert.Contains(t, addon.Finalizers, v1alpha3.AddonFinalizerName)
+		},
+	}, {
+		name: "simple, the resource removed from the yaml is deleted",
+		addon: func() *v1alpha3.Addon {
+			addon := newAddon("simple")
+			addon.Status.Resources = []v1.ObjectReference{{APIVersion: "v1", Kind: "Secret", Namespace: "default", Name: "stale"}}
+			return addon
+		}(),
+		objects: []client.Object{simple.DeepCopy(), &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "stale"}}},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "v1", "Secret", "default", "stale")
+			assert.True(t, apierrors.IsNotFound(err))
+			assert.Len(t, getAddon(c).Status.Resources, 2)
+		},
+	}, {
+		name:    "helm",
+		addon:   newAddon("helm"),
+		objects: []client.Object{helm.DeepCopy()},
+		verify: func(t *testing.T, c client.Client) {
+			repo, err := getObject(c, "source.toolkit.fluxcd.io/v1beta2", "HelmRepository", "default", "fake-addon")
+			assert.Nil(t, err)
+			url, _, _ := unstructured.NestedString(repo.Object, "spec", "url")
+			assert.Equal(t, "https://charts.jenkins.io", url)
+
+			release, err := getObject(c, "helm.toolkit.fluxcd.io/v2beta1", "HelmRelease", "default", "fake-addon")
+			assert.Nil(t, err)
+			chart, _, _ := unstructured.NestedString(release.Object, "spec", "chart", "spec", "chart")
+			assert.Equal(t, "jenkins", chart)
+			version, _, _ := unstructured.NestedString(release.Object, "spec", "chart", "spec", "version")
+			assert.Equal(t, "v0.0.1", version)
+			tag, _, _ := unstructured.NestedString(release.Object, "spec", "values", "controller", "image", "tag")
+			assert.Equal(t, "2.346.1", tag)
+			enabled, _, _ := unstructured.NestedBool(release.Object, "spec", "values", "persistence", "enabled")
+			assert.True(t, enabled)
+
+			assert.Equal(t, v1alpha3.AddonPhaseInstalled, getAddon(c).Status.Phase)
+		},
+	}, {
+		name:    "operator",
+		addon:   newAddon("operator"),
+		objects: []client.Object{operator.DeepCopy()},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "v1", "ServiceAccount", "default", "releaser-controller")
+			assert.Nil(t, err)
+			instance, err := getObject(c, "devops.kubesphere.io/v1alpha1", "ReleaserController", "default", "fake-addon")
+			assert.Nil(t, err)
+			version, _, _ := unstructured.NestedString(instance.Object, "spec", "version")
+			assert.Equal(t, "v0.0.1", version)
+			assert.Len(t, getAddon(c).Status.Resources, 2)
+		},
+	}, {
+		name:  "invalid yaml",
+		addon: newAddon("simple"),
+		objects: []client.Object{&v1alpha3.AddonStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "simple"},
+			Spec: v1alpha3.AddStrategySpec{
+				Type: v1alpha3.AddonInstallStrategySimple,
+				YAML: "kind: ConfigMap",
+			},
+		}},
+		wantErr: true,
+		verify: func(t *testing.T, c client.Client) {
+			addon := getAddon(c)
+			assert.Equal(t, v1alpha3.AddonPhaseFailed, addon.Status.Phase)
+			assert.False(t, meta.IsStatusConditionTrue(addon.Status.Conditions, v1alpha3.AddonConditionTypeInstalled))
+		},
+	}, {
+		name: "simple, the parameters cannot inject other objects",
+		addon: func() *v1alpha3.Addon {
+			addon := newAddon("simple")
+			addon.Spec.Parameters["image"] = "nginx\n---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: injected"
+			return addon
+		}(),
+		objects: []client.Object{simple.DeepCopy()},
+		verify: func(t *testing.T, c client.Client) {
+			cm, err := getObject(c, "v1", "ConfigMap", "default", "fake-config")
+			assert.Nil(t, err)
+			image, _, _ := unstructured.NestedString(cm.Object, "data", "image")
+			assert.Equal(t, "nginx\n---\napiVersion: v1\nkind: Secret\nmetadata:\n  name: injected", image)
+			_, err = getObject(c, "v1", "Secret", "default", "injected")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name:  "simple, cluster-scoped objects are not allowed by default",
+		addon: newAddon("cluster"),
+		objects: []client.Object{&v1alpha3.AddonStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec: v1alpha3.AddStrategySpec{
+				Type: v1alpha3.AddonInstallStrategySimple,
+				YAML: clusterScopedYAML,
+			},
+		}},
+		wantErr: true,
+		verify: func(t *testing.T, c client.Client) {
+			// nothing is applied if any object is not allowed
+			_, err := getObject(c, "v1", "ConfigMap", "default", "fake-config")
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = getObject(c, "rbac.authorization.k8s.io/v1", "ClusterRole", "", "fake-role")
+			assert.True(t, apierrors.IsNotFound(err))
+			assert.Equal(t, v1alpha3.AddonPhaseFailed, getAddon(c).Status.Phase)
+		},
+	}, {
+		name:  "simple, cluster-scoped objects are allowed by the strategy",
+		addon: newAddon("cluster"),
+		objects: []client.Object{&v1alpha3.AddonStrategy{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Spec: v1alpha3.AddStrategySpec{
+				Type:               v1alpha3.AddonInstallStrategySimple,
+				YAML:               clusterScopedYAML,
+				AllowClusterScoped: true,
+			},
+		}},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "v1", "ConfigMap", "default", "fake-config")
+			assert.Nil(t, err)
+			_, err = getObject(c, "rbac.authorization.k8s.io/v1", "ClusterRole", "", "fake-role")
+			assert.Nil(t, err)
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithRESTMapper(mapper).
+				WithObjects(append(tt.objects, tt.addon.DeepCopy())...).Build()
+			r := &Reconciler{
+				Client:   c,
+				log:      logr.Discard(),
+				recorder: record.NewFakeRecorder(100),
+			}
+			_, err := r.addonHandle(context.Background(), getAddon(c))
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			tt.verify(t, c)
+		})
+	}
+}
+
+func TestReconciler_cleanup(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	now := metav1.Now()
+	addon := &v1alpha3.Addon{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "fake-addon",
+			Namespace:         "default",
+			Finalizers:        []string{v1alpha3.AddonFinalizerName},
+			DeletionTimestamp: &now,
+		},
+		Status: v1alpha3.AddonStatus{
+			Phase: v1alpha3.AddonPhaseInstalled,
+			Resources: []v1.ObjectReference{
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "fake-config"},
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "not-exist"},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(schema).WithObjects(addon.DeepCopy(),
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "fake-config"}}).Build()
+	r := &Reconciler{
+		Client:   c,
+		log:      logr.Discard(),
+		recorder: record.NewFakeRecorder(100),
+	}
+	addon = &v1alpha3.Addon{}
+	err = c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fake-addon"}, addon)
+	assert.Nil(t, err)
+	_, err = r.cleanup(addon)
+	assert.Nil(t, err)
+	assert.NotContains(t, addon.Finalizers, v1alpha3.AddonFinalizerName)
+	assert.Equal(t, v1alpha3.AddonPhaseTerminating, addon.Status.Phase)
+
+	err = c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "fake-config"}, &v1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func Test_parseHelmRepo(t *testing.T) {
+	tests := []struct {
+		name        string
+		helmRepo    string
+		chart       string
+		wantRepoURL string
+		wantChart   string
+		wantErr     bool
+	}{{
+		name:        "repository and chart",
+		helmRepo:    "https://charts.jenkins.io",
+		chart:       "jenkins",
+		wantRepoURL: "https://charts.jenkins.io",
+		wantChart:   "jenkins",
+	}, {
+		name:        "chart in the repository",
+		helmRepo:    "https://kubesphere.io/charts/ks-devops",
+		wantRepoURL: "https://kubesphere.io/charts",
+		wantChart:   "ks-devops",
+	}, {
+		name:        "chart in an oci registry",
+		helmRepo:    "oci://ghcr.io/kubesphere/charts/ks-devops",
+		wantRepoURL: "oci://ghcr.io/kubesphere/charts",
+		wantChart:   "ks-devops",
+	}, {
+		name:     "without the chart",
+		helmRepo: "https://charts.jenkins.io",
+		wantErr:  true,
+	}, {
+		name:    "empty",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoURL, chart, err := parseHelmRepo(tt.helmRepo, tt.chart)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.wantRepoURL, repoURL)
+			assert.Equal(t, tt.wantChart, chart)
+		})
+	}
+}
+
+func Test_getHelmValues(t *testing.T) {
+	values, err := getHelmValues(nil, map[string]string{})
+	assert.Nil(t, err)
+	assert.Nil(t, values)
+
+	values, err = getHelmValues(map[string]string{"replicas": "1", "image.tag": "v1", "debug": "false"},
+		map[string]string{"image.tag": "v2"})
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"replicas":1,"debug":false,"image":{"tag":"v2"}}`, string(values.Raw))
+
+	_, err = getHelmValues(map[string]string{"image": "nginx", "image.tag": "v1"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	goscm "github.com/jenkins-x/go-scm/scm"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applicationsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applicationsets/status,verbs=get;update
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applicationsets/finalizers,verbs=update
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=cluster.kubesphere.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=gitrepositories,verbs=get
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const groupName = "applicationset"
+
+// gitRequeuePeriod is the period to refresh the directories of the Git repositories
+const gitRequeuePeriod = 3 * time.Minute
+
+// Reconciler generates the Applications from the template of an ApplicationSet for each target,
+// and prunes the Applications whose target disappears
+type Reconciler struct {
+	client.Client
+	log      logr.Logger
+	recorder record.EventRecorder
+
+	// newGitClient creates the client to read the Git repository, it's for the test purpose
+	newGitClient func(repo *v1alpha3.GitRepository) (*goscm.Client, error)
+}
+
+// Reconcile makes sure the generated Applications are expected
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	r.log.Info(fmt.Sprintf("start to reconcile application set: %s", req.String()))
+
+	appSet := &v1alpha1.ApplicationSet{}
+	if err = r.Get(ctx, req.NamespacedName, appSet); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+	if !appSet.DeletionTimestamp.IsZero() {
+		return
+	}
+	if hasGitGenerator(appSet) {
+		// the Git repositories are not watched, refresh the directories periodically
+		result = ctrl.Result{RequeueAfter: gitRequeuePeriod}
+	}
+
+	var params []map[string]string
+	if params, err = r.generate(ctx, appSet); err != nil {
+		r.recorder.Eventf(appSet, corev1.EventTypeWarning, "FailedGenerate", "failed to generate the parameters: %v", err)
+		if statusErr := r.updateStatus(ctx, appSet, nil, err); statusErr != nil {
+			err = statusErr
+		}
+		return
+	}
+
+	var names []string
+	var syncErr error
+	if names, syncErr = r.syncApplications(ctx, appSet, params); syncErr != nil {
+		r.recorder.Eventf(appSet, corev1.EventTypeWarning, "FailedSync", "failed to sync the Applications: %v", syncErr)
+	}
+	err = r.updateStatus(ctx, appSet, names, syncErr)
+	return
+}
+
+// syncApplications creates or updates the desired Applications, and prunes the others.
+// The pruning is skipped if any desired Application is invalid.
+func (r *Reconciler) syncApplications(ctx context.Context, appSet *v1alpha1.ApplicationSet, params []map[string]string) (
+	names []string, err error) {
+	desired := map[string]*v1alpha1.Application{}
+	for _, param := range params {
+		var app *v1alpha1.Application
+		if app, err = renderApplication(appSet, param); err != nil {
+			return
+		}
+		if _, ok := desired[app.Name]; ok {
+			err = fmt.Errorf("the Application name %q is generated more than once", app.Name)
+			return
+		}
+		desired[app.Name] = app
+		names = append(names, app.Name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err = r.createOrUpdate(ctx, appSet, desired[name]); err != nil {
+			return
+		}
+	}
+
+	if appSet.Spec.PreserveOnDeletion {
+		return
+	}
+	appList := &v1alpha1.ApplicationList{}
+	if err = r.List(ctx, appList, client.InNamespace(appSet.Namespace),
+		client.MatchingLabels{v1alpha1.ApplicationSetLabelKey: appSet.Name}); err != nil {
+		return
+	}
+	for i := range appList.Items {
+		app := &appList.Items[i]
+		if _, ok := desired[app.Name]; ok || !app.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if err = client.IgnoreNotFound(r.Delete(ctx, app)); err != nil {
+			return
+		}
+		r.recorder.Eventf(appSet, corev1.EventTypeNormal, "Pruned", "Application %s was pruned", app.Name)
+	}
+	return
+}
+
+func (r *Reconciler) createOrUpdate(ctx context.Context, appSet *v1alpha1.ApplicationSet, app *v1alpha1.Application) (err error) {
+	existing := &v1alpha1.Application{}
+	if err = r.Get(ctx, client.ObjectKeyFromObject(app), existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			if err = r.Create(ctx, app); err == nil {
+				r.recorder.Eventf(appSet, corev1.EventTypeNormal, "Created", "Application %s was created", app.Name)
+			}
+		}
+		return
+	}
+
+	if existing.Labels[v1alpha1.ApplicationSetLabelKey] != appSet.Name {
+		err = fmt.Errorf("the Application %s exists, but it does not belong to this ApplicationSet", app.Name)
+		return
+	}
+
+	// keep the operations which are requested but not handled yet
+	if app.Spec.ArgoApp != nil && existing.Spec.ArgoApp != nil {
+		app.Spec.ArgoApp.Operation = existing.Spec.ArgoApp.Operation
+	}
+	if app.Spec.FluxApp != nil && existing.Spec.FluxApp != nil {
+		app.Spec.FluxApp.Operation = existing.Spec.FluxApp.Operation
+	}
+	if app.Spec.Rollout != nil && existing.Spec.Rollout != nil {
+		app.Spec.Rollout.Operation = existing.Spec.Rollout.Operation
+	}
+
+	// the labels and annotations could be added by other controllers, only the generated ones are overridden
+	updated := existing.DeepCopy()
+	updated.Spec = app.Spec
+	updated.OwnerReferences = app.OwnerReferences
+	if updated.Labels == nil {
+		updated.Labels = map[string]string{}
+	}
+	for key, val := range app.Labels {
+		updated.Labels[key] = val
+	}
+	if len(app.Annotations) > 0 && updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	for key, val := range app.Annotations {
+		updated.Annotations[key] = val
+	}
+
+	if equality.Semantic.DeepEqual(existing, updated) {
+		return
+	}
+	err = r.Update(ctx, updated)
+	return
+}
+
+func (r *Reconciler) updateStatus(ctx context.Context, appSet *v1alpha1.ApplicationSet, names []string, syncErr error) error {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTypeReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Generated",
+		Message:            fmt.Sprintf("%d Applications were generated", len(names)),
+		ObservedGeneration: appSet.Generation,
+	}
+	if syncErr != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Failed"
+		condition.Message = syncErr.Error()
+	}
+	if names != nil || syncErr == nil {
+		// keep the last known Applications if the parameters cannot be generated
+		appSet.Status.Applications = names
+	}
+	meta.SetStatusCondition(&appSet.Status.Conditions, condition)
+	return r.Status().Update(ctx, appSet)
+}
+
+func hasGitGenerator(appSet *v1alpha1.ApplicationSet) bool {
+	for _, generator := range appSet.Spec.Generators {
+		if generator.GitDirectories != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func hasClusterGenerator(appSet *v1alpha1.ApplicationSet) bool {
+	for _, generator := range appSet.Spec.Generators {
+		if generator.Clusters != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// applicationSetOfApplication maps a generated Application to its ApplicationSet
+func applicationSetOfApplication(obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[v1alpha1.ApplicationSetLabelKey]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name},
+	}}
+}
+
+// applicationSetsOfCluster maps a cluster to all the ApplicationSets which have the cluster generator
+func (r *Reconciler) applicationSetsOfCluster(_ client.Object) (requests []reconcile.Request) {
+	appSetList := &v1alpha1.ApplicationSetList{}
+	if err := r.List(context.Background(), appSetList); err != nil {
+		r.log.Error(err, "failed to list the ApplicationSets")
+		return
+	}
+	for i := range appSetList.Items {
+		appSet := &appSetList.Items[i]
+		if hasClusterGenerator(appSet) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(appSet)})
+		}
+	}
+	return
+}
+
+// GetName returns the name of this controller
+func (r *Reconciler) GetName() string {
+	return "ApplicationSetController"
+}
+
+// GetGroupName returns the group name of this controller
+func (r *Reconciler) GetGroupName() string {
+	return groupName
+}
+
+// SetupWithManager setups the log and recorder
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.log = ctrl.Log.WithName(r.GetName())
+	r.recorder = mgr.GetEventRecorderFor(r.GetName())
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("application_set").
+		For(&v1alpha1.ApplicationSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &v1alpha1.Application{}},
+			handler.EnqueueRequestsFromMapFunc(applicationSetOfApplication),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: createBareClusterObject()},
+			handler.EnqueueRequestsFromMapFunc(r.applicationSetsOfCluster),
+			builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}))).
+		Complete(r)
+}
@@ -0,0 +1,326 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestReconciler_Reconcile(t *testing.T) {
+	createAppSet := func(preserve bool, names ...string) *v1alpha1.ApplicationSet {
+		var elements []map[string]string
+		for _, name := range names {
+			elements = append(elements, map[string]string{"name": name})
+		}
+		return &v1alpha1.ApplicationSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-set"},
+			Spec: v1alpha1.ApplicationSetSpec{
+				Generators: []v1alpha1.ApplicationSetGenerator{{
+					List: &v1alpha1.ListGenerator{Elements: elements},
+				}},
+				Template: v1alpha1.ApplicationSetTemplate{
+					Metadata: v1alpha1.ApplicationSetTemplateMeta{Name: "{{name}}-guestbook"},
+					Spec: v1alpha1.ApplicationSpec{
+						Kind: v1alpha1.ArgoCD,
+						ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+							Destination: v1alpha1.ApplicationDestination{Name: "{{name}}", Namespace: "guestbook"},
+						}},
+					},
+				},
+				PreserveOnDeletion: preserve,
+			},
+		}
+	}
+	createApp := func(name, appSet string, destination string) *v1alpha1.Application {
+		app := &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: name},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.ArgoCD,
+				ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+					Destination: v1alpha1.ApplicationDestination{Name: destination, Namespace: "guestbook"},
+				}},
+			},
+		}
+		if appSet != "" {
+			app.Labels = map[string]string{v1alpha1.ApplicationSetLabelKey: appSet}
+		}
+		return app
+	}
+	getApp := func(c client.Client, name string) (*v1alpha1.Application, error) {
+		app := &v1alpha1.Application{}
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: name}, app)
+		return app, err
+	}
+	getAppSet := func(t *testing.T, c client.Client) *v1alpha1.ApplicationSet {
+		appSet := &v1alpha1.ApplicationSet{}
+		assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-set"}, appSet))
+		return appSet
+	}
+
+	tests := []struct {
+		name   string
+		objs   []client.Object
+		verify func(t *testing.T, c client.Client)
+	}{{
+		name: "not found",
+		verify: func(t *testing.T, c client.Client) {
+			appList := &v1alpha1.ApplicationList{}
+			assert.Nil(t, c.List(context.Background(), appList))
+			assert.Empty(t, appList.Items)
+		},
+	}, {
+		name: "create the Applications",
+		objs: []client.Object{createAppSet(false, "host", "member")},
+		verify: func(t *testing.T, c client.Client) {
+			app, err := getApp(c, "member-guestbook")
+			assert.Nil(t, err)
+			assert.Equal(t, "member", app.Spec.ArgoApp.Spec.Destination.Name)
+			assert.Equal(t, "fake-set", app.Labels[v1alpha1.ApplicationSetLabelKey])
+			assert.Len(t, app.OwnerReferences, 1)
+
+			appSet := getAppSet(t, c)
+			assert.Equal(t, []string{"host-guestbook", "member-guestbook"}, appSet.Status.Applications)
+			assert.True(t, meta.IsStatusConditionTrue(appSet.Status.Conditions, v1alpha1.ConditionTypeReady))
+		},
+	}, {
+		name: "update the Application, keep the operation and the labels from others",
+		objs: []client.Object{createAppSet(false, "member"), func() *v1alpha1.Application {
+			app := createApp("member-guestbook", "fake-set", "old")
+			app.Labels[v1alpha1.SyncStatusLabelKey] = "Synced"
+			app.Spec.ArgoApp.Operation = &v1alpha1.Operation{Sync: &v1alpha1.SyncOperation{Revision: "main"}}
+			return app
+		}()},
+		verify: func(t *testing.T, c client.Client) {
+			app, err := getApp(c, "member-guestbook")
+			assert.Nil(t, err)
+			assert.Equal(t, "member", app.Spec.ArgoApp.Spec.Destination.Name)
+			assert.Equal(t, "Synced", app.Labels[v1alpha1.SyncStatusLabelKey])
+			if assert.NotNil(t, app.Spec.ArgoApp.Operation) {
+				assert.Equal(t, "main", app.Spec.ArgoApp.Operation.Sync.Revision)
+			}
+		},
+	}, {
+		name: "prune the Application which is not generated anymore",
+		objs: []client.Object{createAppSet(false, "member"),
+			createApp("removed-guestbook", "fake-set", "removed"),
+			createApp("other", "", "removed")},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getApp(c, "removed-guestbook")
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = getApp(c, "other")
+			assert.Nil(t, err)
+			_, err = getApp(c, "member-guestbook")
+			assert.Nil(t, err)
+		},
+	}, {
+		name: "preserve the Application which is not generated anymore",
+		objs: []client.Object{createAppSet(true, "member"),
+			createApp("removed-guestbook", "fake-set", "removed")},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getApp(c, "removed-guestbook")
+			assert.Nil(t, err)
+			app, err := getApp(c, "member-guestbook")
+			assert.Nil(t, err)
+			assert.Empty(t, app.OwnerReferences)
+		},
+	}, {
+		name: "the Application does not belong to the ApplicationSet",
+		objs: []client.Object{createAppSet(false, "member"),
+			createApp("member-guestbook", "", "old"),
+			createApp("removed-guestbook", "fake-set", "removed")},
+		verify: func(t *testing.T, c client.Client) {
+			app, err := getApp(c, "member-guestbook")
+			assert.Nil(t, err)
+			assert.Equal(t, "old", app.Spec.ArgoApp.Spec.Destination.Name)
+			// skip the pruning if any Application cannot be synced
+			_, err = getApp(c, "removed-guestbook")
+			assert.Nil(t, err)
+
+			appSet := getAppSet(t, c)
+			assert.True(t, meta.IsStatusConditionFalse(appSet.Status.Conditions, v1alpha1.ConditionTypeReady))
+		},
+	}, {
+		name: "duplicated Application names",
+		objs: []client.Object{createAppSet(false, "member", "member")},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getApp(c, "member-guestbook")
+			assert.True(t, apierrors.IsNotFound(err))
+
+			appSet := getAppSet(t, c)
+			condition := meta.FindStatusCondition(appSet.Status.Conditions, v1alpha1.ConditionTypeReady)
+			if assert.NotNil(t, condition) {
+				assert.Equal(t, metav1.ConditionFalse, condition.Status)
+				assert.Contains(t, condition.Message, "more than once")
+			}
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(tt.objs...).Build()
+			r := &Reconciler{
+				Client:   c,
+				log:      logr.New(log.NullLogSink{}),
+				recorder: &record.FakeRecorder{},
+			}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-set"},
+			})
+			assert.Nil(t, err)
+			tt.verify(t, c)
+		})
+	}
+}
+
+func TestReconciler_failedGenerate(t *testing.T) {
+	appSet := &v1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-set"},
+		Spec: v1alpha1.ApplicationSetSpec{
+			Generators: []v1alpha1.ApplicationSetGenerator{{
+				GitDirectories: &v1alpha1.GitDirectoryGenerator{
+					Repository:  v1.LocalObjectReference{Name: "not-found"},
+					Directories: []v1alpha1.GitDirectoryGeneratorItem{{Path: "*"}},
+				},
+			}},
+			Template: v1alpha1.ApplicationSetTemplate{
+				Metadata: v1alpha1.ApplicationSetTemplateMeta{Name: "{{path.basename}}"},
+			},
+		},
+		Status: v1alpha1.ApplicationSetStatus{Applications: []string{"guestbook"}},
+	}
+	c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(appSet).Build()
+	r := &Reconciler{
+		Client:   c,
+		log:      logr.New(log.NullLogSink{}),
+		recorder: &record.FakeRecorder{},
+	}
+	_, err := r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-set"},
+	})
+	assert.NotNil(t, err)
+
+	latest := &v1alpha1.ApplicationSet{}
+	assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-set"}, latest))
+	assert.Equal(t, []string{"guestbook"}, latest.Status.Applications)
+	assert.True(t, meta.IsStatusConditionFalse(latest.Status.Conditions, v1alpha1.ConditionTypeReady))
+}
+
+func TestReconciler_gitRequeue(t *testing.T) {
+	repo := &v1alpha3.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-repo"},
+		Spec:       v1alpha3.GitRepositorySpec{Owner: "fake", Repo: "repo"},
+	}
+	appSet := &v1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-set"},
+		Spec: v1alpha1.ApplicationSetSpec{
+			Generators: []v1alpha1.ApplicationSetGenerator{{
+				GitDirectories: &v1alpha1.GitDirectoryGenerator{
+					Repository:  v1.LocalObjectReference{Name: "fake-repo"},
+					Directories: []v1alpha1.GitDirectoryGeneratorItem{{Path: "apps/*"}},
+				},
+			}},
+			Template: v1alpha1.ApplicationSetTemplate{
+				Metadata: v1alpha1.ApplicationSetTemplateMeta{Name: "{{path.basename}}"},
+				Spec: v1alpha1.ApplicationSpec{
+					Kind: v1alpha1.ArgoCD,
+					ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+						Source: v1alpha1.ApplicationSource{Path: "{{path}}"},
+					}},
+				},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(repo, appSet).Build()
+	r := &Reconciler{
+		Client:       c,
+		log:          logr.New(log.NullLogSink{}),
+		recorder:     &record.FakeRecorder{},
+		newGitClient: newFakeGitClient(t, "apps/guestbook"),
+	}
+	result, err := r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-set"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, gitRequeuePeriod, result.RequeueAfter)
+
+	app := &v1alpha1.Application{}
+	assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "guestbook"}, app))
+	assert.Equal(t, "apps/guestbook", app.Spec.ArgoApp.Spec.Source.Path)
+}
+
+func TestReconciler_applicationSetsOfCluster(t *testing.T) {
+	clusterSet := &v1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "clusters"},
+		Spec: v1alpha1.ApplicationSetSpec{Generators: []v1alpha1.ApplicationSetGenerator{{
+			Clusters: &v1alpha1.ClusterGenerator{},
+		}}},
+	}
+	listSet := &v1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "list"},
+		Spec: v1alpha1.ApplicationSetSpec{Generators: []v1alpha1.ApplicationSetGenerator{{
+			List: &v1alpha1.ListGenerator{},
+		}}},
+	}
+	r := &Reconciler{
+		Client: fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(clusterSet, listSet).Build(),
+		log:    logr.New(log.NullLogSink{}),
+	}
+	requests := r.applicationSetsOfCluster(createCluster("member", nil, ""))
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, "clusters", requests[0].Name)
+	}
+
+	assert.Empty(t, applicationSetOfApplication(&v1alpha1.Application{}))
+	requests = applicationSetOfApplication(&v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "fake-ns", Labels: map[string]string{v1alpha1.ApplicationSetLabelKey: "clusters"},
+	}})
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, types.NamespacedName{Namespace: "fake-ns", Name: "clusters"}, requests[0].NamespacedName)
+	}
+}
+
+func TestReconciler_GetName(t *testing.T) {
+	r := &Reconciler{}
+	assert.Equal(t, "ApplicationSetController", r.GetName())
+	assert.Equal(t, "applicationset", r.GetGroupName())
+}
+
+func TestReconciler_SetupWithManager(t *testing.T) {
+	schema := newScheme(t)
+	r := &Reconciler{}
+	err := r.SetupWithManager(&core.FakeManager{
+		Client: fake.NewClientBuilder().WithScheme(schema).Build(),
+		Scheme: schema,
+	})
+	assert.Nil(t, err)
+}
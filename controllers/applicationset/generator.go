@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	goscm "github.com/jenkins-x/go-scm/scm"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/client/git"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// inClusterServer is the address of the host cluster which is used by the GitOps engines
+const inClusterServer = "https://kubernetes.default.svc"
+
+// generate returns the parameter sets of all the generators
+func (r *Reconciler) generate(ctx context.Context, appSet *v1alpha1.ApplicationSet) (params []map[string]string, err error) {
+	for i := range appSet.Spec.Generators {
+		generator := appSet.Spec.Generators[i]
+
+		var result []map[string]string
+		switch {
+		case generator.List != nil:
+			result = generator.List.Elements
+		case generator.Clusters != nil:
+			result, err = r.generateFromClusters(ctx, generator.Clusters)
+		case generator.GitDirectories != nil:
+			result, err = r.generateFromGitDirectories(ctx, appSet.Namespace, generator.GitDirectories)
+		default:
+			err = fmt.Errorf("the generator %d is empty", i)
+		}
+		if err != nil {
+			return
+		}
+		params = append(params, result...)
+	}
+	return
+}
+
+// generateFromClusters returns the parameters of the selected KubeSphere clusters
+func (r *Reconciler) generateFromClusters(ctx context.Context, generator *v1alpha1.ClusterGenerator) (
+	params []map[string]string, err error) {
+	var selector client.MatchingLabelsSelector
+	if selector.Selector, err = metav1.LabelSelectorAsSelector(&generator.Selector); err != nil {
+		return
+	}
+
+	clusterList := createBareClusterList()
+	if err = r.List(ctx, clusterList, selector); err != nil {
+		return
+	}
+
+	for i := range clusterList.Items {
+		cluster := clusterList.Items[i]
+		param := map[string]string{
+			"name":   cluster.GetName(),
+			"server": getClusterServer(&cluster),
+		}
+		for key, val := range cluster.GetLabels() {
+			param["metadata.labels."+key] = val
+		}
+		for key, val := range generator.Values {
+			param["values."+key] = renderString(val, param)
+		}
+		params = append(params, param)
+	}
+	return
+}
+
+func getClusterServer(cluster *unstructured.Unstructured) (server string) {
+	if _, ok := cluster.GetLabels()["cluster-role.kubesphere.io/host"]; ok {
+		return inClusterServer
+	}
+	server, _, _ = unstructured.NestedString(cluster.Object, "spec", "connection", "kubernetesAPIEndpoint")
+	return
+}
+
+// generateFromGitDirectories returns the parameters of the matched directories of a Git repository
+func (r *Reconciler) generateFromGitDirectories(ctx context.Context, namespace string,
+	generator *v1alpha1.GitDirectoryGenerator) (params []map[string]string, err error) {
+	repo := &v1alpha3.GitRepository{}
+	if err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: generator.Repository.Name}, repo); err != nil {
+		return
+	}
+
+	newGitClient := r.newGitClient
+	if newGitClient == nil {
+		newGitClient = r.getGitClient
+	}
+	var gitClient *goscm.Client
+	if gitClient, err = newGitClient(repo); err != nil {
+		return
+	}
+
+	repoAddress := git.GetRepositoryName(repo)
+	listed := map[string][]string{}
+	included := map[string]bool{}
+	excluded := map[string]bool{}
+	for _, item := range generator.Directories {
+		pattern := strings.Trim(item.Path, "/")
+		parent := path.Dir(pattern)
+		if parent == "." {
+			parent = ""
+		}
+
+		dirs, ok := listed[parent]
+		if !ok {
+			if dirs, err = listDirectories(ctx, gitClient, repoAddress, parent, generator.Revision); err != nil {
+				err = fmt.Errorf("failed to list the directories of %s in %s: %v", parent, repoAddress, err)
+				return
+			}
+			listed[parent] = dirs
+		}
+
+		for _, dir := range dirs {
+			var ok bool
+			if ok, err = path.Match(pattern, dir); err != nil {
+				return
+			} else if ok && item.Exclude {
+				excluded[dir] = true
+			} else if ok {
+				included[dir] = true
+			}
+		}
+	}
+
+	// the excluded directories take precedence no matter the order of the patterns
+	var paths []string
+	for dir := range included {
+		if !excluded[dir] {
+			paths = append(paths, dir)
+		}
+	}
+	sort.Strings(paths)
+	for _, dir := range paths {
+		params = append(params, map[string]string{
+			"path":          dir,
+			"path.basename": path.Base(dir),
+		})
+	}
+	return
+}
+
+// listDirectories returns the paths of the sub-directories of the given directory
+func listDirectories(ctx context.Context, gitClient *goscm.Client, repo, dir, ref string) (dirs []string, err error) {
+	var entries []*goscm.FileEntry
+	if entries, _, err = gitClient.Contents.List(ctx, repo, dir, ref); err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.Type == "dir" {
+			dirs = append(dirs, path.Join(dir, entry.Name))
+		}
+	}
+	return
+}
+
+func (r *Reconciler) getGitClient(repo *v1alpha3.GitRepository) (*goscm.Client, error) {
+	return git.NewRepositoryClientFactory(repo, r.Client).GetClient()
+}
+
+func createBareClusterList() *unstructured.UnstructuredList {
+	clusterList := &unstructured.UnstructuredList{}
+	clusterList.SetAPIVersion("cluster.kubesphere.io/v1alpha1")
+	clusterList.SetKind("ClusterList")
+	return clusterList
+}
+
+func createBareClusterObject() *unstructured.Unstructured {
+	cluster := &unstructured.Unstructured{}
+	cluster.SetAPIVersion("cluster.kubesphere.io/v1alpha1")
+	cluster.SetKind("Cluster")
+	return cluster
+}
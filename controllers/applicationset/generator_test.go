@@ -0,0 +1,168 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goscm "github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	schema := runtime.NewScheme()
+	assert.Nil(t, v1alpha1.AddToScheme(schema))
+	assert.Nil(t, v1alpha3.AddToScheme(schema))
+	return schema
+}
+
+func createCluster(name string, labels map[string]string, server string) *unstructured.Unstructured {
+	cluster := createBareClusterObject()
+	cluster.SetName(name)
+	cluster.SetLabels(labels)
+	_ = unstructured.SetNestedField(cluster.Object, server, "spec", "connection", "kubernetesAPIEndpoint")
+	return cluster
+}
+
+// newFakeGitClient returns a fake git client which serves the given directories of the repository 'fake/repo'
+func newFakeGitClient(t *testing.T, dirs ...string) func(*v1alpha3.GitRepository) (*goscm.Client, error) {
+	gitClient, data := fakescm.NewDefault()
+	data.ContentDir = t.TempDir()
+	repoDir := filepath.Join(data.ContentDir, "fake", "repo")
+	for _, dir := range append(dirs, "") {
+		assert.Nil(t, os.MkdirAll(filepath.Join(repoDir, dir), 0o755))
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(repoDir, "README.md"), nil, 0o644))
+	return func(*v1alpha3.GitRepository) (*goscm.Client, error) {
+		return gitClient, nil
+	}
+}
+
+func TestReconciler_generate(t *testing.T) {
+	clusters := []runtime.Object{
+		createCluster("host", map[string]string{"cluster-role.kubesphere.io/host": "", "env": "dev"}, "https://host"),
+		createCluster("member", map[string]string{"env": "prod"}, "https://member"),
+	}
+	repo := &v1alpha3.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-repo"},
+		Spec:       v1alpha3.GitRepositorySpec{Provider: "github", URL: "https://github.com/fake/repo.git"},
+	}
+
+	tests := []struct {
+		name       string
+		generators []v1alpha1.ApplicationSetGenerator
+		dirs       []string
+		want       []map[string]string
+		wantErr    bool
+	}{{
+		name: "list",
+		generators: []v1alpha1.ApplicationSetGenerator{{
+			List: &v1alpha1.ListGenerator{Elements: []map[string]string{{"name": "a"}, {"name": "b"}}},
+		}},
+		want: []map[string]string{{"name": "a"}, {"name": "b"}},
+	}, {
+		name: "all clusters",
+		generators: []v1alpha1.ApplicationSetGenerator{{
+			Clusters: &v1alpha1.ClusterGenerator{Values: map[string]string{"namespace": "{{name}}-guestbook"}},
+		}},
+		want: []map[string]string{{
+			"name":                "host",
+			"server":              inClusterServer,
+			"metadata.labels.env": "dev",
+			"metadata.labels.cluster-role.kubesphere.io/host": "",
+			"values.namespace": "host-guestbook",
+		}, {
+			"name":                "member",
+			"server":              "https://member",
+			"metadata.labels.env": "prod",
+			"values.namespace":    "member-guestbook",
+		}},
+	}, {
+		name: "selected clusters",
+		generators: []v1alpha1.ApplicationSetGenerator{{
+			Clusters: &v1alpha1.ClusterGenerator{Selector: metav1.LabelSelector{
+				MatchLabels: map[string]string{"env": "prod"},
+			}},
+		}},
+		want: []map[string]string{{
+			"name":                "member",
+			"server":              "https://member",
+			"metadata.labels.env": "prod",
+		}},
+	}, {
+		name: "git directories",
+		generators: []v1alpha1.ApplicationSetGenerator{{
+			GitDirectories: &v1alpha1.GitDirectoryGenerator{
+				Repository: v1.LocalObjectReference{Name: "fake-repo"},
+				Directories: []v1alpha1.GitDirectoryGeneratorItem{
+					{Path: "apps/*"},
+					{Path: "apps/test", Exclude: true},
+					{Path: "infra"},
+				},
+			},
+		}},
+		dirs: []string{"apps/guestbook", "apps/podinfo", "apps/test", "infra", "docs"},
+		want: []map[string]string{
+			{"path": "apps/guestbook", "path.basename": "guestbook"},
+			{"path": "apps/podinfo", "path.basename": "podinfo"},
+			{"path": "infra", "path.basename": "infra"},
+		},
+	}, {
+		name: "git repository not found",
+		generators: []v1alpha1.ApplicationSetGenerator{{
+			GitDirectories: &v1alpha1.GitDirectoryGenerator{
+				Repository:  v1.LocalObjectReference{Name: "not-found"},
+				Directories: []v1alpha1.GitDirectoryGeneratorItem{{Path: "*"}},
+			},
+		}},
+		wantErr: true,
+	}, {
+		name:       "empty generator",
+		generators: []v1alpha1.ApplicationSetGenerator{{}},
+		wantErr:    true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{
+				Client:       fake.NewFakeClientWithScheme(newScheme(t), append(clusters, repo.DeepCopy())...),
+				newGitClient: newFakeGitClient(t, tt.dirs...),
+			}
+			appSet := &v1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-set"},
+				Spec:       v1alpha1.ApplicationSetSpec{Generators: tt.generators},
+			}
+			params, err := r.generate(context.Background(), appSet)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, params)
+		})
+	}
+}
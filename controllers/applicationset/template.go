@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+)
+
+// paramPattern matches the parameter references, such as '{{name}}' or '{{ metadata.labels.env }}'
+var paramPattern = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// renderString replaces the parameter references with the values, the unknown references are kept as they are
+func renderString(text string, params map[string]string) string {
+	return paramPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if val, ok := params[paramPattern.FindStringSubmatch(ref)[1]]; ok {
+			return val
+		}
+		return ref
+	})
+}
+
+// renderValue replaces the parameter references in all the strings of a decoded JSON value
+func renderValue(value interface{}, params map[string]string) interface{} {
+	switch val := value.(type) {
+	case string:
+		return renderString(val, params)
+	case map[string]interface{}:
+		for key := range val {
+			val[key] = renderValue(val[key], params)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = renderValue(val[i], params)
+		}
+	}
+	return value
+}
+
+// renderApplication creates an Application from the template of the ApplicationSet with a set of the parameters
+func renderApplication(appSet *v1alpha1.ApplicationSet, params map[string]string) (app *v1alpha1.Application, err error) {
+	var data []byte
+	if data, err = json.Marshal(appSet.Spec.Template); err != nil {
+		return
+	}
+	var value interface{}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return
+	}
+	if data, err = json.Marshal(renderValue(value, params)); err != nil {
+		return
+	}
+	template := &v1alpha1.ApplicationSetTemplate{}
+	if err = json.Unmarshal(data, template); err != nil {
+		return
+	}
+
+	name := template.Metadata.Name
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		err = fmt.Errorf("invalid Application name %q: %s", name, strings.Join(errs, ", "))
+		return
+	}
+
+	app = &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   appSet.Namespace,
+			Labels:      template.Metadata.Labels,
+			Annotations: template.Metadata.Annotations,
+		},
+		Spec: template.Spec,
+	}
+	if app.Labels == nil {
+		app.Labels = map[string]string{}
+	}
+	app.Labels[v1alpha1.ApplicationSetLabelKey] = appSet.Name
+	if !appSet.Spec.PreserveOnDeletion {
+		app.OwnerReferences = []metav1.OwnerReference{
+			*metav1.NewControllerRef(appSet, v1alpha1.GroupVersion.WithKind("ApplicationSet")),
+		}
+	}
+	return
+}
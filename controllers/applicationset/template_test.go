@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package applicationset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+)
+
+func Test_renderString(t *testing.T) {
+	params := map[string]string{
+		"name":                      "member",
+		"metadata.labels.env":       "prod",
+		"values.namespace":          "guestbook",
+		"path.basename":             "guestbook",
+		"empty":                     "",
+		"metadata.labels.app/owner": "devops",
+	}
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{{
+		name: "no references",
+		text: "guestbook",
+		want: "guestbook",
+	}, {
+		name: "multiple references",
+		text: "{{name}}-{{ metadata.labels.env }}",
+		want: "member-prod",
+	}, {
+		name: "unknown reference",
+		text: "{{name}}-{{unknown}}",
+		want: "member-{{unknown}}",
+	}, {
+		name: "empty value",
+		text: "a{{empty}}b",
+		want: "ab",
+	}, {
+		name: "label with a slash",
+		text: "{{metadata.labels.app/owner}}",
+		want: "devops",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, renderString(tt.text, params))
+		})
+	}
+}
+
+func Test_renderApplication(t *testing.T) {
+	createAppSet := func(name string, preserve bool) *v1alpha1.ApplicationSet {
+		return &v1alpha1.ApplicationSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-set", UID: "fake-uid"},
+			Spec: v1alpha1.ApplicationSetSpec{
+				PreserveOnDeletion: preserve,
+				Template: v1alpha1.ApplicationSetTemplate{
+					Metadata: v1alpha1.ApplicationSetTemplateMeta{
+						Name:   name,
+						Labels: map[string]string{"env": "{{metadata.labels.env}}"},
+					},
+					Spec: v1alpha1.ApplicationSpec{
+						Kind: v1alpha1.FluxCD,
+						FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+							Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{
+								Deploy: []*v1alpha1.Deploy{{
+									Destination: v1alpha1.FluxApplicationDestination{TargetNamespace: "{{values.namespace}}"},
+									Values:      &apiextensionsv1.JSON{Raw: []byte(`{"cluster":"{{name}}","replicas":2}`)},
+								}},
+							}},
+						}},
+					},
+				},
+			},
+		}
+	}
+	params := map[string]string{
+		"name":                "member",
+		"metadata.labels.env": "prod",
+		"values.namespace":    "guestbook",
+	}
+
+	t.Run("normal case", func(t *testing.T) {
+		app, err := renderApplication(createAppSet("{{name}}-guestbook", false), params)
+		assert.Nil(t, err)
+		assert.Equal(t, "member-guestbook", app.Name)
+		assert.Equal(t, "fake-ns", app.Namespace)
+		assert.Equal(t, map[string]string{"env": "prod", v1alpha1.ApplicationSetLabelKey: "fake-set"}, app.Labels)
+		if assert.Len(t, app.OwnerReferences, 1) {
+			assert.Equal(t, "ApplicationSet", app.OwnerReferences[0].Kind)
+			assert.Equal(t, "fake-set", app.OwnerReferences[0].Name)
+		}
+		deploy := app.Spec.FluxApp.Spec.Config.HelmRelease.Deploy[0]
+		assert.Equal(t, "guestbook", deploy.Destination.TargetNamespace)
+		assert.JSONEq(t, `{"cluster":"member","replicas":2}`, string(deploy.Values.Raw))
+	})
+
+	t.Run("preserve on deletion", func(t *testing.T) {
+		app, err := renderApplication(createAppSet("{{name}}-guestbook", true), params)
+		assert.Nil(t, err)
+		assert.Empty(t, app.OwnerReferences)
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		_, err := renderApplication(createAppSet("{{unknown}}", false), params)
+		assert.NotNil(t, err)
+	})
+}
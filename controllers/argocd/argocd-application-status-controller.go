@@ -24,6 +24,8 @@ import (
 	"strings"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -37,6 +39,7 @@ import (
 //+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;update
 //+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications/status,verbs=get;update
 //+kubebuilder:rbac:groups=argoproj.io,resources=applications,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // ApplicationStatusReconciler represents a controller to sync cluster to ArgoCD cluster
 type ApplicationStatusReconciler struct {
@@ -107,7 +110,15 @@ func (r *ApplicationStatusReconciler) Reconcile(ctx context.Context, req ctrl.Re
 			// update labels
 			if err = r.Update(ctx, app); err == nil {
 				app.Status.ArgoApp = string(statusData)
-				err = r.Status().Update(ctx, app)
+				previous := app.Status.DeepCopy()
+				if argoS != nil {
+					normalizeArgoStatus(argoS, &app.Status)
+				}
+				if err = r.Status().Update(ctx, app); err == nil && argoS != nil &&
+					app.IsDriftAlertEnabled() && app.Status.IsDrifted(previous, argoS.Sync.Revision) {
+					r.recorder.Eventf(app, corev1.EventTypeWarning, "Drifted",
+						"the live state drifted from the deployed revision %s", previous.Revision)
+				}
 			}
 		}
 	}
@@ -145,19 +156,134 @@ func createBareArgoCDApplicationObject() *unstructured.Unstructured {
 
 // we can add more fields when need it
 type argoStatus struct {
-	Summary argoStatusSummary `json:"summary"`
+	Summary        argoStatusSummary    `json:"summary"`
+	Sync           argoSyncStatus       `json:"sync"`
+	Health         argoHealthStatus     `json:"health"`
+	Resources      []argoResourceStatus `json:"resources"`
+	Conditions     []argoCondition      `json:"conditions"`
+	OperationState *argoOperationState  `json:"operationState"`
+	// the history of Argo CD is compatible with the RevisionHistory
+	History []v1alpha1.RevisionHistory `json:"history"`
 }
 
 type argoStatusSummary struct {
 	Images []string `json:"images"`
 }
 
+type argoSyncStatus struct {
+	Status   string `json:"status"`
+	Revision string `json:"revision"`
+}
+
+type argoHealthStatus struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type argoResourceStatus struct {
+	Kind   string            `json:"kind"`
+	Status string            `json:"status"`
+	Health *argoHealthStatus `json:"health"`
+}
+
+type argoCondition struct {
+	Type               string       `json:"type"`
+	Message            string       `json:"message"`
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime"`
+}
+
+type argoOperationState struct {
+	Phase      string       `json:"phase"`
+	Message    string       `json:"message"`
+	StartedAt  *metav1.Time `json:"startedAt"`
+	FinishedAt *metav1.Time `json:"finishedAt"`
+	SyncResult *struct {
+		Revision string `json:"revision"`
+	} `json:"syncResult"`
+}
+
 func parseArgoStatus(data []byte) (status *argoStatus, err error) {
 	status = &argoStatus{}
 	err = json.Unmarshal(data, status)
 	return
 }
 
+// normalizeArgoStatus fills the engine-neutral fields of the Application status
+func normalizeArgoStatus(argoS *argoStatus, status *v1alpha1.ApplicationStatus) {
+	status.SyncStatus = v1alpha1.SyncStatusUnknown
+	switch code := v1alpha1.SyncStatusCode(argoS.Sync.Status); code {
+	case v1alpha1.SyncStatusSynced, v1alpha1.SyncStatusOutOfSync:
+		status.SyncStatus = code
+	}
+	status.HealthStatus = normalizeArgoHealth(argoS.Health.Status)
+	status.Revision = argoS.Sync.Revision
+
+	status.LastOperation = nil
+	if op := argoS.OperationState; op != nil {
+		status.LastOperation = &v1alpha1.OperationResult{
+			Message:    op.Message,
+			StartedAt:  op.StartedAt,
+			FinishedAt: op.FinishedAt,
+		}
+		switch op.Phase {
+		case "Succeeded":
+			status.LastOperation.Phase = v1alpha1.OperationSucceeded
+		case "Failed", "Error":
+			status.LastOperation.Phase = v1alpha1.OperationFailed
+		default:
+			status.LastOperation.Phase = v1alpha1.OperationRunning
+		}
+		if op.SyncResult != nil {
+			status.LastOperation.Revision = op.SyncResult.Revision
+			if status.LastOperation.Phase == v1alpha1.OperationSucceeded {
+				status.Revision = op.SyncResult.Revision
+			}
+		}
+	}
+
+	resources := &v1alpha1.ResourcesSummary{Kinds: map[string]int{}}
+	for _, resource := range argoS.Resources {
+		resources.Total++
+		resources.Kinds[resource.Kind]++
+		if resource.Status == string(v1alpha1.SyncStatusOutOfSync) {
+			resources.OutOfSync++
+		}
+		if resource.Health != nil && normalizeArgoHealth(resource.Health.Status) != v1alpha1.HealthStatusHealthy {
+			resources.Unhealthy++
+		}
+	}
+	status.Resources = resources
+	status.History = argoS.History
+
+	conditions := make([]metav1.Condition, 0, len(argoS.Conditions))
+	for _, condition := range argoS.Conditions {
+		if condition.Type == "" {
+			continue
+		}
+		// the conditions of Argo CD are all errors or warnings
+		item := metav1.Condition{
+			Type:    condition.Type,
+			Status:  metav1.ConditionTrue,
+			Reason:  condition.Type,
+			Message: condition.Message,
+		}
+		if condition.LastTransitionTime != nil {
+			item.LastTransitionTime = *condition.LastTransitionTime
+		}
+		conditions = append(conditions, item)
+	}
+	status.UpdateConditions(conditions...)
+}
+
+func normalizeArgoHealth(health string) v1alpha1.HealthStatusCode {
+	switch code := v1alpha1.HealthStatusCode(health); code {
+	case v1alpha1.HealthStatusProgressing, v1alpha1.HealthStatusHealthy, v1alpha1.HealthStatusSuspended,
+		v1alpha1.HealthStatusDegraded, v1alpha1.HealthStatusMissing:
+		return code
+	}
+	return v1alpha1.HealthStatusUnknown
+}
+
 // SetupWithManager init the logger, recorder and filters
 func (r *ApplicationStatusReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	argoApp := createBareArgoCDApplicationObject()
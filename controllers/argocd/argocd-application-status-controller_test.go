@@ -25,6 +25,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
@@ -270,6 +272,86 @@ func TestArgoCDApplicationStatusReconciler_Reconcile(t *testing.T) {
 	}
 }
 
+func TestArgoCDApplicationStatusReconciler_driftAlert(t *testing.T) {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	createApp := func(alert bool) *v1alpha1.Application {
+		app := &v1alpha1.Application{}
+		app.SetName("name")
+		app.SetNamespace("ns")
+		if alert {
+			app.SetAnnotations(map[string]string{v1alpha1.AnnoKeyDriftAlert: "true"})
+		}
+		app.Spec.ArgoApp = &v1alpha1.ArgoApplication{}
+		app.Status.SyncStatus = v1alpha1.SyncStatusSynced
+		app.Status.Revision = "v1"
+		return app
+	}
+	createArgoCDApp := func(revision string) *unstructured.Unstructured {
+		argoCDApp := &unstructured.Unstructured{}
+		argoCDApp.SetKind("Application")
+		argoCDApp.SetAPIVersion("argoproj.io/v1alpha1")
+		argoCDApp.SetName("name")
+		argoCDApp.SetNamespace("ns")
+		argoCDApp.SetLabels(map[string]string{
+			v1alpha1.AppNamespaceLabelKey: "ns",
+			v1alpha1.AppNameLabelKey:      "name",
+		})
+		_ = unstructured.SetNestedMap(argoCDApp.Object, map[string]interface{}{
+			"sync": map[string]interface{}{
+				"status":   "OutOfSync",
+				"revision": revision,
+			},
+			"operationState": map[string]interface{}{
+				"phase":      "Succeeded",
+				"syncResult": map[string]interface{}{"revision": "v1"},
+			},
+		}, "status")
+		return argoCDApp
+	}
+
+	tests := []struct {
+		name      string
+		app       *v1alpha1.Application
+		argoCDApp *unstructured.Unstructured
+		wantEvent bool
+	}{{
+		name:      "drifted without a new revision",
+		app:       createApp(true),
+		argoCDApp: createArgoCDApp("v1"),
+		wantEvent: true,
+	}, {
+		name:      "out of sync due to a new revision",
+		app:       createApp(true),
+		argoCDApp: createArgoCDApp("v2"),
+	}, {
+		name:      "drift alert is not enabled",
+		app:       createApp(false),
+		argoCDApp: createArgoCDApp("v1"),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &ApplicationStatusReconciler{
+				Client:   fake.NewFakeClientWithScheme(schema, tt.app, tt.argoCDApp),
+				log:      logr.New(log.NullLogSink{}),
+				recorder: recorder,
+			}
+			_, err := r.Reconcile(context.Background(), controllerruntime.Request{
+				NamespacedName: types.NamespacedName{Namespace: "ns", Name: "name"},
+			})
+			assert.Nil(t, err)
+			if tt.wantEvent {
+				assert.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, "Drifted")
+			} else {
+				assert.Len(t, recorder.Events, 0)
+			}
+		})
+	}
+}
+
 func Test_parseArgoStatus(t *testing.T) {
 	type args struct {
 		dataFile string
@@ -282,11 +364,15 @@ func Test_parseArgoStatus(t *testing.T) {
 	}{{
 		name: "normal",
 		args: args{dataFile: "data/argo-status.json"},
-		wantStatus: &argoStatus{argoStatusSummary{
-			Images: []string{"ghcr.io/linuxsuren-bot/open-podcasts-ui:v1.0.2",
-				"ghcr.io/linuxsuren-bot/open-podcasts:v1.0.0",
-				"ghcr.io/opensource-f2f/kube-rbac-proxy:v0.8.0",
-				"ghcr.io/opensource-f2f/open-podcasts-apiserver:dev"}}},
+		wantStatus: &argoStatus{
+			Summary: argoStatusSummary{
+				Images: []string{"ghcr.io/linuxsuren-bot/open-podcasts-ui:v1.0.2",
+					"ghcr.io/linuxsuren-bot/open-podcasts:v1.0.0",
+					"ghcr.io/opensource-f2f/kube-rbac-proxy:v0.8.0",
+					"ghcr.io/opensource-f2f/open-podcasts-apiserver:dev"}},
+			Sync:   argoSyncStatus{Status: "Synced", Revision: "1d4fcf1f56f5dbe2ae65abb001ffc304f1d58070"},
+			Health: argoHealthStatus{Status: "Healthy"},
+		},
 		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
 			assert.Nil(t, err)
 			return true
@@ -294,7 +380,7 @@ func Test_parseArgoStatus(t *testing.T) {
 	}, {
 		name:       "no summary",
 		args:       args{dataFile: "data/argo-status-without-summary.json"},
-		wantStatus: &argoStatus{},
+		wantStatus: &argoStatus{Health: argoHealthStatus{Status: "Healthy"}},
 		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
 			assert.Nil(t, err)
 			return true
@@ -314,6 +400,82 @@ func Test_parseArgoStatus(t *testing.T) {
 	}
 }
 
+func Test_normalizeArgoStatus(t *testing.T) {
+	tests := []struct {
+		name               string
+		data               string
+		wantSync           v1alpha1.SyncStatusCode
+		wantHealth         v1alpha1.HealthStatusCode
+		wantRevision       string
+		wantOperation      v1alpha1.OperationPhase
+		wantResources      *v1alpha1.ResourcesSummary
+		wantReady          metav1.ConditionStatus
+		wantOtherCondition string
+		wantHistory        []string
+	}{{
+		name:          "empty",
+		data:          `{}`,
+		wantSync:      v1alpha1.SyncStatusUnknown,
+		wantHealth:    v1alpha1.HealthStatusUnknown,
+		wantResources: &v1alpha1.ResourcesSummary{Kinds: map[string]int{}},
+		wantReady:     metav1.ConditionUnknown,
+	}, {
+		name: "synced and healthy",
+		data: `{"sync":{"status":"Synced","revision":"a"},"health":{"status":"Healthy"},
+"resources":[{"kind":"Deployment","status":"Synced","health":{"status":"Healthy"}},{"kind":"Service","status":"Synced"}],
+"operationState":{"phase":"Succeeded","message":"successfully synced","syncResult":{"revision":"a"}},
+"history":[{"id":0,"revision":"z","deployedAt":"2022-08-01T00:00:00Z","source":{"repoURL":"https://fake.com/repo.git"}},
+{"id":1,"revision":"a","deployedAt":"2022-08-02T00:00:00Z","initiatedBy":{"username":"admin"}}]}`,
+		wantSync:      v1alpha1.SyncStatusSynced,
+		wantHealth:    v1alpha1.HealthStatusHealthy,
+		wantRevision:  "a",
+		wantOperation: v1alpha1.OperationSucceeded,
+		wantResources: &v1alpha1.ResourcesSummary{Total: 2, Kinds: map[string]int{"Deployment": 1, "Service": 1}},
+		wantReady:     metav1.ConditionTrue,
+		wantHistory:   []string{"z", "a"},
+	}, {
+		name: "failed to sync",
+		data: `{"sync":{"status":"OutOfSync","revision":"b"},"health":{"status":"Degraded"},
+"resources":[{"kind":"Deployment","status":"OutOfSync","health":{"status":"Degraded"}}],
+"conditions":[{"type":"SyncError","message":"failed to sync"}],
+"operationState":{"phase":"Error","message":"one or more objects failed to apply","syncResult":{"revision":"b"}}}`,
+		wantSync:           v1alpha1.SyncStatusOutOfSync,
+		wantHealth:         v1alpha1.HealthStatusDegraded,
+		wantRevision:       "b",
+		wantOperation:      v1alpha1.OperationFailed,
+		wantResources:      &v1alpha1.ResourcesSummary{Total: 1, OutOfSync: 1, Unhealthy: 1, Kinds: map[string]int{"Deployment": 1}},
+		wantReady:          metav1.ConditionFalse,
+		wantOtherCondition: "SyncError",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argoS, err := parseArgoStatus([]byte(tt.data))
+			assert.Nil(t, err)
+
+			status := &v1alpha1.ApplicationStatus{}
+			normalizeArgoStatus(argoS, status)
+			assert.Equal(t, tt.wantSync, status.SyncStatus)
+			assert.Equal(t, tt.wantHealth, status.HealthStatus)
+			assert.Equal(t, tt.wantRevision, status.Revision)
+			if tt.wantOperation == "" {
+				assert.Nil(t, status.LastOperation)
+			} else if assert.NotNil(t, status.LastOperation) {
+				assert.Equal(t, tt.wantOperation, status.LastOperation.Phase)
+			}
+			assert.Equal(t, tt.wantResources, status.Resources)
+			assert.Equal(t, tt.wantReady, meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionTypeReady).Status)
+			if tt.wantOtherCondition != "" {
+				assert.NotNil(t, meta.FindStatusCondition(status.Conditions, tt.wantOtherCondition))
+			}
+			var history []string
+			for _, item := range status.History {
+				history = append(history, item.Revision)
+			}
+			assert.Equal(t, tt.wantHistory, history)
+		})
+	}
+}
+
 func TestApplicationStatusReconciler_SetupWithManager(t *testing.T) {
 	schema, err := v1alpha1.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
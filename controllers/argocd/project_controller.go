@@ -21,14 +21,17 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"time"
 
 	"github.com/go-logr/logr"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/syncwindow"
 	"kubesphere.io/devops/pkg/utils/k8sutil"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -75,7 +78,12 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ct
 		return
 	}
 
-	err = r.reconcileArgoProject(project)
+	if err = r.reconcileArgoProject(project); err == nil {
+		// the active change freezes are rendered as deny windows, update them once a change freeze begins or ends
+		if next := nextChangeFreezeTransition(project, time.Now()); !next.IsZero() {
+			result.RequeueAfter = time.Until(next) + time.Second
+		}
+	}
 	return
 }
 
@@ -146,6 +154,61 @@ func createUnstructuredObject(project *v1alpha3.DevOpsProject, argocdNamespace s
 			result.SetName(project.GetName())
 			result.SetNamespace(argocdNamespace)
 			k8sutil.AddOwnerReference(result, project.TypeMeta, project.ObjectMeta)
+
+			var windows []interface{}
+			if windows, err = createArgoSyncWindows(project, time.Now()); err == nil && len(windows) > 0 {
+				err = unstructured.SetNestedSlice(result.Object, windows, "spec", "syncWindows")
+			}
+		}
+	}
+	return
+}
+
+// createArgoSyncWindows returns the sync windows of the Argo AppProject, they come from the Argo specific windows,
+// the engine-neutral windows and the active change freezes of the DevOpsProject
+func createArgoSyncWindows(project *v1alpha3.DevOpsProject, now time.Time) (windows []interface{}, err error) {
+	var syncWindows v1alpha3.SyncWindows
+	if project.Spec.Argo != nil {
+		syncWindows = append(syncWindows, project.Spec.Argo.SyncWindows...)
+	}
+	syncWindows = append(syncWindows, project.Spec.SyncWindows...)
+	for _, freeze := range project.Spec.ChangeFreezes {
+		if now.Before(freeze.Start.Time) || !now.Before(freeze.End.Time) {
+			continue
+		}
+		// a deny window which is always active
+		window := &v1alpha3.SyncWindow{
+			Kind:         syncwindow.KindDeny,
+			Schedule:     "* * * * *",
+			Duration:     "1m",
+			Applications: freeze.Applications,
+		}
+		if len(window.Applications) == 0 {
+			window.Applications = []string{"*"}
+		}
+		syncWindows = append(syncWindows, window)
+	}
+
+	for _, window := range syncWindows {
+		if window == nil {
+			continue
+		}
+		var item map[string]interface{}
+		if item, err = runtime.DefaultUnstructuredConverter.ToUnstructured(window); err != nil {
+			return
+		}
+		windows = append(windows, item)
+	}
+	return
+}
+
+// nextChangeFreezeTransition returns the next time when a change freeze begins or ends
+func nextChangeFreezeTransition(project *v1alpha3.DevOpsProject, now time.Time) (next time.Time) {
+	for _, freeze := range project.Spec.ChangeFreezes {
+		for _, t := range []time.Time{freeze.Start.Time, freeze.End.Time} {
+			if t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
 		}
 	}
 	return
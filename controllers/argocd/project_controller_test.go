@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
+	"time"
 )
 
 func TestCreateUnstructuredObject(t *testing.T) {
@@ -94,6 +95,57 @@ func TestCreateUnstructuredObject(t *testing.T) {
 		map[string]interface{}{"group": "group2", "kind": "kind2"}}, p2ClusterResourceWhitelist)
 }
 
+func Test_createArgoSyncWindows(t *testing.T) {
+	now := time.Date(2022, 9, 2, 10, 0, 0, 0, time.UTC)
+	project := &v1alpha3.DevOpsProject{
+		Spec: v1alpha3.DevOpsProjectSpec{
+			Argo: &v1alpha3.Argo{
+				SyncWindows: v1alpha3.SyncWindows{{
+					Kind: "allow", Schedule: "0 9 * * *", Duration: "8h", Applications: []string{"*"},
+				}},
+			},
+			SyncWindows: v1alpha3.SyncWindows{{
+				Kind: "deny", Schedule: "0 22 * * *", Duration: "2h", Namespaces: []string{"prod-*"}, ManualSync: true,
+			}},
+			ChangeFreezes: []v1alpha3.ChangeFreeze{{
+				Name:         "release",
+				Start:        metav1.NewTime(now.Add(-time.Hour)),
+				End:          metav1.NewTime(now.Add(time.Hour)),
+				Applications: []string{"guestbook"},
+			}, {
+				Name:  "upcoming",
+				Start: metav1.NewTime(now.Add(time.Hour)),
+				End:   metav1.NewTime(now.Add(2 * time.Hour)),
+			}},
+		},
+	}
+
+	windows, err := createArgoSyncWindows(project, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"kind": "allow", "schedule": "0 9 * * *", "duration": "8h",
+			"applications": []interface{}{"*"}},
+		map[string]interface{}{"kind": "deny", "schedule": "0 22 * * *", "duration": "2h",
+			"namespaces": []interface{}{"prod-*"}, "manualSync": true},
+		map[string]interface{}{"kind": "deny", "schedule": "* * * * *", "duration": "1m",
+			"applications": []interface{}{"guestbook"}},
+	}, windows)
+	assert.Equal(t, now.Add(time.Hour), nextChangeFreezeTransition(project, now))
+
+	// all the change freezes are over
+	later := now.Add(3 * time.Hour)
+	windows, err = createArgoSyncWindows(project, later)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(windows))
+	assert.True(t, nextChangeFreezeTransition(project, later).IsZero())
+
+	// the sync windows are rendered into the Argo AppProject
+	obj, err := createUnstructuredObject(project, "argocd")
+	assert.Nil(t, err)
+	syncWindows, _, _ := unstructured.NestedSlice(obj.Object, "spec", "syncWindows")
+	assert.GreaterOrEqual(t, len(syncWindows), 2)
+}
+
 func TestReconcileArgoProject(t *testing.T) {
 	schema, err := v1alpha3.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
@@ -26,17 +26,24 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
 	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
+	apimeta "kubesphere.io/devops/pkg/external/fluxcd/meta"
 	sourcev1 "kubesphere.io/devops/pkg/external/fluxcd/source/v1beta2"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 	"time"
 )
 
 //+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=watch;get;list
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=devopsprojects,verbs=watch;get;list
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups="kustomize.toolkit.fluxcd.io",resources=kustomizations,verbs=watch;get;list;create;update;delete
 //+kubebuilder:rbac:groups="helm.toolkit.fluxcd.io",resources=helmreleases,verbs=watch;get;list;create;update;delete
@@ -64,10 +71,16 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return
 	}
 
-	if err = r.reconcileFluxApp(app); err != nil {
+	var window *syncWindowState
+	if window, err = r.evaluateSyncWindows(ctx, app); err != nil {
 		return
 	}
 
+	if err = r.reconcileFluxApp(app, window); err != nil {
+		return
+	}
+
+	result.RequeueAfter = window.requeueAfter()
 	return
 }
 
@@ -87,21 +100,23 @@ func validateFluxApp(app *v1alpha1.Application) (err error) {
 	return
 }
 
-func (r *ApplicationReconciler) reconcileFluxApp(app *v1alpha1.Application) (err error) {
+// reconcileFluxApp creates or updates the HelmReleases or Kustomizations of the application,
+// they are suspended while the sync windows block the automated syncs
+func (r *ApplicationReconciler) reconcileFluxApp(app *v1alpha1.Application, window *syncWindowState) (err error) {
 	ctx := context.Background()
 
 	var at AppType
 	at, err = isHelmOrKustomize(app)
 	switch at {
 	case HelmRelease:
-		return r.reconcileHelmRelease(ctx, app)
+		return r.reconcileHelmRelease(ctx, app, window)
 	case Kustomization:
-		return r.reconcileKustomization(ctx, app)
+		return r.reconcileKustomization(ctx, app, window)
 	}
 	return
 }
 
-func (r *ApplicationReconciler) reconcileHelmRelease(ctx context.Context, app *v1alpha1.Application) (err error) {
+func (r *ApplicationReconciler) reconcileHelmRelease(ctx context.Context, app *v1alpha1.Application, window *syncWindowState) (err error) {
 	fluxApp := app.Spec.FluxApp.DeepCopy()
 	if err = checkHelmRelease(fluxApp); err != nil {
 		return
@@ -137,13 +152,14 @@ func (r *ApplicationReconciler) reconcileHelmRelease(ctx context.Context, app *v
 		}
 	}
 
-	if err = r.reconcileHelmReleaseList(ctx, app, helmChart); err != nil {
+	if err = r.reconcileHelmReleaseList(ctx, app, helmChart, window); err != nil {
 		return
 	}
 	return
 }
 
-func (r *ApplicationReconciler) reconcileHelmReleaseList(ctx context.Context, app *v1alpha1.Application, helmChart *sourcev1.HelmChart) (err error) {
+func (r *ApplicationReconciler) reconcileHelmReleaseList(ctx context.Context, app *v1alpha1.Application, helmChart *sourcev1.HelmChart,
+	window *syncWindowState) (err error) {
 	fluxApp := app.Spec.FluxApp.DeepCopy()
 	appNS, appName := app.GetNamespace(), app.GetName()
 
@@ -165,14 +181,14 @@ func (r *ApplicationReconciler) reconcileHelmReleaseList(ctx context.Context, ap
 		if hr, ok := hrMap[name]; !ok {
 			// there is no matching helmRelease
 			// create
-			if err = r.createHelmRelease(ctx, app, helmChart, deploy); err != nil {
+			if err = r.createHelmRelease(ctx, app, helmChart, deploy, window); err != nil {
 				return
 			}
 		} else {
 			// there is a matching helmRelease
 			// update the helmRelease
 			// TODO: determine whether this helmrelease should update by ResourceVersion
-			if err = r.updateHelmRelease(ctx, hr, helmChart, deploy); err != nil {
+			if err = r.updateHelmRelease(ctx, app, hr, helmChart, deploy, window); err != nil {
 				return
 			}
 		}
@@ -181,7 +197,8 @@ func (r *ApplicationReconciler) reconcileHelmReleaseList(ctx context.Context, ap
 	return
 }
 
-func (r *ApplicationReconciler) createHelmRelease(ctx context.Context, app *v1alpha1.Application, helmChart *sourcev1.HelmChart, deploy *v1alpha1.Deploy) (err error) {
+func (r *ApplicationReconciler) createHelmRelease(ctx context.Context, app *v1alpha1.Application, helmChart *sourcev1.HelmChart, deploy *v1alpha1.Deploy,
+	window *syncWindowState) (err error) {
 	appNS, appName := app.GetNamespace(), app.GetName()
 	hrNS := appNS
 
@@ -189,6 +206,7 @@ func (r *ApplicationReconciler) createHelmRelease(ctx context.Context, app *v1al
 	if hr, err = buildHelmRelease(helmChart, deploy); err != nil {
 		return
 	}
+	hr.Spec.Suspend = hr.Spec.Suspend || app.IsSuspended() || window.suspend(app, "")
 	hr.SetNamespace(hrNS)
 	hr.SetGenerateName(appName)
 	hr.SetName("")
@@ -200,6 +218,7 @@ func (r *ApplicationReconciler) createHelmRelease(ctx context.Context, app *v1al
 	hr.SetAnnotations(map[string]string{
 		"app.kubernetes.io/name": getHelmReleaseName(deploy),
 	})
+	setReconcileRequest(hr, app)
 	hr.SetOwnerReferences([]metav1.OwnerReference{
 		{
 			APIVersion: "gitops.kubesphere.io/v1alpha1",
@@ -216,12 +235,20 @@ func (r *ApplicationReconciler) createHelmRelease(ctx context.Context, app *v1al
 	return
 }
 
-func (r *ApplicationReconciler) updateHelmRelease(ctx context.Context, hr *helmv2.HelmRelease, helmChart *sourcev1.HelmChart, deploy *v1alpha1.Deploy) (err error) {
+func (r *ApplicationReconciler) updateHelmRelease(ctx context.Context, app *v1alpha1.Application, hr *helmv2.HelmRelease, helmChart *sourcev1.HelmChart, deploy *v1alpha1.Deploy,
+	window *syncWindowState) (err error) {
 	var newHR *helmv2.HelmRelease
 	if newHR, err = buildHelmRelease(helmChart, deploy); err != nil {
 		return
 	}
+	if app.IsSuspended() {
+		newHR.Spec.Suspend = true
+	} else if !deploy.Suspend {
+		newHR.Spec.Suspend = window.suspend(app, hr.Status.LastHandledReconcileAt)
+		r.recordSuspension(app, window, "HelmRelease", getHelmReleaseName(deploy), hr.Spec.Suspend, newHR.Spec.Suspend)
+	}
 	hr.Spec = newHR.Spec
+	setReconcileRequest(hr, app)
 	if err = r.Update(ctx, hr); err != nil {
 		return
 	}
@@ -230,7 +257,7 @@ func (r *ApplicationReconciler) updateHelmRelease(ctx context.Context, hr *helmv
 	return
 }
 
-func (r *ApplicationReconciler) reconcileKustomization(ctx context.Context, app *v1alpha1.Application) (err error) {
+func (r *ApplicationReconciler) reconcileKustomization(ctx context.Context, app *v1alpha1.Application, window *syncWindowState) (err error) {
 	if err = checkKustomization(app.Spec.FluxApp); err != nil {
 		return err
 	}
@@ -254,25 +281,27 @@ func (r *ApplicationReconciler) reconcileKustomization(ctx context.Context, app
 		if kus, ok := kusMap[name]; !ok {
 			// not found
 			// create
-			err = r.createKustomization(ctx, app, kusDeploy)
+			err = r.createKustomization(ctx, app, kusDeploy, window)
 		} else {
 			// found
 			// update this kus
-			err = r.updateKustomization(ctx, app, kus, kusDeploy)
+			err = r.updateKustomization(ctx, app, kus, kusDeploy, window)
 		}
 	}
 	return
 }
 
-func (r *ApplicationReconciler) createKustomization(ctx context.Context, app *v1alpha1.Application, deploy *v1alpha1.KustomizationSpec) (err error) {
+func (r *ApplicationReconciler) createKustomization(ctx context.Context, app *v1alpha1.Application, deploy *v1alpha1.KustomizationSpec,
+	window *syncWindowState) (err error) {
 	appNS, appName := app.GetNamespace(), app.GetName()
 	kusNS := appNS
 
-	fluxApp := app.Spec.FluxApp.DeepCopy()
+	fluxApp := getPinnedFluxApp(app)
 	var kus *kusv1.Kustomization
 	if kus, err = buildKustomization(fluxApp, deploy); err != nil {
 		return
 	}
+	kus.Spec.Suspend = kus.Spec.Suspend || app.IsSuspended() || window.suspend(app, "")
 	kus.SetNamespace(kusNS)
 	kus.SetGenerateName(appName)
 	kus.SetName("")
@@ -283,6 +312,7 @@ func (r *ApplicationReconciler) createKustomization(ctx context.Context, app *v1
 	kus.SetAnnotations(map[string]string{
 		"app.kubernetes.io/name": getKustomizationName(deploy),
 	})
+	setReconcileRequest(kus, app)
 	kus.SetOwnerReferences([]metav1.OwnerReference{
 		{
 			APIVersion: "gitops.kubesphere.io/v1alpha1",
@@ -299,13 +329,21 @@ func (r *ApplicationReconciler) createKustomization(ctx context.Context, app *v1
 	r.recorder.Eventf(kus, corev1.EventTypeNormal, "Created", "Created FluxCD Kustomization %s", kus.GetAnnotations()["app.kubernetes.io/name"])
 	return
 }
-func (r *ApplicationReconciler) updateKustomization(ctx context.Context, app *v1alpha1.Application, kus *kusv1.Kustomization, deploy *v1alpha1.KustomizationSpec) (err error) {
-	fluxApp := app.Spec.FluxApp.DeepCopy()
+func (r *ApplicationReconciler) updateKustomization(ctx context.Context, app *v1alpha1.Application, kus *kusv1.Kustomization, deploy *v1alpha1.KustomizationSpec,
+	window *syncWindowState) (err error) {
+	fluxApp := getPinnedFluxApp(app)
 	var newKus *kusv1.Kustomization
 	if newKus, err = buildKustomization(fluxApp, deploy); err != nil {
 		return
 	}
+	if app.IsSuspended() {
+		newKus.Spec.Suspend = true
+	} else if !deploy.Suspend {
+		newKus.Spec.Suspend = window.suspend(app, kus.Status.LastHandledReconcileAt)
+		r.recordSuspension(app, window, "Kustomization", getKustomizationName(deploy), kus.Spec.Suspend, newKus.Spec.Suspend)
+	}
 	kus.Spec = newKus.Spec
+	setReconcileRequest(kus, app)
 	if err = r.Update(ctx, kus); err != nil {
 		return
 	}
@@ -314,6 +352,20 @@ func (r *ApplicationReconciler) updateKustomization(ctx context.Context, app *v1
 	return
 }
 
+// setReconcileRequest passes the manual sync or resume request of the Application to FluxCD by the reconcile annotation
+func setReconcileRequest(obj metav1.Object, app *v1alpha1.Application) {
+	op := app.Spec.FluxApp.Operation
+	if op == nil || op.Type == v1alpha1.FluxOperationSuspend {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[apimeta.ReconcileRequestAnnotation] = op.RequestedAt.UTC().Format(time.RFC3339Nano)
+	obj.SetAnnotations(annotations)
+}
+
 func isHelmOrKustomize(app *v1alpha1.Application) (at AppType, err error) {
 	isHelm, isKus := checkHelmRelease(app.Spec.FluxApp) == nil, checkKustomization(app.Spec.FluxApp) == nil
 	if isHelm && !isKus {
@@ -386,6 +438,9 @@ func buildTemplateFromApp(fluxApp *v1alpha1.FluxApplication) (*sourcev1.HelmChar
 		return nil, fmt.Errorf("should provide a chart for the FluxCD HelmRelease")
 	}
 	s := fluxApp.Spec.Source.SourceRef
+	if s.Kind == "OCIRepository" {
+		return nil, fmt.Errorf("the FluxCD HelmRelease does not support the OCIRepository, please use a HelmRepository of the oci type")
+	}
 	c := fluxApp.Spec.Config.HelmRelease.Chart
 
 	return &sourcev1.HelmChart{
@@ -449,6 +504,18 @@ func buildHelmRelease(helmChart *sourcev1.HelmChart, deploy *v1alpha1.Deploy) (*
 	}, nil
 }
 
+// getPinnedFluxApp returns a copy of the FluxApplication, the source of which is replaced with the GitRepository
+// pinned by the rollback of the Application
+func getPinnedFluxApp(app *v1alpha1.Application) *v1alpha1.FluxApplication {
+	fluxApp := app.Spec.FluxApp.DeepCopy()
+	pinned := app.GetAnnotations()[v1alpha1.AnnoKeyPinnedSource]
+	if pinned != "" && fluxApp.Spec.Source != nil && fluxApp.Spec.Source.SourceRef.Kind == "GitRepository" {
+		fluxApp.Spec.Source.SourceRef.Name = pinned
+		fluxApp.Spec.Source.SourceRef.Namespace = app.GetNamespace()
+	}
+	return fluxApp
+}
+
 func buildKustomization(fluxApp *v1alpha1.FluxApplication, deploy *v1alpha1.KustomizationSpec) (*kusv1.Kustomization, error) {
 	if fluxApp.Spec.Source == nil {
 		return nil, fmt.Errorf("should provide a Source for FluxCD Kustomization")
@@ -457,6 +524,9 @@ func buildKustomization(fluxApp *v1alpha1.FluxApplication, deploy *v1alpha1.Kust
 		return nil, fmt.Errorf("should provide Deploy struct to indicate how to deploy the Kustomization")
 	}
 	s := fluxApp.Spec.Source.SourceRef
+	if s.Kind == "HelmRepository" {
+		return nil, fmt.Errorf("the FluxCD Kustomization does not support the HelmRepository")
+	}
 	return &kusv1.Kustomization{
 		Spec: kusv1.KustomizationSpec{
 			SourceRef: kusv1.CrossNamespaceSourceReference{
@@ -534,5 +604,8 @@ func (r *ApplicationReconciler) SetupWithManager(mgr manager.Manager) error {
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.Application{}).
+		Watches(&source.Kind{Type: &v1alpha3.DevOpsProject{}},
+			handler.EnqueueRequestsFromMapFunc(r.applicationsOfProject),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Complete(r)
 }
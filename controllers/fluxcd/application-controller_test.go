@@ -26,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
 	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
@@ -52,6 +53,9 @@ func TestApplicationReconciler_Reconcile(t *testing.T) {
 	err = kusv1.SchemeBuilder.AddToScheme(schema)
 	assert.Nil(t, err)
 
+	err = v1alpha3.AddToScheme(schema)
+	assert.Nil(t, err)
+
 	argoApp := &v1alpha1.Application{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: "fake-ns",
@@ -72,7 +76,7 @@ func TestApplicationReconciler_Reconcile(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -312,7 +316,7 @@ func TestApplicationReconciler_reconcileApp(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -415,7 +419,7 @@ func TestApplicationReconciler_reconcileApp(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -839,12 +843,51 @@ func TestApplicationReconciler_reconcileApp(t *testing.T) {
 				log:      logr.New(log.NullLogSink{}),
 				recorder: &record.FakeRecorder{},
 			}
-			err := r.reconcileFluxApp(tt.args.app)
+			err := r.reconcileFluxApp(tt.args.app, nil)
 			tt.verify(t, tt.fields.Client, err)
 		})
 	}
 }
 
+func Test_setReconcileRequest(t *testing.T) {
+	requestedAt := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name      string
+		operation *v1alpha1.FluxOperation
+		want      map[string]string
+	}{{
+		name: "no operation",
+		want: map[string]string{"app.kubernetes.io/name": "app"},
+	}, {
+		name:      "sync",
+		operation: &v1alpha1.FluxOperation{Type: v1alpha1.FluxOperationSync, RequestedAt: requestedAt},
+		want: map[string]string{
+			"app.kubernetes.io/name":        "app",
+			meta.ReconcileRequestAnnotation: "2022-01-01T00:00:00Z",
+		},
+	}, {
+		name:      "suspend",
+		operation: &v1alpha1.FluxOperation{Type: v1alpha1.FluxOperationSuspend, RequestedAt: requestedAt},
+		want:      map[string]string{"app.kubernetes.io/name": "app"},
+	}, {
+		name:      "resume",
+		operation: &v1alpha1.FluxOperation{Type: v1alpha1.FluxOperationResume, RequestedAt: requestedAt},
+		want: map[string]string{
+			"app.kubernetes.io/name":        "app",
+			meta.ReconcileRequestAnnotation: "2022-01-01T00:00:00Z",
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &v1alpha1.Application{Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Operation: tt.operation}}}
+			hr := &helmv2.HelmRelease{}
+			hr.SetAnnotations(map[string]string{"app.kubernetes.io/name": "app"})
+			setReconcileRequest(hr, app)
+			assert.Equal(t, tt.want, hr.GetAnnotations())
+		})
+	}
+}
+
 func TestApplicationReconciler_GetName(t *testing.T) {
 	t.Run("get FluxApplicationReconciler name", func(t *testing.T) {
 
@@ -998,6 +1041,64 @@ func TestApplicationReconciler_convertInterval(t *testing.T) {
 	}
 }
 
+func TestApplicationReconciler_unsupportedSourceKind(t *testing.T) {
+	newFluxApp := func(kind string) *v1alpha1.FluxApplication {
+		return &v1alpha1.FluxApplication{
+			Spec: v1alpha1.FluxApplicationSpec{
+				Source: &v1alpha1.FluxApplicationSource{
+					SourceRef: v1alpha1.FluxSourceReference{
+						Kind: kind,
+						Name: "fake-source",
+					},
+				},
+				Config: &v1alpha1.FluxApplicationConfig{
+					HelmRelease: &v1alpha1.HelmReleaseSpec{
+						Chart: &v1alpha1.HelmChartTemplateSpec{Chart: "fake-chart"},
+					},
+				},
+			},
+		}
+	}
+
+	_, err := buildTemplateFromApp(newFluxApp("OCIRepository"))
+	assert.NotNil(t, err)
+	helmChart, err := buildTemplateFromApp(newFluxApp("HelmRepository"))
+	assert.Nil(t, err)
+	assert.Equal(t, "HelmRepository", helmChart.Spec.SourceRef.Kind)
+
+	_, err = buildKustomization(newFluxApp("HelmRepository"), &v1alpha1.KustomizationSpec{})
+	assert.NotNil(t, err)
+	kus, err := buildKustomization(newFluxApp("OCIRepository"), &v1alpha1.KustomizationSpec{})
+	assert.Nil(t, err)
+	assert.Equal(t, "OCIRepository", kus.Spec.SourceRef.Kind)
+}
+
+func Test_getPinnedFluxApp(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "fake-app", Namespace: "fake-ns"},
+		Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+			Source: &v1alpha1.FluxApplicationSource{SourceRef: v1alpha1.FluxSourceReference{
+				Kind: "GitRepository",
+				Name: "fake-repo",
+			}},
+		}}},
+	}
+
+	// not pinned
+	assert.Equal(t, "fake-repo", getPinnedFluxApp(app).Spec.Source.SourceRef.Name)
+
+	// pinned by the rollback
+	app.Annotations = map[string]string{v1alpha1.AnnoKeyPinnedSource: "fake-app-pinned"}
+	fluxApp := getPinnedFluxApp(app)
+	assert.Equal(t, "fake-app-pinned", fluxApp.Spec.Source.SourceRef.Name)
+	assert.Equal(t, "fake-ns", fluxApp.Spec.Source.SourceRef.Namespace)
+	assert.Equal(t, "fake-repo", app.Spec.FluxApp.Spec.Source.SourceRef.Name)
+
+	// only the GitRepository can be pinned
+	app.Spec.FluxApp.Spec.Source.SourceRef.Kind = "HelmRepository"
+	assert.Equal(t, "fake-repo", getPinnedFluxApp(app).Spec.Source.SourceRef.Name)
+}
+
 func TestApplicationReconciler_SetupWithManager(t *testing.T) {
 	schema, err := v1alpha1.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
@@ -44,3 +44,6 @@ const (
 	// FluxAppLastRevision is the revision of the last successfully applied source.
 	FluxAppLastRevision = "gitops.kubesphere.io/last-revision"
 )
+
+// FluxImageUpdaterLabelKey is the label key of the name of the ImageUpdater which generates the FluxCD image automation objects
+const FluxImageUpdaterLabelKey = "gitops.kubesphere.io/image-updater"
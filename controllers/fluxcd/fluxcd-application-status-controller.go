@@ -20,8 +20,10 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
@@ -32,13 +34,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 //+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;update
 //+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications/status,verbs=get;update
 //+kubebuilder:rbac:groups="kustomize.toolkit.fluxcd.io",resources=kustomizations,verbs=get;list;watch
 //+kubebuilder:rbac:groups="helm.toolkit.fluxcd.io",resources=helmreleases,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // ApplicationStatusReconciler represents a controller to sync the status of
 // FluxApplication (HelmRelease and Kustomization) to Kubesphere GitOps Application
@@ -92,11 +97,15 @@ func (r *ApplicationStatusReconciler) reconcileHelmRelease(ctx context.Context,
 	if app.Status.FluxApp.HelmReleaseStatus == nil {
 		app.Status.FluxApp.HelmReleaseStatus = make(map[string]*helmv2.HelmReleaseStatus, totalHRNum)
 	}
-	app.Status.FluxApp.HelmReleaseStatus[hr.GetAnnotations()["app.kubernetes.io/name"]] = hr.Status.DeepCopy()
+	name := hr.GetAnnotations()["app.kubernetes.io/name"]
+	previous := newHelmReleaseStatus(app.Status.FluxApp.HelmReleaseStatus[name])
+	app.Status.FluxApp.HelmReleaseStatus[name] = hr.Status.DeepCopy()
+	normalizeFluxStatus(app)
 	// Update status
 	if err = r.Status().Update(ctx, app); err != nil {
 		return
 	}
+	r.alertDrift(app, name, previous, newHelmReleaseStatus(&hr.Status))
 
 	if app.GetLabels() == nil {
 		app.SetLabels(map[string]string{})
@@ -116,6 +125,7 @@ func (r *ApplicationStatusReconciler) reconcileHelmRelease(ctx context.Context,
 	app.GetLabels()[FluxAppReadyNumKey] = strconv.Itoa(readyHRNum) + "-" + strconv.Itoa(totalHRNum)
 	// TODO: should find a better way to add AppType
 	app.GetLabels()[FluxAppTypeKey] = string(HelmRelease)
+	app.SetStatusLabels()
 
 	// update label
 	if err = r.Update(ctx, app); err != nil {
@@ -139,11 +149,15 @@ func (r *ApplicationStatusReconciler) reconcileKustomization(ctx context.Context
 	if app.Status.FluxApp.KustomizationStatus == nil {
 		app.Status.FluxApp.KustomizationStatus = make(map[string]*kusv1.KustomizationStatus, totalKusNum)
 	}
-	app.Status.FluxApp.KustomizationStatus[kus.GetAnnotations()["app.kubernetes.io/name"]] = kus.Status.DeepCopy()
+	name := kus.GetAnnotations()["app.kubernetes.io/name"]
+	previous := newKustomizationStatus(app.Status.FluxApp.KustomizationStatus[name])
+	app.Status.FluxApp.KustomizationStatus[name] = kus.Status.DeepCopy()
+	normalizeFluxStatus(app)
 	// Update status
 	if err = r.Status().Update(ctx, app); err != nil {
 		return
 	}
+	r.alertDrift(app, name, previous, newKustomizationStatus(&kus.Status))
 
 	if app.GetLabels() == nil {
 		app.SetLabels(map[string]string{})
@@ -163,6 +177,7 @@ func (r *ApplicationStatusReconciler) reconcileKustomization(ctx context.Context
 	app.GetLabels()[FluxAppReadyNumKey] = strconv.Itoa(readyKusNum) + "-" + strconv.Itoa(totalKusNum)
 	// TODO: should find a better way to add AppType
 	app.GetLabels()[FluxAppTypeKey] = string(Kustomization)
+	app.SetStatusLabels()
 	// update label
 	if err = r.Update(ctx, app); err != nil {
 		return
@@ -170,6 +185,232 @@ func (r *ApplicationStatusReconciler) reconcileKustomization(ctx context.Context
 	return
 }
 
+// alertDrift sends a warning event if the drift alert of the Application is enabled and the HelmRelease or
+// Kustomization drifted. It drifted if it turned not ready while the applied revision was still the attempted one,
+// the other HelmReleases or Kustomizations of the Application do not matter.
+func (r *ApplicationStatusReconciler) alertDrift(app *v1alpha1.Application, name string, previous, current *fluxReleaseStatus) {
+	if !app.IsDriftAlertEnabled() || previous == nil || current == nil {
+		return
+	}
+	if current.applied != "" && current.applied == current.attempted &&
+		previous.applied == current.applied && previous.attempted == current.attempted &&
+		!meta.IsStatusConditionFalse(previous.conditions, apimeta.ReadyCondition) &&
+		meta.IsStatusConditionFalse(current.conditions, apimeta.ReadyCondition) {
+		r.recorder.Eventf(app, corev1.EventTypeWarning, "Drifted",
+			"the live state of %s %s drifted from the deployed revision %s", current.kind, name, current.applied)
+	}
+}
+
+// fluxReleaseStatus is the common part of the status of HelmRelease and Kustomization
+type fluxReleaseStatus struct {
+	kind       string
+	attempted  string
+	applied    string
+	conditions []metav1.Condition
+	inventory  *kusv1.ResourceInventory
+}
+
+func newHelmReleaseStatus(status *helmv2.HelmReleaseStatus) *fluxReleaseStatus {
+	if status == nil {
+		return nil
+	}
+	return &fluxReleaseStatus{
+		kind:       string(HelmRelease),
+		attempted:  status.LastAttemptedRevision,
+		applied:    status.LastAppliedRevision,
+		conditions: status.Conditions,
+	}
+}
+
+func newKustomizationStatus(status *kusv1.KustomizationStatus) *fluxReleaseStatus {
+	if status == nil {
+		return nil
+	}
+	return &fluxReleaseStatus{
+		kind:       string(Kustomization),
+		attempted:  status.LastAttemptedRevision,
+		applied:    status.LastAppliedRevision,
+		conditions: status.Conditions,
+		inventory:  status.Inventory,
+	}
+}
+
+// normalizeFluxStatus fills the engine-neutral fields of the Application status
+// according to the status of all the HelmReleases and Kustomizations
+func normalizeFluxStatus(app *v1alpha1.Application) {
+	var releases []fluxReleaseStatus
+	helmReleases := make([]string, 0, len(app.Status.FluxApp.HelmReleaseStatus))
+	for name := range app.Status.FluxApp.HelmReleaseStatus {
+		helmReleases = append(helmReleases, name)
+	}
+	sort.Strings(helmReleases)
+	for _, name := range helmReleases {
+		if release := newHelmReleaseStatus(app.Status.FluxApp.HelmReleaseStatus[name]); release != nil {
+			releases = append(releases, *release)
+		}
+	}
+	kustomizations := make([]string, 0, len(app.Status.FluxApp.KustomizationStatus))
+	for name := range app.Status.FluxApp.KustomizationStatus {
+		kustomizations = append(kustomizations, name)
+	}
+	sort.Strings(kustomizations)
+	for _, name := range kustomizations {
+		if release := newKustomizationStatus(app.Status.FluxApp.KustomizationStatus[name]); release != nil {
+			releases = append(releases, *release)
+		}
+	}
+
+	status := &app.Status
+	status.SyncStatus = v1alpha1.SyncStatusUnknown
+	status.HealthStatus = v1alpha1.HealthStatusUnknown
+	status.Revision = ""
+	status.LastOperation = nil
+	status.Resources = &v1alpha1.ResourcesSummary{Kinds: map[string]int{}}
+	if len(releases) == 0 {
+		status.UpdateConditions()
+		return
+	}
+
+	var ready, failed int
+	outOfSync := false
+	operation := &v1alpha1.OperationResult{}
+	for _, release := range releases {
+		resources := 1
+		if release.inventory != nil {
+			resources = len(release.inventory.Entries)
+			for _, entry := range release.inventory.Entries {
+				// the format of the ID is <namespace>_<name>_<group>_<kind>
+				items := strings.Split(entry.ID, "_")
+				status.Resources.Kinds[items[len(items)-1]]++
+			}
+		} else {
+			status.Resources.Kinds[release.kind]++
+		}
+		status.Resources.Total += resources
+
+		if release.applied == "" || release.applied != release.attempted {
+			outOfSync = true
+			status.Resources.OutOfSync += resources
+		}
+		if status.Revision == "" {
+			status.Revision = release.applied
+		}
+		if operation.Revision == "" {
+			operation.Revision = release.attempted
+		}
+
+		condition := meta.FindStatusCondition(release.conditions, apimeta.ReadyCondition)
+		if condition == nil || condition.Status != metav1.ConditionTrue {
+			status.Resources.Unhealthy += resources
+		}
+		if condition == nil {
+			continue
+		}
+		switch condition.Status {
+		case metav1.ConditionTrue:
+			ready++
+		case metav1.ConditionFalse:
+			failed++
+		}
+		if operation.Message == "" || condition.Status != metav1.ConditionTrue {
+			operation.Message = condition.Message
+		}
+		if condition.Status != metav1.ConditionUnknown &&
+			(operation.FinishedAt == nil || operation.FinishedAt.Before(&condition.LastTransitionTime)) {
+			operation.FinishedAt = condition.LastTransitionTime.DeepCopy()
+		}
+	}
+
+	switch {
+	case failed > 0:
+		operation.Phase = v1alpha1.OperationFailed
+		status.HealthStatus = v1alpha1.HealthStatusDegraded
+	case ready == len(releases):
+		operation.Phase = v1alpha1.OperationSucceeded
+		status.HealthStatus = v1alpha1.HealthStatusHealthy
+	default:
+		operation.Phase = v1alpha1.OperationRunning
+		operation.FinishedAt = nil
+		status.HealthStatus = v1alpha1.HealthStatusProgressing
+	}
+	if isFluxAppSuspended(app) {
+		status.HealthStatus = v1alpha1.HealthStatusSuspended
+	}
+	status.SyncStatus = v1alpha1.SyncStatusSynced
+	if outOfSync {
+		status.SyncStatus = v1alpha1.SyncStatusOutOfSync
+	}
+	status.LastOperation = operation
+	if operation.Phase == v1alpha1.OperationSucceeded && !outOfSync && status.Revision != "" {
+		deployedAt := metav1.Now()
+		if operation.FinishedAt != nil {
+			deployedAt = *operation.FinishedAt
+		}
+		status.AddHistory(status.Revision, deployedAt, getFluxDeploymentInitiator(app), getFluxHistoryLimit(app))
+	}
+	status.UpdateConditions()
+}
+
+// getFluxDeploymentInitiator returns the user who requested the latest deployment manually,
+// the deployment is considered as an automated one if there was no sync or rollback since the last deployment
+func getFluxDeploymentInitiator(app *v1alpha1.Application) *v1alpha1.OperationInitiator {
+	if app.Spec.FluxApp != nil {
+		op := app.Spec.FluxApp.Operation
+		if op != nil && (op.Type == v1alpha1.FluxOperationSync || op.Type == v1alpha1.FluxOperationRollback) {
+			history := app.Status.History
+			if len(history) == 0 || history[len(history)-1].DeployedAt.Before(&op.RequestedAt) {
+				initiator := op.InitiatedBy
+				return &initiator
+			}
+		}
+	}
+	return &v1alpha1.OperationInitiator{Automated: true}
+}
+
+// getFluxHistoryLimit returns the MaxHistory of the HelmReleases, or the default limit if it's absent
+func getFluxHistoryLimit(app *v1alpha1.Application) int {
+	if app.Spec.FluxApp != nil && app.Spec.FluxApp.Spec.Config != nil && app.Spec.FluxApp.Spec.Config.HelmRelease != nil {
+		for _, deploy := range app.Spec.FluxApp.Spec.Config.HelmRelease.Deploy {
+			if deploy != nil && deploy.MaxHistory != nil {
+				return *deploy.MaxHistory
+			}
+		}
+	}
+	return v1alpha1.DefaultHistoryLimit
+}
+
+// isFluxAppSuspended returns true if the Application is suspended, or the reconciliation of all the HelmReleases or
+// Kustomizations are suspended
+func isFluxAppSuspended(app *v1alpha1.Application) bool {
+	if app.IsSuspended() {
+		return true
+	}
+	if app.Spec.FluxApp == nil || app.Spec.FluxApp.Spec.Config == nil {
+		return false
+	}
+	config := app.Spec.FluxApp.Spec.Config
+	total, suspended := 0, 0
+	if config.HelmRelease != nil {
+		for _, deploy := range config.HelmRelease.Deploy {
+			if deploy != nil {
+				total++
+				if deploy.Suspend {
+					suspended++
+				}
+			}
+		}
+	}
+	for _, kus := range config.Kustomization {
+		if kus != nil {
+			total++
+			if kus.Suspend {
+				suspended++
+			}
+		}
+	}
+	return total > 0 && total == suspended
+}
+
 // GetName returns the name of this controller
 func (r *ApplicationStatusReconciler) GetName() string {
 	return "FluxCDApplicationStatusController"
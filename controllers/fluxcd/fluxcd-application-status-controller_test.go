@@ -58,7 +58,7 @@ func TestApplicationStatusReconciler_Reconcile(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -108,7 +108,7 @@ func TestApplicationStatusReconciler_Reconcile(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -304,7 +304,7 @@ func TestApplicationStatusReconciler_reconcileHelmRelease(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -520,6 +520,8 @@ func TestApplicationStatusReconciler_reconcileHelmRelease(t *testing.T) {
 				// labels
 				assert.Equal(t, string(HelmRelease), app.GetLabels()[FluxAppTypeKey])
 				assert.Equal(t, "0-1", app.GetLabels()[FluxAppReadyNumKey])
+				assert.Equal(t, string(v1alpha1.HealthStatusProgressing), app.GetLabels()[v1alpha1.HealthStatusLabelKey])
+				assert.Equal(t, v1alpha1.HealthStatusProgressing, app.Status.HealthStatus)
 			},
 		},
 		{
@@ -610,7 +612,7 @@ func TestApplicationStatusReconciler_reconcileKustomization(t *testing.T) {
 			FluxApp: &v1alpha1.FluxApplication{
 				Spec: v1alpha1.FluxApplicationSpec{
 					Source: &v1alpha1.FluxApplicationSource{
-						SourceRef: helmv2.CrossNamespaceObjectReference{
+						SourceRef: v1alpha1.FluxSourceReference{
 							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
 							Kind:       "GitRepository",
 							Name:       "fake-repo",
@@ -830,3 +832,277 @@ func TestApplicationStatusReconciler_SetupWithManager(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizeFluxStatus(t *testing.T) {
+	transitionTime := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	ready := func(status metav1.ConditionStatus, message string) []metav1.Condition {
+		return []metav1.Condition{{Type: meta.ReadyCondition, Status: status, Message: message, LastTransitionTime: transitionTime}}
+	}
+
+	tests := []struct {
+		name          string
+		app           *v1alpha1.Application
+		wantSync      v1alpha1.SyncStatusCode
+		wantHealth    v1alpha1.HealthStatusCode
+		wantRevision  string
+		wantOperation *v1alpha1.OperationResult
+		wantResources *v1alpha1.ResourcesSummary
+		wantHistory   []string
+	}{{
+		name:          "no status",
+		app:           &v1alpha1.Application{},
+		wantSync:      v1alpha1.SyncStatusUnknown,
+		wantHealth:    v1alpha1.HealthStatusUnknown,
+		wantResources: &v1alpha1.ResourcesSummary{Kinds: map[string]int{}},
+	}, {
+		name: "ready HelmRelease and Kustomization",
+		app: &v1alpha1.Application{Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+			HelmReleaseStatus: map[string]*helmv2.HelmReleaseStatus{"hr": {
+				LastAttemptedRevision: "0.1.0",
+				LastAppliedRevision:   "0.1.0",
+				Conditions:            ready(metav1.ConditionTrue, "Release reconciliation succeeded"),
+			}},
+			KustomizationStatus: map[string]*kusv1.KustomizationStatus{"kus": {
+				LastAttemptedRevision: "main/a",
+				LastAppliedRevision:   "main/a",
+				Conditions:            ready(metav1.ConditionTrue, "Applied revision: main/a"),
+				Inventory: &kusv1.ResourceInventory{Entries: []kusv1.ResourceRef{
+					{ID: "default_app_apps_Deployment"}, {ID: "default_app__Service"},
+				}},
+			}},
+		}}},
+		wantSync:     v1alpha1.SyncStatusSynced,
+		wantHealth:   v1alpha1.HealthStatusHealthy,
+		wantRevision: "0.1.0",
+		wantOperation: &v1alpha1.OperationResult{
+			Phase:      v1alpha1.OperationSucceeded,
+			Message:    "Release reconciliation succeeded",
+			Revision:   "0.1.0",
+			FinishedAt: &transitionTime,
+		},
+		wantResources: &v1alpha1.ResourcesSummary{Total: 3, Kinds: map[string]int{"HelmRelease": 1, "Deployment": 1, "Service": 1}},
+		wantHistory:   []string{"0.1.0"},
+	}, {
+		name: "failed Kustomization",
+		app: &v1alpha1.Application{Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+			KustomizationStatus: map[string]*kusv1.KustomizationStatus{"kus": {
+				LastAttemptedRevision: "main/b",
+				LastAppliedRevision:   "main/a",
+				Conditions:            ready(metav1.ConditionFalse, "apply failed"),
+			}},
+		}}},
+		wantSync:     v1alpha1.SyncStatusOutOfSync,
+		wantHealth:   v1alpha1.HealthStatusDegraded,
+		wantRevision: "main/a",
+		wantOperation: &v1alpha1.OperationResult{
+			Phase:      v1alpha1.OperationFailed,
+			Message:    "apply failed",
+			Revision:   "main/b",
+			FinishedAt: &transitionTime,
+		},
+		wantResources: &v1alpha1.ResourcesSummary{Total: 1, OutOfSync: 1, Unhealthy: 1, Kinds: map[string]int{"Kustomization": 1}},
+	}, {
+		name: "suspended HelmRelease",
+		app: &v1alpha1.Application{
+			Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+				Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{
+					Deploy: []*v1alpha1.Deploy{{Suspend: true}},
+				}},
+			}}},
+			Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+				HelmReleaseStatus: map[string]*helmv2.HelmReleaseStatus{"hr": {LastAttemptedRevision: "0.1.0"}},
+			}},
+		},
+		wantSync:   v1alpha1.SyncStatusOutOfSync,
+		wantHealth: v1alpha1.HealthStatusSuspended,
+		wantOperation: &v1alpha1.OperationResult{
+			Phase:    v1alpha1.OperationRunning,
+			Revision: "0.1.0",
+		},
+		wantResources: &v1alpha1.ResourcesSummary{Total: 1, OutOfSync: 1, Unhealthy: 1, Kinds: map[string]int{"HelmRelease": 1}},
+	}, {
+		name: "suspended Application",
+		app: &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{v1alpha1.AnnoKeySuspended: "true"}},
+			Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+				Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{
+					Deploy: []*v1alpha1.Deploy{{}},
+				}},
+			}}},
+			Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+				HelmReleaseStatus: map[string]*helmv2.HelmReleaseStatus{"hr": {LastAttemptedRevision: "0.1.0"}},
+			}},
+		},
+		wantSync:   v1alpha1.SyncStatusOutOfSync,
+		wantHealth: v1alpha1.HealthStatusSuspended,
+		wantOperation: &v1alpha1.OperationResult{
+			Phase:    v1alpha1.OperationRunning,
+			Revision: "0.1.0",
+		},
+		wantResources: &v1alpha1.ResourcesSummary{Total: 1, OutOfSync: 1, Unhealthy: 1, Kinds: map[string]int{"HelmRelease": 1}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizeFluxStatus(tt.app)
+			status := tt.app.Status
+			assert.Equal(t, tt.wantSync, status.SyncStatus)
+			assert.Equal(t, tt.wantHealth, status.HealthStatus)
+			assert.Equal(t, tt.wantRevision, status.Revision)
+			assert.Equal(t, tt.wantOperation, status.LastOperation)
+			assert.Equal(t, tt.wantResources, status.Resources)
+			var history []string
+			for _, item := range status.History {
+				history = append(history, item.Revision)
+			}
+			assert.Equal(t, tt.wantHistory, history)
+			if assert.Len(t, status.Conditions, 1) {
+				assert.Equal(t, v1alpha1.ConditionTypeReady, status.Conditions[0].Type)
+			}
+		})
+	}
+}
+
+func Test_getFluxDeploymentInitiator(t *testing.T) {
+	deployedAt := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	createApp := func(op *v1alpha1.FluxOperation, history ...v1alpha1.RevisionHistory) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			Spec:   v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Operation: op}},
+			Status: v1alpha1.ApplicationStatus{History: history},
+		}
+	}
+
+	tests := []struct {
+		name string
+		app  *v1alpha1.Application
+		want *v1alpha1.OperationInitiator
+	}{{
+		name: "no operation",
+		app:  createApp(nil),
+		want: &v1alpha1.OperationInitiator{Automated: true},
+	}, {
+		name: "sync without history",
+		app: createApp(&v1alpha1.FluxOperation{
+			Type:        v1alpha1.FluxOperationSync,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+			RequestedAt: deployedAt,
+		}),
+		want: &v1alpha1.OperationInitiator{Username: "admin"},
+	}, {
+		name: "rollback after the last deployment",
+		app: createApp(&v1alpha1.FluxOperation{
+			Type:        v1alpha1.FluxOperationRollback,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+			RequestedAt: metav1.NewTime(deployedAt.Add(time.Minute)),
+		}, v1alpha1.RevisionHistory{DeployedAt: deployedAt}),
+		want: &v1alpha1.OperationInitiator{Username: "admin"},
+	}, {
+		name: "sync before the last deployment",
+		app: createApp(&v1alpha1.FluxOperation{
+			Type:        v1alpha1.FluxOperationSync,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+			RequestedAt: metav1.NewTime(deployedAt.Add(-time.Minute)),
+		}, v1alpha1.RevisionHistory{DeployedAt: deployedAt}),
+		want: &v1alpha1.OperationInitiator{Automated: true},
+	}, {
+		name: "suspend",
+		app: createApp(&v1alpha1.FluxOperation{
+			Type:        v1alpha1.FluxOperationSuspend,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+			RequestedAt: deployedAt,
+		}),
+		want: &v1alpha1.OperationInitiator{Automated: true},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, getFluxDeploymentInitiator(tt.app))
+		})
+	}
+}
+
+func Test_getFluxHistoryLimit(t *testing.T) {
+	maxHistory := 3
+	assert.Equal(t, v1alpha1.DefaultHistoryLimit, getFluxHistoryLimit(&v1alpha1.Application{}))
+	assert.Equal(t, maxHistory, getFluxHistoryLimit(&v1alpha1.Application{
+		Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+			Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{
+				Deploy: []*v1alpha1.Deploy{{MaxHistory: &maxHistory}},
+			}},
+		}}},
+	}))
+}
+
+func TestApplicationStatusReconciler_alertDrift(t *testing.T) {
+	const revision, newRevision = "main@sha1:a1b2c3", "main@sha1:d4e5f6"
+	release := func(status metav1.ConditionStatus, attempted, applied string) *fluxReleaseStatus {
+		return &fluxReleaseStatus{
+			kind:       string(HelmRelease),
+			attempted:  attempted,
+			applied:    applied,
+			conditions: []metav1.Condition{{Type: meta.ReadyCondition, Status: status}},
+		}
+	}
+	createApp := func(alert bool) *v1alpha1.Application {
+		app := &v1alpha1.Application{}
+		if alert {
+			app.SetAnnotations(map[string]string{v1alpha1.AnnoKeyDriftAlert: "true"})
+		}
+		return app
+	}
+
+	tests := []struct {
+		name      string
+		app       *v1alpha1.Application
+		previous  *fluxReleaseStatus
+		current   *fluxReleaseStatus
+		wantEvent bool
+	}{{
+		name:      "not ready without a new revision",
+		app:       createApp(true),
+		previous:  release(metav1.ConditionTrue, revision, revision),
+		current:   release(metav1.ConditionFalse, revision, revision),
+		wantEvent: true,
+	}, {
+		name:      "not ready after a reconciliation in progress",
+		app:       createApp(true),
+		previous:  release(metav1.ConditionUnknown, revision, revision),
+		current:   release(metav1.ConditionFalse, revision, revision),
+		wantEvent: true,
+	}, {
+		name:     "the upgrade to a new revision failed",
+		app:      createApp(true),
+		previous: release(metav1.ConditionTrue, revision, revision),
+		current:  release(metav1.ConditionFalse, newRevision, revision),
+	}, {
+		name:     "the retry of a failed upgrade",
+		app:      createApp(true),
+		previous: release(metav1.ConditionUnknown, newRevision, revision),
+		current:  release(metav1.ConditionFalse, newRevision, revision),
+	}, {
+		name:     "not ready already",
+		app:      createApp(true),
+		previous: release(metav1.ConditionFalse, revision, revision),
+		current:  release(metav1.ConditionFalse, revision, revision),
+	}, {
+		name:    "observed for the first time",
+		app:     createApp(true),
+		current: release(metav1.ConditionFalse, revision, revision),
+	}, {
+		name:     "drift alert is not enabled",
+		app:      createApp(false),
+		previous: release(metav1.ConditionTrue, revision, revision),
+		current:  release(metav1.ConditionFalse, revision, revision),
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			r := &ApplicationStatusReconciler{recorder: recorder}
+			r.alertDrift(tt.app, "fake-release", tt.previous, tt.current)
+			if tt.wantEvent {
+				assert.Len(t, recorder.Events, 1)
+				assert.Contains(t, <-recorder.Events, "Drifted")
+			} else {
+				assert.Len(t, recorder.Events, 0)
+			}
+		})
+	}
+}
@@ -18,11 +18,16 @@ package fluxcd
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -33,11 +38,13 @@ import (
 	"kubesphere.io/devops/pkg/utils/k8sutil"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 //+kubebuilder:rbac:groups=devops.kubesphere.io,resources=gitrepositories,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
-//+kubebuilder:rbac:groups="source.toolkit.fluxcd.io",resources=gitrepositories,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="source.toolkit.fluxcd.io",resources=gitrepositories;helmrepositories;ocirepositories;buckets,verbs=get;list;create;update;delete
 
 // GitRepositoryReconciler is the reconciler of the FluxCDGitRepository
 type GitRepositoryReconciler struct {
@@ -61,17 +68,13 @@ func (r *GitRepositoryReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 func (r *GitRepositoryReconciler) reconcileFluxGitRepo(repo *v1alpha3.GitRepository) (err error) {
 	ctx := context.Background()
-	fluxGitRepo := createBareFluxGitRepoObject()
-	// FluxGitRepo's namespace = v1alpha3.GitRepository's namespace
-	// FluxGitRepo's name = "fluxcd-" + v1alpha3.GitRepository's name
+	// FluxSource's namespace = v1alpha3.GitRepository's namespace
+	// FluxSource's name = "fluxcd-" + v1alpha3.GitRepository's name
 	ns, name := repo.GetNamespace(), getFluxRepoName(repo.GetName())
 
 	if !isArtifactRepo(repo) || !repo.ObjectMeta.DeletionTimestamp.IsZero() {
-		if err = r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, fluxGitRepo); err != nil {
-			err = client.IgnoreNotFound(err)
-		} else {
-			r.log.Info("delete FluxCDGitRepository", "name", fluxGitRepo.GetName())
-			err = r.Delete(ctx, fluxGitRepo)
+		if err = r.deleteFluxSources(ctx, ns, name, ""); err == nil {
+			err = r.deleteFluxSourceCredential(ctx, repo)
 		}
 
 		if err == nil {
@@ -87,34 +90,56 @@ func (r *GitRepositoryReconciler) reconcileFluxGitRepo(repo *v1alpha3.GitReposit
 		}
 	}
 
-	if err = r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, fluxGitRepo); err != nil {
+	repoType := getArtifactRepoType(repo)
+	kind := getFluxSourceKind(repoType)
+	// the type of the repository might be changed, remove the sources of other kinds
+	if err = r.deleteFluxSources(ctx, ns, name, kind); err != nil {
+		return
+	}
+
+	var secretName string
+	if secretName, err = r.reconcileFluxSourceCredential(ctx, repo, repoType); err != nil {
+		r.recorder.Eventf(repo, v1.EventTypeWarning, "FailedWithFluxCD",
+			"failed to prepare the credential of FluxCD %s, error is: %v", kind, err)
+		return
+	}
+
+	var newFluxSource *unstructured.Unstructured
+	if newFluxSource, err = createUnstructuredFluxSource(repo, repoType, secretName); err != nil {
+		r.recorder.Eventf(repo, v1.EventTypeWarning, "FailedWithFluxCD",
+			"failed to generate FluxCD %s, error is: %v", kind, err)
+		return
+	}
+
+	fluxSource := createBareFluxSourceObject(kind)
+	if err = r.Get(ctx, types.NamespacedName{Namespace: ns, Name: name}, fluxSource); err != nil {
 		if !apierrors.IsNotFound(err) {
 			return
 		}
-		// flux git repo did not existed
+		// flux source did not existed
 		// create
-		newFluxGitRepo := createUnstructuredFluxGitRepo(repo)
-		if err = r.Create(ctx, newFluxGitRepo); err != nil {
-			r.recorder.Eventf(newFluxGitRepo, v1.EventTypeWarning, "FailedWithFluxCD",
-				"failed to create FluxCDGitRepository, error is: %v", err)
+		if err = r.Create(ctx, newFluxSource); err != nil {
+			r.recorder.Eventf(newFluxSource, v1.EventTypeWarning, "FailedWithFluxCD",
+				"failed to create FluxCD%s, error is: %v", kind, err)
 		}
 	} else {
-		// flux git repo existed
+		// flux source existed
 		// update
-		newFluxGitRepo := createUnstructuredFluxGitRepo(repo)
-		fluxGitRepo.Object["spec"] = newFluxGitRepo.Object["spec"]
+		// the spec is always generated from the GitRepository. A rollback never changes this source which might be
+		// shared, it pins the dedicated copy <application>-pinned or the chart version of the HelmRelease instead
+		fluxSource.Object["spec"] = newFluxSource.Object["spec"]
 		err = retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
-			latestGitRepo := createBareFluxGitRepoObject()
+			latestSource := createBareFluxSourceObject(kind)
 			if err = r.Get(ctx, types.NamespacedName{
-				Namespace: fluxGitRepo.GetNamespace(),
-				Name:      fluxGitRepo.GetName(),
-			}, latestGitRepo); err != nil {
+				Namespace: fluxSource.GetNamespace(),
+				Name:      fluxSource.GetName(),
+			}, latestSource); err != nil {
 				return
 			}
 
-			fluxGitRepo.SetResourceVersion(latestGitRepo.GetResourceVersion())
-			r.log.Info("update FluxCDGitRepository", "name", fluxGitRepo.GetName())
-			err = r.Update(ctx, fluxGitRepo)
+			fluxSource.SetResourceVersion(latestSource.GetResourceVersion())
+			r.log.Info("update FluxCD"+kind, "name", fluxSource.GetName())
+			err = r.Update(ctx, fluxSource)
 			return
 		})
 
@@ -122,25 +147,228 @@ func (r *GitRepositoryReconciler) reconcileFluxGitRepo(repo *v1alpha3.GitReposit
 	return
 }
 
+// deleteFluxSources deletes the FluxCD sources of all kinds except the kept one
+func (r *GitRepositoryReconciler) deleteFluxSources(ctx context.Context, ns, name, keptKind string) (err error) {
+	for _, kind := range fluxSourceKinds {
+		if kind == keptKind {
+			continue
+		}
+
+		fluxSource := createBareFluxSourceObject(kind)
+		fluxSource.SetNamespace(ns)
+		fluxSource.SetName(name)
+		if err = r.Delete(ctx, fluxSource); err != nil {
+			// the CRD of this kind might not be installed
+			if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				err = nil
+				continue
+			}
+			return
+		}
+		r.log.Info("delete FluxCD"+kind, "name", name)
+	}
+	return
+}
+
+// reconcileFluxSourceCredential returns the name of the secret which is referenced by the FluxCD source.
+// The username and password of a DevOps basic-auth credential are understood by the FluxCD GitRepository and
+// HelmRepository, but the OCIRepository and Bucket need a secret which is converted from the credential.
+// Only the secret in the namespace of the repository can be referenced, otherwise the credential of
+// another project could be copied out.
+func (r *GitRepositoryReconciler) reconcileFluxSourceCredential(ctx context.Context, repo *v1alpha3.GitRepository,
+	repoType v1alpha1.ArtifactRepoType) (secretName string, err error) {
+	if repo.Spec.Secret != nil && repo.Spec.Secret.Namespace != "" && repo.Spec.Secret.Namespace != repo.GetNamespace() {
+		err = fmt.Errorf("the secret %s/%s must be in the namespace of the repository %s",
+			repo.Spec.Secret.Namespace, repo.Spec.Secret.Name, repo.GetNamespace())
+		return
+	}
+	if repo.Spec.Secret == nil || repo.Spec.Secret.Name == "" ||
+		(repoType != v1alpha1.ArtifactRepoTypeOCI && repoType != v1alpha1.ArtifactRepoTypeBucket) {
+		if repo.Spec.Secret != nil {
+			secretName = repo.Spec.Secret.Name
+		}
+		err = r.deleteFluxSourceCredential(ctx, repo)
+		return
+	}
+
+	credential := &v1.Secret{}
+	if err = r.Get(ctx, types.NamespacedName{Namespace: repo.GetNamespace(), Name: repo.Spec.Secret.Name}, credential); err != nil {
+		return
+	}
+	if credential.Type != v1alpha3.SecretTypeBasicAuth {
+		err = fmt.Errorf("the %s repository only supports the credential of type %s, got %s",
+			repoType, v1alpha3.SecretTypeBasicAuth, credential.Type)
+		return
+	}
+	username := string(credential.Data[v1alpha3.BasicAuthUsernameKey])
+	password := string(credential.Data[v1alpha3.BasicAuthPasswordKey])
+
+	fluxSecret := &v1.Secret{}
+	fluxSecret.SetNamespace(repo.GetNamespace())
+	fluxSecret.SetName(getFluxCredentialName(repo.GetName()))
+	fluxSecret.SetLabels(map[string]string{
+		"app.kubernetes.io/managed-by": v1alpha1.GroupName,
+	})
+	switch repoType {
+	case v1alpha1.ArtifactRepoTypeOCI:
+		var config []byte
+		if config, err = createDockerConfigJSON(repo.Spec.URL, username, password); err != nil {
+			return
+		}
+		fluxSecret.Type = v1.SecretTypeDockerConfigJson
+		fluxSecret.Data = map[string][]byte{v1.DockerConfigJsonKey: config}
+	case v1alpha1.ArtifactRepoTypeBucket:
+		fluxSecret.Type = v1.SecretTypeOpaque
+		fluxSecret.Data = map[string][]byte{
+			"accesskey": []byte(username),
+			"secretkey": []byte(password),
+		}
+	}
+	if err = controllerutil.SetOwnerReference(repo, fluxSecret, r.Scheme()); err != nil {
+		return
+	}
+	secretName = fluxSecret.GetName()
+
+	existing := &v1.Secret{}
+	if err = r.Get(ctx, types.NamespacedName{Namespace: fluxSecret.GetNamespace(), Name: secretName}, existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = r.Create(ctx, fluxSecret)
+		}
+		return
+	}
+	if existing.Type != fluxSecret.Type {
+		// the type of a secret is immutable
+		if err = r.Delete(ctx, existing); err == nil {
+			err = r.Create(ctx, fluxSecret)
+		}
+		return
+	}
+	existing.Data = fluxSecret.Data
+	existing.SetOwnerReferences(fluxSecret.GetOwnerReferences())
+	err = r.Update(ctx, existing)
+	return
+}
+
+func (r *GitRepositoryReconciler) deleteFluxSourceCredential(ctx context.Context, repo *v1alpha3.GitRepository) error {
+	secret := &v1.Secret{}
+	secret.SetNamespace(repo.GetNamespace())
+	secret.SetName(getFluxCredentialName(repo.GetName()))
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
 func createUnstructuredFluxGitRepo(repo *v1alpha3.GitRepository) *unstructured.Unstructured {
-	newFluxGitRepo := createBareFluxGitRepoObject()
-	newFluxGitRepo.SetNamespace(repo.GetNamespace())
-	newFluxGitRepo.SetName(getFluxRepoName(repo.GetName()))
+	var secretName string
+	if repo.Spec.Secret != nil {
+		secretName = repo.Spec.Secret.Name
+	}
+	// a GitRepository never fails to be generated
+	newFluxGitRepo, _ := createUnstructuredFluxSource(repo, v1alpha1.ArtifactRepoTypeGit, secretName)
+	return newFluxGitRepo
+}
+
+func createUnstructuredFluxSource(repo *v1alpha3.GitRepository, repoType v1alpha1.ArtifactRepoType,
+	secretName string) (*unstructured.Unstructured, error) {
+	newFluxSource := createBareFluxSourceObject(getFluxSourceKind(repoType))
+	newFluxSource.SetNamespace(repo.GetNamespace())
+	newFluxSource.SetName(getFluxRepoName(repo.GetName()))
 
-	// set url
-	_ = unstructured.SetNestedField(newFluxGitRepo.Object, repo.Spec.URL, "spec", "url")
+	switch repoType {
+	case v1alpha1.ArtifactRepoTypeBucket:
+		if err := setBucketEndpoint(newFluxSource, repo.Spec.URL); err != nil {
+			return nil, err
+		}
+	case v1alpha1.ArtifactRepoTypeOCI:
+		if err := setOCIRef(newFluxSource, repo.GetAnnotations()[v1alpha1.ArtifactRepoRefAnnoKey]); err != nil {
+			return nil, err
+		}
+		_ = unstructured.SetNestedField(newFluxSource.Object, repo.Spec.URL, "spec", "url")
+	case v1alpha1.ArtifactRepoTypeOCIHelm:
+		_ = unstructured.SetNestedField(newFluxSource.Object, "oci", "spec", "type")
+		fallthrough
+	default:
+		// set url
+		_ = unstructured.SetNestedField(newFluxSource.Object, repo.Spec.URL, "spec", "url")
+	}
 	// set interval
-	_ = unstructured.SetNestedField(newFluxGitRepo.Object, "1m", "spec", "interval")
+	_ = unstructured.SetNestedField(newFluxSource.Object, "1m", "spec", "interval")
 	// set secretRef
-	if repo.Spec.Secret != nil && repo.Spec.Secret.Name != "" {
-		_ = unstructured.SetNestedField(newFluxGitRepo.Object, repo.Spec.Secret.Name, "spec", "secretRef", "name")
+	if secretName != "" {
+		_ = unstructured.SetNestedField(newFluxSource.Object, secretName, "spec", "secretRef", "name")
 	}
 
-	newFluxGitRepo.SetLabels(map[string]string{
+	newFluxSource.SetLabels(map[string]string{
 		"app.kubernetes.io/managed-by": v1alpha1.GroupName,
 	})
+	return newFluxSource, nil
+}
 
-	return newFluxGitRepo
+// setOCIRef sets the reference of a FluxCD OCIRepository from a value like tag:v1.0.0, semver:>=1.0.0 or
+// digest:sha256:<hash>, nothing is set for an empty value so that FluxCD pulls the latest tag
+func setOCIRef(ociRepo *unstructured.Unstructured, ref string) error {
+	if ref == "" {
+		return nil
+	}
+	pair := strings.SplitN(ref, ":", 2)
+	if len(pair) != 2 || pair[1] == "" {
+		return fmt.Errorf("invalid OCI reference %q, it should be like tag:v1.0.0, semver:>=1.0.0 or digest:sha256:<hash>", ref)
+	}
+	switch pair[0] {
+	case "tag", "semver", "digest":
+		_ = unstructured.SetNestedField(ociRepo.Object, pair[1], "spec", "ref", pair[0])
+	default:
+		return fmt.Errorf("unsupported kind %q of the OCI reference %q, it should be tag, semver or digest", pair[0], ref)
+	}
+	return nil
+}
+
+// setBucketEndpoint sets the endpoint, bucketName, region and insecure of a FluxCD Bucket
+// from a URL like https://minio.example.com/bucket-name?region=us-east-1
+func setBucketEndpoint(bucket *unstructured.Unstructured, rawURL string) (err error) {
+	var bucketURL *url.URL
+	if bucketURL, err = url.Parse(rawURL); err != nil {
+		return
+	}
+	bucketName := strings.Split(strings.Trim(bucketURL.Path, "/"), "/")[0]
+	if bucketURL.Host == "" || bucketName == "" {
+		return fmt.Errorf("invalid bucket URL %q, it should be like https://endpoint/bucket-name", rawURL)
+	}
+
+	_ = unstructured.SetNestedField(bucket.Object, "generic", "spec", "provider")
+	_ = unstructured.SetNestedField(bucket.Object, bucketURL.Host, "spec", "endpoint")
+	_ = unstructured.SetNestedField(bucket.Object, bucketName, "spec", "bucketName")
+	if bucketURL.Scheme == "http" {
+		_ = unstructured.SetNestedField(bucket.Object, true, "spec", "insecure")
+	}
+	if region := bucketURL.Query().Get("region"); region != "" {
+		_ = unstructured.SetNestedField(bucket.Object, region, "spec", "region")
+	}
+	return
+}
+
+// createDockerConfigJSON creates the docker config which is required by the FluxCD OCIRepository
+func createDockerConfigJSON(rawURL, username, password string) ([]byte, error) {
+	registryURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if registryURL.Host == "" {
+		return nil, fmt.Errorf("invalid OCI repository URL %q, it should be like oci://registry/repository", rawURL)
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			registryURL.Host: map[string]string{
+				"username": username,
+				"password": password,
+				"auth":     auth,
+			},
+		},
+	})
+}
+
+func getFluxCredentialName(name string) string {
+	return fmt.Sprintf("fluxcd-%s-credential", name)
 }
 
 func getFluxRepoName(name string) string {
@@ -153,13 +381,42 @@ func (r *GitRepositoryReconciler) GetName() string {
 }
 
 func createBareFluxGitRepoObject() *unstructured.Unstructured {
-	fluxGitRepo := &unstructured.Unstructured{}
-	fluxGitRepo.SetGroupVersionKind(schema.GroupVersionKind{
+	return createBareFluxSourceObject("GitRepository")
+}
+
+// fluxSourceKinds are the kinds of FluxCD source which might be generated from a GitRepository
+var fluxSourceKinds = []string{"GitRepository", "HelmRepository", "OCIRepository", "Bucket"}
+
+func createBareFluxSourceObject(kind string) *unstructured.Unstructured {
+	fluxSource := &unstructured.Unstructured{}
+	fluxSource.SetGroupVersionKind(schema.GroupVersionKind{
 		Group:   "source.toolkit.fluxcd.io",
 		Version: "v1beta2",
-		Kind:    "GitRepository",
+		Kind:    kind,
 	})
-	return fluxGitRepo
+	return fluxSource
+}
+
+// getArtifactRepoType returns the type of the ArtifactRepo, the unknown type is treated as git
+func getArtifactRepoType(repo *v1alpha3.GitRepository) v1alpha1.ArtifactRepoType {
+	switch repoType := v1alpha1.ArtifactRepoType(repo.GetLabels()[v1alpha1.ArtifactRepoTypeLabelKey]); repoType {
+	case v1alpha1.ArtifactRepoTypeHelm, v1alpha1.ArtifactRepoTypeOCIHelm,
+		v1alpha1.ArtifactRepoTypeOCI, v1alpha1.ArtifactRepoTypeBucket:
+		return repoType
+	}
+	return v1alpha1.ArtifactRepoTypeGit
+}
+
+func getFluxSourceKind(repoType v1alpha1.ArtifactRepoType) string {
+	switch repoType {
+	case v1alpha1.ArtifactRepoTypeHelm, v1alpha1.ArtifactRepoTypeOCIHelm:
+		return "HelmRepository"
+	case v1alpha1.ArtifactRepoTypeOCI:
+		return "OCIRepository"
+	case v1alpha1.ArtifactRepoTypeBucket:
+		return "Bucket"
+	}
+	return "GitRepository"
 }
 
 // isArtifactRepo check whether the repo is ArtifactRepo
@@ -39,6 +39,8 @@ import (
 func TestGitRepositoryReconciler_reconcileFluxGitRepo(t *testing.T) {
 	schema, err := v1alpha3.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
 
 	NonArtifactRepo := &v1alpha3.GitRepository{
 		ObjectMeta: metav1.ObjectMeta{
@@ -73,6 +75,8 @@ func TestGitRepositoryReconciler_reconcileFluxGitRepo(t *testing.T) {
 
 	FluxGitRepo := createBareFluxGitRepoObject()
 	preDelFluxGitRepo := createUnstructuredFluxGitRepo(ArtifactRepo)
+	pinnedFluxGitRepo := createUnstructuredFluxGitRepo(ArtifactRepo)
+	_ = unstructured.SetNestedField(pinnedFluxGitRepo.Object, "fake-commit", "spec", "ref", "commit")
 
 	type fields struct {
 		Client client.Client
@@ -185,6 +189,28 @@ func TestGitRepositoryReconciler_reconcileFluxGitRepo(t *testing.T) {
 				assert.Equal(t, "https://fakeGitHub.com/faker/another-fake-project", url)
 			},
 		},
+		{
+			name: "update a Artifact git repository which was pinned to a commit",
+			fields: fields{
+				Client: fake.NewFakeClientWithScheme(schema, ArtifactRepo.DeepCopy(), pinnedFluxGitRepo.DeepCopy()),
+			},
+			args: args{
+				repo: ArtifactRepoWithNewURL.DeepCopy(),
+			},
+			verify: func(t *testing.T, Client client.Client, err error) {
+				assert.Nil(t, err)
+				gitrepo := FluxGitRepo.DeepCopy()
+				err = Client.Get(context.TODO(), types.NamespacedName{
+					Name:      getFluxRepoName(ArtifactRepo.GetName()),
+					Namespace: ArtifactRepo.GetNamespace(),
+				}, gitrepo)
+				assert.Nil(t, err)
+				url, _, _ := unstructured.NestedString(gitrepo.Object, "spec", "url")
+				assert.Equal(t, "https://fakeGitHub.com/faker/another-fake-project", url)
+				_, found, _ := unstructured.NestedString(gitrepo.Object, "spec", "ref", "commit")
+				assert.False(t, found)
+			},
+		},
 		{
 			name: "update a Non-Artifact git repository (add the ArtifactRepo Label)",
 			fields: fields{
@@ -224,6 +250,225 @@ func TestGitRepositoryReconciler_reconcileFluxGitRepo(t *testing.T) {
 	}
 }
 
+func TestGitRepositoryReconciler_reconcileFluxSources(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	newArtifactRepo := func(repoType v1alpha1.ArtifactRepoType, url string) *v1alpha3.GitRepository {
+		return &v1alpha3.GitRepository{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fake-repo",
+				Namespace: "fake-ns",
+				Labels: map[string]string{
+					v1alpha1.ArtifactRepoLabelKey:     "true",
+					v1alpha1.ArtifactRepoTypeLabelKey: string(repoType),
+				},
+				ResourceVersion: "999",
+			},
+			Spec: v1alpha3.GitRepositorySpec{
+				URL: url,
+				Secret: &v1.SecretReference{
+					Name:      "fake-secret",
+					Namespace: "fake-ns",
+				},
+			},
+		}
+	}
+	basicAuth := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-secret",
+			Namespace: "fake-ns",
+		},
+		Type: v1alpha3.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			v1alpha3.BasicAuthUsernameKey: []byte("admin"),
+			v1alpha3.BasicAuthPasswordKey: []byte("password"),
+		},
+	}
+	sshAuth := basicAuth.DeepCopy()
+	sshAuth.Type = v1alpha3.SecretTypeSSHAuth
+
+	getSource := func(c client.Client, kind string) (*unstructured.Unstructured, error) {
+		source := createBareFluxSourceObject(kind)
+		err := c.Get(context.TODO(), types.NamespacedName{
+			Namespace: "fake-ns",
+			Name:      getFluxRepoName("fake-repo"),
+		}, source)
+		return source, err
+	}
+	getCredential := func(c client.Client) (*v1.Secret, error) {
+		secret := &v1.Secret{}
+		err := c.Get(context.TODO(), types.NamespacedName{
+			Namespace: "fake-ns",
+			Name:      getFluxCredentialName("fake-repo"),
+		}, secret)
+		return secret, err
+	}
+
+	ociRepo := newArtifactRepo(v1alpha1.ArtifactRepoTypeOCI, "oci://ghcr.io/faker/manifests")
+	preFluxGitRepo := createUnstructuredFluxGitRepo(ociRepo)
+
+	tests := []struct {
+		name    string
+		repo    *v1alpha3.GitRepository
+		objects []client.Object
+		verify  func(t *testing.T, c client.Client, err error)
+	}{{
+		name:    "helm repository of the oci type",
+		repo:    newArtifactRepo(v1alpha1.ArtifactRepoTypeOCIHelm, "oci://ghcr.io/faker/charts"),
+		objects: []client.Object{basicAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.Nil(t, err)
+			source, err := getSource(c, "HelmRepository")
+			assert.Nil(t, err)
+			repoType, _, _ := unstructured.NestedString(source.Object, "spec", "type")
+			assert.Equal(t, "oci", repoType)
+			url, _, _ := unstructured.NestedString(source.Object, "spec", "url")
+			assert.Equal(t, "oci://ghcr.io/faker/charts", url)
+			secretName, _, _ := unstructured.NestedString(source.Object, "spec", "secretRef", "name")
+			assert.Equal(t, "fake-secret", secretName)
+		},
+	}, {
+		name:    "oci repository with a docker config credential, the existing git repository is removed",
+		repo:    ociRepo.DeepCopy(),
+		objects: []client.Object{basicAuth.DeepCopy(), preFluxGitRepo.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.Nil(t, err)
+			_, err = getSource(c, "GitRepository")
+			assert.True(t, apierrors.IsNotFound(err))
+
+			source, err := getSource(c, "OCIRepository")
+			assert.Nil(t, err)
+			secretName, _, _ := unstructured.NestedString(source.Object, "spec", "secretRef", "name")
+			assert.Equal(t, getFluxCredentialName("fake-repo"), secretName)
+			_, found, _ := unstructured.NestedMap(source.Object, "spec", "ref")
+			assert.False(t, found)
+
+			secret, err := getCredential(c)
+			assert.Nil(t, err)
+			assert.Equal(t, v1.SecretTypeDockerConfigJson, secret.Type)
+			assert.Contains(t, string(secret.Data[v1.DockerConfigJsonKey]), `"ghcr.io"`)
+			assert.Equal(t, "fake-repo", secret.OwnerReferences[0].Name)
+		},
+	}, {
+		name: "oci repository with a semver reference",
+		repo: func() *v1alpha3.GitRepository {
+			repo := ociRepo.DeepCopy()
+			repo.SetAnnotations(map[string]string{v1alpha1.ArtifactRepoRefAnnoKey: "semver:>=1.0.0"})
+			return repo
+		}(),
+		objects: []client.Object{basicAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.Nil(t, err)
+			source, err := getSource(c, "OCIRepository")
+			assert.Nil(t, err)
+			ref, _, _ := unstructured.NestedStringMap(source.Object, "spec", "ref")
+			assert.Equal(t, map[string]string{"semver": ">=1.0.0"}, ref)
+		},
+	}, {
+		name: "oci repository with an invalid reference",
+		repo: func() *v1alpha3.GitRepository {
+			repo := ociRepo.DeepCopy()
+			repo.SetAnnotations(map[string]string{v1alpha1.ArtifactRepoRefAnnoKey: "branch:main"})
+			return repo
+		}(),
+		objects: []client.Object{basicAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.NotNil(t, err)
+			_, err = getSource(c, "OCIRepository")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name: "bucket with an access key credential",
+		repo: newArtifactRepo(v1alpha1.ArtifactRepoTypeBucket,
+			"http://minio.fake-ns:9000/manifests?region=us-east-1"),
+		objects: []client.Object{basicAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.Nil(t, err)
+			source, err := getSource(c, "Bucket")
+			assert.Nil(t, err)
+			endpoint, _, _ := unstructured.NestedString(source.Object, "spec", "endpoint")
+			assert.Equal(t, "minio.fake-ns:9000", endpoint)
+			bucketName, _, _ := unstructured.NestedString(source.Object, "spec", "bucketName")
+			assert.Equal(t, "manifests", bucketName)
+			region, _, _ := unstructured.NestedString(source.Object, "spec", "region")
+			assert.Equal(t, "us-east-1", region)
+			insecure, _, _ := unstructured.NestedBool(source.Object, "spec", "insecure")
+			assert.True(t, insecure)
+
+			secret, err := getCredential(c)
+			assert.Nil(t, err)
+			assert.Equal(t, "admin", string(secret.Data["accesskey"]))
+			assert.Equal(t, "password", string(secret.Data["secretkey"]))
+		},
+	}, {
+		name:    "bucket without the bucket name",
+		repo:    newArtifactRepo(v1alpha1.ArtifactRepoTypeBucket, "https://minio.fake-ns"),
+		objects: []client.Object{basicAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.NotNil(t, err)
+			_, err = getSource(c, "Bucket")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name: "oci repository with a credential in another namespace",
+		repo: func() *v1alpha3.GitRepository {
+			repo := ociRepo.DeepCopy()
+			repo.Spec.Secret.Namespace = "another-fake-ns"
+			return repo
+		}(),
+		objects: []client.Object{func() *v1.Secret {
+			secret := basicAuth.DeepCopy()
+			secret.SetNamespace("another-fake-ns")
+			return secret
+		}()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.NotNil(t, err)
+			_, err = getCredential(c)
+			assert.True(t, apierrors.IsNotFound(err))
+			_, err = getSource(c, "OCIRepository")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name:    "oci repository with a non basic-auth credential",
+		repo:    ociRepo.DeepCopy(),
+		objects: []client.Object{sshAuth.DeepCopy()},
+		verify: func(t *testing.T, c client.Client, err error) {
+			assert.NotNil(t, err)
+			_, err = getSource(c, "OCIRepository")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).
+				WithObjects(append(tt.objects, tt.repo.DeepCopy())...).Build()
+			r := &GitRepositoryReconciler{
+				Client:   c,
+				log:      logr.New(log.NullLogSink{}),
+				recorder: &record.FakeRecorder{},
+			}
+			err := r.reconcileFluxGitRepo(tt.repo)
+			tt.verify(t, c, err)
+		})
+	}
+}
+
+func TestGitRepositoryReconciler_getArtifactRepoType(t *testing.T) {
+	repo := &v1alpha3.GitRepository{}
+	assert.Equal(t, v1alpha1.ArtifactRepoTypeGit, getArtifactRepoType(repo))
+
+	repo.SetLabels(map[string]string{v1alpha1.ArtifactRepoTypeLabelKey: "unknown"})
+	assert.Equal(t, v1alpha1.ArtifactRepoTypeGit, getArtifactRepoType(repo))
+
+	repo.SetLabels(map[string]string{v1alpha1.ArtifactRepoTypeLabelKey: "oci-helm"})
+	assert.Equal(t, v1alpha1.ArtifactRepoTypeOCIHelm, getArtifactRepoType(repo))
+	assert.Equal(t, "HelmRepository", getFluxSourceKind(getArtifactRepoType(repo)))
+}
+
 func TestGitRepositoryReconciler_getFluxRepoName(t *testing.T) {
 	type args struct {
 		name string
@@ -249,6 +494,8 @@ func TestGitRepositoryReconciler_getFluxRepoName(t *testing.T) {
 func TestGitRepositoryReconciler_Reconcile(t *testing.T) {
 	schema, err := v1alpha3.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
+	err = v1.AddToScheme(schema)
+	assert.Nil(t, err)
 
 	repo := v1alpha3.GitRepository{
 		ObjectMeta: metav1.ObjectMeta{
@@ -324,3 +571,43 @@ func TestGitRepositoryReconciler_GetName(t *testing.T) {
 		assert.Equal(t, "FluxGitRepositoryReconciler", r.GetName())
 	})
 }
+
+func Test_setOCIRef(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		wantRef map[string]string
+		wantErr bool
+	}{{
+		name: "empty",
+	}, {
+		name:    "tag",
+		ref:     "tag:v1.0.0",
+		wantRef: map[string]string{"tag": "v1.0.0"},
+	}, {
+		name:    "digest",
+		ref:     "digest:sha256:abc",
+		wantRef: map[string]string{"digest": "sha256:abc"},
+	}, {
+		name:    "no value",
+		ref:     "tag:",
+		wantErr: true,
+	}, {
+		name:    "no kind",
+		ref:     "v1.0.0",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ociRepo := createBareFluxSourceObject("OCIRepository")
+			err := setOCIRef(ociRepo, tt.ref)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			ref, _, _ := unstructured.NestedStringMap(ociRepo.Object, "spec", "ref")
+			assert.Equal(t, tt.wantRef, ref)
+		})
+	}
+}
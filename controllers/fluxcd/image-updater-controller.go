@@ -0,0 +1,378 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fluxcd
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;list
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=imageupdaters,verbs=get;list;watch
+//+kubebuilder:rbac:groups="source.toolkit.fluxcd.io",resources=gitrepositories,verbs=get
+//+kubebuilder:rbac:groups="image.toolkit.fluxcd.io",resources=imagerepositories;imagepolicies;imageupdateautomations,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const (
+	defaultImageScanInterval     = "5m"
+	defaultCommitAuthorName      = "fluxcdbot"
+	defaultCommitAuthorEmail     = "fluxcdbot@users.noreply.github.com"
+	defaultCommitMessageTemplate = "{{range .Updated.Images}}{{println .}}{{end}}"
+)
+
+// ImageUpdaterReconciler generates the FluxCD ImageRepositories, ImagePolicies and ImageUpdateAutomation
+// according to the ImageUpdater, the updated images are committed back to the GitRepository of the Application
+type ImageUpdaterReconciler struct {
+	client.Client
+	log      logr.Logger
+	recorder record.EventRecorder
+}
+
+// Reconcile makes sure the FluxCD image automation objects are expected
+func (r *ImageUpdaterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	r.log.Info(fmt.Sprintf("start to reconcile imageUpdater: %s", req.String()))
+
+	updater := &v1alpha1.ImageUpdater{}
+	if err = r.Get(ctx, req.NamespacedName, updater); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+
+	// skip if kind is not fluxcd
+	if updater.Spec.Kind != "fluxcd" {
+		r.log.V(7).Info(fmt.Sprintf("skip %s due to the spec.kind value is not fluxcd", req.String()))
+		return
+	}
+
+	flux := updater.Spec.Flux
+	if flux == nil {
+		r.log.V(7).Info(fmt.Sprintf("skip %s due to the Flux is nil", req.String()))
+		return
+	}
+
+	if flux.App.Name == "" {
+		r.recorder.Eventf(updater, corev1.EventTypeWarning, "Missing", "application name is required")
+		return
+	}
+
+	app := &v1alpha1.Application{}
+	if err = r.Get(ctx, types.NamespacedName{
+		Namespace: req.Namespace,
+		Name:      flux.App.Name,
+	}, app); err != nil {
+		result = ctrl.Result{RequeueAfter: time.Minute}
+		err = nil
+		return
+	}
+
+	if app.Spec.FluxApp == nil || app.Spec.FluxApp.Spec.Source == nil ||
+		app.Spec.FluxApp.Spec.Source.SourceRef.Kind != "GitRepository" {
+		r.recorder.Eventf(updater, corev1.EventTypeWarning, "Invalid",
+			"application %s is not a FluxCD application of GitRepository", app.GetName())
+		return
+	}
+
+	var objects []*unstructured.Unstructured
+	if objects, err = r.buildImageAutomation(ctx, updater, app); err != nil {
+		r.recorder.Eventf(updater, corev1.EventTypeWarning, "Invalid", err.Error())
+		err = nil
+		return
+	}
+
+	for _, obj := range objects {
+		if err = r.createOrUpdate(ctx, obj); err != nil {
+			return
+		}
+	}
+	err = r.cleanImageAutomation(ctx, updater, objects)
+	return
+}
+
+// buildImageAutomation builds an ImageRepository and an ImagePolicy for each image,
+// and an ImageUpdateAutomation to commit the updated images
+func (r *ImageUpdaterReconciler) buildImageAutomation(ctx context.Context, updater *v1alpha1.ImageUpdater,
+	app *v1alpha1.Application) (objects []*unstructured.Unstructured, err error) {
+	flux := updater.Spec.Flux
+	interval := defaultImageScanInterval
+	if flux.Interval != nil {
+		interval = flux.Interval.Duration.String()
+	}
+
+	for _, item := range updater.Spec.Images {
+		image := parseFluxImage(item)
+		name := getImageObjectName(updater.GetName(), image.alias)
+
+		var policy map[string]interface{}
+		if policy, err = getFluxImagePolicy(flux.UpdateStrategy[image.alias], image.constraint); err != nil {
+			return
+		}
+
+		imageRepo := createImageAutomationObject("ImageRepository", name, updater)
+		_ = unstructured.SetNestedField(imageRepo.Object, image.name, "spec", "image")
+		_ = unstructured.SetNestedField(imageRepo.Object, interval, "spec", "interval")
+		if secret := flux.Secrets[image.alias]; secret != "" {
+			_ = unstructured.SetNestedField(imageRepo.Object, secret, "spec", "secretRef", "name")
+		}
+
+		imagePolicy := createImageAutomationObject("ImagePolicy", name, updater)
+		_ = unstructured.SetNestedField(imagePolicy.Object, name, "spec", "imageRepositoryRef", "name")
+		_ = unstructured.SetNestedMap(imagePolicy.Object, policy, "spec", "policy")
+		if pattern := flux.AllowTags[image.alias]; pattern != "" {
+			if _, err = regexp.Compile(pattern); err != nil {
+				err = fmt.Errorf("invalid allowed tags of image %s: %v", image.alias, err)
+				return
+			}
+			_ = unstructured.SetNestedField(imagePolicy.Object, pattern, "spec", "filterTags", "pattern")
+		}
+		objects = append(objects, imageRepo, imagePolicy)
+	}
+	if len(objects) == 0 {
+		return
+	}
+
+	sourceRef := app.Spec.FluxApp.Spec.Source.SourceRef
+	if sourceRef.Namespace == "" {
+		sourceRef.Namespace = app.GetNamespace()
+	}
+	var branch string
+	if branch, err = r.getGitBranch(ctx, flux.Git.Branch, sourceRef.Namespace, sourceRef.Name); err != nil {
+		return
+	}
+
+	automation := createImageAutomationObject("ImageUpdateAutomation", updater.GetName(), updater)
+	_ = unstructured.SetNestedField(automation.Object, interval, "spec", "interval")
+	_ = unstructured.SetNestedStringMap(automation.Object, map[string]string{
+		"kind":      sourceRef.Kind,
+		"name":      sourceRef.Name,
+		"namespace": sourceRef.Namespace,
+	}, "spec", "sourceRef")
+	_ = unstructured.SetNestedField(automation.Object, branch, "spec", "git", "checkout", "ref", "branch")
+	_ = unstructured.SetNestedField(automation.Object, branch, "spec", "git", "push", "branch")
+	_ = unstructured.SetNestedStringMap(automation.Object, map[string]string{
+		"name":  getOrDefault(flux.Git.AuthorName, defaultCommitAuthorName),
+		"email": getOrDefault(flux.Git.AuthorEmail, defaultCommitAuthorEmail),
+	}, "spec", "git", "commit", "author")
+	_ = unstructured.SetNestedField(automation.Object, getOrDefault(flux.Git.MessageTemplate, defaultCommitMessageTemplate),
+		"spec", "git", "commit", "messageTemplate")
+	_ = unstructured.SetNestedStringMap(automation.Object, map[string]string{
+		"path":     getOrDefault(flux.Git.Path, getKustomizationPath(app)),
+		"strategy": "Setters",
+	}, "spec", "update")
+	objects = append(objects, automation)
+	return
+}
+
+// getGitBranch returns the branch of the GitRepository if the expected one is empty
+func (r *ImageUpdaterReconciler) getGitBranch(ctx context.Context, expected, namespace, name string) (branch string, err error) {
+	if expected != "" {
+		branch = expected
+		return
+	}
+
+	repo := createBareFluxGitRepoObject()
+	if err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, repo); err != nil {
+		return
+	}
+	branch, _, _ = unstructured.NestedString(repo.Object, "spec", "ref", "branch")
+	// FluxCD checks out the master branch by default
+	branch = getOrDefault(branch, "master")
+	return
+}
+
+func (r *ImageUpdaterReconciler) createOrUpdate(ctx context.Context, obj *unstructured.Unstructured) (err error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	if err = r.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.log.Info(fmt.Sprintf("create FluxCD %s", obj.GetKind()), "name", obj.GetName())
+			err = r.Create(ctx, obj)
+		}
+		return
+	}
+
+	existing.SetLabels(obj.GetLabels())
+	existing.SetOwnerReferences(obj.GetOwnerReferences())
+	existing.Object["spec"] = obj.Object["spec"]
+	r.log.Info(fmt.Sprintf("update FluxCD %s", obj.GetKind()), "name", obj.GetName())
+	err = r.Update(ctx, existing)
+	return
+}
+
+// cleanImageAutomation deletes the objects which were generated by the ImageUpdater but not expected anymore
+func (r *ImageUpdaterReconciler) cleanImageAutomation(ctx context.Context, updater *v1alpha1.ImageUpdater,
+	expected []*unstructured.Unstructured) (err error) {
+	expectedNames := make(map[string]bool, len(expected))
+	for _, obj := range expected {
+		expectedNames[obj.GetKind()+"/"+obj.GetName()] = true
+	}
+
+	for _, kind := range []string{"ImageRepository", "ImagePolicy", "ImageUpdateAutomation"} {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(getImageAutomationGVK(kind + "List"))
+		if err = r.List(ctx, list, client.InNamespace(updater.GetNamespace()), client.MatchingLabels{
+			FluxImageUpdaterLabelKey: updater.GetName(),
+		}); err != nil {
+			return
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if expectedNames[kind+"/"+obj.GetName()] {
+				continue
+			}
+			r.log.Info(fmt.Sprintf("delete FluxCD %s", kind), "name", obj.GetName())
+			if err = r.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+				return
+			}
+			err = nil
+		}
+	}
+	return
+}
+
+// fluxImage is an image in the format of [<alias>=]<image>[:<version constraint>]
+type fluxImage struct {
+	alias      string
+	name       string
+	constraint string
+}
+
+func parseFluxImage(image string) (result fluxImage) {
+	if index := strings.Index(image, "="); index >= 0 {
+		result.alias = image[:index]
+		image = image[index+1:]
+	}
+	// the colon before the last slash belongs to the registry host
+	if index := strings.LastIndex(image, ":"); index > strings.LastIndex(image, "/") {
+		result.constraint = image[index+1:]
+		image = image[:index]
+	}
+	result.name = image
+	if result.alias == "" {
+		result.alias = image[strings.LastIndex(image, "/")+1:]
+	}
+	return
+}
+
+// getFluxImagePolicy converts the update strategy of Argo CD Image Updater to the policy of FluxCD
+func getFluxImagePolicy(strategy, constraint string) (policy map[string]interface{}, err error) {
+	switch strategy {
+	case "", "semver":
+		if constraint == "" {
+			constraint = ">=0.0.0"
+		}
+		policy = map[string]interface{}{"semver": map[string]interface{}{"range": constraint}}
+	case "name", "alphabetical":
+		policy = map[string]interface{}{"alphabetical": map[string]interface{}{"order": "asc"}}
+	case "latest", "newest-build":
+		// FluxCD does not know when the images were built, so the tags are expected to be timestamps or build numbers
+		policy = map[string]interface{}{"numerical": map[string]interface{}{"order": "asc"}}
+	default:
+		err = fmt.Errorf("update strategy %q is not supported by FluxCD", strategy)
+	}
+	return
+}
+
+var invalidObjectNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+func getImageObjectName(updater, alias string) string {
+	return updater + "-" + strings.Trim(invalidObjectNameChars.ReplaceAllString(strings.ToLower(alias), "-"), "-")
+}
+
+// getKustomizationPath returns the path of the first Kustomization, the manifests with markers are expected to be there
+func getKustomizationPath(app *v1alpha1.Application) string {
+	if config := app.Spec.FluxApp.Spec.Config; config != nil {
+		for _, kus := range config.Kustomization {
+			if kus != nil && kus.Path != "" {
+				return kus.Path
+			}
+		}
+	}
+	return "./"
+}
+
+func getOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func getImageAutomationGVK(kind string) schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Group:   "image.toolkit.fluxcd.io",
+		Version: "v1beta1",
+		Kind:    kind,
+	}
+}
+
+func createImageAutomationObject(kind, name string, updater *v1alpha1.ImageUpdater) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(getImageAutomationGVK(kind))
+	obj.SetNamespace(updater.GetNamespace())
+	obj.SetName(name)
+	obj.SetLabels(map[string]string{
+		"app.kubernetes.io/managed-by": v1alpha1.GroupName,
+		FluxImageUpdaterLabelKey:       updater.GetName(),
+	})
+	controller := true
+	obj.SetOwnerReferences([]metav1.OwnerReference{
+		{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "ImageUpdater",
+			Name:       updater.GetName(),
+			UID:        updater.GetUID(),
+			Controller: &controller,
+		},
+	})
+	return obj
+}
+
+// GetName returns the name of this controller
+func (r *ImageUpdaterReconciler) GetName() string {
+	return "FluxImageUpdaterController"
+}
+
+// GetGroupName returns the group name of this controller
+func (r *ImageUpdaterReconciler) GetGroupName() string {
+	return controllerGroupName
+}
+
+// SetupWithManager setups the log and recorder
+func (r *ImageUpdaterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.log = ctrl.Log.WithName(r.GetName())
+	r.recorder = mgr.GetEventRecorderFor(r.GetName())
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("flux_image_updater").
+		For(&v1alpha1.ImageUpdater{}).
+		Complete(r)
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fluxcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func Test_parseFluxImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  fluxImage
+	}{{
+		image: "nginx",
+		want:  fluxImage{alias: "nginx", name: "nginx"},
+	}, {
+		image: "nginx:~1.20",
+		want:  fluxImage{alias: "nginx", name: "nginx", constraint: "~1.20"},
+	}, {
+		image: "ui=ghcr.io/kubesphere/devops-ui",
+		want:  fluxImage{alias: "ui", name: "ghcr.io/kubesphere/devops-ui"},
+	}, {
+		image: "registry.local:5000/devops/ui:^1.0",
+		want:  fluxImage{alias: "ui", name: "registry.local:5000/devops/ui", constraint: "^1.0"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseFluxImage(tt.image))
+		})
+	}
+}
+
+func Test_getFluxImagePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		constraint string
+		wantPolicy map[string]interface{}
+		wantErr    bool
+	}{{
+		name:       "semver without constraint",
+		wantPolicy: map[string]interface{}{"semver": map[string]interface{}{"range": ">=0.0.0"}},
+	}, {
+		name:       "semver with constraint",
+		strategy:   "semver",
+		constraint: "~1.20",
+		wantPolicy: map[string]interface{}{"semver": map[string]interface{}{"range": "~1.20"}},
+	}, {
+		name:       "name",
+		strategy:   "name",
+		wantPolicy: map[string]interface{}{"alphabetical": map[string]interface{}{"order": "asc"}},
+	}, {
+		name:       "latest",
+		strategy:   "latest",
+		wantPolicy: map[string]interface{}{"numerical": map[string]interface{}{"order": "asc"}},
+	}, {
+		name:     "digest is not supported",
+		strategy: "digest",
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := getFluxImagePolicy(tt.strategy, tt.constraint)
+			assert.Equal(t, tt.wantPolicy, policy)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func Test_getImageObjectName(t *testing.T) {
+	assert.Equal(t, "updater-nginx", getImageObjectName("updater", "nginx"))
+	assert.Equal(t, "updater-my-ui", getImageObjectName("updater", "My_UI."))
+}
+
+func TestImageUpdaterReconciler_Reconcile(t *testing.T) {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.SchemeBuilder.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "app",
+			Namespace: "fake",
+		},
+		Spec: v1alpha1.ApplicationSpec{
+			Kind: v1alpha1.FluxCD,
+			FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+				Source: &v1alpha1.FluxApplicationSource{SourceRef: v1alpha1.FluxSourceReference{
+					Kind: "GitRepository",
+					Name: "repo",
+				}},
+				Config: &v1alpha1.FluxApplicationConfig{Kustomization: []*v1alpha1.KustomizationSpec{{
+					Path: "./deploy",
+				}}},
+			}},
+		},
+	}
+	helmApp := app.DeepCopy()
+	helmApp.Spec.FluxApp.Spec.Source.SourceRef.Kind = "HelmRepository"
+
+	repo := createBareFluxGitRepoObject()
+	repo.SetNamespace("fake")
+	repo.SetName("repo")
+	_ = unstructured.SetNestedField(repo.Object, "main", "spec", "ref", "branch")
+
+	updater := &v1alpha1.ImageUpdater{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "updater",
+			Namespace: "fake",
+		},
+		Spec: v1alpha1.ImageUpdaterSpec{
+			Kind:   "fluxcd",
+			Images: []string{"nginx:~1.20", "ui=ghcr.io/kubesphere/devops-ui"},
+			Flux: &v1alpha1.FluxImageUpdater{
+				App:            v1.LocalObjectReference{Name: "app"},
+				UpdateStrategy: map[string]string{"ui": "latest"},
+				AllowTags:      map[string]string{"ui": "^main-[0-9]+$"},
+				Secrets:        map[string]string{"ui": "ghcr-secret"},
+			},
+		},
+	}
+	argoUpdater := updater.DeepCopy()
+	argoUpdater.Spec.Kind = "argocd"
+	unsupportedStrategy := updater.DeepCopy()
+	unsupportedStrategy.Spec.Flux.UpdateStrategy = map[string]string{"nginx": "digest"}
+	lessImages := updater.DeepCopy()
+	lessImages.Spec.Images = []string{"nginx"}
+
+	createObject := func(kind, name string) *unstructured.Unstructured {
+		obj := createImageAutomationObject(kind, name, updater)
+		_ = unstructured.SetNestedField(obj.Object, "fake", "spec", "image")
+		return obj
+	}
+	getObject := func(c client.Client, kind, name string) (*unstructured.Unstructured, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(getImageAutomationGVK(kind))
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: "fake", Name: name}, obj)
+		return obj, err
+	}
+
+	defaultReq := ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "fake",
+			Name:      "updater",
+		},
+	}
+
+	tests := []struct {
+		name       string
+		objects    []client.Object
+		wantResult ctrl.Result
+		verify     func(t *testing.T, c client.Client)
+	}{{
+		name:    "kind is not fluxcd",
+		objects: []client.Object{argoUpdater, app, repo},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "ImageUpdateAutomation", "updater")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name:       "cannot find the app",
+		objects:    []client.Object{updater},
+		wantResult: ctrl.Result{RequeueAfter: time.Minute},
+		verify:     func(t *testing.T, c client.Client) {},
+	}, {
+		name:    "the app is not from a GitRepository",
+		objects: []client.Object{updater, helmApp, repo},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "ImageUpdateAutomation", "updater")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name:    "unsupported update strategy",
+		objects: []client.Object{unsupportedStrategy, app, repo},
+		verify: func(t *testing.T, c client.Client) {
+			_, err := getObject(c, "ImagePolicy", "updater-nginx")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}, {
+		name:    "normal case",
+		objects: []client.Object{updater, app, repo},
+		verify: func(t *testing.T, c client.Client) {
+			imageRepo, err := getObject(c, "ImageRepository", "updater-ui")
+			if assert.Nil(t, err) {
+				image, _, _ := unstructured.NestedString(imageRepo.Object, "spec", "image")
+				assert.Equal(t, "ghcr.io/kubesphere/devops-ui", image)
+				secret, _, _ := unstructured.NestedString(imageRepo.Object, "spec", "secretRef", "name")
+				assert.Equal(t, "ghcr-secret", secret)
+				assert.Equal(t, "updater", imageRepo.GetOwnerReferences()[0].Name)
+			}
+
+			policy, err := getObject(c, "ImagePolicy", "updater-nginx")
+			if assert.Nil(t, err) {
+				semver, _, _ := unstructured.NestedString(policy.Object, "spec", "policy", "semver", "range")
+				assert.Equal(t, "~1.20", semver)
+			}
+			policy, err = getObject(c, "ImagePolicy", "updater-ui")
+			if assert.Nil(t, err) {
+				order, _, _ := unstructured.NestedString(policy.Object, "spec", "policy", "numerical", "order")
+				assert.Equal(t, "asc", order)
+				pattern, _, _ := unstructured.NestedString(policy.Object, "spec", "filterTags", "pattern")
+				assert.Equal(t, "^main-[0-9]+$", pattern)
+			}
+
+			automation, err := getObject(c, "ImageUpdateAutomation", "updater")
+			if assert.Nil(t, err) {
+				sourceRef, _, _ := unstructured.NestedStringMap(automation.Object, "spec", "sourceRef")
+				assert.Equal(t, map[string]string{"kind": "GitRepository", "name": "repo", "namespace": "fake"}, sourceRef)
+				branch, _, _ := unstructured.NestedString(automation.Object, "spec", "git", "push", "branch")
+				assert.Equal(t, "main", branch)
+				path, _, _ := unstructured.NestedString(automation.Object, "spec", "update", "path")
+				assert.Equal(t, "./deploy", path)
+				author, _, _ := unstructured.NestedString(automation.Object, "spec", "git", "commit", "author", "name")
+				assert.Equal(t, defaultCommitAuthorName, author)
+			}
+		},
+	}, {
+		name: "update and clean the objects",
+		objects: []client.Object{lessImages, app, repo,
+			createObject("ImageRepository", "updater-nginx"), createObject("ImageRepository", "updater-ui")},
+		verify: func(t *testing.T, c client.Client) {
+			imageRepo, err := getObject(c, "ImageRepository", "updater-nginx")
+			if assert.Nil(t, err) {
+				image, _, _ := unstructured.NestedString(imageRepo.Object, "spec", "image")
+				assert.Equal(t, "nginx", image)
+			}
+			_, err = getObject(c, "ImageRepository", "updater-ui")
+			assert.True(t, apierrors.IsNotFound(err))
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithObjects(tt.objects...).Build()
+			r := &ImageUpdaterReconciler{
+				Client:   c,
+				log:      logr.New(log.NullLogSink{}),
+				recorder: &record.FakeRecorder{},
+			}
+			result, err := r.Reconcile(context.Background(), defaultReq)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantResult, result)
+			tt.verify(t, c)
+		})
+	}
+}
+
+func TestImageUpdaterReconciler_SetupWithManager(t *testing.T) {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	r := &ImageUpdaterReconciler{}
+	assert.Equal(t, "FluxImageUpdaterController", r.GetName())
+	assert.Equal(t, controllerGroupName, r.GetGroupName())
+	err = r.SetupWithManager(&core.FakeManager{
+		Client: fake.NewFakeClientWithScheme(schema),
+		Scheme: schema,
+	})
+	assert.Nil(t, err)
+}
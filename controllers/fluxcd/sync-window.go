@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fluxcd
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/syncwindow"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// syncWindowState is the state of the sync windows and change freezes of an Application
+type syncWindowState struct {
+	// automated decides if the HelmReleases and Kustomizations can be reconciled by FluxCD
+	automated syncwindow.Result
+	// manual decides if a manual sync is allowed while the automated syncs are blocked
+	manual syncwindow.Result
+}
+
+// evaluateSyncWindows evaluates the sync windows and change freezes of the DevOpsProject of the application,
+// the name of a DevOpsProject is the same as its namespace
+func (r *ApplicationReconciler) evaluateSyncWindows(ctx context.Context, app *v1alpha1.Application) (state *syncWindowState, err error) {
+	project := &v1alpha3.DevOpsProject{}
+	if err = r.Get(ctx, types.NamespacedName{Name: app.GetNamespace()}, project); err != nil {
+		if apierrors.IsNotFound(err) {
+			err = nil
+		}
+		return
+	}
+
+	now := time.Now()
+	target := syncwindow.TargetOf(app)
+	state = &syncWindowState{}
+	if state.automated, err = syncwindow.Evaluate(&project.Spec, target, now, false); err == nil {
+		state.manual, err = syncwindow.Evaluate(&project.Spec, target, now, true)
+	}
+	if err != nil {
+		r.recorder.Eventf(app, corev1.EventTypeWarning, "InvalidSyncWindow", err.Error())
+	}
+	return
+}
+
+// requeueAfter returns the duration until the next transition of the sync windows, it's zero if there is none
+func (s *syncWindowState) requeueAfter() time.Duration {
+	if s == nil || s.automated.NextTransition.IsZero() {
+		return 0
+	}
+	// a little later than the transition to make sure the state is changed
+	if after := time.Until(s.automated.NextTransition) + time.Second; after > time.Second {
+		return after
+	}
+	return time.Second
+}
+
+// suspend returns true if the HelmRelease or Kustomization should be suspended by the sync windows.
+// A manual sync which is allowed keeps it resumed until FluxCD handles the reconcile request.
+func (s *syncWindowState) suspend(app *v1alpha1.Application, lastHandledReconcileAt string) bool {
+	if s == nil || s.automated.Allowed {
+		return false
+	}
+	if op := app.Spec.FluxApp.Operation; s.manual.Allowed && op != nil &&
+		(op.Type == v1alpha1.FluxOperationSync || op.Type == v1alpha1.FluxOperationRollback) {
+		return lastHandledReconcileAt == op.RequestedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return true
+}
+
+// recordSuspension records an event when the sync windows suspend or resume a HelmRelease or Kustomization
+func (r *ApplicationReconciler) recordSuspension(app *v1alpha1.Application, state *syncWindowState,
+	kind, name string, suspended, suspend bool) {
+	if state == nil {
+		return
+	}
+	switch {
+	case suspend && !suspended:
+		r.recorder.Eventf(app, corev1.EventTypeNormal, "SyncWindowClosed",
+			"Suspended FluxCD %s %s: %s", kind, name, state.automated.Message)
+	case !suspend && suspended:
+		r.recorder.Eventf(app, corev1.EventTypeNormal, "SyncWindowOpened", "Resumed FluxCD %s %s", kind, name)
+	}
+}
+
+// applicationsOfProject returns the FluxCD Applications of a DevOpsProject
+func (r *ApplicationReconciler) applicationsOfProject(obj client.Object) (requests []reconcile.Request) {
+	apps := &v1alpha1.ApplicationList{}
+	if err := r.List(context.Background(), apps, client.InNamespace(obj.GetName())); err != nil {
+		r.log.Error(err, "failed to list the applications of the project", "project", obj.GetName())
+		return
+	}
+	for _, app := range apps.Items {
+		if app.Spec.Kind == v1alpha1.FluxCD {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: app.GetNamespace(), Name: app.GetName()},
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fluxcd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
+	sourcev1 "kubesphere.io/devops/pkg/external/fluxcd/source/v1beta2"
+	"kubesphere.io/devops/pkg/syncwindow"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newSyncWindowScheme(t *testing.T) *runtime.Scheme {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		helmv2.SchemeBuilder.AddToScheme, sourcev1.SchemeBuilder.AddToScheme,
+		kusv1.SchemeBuilder.AddToScheme, v1alpha3.AddToScheme,
+	} {
+		assert.Nil(t, addToScheme(schema))
+	}
+	return schema
+}
+
+func newSyncWindowApp() *v1alpha1.Application {
+	return &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "devops", Name: "podinfo"},
+		Spec: v1alpha1.ApplicationSpec{
+			Kind: v1alpha1.FluxCD,
+			FluxApp: &v1alpha1.FluxApplication{
+				Spec: v1alpha1.FluxApplicationSpec{
+					Source: &v1alpha1.FluxApplicationSource{
+						SourceRef: v1alpha1.FluxSourceReference{
+							APIVersion: "source.toolkit.fluxcd.io/v1beta2",
+							Kind:       "GitRepository",
+							Name:       "podinfo",
+							Namespace:  "devops",
+						},
+					},
+					Config: &v1alpha1.FluxApplicationConfig{
+						Kustomization: []*v1alpha1.KustomizationSpec{{
+							Destination: v1alpha1.FluxApplicationDestination{TargetNamespace: "podinfo"},
+							Path:        "./kustomize",
+						}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newSyncWindowProject(windows ...*v1alpha3.SyncWindow) *v1alpha3.DevOpsProject {
+	return &v1alpha3.DevOpsProject{
+		ObjectMeta: metav1.ObjectMeta{Name: "devops"},
+		Spec:       v1alpha3.DevOpsProjectSpec{SyncWindows: windows},
+	}
+}
+
+func TestApplicationReconciler_syncWindows(t *testing.T) {
+	schema := newSyncWindowScheme(t)
+	deny := &v1alpha3.SyncWindow{Kind: syncwindow.KindDeny, Schedule: "* * * * *", Duration: "1h", Applications: []string{"*"}}
+	denyWithManualSync := deny.DeepCopy()
+	denyWithManualSync.ManualSync = true
+
+	manualSyncApp := newSyncWindowApp()
+	requestedAt := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	manualSyncApp.Spec.FluxApp.Operation = &v1alpha1.FluxOperation{
+		Type:        v1alpha1.FluxOperationSync,
+		RequestedAt: requestedAt,
+	}
+
+	existingKus := &kusv1.Kustomization{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "devops",
+			Name:        "podinfo-abcde",
+			Labels:      map[string]string{"app.kubernetes.io/managed-by": "podinfo"},
+			Annotations: map[string]string{"app.kubernetes.io/name": "podinfo"},
+		},
+		Spec: kusv1.KustomizationSpec{Suspend: true},
+	}
+	handledKus := existingKus.DeepCopy()
+	handledKus.Status.LastHandledReconcileAt = requestedAt.UTC().Format(time.RFC3339Nano)
+	resumedKus := existingKus.DeepCopy()
+	resumedKus.Spec.Suspend = false
+
+	suspendedApp := newSyncWindowApp()
+	suspendedApp.Annotations = map[string]string{v1alpha1.AnnoKeySuspended: "true"}
+
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		wantSuspend bool
+		wantRequeue bool
+	}{{
+		name:    "no DevOpsProject",
+		objects: []client.Object{newSyncWindowApp()},
+	}, {
+		name:    "no sync windows",
+		objects: []client.Object{newSyncWindowApp(), newSyncWindowProject()},
+	}, {
+		name:        "active deny window",
+		objects:     []client.Object{newSyncWindowApp(), newSyncWindowProject(deny)},
+		wantSuspend: true,
+		wantRequeue: true,
+	}, {
+		name:        "inactive deny window",
+		objects:     []client.Object{newSyncWindowApp(), newSyncWindowProject(&v1alpha3.SyncWindow{Kind: syncwindow.KindDeny, Schedule: "0 0 30 2 *", Duration: "1h", Applications: []string{"*"}})},
+		wantSuspend: false,
+	}, {
+		name:        "manual sync is blocked",
+		objects:     []client.Object{manualSyncApp.DeepCopy(), newSyncWindowProject(deny), existingKus.DeepCopy()},
+		wantSuspend: true,
+		wantRequeue: true,
+	}, {
+		name:        "manual sync is not handled yet",
+		objects:     []client.Object{manualSyncApp.DeepCopy(), newSyncWindowProject(denyWithManualSync), existingKus.DeepCopy()},
+		wantSuspend: false,
+		wantRequeue: true,
+	}, {
+		name:        "manual sync was handled",
+		objects:     []client.Object{manualSyncApp.DeepCopy(), newSyncWindowProject(denyWithManualSync), handledKus.DeepCopy()},
+		wantSuspend: true,
+		wantRequeue: true,
+	}, {
+		name:        "suspended Application",
+		objects:     []client.Object{suspendedApp.DeepCopy(), newSyncWindowProject()},
+		wantSuspend: true,
+	}, {
+		name:        "suspended Application with an existing Kustomization",
+		objects:     []client.Object{suspendedApp.DeepCopy(), newSyncWindowProject(), resumedKus.DeepCopy()},
+		wantSuspend: true,
+	}, {
+		name:        "resumed Application",
+		objects:     []client.Object{newSyncWindowApp(), newSyncWindowProject(), existingKus.DeepCopy()},
+		wantSuspend: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithObjects(tt.objects...).Build()
+			r := &ApplicationReconciler{
+				Client:   c,
+				log:      logr.New(log.NullLogSink{}),
+				recorder: &record.FakeRecorder{},
+			}
+			result, err := r.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Namespace: "devops", Name: "podinfo"},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantRequeue, result.RequeueAfter > 0)
+
+			kusList := &kusv1.KustomizationList{}
+			assert.Nil(t, c.List(context.Background(), kusList, client.InNamespace("devops")))
+			if assert.Equal(t, 1, len(kusList.Items)) {
+				assert.Equal(t, tt.wantSuspend, kusList.Items[0].Spec.Suspend)
+			}
+		})
+	}
+}
+
+func TestApplicationReconciler_applicationsOfProject(t *testing.T) {
+	schema := newSyncWindowScheme(t)
+	argoApp := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "devops", Name: "guestbook"},
+		Spec:       v1alpha1.ApplicationSpec{Kind: v1alpha1.ArgoCD},
+	}
+	otherApp := newSyncWindowApp()
+	otherApp.Namespace = "other"
+
+	r := &ApplicationReconciler{
+		Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(newSyncWindowApp(), argoApp, otherApp).Build(),
+		log:    logr.New(log.NullLogSink{}),
+	}
+	assert.Equal(t, []ctrl.Request{{
+		NamespacedName: types.NamespacedName{Namespace: "devops", Name: "podinfo"},
+	}}, r.applicationsOfProject(newSyncWindowProject()))
+}
@@ -110,7 +110,12 @@ func (r *Reconciler) createOrUpdateWebhook(repo *v1alpha3.GitRepository) (err er
 		}
 
 		// the token is optional, we can ignore the error
-		webhookToken, _ := r.getTokenFromSecret(repo.Spec.Secret, repo.Namespace)
+		// the secret of webhook takes precedence, the deliveries will be verified with the same one
+		secretRef := repo.Spec.Secret
+		if webhook.Spec.Secret != nil {
+			secretRef = webhook.Spec.Secret
+		}
+		webhookToken, _ := r.getTokenFromSecret(secretRef, repo.Namespace)
 
 		// TODO users need to add every single event of target git provider if they want to add all of them
 		//   it's possible to have a solution to allow users add all events in an easy way.
@@ -163,8 +168,10 @@ func (r *Reconciler) getTokenFromSecret(secretRef *v1.SecretReference, defaultNa
 	}
 
 	switch gitSecret.Type {
-	case v1.SecretTypeBasicAuth:
+	case v1.SecretTypeBasicAuth, v1alpha3.SecretTypeBasicAuth:
 		token = string(gitSecret.Data[v1.BasicAuthPasswordKey])
+	case v1alpha3.SecretTypeSecretText:
+		token = string(gitSecret.Data[v1alpha3.SecretTextSecretKey])
 	case v1.SecretTypeOpaque:
 		token = string(gitSecret.Data[v1.ServiceAccountTokenKey])
 	}
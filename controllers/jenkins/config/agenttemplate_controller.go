@@ -0,0 +1,485 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	k8s "github.com/jenkins-zh/jenkins-client/pkg/k8s"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/constants"
+	"kubesphere.io/devops/pkg/utils/k8sutil"
+	"kubesphere.io/devops/pkg/utils/stringutils"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=agenttemplates,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=agenttemplates/status,verbs=get;update
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;update
+
+// AgentTemplateReconciler renders the AgentTemplates into the Jenkins CasC.
+// The AgentTemplates in the namespace of the CasC ConfigMap are available to all DevOpsProjects,
+// the name and labels of the AgentTemplates in a DevOpsProject are prefixed with the project name and a dot.
+// The prefix only avoids the name conflicts, the labels are not access-controlled: any Pipeline could use them.
+type AgentTemplateReconciler struct {
+	TargetConfigMapName      string
+	TargetConfigMapNamespace string
+	TargetConfigMapKey       string
+	// WorkerNamespace is the namespace where the Jenkins agent pods are running in
+	WorkerNamespace string
+	Interval        time.Duration
+
+	client.Client
+	log      logr.Logger
+	recorder record.EventRecorder
+}
+
+// Reconcile is the entrypoint of this reconciler
+func (r *AgentTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	r.log.Info("start to reconcile AgentTemplate", "resource", req)
+
+	template := &v1alpha3.AgentTemplate{}
+	if err = r.Get(ctx, req.NamespacedName, template); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+
+	if !template.DeletionTimestamp.IsZero() {
+		err = r.cleanup(ctx, template)
+		return
+	}
+
+	if k8sutil.AddFinalizer(&template.ObjectMeta, agentTemplateFinalizer) {
+		if err = r.Update(ctx, template); err != nil {
+			return
+		}
+	}
+
+	var prefix string
+	var valid bool
+	if prefix, valid, err = r.getScopePrefix(ctx, template.Namespace); err != nil {
+		return
+	}
+
+	var podTemplate *v1.PodTemplate
+	status := v1alpha3.AgentTemplateStatus{}
+	if !valid {
+		err = fmt.Errorf("namespace %s is neither the system namespace nor a DevOpsProject", template.Namespace)
+	} else {
+		podTemplate, err = renderPodTemplate(template, prefix, r.WorkerNamespace)
+	}
+	if err == nil {
+		err = r.checkConflict(ctx, template, podTemplate.Name)
+	}
+	if err != nil {
+		// the template is invalid, there is no need to retry until it's changed
+		message := err.Error()
+		r.recorder.Event(template, v1.EventTypeWarning, "InvalidTemplate", message)
+		if err = r.removeFromCasC(ctx, template.Status.TemplateName); err == nil {
+			status.Phase = v1alpha3.AgentTemplatePhaseFailed
+			status.Message = message
+			err = r.updateStatus(ctx, template, status)
+		}
+		return
+	}
+
+	var found bool
+	if found, err = r.updateCasC(ctx, func(casc *k8s.JenkinsConfig) (err error) {
+		if oldName := template.Status.TemplateName; oldName != "" && oldName != podTemplate.Name {
+			if err = casc.RemovePodTemplate(oldName); err != nil {
+				return
+			}
+		}
+		return casc.ReplaceOrAddPodTemplate(podTemplate)
+	}); err != nil {
+		return
+	}
+
+	if found {
+		status.Phase = v1alpha3.AgentTemplatePhaseSynced
+		status.TemplateName = podTemplate.Name
+		status.Labels = getAgentLabels(podTemplate)
+	} else {
+		status.Phase = v1alpha3.AgentTemplatePhaseFailed
+		status.Message = fmt.Sprintf("the Jenkins CasC was not found in ConfigMap %s/%s",
+			r.TargetConfigMapNamespace, r.TargetConfigMapName)
+	}
+	if err = r.updateStatus(ctx, template, status); err == nil {
+		// make sure the AgentTemplates always could be in the Jenkins CasC
+		result = ctrl.Result{RequeueAfter: r.Interval}
+	}
+	return
+}
+
+func (r *AgentTemplateReconciler) cleanup(ctx context.Context, template *v1alpha3.AgentTemplate) (err error) {
+	if err = r.removeFromCasC(ctx, template.Status.TemplateName); err == nil {
+		k8sutil.RemoveFinalizer(&template.ObjectMeta, agentTemplateFinalizer)
+		err = r.Update(ctx, template)
+	}
+	return
+}
+
+func (r *AgentTemplateReconciler) removeFromCasC(ctx context.Context, name string) (err error) {
+	if name == "" {
+		return
+	}
+	_, err = r.updateCasC(ctx, func(casc *k8s.JenkinsConfig) error {
+		return casc.RemovePodTemplate(name)
+	})
+	return
+}
+
+// updateCasC manipulates the Jenkins CasC data, found is false if the ConfigMap or the expected key does not exist
+func (r *AgentTemplateReconciler) updateCasC(ctx context.Context, manipulate func(*k8s.JenkinsConfig) error) (found bool, err error) {
+	cm := &v1.ConfigMap{}
+	if err = r.Get(ctx, types.NamespacedName{
+		Namespace: r.TargetConfigMapNamespace,
+		Name:      r.TargetConfigMapName,
+	}, cm); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+	data := strings.TrimSpace(cm.Data[r.TargetConfigMapKey])
+	if data == "" {
+		return
+	}
+
+	found = true
+	casc := k8s.JenkinsConfig{
+		Config: []byte(data),
+	}
+	if err = manipulate(&casc); err != nil || casc.GetConfigAsString() == data {
+		return
+	}
+	if err = validateCasC(casc.GetConfigAsString()); err != nil {
+		err = fmt.Errorf("the Jenkins CasC would be invalid, error: %v", err)
+		return
+	}
+	cm.Data[r.TargetConfigMapKey] = casc.GetConfigAsString()
+	err = r.Update(ctx, cm)
+	return
+}
+
+func (r *AgentTemplateReconciler) updateStatus(ctx context.Context, template *v1alpha3.AgentTemplate, status v1alpha3.AgentTemplateStatus) error {
+	if reflect.DeepEqual(template.Status, status) {
+		return nil
+	}
+	template.Status = status
+	return r.Status().Update(ctx, template)
+}
+
+// checkConflict makes sure the pod template in the Jenkins CasC which has the same name belongs to this AgentTemplate.
+// The pod templates written by hand or rendered from another AgentTemplate must not be overwritten.
+func (r *AgentTemplateReconciler) checkConflict(ctx context.Context, template *v1alpha3.AgentTemplate, name string) (err error) {
+	cm := &v1.ConfigMap{}
+	if err = r.Get(ctx, types.NamespacedName{
+		Namespace: r.TargetConfigMapNamespace,
+		Name:      r.TargetConfigMapName,
+	}, cm); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+
+	var exists bool
+	var owner string
+	if exists, owner, err = getPodTemplateOwner(cm.Data[r.TargetConfigMapKey], name); err != nil || !exists {
+		return
+	}
+	// the pod templates rendered before the owner annotation was introduced are recognized by the status
+	if owner == getAgentTemplateKey(template) || (owner == "" && template.Status.TemplateName == name) {
+		return
+	}
+	if owner == "" {
+		err = fmt.Errorf("the pod template %s already exists in the Jenkins CasC", name)
+	} else {
+		err = fmt.Errorf("the pod template %s is already rendered from the AgentTemplate %s", name, owner)
+	}
+	return
+}
+
+// getPodTemplateOwner returns the AgentTemplate key in the owner annotation of the pod template in the Jenkins CasC
+func getPodTemplateOwner(data, name string) (exists bool, owner string, err error) {
+	casc := &struct {
+		Jenkins struct {
+			Clouds []k8s.CloudAgent `json:"clouds"`
+		} `json:"jenkins"`
+	}{}
+	if err = yaml.Unmarshal([]byte(data), casc); err != nil {
+		err = fmt.Errorf("failed to parse the Jenkins CasC, error: %v", err)
+		return
+	}
+	for _, cloud := range casc.Jenkins.Clouds {
+		for _, podTemplate := range cloud.Kubernetes.Templates {
+			if podTemplate.Name != name {
+				continue
+			}
+			exists = true
+			pod := &metav1.PartialObjectMetadata{}
+			if err = yaml.Unmarshal([]byte(podTemplate.YAML), pod); err == nil {
+				owner = pod.Annotations[agentTemplateOwnerAnnotation]
+			}
+			return
+		}
+	}
+	return
+}
+
+func getAgentTemplateKey(template *v1alpha3.AgentTemplate) string {
+	return template.Namespace + "/" + template.Name
+}
+
+// getScopePrefix returns the prefix of the Jenkins pod template name and labels, it's empty for the cluster-wide templates.
+// valid is false if the namespace is neither the system namespace nor a DevOpsProject.
+func (r *AgentTemplateReconciler) getScopePrefix(ctx context.Context, namespace string) (prefix string, valid bool, err error) {
+	if namespace == r.TargetConfigMapNamespace {
+		valid = true
+		return
+	}
+
+	ns := &v1.Namespace{}
+	if err = r.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+	if project := ns.Labels[constants.DevOpsProjectLabelKey]; project != "" {
+		// the namespace cannot contain a dot, so the names of different projects never conflict
+		prefix = namespace + "."
+		valid = true
+	}
+	return
+}
+
+// renderPodTemplate converts an AgentTemplate to a PodTemplate which could be taken by the Jenkins CasC
+func renderPodTemplate(template *v1alpha3.AgentTemplate, prefix, namespace string) (podTemplate *v1.PodTemplate, err error) {
+	spec := template.Spec
+	if len(spec.Containers) == 0 {
+		err = errors.New("at least one container is required")
+		return
+	}
+
+	if err = validateNames(template, prefix); err != nil {
+		return
+	}
+	if prefix != "" {
+		if err = validateProjectTemplate(spec); err != nil {
+			return
+		}
+	}
+
+	podTemplate = &v1.PodTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        prefix + template.Name,
+			Annotations: map[string]string{},
+		},
+	}
+
+	labels := make([]string, len(spec.Labels))
+	for i, label := range spec.Labels {
+		labels[i] = prefix + label
+	}
+	if len(labels) > 0 {
+		podTemplate.Annotations["jenkins.agent.labels"] = strings.Join(labels, " ")
+	}
+	if spec.IdleMinutes > 0 {
+		podTemplate.Annotations["idleMinutes"] = strconv.Itoa(spec.IdleMinutes)
+	}
+	if spec.InheritFrom != "" {
+		podTemplate.Annotations["inherit.from"] = spec.InheritFrom
+	}
+
+	names := map[string]bool{}
+	for _, container := range spec.Containers {
+		if names[container.Name] {
+			err = fmt.Errorf("duplicated container name: %s", container.Name)
+			return
+		}
+		names[container.Name] = true
+		podTemplate.Template.Spec.Containers = append(podTemplate.Template.Spec.Containers, toContainer(container))
+	}
+
+	var podYAML string
+	if podYAML, err = getPodYAML(spec, getAgentTemplateKey(template)); err == nil {
+		podTemplate.Annotations["containers.yaml"] = podYAML
+	}
+	return
+}
+
+var agentLabelRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// validateNames makes sure the name and labels of a template are valid Jenkins labels. A dot is not allowed in the
+// cluster-wide templates, it separates the project name and the template name of the DevOpsProject templates.
+func validateNames(template *v1alpha3.AgentTemplate, prefix string) error {
+	for _, name := range append([]string{template.Name}, template.Spec.Labels...) {
+		if !agentLabelRegexp.MatchString(name) {
+			return fmt.Errorf("invalid label %q, only letters, digits, '-', '_' and '.' are allowed", name)
+		}
+		if prefix == "" && strings.Contains(name, ".") {
+			return fmt.Errorf("invalid label %q, a dot is not allowed in the cluster-wide templates", name)
+		}
+	}
+	return nil
+}
+
+// validateProjectTemplate makes sure the template of a DevOpsProject cannot reach the node or the objects of other
+// projects, because all agents run in the shared worker namespace. The privileged containers and the volumes except
+// emptyDir are only allowed in the cluster-wide templates.
+func validateProjectTemplate(spec v1alpha3.AgentTemplateSpec) error {
+	for _, container := range spec.Containers {
+		if container.Privileged {
+			return fmt.Errorf("the privileged container %s is only allowed in the cluster-wide templates", container.Name)
+		}
+	}
+	for _, volume := range spec.Volumes {
+		if volume.HostPath != "" || volume.PersistentVolumeClaim != "" || volume.ConfigMap != "" || volume.Secret != "" {
+			return fmt.Errorf("the volume %s is only allowed in the cluster-wide templates, "+
+				"a DevOpsProject template can only have emptyDir volumes", volume.Name)
+		}
+	}
+	return nil
+}
+
+func toContainer(agentContainer v1alpha3.AgentContainer) (container v1.Container) {
+	container = v1.Container{
+		Name:      agentContainer.Name,
+		Image:     agentContainer.Image,
+		Command:   agentContainer.Command,
+		Args:      agentContainer.Args,
+		Resources: agentContainer.Resources,
+	}
+	if len(container.Command) == 0 && len(container.Args) == 0 {
+		// keep the container running, the steps will be executed in it
+		container.Command = []string{"cat"}
+	}
+	if agentContainer.Privileged {
+		privileged := true
+		container.SecurityContext = &v1.SecurityContext{Privileged: &privileged}
+	}
+	return
+}
+
+// getPodYAML returns the raw pod YAML which contains the fields that are not supported by the Jenkins pod template,
+// and the owner annotation which is used to detect the conflicts.
+func getPodYAML(spec v1alpha3.AgentTemplateSpec, owner string) (podYAML string, err error) {
+	podSpec := map[string]interface{}{}
+	if len(spec.NodeSelector) > 0 {
+		podSpec["nodeSelector"] = spec.NodeSelector
+	}
+	if len(spec.Tolerations) > 0 {
+		podSpec["tolerations"] = spec.Tolerations
+	}
+
+	var volumes []v1.Volume
+	for _, volume := range spec.Volumes {
+		volumes = append(volumes, toVolume(volume))
+	}
+	if len(volumes) > 0 {
+		podSpec["volumes"] = volumes
+	}
+
+	var containers []map[string]interface{}
+	for _, container := range spec.Containers {
+		if len(container.VolumeMounts) > 0 {
+			containers = append(containers, map[string]interface{}{
+				"name":         container.Name,
+				"volumeMounts": container.VolumeMounts,
+			})
+		}
+	}
+	if len(containers) > 0 {
+		podSpec["containers"] = containers
+	}
+
+	pod := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{agentTemplateOwnerAnnotation: owner},
+		},
+	}
+	if len(podSpec) > 0 {
+		pod["spec"] = podSpec
+	}
+
+	var data []byte
+	if data, err = yaml.Marshal(pod); err == nil {
+		podYAML = string(data)
+	}
+	return
+}
+
+func toVolume(agentVolume v1alpha3.AgentVolume) (volume v1.Volume) {
+	volume.Name = agentVolume.Name
+	switch {
+	case agentVolume.HostPath != "":
+		volume.HostPath = &v1.HostPathVolumeSource{Path: agentVolume.HostPath}
+	case agentVolume.PersistentVolumeClaim != "":
+		volume.PersistentVolumeClaim = &v1.PersistentVolumeClaimVolumeSource{ClaimName: agentVolume.PersistentVolumeClaim}
+	case agentVolume.ConfigMap != "":
+		volume.ConfigMap = &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: agentVolume.ConfigMap}}
+	case agentVolume.Secret != "":
+		volume.Secret = &v1.SecretVolumeSource{SecretName: agentVolume.Secret}
+	default:
+		volume.EmptyDir = &v1.EmptyDirVolumeSource{}
+	}
+	return
+}
+
+// getAgentLabels returns the labels of the Jenkins pod template, the name of the template is always one of them
+func getAgentLabels(podTemplate *v1.PodTemplate) []string {
+	labels := strings.Fields(podTemplate.Annotations["jenkins.agent.labels"])
+	return append(labels, podTemplate.Name)
+}
+
+// GetName returns the name of this reconciler
+func (r *AgentTemplateReconciler) GetName() string {
+	return "agent-template"
+}
+
+// GetGroupName returns the group name of this reconciler
+func (r *AgentTemplateReconciler) GetGroupName() string {
+	return reconcilerGroupName
+}
+
+// SetupWithManager setups the reconciler
+func (r *AgentTemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.log = ctrl.Log.WithName(r.GetName())
+	r.recorder = mgr.GetEventRecorderFor(r.GetName())
+	r.TargetConfigMapName = stringutils.SetOrDefault(r.TargetConfigMapName, "jenkins-casc-config")
+	r.TargetConfigMapNamespace = stringutils.SetOrDefault(r.TargetConfigMapNamespace, "kubesphere-devops-system")
+	r.TargetConfigMapKey = stringutils.SetOrDefault(r.TargetConfigMapKey, "jenkins_user.yaml")
+	r.WorkerNamespace = stringutils.SetOrDefault(r.WorkerNamespace, "kubesphere-devops-worker")
+	if r.Interval == 0 {
+		r.Interval = 5 * time.Minute
+	}
+	return ctrl.NewControllerManagedBy(mgr).For(&v1alpha3.AgentTemplate{}).Complete(r)
+}
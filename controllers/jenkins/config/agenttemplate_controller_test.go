@@ -0,0 +1,419 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	mgrcore "kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/constants"
+	controllerruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func Test_renderPodTemplate(t *testing.T) {
+	template := &v1alpha3.AgentTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "kubesphere-devops-system",
+			Name:      "maven",
+		},
+		Spec: v1alpha3.AgentTemplateSpec{
+			Labels: []string{"maven", "java"},
+			Containers: []v1alpha3.AgentContainer{{
+				Name:       "maven",
+				Image:      "maven:3.8",
+				Privileged: true,
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{
+						v1.ResourceCPU: resource.MustParse("2"),
+					},
+				},
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      "cache",
+					MountPath: "/root/.m2",
+				}},
+			}},
+			NodeSelector: map[string]string{"disk": "ssd"},
+			Tolerations: []v1.Toleration{{
+				Key:      "ci",
+				Operator: v1.TolerationOpExists,
+			}},
+			Volumes: []v1alpha3.AgentVolume{{
+				Name:                  "cache",
+				PersistentVolumeClaim: "maven-cache",
+			}},
+			IdleMinutes: 10,
+		},
+	}
+
+	t.Run("cluster-wide template", func(t *testing.T) {
+		podTemplate, err := renderPodTemplate(template, "", "kubesphere-devops-worker")
+		assert.Nil(t, err)
+		assert.Equal(t, "maven", podTemplate.Name)
+		assert.Equal(t, "kubesphere-devops-worker", podTemplate.Namespace)
+		assert.Equal(t, "maven java", podTemplate.Annotations["jenkins.agent.labels"])
+		assert.Equal(t, "10", podTemplate.Annotations["idleMinutes"])
+		assert.Equal(t, []string{"maven", "java", "maven"}, getAgentLabels(podTemplate))
+
+		container := podTemplate.Template.Spec.Containers[0]
+		assert.Equal(t, []string{"cat"}, container.Command)
+		assert.True(t, *container.SecurityContext.Privileged)
+		assert.Equal(t, "2", container.Resources.Limits.Cpu().String())
+
+		podYAML := podTemplate.Annotations["containers.yaml"]
+		assert.Contains(t, podYAML, "disk: ssd")
+		assert.Contains(t, podYAML, "key: ci")
+		assert.Contains(t, podYAML, "claimName: maven-cache")
+		assert.Contains(t, podYAML, "mountPath: /root/.m2")
+		assert.Contains(t, podYAML, "devops.kubesphere.io/agent-template: kubesphere-devops-system/maven")
+	})
+
+	t.Run("project template", func(t *testing.T) {
+		projectTemplate := template.DeepCopy()
+		projectTemplate.Spec.Containers[0].Privileged = false
+		projectTemplate.Spec.Volumes = []v1alpha3.AgentVolume{{Name: "cache"}}
+		podTemplate, err := renderPodTemplate(projectTemplate, "project.", "kubesphere-devops-worker")
+		assert.Nil(t, err)
+		assert.Equal(t, "project.maven", podTemplate.Name)
+		assert.Equal(t, []string{"project.maven", "project.java", "project.maven"}, getAgentLabels(podTemplate))
+		assert.Contains(t, podTemplate.Annotations["containers.yaml"], "emptyDir: {}")
+	})
+
+	t.Run("project template with the fields of cluster-wide templates", func(t *testing.T) {
+		privileged := template.DeepCopy()
+		privileged.Spec.Volumes = nil
+		_, err := renderPodTemplate(privileged, "project.", "kubesphere-devops-worker")
+		assert.NotNil(t, err)
+
+		for _, volume := range []v1alpha3.AgentVolume{
+			{Name: "docker", HostPath: "/var/run/docker.sock"},
+			{Name: "cache", PersistentVolumeClaim: "maven-cache"},
+			{Name: "settings", ConfigMap: "settings"},
+			{Name: "token", Secret: "token"},
+		} {
+			withVolume := template.DeepCopy()
+			withVolume.Spec.Containers[0].Privileged = false
+			withVolume.Spec.Volumes = []v1alpha3.AgentVolume{volume}
+			_, err = renderPodTemplate(withVolume, "project.", "kubesphere-devops-worker")
+			assert.NotNil(t, err, volume.Name)
+		}
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for _, labels := range [][]string{{"maven java"}, {"maven&&java"}, {""}} {
+			invalid := template.DeepCopy()
+			invalid.Spec.Labels = labels
+			_, err := renderPodTemplate(invalid, "", "ns")
+			assert.NotNil(t, err, labels)
+		}
+
+		// the dot is reserved for the project templates
+		withDot := template.DeepCopy()
+		withDot.Spec.Labels = []string{"jdk1.8"}
+		_, err := renderPodTemplate(withDot, "", "ns")
+		assert.NotNil(t, err)
+		withDot.Spec.Containers[0].Privileged = false
+		withDot.Spec.Volumes = nil
+		podTemplate, err := renderPodTemplate(withDot, "project.", "ns")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"project.jdk1.8", "project.maven"}, getAgentLabels(podTemplate))
+	})
+
+	t.Run("without containers", func(t *testing.T) {
+		invalid := template.DeepCopy()
+		invalid.Spec.Containers = nil
+		_, err := renderPodTemplate(invalid, "", "ns")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("duplicated containers", func(t *testing.T) {
+		invalid := template.DeepCopy()
+		invalid.Spec.Containers = append(invalid.Spec.Containers, invalid.Spec.Containers[0])
+		_, err := renderPodTemplate(invalid, "", "ns")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("without pod YAML", func(t *testing.T) {
+		simple := &v1alpha3.AgentTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "base"},
+			Spec: v1alpha3.AgentTemplateSpec{
+				Containers: []v1alpha3.AgentContainer{{
+					Name:    "base",
+					Image:   "busybox",
+					Command: []string{"sleep"},
+					Args:    []string{"infinity"},
+				}},
+			},
+		}
+		podTemplate, err := renderPodTemplate(simple, "", "ns")
+		assert.Nil(t, err)
+		assert.Len(t, podTemplate.Annotations, 1)
+		assert.NotContains(t, podTemplate.Annotations["containers.yaml"], "spec:")
+		assert.Equal(t, []string{"sleep"}, podTemplate.Template.Spec.Containers[0].Command)
+	})
+}
+
+func Test_toVolume(t *testing.T) {
+	assert.NotNil(t, toVolume(v1alpha3.AgentVolume{HostPath: "/var/run/docker.sock"}).HostPath)
+	assert.NotNil(t, toVolume(v1alpha3.AgentVolume{ConfigMap: "settings"}).ConfigMap)
+	assert.NotNil(t, toVolume(v1alpha3.AgentVolume{Secret: "settings"}).Secret)
+	assert.NotNil(t, toVolume(v1alpha3.AgentVolume{}).EmptyDir)
+}
+
+func TestAgentTemplateReconciler_Reconcile(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.SchemeBuilder.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	cascData, err := ioutil.ReadFile("testdata/casc.yaml")
+	assert.Nil(t, err)
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "kubesphere-devops-system",
+			Name:      "jenkins-casc-config",
+		},
+		Data: map[string]string{
+			"jenkins_user.yaml": string(cascData),
+		},
+	}
+	projectNs := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "project",
+			Labels: map[string]string{constants.DevOpsProjectLabelKey: "project"},
+		},
+	}
+	otherNs := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+	}
+
+	newTemplate := func(namespace string) *v1alpha3.AgentTemplate {
+		return &v1alpha3.AgentTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      "nodejs",
+			},
+			Spec: v1alpha3.AgentTemplateSpec{
+				Labels: []string{"node"},
+				Containers: []v1alpha3.AgentContainer{{
+					Name:  "nodejs",
+					Image: "node:16",
+				}},
+			},
+		}
+	}
+	now := metav1.Now()
+	deletingTemplate := newTemplate("project")
+	deletingTemplate.DeletionTimestamp = &now
+	deletingTemplate.Finalizers = []string{agentTemplateFinalizer}
+	deletingTemplate.Status.TemplateName = "project.nodejs"
+
+	// the pod template named nodejs is written by hand
+	conflictCM := cm.DeepCopy()
+	conflictCM.Data["jenkins_user.yaml"] = strings.ReplaceAll(string(cascData), "name: go\r", "name: nodejs\r")
+	// the pod template was rendered with the legacy name
+	legacyTemplate := newTemplate("project")
+	legacyTemplate.Status.TemplateName = "project-nodejs"
+	legacyCM := cm.DeepCopy()
+	legacyCM.Data["jenkins_user.yaml"] = strings.ReplaceAll(string(cascData), "name: go\r", "name: project-nodejs\r")
+
+	getTemplate := func(t *testing.T, c client.Client, namespace string) *v1alpha3.AgentTemplate {
+		template := &v1alpha3.AgentTemplate{}
+		err := c.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: "nodejs"}, template)
+		assert.Nil(t, err)
+		return template
+	}
+	getCasC := func(t *testing.T, c client.Client) string {
+		target := &v1.ConfigMap{}
+		err := c.Get(context.Background(), types.NamespacedName{
+			Namespace: "kubesphere-devops-system",
+			Name:      "jenkins-casc-config",
+		}, target)
+		assert.Nil(t, err)
+		return target.Data["jenkins_user.yaml"]
+	}
+
+	tests := []struct {
+		name       string
+		objects    []client.Object
+		namespace  string
+		wantResult controllerruntime.Result
+		wantErr    assert.ErrorAssertionFunc
+		verify     func(*testing.T, client.Client)
+	}{{
+		name:      "not found AgentTemplate",
+		namespace: "project",
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+	}, {
+		name:       "cluster-wide AgentTemplate",
+		objects:    []client.Object{newTemplate("kubesphere-devops-system"), cm.DeepCopy()},
+		namespace:  "kubesphere-devops-system",
+		wantResult: controllerruntime.Result{RequeueAfter: 5 * time.Minute},
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "kubesphere-devops-system")
+			assert.Equal(t, []string{agentTemplateFinalizer}, template.Finalizers)
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseSynced, template.Status.Phase)
+			assert.Equal(t, "nodejs", template.Status.TemplateName)
+			assert.Equal(t, []string{"node", "nodejs"}, template.Status.Labels)
+			assert.Contains(t, getCasC(t, c), "label: node nodejs")
+		},
+	}, {
+		name:       "AgentTemplate in a DevOpsProject",
+		objects:    []client.Object{newTemplate("project"), projectNs.DeepCopy(), cm.DeepCopy()},
+		namespace:  "project",
+		wantResult: controllerruntime.Result{RequeueAfter: 5 * time.Minute},
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "project")
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseSynced, template.Status.Phase)
+			assert.Equal(t, "project.nodejs", template.Status.TemplateName)
+			assert.Equal(t, []string{"project.node", "project.nodejs"}, template.Status.Labels)
+			casc := getCasC(t, c)
+			assert.Contains(t, casc, "name: project.nodejs")
+			assert.Contains(t, casc, "namespace: kubesphere-devops-worker")
+		},
+	}, {
+		name:      "conflict with a pod template written by hand",
+		objects:   []client.Object{newTemplate("kubesphere-devops-system"), conflictCM},
+		namespace: "kubesphere-devops-system",
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "kubesphere-devops-system")
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseFailed, template.Status.Phase)
+			assert.Contains(t, template.Status.Message, "already exists")
+			casc := getCasC(t, c)
+			assert.Contains(t, casc, "image: kubesphere/builder-go:v3.2.0")
+			assert.NotContains(t, casc, "image: node:16")
+		},
+	}, {
+		name:       "rename the pod template with the legacy name",
+		objects:    []client.Object{legacyTemplate, projectNs.DeepCopy(), legacyCM},
+		namespace:  "project",
+		wantResult: controllerruntime.Result{RequeueAfter: 5 * time.Minute},
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "project")
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseSynced, template.Status.Phase)
+			assert.Equal(t, "project.nodejs", template.Status.TemplateName)
+			casc := getCasC(t, c)
+			assert.Contains(t, casc, "name: project.nodejs")
+			assert.NotContains(t, casc, "name: project-nodejs")
+		},
+	}, {
+		name:      "AgentTemplate in a namespace which is not a DevOpsProject",
+		objects:   []client.Object{newTemplate("other"), otherNs.DeepCopy(), cm.DeepCopy()},
+		namespace: "other",
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "other")
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseFailed, template.Status.Phase)
+			assert.NotEmpty(t, template.Status.Message)
+			assert.NotContains(t, getCasC(t, c), "nodejs")
+		},
+	}, {
+		name:       "no related ConfigMap exist",
+		objects:    []client.Object{newTemplate("kubesphere-devops-system")},
+		namespace:  "kubesphere-devops-system",
+		wantResult: controllerruntime.Result{RequeueAfter: 5 * time.Minute},
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := getTemplate(t, c, "kubesphere-devops-system")
+			assert.Equal(t, v1alpha3.AgentTemplatePhaseFailed, template.Status.Phase)
+		},
+	}, {
+		name:      "handle a deleting AgentTemplate",
+		objects:   []client.Object{deletingTemplate, projectNs.DeepCopy(), cm.DeepCopy()},
+		namespace: "project",
+		wantErr: func(t assert.TestingT, err error, i ...interface{}) bool {
+			assert.Nil(t, err)
+			return true
+		},
+		verify: func(t *testing.T, c client.Client) {
+			template := &v1alpha3.AgentTemplate{}
+			err := c.Get(context.Background(), types.NamespacedName{Namespace: "project", Name: "nodejs"}, template)
+			if err == nil {
+				assert.Empty(t, template.Finalizers)
+			} else {
+				assert.Nil(t, client.IgnoreNotFound(err))
+			}
+			assert.NotContains(t, getCasC(t, c), "project.nodejs")
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithObjects(tt.objects...).Build()
+			r := &AgentTemplateReconciler{
+				Client: c,
+			}
+			err := r.SetupWithManager(&mgrcore.FakeManager{
+				Scheme: schema,
+			})
+			assert.Nil(t, err)
+			r.log = logr.New(log.NullLogSink{})
+			r.recorder = &record.FakeRecorder{}
+
+			req := controllerruntime.Request{
+				NamespacedName: types.NamespacedName{Namespace: tt.namespace, Name: "nodejs"},
+			}
+			gotResult, err := r.Reconcile(context.Background(), req)
+			if !tt.wantErr(t, err, fmt.Sprintf("Reconcile(%v)", req)) {
+				return
+			}
+			assert.Equalf(t, tt.wantResult, gotResult, "Reconcile(%v)", req)
+			if tt.verify != nil {
+				tt.verify(t, c)
+			}
+		})
+	}
+}
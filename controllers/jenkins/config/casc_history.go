@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// jenkinsCasCHistoryName is the name of the ConfigMap which keeps the applied revisions of the Jenkins CasC
+	jenkinsCasCHistoryName = "jenkins-casc-config-history"
+	// ANNOJenkinsCasCRevision is the latest revision in the Jenkins CasC history
+	ANNOJenkinsCasCRevision = "devops.kubesphere.io/jenkins-casc-revision"
+	cascRevisionKeyPrefix   = "revision-"
+	defaultCasCHistoryLimit = 10
+)
+
+func getCasCRevisionKey(revision int) string {
+	return fmt.Sprintf("%s%d", cascRevisionKeyPrefix, revision)
+}
+
+// getLatestCasCRevision returns the latest applied Jenkins CasC, revision is 0 if there is no history
+func getLatestCasCRevision(history *v1.ConfigMap) (data string, revision int) {
+	if history == nil {
+		return
+	}
+	if revision, _ = strconv.Atoi(history.Annotations[ANNOJenkinsCasCRevision]); revision > 0 {
+		var ok bool
+		if data, ok = history.Data[getCasCRevisionKey(revision)]; !ok {
+			revision = 0
+		}
+	}
+	return
+}
+
+// addCasCRevision adds a revision into the history and removes the revisions out of the limit,
+// it does nothing if the data is the same as the latest revision
+func addCasCRevision(history *v1.ConfigMap, data string, limit int) (revision int, changed bool) {
+	var latest string
+	if latest, revision = getLatestCasCRevision(history); revision > 0 && latest == data {
+		return
+	}
+	if limit <= 0 {
+		limit = defaultCasCHistoryLimit
+	}
+
+	revision++
+	changed = true
+	if history.Data == nil {
+		history.Data = map[string]string{}
+	}
+	if history.Annotations == nil {
+		history.Annotations = map[string]string{}
+	}
+	history.Data[getCasCRevisionKey(revision)] = data
+	history.Annotations[ANNOJenkinsCasCRevision] = strconv.Itoa(revision)
+
+	for key := range history.Data {
+		if !strings.HasPrefix(key, cascRevisionKeyPrefix) {
+			continue
+		}
+		if num, err := strconv.Atoi(strings.TrimPrefix(key, cascRevisionKeyPrefix)); err == nil && num <= revision-limit {
+			delete(history.Data, key)
+		}
+	}
+	return
+}
+
+func (c *Controller) getCasCHistory(namespace string) (history *v1.ConfigMap, err error) {
+	if history, err = c.configMapClient.ConfigMaps(namespace).Get(context.Background(),
+		jenkinsCasCHistoryName, metav1.GetOptions{}); errors.IsNotFound(err) {
+		history, err = nil, nil
+	}
+	return
+}
+
+// recordCasCRevision keeps the Jenkins CasC which was applied successfully
+func (c *Controller) recordCasCRevision(cm *v1.ConfigMap) (revision int, err error) {
+	var history *v1.ConfigMap
+	if history, err = c.getCasCHistory(cm.Namespace); err != nil {
+		return
+	}
+
+	if history == nil {
+		history = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: cm.Namespace,
+				Name:      jenkinsCasCHistoryName,
+			},
+		}
+		addCasCRevision(history, cm.Data[jenkinsUserYamlKey], c.cascHistoryLimit)
+		_, err = c.configMapClient.ConfigMaps(cm.Namespace).Create(context.Background(), history, metav1.CreateOptions{})
+		revision = 1
+		return
+	}
+
+	var changed bool
+	if revision, changed = addCasCRevision(history, cm.Data[jenkinsUserYamlKey], c.cascHistoryLimit); changed {
+		_, err = c.configMapClient.ConfigMaps(cm.Namespace).Update(context.Background(), history, metav1.UpdateOptions{})
+	}
+	return
+}
+
+// revertJenkinsConfig reverts the Jenkins CasC to the latest applied revision because of the cause,
+// reverted is false if there is nothing to revert
+func (c *Controller) revertJenkinsConfig(cm *v1.ConfigMap, cause error) (reverted bool, err error) {
+	var history *v1.ConfigMap
+	if history, err = c.getCasCHistory(cm.Namespace); err != nil {
+		return
+	}
+
+	data, revision := getLatestCasCRevision(history)
+	if revision == 0 || data == cm.Data[jenkinsUserYamlKey] {
+		klog.Errorf("no revision of the Jenkins CasC could be reverted to")
+		return
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[jenkinsUserYamlKey] = data
+	if _, err = c.configMapClient.ConfigMaps(cm.Namespace).Update(context.Background(), cm, metav1.UpdateOptions{}); err == nil {
+		// the Jenkins CasC will be reloaded once the ConfigMap is updated
+		reverted = true
+		c.recordEvent(cm, v1.EventTypeWarning, "Reverted",
+			fmt.Sprintf("reverted the Jenkins CasC to revision %d due to: %v", revision, cause))
+	}
+	return
+}
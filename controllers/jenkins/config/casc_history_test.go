@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_addCasCRevision(t *testing.T) {
+	history := &v1.ConfigMap{}
+	data, revision := getLatestCasCRevision(history)
+	assert.Empty(t, data)
+	assert.Equal(t, 0, revision)
+
+	revision, changed := addCasCRevision(history, "a", 2)
+	assert.True(t, changed)
+	assert.Equal(t, 1, revision)
+
+	// the same data as the latest revision
+	revision, changed = addCasCRevision(history, "a", 2)
+	assert.False(t, changed)
+	assert.Equal(t, 1, revision)
+
+	revision, changed = addCasCRevision(history, "b", 2)
+	assert.True(t, changed)
+	assert.Equal(t, 2, revision)
+	revision, changed = addCasCRevision(history, "c", 2)
+	assert.True(t, changed)
+	assert.Equal(t, 3, revision)
+	assert.Equal(t, map[string]string{"revision-2": "b", "revision-3": "c"}, history.Data)
+
+	data, revision = getLatestCasCRevision(history)
+	assert.Equal(t, "c", data)
+	assert.Equal(t, 3, revision)
+
+	// the latest revision is missing
+	delete(history.Data, "revision-3")
+	_, revision = getLatestCasCRevision(history)
+	assert.Equal(t, 0, revision)
+}
+
+func TestController_recordCasCRevision(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: jenkinsConfigName},
+		Data:       map[string]string{jenkinsUserYamlKey: "good"},
+	}
+	clientset := fake.NewSimpleClientset(cm)
+	c := &Controller{configMapClient: clientset.CoreV1(), cascHistoryLimit: 2}
+
+	revision, err := c.recordCasCRevision(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, revision)
+
+	cm.Data[jenkinsUserYamlKey] = "better"
+	revision, err = c.recordCasCRevision(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, revision)
+
+	history, err := c.getCasCHistory("ns")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", history.Annotations[ANNOJenkinsCasCRevision])
+	assert.Equal(t, "better", history.Data["revision-2"])
+}
+
+func TestController_revertJenkinsConfig(t *testing.T) {
+	reloadErr := errors.New("failed to reload")
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: jenkinsConfigName},
+		Data:       map[string]string{jenkinsUserYamlKey: "bad"},
+	}
+	history := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        jenkinsCasCHistoryName,
+			Annotations: map[string]string{ANNOJenkinsCasCRevision: "3"},
+		},
+		Data: map[string]string{"revision-3": "good"},
+	}
+
+	t.Run("without history", func(t *testing.T) {
+		c := &Controller{configMapClient: fake.NewSimpleClientset(cm.DeepCopy()).CoreV1()}
+		reverted, err := c.revertJenkinsConfig(cm.DeepCopy(), reloadErr)
+		assert.Nil(t, err)
+		assert.False(t, reverted)
+	})
+
+	t.Run("the latest revision fails to reload", func(t *testing.T) {
+		good := cm.DeepCopy()
+		good.Data[jenkinsUserYamlKey] = "good"
+		c := &Controller{configMapClient: fake.NewSimpleClientset(good.DeepCopy(), history.DeepCopy()).CoreV1()}
+		reverted, err := c.revertJenkinsConfig(good, reloadErr)
+		assert.Nil(t, err)
+		assert.False(t, reverted)
+	})
+
+	t.Run("revert to the latest revision", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(cm.DeepCopy(), history.DeepCopy())
+		recorder := record.NewFakeRecorder(1)
+		c := &Controller{configMapClient: clientset.CoreV1(), recorder: recorder}
+		reverted, err := c.revertJenkinsConfig(cm.DeepCopy(), reloadErr)
+		assert.Nil(t, err)
+		assert.True(t, reverted)
+
+		revertedCM, err := clientset.CoreV1().ConfigMaps("ns").Get(context.Background(), jenkinsConfigName, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "good", revertedCM.Data[jenkinsUserYamlKey])
+		assert.Contains(t, <-recorder.Events, "Reverted")
+	})
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// invalidCasCError means the Jenkins CasC is invalid, it does not help to retry
+type invalidCasCError struct {
+	error
+}
+
+func isInvalidCasC(err error) bool {
+	return errors.As(err, &invalidCasCError{})
+}
+
+// validateCasC makes sure the Jenkins CasC is able to be loaded before applying it
+func validateCasC(data string) (err error) {
+	casc := map[string]interface{}{}
+	if err = yaml.Unmarshal([]byte(data), &casc); err != nil {
+		err = fmt.Errorf("invalid YAML: %v", err)
+		return
+	}
+
+	jenkinsConfig, ok := casc["jenkins"].(map[string]interface{})
+	if !ok {
+		err = errors.New("jenkins is required")
+		return
+	}
+
+	clouds, found := jenkinsConfig["clouds"]
+	if !found || clouds == nil {
+		return
+	}
+	var cloudList []interface{}
+	if cloudList, ok = clouds.([]interface{}); !ok {
+		err = errors.New("jenkins.clouds should be a list")
+		return
+	}
+	for i, cloud := range cloudList {
+		cloudMap, _ := cloud.(map[string]interface{})
+		if kubernetesCloud, found := cloudMap["kubernetes"]; found {
+			if err = validateKubernetesCloud(fmt.Sprintf("jenkins.clouds[%d].kubernetes", i), kubernetesCloud); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func validateKubernetesCloud(path string, cloud interface{}) (err error) {
+	cloudMap, ok := cloud.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s should be an object", path)
+	}
+	for _, key := range []string{"containerCapStr", "connectTimeout", "readTimeout", "maxRequestsPerHostStr"} {
+		if val, found := cloudMap[key]; found && !isNonNegativeInt(val) {
+			return fmt.Errorf("%s.%s should be a non-negative integer, got: %v", path, key, val)
+		}
+	}
+
+	templates, found := cloudMap["templates"]
+	if !found || templates == nil {
+		return
+	}
+	var templateList []interface{}
+	if templateList, ok = templates.([]interface{}); !ok {
+		return fmt.Errorf("%s.templates should be a list", path)
+	}
+	names := map[string]bool{}
+	for i, template := range templateList {
+		templatePath := fmt.Sprintf("%s.templates[%d]", path, i)
+		templateMap, ok := template.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s should be an object", templatePath)
+		}
+		name, _ := templateMap["name"].(string)
+		if name == "" {
+			return fmt.Errorf("%s.name is required", templatePath)
+		} else if names[name] {
+			return fmt.Errorf("%s.name is duplicated: %s", templatePath, name)
+		}
+		names[name] = true
+
+		if err = validatePodTemplate(templatePath, templateMap); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func validatePodTemplate(path string, template map[string]interface{}) (err error) {
+	if val, found := template["idleMinutes"]; found && !isNonNegativeInt(val) {
+		return fmt.Errorf("%s.idleMinutes should be a non-negative integer, got: %v", path, val)
+	}
+	if podYAML, _ := template["yaml"].(string); podYAML != "" {
+		pod := map[string]interface{}{}
+		if err = yaml.Unmarshal([]byte(podYAML), &pod); err != nil {
+			return fmt.Errorf("%s.yaml is invalid: %v", path, err)
+		}
+	}
+
+	containers, found := template["containers"]
+	if !found || containers == nil {
+		return
+	}
+	containerList, ok := containers.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s.containers should be a list", path)
+	}
+	names := map[string]bool{}
+	for i, container := range containerList {
+		containerPath := fmt.Sprintf("%s.containers[%d]", path, i)
+		containerMap, ok := container.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s should be an object", containerPath)
+		}
+		name, _ := containerMap["name"].(string)
+		if name == "" {
+			return fmt.Errorf("%s.name is required", containerPath)
+		} else if names[name] {
+			return fmt.Errorf("%s.name is duplicated: %s", containerPath, name)
+		}
+		names[name] = true
+		if image, _ := containerMap["image"].(string); image == "" {
+			return fmt.Errorf("%s.image is required", containerPath)
+		}
+
+		if err = validateContainerResource(containerPath, containerMap, "resourceRequestCpu", "resourceLimitCpu"); err != nil {
+			return
+		}
+		if err = validateContainerResource(containerPath, containerMap, "resourceRequestMemory", "resourceLimitMemory"); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// validateContainerResource makes sure the resource request and limit are valid quantities, and the request is not
+// greater than the limit
+func validateContainerResource(path string, container map[string]interface{}, requestKey, limitKey string) (err error) {
+	var request, limit *resource.Quantity
+	if request, err = parseQuantityField(path, container, requestKey); err != nil {
+		return
+	}
+	if limit, err = parseQuantityField(path, container, limitKey); err != nil {
+		return
+	}
+	if request != nil && limit != nil && request.Cmp(*limit) > 0 {
+		err = fmt.Errorf("%s.%s should not be greater than %s.%s", path, requestKey, path, limitKey)
+	}
+	return
+}
+
+func parseQuantityField(path string, container map[string]interface{}, key string) (quantity *resource.Quantity, err error) {
+	val, found := container[key]
+	if !found || val == nil || val == "" {
+		return
+	}
+	var parsed resource.Quantity
+	if parsed, err = resource.ParseQuantity(fmt.Sprint(val)); err != nil {
+		err = fmt.Errorf("%s.%s is not a valid quantity: %v", path, key, val)
+		return
+	}
+	quantity = &parsed
+	return
+}
+
+func isNonNegativeInt(val interface{}) bool {
+	switch v := val.(type) {
+	case float64:
+		return v >= 0 && v == float64(int64(v))
+	case string:
+		num, err := strconv.Atoi(v)
+		return err == nil && num >= 0
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateCasC(t *testing.T) {
+	cascData, err := ioutil.ReadFile("testdata/casc.yaml")
+	assert.Nil(t, err)
+	casc := string(cascData)
+
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{{
+		name: "valid CasC",
+		data: casc,
+	}, {
+		name:    "invalid YAML",
+		data:    "jenkins: [",
+		wantErr: "invalid YAML",
+	}, {
+		name:    "without jenkins",
+		data:    "unclassified: {}",
+		wantErr: "jenkins is required",
+	}, {
+		name: "without clouds",
+		data: "jenkins:\n  numExecutors: 0",
+	}, {
+		name:    "clouds is not a list",
+		data:    "jenkins:\n  clouds: kubernetes",
+		wantErr: "jenkins.clouds should be a list",
+	}, {
+		name:    "invalid containerCapStr",
+		data:    strings.Replace(casc, `containerCapStr: "4"`, `containerCapStr: "four"`, 1),
+		wantErr: "jenkins.clouds[0].kubernetes.containerCapStr",
+	}, {
+		name: "duplicated template name",
+		data: `jenkins:
+  clouds:
+    - kubernetes:
+        templates:
+          - name: base
+          - name: base`,
+		wantErr: "jenkins.clouds[0].kubernetes.templates[1].name is duplicated: base",
+	}, {
+		name:    "invalid idleMinutes",
+		data:    strings.Replace(casc, "idleMinutes: 0", "idleMinutes: -1", 1),
+		wantErr: "idleMinutes should be a non-negative integer",
+	}, {
+		name:    "container without image",
+		data:    strings.Replace(casc, "image: kubesphere/builder-go:v3.2.0", `image: ""`, 1),
+		wantErr: "containers[0].image is required",
+	}, {
+		name:    "invalid quantity",
+		data:    strings.Replace(casc, "resourceLimitCpu: 4000m", "resourceLimitCpu: 4 cores", 1),
+		wantErr: "resourceLimitCpu is not a valid quantity",
+	}, {
+		name:    "request is greater than limit",
+		data:    strings.Replace(casc, "resourceRequestMemory: 100Mi", "resourceRequestMemory: 10Gi", 1),
+		wantErr: "resourceRequestMemory should not be greater than",
+	}, {
+		name:    "invalid pod YAML",
+		data:    strings.Replace(casc, `yaml: ""`, `yaml: "spec: ["`, 1),
+		wantErr: "yaml is invalid",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCasC(tt.data)
+			if tt.wantErr == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
@@ -35,3 +35,8 @@ const (
 const reconcilerGroupName = "jenkins"
 
 const podTemplateFinalizer = "podtemplate.devops.kubesphere.io/finalizer"
+
+const agentTemplateFinalizer = "agenttemplate.devops.kubesphere.io/finalizer"
+
+// agentTemplateOwnerAnnotation is the annotation key of the rendered pod, its value is the key of the AgentTemplate
+const agentTemplateOwnerAnnotation = "devops.kubesphere.io/agent-template"
@@ -30,6 +30,7 @@ import (
 	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
 	corev1lister "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	"kubesphere.io/devops/pkg/client/devops"
@@ -51,6 +52,7 @@ type ControllerOptions struct {
 
 	InformerFactory informers.InformerFactory
 	ConfigOperator  devops.ConfigurationOperator
+	Recorder        record.EventRecorder
 
 	ReloadCasCDelay time.Duration
 }
@@ -66,10 +68,12 @@ type Controller struct {
 	configMapClient     v1core.ConfigMapsGetter
 
 	configOperator devops.ConfigurationOperator
+	recorder       record.EventRecorder
 
 	queue            workqueue.RateLimitingInterface
 	workerLoopPeriod time.Duration
 	ReloadCasCDelay  time.Duration
+	cascHistoryLimit int
 
 	devopsOptions *jenkins.Options
 }
@@ -89,10 +93,12 @@ func NewController(
 		configMapClient:     options.ConfigMapClient,
 
 		configOperator: options.ConfigOperator,
+		recorder:       options.Recorder,
 
 		queue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), jenkinsConfigName),
 		workerLoopPeriod: time.Second,
 		ReloadCasCDelay:  options.ReloadCasCDelay,
+		cascHistoryLimit: devopsOptions.CasCHistoryLimit,
 
 		devopsOptions: devopsOptions,
 	}
@@ -257,7 +263,7 @@ func (c *Controller) providePredefinedConfig(cm *v1.ConfigMap) (err error) {
 		return
 	}
 	if err = c.handleJenkinsCasCConfig(cm, config); err != nil {
-		err = fmt.Errorf("failed to handleJenkinsCasCConfig, error: %v", err)
+		err = fmt.Errorf("failed to handleJenkinsCasCConfig, error: %w", err)
 		return
 	}
 	return
@@ -337,26 +343,62 @@ func (c *Controller) syncHandler(key string) (err error) {
 		return
 	}
 
-	if err = c.providePredefinedConfig(jenkinsCMCopy); err != nil {
+	if err = c.providePredefinedConfig(jenkinsCMCopy); err == nil {
+		err = validateCasC(jenkinsCMCopy.Data[jenkinsUserYamlKey])
+	} else if !isInvalidCasC(err) {
 		err = fmt.Errorf("failed to provide the pre-defined Jenkins config, error: %v", err)
 		return
 	}
 
-	// Update Jenkins Configuration as Code ConfigMap
-	_, err = c.configMapClient.ConfigMaps(ns).Update(context.Background(), jenkinsCMCopy, metav1.UpdateOptions{})
+	// Jenkins keeps running with the current configuration if the new one is invalid, whether it's customized or
+	// provided by a formula, so the ConfigMap is reverted to the latest revision which was reloaded successfully
 	if err != nil {
+		klog.Errorf("skip reloading the invalid Jenkins configuration of ConfigMap %s/%s, error: %v", ns, name, err)
+		c.recordEvent(jenkinsCM, v1.EventTypeWarning, "InvalidCasC", fmt.Sprintf("skip reloading the invalid Jenkins CasC: %v", err))
+		// compare with the data in the ConfigMap instead of the provided one, it might never be valid
+		_, err = c.revertJenkinsConfig(jenkinsCM.DeepCopy(), err)
+		return
+	}
+
+	// Update Jenkins Configuration as Code ConfigMap
+	if jenkinsCMCopy, err = c.configMapClient.ConfigMaps(ns).Update(context.Background(), jenkinsCMCopy, metav1.UpdateOptions{}); err != nil {
 		klog.Errorf("failed to update ConfigMap: %s/%s", ns, name)
 		return err
 	}
 
 	// Reload configuration
 	klog.V(5).Info("reloading Jenkins configuration")
-	if err = c.delayReloadJenkinsConfig(); err == nil {
-		klog.V(5).Infof("reloaded Jenkins configuration successfully")
+	if err = c.delayReloadJenkinsConfig(); err != nil {
+		klog.Errorf("failed to reload Jenkins configuration, error: %v", err)
+		c.recordEvent(jenkinsCMCopy, v1.EventTypeWarning, "ReloadFailed", fmt.Sprintf("failed to reload the Jenkins CasC: %v", err))
+		// it might be a temporary failure, like a network error, retry it instead of reverting
+		if !devops.IsConfigurationRejected(err) {
+			return
+		}
+		reloadErr := err
+		var reverted bool
+		if reverted, err = c.revertJenkinsConfig(jenkinsCMCopy, reloadErr); err == nil && !reverted {
+			err = reloadErr
+		}
+		return
+	}
+	klog.V(5).Infof("reloaded Jenkins configuration successfully")
+
+	var revision int
+	if revision, err = c.recordCasCRevision(jenkinsCMCopy); err != nil {
+		err = fmt.Errorf("failed to record the revision of Jenkins configuration, error: %v", err)
+		return
 	}
+	c.recordEvent(jenkinsCMCopy, v1.EventTypeNormal, "Reloaded", fmt.Sprintf("reloaded the Jenkins CasC of revision %d", revision))
 	return
 }
 
+func (c *Controller) recordEvent(cm *v1.ConfigMap, eventType, reason, message string) {
+	if c.recorder != nil {
+		c.recorder.Event(cm, eventType, reason, message)
+	}
+}
+
 // Handle worker namespace quota limit
 func (c *Controller) handleWorkerNamespaceQuotaLimit(providedConfig map[string]string, namespace string) error {
 	// get the resource quota
@@ -472,22 +514,29 @@ func (c *Controller) handleJenkinsCasCConfig(cm *v1.ConfigMap, providedConfig ma
 	jenkinsCasCConfigTemplate := cm.Data[jenkinsYamlKey]
 	namespace := cm.Namespace
 
+	if err = validateCasC(jenkinsCasCConfigTemplate); err != nil {
+		err = invalidCasCError{fmt.Errorf("the Jenkins CasC template is invalid, error: %v", err)}
+		return
+	}
 	cascMap := make(map[string]interface{})
-	err = yaml.Unmarshal([]byte(jenkinsCasCConfigTemplate), &cascMap)
-	if err != nil {
-		return err
+	if err = yaml.Unmarshal([]byte(jenkinsCasCConfigTemplate), &cascMap); err != nil {
+		return
 	}
 
-	kubernetesMap := cascMap["jenkins"].(map[interface{}]interface{})["clouds"].([]interface{})[0].(map[interface{}]interface{})["kubernetes"]
+	var kubernetesMap map[interface{}]interface{}
+	if kubernetesMap, err = getKubernetesCloud(cascMap); err != nil {
+		err = invalidCasCError{fmt.Errorf("the Jenkins CasC template is invalid, error: %v", err)}
+		return
+	}
 
 	// set concurrent
 	concurrent, ok := providedConfig[podConcurrentKey]
 	if ok {
-		kubernetesMap.(map[interface{}]interface{})["containerCapStr"] = concurrent
+		kubernetesMap["containerCapStr"] = concurrent
 	}
 
 	// set pod template
-	if templates, ok := kubernetesMap.(map[interface{}]interface{})["templates"].([]interface{}); ok {
+	if templates, ok := kubernetesMap["templates"].([]interface{}); ok {
 		for _, template := range templates {
 			// type safe check
 			if template, ok := template.(map[interface{}]interface{}); ok {
@@ -516,12 +565,15 @@ func (c *Controller) handleJenkinsCasCConfig(cm *v1.ConfigMap, providedConfig ma
 
 	// set CasC config into newJenkinsCascConfig
 	var targetJenkinsYAMLConfig []byte
-	if targetJenkinsYAMLConfig, err = yaml.Marshal(cascMap); err == nil {
-		// update Jenkins config ConfigMap
-		cm.Data[jenkinsUserYamlKey] = string(targetJenkinsYAMLConfig)
-	} else {
+	if targetJenkinsYAMLConfig, err = yaml.Marshal(cascMap); err != nil {
 		return
 	}
+	if err = validateCasC(string(targetJenkinsYAMLConfig)); err != nil {
+		err = invalidCasCError{fmt.Errorf("the provided Jenkins CasC is invalid, error: %v", err)}
+		return
+	}
+	// update Jenkins config ConfigMap
+	cm.Data[jenkinsUserYamlKey] = string(targetJenkinsYAMLConfig)
 
 	if _, err = c.configMapClient.ConfigMaps(namespace).Update(context.Background(), cm, metav1.UpdateOptions{}); err != nil {
 		err = fmt.Errorf("failed to update ConfigMap: %s/%s, error: %v", namespace, jenkinsCasCConfigName, err)
@@ -531,6 +583,21 @@ func (c *Controller) handleJenkinsCasCConfig(cm *v1.ConfigMap, providedConfig ma
 	return
 }
 
+// getKubernetesCloud returns jenkins.clouds[0].kubernetes of the Jenkins CasC
+func getKubernetesCloud(casc map[string]interface{}) (cloud map[interface{}]interface{}, err error) {
+	jenkinsMap, _ := casc["jenkins"].(map[interface{}]interface{})
+	clouds, _ := jenkinsMap["clouds"].([]interface{})
+	if len(clouds) == 0 {
+		err = fmt.Errorf("jenkins.clouds is required")
+		return
+	}
+	firstCloud, _ := clouds[0].(map[interface{}]interface{})
+	if cloud, _ = firstCloud["kubernetes"].(map[interface{}]interface{}); cloud == nil {
+		err = fmt.Errorf("jenkins.clouds[0].kubernetes is required")
+	}
+	return
+}
+
 // Set containers limit
 func setContainersLimit(providedConfig map[string]string, containers interface{}, containerName string) {
 	if containers, ok := containers.([]interface{}); ok {
@@ -17,10 +17,18 @@ limitations under the License.
 package config
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/client/devops"
 	"kubesphere.io/devops/pkg/client/devops/fake"
+	"kubesphere.io/devops/pkg/client/devops/jenkins"
 	"reflect"
 	"testing"
 )
@@ -284,3 +292,116 @@ func Test_isJenkinsConfigCustomized(t *testing.T) {
 		})
 	}
 }
+
+type fakeConfigOperator struct {
+	fake.Devops
+	err error
+}
+
+func (o *fakeConfigOperator) ApplyNewSource(string) error {
+	return o.err
+}
+
+func TestController_syncHandler(t *testing.T) {
+	validCasC := "jenkins:\n  numExecutors: 0"
+	history := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "ns",
+			Name:        jenkinsCasCHistoryName,
+			Annotations: map[string]string{ANNOJenkinsCasCRevision: "1"},
+		},
+		Data: map[string]string{"revision-1": validCasC},
+	}
+	newConfigMap := func(data, formula, template string) *v1.ConfigMap {
+		if formula == "" {
+			formula = FormulaCustom
+		}
+		if template == "" {
+			template = validCasC
+		}
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "ns",
+				Name:        jenkinsConfigName,
+				Annotations: map[string]string{ANNOJenkinsConfigFormula: formula},
+			},
+			Data: map[string]string{jenkinsYamlKey: template, jenkinsUserYamlKey: data},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		formula   string
+		template  string
+		applyErr  error
+		wantErr   bool
+		wantData  string
+		wantEvent string
+	}{{
+		name:     "reload a valid CasC",
+		data:     "jenkins:\n  numExecutors: 1",
+		wantData: "jenkins:\n  numExecutors: 1",
+	}, {
+		name:      "revert an invalid CasC",
+		data:      "jenkins: [",
+		wantData:  validCasC,
+		wantEvent: "InvalidCasC",
+	}, {
+		name:      "revert the CasC of a formula whose template is invalid",
+		data:      "jenkins:\n  numExecutors: 1",
+		formula:   FormulaLow,
+		template:  "jenkins: [",
+		wantData:  validCasC,
+		wantEvent: "InvalidCasC",
+	}, {
+		name:      "revert the CasC of a formula whose template has no Kubernetes cloud",
+		data:      "jenkins:\n  numExecutors: 1",
+		formula:   FormulaHigh,
+		template:  "jenkins:\n  clouds:\n  - docker: {}",
+		wantData:  validCasC,
+		wantEvent: "InvalidCasC",
+	}, {
+		name:     "revert the CasC which is rejected by Jenkins",
+		data:     "jenkins:\n  numExecutors: 1",
+		applyErr: &devops.ConfigurationRejectedError{StatusCode: 500},
+		wantData: validCasC,
+	}, {
+		name:     "retry when Jenkins is not reachable",
+		data:     "jenkins:\n  numExecutors: 1",
+		applyErr: errors.New("connection refused"),
+		wantErr:  true,
+		wantData: "jenkins:\n  numExecutors: 1",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := newConfigMap(tt.data, tt.formula, tt.template)
+			clientset := k8sfake.NewSimpleClientset(cm.DeepCopy(), history.DeepCopy())
+			namespaceIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			assert.Nil(t, namespaceIndexer.Add(&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}))
+			configMapIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			assert.Nil(t, configMapIndexer.Add(cm.DeepCopy()))
+
+			recorder := record.NewFakeRecorder(10)
+			c := &Controller{
+				configmapLister:     corev1lister.NewConfigMapLister(configMapIndexer),
+				namespaceLister:     corev1lister.NewNamespaceLister(namespaceIndexer),
+				configMapClient:     clientset.CoreV1(),
+				resourceQuotaClient: clientset.CoreV1(),
+				limitRangeClient:    clientset.CoreV1(),
+				configOperator:      &fakeConfigOperator{err: tt.applyErr},
+				recorder:            recorder,
+				devopsOptions:       &jenkins.Options{},
+			}
+			err := c.syncHandler("ns/" + jenkinsConfigName)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			if tt.wantEvent != "" {
+				assert.Contains(t, <-recorder.Events, tt.wantEvent)
+			}
+
+			result, err := clientset.CoreV1().ConfigMaps("ns").Get(context.Background(), jenkinsConfigName, metav1.GetOptions{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantData, result.Data[jenkinsUserYamlKey])
+		})
+	}
+}
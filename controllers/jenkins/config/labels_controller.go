@@ -17,6 +17,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -31,13 +32,20 @@ import (
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/jwt/token"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // tokenExpireIn indicates that the temporary token issued by controller will be expired in some time.
 const tokenExpireIn time.Duration = 5 * time.Minute
 
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=agenttemplates,verbs=get;list;watch
+
 // AgentLabelsReconciler responsible for the Jenkins agent labels sync
 type AgentLabelsReconciler struct {
 	// TargetNamespace indicate which namespace the target ConfigMap located in
@@ -69,6 +77,10 @@ func (r *AgentLabelsReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		err = fmt.Errorf("failed to get labels, error: %v", err)
 		return
 	}
+	if labels, err = r.appendAgentTemplateLabels(labels); err != nil {
+		err = fmt.Errorf("failed to get labels of AgentTemplates, error: %v", err)
+		return
+	}
 
 	if changed := setLabelsToConfigMap(labels, cm); changed {
 		err = r.Update(context.Background(), cm)
@@ -102,6 +114,31 @@ func (r *AgentLabelsReconciler) getLabels() (labels []string, err error) {
 	return
 }
 
+// appendAgentTemplateLabels appends the labels of the synced AgentTemplates, they might not be known by Jenkins yet
+func (r *AgentLabelsReconciler) appendAgentTemplateLabels(labels []string) ([]string, error) {
+	templates := &v1alpha3.AgentTemplateList{}
+	if err := r.List(context.Background(), templates); err != nil {
+		return labels, err
+	}
+
+	existing := map[string]bool{}
+	for _, label := range labels {
+		existing[label] = true
+	}
+	for _, template := range templates.Items {
+		if template.Status.Phase != v1alpha3.AgentTemplatePhaseSynced {
+			continue
+		}
+		for _, label := range template.Status.Labels {
+			if !existing[label] {
+				existing[label] = true
+				labels = append(labels, label)
+			}
+		}
+	}
+	return labels, nil
+}
+
 func (r *AgentLabelsReconciler) getOrCreateJenkinsCore(annotations map[string]string) (*core.JenkinsCore, error) {
 	creator, ok := annotations[v1alpha3.PipelineRunCreatorAnnoKey]
 	if !ok || creator == "" {
@@ -163,6 +200,16 @@ func (r *AgentLabelsReconciler) GetGroupName() string {
 	return reconcilerGroupName
 }
 
+// targetOfAgentTemplate makes sure the labels of the AgentTemplates are in the target ConfigMap
+func (r *AgentLabelsReconciler) targetOfAgentTemplate(client.Object) []reconcile.Request {
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Namespace: r.TargetNamespace,
+			Name:      r.targetName,
+		},
+	}}
+}
+
 func getSpecificConfigMapPredicate(name, namespace string) predicate.Funcs {
 	return predicate.NewPredicateFuncs(func(object client.Object) (ok bool) {
 		ok = object.GetName() == name && object.GetNamespace() == namespace
@@ -182,7 +229,14 @@ func (r *AgentLabelsReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.log = ctrl.Log.WithName(r.GetName())
 	r.recorder = mgr.GetEventRecorderFor(r.GetName())
 	return ctrl.NewControllerManagedBy(mgr).
-		WithEventFilter(getSpecificConfigMapPredicate(r.targetName, r.TargetNamespace)).
-		For(&v1.ConfigMap{}).
+		For(&v1.ConfigMap{}, builder.WithPredicates(getSpecificConfigMapPredicate(r.targetName, r.TargetNamespace))).
+		Watches(&source.Kind{Type: &v1alpha3.AgentTemplate{}},
+			handler.EnqueueRequestsFromMapFunc(r.targetOfAgentTemplate),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					return !reflect.DeepEqual(e.ObjectOld.(*v1alpha3.AgentTemplate).Status.Labels,
+						e.ObjectNew.(*v1alpha3.AgentTemplate).Status.Labels)
+				},
+			})).
 		Complete(r)
 }
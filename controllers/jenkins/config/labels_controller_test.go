@@ -316,3 +316,30 @@ func Test_getSpecificConfigMapPredicate(t *testing.T) {
 		})
 	}
 }
+
+func TestAgentLabelsReconciler_appendAgentTemplateLabels(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	synced := &v1alpha3.AgentTemplate{
+		ObjectMeta: v12.ObjectMeta{Namespace: "project", Name: "nodejs"},
+		Status: v1alpha3.AgentTemplateStatus{
+			Phase:  v1alpha3.AgentTemplatePhaseSynced,
+			Labels: []string{"project-node", "base"},
+		},
+	}
+	failed := &v1alpha3.AgentTemplate{
+		ObjectMeta: v12.ObjectMeta{Namespace: "project", Name: "maven"},
+		Status: v1alpha3.AgentTemplateStatus{
+			Phase:  v1alpha3.AgentTemplatePhaseFailed,
+			Labels: []string{"project-maven"},
+		},
+	}
+
+	r := &AgentLabelsReconciler{
+		Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(synced, failed).Build(),
+	}
+	labels, err := r.appendAgentTemplateLabels([]string{"base", "go"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"base", "go", "project-node"}, labels)
+}
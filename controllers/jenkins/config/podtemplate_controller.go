@@ -15,6 +15,7 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"time"
 
@@ -86,6 +87,11 @@ func (r *PodTemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// manipulate the data
 	if podTemplate.DeletionTimestamp.IsZero() {
 		if err = casc.ReplaceOrAddPodTemplate(podTemplate); err == nil {
+			// never write an invalid Jenkins CasC back
+			if err = validateCasC(casc.GetConfigAsString()); err != nil {
+				err = fmt.Errorf("the Jenkins CasC would be invalid with PodTemplate %s, error: %v", req, err)
+				return
+			}
 			cm.Data[r.TargetConfigMapKey] = casc.GetConfigAsString()
 
 			// write back the data
@@ -0,0 +1,263 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// concurrencyAction is the action to take on a new PipelineRun according to the concurrency policy.
+type concurrencyAction string
+
+const (
+	// concurrencyActionRun indicates that the PipelineRun could be triggered.
+	concurrencyActionRun concurrencyAction = "Run"
+	// concurrencyActionQueue indicates that the PipelineRun should wait for the previous ones.
+	concurrencyActionQueue concurrencyAction = "Queue"
+	// concurrencyActionSkip indicates that the PipelineRun should not be triggered at all.
+	concurrencyActionSkip concurrencyAction = "Skip"
+	// concurrencyActionReplace indicates that the previous PipelineRuns should be cancelled before triggering.
+	concurrencyActionReplace concurrencyAction = "Replace"
+)
+
+// concurrentPipelineRuns contains the PipelineRuns which are concurrent with a new PipelineRun.
+type concurrentPipelineRuns struct {
+	// running contains the PipelineRuns which have been triggered but not completed yet.
+	running []v1alpha3.PipelineRun
+	// queued contains the PipelineRuns which are not triggered yet, and were created before the new PipelineRun.
+	queued []v1alpha3.PipelineRun
+}
+
+// collectConcurrentPipelineRuns collects the PipelineRuns which run the same SCM reference with the given PipelineRun.
+func collectConcurrentPipelineRuns(pr *v1alpha3.PipelineRun, pipelineRuns []v1alpha3.PipelineRun) (runs concurrentPipelineRuns) {
+	group := getConcurrencyGroup(&pr.Spec)
+	for i := range pipelineRuns {
+		item := &pipelineRuns[i]
+		if item.Name == pr.Name || !item.Buildable() || !item.DeletionTimestamp.IsZero() ||
+			getConcurrencyGroup(&item.Spec) != group {
+			continue
+		}
+
+		if item.HasStarted() {
+			runs.running = append(runs.running, *item)
+		} else if createdBefore(item, pr) {
+			runs.queued = append(runs.queued, *item)
+		}
+	}
+	sort.Slice(runs.queued, func(i, j int) bool {
+		return createdBefore(&runs.queued[i], &runs.queued[j])
+	})
+	return
+}
+
+// getConcurrencyGroup returns the SCM reference of the PipelineRun, such as "branch/master".
+// PipelineRuns without SCM, like the ones triggered manually, are in the same group.
+func getConcurrencyGroup(prSpec *v1alpha3.PipelineRunSpec) string {
+	if prSpec.SCM == nil {
+		return ""
+	}
+	return string(prSpec.SCM.RefType) + "/" + prSpec.SCM.RefName
+}
+
+// createdBefore returns true if PipelineRun a was created before b, the name is compared if they were created at the same time.
+func createdBefore(a, b *v1alpha3.PipelineRun) bool {
+	if a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.Name < b.Name
+	}
+	return a.CreationTimestamp.Before(&b.CreationTimestamp)
+}
+
+// decideConcurrencyAction decides what to do with a new PipelineRun according to the concurrency policy.
+func decideConcurrencyAction(policy *v1alpha3.ConcurrencyPolicy, runs concurrentPipelineRuns) (action concurrencyAction, reason, message string) {
+	action = concurrencyActionRun
+	if len(runs.running) == 0 && len(runs.queued) == 0 {
+		return
+	}
+
+	spec := &v1alpha3.PipelineSpec{ConcurrencyPolicy: policy}
+	switch spec.GetConcurrencyPolicyType() {
+	case v1alpha3.ForbidConcurrent:
+		action, reason = concurrencyActionSkip, v1alpha3.ConcurrencyForbidden
+		message = fmt.Sprintf("skipped due to %d PipelineRun(s) not completed yet", len(runs.running)+len(runs.queued))
+	case v1alpha3.ReplaceConcurrent:
+		action, reason = concurrencyActionReplace, v1alpha3.Replaced
+		message = "replaced by a newer PipelineRun"
+	case v1alpha3.QueueConcurrent:
+		if policy.MaxQueueDepth > 0 && len(runs.queued) >= policy.MaxQueueDepth {
+			action, reason = concurrencyActionSkip, v1alpha3.QueueFull
+			message = fmt.Sprintf("skipped due to the queue is full, max queue depth is %d", policy.MaxQueueDepth)
+		} else {
+			action, reason = concurrencyActionQueue, v1alpha3.Queued
+			message = fmt.Sprintf("waiting for %d running and %d queued PipelineRun(s)", len(runs.running), len(runs.queued))
+		}
+	}
+	return
+}
+
+// applyConcurrencyPolicy enforces the concurrency policy of the Pipeline before triggering the PipelineRun.
+// The PipelineRun could be triggered only if proceed is true, otherwise the result should be returned.
+func (r *Reconciler) applyConcurrencyPolicy(ctx context.Context, pipeline *v1alpha3.Pipeline, pr *v1alpha3.PipelineRun) (
+	proceed bool, result ctrl.Result, err error) {
+	if pipeline.Spec.GetConcurrencyPolicyType() == v1alpha3.AllowConcurrent {
+		proceed = true
+		return
+	}
+
+	pipelineRuns := &v1alpha3.PipelineRunList{}
+	if err = r.List(ctx, pipelineRuns, client.InNamespace(pipeline.Namespace),
+		client.MatchingLabels{v1alpha3.PipelineNameLabelKey: pipeline.Name}); err != nil {
+		return
+	}
+	runs := collectConcurrentPipelineRuns(pr, pipelineRuns.Items)
+	action, reason, message := decideConcurrencyAction(pipeline.Spec.ConcurrencyPolicy, runs)
+
+	switch action {
+	case concurrencyActionRun:
+		proceed = true
+	case concurrencyActionReplace:
+		if err = r.cancelPipelineRuns(ctx, runs, reason, message); err == nil {
+			proceed = true
+		}
+	case concurrencyActionSkip:
+		r.recorder.Eventf(pr, corev1.EventTypeWarning, reason, "Skipped PipelineRun %s/%s, %s", pr.Namespace, pr.Name, message)
+		err = r.updateStatus(ctx, cancelledStatus(&pr.Status, reason, message), client.ObjectKeyFromObject(pr))
+	case concurrencyActionQueue:
+		// make sure the labels are persisted, so that the later PipelineRuns could find this one
+		if err = r.updateLabelsAndAnnotations(ctx, pr); err != nil {
+			return
+		}
+		if err = r.updateStatus(ctx, queuedStatus(&pr.Status, reason, message), client.ObjectKeyFromObject(pr)); err == nil {
+			result = ctrl.Result{RequeueAfter: r.pollInterval(nil)}
+		}
+	}
+	return
+}
+
+// cancelPipelineRuns requests to cancel the running PipelineRuns and skips the queued ones.
+func (r *Reconciler) cancelPipelineRuns(ctx context.Context, runs concurrentPipelineRuns, reason, message string) error {
+	for i := range runs.running {
+		run := &runs.running[i]
+		if err := r.requestToCancel(ctx, client.ObjectKeyFromObject(run)); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return err
+		}
+		r.recorder.Eventf(run, corev1.EventTypeNormal, reason, "Requested to cancel PipelineRun %s/%s, %s", run.Namespace, run.Name, message)
+	}
+	for i := range runs.queued {
+		run := &runs.queued[i]
+		if err := r.updateStatus(ctx, cancelledStatus(&run.Status, reason, message), client.ObjectKeyFromObject(run)); err != nil {
+			if client.IgnoreNotFound(err) == nil {
+				continue
+			}
+			return err
+		}
+		r.recorder.Eventf(run, corev1.EventTypeNormal, reason, "Skipped PipelineRun %s/%s, %s", run.Namespace, run.Name, message)
+	}
+	return nil
+}
+
+// requestToCancel marks the PipelineRun as cancel requested, the build will be stopped in its own reconciliation.
+func (r *Reconciler) requestToCancel(ctx context.Context, key client.ObjectKey) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		prToUpdate := &v1alpha3.PipelineRun{}
+		if err := r.Get(ctx, key, prToUpdate); err != nil {
+			return err
+		}
+		if prToUpdate.Spec.CancelRequested {
+			return nil
+		}
+		prToUpdate.Spec.CancelRequested = true
+		return r.Update(ctx, prToUpdate)
+	})
+}
+
+// queuedStatus returns a pending status with a condition which tells why the PipelineRun is queued.
+func queuedStatus(status *v1alpha3.PipelineRunStatus, reason, message string) *v1alpha3.PipelineRunStatus {
+	now := v1.Now()
+	desiredStatus := status.DeepCopy()
+	desiredStatus.Phase = v1alpha3.Pending
+	desiredStatus.UpdateTime = &now
+	if latest := status.GetLatestCondition(); status.Phase == v1alpha3.Pending &&
+		latest != nil && latest.Reason == reason && latest.Message == message {
+		// avoid updating the status every time
+		return status
+	}
+	desiredStatus.AddCondition(&v1alpha3.Condition{
+		Type:               v1alpha3.ConditionReady,
+		Status:             v1alpha3.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	})
+	return desiredStatus
+}
+
+// cancellingStatus returns a status with a condition which tells that the build is being stopped.
+func cancellingStatus(status *v1alpha3.PipelineRunStatus) *v1alpha3.PipelineRunStatus {
+	now := v1.Now()
+	desiredStatus := status.DeepCopy()
+	desiredStatus.UpdateTime = &now
+	desiredStatus.AddCondition(&v1alpha3.Condition{
+		Type:               v1alpha3.ConditionSucceeded,
+		Status:             v1alpha3.ConditionUnknown,
+		Reason:             v1alpha3.Cancelling,
+		Message:            "waiting for Jenkins to abort the build",
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	})
+	return desiredStatus
+}
+
+// isCancelling returns true if the build of the PipelineRun is being stopped.
+func isCancelling(status *v1alpha3.PipelineRunStatus) bool {
+	for _, condition := range status.Conditions {
+		if condition.Type == v1alpha3.ConditionSucceeded {
+			return condition.Reason == v1alpha3.Cancelling
+		}
+	}
+	return false
+}
+
+// cancelledStatus returns a completed status which indicates that the PipelineRun was cancelled or skipped.
+func cancelledStatus(status *v1alpha3.PipelineRunStatus, reason, message string) *v1alpha3.PipelineRunStatus {
+	now := v1.Now()
+	desiredStatus := status.DeepCopy()
+	desiredStatus.Phase = v1alpha3.Cancelled
+	desiredStatus.CompletionTime = &now
+	desiredStatus.UpdateTime = &now
+	desiredStatus.AddCondition(&v1alpha3.Condition{
+		Type:               v1alpha3.ConditionSucceeded,
+		Status:             v1alpha3.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		LastProbeTime:      now,
+		LastTransitionTime: now,
+	})
+	return desiredStatus
+}
@@ -0,0 +1,311 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newConcurrencyTestPipelineRun(name string, created time.Time, runID, refName string) v1alpha3.PipelineRun {
+	pr := v1alpha3.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "ns",
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            map[string]string{v1alpha3.PipelineNameLabelKey: "pipeline"},
+			Annotations:       map[string]string{},
+		},
+		Spec: v1alpha3.PipelineRunSpec{
+			PipelineRef: &v1.ObjectReference{Name: "pipeline"},
+		},
+	}
+	if runID != "" {
+		pr.Annotations[v1alpha3.JenkinsPipelineRunIDAnnoKey] = runID
+	}
+	if refName != "" {
+		pr.Spec.PipelineSpec = &v1alpha3.PipelineSpec{Type: v1alpha3.MultiBranchPipelineType}
+		pr.Spec.SCM = &v1alpha3.SCM{RefType: "branch", RefName: refName}
+	}
+	return pr
+}
+
+func Test_collectConcurrentPipelineRuns(t *testing.T) {
+	now := time.Now()
+	completed := newConcurrencyTestPipelineRun("completed", now.Add(-time.Hour), "1", "")
+	completed.Status.CompletionTime = &metav1.Time{Time: now}
+
+	tests := []struct {
+		name        string
+		pr          v1alpha3.PipelineRun
+		items       []v1alpha3.PipelineRun
+		wantRunning []string
+		wantQueued  []string
+	}{{
+		name:  "no other PipelineRuns",
+		pr:    newConcurrencyTestPipelineRun("new", now, "", ""),
+		items: []v1alpha3.PipelineRun{newConcurrencyTestPipelineRun("new", now, "", "")},
+	}, {
+		name: "completed PipelineRuns are not concurrent",
+		pr:   newConcurrencyTestPipelineRun("new", now, "", ""),
+		items: []v1alpha3.PipelineRun{
+			completed,
+			newConcurrencyTestPipelineRun("new", now, "", ""),
+		},
+	}, {
+		name: "running and queued PipelineRuns",
+		pr:   newConcurrencyTestPipelineRun("new", now, "", ""),
+		items: []v1alpha3.PipelineRun{
+			newConcurrencyTestPipelineRun("queued-2", now.Add(-time.Second), "", ""),
+			newConcurrencyTestPipelineRun("running", now.Add(-time.Hour), "1", ""),
+			newConcurrencyTestPipelineRun("queued-1", now.Add(-time.Minute), "", ""),
+			newConcurrencyTestPipelineRun("newer", now.Add(time.Second), "", ""),
+		},
+		wantRunning: []string{"running"},
+		wantQueued:  []string{"queued-1", "queued-2"},
+	}, {
+		name: "PipelineRuns of other branches are not concurrent",
+		pr:   newConcurrencyTestPipelineRun("new", now, "", "master"),
+		items: []v1alpha3.PipelineRun{
+			newConcurrencyTestPipelineRun("master", now.Add(-time.Hour), "1", "master"),
+			newConcurrencyTestPipelineRun("dev", now.Add(-time.Hour), "1", "dev"),
+		},
+		wantRunning: []string{"master"},
+	}, {
+		name: "PipelineRuns of other SCM references of a non multi-branch Pipeline are not concurrent",
+		pr: func() v1alpha3.PipelineRun {
+			pr := newConcurrencyTestPipelineRun("new", now, "", "")
+			pr.Spec.SCM = &v1alpha3.SCM{RefType: "branch", RefName: "master"}
+			return pr
+		}(),
+		items: []v1alpha3.PipelineRun{
+			func() v1alpha3.PipelineRun {
+				pr := newConcurrencyTestPipelineRun("master", now.Add(-time.Hour), "1", "")
+				pr.Spec.SCM = &v1alpha3.SCM{RefType: "branch", RefName: "master"}
+				return pr
+			}(),
+			func() v1alpha3.PipelineRun {
+				pr := newConcurrencyTestPipelineRun("tag-master", now.Add(-time.Hour), "2", "")
+				pr.Spec.SCM = &v1alpha3.SCM{RefType: "tag", RefName: "master"}
+				return pr
+			}(),
+			newConcurrencyTestPipelineRun("manual", now.Add(-time.Hour), "3", ""),
+		},
+		wantRunning: []string{"master"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := collectConcurrentPipelineRuns(&tt.pr, tt.items)
+			var running, queued []string
+			for _, item := range runs.running {
+				running = append(running, item.Name)
+			}
+			for _, item := range runs.queued {
+				queued = append(queued, item.Name)
+			}
+			assert.Equal(t, tt.wantRunning, running)
+			assert.Equal(t, tt.wantQueued, queued)
+		})
+	}
+}
+
+func Test_decideConcurrencyAction(t *testing.T) {
+	oneRunning := concurrentPipelineRuns{running: []v1alpha3.PipelineRun{{}}}
+	oneQueued := concurrentPipelineRuns{running: []v1alpha3.PipelineRun{{}}, queued: []v1alpha3.PipelineRun{{}}}
+
+	tests := []struct {
+		name       string
+		policy     *v1alpha3.ConcurrencyPolicy
+		runs       concurrentPipelineRuns
+		wantAction concurrencyAction
+		wantReason string
+	}{{
+		name:       "nil policy",
+		runs:       oneRunning,
+		wantAction: concurrencyActionRun,
+	}, {
+		name:       "allow",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.AllowConcurrent},
+		runs:       oneRunning,
+		wantAction: concurrencyActionRun,
+	}, {
+		name:       "forbid without concurrent PipelineRuns",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.ForbidConcurrent},
+		wantAction: concurrencyActionRun,
+	}, {
+		name:       "forbid",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.ForbidConcurrent},
+		runs:       oneRunning,
+		wantAction: concurrencyActionSkip,
+		wantReason: v1alpha3.ConcurrencyForbidden,
+	}, {
+		name:       "replace",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.ReplaceConcurrent},
+		runs:       oneRunning,
+		wantAction: concurrencyActionReplace,
+		wantReason: v1alpha3.Replaced,
+	}, {
+		name:       "queue without limit",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.QueueConcurrent},
+		runs:       oneQueued,
+		wantAction: concurrencyActionQueue,
+		wantReason: v1alpha3.Queued,
+	}, {
+		name:       "queue is not full",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.QueueConcurrent, MaxQueueDepth: 2},
+		runs:       oneQueued,
+		wantAction: concurrencyActionQueue,
+		wantReason: v1alpha3.Queued,
+	}, {
+		name:       "queue is full",
+		policy:     &v1alpha3.ConcurrencyPolicy{Type: v1alpha3.QueueConcurrent, MaxQueueDepth: 1},
+		runs:       oneQueued,
+		wantAction: concurrencyActionSkip,
+		wantReason: v1alpha3.QueueFull,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, reason, _ := decideConcurrencyAction(tt.policy, tt.runs)
+			assert.Equal(t, tt.wantAction, action)
+			assert.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
+
+func TestReconciler_applyConcurrencyPolicy(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	now := time.Now()
+	newPipeline := func(policyType v1alpha3.ConcurrencyPolicyType) *v1alpha3.Pipeline {
+		return &v1alpha3.Pipeline{
+			ObjectMeta: metav1.ObjectMeta{Name: "pipeline", Namespace: "ns"},
+			Spec: v1alpha3.PipelineSpec{
+				Type:              v1alpha3.NoScmPipelineType,
+				ConcurrencyPolicy: &v1alpha3.ConcurrencyPolicy{Type: policyType},
+			},
+		}
+	}
+	running := newConcurrencyTestPipelineRun("running", now.Add(-time.Hour), "1", "")
+	queued := newConcurrencyTestPipelineRun("queued", now.Add(-time.Minute), "", "")
+	newRun := newConcurrencyTestPipelineRun("new", now, "", "")
+
+	tests := []struct {
+		name        string
+		pipeline    *v1alpha3.Pipeline
+		existing    []v1alpha3.PipelineRun
+		wantProceed bool
+		wantRequeue bool
+		wantPhases  map[string]v1alpha3.RunPhase
+		// wantCancelRequested contains the PipelineRuns which should be requested to cancel
+		wantCancelRequested []string
+	}{{
+		name:        "allow",
+		pipeline:    newPipeline(v1alpha3.AllowConcurrent),
+		existing:    []v1alpha3.PipelineRun{running},
+		wantProceed: true,
+	}, {
+		name:        "forbid without concurrent PipelineRuns",
+		pipeline:    newPipeline(v1alpha3.ForbidConcurrent),
+		wantProceed: true,
+	}, {
+		name:       "forbid",
+		pipeline:   newPipeline(v1alpha3.ForbidConcurrent),
+		existing:   []v1alpha3.PipelineRun{running},
+		wantPhases: map[string]v1alpha3.RunPhase{"new": v1alpha3.Cancelled},
+	}, {
+		name:        "queue",
+		pipeline:    newPipeline(v1alpha3.QueueConcurrent),
+		existing:    []v1alpha3.PipelineRun{running},
+		wantRequeue: true,
+		wantPhases:  map[string]v1alpha3.RunPhase{"new": v1alpha3.Pending},
+	}, {
+		name:                "replace",
+		pipeline:            newPipeline(v1alpha3.ReplaceConcurrent),
+		existing:            []v1alpha3.PipelineRun{running, queued},
+		wantProceed:         true,
+		wantPhases:          map[string]v1alpha3.RunPhase{"queued": v1alpha3.Cancelled, "new": ""},
+		wantCancelRequested: []string{"running"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []client.Object{tt.pipeline, newRun.DeepCopy()}
+			for i := range tt.existing {
+				objs = append(objs, tt.existing[i].DeepCopy())
+			}
+			r := &Reconciler{
+				Client:   fake.NewClientBuilder().WithScheme(schema).WithObjects(objs...).Build(),
+				recorder: &record.FakeRecorder{},
+			}
+
+			proceed, result, err := r.applyConcurrencyPolicy(context.Background(), tt.pipeline, newRun.DeepCopy())
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantProceed, proceed)
+			assert.Equal(t, tt.wantRequeue, result.RequeueAfter > 0)
+			for name, phase := range tt.wantPhases {
+				pr := &v1alpha3.PipelineRun{}
+				assert.Nil(t, r.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: name}, pr))
+				assert.Equal(t, phase, pr.Status.Phase, name)
+			}
+			for _, name := range tt.wantCancelRequested {
+				pr := &v1alpha3.PipelineRun{}
+				assert.Nil(t, r.Get(context.Background(), client.ObjectKey{Namespace: "ns", Name: name}, pr))
+				assert.True(t, pr.Spec.CancelRequested, name)
+			}
+		})
+	}
+}
+
+func Test_queuedStatus(t *testing.T) {
+	status := queuedStatus(&v1alpha3.PipelineRunStatus{}, v1alpha3.Queued, "waiting")
+	assert.Equal(t, v1alpha3.Pending, status.Phase)
+	assert.Nil(t, status.CompletionTime)
+	if assert.NotNil(t, status.GetLatestCondition()) {
+		assert.Equal(t, v1alpha3.Queued, status.GetLatestCondition().Reason)
+	}
+
+	// the same status is returned if nothing changed
+	sameStatus := queuedStatus(status, v1alpha3.Queued, "waiting")
+	assert.True(t, sameStatus == status)
+
+	status = cancelledStatus(status, v1alpha3.QueueFull, "full")
+	assert.Equal(t, v1alpha3.Cancelled, status.Phase)
+	assert.NotNil(t, status.CompletionTime)
+	assert.Equal(t, v1alpha3.QueueFull, status.GetLatestCondition().Reason)
+}
+
+func Test_cancellingStatus(t *testing.T) {
+	status := &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running}
+	assert.False(t, isCancelling(status))
+
+	status = cancellingStatus(status)
+	assert.Equal(t, v1alpha3.Running, status.Phase)
+	assert.Nil(t, status.CompletionTime)
+	assert.True(t, isCancelling(status))
+
+	status = cancelledStatus(status, string(v1alpha3.Cancelled), "cancelled")
+	assert.False(t, isCancelling(status))
+}
@@ -17,7 +17,11 @@ limitations under the License.
 package pipelinerun
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -125,6 +129,93 @@ func (handler *jenkinsHandler) triggerJenkinsJob(devopsProjectName, pipelineName
 	})
 }
 
+var (
+	queueItemLocationPattern = regexp.MustCompile(`/queue/item/(\d+)/?$`)
+	buildLocationPattern     = regexp.MustCompile(`/(\d+)/?$`)
+)
+
+// restartJenkinsJob restarts a completed Jenkins build from the given stage, the location which Jenkins redirects to is returned.
+// The location points to the queue item or the build of the restarted PipelineRun, see also resolveRestartedJenkinsJob.
+func (handler *jenkinsHandler) restartJenkinsJob(pipelineRun *v1alpha3.PipelineRun, runID, stage string) (location string, err error) {
+	jobPath := getJenkinsJobPath(pipelineRun)
+	api := fmt.Sprintf("%s%s/%s/restart/restart", strings.TrimSuffix(handler.URL, "/"), jobPath, runID)
+	payload := strings.NewReader(url.Values{"stageName": {stage}}.Encode())
+
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPost, api, payload); err != nil {
+		return
+	}
+	if err = handler.AuthHandle(req); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	// the location of the redirection is the only place which tells us the restarted build
+	client := handler.GetClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return "", fmt.Errorf("failed to restart Jenkins job: %s, build: %s, stage: %s, error: %v", jobPath, runID, stage, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("failed to restart Jenkins job: %s, build: %s, stage: %s, status code: %d",
+			jobPath, runID, stage, resp.StatusCode)
+	}
+	if location = resp.Header.Get("Location"); location == "" {
+		err = fmt.Errorf("no location returned after restarting Jenkins job: %s, build: %s, stage: %s", jobPath, runID, stage)
+	}
+	return
+}
+
+// resolveRestartedJenkinsJob finds the restarted build by the location which Jenkins returned after restarting.
+// A nil PipelineRun is returned if the restarted build is still waiting in the queue.
+func (handler *jenkinsHandler) resolveRestartedJenkinsJob(pipelineRun *v1alpha3.PipelineRun, location string) (*job.PipelineRun, error) {
+	var buildNumber int
+	if matches := queueItemLocationPattern.FindStringSubmatch(location); len(matches) == 2 {
+		item := &queueItem{}
+		api := fmt.Sprintf("/queue/item/%s/api/json", matches[1])
+		statusCode, data, err := handler.Request(http.MethodGet, api, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Jenkins queue item: %s, error: %v", matches[1], err)
+		}
+		if statusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get Jenkins queue item: %s, status code: %d", matches[1], statusCode)
+		}
+		if err = json.Unmarshal(data, item); err != nil {
+			return nil, fmt.Errorf("failed to parse Jenkins queue item: %s, error: %v", matches[1], err)
+		}
+		if item.Cancelled {
+			return nil, fmt.Errorf("the Jenkins queue item %s of the restarted build was cancelled", matches[1])
+		}
+		if item.Executable == nil {
+			return nil, nil
+		}
+		buildNumber = item.Executable.Number
+	} else if matches = buildLocationPattern.FindStringSubmatch(location); len(matches) == 2 {
+		buildNumber, _ = strconv.Atoi(matches[1])
+	} else {
+		return nil, fmt.Errorf("unable to find the restarted build from location: %s", location)
+	}
+
+	jobRun := &job.PipelineRun{}
+	jobRun.ID = strconv.Itoa(buildNumber)
+	jobRun.Pipeline = getJenkinsRefName(&pipelineRun.Spec)
+	return jobRun, nil
+}
+
+// queueItem is the part of a Jenkins queue item which we care about
+type queueItem struct {
+	Cancelled  bool `json:"cancelled"`
+	Executable *struct {
+		Number int `json:"number"`
+	} `json:"executable"`
+}
+
 func (handler *jenkinsHandler) deleteJenkinsJobHistory(pipelineRun *v1alpha3.PipelineRun) (err error) {
 	var buildNum int
 	if buildNum = getJenkinsBuildNumber(pipelineRun); buildNum < 0 {
@@ -144,6 +235,46 @@ func (handler *jenkinsHandler) deleteJenkinsJobHistory(pipelineRun *v1alpha3.Pip
 	return
 }
 
+// stopJenkinsJob stops the Jenkins build which related with a PipelineRun
+func (handler *jenkinsHandler) stopJenkinsJob(pipelineRun *v1alpha3.PipelineRun) (err error) {
+	var buildNum int
+	if buildNum = getJenkinsBuildNumber(pipelineRun); buildNum < 0 {
+		return
+	}
+
+	jenkinsClient := job.Client{JenkinsCore: *handler.JenkinsCore}
+	jobPath := getJenkinsJobPath(pipelineRun)
+	if err = jenkinsClient.StopJob(jobPath, buildNum); err != nil {
+		err = fmt.Errorf("failed to stop Jenkins job: %s, build: %d, error: %v", jobPath, buildNum, err)
+	}
+	return
+}
+
+// getJenkinsJobLog returns the whole console log of the Jenkins build
+func (handler *jenkinsHandler) getJenkinsJobLog(pipelineRun *v1alpha3.PipelineRun) (string, error) {
+	var buildNum int
+	if buildNum = getJenkinsBuildNumber(pipelineRun); buildNum < 0 {
+		return "", nil
+	}
+
+	jenkinsClient := job.Client{JenkinsCore: *handler.JenkinsCore}
+	jobPath := getJenkinsJobPath(pipelineRun)
+	builder := strings.Builder{}
+	var start int64
+	for {
+		jobLog, err := jenkinsClient.Log(jobPath, buildNum, start)
+		if err != nil {
+			return "", fmt.Errorf("failed to get the log of Jenkins job: %s, build: %d, error: %v", jobPath, buildNum, err)
+		}
+		builder.WriteString(jobLog.Text)
+		if !jobLog.HasMore || jobLog.NextStart <= start {
+			break
+		}
+		start = jobLog.NextStart
+	}
+	return builder.String(), nil
+}
+
 // getJenkinsJobPath returns the corresponding Jenkins job path
 // only a regular or multi-branch Pipeline supported
 func getJenkinsJobPath(run *v1alpha3.PipelineRun) (jobPath string) {
@@ -159,8 +290,8 @@ func getJenkinsJobPath(run *v1alpha3.PipelineRun) (jobPath string) {
 	}
 
 	jobPath = fmt.Sprintf("/job/%s/job/%s", ref.Namespace, ref.Name)
-	if run.Spec.SCM != nil && run.Spec.SCM.RefName != "" {
-		jobPath = fmt.Sprintf("%s/job/%s", jobPath, run.Spec.SCM.RefName)
+	if refName := getJenkinsRefName(&run.Spec); refName != "" {
+		jobPath = fmt.Sprintf("%s/job/%s", jobPath, refName)
 	}
 	return
 }
@@ -23,6 +23,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -304,6 +305,29 @@ func Test_getJenkinsJobPath(t *testing.T) {
 			},
 		},
 		want: "/job/ns/job/pipeline/job/master",
+	}, {
+		name: "a regular PipelineRun triggered by a pull request",
+		args: args{
+			pipelineRun: &v1alpha3.PipelineRun{
+				ObjectMeta: v1.ObjectMeta{
+					Namespace: "ns",
+					Name:      "run",
+				},
+				Spec: v1alpha3.PipelineRunSpec{
+					SCM: &v1alpha3.SCM{
+						RefType: v1alpha3.PullRequest,
+						RefName: "PR-1",
+					},
+					PipelineSpec: &v1alpha3.PipelineSpec{
+						Type: v1alpha3.NoScmPipelineType,
+					},
+					PipelineRef: &corev1.ObjectReference{
+						Name: "pipeline",
+					},
+				},
+			},
+		},
+		want: "/job/ns/job/pipeline",
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -311,3 +335,275 @@ func Test_getJenkinsJobPath(t *testing.T) {
 		})
 	}
 }
+
+var _ = Describe("Test stopJenkinsJob", func() {
+	var (
+		ctrl         *gomock.Controller
+		roundTripper *mhttp.MockRoundTripper
+		jHandler     *jenkinsHandler
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		roundTripper = mhttp.NewMockRoundTripper(ctrl)
+		jHandler = &jenkinsHandler{&core.JenkinsCore{
+			URL:          "http://localhost",
+			RoundTripper: roundTripper,
+		}}
+	})
+
+	It("stop a PipelineRun without build number", func() {
+		err := jHandler.stopJenkinsJob(&v1alpha3.PipelineRun{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("stop a valid PipelineRun", func() {
+		namespace := "project1"
+		pipelineName := "testPipeline"
+
+		requestCrumb, _ := http.NewRequest(http.MethodGet, "http://localhost/crumbIssuer/api/json", nil)
+		responseCrumb := &http.Response{
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			Request:    requestCrumb,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`
+				{"crumbRequestField":"CrumbRequestField","crumb":"Crumb"}
+				`)),
+		}
+		roundTripper.EXPECT().
+			RoundTrip(core.NewRequestMatcher(requestCrumb)).Return(responseCrumb, nil)
+
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost/job/%s/job/%s/2/stop", namespace, pipelineName), nil)
+		request.Header.Set("CrumbRequestField", "Crumb")
+		response := &http.Response{
+			Request:    request,
+			StatusCode: http.StatusOK,
+		}
+		roundTripper.EXPECT().
+			RoundTrip(core.NewRequestMatcher(request)).Return(response, nil)
+
+		err := jHandler.stopJenkinsJob(&v1alpha3.PipelineRun{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: namespace,
+				Annotations: map[string]string{
+					v1alpha3.JenkinsPipelineRunIDAnnoKey: "2",
+				},
+			},
+			Spec: v1alpha3.PipelineRunSpec{
+				PipelineRef: &corev1.ObjectReference{
+					Name: pipelineName,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
+
+var _ = Describe("Test restartJenkinsJob", func() {
+	var (
+		ctrl         *gomock.Controller
+		roundTripper *mhttp.MockRoundTripper
+		jHandler     *jenkinsHandler
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		roundTripper = mhttp.NewMockRoundTripper(ctrl)
+		jHandler = &jenkinsHandler{&core.JenkinsCore{
+			URL:          "http://localhost",
+			RoundTripper: roundTripper,
+		}}
+	})
+
+	It("restart a PipelineRun from a stage", func() {
+		namespace := "project1"
+		pipelineName := "testPipeline"
+
+		requestCrumb, _ := http.NewRequest(http.MethodGet, "http://localhost/crumbIssuer/api/json", nil)
+		responseCrumb := &http.Response{
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			Request:    requestCrumb,
+			Body: ioutil.NopCloser(bytes.NewBufferString(`
+				{"crumbRequestField":"CrumbRequestField","crumb":"Crumb"}
+				`)),
+		}
+		roundTripper.EXPECT().
+			RoundTrip(core.NewRequestMatcher(requestCrumb)).Return(responseCrumb, nil)
+
+		request, _ := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost/job/%s/job/%s/2/restart/restart", namespace, pipelineName),
+			bytes.NewBufferString("stageName=build"))
+		request.Header.Set("CrumbRequestField", "Crumb")
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		response := &http.Response{
+			Request:    request,
+			StatusCode: http.StatusFound,
+			Header:     http.Header{"Location": []string{"http://localhost/queue/item/5/"}},
+			Body:       ioutil.NopCloser(bytes.NewBufferString("")),
+		}
+		roundTripper.EXPECT().
+			RoundTrip(core.NewRequestMatcher(request).WithBody()).Return(response, nil)
+
+		location, err := jHandler.restartJenkinsJob(&v1alpha3.PipelineRun{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: namespace,
+			},
+			Spec: v1alpha3.PipelineRunSpec{
+				PipelineRef: &corev1.ObjectReference{
+					Name: pipelineName,
+				},
+			},
+		}, "2", "build")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(location).To(Equal("http://localhost/queue/item/5/"))
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+})
+
+var _ = Describe("Test getJenkinsJobLog", func() {
+	var (
+		ctrl         *gomock.Controller
+		roundTripper *mhttp.MockRoundTripper
+		jHandler     *jenkinsHandler
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		roundTripper = mhttp.NewMockRoundTripper(ctrl)
+		jHandler = &jenkinsHandler{&core.JenkinsCore{
+			URL:          "http://localhost",
+			RoundTripper: roundTripper,
+		}}
+	})
+
+	It("get the log of a PipelineRun without build number", func() {
+		log, err := jHandler.getJenkinsJobLog(&v1alpha3.PipelineRun{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log).To(BeEmpty())
+	})
+
+	It("get the log of a valid PipelineRun progressively", func() {
+		namespace := "project1"
+		pipelineName := "testPipeline"
+
+		for _, piece := range []struct {
+			start    int
+			text     string
+			textSize string
+			moreData string
+		}{{
+			text: "first\n", textSize: "6", moreData: "true",
+		}, {
+			start: 6, text: "second\n", textSize: "13",
+		}} {
+			request, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost/job/%s/job/%s/2/logText/progressiveText?start=%d",
+				namespace, pipelineName, piece.start), nil)
+			response := &http.Response{
+				Request:    request,
+				StatusCode: http.StatusOK,
+				Header: http.Header{
+					"X-Text-Size": []string{piece.textSize},
+					"X-More-Data": []string{piece.moreData},
+				},
+				Body: ioutil.NopCloser(bytes.NewBufferString(piece.text)),
+			}
+			roundTripper.EXPECT().
+				RoundTrip(core.NewRequestMatcher(request)).Return(response, nil).Times(1)
+		}
+
+		log, err := jHandler.getJenkinsJobLog(&v1alpha3.PipelineRun{
+			ObjectMeta: v1.ObjectMeta{
+				Namespace: namespace,
+				Annotations: map[string]string{
+					v1alpha3.JenkinsPipelineRunIDAnnoKey: "2",
+				},
+			},
+			Spec: v1alpha3.PipelineRunSpec{
+				PipelineRef: &corev1.ObjectReference{
+					Name: pipelineName,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(log).To(Equal("first\nsecond\n"))
+	})
+})
+
+func Test_resolveRestartedJenkinsJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/queue/item/1/api/json":
+			_, _ = w.Write([]byte(`{"cancelled":false,"executable":{"number":3}}`))
+		case "/queue/item/2/api/json":
+			_, _ = w.Write([]byte(`{"cancelled":false}`))
+		case "/queue/item/3/api/json":
+			_, _ = w.Write([]byte(`{"cancelled":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	pipelineRun := &v1alpha3.PipelineRun{
+		Spec: v1alpha3.PipelineRunSpec{
+			SCM: &v1alpha3.SCM{RefName: "main", RefType: "branch"},
+		},
+	}
+	tests := []struct {
+		name     string
+		location string
+		wantID   string
+		wantNil  bool
+		wantErr  bool
+	}{{
+		name:     "the queue item has been built",
+		location: server.URL + "/queue/item/1/",
+		wantID:   "3",
+	}, {
+		name:     "the queue item is pending",
+		location: server.URL + "/queue/item/2/",
+		wantNil:  true,
+	}, {
+		name:     "the queue item was cancelled",
+		location: server.URL + "/queue/item/3/",
+		wantErr:  true,
+	}, {
+		name:     "the queue item is gone",
+		location: server.URL + "/queue/item/4/",
+		wantErr:  true,
+	}, {
+		name:     "the build",
+		location: server.URL + "/job/ns/job/pipeline/job/main/5/",
+		wantID:   "5",
+	}, {
+		name:     "unknown location",
+		location: server.URL + "/job/ns/job/pipeline/",
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &jenkinsHandler{&core.JenkinsCore{URL: server.URL}}
+			jobRun, err := handler.resolveRestartedJenkinsJob(pipelineRun, tt.location)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			if tt.wantNil {
+				assert.Nil(t, jobRun)
+				return
+			}
+			if assert.NotNil(t, jobRun) {
+				assert.Equal(t, tt.wantID, jobRun.ID)
+				assert.Equal(t, "main", jobRun.Pipeline)
+			}
+		})
+	}
+}
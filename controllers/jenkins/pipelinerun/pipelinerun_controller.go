@@ -21,7 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/go-logr/logr"
-	cmstore "kubesphere.io/devops/pkg/store/configmap"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 	storeInter "kubesphere.io/devops/pkg/store/store"
 	"kubesphere.io/devops/pkg/utils/k8sutil"
 	"reflect"
@@ -38,9 +38,12 @@ import (
 	"k8s.io/klog/v2"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	devopsClient "kubesphere.io/devops/pkg/client/devops"
+	"kubesphere.io/devops/pkg/client/s3"
 	"kubesphere.io/devops/pkg/jwt/token"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 )
 
 // tokenExpireIn indicates that the temporary token issued by controller will be expired in some time.
@@ -49,6 +52,15 @@ const tokenExpireIn time.Duration = 5 * time.Minute
 // BuildNotExistMsg indicates the build with pipelinerun-id not exist in jenkins
 const BuildNotExistMsg = "not found resources"
 
+const (
+	// defaultMinPollInterval is the default minimum interval of polling Jenkins for missed events.
+	defaultMinPollInterval = 10 * time.Second
+	// defaultMaxPollInterval is the default maximum interval of polling Jenkins for missed events.
+	defaultMaxPollInterval = 5 * time.Minute
+	// pollBackoffFactor makes the polling interval grow along with the running duration of a PipelineRun.
+	pollBackoffFactor = 4
+)
+
 // Reconciler reconciles a PipelineRun object
 type Reconciler struct {
 	client.Client
@@ -61,6 +73,15 @@ type Reconciler struct {
 	TokenIssuer          token.Issuer
 	recorder             record.EventRecorder
 	PipelineRunDataStore string
+	// PipelineRunDataDir is the root directory of the filesystem data store
+	PipelineRunDataDir string
+	// S3Client is only required by the s3 data store
+	S3Client s3.Interface
+
+	// MinPollInterval and MaxPollInterval limit the interval of polling Jenkins.
+	// Status updates are mainly driven by Jenkins events, polling is only a fallback for missed events.
+	MinPollInterval time.Duration
+	MaxPollInterval time.Duration
 }
 
 //+kubebuilder:rbac:groups=devops.kubesphere.io,resources=pipelineruns,verbs=get;list;watch;create;update;patch;delete
@@ -87,6 +108,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 
 	// DeletionTimestamp.IsZero() means copyPipeline has not been deleted.
 	if !pipelineRunCopied.ObjectMeta.DeletionTimestamp.IsZero() {
+		if err = r.deletePipelineRunData(pipelineRunCopied); err != nil {
+			// the data is not important enough to block the deletion
+			klog.V(4).Infof("failed to delete the data of PipelineRun: %s/%s, error: %v",
+				pipelineRunCopied.Namespace, pipelineRunCopied.Name, err)
+		}
 		if err = jHandler.deleteJenkinsJobHistory(pipelineRunCopied); err != nil {
 			klog.V(4).Infof("failed to delete Jenkins job history from PipelineRun: %s/%s, error: %v",
 				pipelineRunCopied.Namespace, pipelineRunCopied.Name, err)
@@ -102,6 +128,17 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		return ctrl.Result{}, nil
 	}
 
+	// the PipelineRun is requested to be cancelled
+	if pipelineRunCopied.Spec.IsCancelRequested() {
+		if !pipelineRunCopied.HasStarted() {
+			return ctrl.Result{}, r.cancelPipelineRun(ctx, pipelineRunCopied)
+		}
+		// the PipelineRun will be finalized by the sync below once Jenkins has aborted the build
+		if err = r.stopPipelineRun(ctx, pipelineRunCopied); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
 	// check PipelineRef
 	if pipelineRunCopied.Spec.PipelineRef == nil || pipelineRunCopied.Spec.PipelineRef.Name == "" {
 		// make the PipelineRun as orphan
@@ -145,6 +182,11 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		status := pipelineRunCopied.Status.DeepCopy()
 		pbApplier := pipelineBuildApplier{pipelineBuild}
 		pbApplier.apply(status)
+		if pipelineRunCopied.Spec.IsCancelRequested() && pipelineBuild.Result == Aborted.String() {
+			completionTime := status.CompletionTime
+			status = cancelledStatus(status, string(v1alpha3.Cancelled), "the PipelineRun was cancelled")
+			status.CompletionTime = completionTime
+		}
 		// Because the status is a subresource of PipelineRun, we have to update status separately.
 		// See also: https://book-v1.book.kubebuilder.io/basics/status_subresource.html
 		if err := r.updateStatus(ctx, status, req.NamespacedName); err != nil {
@@ -168,8 +210,16 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 			nodeDetailsJSON = []byte("[]")
 		}
 
+		// keep the whole log once the PipelineRun completes, then the log API doesn't need to request Jenkins
+		var allLog string
+		if status.CompletionTime != nil && r.PipelineRunDataStore != storefactory.TypeAnnotation {
+			if allLog, err = jHandler.getJenkinsJobLog(pipelineRunCopied); err != nil {
+				log.Error(err, "unable to get the log of PipelineRun")
+			}
+		}
+
 		// store pipelinerun stage to configmap
-		if err = r.storePipelineRunData(string(nodeDetailsJSON), pipelineRunCopied); err != nil {
+		if err = r.storePipelineRunData(string(nodeDetailsJSON), allLog, pipelineRunCopied); err != nil {
 			log.Error(err, "unable to store pipeline stages to configmap.")
 			return ctrl.Result{}, err
 		}
@@ -186,9 +236,19 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		}
 
 		r.recorder.Eventf(pipelineRunCopied, corev1.EventTypeNormal, v1alpha3.Updated, "Updated running data for PipelineRun %s", req.NamespacedName)
-		// until the status is okay
-		// TODO make the RequeueAfter configurable
-		return ctrl.Result{RequeueAfter: 3 * time.Second}, nil
+		if status.CompletionTime != nil {
+			return ctrl.Result{}, nil
+		}
+		// poll as a fallback in case of missing events from Jenkins
+		return ctrl.Result{RequeueAfter: r.pollInterval(status)}, nil
+	}
+
+	// make sure the concurrency policy of the Pipeline is respected before triggering
+	if proceed, result, err := r.applyConcurrencyPolicy(ctx, pipeline, pipelineRunCopied); err != nil || !proceed {
+		if err != nil {
+			log.Error(err, "unable to apply the concurrency policy")
+		}
+		return result, err
 	}
 
 	// get or create JenkinsCore if the PipelineRun has creator annotation
@@ -199,8 +259,16 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	}
 	// create trigger handler
 	triggerHandler := &jenkinsHandler{jenkinsCore}
-	// first run
-	jobRun, err := triggerHandler.triggerJenkinsJob(namespaceName, pipelineName, &pipelineRunCopied.Spec)
+	// first run, or restart from a stage of the original build
+	var jobRun *job.PipelineRun
+	if stage, runID := getRestartStage(pipelineRunCopied); stage != "" {
+		if jobRun, err = r.restartFromStage(ctx, triggerHandler, pipelineRunCopied, runID, stage); err == nil && jobRun == nil {
+			// the restarted build is still in the queue of Jenkins
+			return ctrl.Result{RequeueAfter: r.pollInterval(nil)}, nil
+		}
+	} else {
+		jobRun, err = triggerHandler.triggerJenkinsJob(namespaceName, pipelineName, &pipelineRunCopied.Spec)
+	}
 	if err != nil {
 		log.Error(err, "unable to run pipeline", "namespace", namespaceName, "pipeline", pipeline.Name)
 		r.recorder.Eventf(pipelineRunCopied, corev1.EventTypeWarning, v1alpha3.TriggerFailed, "Failed to trigger PipelineRun %s, and error was %v", req.NamespacedName, err)
@@ -243,11 +311,53 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		return ctrl.Result{}, err
 	}
 	r.recorder.Eventf(pipelineRunCopied, corev1.EventTypeNormal, v1alpha3.Started, "Started PipelineRun %s", req.NamespacedName)
-	// requeue after 1 second
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.pollInterval(&pipelineRunCopied.Status)}, nil
 }
 
-func (r *Reconciler) storePipelineRunData(nodeDetailsJSON string, pipelineRunCopied *v1alpha3.PipelineRun) (err error) {
+// restartFromStage restarts the original build from the given stage, the location which Jenkins returns is kept in
+// an annotation, so that the build won't be restarted again if we fail to resolve it this time.
+func (r *Reconciler) restartFromStage(ctx context.Context, handler *jenkinsHandler, pipelineRun *v1alpha3.PipelineRun,
+	runID, stage string) (jobRun *job.PipelineRun, err error) {
+	location := pipelineRun.GetAnnotations()[v1alpha3.PipelineRunRestartLocationAnnoKey]
+	if location == "" {
+		if location, err = handler.restartJenkinsJob(pipelineRun, runID, stage); err != nil {
+			return
+		}
+		if pipelineRun.Annotations == nil {
+			pipelineRun.Annotations = make(map[string]string)
+		}
+		pipelineRun.Annotations[v1alpha3.PipelineRunRestartLocationAnnoKey] = location
+		if err = r.updateLabelsAndAnnotations(ctx, pipelineRun); err != nil {
+			return
+		}
+	}
+	return handler.resolveRestartedJenkinsJob(pipelineRun, location)
+}
+
+// pollInterval returns an adaptive interval of polling Jenkins. The longer the PipelineRun has been running,
+// the less frequently we poll it, the interval is limited between MinPollInterval and MaxPollInterval.
+func (r *Reconciler) pollInterval(status *v1alpha3.PipelineRunStatus) time.Duration {
+	minInterval, maxInterval := r.MinPollInterval, r.MaxPollInterval
+	if minInterval <= 0 {
+		minInterval = defaultMinPollInterval
+	}
+	if maxInterval < minInterval {
+		maxInterval = defaultMaxPollInterval
+	}
+
+	interval := minInterval
+	if status != nil && status.StartTime != nil {
+		interval = time.Since(status.StartTime.Time) / pollBackoffFactor
+	}
+	if interval < minInterval {
+		interval = minInterval
+	} else if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+func (r *Reconciler) storePipelineRunData(nodeDetailsJSON, allLog string, pipelineRunCopied *v1alpha3.PipelineRun) (err error) {
 	if r.PipelineRunDataStore == "" {
 		if pipelineRunCopied.Annotations == nil {
 			pipelineRunCopied.Annotations = make(map[string]string)
@@ -258,20 +368,43 @@ func (r *Reconciler) storePipelineRunData(nodeDetailsJSON string, pipelineRunCop
 		if err = r.updateLabelsAndAnnotations(r.ctx, pipelineRunCopied); err != nil {
 			r.log.Error(err, "unable to update PipelineRun labels and annotations.")
 		}
-	} else if r.PipelineRunDataStore == "configmap" {
-		var cmStore storeInter.ConfigMapStore
-		if cmStore, err = cmstore.NewConfigMapStore(r.ctx, r.req.NamespacedName, r.Client); err == nil {
-			cmStore.SetStages(nodeDetailsJSON)
-			cmStore.SetOwnerReference(v1.OwnerReference{
-				APIVersion: pipelineRunCopied.APIVersion,
-				Kind:       pipelineRunCopied.Kind,
-				Name:       pipelineRunCopied.Name,
-				UID:        pipelineRunCopied.UID,
-			})
-			err = cmStore.Save()
-		}
 	} else {
-		err = fmt.Errorf("unknown pipelineRun data store type: %s", r.PipelineRunDataStore)
+		var dataStore storeInter.PipelineRunDataStore
+		if dataStore, err = r.getDataStoreFactory().NewWithMigration(r.ctx, r.req.NamespacedName); err == nil {
+			dataStore.SetStages(nodeDetailsJSON)
+			if allLog != "" {
+				dataStore.SetAllLog(allLog)
+			}
+			if cmStore, ok := dataStore.(storeInter.ConfigMapStore); ok {
+				cmStore.SetOwnerReference(v1.OwnerReference{
+					APIVersion: pipelineRunCopied.APIVersion,
+					Kind:       pipelineRunCopied.Kind,
+					Name:       pipelineRunCopied.Name,
+					UID:        pipelineRunCopied.UID,
+				})
+			}
+			err = dataStore.Save()
+		}
+	}
+	return
+}
+
+// getDataStoreFactory returns the factory of the PipelineRun data stores according to the data store type
+func (r *Reconciler) getDataStoreFactory() *storefactory.Factory {
+	return storefactory.NewFactory(&storefactory.Options{
+		Type:    r.PipelineRunDataStore,
+		RootDir: r.PipelineRunDataDir,
+	}, r.Client, r.S3Client)
+}
+
+// deletePipelineRunData removes the data of a PipelineRun from the data store
+func (r *Reconciler) deletePipelineRunData(pipelineRun *v1alpha3.PipelineRun) (err error) {
+	if r.PipelineRunDataStore == storefactory.TypeAnnotation {
+		return
+	}
+	var dataStore storeInter.PipelineRunDataStore
+	if dataStore, err = r.getDataStoreFactory().New(r.ctx, client.ObjectKeyFromObject(pipelineRun)); err == nil {
+		err = dataStore.Delete()
 	}
 	return
 }
@@ -364,6 +497,36 @@ func (r *Reconciler) makePipelineRunOrphan(ctx context.Context, pr *v1alpha3.Pip
 	return
 }
 
+// stopPipelineRun stops the Jenkins build of a started PipelineRun, then marks the PipelineRun as cancelling.
+// It's not cancelled until Jenkins reports the build as aborted.
+func (r *Reconciler) stopPipelineRun(ctx context.Context, pr *v1alpha3.PipelineRun) (err error) {
+	if isCancelling(&pr.Status) {
+		return
+	}
+	jHandler := &jenkinsHandler{&r.JenkinsCore}
+	if err = jHandler.stopJenkinsJob(pr); err != nil {
+		r.recorder.Eventf(pr, corev1.EventTypeWarning, v1alpha3.CancelFailed, "Failed to cancel PipelineRun %s/%s, and error was %v", pr.Namespace, pr.Name, err)
+		return
+	}
+
+	status := cancellingStatus(&pr.Status)
+	if err = r.updateStatus(ctx, status, client.ObjectKeyFromObject(pr)); err == nil {
+		pr.Status = *status
+		r.recorder.Eventf(pr, corev1.EventTypeNormal, v1alpha3.Cancelling, "Requested to stop the build of PipelineRun %s/%s", pr.Namespace, pr.Name)
+	}
+	return
+}
+
+// cancelPipelineRun marks the PipelineRun which has not started as cancelled.
+func (r *Reconciler) cancelPipelineRun(ctx context.Context, pr *v1alpha3.PipelineRun) (err error) {
+	reason := string(v1alpha3.Cancelled)
+	status := cancelledStatus(&pr.Status, reason, "the PipelineRun was cancelled")
+	if err = r.updateStatus(ctx, status, client.ObjectKeyFromObject(pr)); err == nil {
+		r.recorder.Eventf(pr, corev1.EventTypeNormal, reason, "Cancelled PipelineRun %s/%s", pr.Namespace, pr.Name)
+	}
+	return
+}
+
 func (r *Reconciler) getOrCreateJenkinsCore(annotations map[string]string) (*core.JenkinsCore, error) {
 	creator, ok := annotations[v1alpha3.PipelineRunCreatorAnnoKey]
 	if !ok || creator == "" {
@@ -389,5 +552,22 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.log = ctrl.Log.WithName("pipelinerun-controller")
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha3.PipelineRun{}).
+		WithEventFilter(pipelineRunEventPredicate()).
 		Complete(r)
 }
+
+// pipelineRunEventPredicate filters out the updates made by the controller itself, such as status and running data.
+// Only the spec changes, deletion and events from Jenkins could trigger the reconciliation.
+func pipelineRunEventPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectOld == nil || e.ObjectNew == nil {
+				return false
+			}
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+				!e.ObjectNew.GetDeletionTimestamp().IsZero() ||
+				e.ObjectOld.GetAnnotations()[v1alpha3.JenkinsPipelineRunEventAnnoKey] !=
+					e.ObjectNew.GetAnnotations()[v1alpha3.JenkinsPipelineRunEventAnnoKey]
+		},
+	}
+}
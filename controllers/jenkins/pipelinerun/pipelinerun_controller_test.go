@@ -25,6 +25,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -35,12 +36,17 @@ import (
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/client/clientset/versioned/scheme"
 	"kubesphere.io/devops/pkg/jwt/token"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"reflect"
 	controllerruntime "sigs.k8s.io/controller-runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"testing"
+	"time"
 	// nolint
 	// The fakeclient will undeprecated starting with v0.7.0
 	// Reference:
@@ -497,7 +503,7 @@ func TestStorePipelineRunData(t *testing.T) {
 		log:                  logr.New(log.NullLogSink{}),
 		PipelineRunDataStore: "fake",
 	}
-	assert.NotNil(t, r.storePipelineRunData("", pipelineRun.DeepCopy()))
+	assert.NotNil(t, r.storePipelineRunData("", "", pipelineRun.DeepCopy()))
 
 	r = &Reconciler{
 		Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(pipelineRun.DeepCopy()).Build(),
@@ -507,12 +513,204 @@ func TestStorePipelineRunData(t *testing.T) {
 		},
 		PipelineRunDataStore: "configmap",
 	}
-	assert.Nil(t, r.storePipelineRunData("", pipelineRun.DeepCopy()))
+	assert.Nil(t, r.storePipelineRunData("", "", pipelineRun.DeepCopy()))
 
 	r = &Reconciler{
 		Client:               fake.NewClientBuilder().WithScheme(schema).WithObjects(pipelineRun.DeepCopy()).Build(),
 		log:                  logr.New(log.NullLogSink{}),
 		PipelineRunDataStore: "",
 	}
-	assert.Nil(t, r.storePipelineRunData("", pipelineRun.DeepCopy()))
+	assert.Nil(t, r.storePipelineRunData("", "", pipelineRun.DeepCopy()))
+
+	dataDir, err := ioutil.TempDir("", "pipelineruns")
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(dataDir)
+	}()
+	r = &Reconciler{
+		Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(pipelineRun.DeepCopy()).Build(),
+		log:    logr.New(log.NullLogSink{}),
+		req: ctrl.Request{
+			NamespacedName: types.NamespacedName{Name: "name", Namespace: "ns"},
+		},
+		PipelineRunDataStore: "filesystem",
+		PipelineRunDataDir:   dataDir,
+	}
+	assert.Nil(t, r.storePipelineRunData("[]", "log", pipelineRun.DeepCopy()))
+	dataStore, err := r.getDataStoreFactory().New(r.ctx, r.req.NamespacedName)
+	assert.Nil(t, err)
+	assert.Equal(t, "[]", dataStore.GetStages())
+	assert.Equal(t, "log", dataStore.GetAllLog())
+
+	assert.Nil(t, r.deletePipelineRunData(pipelineRun.DeepCopy()))
+	dataStore, err = r.getDataStoreFactory().New(r.ctx, r.req.NamespacedName)
+	assert.Nil(t, err)
+	assert.Empty(t, dataStore.Keys())
+}
+
+func TestReconciler_pollInterval(t *testing.T) {
+	startedAt := func(duration time.Duration) *v1alpha3.PipelineRunStatus {
+		return &v1alpha3.PipelineRunStatus{StartTime: &metav1.Time{Time: time.Now().Add(-duration)}}
+	}
+	tests := []struct {
+		name       string
+		reconciler *Reconciler
+		status     *v1alpha3.PipelineRunStatus
+		want       time.Duration
+	}{{
+		name:       "nil status",
+		reconciler: &Reconciler{},
+		status:     nil,
+		want:       defaultMinPollInterval,
+	}, {
+		name:       "not started yet",
+		reconciler: &Reconciler{},
+		status:     &v1alpha3.PipelineRunStatus{},
+		want:       defaultMinPollInterval,
+	}, {
+		name:       "just started",
+		reconciler: &Reconciler{},
+		status:     startedAt(time.Second),
+		want:       defaultMinPollInterval,
+	}, {
+		name:       "running for a long time",
+		reconciler: &Reconciler{},
+		status:     startedAt(24 * time.Hour),
+		want:       defaultMaxPollInterval,
+	}, {
+		name:       "customized intervals",
+		reconciler: &Reconciler{MinPollInterval: time.Second, MaxPollInterval: time.Minute},
+		status:     startedAt(time.Hour),
+		want:       time.Minute,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.reconciler.pollInterval(tt.status))
+		})
+	}
+
+	interval := (&Reconciler{}).pollInterval(startedAt(4 * time.Minute))
+	assert.True(t, interval > defaultMinPollInterval && interval < defaultMaxPollInterval)
+}
+
+func Test_pipelineRunEventPredicate(t *testing.T) {
+	createPipelineRun := func(generation int64, eventType string) *v1alpha3.PipelineRun {
+		pipelineRun := &v1alpha3.PipelineRun{}
+		pipelineRun.SetGeneration(generation)
+		pipelineRun.SetAnnotations(map[string]string{
+			v1alpha3.JenkinsPipelineRunEventAnnoKey: eventType,
+		})
+		return pipelineRun
+	}
+	deleting := createPipelineRun(1, "")
+	deleting.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+
+	tests := []struct {
+		name   string
+		oldObj client.Object
+		newObj client.Object
+		want   bool
+	}{{
+		name:   "status or running data changed only",
+		oldObj: createPipelineRun(1, ""),
+		newObj: createPipelineRun(1, ""),
+		want:   false,
+	}, {
+		name:   "spec changed",
+		oldObj: createPipelineRun(1, ""),
+		newObj: createPipelineRun(2, ""),
+		want:   true,
+	}, {
+		name:   "received a new event from Jenkins",
+		oldObj: createPipelineRun(1, "run.started"),
+		newObj: createPipelineRun(1, "run.completed"),
+		want:   true,
+	}, {
+		name:   "being deleted",
+		oldObj: createPipelineRun(1, ""),
+		newObj: deleting,
+		want:   true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pipelineRunEventPredicate().Update(event.UpdateEvent{
+				ObjectOld: tt.oldObj,
+				ObjectNew: tt.newObj,
+			}))
+		})
+	}
+	assert.True(t, pipelineRunEventPredicate().Create(event.CreateEvent{Object: createPipelineRun(1, "")}))
+}
+
+func TestReconciler_cancelPipelineRun(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	pipelineRun := &v1alpha3.PipelineRun{}
+	pipelineRun.SetName("name")
+	pipelineRun.SetNamespace("ns")
+	pipelineRun.Spec.CancelRequested = true
+	pipelineRun.Spec.PipelineRef = &v1.ObjectReference{Name: "pipeline"}
+
+	r := &Reconciler{
+		Client:   fake.NewClientBuilder().WithScheme(schema).WithObjects(pipelineRun.DeepCopy()).Build(),
+		log:      logr.New(log.NullLogSink{}),
+		recorder: &record.FakeRecorder{},
+	}
+	_, err = r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "ns", Name: "name"},
+	})
+	assert.Nil(t, err)
+
+	pr := &v1alpha3.PipelineRun{}
+	assert.Nil(t, r.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: "name"}, pr))
+	assert.Equal(t, v1alpha3.Cancelled, pr.Status.Phase)
+	assert.True(t, pr.HasCompleted())
+	if assert.NotNil(t, pr.Status.GetLatestCondition()) {
+		assert.Equal(t, string(v1alpha3.Cancelled), pr.Status.GetLatestCondition().Reason)
+	}
+}
+
+func TestReconciler_stopPipelineRun(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	var stopped int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/crumbIssuer/api/json":
+			_, _ = w.Write([]byte(`{"crumbRequestField":"CrumbRequestField","crumb":"Crumb"}`))
+		case "/job/ns/job/pipeline/2/stop":
+			stopped++
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	pipelineRun := &v1alpha3.PipelineRun{}
+	pipelineRun.SetName("name")
+	pipelineRun.SetNamespace("ns")
+	pipelineRun.SetAnnotations(map[string]string{v1alpha3.JenkinsPipelineRunIDAnnoKey: "2"})
+	pipelineRun.Spec.CancelRequested = true
+	pipelineRun.Spec.PipelineRef = &v1.ObjectReference{Name: "pipeline"}
+
+	r := &Reconciler{
+		Client:      fake.NewClientBuilder().WithScheme(schema).WithObjects(pipelineRun.DeepCopy()).Build(),
+		JenkinsCore: core.JenkinsCore{URL: server.URL},
+		log:         logr.New(log.NullLogSink{}),
+		recorder:    &record.FakeRecorder{},
+	}
+	assert.Nil(t, r.stopPipelineRun(context.Background(), pipelineRun))
+	assert.Equal(t, 1, stopped)
+
+	// it's cancelling instead of cancelled until Jenkins aborts the build
+	pr := &v1alpha3.PipelineRun{}
+	assert.Nil(t, r.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: "name"}, pr))
+	assert.False(t, pr.HasCompleted())
+	assert.True(t, isCancelling(&pr.Status))
+
+	// the build is only stopped once
+	assert.Nil(t, r.stopPipelineRun(context.Background(), pr))
+	assert.Equal(t, 1, stopped)
 }
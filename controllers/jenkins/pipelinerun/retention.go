@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/jenkins-zh/jenkins-client/pkg/core"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
+	"kubesphere.io/devops/pkg/utils/sliceutil"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// pruneReasonNumToKeep indicates that a PipelineRun is pruned due to there are too many PipelineRuns
+	pruneReasonNumToKeep = "num_to_keep"
+	// pruneReasonDaysToKeep indicates that a PipelineRun is pruned due to it's too old
+	pruneReasonDaysToKeep = "days_to_keep"
+)
+
+var (
+	prunedPipelineRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devops_pipelinerun_retention_pruned_total",
+		Help: "Total number of PipelineRuns pruned by the retention policy of Pipelines",
+	}, []string{"namespace", "pipeline", "reason"})
+	pruneFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devops_pipelinerun_retention_failures_total",
+		Help: "Total number of failures when pruning PipelineRuns by the retention policy of Pipelines",
+	}, []string{"namespace", "pipeline"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(prunedPipelineRunsTotal, pruneFailuresTotal)
+}
+
+// retentionPolicy is parsed from the discarder of a Pipeline, zero means no limit.
+type retentionPolicy struct {
+	numToKeep  int
+	daysToKeep int
+}
+
+// newRetentionPolicy parses the discarder, an invalid or negative value means no limit like Jenkins does
+func newRetentionPolicy(discarder *v1alpha3.DiscarderProperty) (policy retentionPolicy) {
+	if discarder == nil {
+		return
+	}
+	if num, err := strconv.Atoi(discarder.NumToKeep); err == nil && num > 0 {
+		policy.numToKeep = num
+	}
+	if days, err := strconv.Atoi(discarder.DaysToKeep); err == nil && days > 0 {
+		policy.daysToKeep = days
+	}
+	return
+}
+
+func (p retentionPolicy) isEmpty() bool {
+	return p.numToKeep == 0 && p.daysToKeep == 0
+}
+
+// pipelineRunToPrune is a PipelineRun which should be pruned with the reason
+type pipelineRunToPrune struct {
+	pipelineRun v1alpha3.PipelineRun
+	reason      string
+}
+
+// selectPipelineRunsToPrune selects the completed PipelineRuns which are out of the retention policy.
+// The policy is applied to each branch separately like Jenkins does, and the last successful PipelineRun
+// of each branch is always kept. It returns the time when the next PipelineRun expires as well.
+func selectPipelineRunsToPrune(policy retentionPolicy, pipelineRuns []v1alpha3.PipelineRun, now time.Time) (
+	toPrune []pipelineRunToPrune, nextExpiry *time.Time) {
+	branches := map[string][]v1alpha3.PipelineRun{}
+	for i := range pipelineRuns {
+		item := pipelineRuns[i]
+		if !item.HasCompleted() || !item.DeletionTimestamp.IsZero() {
+			continue
+		}
+		refName := item.GetRefName()
+		branches[refName] = append(branches[refName], item)
+	}
+
+	refNames := make([]string, 0, len(branches))
+	for refName := range branches {
+		refNames = append(refNames, refName)
+	}
+	sort.Strings(refNames)
+
+	for _, refName := range refNames {
+		runs := branches[refName]
+		// the newest one comes first
+		sort.Slice(runs, func(i, j int) bool {
+			return createdBefore(&runs[j], &runs[i])
+		})
+
+		lastSuccessful := ""
+		for i := range runs {
+			if runs[i].Status.Phase == v1alpha3.Succeeded {
+				lastSuccessful = runs[i].Name
+				break
+			}
+		}
+
+		for i := range runs {
+			run := runs[i]
+			reason := ""
+			expiry := run.Status.CompletionTime.Add(time.Duration(policy.daysToKeep) * 24 * time.Hour)
+			if policy.numToKeep > 0 && i >= policy.numToKeep {
+				reason = pruneReasonNumToKeep
+			} else if policy.daysToKeep > 0 && !expiry.After(now) {
+				reason = pruneReasonDaysToKeep
+			}
+
+			if run.Name == lastSuccessful {
+				continue
+			}
+			if reason != "" {
+				toPrune = append(toPrune, pipelineRunToPrune{pipelineRun: run, reason: reason})
+			} else if policy.daysToKeep > 0 && (nextExpiry == nil || expiry.Before(*nextExpiry)) {
+				nextExpiry = &expiry
+			}
+		}
+	}
+	return
+}
+
+// RetentionReconciler deletes the PipelineRuns which are out of the retention policy of their Pipeline.
+// The retention policy comes from the discarder of the Pipeline.
+type RetentionReconciler struct {
+	client.Client
+	log              logr.Logger
+	recorder         record.EventRecorder
+	JenkinsCore      core.JenkinsCore
+	DataStoreFactory *storefactory.Factory
+}
+
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=pipelines,verbs=get;list;watch
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=pipelineruns,verbs=get;list;watch;delete
+
+// Reconcile prunes the PipelineRuns of a Pipeline
+func (r *RetentionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.log.WithValues("Pipeline", req.NamespacedName)
+	pipeline := &v1alpha3.Pipeline{}
+	if err := r.Get(ctx, req.NamespacedName, pipeline); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !pipeline.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	policy := newRetentionPolicy(pipeline.Spec.GetDiscarder())
+	if policy.isEmpty() {
+		return ctrl.Result{}, nil
+	}
+
+	pipelineRuns := &v1alpha3.PipelineRunList{}
+	if err := r.List(ctx, pipelineRuns, client.InNamespace(pipeline.Namespace),
+		client.MatchingLabels{v1alpha3.PipelineNameLabelKey: pipeline.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := time.Now()
+	toPrune, nextExpiry := selectPipelineRunsToPrune(policy, pipelineRuns.Items, now)
+	for i := range toPrune {
+		run := &toPrune[i].pipelineRun
+		if err := r.prunePipelineRun(ctx, run); err != nil {
+			log.Error(err, "unable to prune PipelineRun", "PipelineRun", run.Name)
+			pruneFailuresTotal.WithLabelValues(pipeline.Namespace, pipeline.Name).Inc()
+			r.recorder.Eventf(pipeline, corev1.EventTypeWarning, v1alpha3.PruneFailed,
+				"Failed to prune PipelineRun %s, error: %v", run.Name, err)
+			return ctrl.Result{}, err
+		}
+		prunedPipelineRunsTotal.WithLabelValues(pipeline.Namespace, pipeline.Name, toPrune[i].reason).Inc()
+		r.recorder.Eventf(pipeline, corev1.EventTypeNormal, v1alpha3.Pruned,
+			"Pruned PipelineRun %s due to %s", run.Name, toPrune[i].reason)
+	}
+
+	if nextExpiry != nil {
+		// check it again once the next PipelineRun expires
+		return ctrl.Result{RequeueAfter: nextExpiry.Sub(now) + time.Second}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// prunePipelineRun deletes the PipelineRun together with its Jenkins build and data.
+// The PipelineRun reconciler cleans them up if the PipelineRun has the finalizer,
+// but the PipelineRuns synchronized from Jenkins might not have it.
+func (r *RetentionReconciler) prunePipelineRun(ctx context.Context, pipelineRun *v1alpha3.PipelineRun) (err error) {
+	if !sliceutil.HasString(pipelineRun.Finalizers, v1alpha3.PipelineRunFinalizerName) {
+		jHandler := &jenkinsHandler{&r.JenkinsCore}
+		if err = jHandler.deleteJenkinsJobHistory(pipelineRun); err != nil {
+			return
+		}
+		if r.DataStoreFactory != nil && r.DataStoreFactory.Type != storefactory.TypeAnnotation {
+			dataStore, storeErr := r.DataStoreFactory.New(ctx, client.ObjectKeyFromObject(pipelineRun))
+			if storeErr == nil {
+				storeErr = dataStore.Delete()
+			}
+			if storeErr != nil {
+				// the data is not important enough to block the pruning
+				r.log.Error(storeErr, "unable to delete the data of PipelineRun", "PipelineRun", client.ObjectKeyFromObject(pipelineRun))
+			}
+		}
+	}
+	return client.IgnoreNotFound(r.Delete(ctx, pipelineRun))
+}
+
+// SetupWithManager setups the reconciler with a manager
+func (r *RetentionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("pipelinerun-retention")
+	r.log = ctrl.Log.WithName("pipelinerun-retention")
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pipelinerun_retention_controller").
+		For(&v1alpha3.Pipeline{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &v1alpha3.PipelineRun{}},
+			handler.EnqueueRequestsFromMapFunc(pipelineOfPipelineRun),
+			builder.WithPredicates(pipelineRunCompletedPredicate())).
+		Complete(r)
+}
+
+// pipelineOfPipelineRun maps a PipelineRun to its Pipeline
+func pipelineOfPipelineRun(obj client.Object) []reconcile.Request {
+	pipelineName := obj.GetLabels()[v1alpha3.PipelineNameLabelKey]
+	if pipelineName == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: pipelineName},
+	}}
+}
+
+// pipelineRunCompletedPredicate only accepts the PipelineRuns which just completed or created as completed
+func pipelineRunCompletedPredicate() predicate.Predicate {
+	hasCompleted := func(obj client.Object) bool {
+		pr, ok := obj.(*v1alpha3.PipelineRun)
+		return ok && pr.HasCompleted()
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return hasCompleted(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !hasCompleted(e.ObjectOld) && hasCompleted(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newRetentionTestPipelineRun(name string, completed time.Time, phase v1alpha3.RunPhase, refName string) v1alpha3.PipelineRun {
+	pr := newConcurrencyTestPipelineRun(name, completed.Add(-time.Minute), "1", refName)
+	if !completed.IsZero() {
+		pr.Status.CompletionTime = &metav1.Time{Time: completed}
+	}
+	pr.Status.Phase = phase
+	return pr
+}
+
+func Test_newRetentionPolicy(t *testing.T) {
+	tests := []struct {
+		name      string
+		discarder *v1alpha3.DiscarderProperty
+		want      retentionPolicy
+	}{{
+		name: "nil discarder",
+	}, {
+		name:      "valid discarder",
+		discarder: &v1alpha3.DiscarderProperty{DaysToKeep: "7", NumToKeep: "10"},
+		want:      retentionPolicy{numToKeep: 10, daysToKeep: 7},
+	}, {
+		name:      "no limits",
+		discarder: &v1alpha3.DiscarderProperty{DaysToKeep: "-1", NumToKeep: "invalid"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newRetentionPolicy(tt.discarder))
+		})
+	}
+}
+
+func Test_selectPipelineRunsToPrune(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name           string
+		policy         retentionPolicy
+		pipelineRuns   []v1alpha3.PipelineRun
+		wantPruned     map[string]string
+		wantNextExpiry *time.Time
+	}{{
+		name:   "keep the number of PipelineRuns",
+		policy: retentionPolicy{numToKeep: 2},
+		pipelineRuns: []v1alpha3.PipelineRun{
+			newRetentionTestPipelineRun("run-1", now.Add(-3*time.Hour), v1alpha3.Failed, ""),
+			newRetentionTestPipelineRun("run-2", now.Add(-2*time.Hour), v1alpha3.Failed, ""),
+			newRetentionTestPipelineRun("run-3", now.Add(-time.Hour), v1alpha3.Failed, ""),
+			newRetentionTestPipelineRun("run-4", time.Time{}, v1alpha3.Running, ""),
+		},
+		wantPruned: map[string]string{"run-1": pruneReasonNumToKeep},
+	}, {
+		name:   "keep the PipelineRuns for some days",
+		policy: retentionPolicy{daysToKeep: 2},
+		pipelineRuns: []v1alpha3.PipelineRun{
+			newRetentionTestPipelineRun("run-1", now.Add(-3*day), v1alpha3.Failed, ""),
+			newRetentionTestPipelineRun("run-2", now.Add(-day), v1alpha3.Failed, ""),
+			newRetentionTestPipelineRun("run-3", now.Add(-time.Hour), v1alpha3.Failed, ""),
+		},
+		wantPruned:     map[string]string{"run-1": pruneReasonDaysToKeep},
+		wantNextExpiry: timePtr(now.Add(day)),
+	}, {
+		name:   "always keep the last successful PipelineRun",
+		policy: retentionPolicy{numToKeep: 1, daysToKeep: 1},
+		pipelineRuns: []v1alpha3.PipelineRun{
+			newRetentionTestPipelineRun("run-1", now.Add(-3*day), v1alpha3.Succeeded, ""),
+			newRetentionTestPipelineRun("run-2", now.Add(-2*day), v1alpha3.Succeeded, ""),
+			newRetentionTestPipelineRun("run-3", now.Add(-time.Hour), v1alpha3.Failed, ""),
+		},
+		wantPruned:     map[string]string{"run-1": pruneReasonNumToKeep},
+		wantNextExpiry: timePtr(now.Add(-time.Hour + day)),
+	}, {
+		name:   "apply the policy to each branch",
+		policy: retentionPolicy{numToKeep: 1},
+		pipelineRuns: []v1alpha3.PipelineRun{
+			newRetentionTestPipelineRun("master-1", now.Add(-3*time.Hour), v1alpha3.Failed, "master"),
+			newRetentionTestPipelineRun("master-2", now.Add(-2*time.Hour), v1alpha3.Failed, "master"),
+			newRetentionTestPipelineRun("dev-1", now.Add(-3*time.Hour), v1alpha3.Succeeded, "dev"),
+			newRetentionTestPipelineRun("dev-2", now.Add(-2*time.Hour), v1alpha3.Failed, "dev"),
+		},
+		wantPruned: map[string]string{"master-1": pruneReasonNumToKeep},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toPrune, nextExpiry := selectPipelineRunsToPrune(tt.policy, tt.pipelineRuns, now)
+			pruned := map[string]string{}
+			for _, item := range toPrune {
+				pruned[item.pipelineRun.Name] = item.reason
+			}
+			assert.Equal(t, tt.wantPruned, pruned)
+			if tt.wantNextExpiry == nil {
+				assert.Nil(t, nextExpiry)
+			} else if assert.NotNil(t, nextExpiry) {
+				assert.WithinDuration(t, *tt.wantNextExpiry, *nextExpiry, time.Second)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestRetentionReconciler_Reconcile(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	now := time.Now()
+	pipeline := &v1alpha3.Pipeline{
+		ObjectMeta: metav1.ObjectMeta{Name: "retention", Namespace: "ns"},
+		Spec: v1alpha3.PipelineSpec{
+			Type: v1alpha3.NoScmPipelineType,
+			Pipeline: &v1alpha3.NoScmPipeline{
+				Discarder: &v1alpha3.DiscarderProperty{NumToKeep: "1", DaysToKeep: "7"},
+			},
+		},
+	}
+	old := newRetentionTestPipelineRun("old", now.Add(-2*time.Hour), v1alpha3.Failed, "")
+	// a PipelineRun synchronized from Jenkins without the finalizer and run ID
+	old.Annotations = nil
+	latest := newRetentionTestPipelineRun("latest", now.Add(-time.Hour), v1alpha3.Failed, "")
+	for _, pr := range []*v1alpha3.PipelineRun{&old, &latest} {
+		pr.Labels[v1alpha3.PipelineNameLabelKey] = pipeline.Name
+	}
+
+	c := fake.NewClientBuilder().WithScheme(schema).WithObjects(pipeline, old.DeepCopy(), latest.DeepCopy()).Build()
+	r := &RetentionReconciler{
+		Client:   c,
+		log:      logr.New(log.NullLogSink{}),
+		recorder: &record.FakeRecorder{},
+	}
+	prunedBefore := testutil.ToFloat64(prunedPipelineRunsTotal.WithLabelValues("ns", pipeline.Name, pruneReasonNumToKeep))
+
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pipeline)})
+	assert.Nil(t, err)
+	assert.True(t, result.RequeueAfter > 0)
+	assert.True(t, apierrors.IsNotFound(c.Get(context.Background(), client.ObjectKeyFromObject(&old), &v1alpha3.PipelineRun{})))
+	assert.Nil(t, c.Get(context.Background(), client.ObjectKeyFromObject(&latest), &v1alpha3.PipelineRun{}))
+	assert.Equal(t, prunedBefore+1, testutil.ToFloat64(prunedPipelineRunsTotal.WithLabelValues("ns", pipeline.Name, pruneReasonNumToKeep)))
+
+	// nothing to do without the retention policy
+	pipeline.Spec.Pipeline.Discarder = nil
+	assert.Nil(t, c.Update(context.Background(), pipeline))
+	result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pipeline)})
+	assert.Nil(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	// the Pipeline does not exist
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "ns", Name: "fake"}})
+	assert.Nil(t, err)
+}
+
+func Test_pipelineOfPipelineRun(t *testing.T) {
+	pr := newConcurrencyTestPipelineRun("run", time.Now(), "", "")
+	requests := pipelineOfPipelineRun(&pr)
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, client.ObjectKey{Namespace: "ns", Name: "pipeline"}, requests[0].NamespacedName)
+	}
+
+	pr.Labels = nil
+	assert.Empty(t, pipelineOfPipelineRun(&pr))
+}
+
+func Test_pipelineRunCompletedPredicate(t *testing.T) {
+	running := newRetentionTestPipelineRun("run", time.Time{}, v1alpha3.Running, "")
+	completed := newRetentionTestPipelineRun("run", time.Now(), v1alpha3.Succeeded, "")
+
+	p := pipelineRunCompletedPredicate()
+	assert.True(t, p.Create(event.CreateEvent{Object: &completed}))
+	assert.False(t, p.Create(event.CreateEvent{Object: &running}))
+	assert.True(t, p.Update(event.UpdateEvent{ObjectOld: &running, ObjectNew: &completed}))
+	assert.False(t, p.Update(event.UpdateEvent{ObjectOld: &completed, ObjectNew: &completed}))
+	assert.False(t, p.Delete(event.DeleteEvent{Object: &completed}))
+}
@@ -142,7 +142,7 @@ func (pbApplier pipelineBuildApplier) whenPipelineRunFinished(condition *v1alpha
 		prStatus.Phase = v1alpha3.Unknown
 	case Aborted.String():
 		condition.Status = v1alpha3.ConditionFalse
-		prStatus.Phase = v1alpha3.Failed
+		prStatus.Phase = v1alpha3.Cancelled
 	}
 }
 
@@ -161,3 +161,23 @@ func (converter parameterConverter) convert() []job.Parameter {
 	}
 	return params
 }
+
+// getJenkinsRefName returns the SCM reference name which is a part of the Jenkins job path.
+// Only a multi-branch Pipeline has it, the SCM of other PipelineRuns is informational, like the ones triggered by webhooks.
+func getJenkinsRefName(prSpec *v1alpha3.PipelineRunSpec) string {
+	if prSpec.SCM == nil || (prSpec.PipelineSpec != nil && !prSpec.IsMultiBranchPipeline()) {
+		return ""
+	}
+	return prSpec.SCM.RefName
+}
+
+// getRestartStage returns the stage name and the Jenkins run ID from which the PipelineRun restarts.
+// The stage name is empty if the PipelineRun does not restart from a stage.
+func getRestartStage(pr *v1alpha3.PipelineRun) (stage, runID string) {
+	stage = pr.Annotations[v1alpha3.PipelineRunRestartStageAnnoKey]
+	runID = pr.Annotations[v1alpha3.PipelineRunRestartRunIDAnnoKey]
+	if stage == "" || runID == "" {
+		return "", ""
+	}
+	return
+}
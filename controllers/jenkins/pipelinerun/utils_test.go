@@ -262,7 +262,7 @@ func Test_pipelineBuildApplier_apply(t *testing.T) {
 			commonStatusAssert(prStatus)
 			assert.Equal(t, v1alpha3.ConditionFalse, prStatus.Conditions[0].Status)
 			assert.Equal(t, v1alpha3.ConditionSucceeded, prStatus.Conditions[0].Type)
-			assert.Equal(t, v1alpha3.Failed, prStatus.Phase)
+			assert.Equal(t, v1alpha3.Cancelled, prStatus.Phase)
 		},
 	}, {
 		name: "PipelineRun with new condition",
@@ -365,3 +365,36 @@ func Test_parameterConverter_convert(t *testing.T) {
 		})
 	}
 }
+
+func Test_getRestartStage(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantStage   string
+		wantRunID   string
+	}{{
+		name: "no annotations",
+	}, {
+		name: "no run ID",
+		annotations: map[string]string{
+			v1alpha3.PipelineRunRestartStageAnnoKey: "build",
+		},
+	}, {
+		name: "restart from a stage",
+		annotations: map[string]string{
+			v1alpha3.PipelineRunRestartStageAnnoKey: "build",
+			v1alpha3.PipelineRunRestartRunIDAnnoKey: "2",
+		},
+		wantStage: "build",
+		wantRunID: "2",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := &v1alpha3.PipelineRun{}
+			pr.Annotations = tt.annotations
+			stage, runID := getRestartStage(pr)
+			assert.Equal(t, tt.wantStage, stage)
+			assert.Equal(t, tt.wantRunID, runID)
+		})
+	}
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	apimeta "kubesphere.io/devops/pkg/external/fluxcd/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;list;watch
+
+// ApplicationReconciler exports the deployment frequency and lead time of the GitOps Applications of an engine
+type ApplicationReconciler struct {
+	client.Client
+	// Engine is the GitOps engine of the Applications which this controller takes care of
+	Engine v1alpha1.Engine
+
+	mutex  sync.Mutex
+	states map[types.NamespacedName]*applicationState
+	// now is used to get the current time, it's useful for testing
+	now func() time.Time
+}
+
+// deployment represents the last deployment of an Application, or one of its resources in FluxCD
+type deployment struct {
+	// target is the revision which is going to be deployed
+	target string
+	// revision is the revision of the last deployment
+	revision string
+	// finished indicates whether the last deployment is finished
+	finished bool
+	// finishedAt is the finish time of the deployment, zero value means unknown
+	finishedAt time.Time
+	// startedAt is the start time of the deployment, nil means unknown
+	startedAt *time.Time
+	succeeded bool
+}
+
+// identity distinguishes the deployments
+func (d deployment) identity() string {
+	return fmt.Sprintf("%s/%t/%s", d.revision, d.succeeded, d.finishedAt.Format(time.RFC3339))
+}
+
+type pendingRevision struct {
+	revision string
+	since    time.Time
+}
+
+type applicationState struct {
+	// deployments records the identity of the last deployment of each item
+	deployments map[string]string
+	// deployed records the last successfully deployed revision of each item
+	deployed map[string]string
+	// pending records the target revision of each item which is not deployed yet
+	pending map[string]pendingRevision
+}
+
+// Reconcile is the main entrypoint of this controller
+func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	app := &v1alpha1.Application{}
+	if err = r.Get(ctx, req.NamespacedName, app); err != nil {
+		if err = client.IgnoreNotFound(err); err == nil {
+			r.mutex.Lock()
+			delete(r.states, req.NamespacedName)
+			r.mutex.Unlock()
+		}
+		return
+	}
+	if app.Spec.Kind != r.Engine {
+		return
+	}
+
+	var deployments map[string]deployment
+	switch r.Engine {
+	case v1alpha1.ArgoCD:
+		deployments = getArgoCDDeployments(app)
+	case v1alpha1.FluxCD:
+		deployments = getFluxCDDeployments(app)
+	}
+	r.observe(req.NamespacedName, deployments)
+	return
+}
+
+func (r *ApplicationReconciler) observe(key types.NamespacedName, deployments map[string]deployment) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.states == nil {
+		r.states = map[types.NamespacedName]*applicationState{}
+	}
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+
+	state, exist := r.states[key]
+	if !exist {
+		state = &applicationState{
+			deployments: map[string]string{},
+			deployed:    map[string]string{},
+			pending:     map[string]pendingRevision{},
+		}
+		r.states[key] = state
+	}
+
+	engine := string(r.Engine)
+	for item, d := range deployments {
+		if !exist && d.finished && d.succeeded {
+			state.deployed[item] = d.revision
+		}
+		if d.target != "" && d.target != state.deployed[item] && state.pending[item].revision != d.target {
+			since := now
+			if d.startedAt != nil && d.revision == d.target && d.startedAt.Before(now) {
+				since = *d.startedAt
+			}
+			state.pending[item] = pendingRevision{revision: d.target, since: since}
+		}
+		if !d.finished {
+			continue
+		}
+
+		identity := d.identity()
+		last, known := state.deployments[item]
+		state.deployments[item] = identity
+		if d.succeeded {
+			state.deployed[item] = d.revision
+		}
+		if !exist {
+			// the deployments before the controller started are not counted
+			continue
+		}
+		if known && last == identity {
+			continue
+		}
+
+		result := resultFailed
+		if d.succeeded {
+			result = resultSucceeded
+		}
+		applicationDeploymentsTotal.WithLabelValues(key.Namespace, key.Name, engine, result).Inc()
+
+		if pending, ok := state.pending[item]; ok && d.succeeded && pending.revision == d.revision {
+			deployedAt := d.finishedAt
+			if deployedAt.IsZero() || deployedAt.Before(pending.since) {
+				deployedAt = now
+			}
+			applicationLeadTime.WithLabelValues(key.Namespace, key.Name, engine).Observe(nonNegativeSeconds(deployedAt.Sub(pending.since)))
+			delete(state.pending, item)
+		}
+	}
+}
+
+// argoStatus contains the fields of an ArgoCD Application status which are required by the metrics
+type argoStatus struct {
+	Sync struct {
+		Revision string `json:"revision"`
+	} `json:"sync"`
+	OperationState *struct {
+		Phase      string       `json:"phase"`
+		StartedAt  *metav1.Time `json:"startedAt"`
+		FinishedAt *metav1.Time `json:"finishedAt"`
+		SyncResult *struct {
+			Revision string `json:"revision"`
+		} `json:"syncResult"`
+	} `json:"operationState"`
+}
+
+func getArgoCDDeployments(app *v1alpha1.Application) (deployments map[string]deployment) {
+	deployments = map[string]deployment{}
+	status := &argoStatus{}
+	if app.Status.ArgoApp == "" || json.Unmarshal([]byte(app.Status.ArgoApp), status) != nil {
+		return
+	}
+
+	d := deployment{target: status.Sync.Revision}
+	if op := status.OperationState; op != nil {
+		if op.SyncResult != nil {
+			d.revision = op.SyncResult.Revision
+		}
+		if op.StartedAt != nil {
+			d.startedAt = &op.StartedAt.Time
+		}
+		if op.FinishedAt != nil {
+			d.finished = true
+			d.finishedAt = op.FinishedAt.Time
+			d.succeeded = op.Phase == "Succeeded"
+		}
+	}
+	deployments[""] = d
+	return
+}
+
+func getFluxCDDeployments(app *v1alpha1.Application) (deployments map[string]deployment) {
+	deployments = map[string]deployment{}
+	for name, status := range app.Status.FluxApp.HelmReleaseStatus {
+		if status != nil {
+			deployments["helmrelease/"+name] = newFluxCDDeployment(status.LastAttemptedRevision, status.LastAppliedRevision, status.Conditions)
+		}
+	}
+	for name, status := range app.Status.FluxApp.KustomizationStatus {
+		if status != nil {
+			deployments["kustomization/"+name] = newFluxCDDeployment(status.LastAttemptedRevision, status.LastAppliedRevision, status.Conditions)
+		}
+	}
+	return
+}
+
+// newFluxCDDeployment parses the deployment from the status of a HelmRelease or Kustomization.
+// The transition time of the Ready condition does not change when deploying new revisions successfully,
+// so the finish time of FluxCD deployments is unknown.
+func newFluxCDDeployment(attempted, applied string, conditions []metav1.Condition) (d deployment) {
+	d.target = attempted
+	ready := meta.FindStatusCondition(conditions, apimeta.ReadyCondition)
+	if ready == nil || ready.Status == metav1.ConditionUnknown {
+		return
+	}
+	d.finished = true
+	d.succeeded = ready.Status == metav1.ConditionTrue
+	if d.succeeded {
+		d.revision = applied
+	} else {
+		d.revision = attempted
+	}
+	return
+}
+
+// GetName returns the name of this controller
+func (r *ApplicationReconciler) GetName() string {
+	return "ApplicationMetricsController-" + string(r.Engine)
+}
+
+// SetupWithManager setups the controller with a filter of the GitOps engine
+func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(fmt.Sprintf("%s_application_metrics_controller", r.Engine)).
+		For(&v1alpha1.Application{}).
+		WithEventFilter(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			app, ok := object.(*v1alpha1.Application)
+			return ok && app.Spec.Kind == r.Engine
+		})).
+		Complete(r)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getArgoCDDeployments(t *testing.T) {
+	started := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	finished := metav1.NewTime(time.Date(2022, 1, 1, 0, 1, 0, 0, time.UTC))
+
+	tests := []struct {
+		name   string
+		status string
+		want   map[string]deployment
+	}{{
+		name: "empty status",
+		want: map[string]deployment{},
+	}, {
+		name:   "invalid status",
+		status: "invalid",
+		want:   map[string]deployment{},
+	}, {
+		name:   "out of sync",
+		status: `{"sync":{"revision":"new"}}`,
+		want:   map[string]deployment{"": {target: "new"}},
+	}, {
+		name: "succeeded",
+		status: `{"sync":{"revision":"new"},"operationState":{"phase":"Succeeded","startedAt":"2022-01-01T00:00:00Z",
+"finishedAt":"2022-01-01T00:01:00Z","syncResult":{"revision":"new"}}}`,
+		want: map[string]deployment{"": {
+			target:     "new",
+			revision:   "new",
+			finished:   true,
+			startedAt:  &started.Time,
+			finishedAt: finished.Time,
+			succeeded:  true,
+		}},
+	}, {
+		name:   "running",
+		status: `{"sync":{"revision":"new"},"operationState":{"phase":"Running","startedAt":"2022-01-01T00:00:00Z"}}`,
+		want:   map[string]deployment{"": {target: "new", startedAt: &started.Time}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &v1alpha1.Application{Status: v1alpha1.ApplicationStatus{ArgoApp: tt.status}}
+			got := getArgoCDDeployments(app)
+			assert.Equal(t, len(tt.want), len(got))
+			for key, want := range tt.want {
+				assert.Equal(t, want.identity(), got[key].identity())
+				assert.Equal(t, want.target, got[key].target)
+				assert.Equal(t, want.finished, got[key].finished)
+				assert.Equal(t, want.startedAt == nil, got[key].startedAt == nil)
+			}
+		})
+	}
+}
+
+func Test_getFluxCDDeployments(t *testing.T) {
+	app := &v1alpha1.Application{Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+		HelmReleaseStatus: map[string]*helmv2.HelmReleaseStatus{
+			"ready": {
+				LastAttemptedRevision: "v2",
+				LastAppliedRevision:   "v2",
+				Conditions:            []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue}},
+			},
+			"progressing": {
+				LastAttemptedRevision: "v3",
+				LastAppliedRevision:   "v2",
+				Conditions:            []metav1.Condition{{Type: "Ready", Status: metav1.ConditionUnknown}},
+			},
+		},
+		KustomizationStatus: map[string]*kusv1.KustomizationStatus{
+			"failed": {
+				LastAttemptedRevision: "main/b",
+				LastAppliedRevision:   "main/a",
+				Conditions:            []metav1.Condition{{Type: "Ready", Status: metav1.ConditionFalse}},
+			},
+		},
+	}}}
+
+	assert.Equal(t, map[string]deployment{
+		"helmrelease/ready":       {target: "v2", revision: "v2", finished: true, succeeded: true},
+		"helmrelease/progressing": {target: "v3"},
+		"kustomization/failed":    {target: "main/b", revision: "main/b", finished: true},
+	}, getFluxCDDeployments(app))
+}
+
+func TestApplicationReconciler_observe(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := &ApplicationReconciler{Engine: v1alpha1.FluxCD, now: func() time.Time {
+		return now
+	}}
+	key := types.NamespacedName{Namespace: "ns", Name: "observe"}
+	succeeded := func(revision string) map[string]deployment {
+		return map[string]deployment{"kustomization/app": {target: revision, revision: revision, finished: true, succeeded: true}}
+	}
+
+	// the deployment before the controller started is not counted
+	r.observe(key, succeeded("v1"))
+	assert.Equal(t, float64(0), testutil.ToFloat64(applicationDeploymentsTotal.WithLabelValues("ns", "observe", "fluxcd", resultSucceeded)))
+
+	// a new revision is going to be deployed
+	now = now.Add(time.Minute)
+	r.observe(key, map[string]deployment{"kustomization/app": {target: "v2"}})
+	now = now.Add(time.Minute)
+	r.observe(key, map[string]deployment{"kustomization/app": {target: "v2", revision: "v2", finished: true}})
+	now = now.Add(time.Minute)
+	r.observe(key, succeeded("v2"))
+	// observe the same deployment again
+	r.observe(key, succeeded("v2"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(applicationDeploymentsTotal.WithLabelValues("ns", "observe", "fluxcd", resultSucceeded)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(applicationDeploymentsTotal.WithLabelValues("ns", "observe", "fluxcd", resultFailed)))
+	assert.Equal(t, uint64(1), sampleCount(t, applicationLeadTime.WithLabelValues("ns", "observe", "fluxcd")))
+	assert.Empty(t, r.states[key].pending)
+}
+
+func TestApplicationReconciler_Reconcile(t *testing.T) {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "argo"},
+		Spec:       v1alpha1.ApplicationSpec{Kind: v1alpha1.ArgoCD},
+		Status: v1alpha1.ApplicationStatus{
+			ArgoApp: `{"sync":{"revision":"a"},"operationState":{"phase":"Succeeded","finishedAt":"2022-01-01T00:00:00Z","syncResult":{"revision":"a"}}}`,
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(schema).WithObjects(app).Build()
+	key := types.NamespacedName{Namespace: "ns", Name: "argo"}
+
+	// the Application of other engines is ignored
+	r := &ApplicationReconciler{Client: c, Engine: v1alpha1.FluxCD}
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err)
+	assert.Empty(t, r.states)
+
+	r = &ApplicationReconciler{Client: c, Engine: v1alpha1.ArgoCD}
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err)
+	assert.Equal(t, "a", r.states[key].deployed[""])
+
+	assert.Nil(t, c.Delete(context.Background(), app))
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err)
+	assert.Empty(t, r.states)
+	assert.Equal(t, "ApplicationMetricsController-argocd", r.GetName())
+}
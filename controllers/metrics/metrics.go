@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// resultSucceeded indicates a deployment was successful
+	resultSucceeded = "succeeded"
+	// resultFailed indicates a deployment was failed
+	resultFailed = "failed"
+)
+
+var (
+	pipelineRunsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devops_pipelinerun_total",
+		Help: "Total number of PipelineRuns which entered a phase",
+	}, []string{"namespace", "pipeline", "branch", "phase"})
+	pipelineRunQueueDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "devops_pipelinerun_queue_duration_seconds",
+		Help:    "Time between creating a PipelineRun and starting it in Jenkins",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"namespace", "pipeline", "branch"})
+	pipelineRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "devops_pipelinerun_duration_seconds",
+		Help:    "Time between starting and completing a PipelineRun",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 12),
+	}, []string{"namespace", "pipeline", "branch", "phase"})
+	pipelineFailureRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "devops_pipeline_failure_ratio",
+		Help: "Ratio of failed PipelineRuns to completed PipelineRuns of a Pipeline observed by this controller",
+	}, []string{"namespace", "pipeline"})
+
+	applicationDeploymentsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "devops_gitops_application_deployments_total",
+		Help: "Total number of deployments of GitOps Applications",
+	}, []string{"namespace", "application", "engine", "result"})
+	applicationLeadTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "devops_gitops_application_lead_time_seconds",
+		Help:    "Time between observing a new target revision of a GitOps Application and deploying it successfully",
+		Buckets: prometheus.ExponentialBuckets(10, 2, 14),
+	}, []string{"namespace", "application", "engine"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(pipelineRunsTotal, pipelineRunQueueDuration, pipelineRunDuration, pipelineFailureRatio,
+		applicationDeploymentsTotal, applicationLeadTime)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=pipelineruns,verbs=get;list;watch
+
+// PipelineRunReconciler exports the metrics of PipelineRuns according to their phase transitions
+type PipelineRunReconciler struct {
+	client.Client
+
+	// startTime is used to skip the PipelineRuns which were created before this controller
+	startTime time.Time
+	mutex     sync.Mutex
+	// observed records the last observed status of each PipelineRun
+	observed map[types.NamespacedName]observedPipelineRun
+	// completed counts the completed and failed PipelineRuns of each Pipeline
+	completed map[types.NamespacedName]*completedCount
+}
+
+type observedPipelineRun struct {
+	phase   v1alpha3.RunPhase
+	started bool
+}
+
+type completedCount struct {
+	total  int
+	failed int
+}
+
+// Reconcile is the main entrypoint of this controller
+func (r *PipelineRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	pr := &v1alpha3.PipelineRun{}
+	if err = r.Get(ctx, req.NamespacedName, pr); err != nil {
+		if err = client.IgnoreNotFound(err); err == nil {
+			r.mutex.Lock()
+			delete(r.observed, req.NamespacedName)
+			r.mutex.Unlock()
+		}
+		return
+	}
+	r.observe(pr)
+	return
+}
+
+func (r *PipelineRunReconciler) observe(pr *v1alpha3.PipelineRun) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.observed == nil {
+		r.observed = map[types.NamespacedName]observedPipelineRun{}
+	}
+
+	key := types.NamespacedName{Namespace: pr.Namespace, Name: pr.Name}
+	current := observedPipelineRun{phase: pr.Status.Phase, started: pr.Status.StartTime != nil}
+	last, exist := r.observed[key]
+	r.observed[key] = current
+	if !exist && pr.CreationTimestamp.Time.Before(r.startTime) {
+		// the transitions of this PipelineRun were counted before the controller restarted
+		return
+	}
+
+	pipeline := pr.Labels[v1alpha3.PipelineNameLabelKey]
+	branch := pr.GetRefName()
+	if current.started && !last.started {
+		queued := pr.Status.StartTime.Sub(pr.CreationTimestamp.Time)
+		pipelineRunQueueDuration.WithLabelValues(pr.Namespace, pipeline, branch).Observe(nonNegativeSeconds(queued))
+	}
+	if current.phase == "" || current.phase == last.phase {
+		return
+	}
+	pipelineRunsTotal.WithLabelValues(pr.Namespace, pipeline, branch, string(current.phase)).Inc()
+
+	if !pr.HasCompleted() {
+		return
+	}
+	if pr.Status.StartTime != nil && pr.Status.CompletionTime != nil {
+		duration := pr.Status.CompletionTime.Sub(pr.Status.StartTime.Time)
+		pipelineRunDuration.WithLabelValues(pr.Namespace, pipeline, branch, string(current.phase)).Observe(nonNegativeSeconds(duration))
+	}
+	if current.phase == v1alpha3.Succeeded || current.phase == v1alpha3.Failed {
+		r.updateFailureRatio(pr.Namespace, pipeline, current.phase == v1alpha3.Failed)
+	}
+}
+
+// updateFailureRatio updates the failure ratio of a Pipeline, the cancelled PipelineRuns are not taken into account
+func (r *PipelineRunReconciler) updateFailureRatio(namespace, pipeline string, failed bool) {
+	if r.completed == nil {
+		r.completed = map[types.NamespacedName]*completedCount{}
+	}
+	key := types.NamespacedName{Namespace: namespace, Name: pipeline}
+	count, ok := r.completed[key]
+	if !ok {
+		count = &completedCount{}
+		r.completed[key] = count
+	}
+	count.total++
+	if failed {
+		count.failed++
+	}
+	pipelineFailureRatio.WithLabelValues(namespace, pipeline).Set(float64(count.failed) / float64(count.total))
+}
+
+func nonNegativeSeconds(duration time.Duration) float64 {
+	if duration < 0 {
+		return 0
+	}
+	return duration.Seconds()
+}
+
+// GetName returns the name of this controller
+func (r *PipelineRunReconciler) GetName() string {
+	return "PipelineRunMetricsController"
+}
+
+// SetupWithManager records the start time and setups the controller
+func (r *PipelineRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.startTime = time.Now()
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("pipelinerun_metrics_controller").
+		For(&v1alpha3.PipelineRun{}).
+		Complete(r)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPipelineRunReconciler(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	now := time.Now()
+	pr := &v1alpha3.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "ns",
+			Name:              "run",
+			CreationTimestamp: metav1.NewTime(now.Add(time.Minute)),
+			Labels:            map[string]string{v1alpha3.PipelineNameLabelKey: "metrics"},
+		},
+		Spec: v1alpha3.PipelineRunSpec{
+			PipelineSpec: &v1alpha3.PipelineSpec{Type: v1alpha3.MultiBranchPipelineType},
+			SCM:          &v1alpha3.SCM{RefName: "master"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(schema).WithObjects(pr.DeepCopy()).Build()
+	r := &PipelineRunReconciler{Client: c, startTime: now}
+	key := types.NamespacedName{Namespace: "ns", Name: "run"}
+	reconcile := func(update func(pr *v1alpha3.PipelineRun)) {
+		current := &v1alpha3.PipelineRun{}
+		assert.Nil(t, c.Get(context.Background(), key, current))
+		if update != nil {
+			update(current)
+			assert.Nil(t, c.Update(context.Background(), current))
+		}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+		assert.Nil(t, err)
+	}
+
+	reconcile(func(pr *v1alpha3.PipelineRun) {
+		pr.Status.Phase = v1alpha3.Pending
+	})
+	reconcile(func(pr *v1alpha3.PipelineRun) {
+		pr.Status.Phase = v1alpha3.Running
+		pr.Status.StartTime = &metav1.Time{Time: now.Add(2 * time.Minute)}
+	})
+	// reconcile without any changes
+	reconcile(nil)
+	reconcile(func(pr *v1alpha3.PipelineRun) {
+		pr.Status.Phase = v1alpha3.Failed
+		pr.Status.CompletionTime = &metav1.Time{Time: now.Add(5 * time.Minute)}
+	})
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(pipelineRunsTotal.WithLabelValues("ns", "metrics", "master", "Pending")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(pipelineRunsTotal.WithLabelValues("ns", "metrics", "master", "Running")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(pipelineRunsTotal.WithLabelValues("ns", "metrics", "master", "Failed")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(pipelineFailureRatio.WithLabelValues("ns", "metrics")))
+	assert.Equal(t, uint64(1), sampleCount(t, pipelineRunQueueDuration.WithLabelValues("ns", "metrics", "master")))
+	assert.Equal(t, uint64(1), sampleCount(t, pipelineRunDuration.WithLabelValues("ns", "metrics", "master", "Failed")))
+
+	// the PipelineRun was deleted
+	assert.Nil(t, c.Delete(context.Background(), pr))
+	_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	assert.Nil(t, err)
+	assert.Empty(t, r.observed)
+}
+
+func sampleCount(t *testing.T, observer prometheus.Observer) uint64 {
+	metric := &dto.Metric{}
+	assert.Nil(t, observer.(prometheus.Metric).Write(metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestPipelineRunReconciler_skipExisting(t *testing.T) {
+	now := time.Now()
+	r := &PipelineRunReconciler{startTime: now}
+	pr := &v1alpha3.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "ns",
+			Name:              "run",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+			Labels:            map[string]string{v1alpha3.PipelineNameLabelKey: "existing"},
+		},
+		Status: v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running, StartTime: &metav1.Time{Time: now.Add(-time.Minute)}},
+	}
+	r.observe(pr)
+	assert.Equal(t, float64(0), testutil.ToFloat64(pipelineRunsTotal.WithLabelValues("ns", "existing", "", "Running")))
+
+	// the transitions after the controller started are counted
+	pr.Status.Phase = v1alpha3.Succeeded
+	pr.Status.CompletionTime = &metav1.Time{Time: now}
+	r.observe(pr)
+	assert.Equal(t, float64(1), testutil.ToFloat64(pipelineRunsTotal.WithLabelValues("ns", "existing", "", "Succeeded")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(pipelineFailureRatio.WithLabelValues("ns", "existing")))
+	assert.Equal(t, uint64(0), sampleCount(t, pipelineRunQueueDuration.WithLabelValues("ns", "existing", "")))
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	goscm "github.com/jenkins-x/go-scm/scm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=promotions,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=promotions/status,verbs=get;update
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=gitrepositories,verbs=get
+//+kubebuilder:rbac:groups=devops.kubesphere.io,resources=pipelineruns,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const groupName = "promotion"
+
+// gitRequeuePeriod is the period to refresh the values in the Git repositories
+const gitRequeuePeriod = 3 * time.Minute
+
+// Reconciler promotes the revisions of the Applications from one stage to the next once the gates pass
+type Reconciler struct {
+	client.Client
+	log      logr.Logger
+	recorder record.EventRecorder
+
+	// newGitClient creates the client to read and write the Git repository, it's for the test purpose
+	newGitClient func(repo *v1alpha3.GitRepository) (*goscm.Client, error)
+}
+
+// Reconcile checks the gates of each stage, and promotes the value of the previous stage
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	r.log.Info(fmt.Sprintf("start to reconcile promotion: %s", req.String()))
+
+	promotion := &v1alpha1.Promotion{}
+	if err = r.Get(ctx, req.NamespacedName, promotion); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+
+	statuses := make([]v1alpha1.PromotionStageStatus, len(promotion.Spec.Stages))
+	for i := range promotion.Spec.Stages {
+		statuses[i].Name = promotion.Spec.Stages[i].Name
+		if existing := getStageStatus(promotion.Status.Stages, statuses[i].Name); existing != nil {
+			statuses[i].Approval = existing.Approval
+			statuses[i].LastPromotion = existing.LastPromotion
+		}
+	}
+
+	if op := promotion.Spec.Operation; op != nil {
+		if stageStatus := getStageStatus(statuses, op.Stage); stageStatus != nil && op.Type == v1alpha1.PromotionOperationApprove {
+			stageStatus.Approval = op.DeepCopy()
+			r.recorder.Eventf(promotion, corev1.EventTypeNormal, "Approved", "%s was approved to be promoted to %s by %s",
+				op.Value, op.Stage, op.InitiatedBy.Username)
+		}
+
+		// the operation is handled, remove it from the spec
+		promotion.Spec.Operation = nil
+		if err = r.Update(ctx, promotion); err != nil {
+			return
+		}
+	}
+
+	var previous *stageState
+	for i := range promotion.Spec.Stages {
+		stage := &promotion.Spec.Stages[i]
+		state := &stageState{stage: stage, status: &statuses[i]}
+		r.reconcileStage(ctx, promotion, state, previous)
+		previous = state
+	}
+
+	promotion.Status.Stages = statuses
+	if err = r.Status().Update(ctx, promotion); err != nil {
+		return
+	}
+
+	for _, stage := range promotion.Spec.Stages {
+		if stage.Git != nil {
+			// the Git repositories are not watched, refresh the values periodically
+			result = ctrl.Result{RequeueAfter: gitRequeuePeriod}
+			break
+		}
+	}
+	return
+}
+
+// stageState is the intermediate state of a stage during the reconciling
+type stageState struct {
+	stage  *v1alpha1.PromotionStage
+	status *v1alpha1.PromotionStageStatus
+	app    *v1alpha1.Application
+	// promoted indicates the stage was promoted in this round, its Application is not deployed yet
+	promoted bool
+}
+
+func (r *Reconciler) reconcileStage(ctx context.Context, promotion *v1alpha1.Promotion, state, previous *stageState) {
+	status := state.status
+	state.app = &v1alpha1.Application{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: promotion.Namespace, Name: state.stage.Application.Name}, state.app); err != nil {
+		status.Phase = v1alpha1.PromotionPhaseFailed
+		status.Message = err.Error()
+		return
+	}
+
+	value, err := r.getStageValue(ctx, promotion, state.stage, state.app)
+	if err != nil {
+		status.Phase = v1alpha1.PromotionPhaseFailed
+		status.Message = err.Error()
+		return
+	}
+	status.Value = value.deployed
+	if previous == nil {
+		// it's the first stage, nothing to promote
+		return
+	}
+
+	source := previous.status.Value
+	switch {
+	case previous.status.Phase == v1alpha1.PromotionPhaseFailed || source == "":
+		status.Phase = v1alpha1.PromotionPhaseWaiting
+		status.Message = "the previous stage has no value to promote"
+		return
+	case source == value.desired:
+		status.Phase = v1alpha1.PromotionPhasePromoted
+		return
+	}
+
+	status.Pending = source
+	if message := r.checkGates(ctx, promotion, state, previous); message != "" {
+		status.Phase = v1alpha1.PromotionPhaseWaiting
+		status.Message = message
+		return
+	}
+	if gates := state.stage.Gates; gates != nil && gates.ManualApproval &&
+		(status.Approval == nil || status.Approval.Value != source) {
+		status.Phase = v1alpha1.PromotionPhaseWaitingForApproval
+		status.Message = fmt.Sprintf("%s is waiting for approval", source)
+		return
+	}
+
+	if err = r.promote(ctx, promotion, state.stage, source); err != nil {
+		r.recorder.Eventf(promotion, corev1.EventTypeWarning, "FailedPromote", "failed to promote %s to %s: %v",
+			source, state.stage.Name, err)
+		status.Phase = v1alpha1.PromotionPhaseFailed
+		status.Message = err.Error()
+		return
+	}
+	r.recorder.Eventf(promotion, corev1.EventTypeNormal, "Promoted", "%s was promoted to %s", source, state.stage.Name)
+	status.Phase = v1alpha1.PromotionPhasePromoted
+	status.Pending = ""
+	if state.stage.Git != nil {
+		status.Value = source
+	}
+	status.LastPromotion = &v1alpha1.PromotionRecord{Value: source, PromotedAt: metav1.Now()}
+	state.promoted = true
+}
+
+// checkGates returns the reason if any gate, except the manual approval, does not pass
+func (r *Reconciler) checkGates(ctx context.Context, promotion *v1alpha1.Promotion, state, previous *stageState) string {
+	if previous.promoted {
+		return "the previous stage was just promoted"
+	}
+	gates := state.stage.Gates
+	if gates == nil {
+		return ""
+	}
+
+	// the time when the previous stage was deployed, it's unknown if the stage has never been deployed
+	var deployedAt *metav1.Time
+	if lastOperation := previous.app.Status.LastOperation; lastOperation != nil {
+		deployedAt = lastOperation.FinishedAt
+	}
+
+	if gates.HealthyPreviousStage {
+		appStatus := previous.app.Status
+		if appStatus.SyncStatus != v1alpha1.SyncStatusSynced || appStatus.HealthStatus != v1alpha1.HealthStatusHealthy {
+			return fmt.Sprintf("the previous stage is not synced and healthy, the current status is %s and %s",
+				appStatus.SyncStatus, appStatus.HealthStatus)
+		}
+		if lastPromotion := previous.status.LastPromotion; lastPromotion != nil &&
+			(deployedAt == nil || deployedAt.Before(&lastPromotion.PromotedAt)) {
+			return "the previous stage is not deployed since the last promotion"
+		}
+	}
+
+	if gate := gates.PipelineRun; gate != nil {
+		pipelineRun, err := r.getLatestPipelineRun(ctx, promotion.Namespace, gate, state.status.Pending)
+		switch {
+		case err != nil:
+			return err.Error()
+		case pipelineRun == nil:
+			return fmt.Sprintf("there is no PipelineRun of Pipeline %s which built %s", gate.Pipeline, state.status.Pending)
+		case pipelineRun.Status.Phase != v1alpha3.Succeeded:
+			return fmt.Sprintf("the latest PipelineRun %s is %s", pipelineRun.Name, pipelineRun.Status.Phase)
+		case deployedAt != nil && (pipelineRun.Status.CompletionTime == nil || pipelineRun.Status.CompletionTime.Before(deployedAt)):
+			return fmt.Sprintf("the latest PipelineRun %s was completed before the previous stage was deployed", pipelineRun.Name)
+		}
+	}
+	return ""
+}
+
+// getLatestPipelineRun returns the latest PipelineRun of the gate which built the value
+func (r *Reconciler) getLatestPipelineRun(ctx context.Context, namespace string, gate *v1alpha1.PipelineRunGate,
+	value string) (latest *v1alpha3.PipelineRun, err error) {
+	pipelineRunList := &v1alpha3.PipelineRunList{}
+	if err = r.List(ctx, pipelineRunList, client.InNamespace(namespace),
+		client.MatchingLabels{v1alpha3.PipelineNameLabelKey: gate.Pipeline}); err != nil {
+		return
+	}
+	for i := range pipelineRunList.Items {
+		pipelineRun := &pipelineRunList.Items[i]
+		if getBuiltValue(pipelineRun, gate.Parameter) != value {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&pipelineRun.CreationTimestamp) {
+			latest = pipelineRun
+		}
+	}
+	return
+}
+
+// getBuiltValue returns the value of the parameter, or the SCM reference name if the parameter is empty
+func getBuiltValue(pipelineRun *v1alpha3.PipelineRun, parameter string) string {
+	if parameter == "" {
+		if pipelineRun.Spec.SCM == nil {
+			return ""
+		}
+		return pipelineRun.Spec.SCM.RefName
+	}
+	for _, param := range pipelineRun.Spec.Parameters {
+		if param.Name == parameter {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+func getStageStatus(statuses []v1alpha1.PromotionStageStatus, name string) *v1alpha1.PromotionStageStatus {
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// promotionsOfApplication maps an Application to the Promotions which have it as a stage
+func (r *Reconciler) promotionsOfApplication(obj client.Object) []reconcile.Request {
+	return r.findPromotions(obj.GetNamespace(), func(stage *v1alpha1.PromotionStage) bool {
+		return stage.Application.Name == obj.GetName()
+	})
+}
+
+// promotionsOfPipelineRun maps a PipelineRun to the Promotions which have its Pipeline as a gate
+func (r *Reconciler) promotionsOfPipelineRun(obj client.Object) []reconcile.Request {
+	pipeline := obj.GetLabels()[v1alpha3.PipelineNameLabelKey]
+	if pipeline == "" {
+		return nil
+	}
+	return r.findPromotions(obj.GetNamespace(), func(stage *v1alpha1.PromotionStage) bool {
+		return stage.Gates != nil && stage.Gates.PipelineRun != nil && stage.Gates.PipelineRun.Pipeline == pipeline
+	})
+}
+
+func (r *Reconciler) findPromotions(namespace string, match func(*v1alpha1.PromotionStage) bool) (
+	requests []reconcile.Request) {
+	promotionList := &v1alpha1.PromotionList{}
+	if err := r.List(context.Background(), promotionList, client.InNamespace(namespace)); err != nil {
+		r.log.Error(err, "failed to list the Promotions", "namespace", namespace)
+		return
+	}
+	for i := range promotionList.Items {
+		promotion := &promotionList.Items[i]
+		for j := range promotion.Spec.Stages {
+			if match(&promotion.Spec.Stages[j]) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(promotion)})
+				break
+			}
+		}
+	}
+	return
+}
+
+// GetName returns the name of this controller
+func (r *Reconciler) GetName() string {
+	return "PromotionController"
+}
+
+// GetGroupName returns the group name of this controller
+func (r *Reconciler) GetGroupName() string {
+	return groupName
+}
+
+// SetupWithManager setups the log and recorder
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.log = ctrl.Log.WithName(r.GetName())
+	r.recorder = mgr.GetEventRecorderFor(r.GetName())
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("promotion").
+		For(&v1alpha1.Promotion{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &v1alpha1.Application{}},
+			handler.EnqueueRequestsFromMapFunc(r.promotionsOfApplication)).
+		Watches(&source.Kind{Type: &v1alpha3.PipelineRun{}},
+			handler.EnqueueRequestsFromMapFunc(r.promotionsOfPipelineRun)).
+		Complete(r)
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	goscm "github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	schema := runtime.NewScheme()
+	assert.Nil(t, v1alpha1.AddToScheme(schema))
+	assert.Nil(t, v1alpha3.AddToScheme(schema))
+	return schema
+}
+
+func createArgoApp(name, targetRevision, revision string, sync v1alpha1.SyncStatusCode, health v1alpha1.HealthStatusCode) *v1alpha1.Application {
+	return &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: name},
+		Spec: v1alpha1.ApplicationSpec{
+			Kind: v1alpha1.ArgoCD,
+			ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+				Source: v1alpha1.ApplicationSource{TargetRevision: targetRevision},
+			}},
+		},
+		Status: v1alpha1.ApplicationStatus{
+			Revision:     revision,
+			SyncStatus:   sync,
+			HealthStatus: health,
+		},
+	}
+}
+
+func createPromotion(gates *v1alpha1.PromotionGates) *v1alpha1.Promotion {
+	return &v1alpha1.Promotion{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-promotion"},
+		Spec: v1alpha1.PromotionSpec{Stages: []v1alpha1.PromotionStage{{
+			Name:        "dev",
+			Application: v1.LocalObjectReference{Name: "dev"},
+		}, {
+			Name:        "staging",
+			Application: v1.LocalObjectReference{Name: "staging"},
+			Gates:       gates,
+		}}},
+	}
+}
+
+func createPipelineRun(name string, phase v1alpha3.RunPhase, created, completed time.Time) *v1alpha3.PipelineRun {
+	return &v1alpha3.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "fake-ns",
+			Name:              name,
+			Labels:            map[string]string{v1alpha3.PipelineNameLabelKey: "verify"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: v1alpha3.PipelineRunSpec{
+			SCM:        &v1alpha3.SCM{RefType: "branch", RefName: "abc"},
+			Parameters: []v1alpha3.Parameter{{Name: "TAG", Value: "abc"}},
+		},
+		Status: v1alpha3.PipelineRunStatus{
+			Phase:          phase,
+			CompletionTime: &metav1.Time{Time: completed},
+		},
+	}
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	now := time.Now()
+	deployedDev := createArgoApp("dev", "main", "abc", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusHealthy)
+	deployedDev.Status.LastOperation = &v1alpha1.OperationResult{FinishedAt: &metav1.Time{Time: now.Add(-time.Hour)}}
+	staging := createArgoApp("staging", "old", "old", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusHealthy)
+
+	tests := []struct {
+		name             string
+		objs             []client.Object
+		wantPhase        v1alpha1.PromotionPhase
+		wantRevision     string
+		wantLastPromoted string
+	}{{
+		name:             "promote without gates",
+		objs:             []client.Object{createPromotion(nil), deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:        v1alpha1.PromotionPhasePromoted,
+		wantRevision:     "abc",
+		wantLastPromoted: "abc",
+	}, {
+		name: "already promoted",
+		objs: []client.Object{createPromotion(nil), deployedDev.DeepCopy(),
+			createArgoApp("staging", "abc", "abc", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusHealthy)},
+		wantPhase:    v1alpha1.PromotionPhasePromoted,
+		wantRevision: "abc",
+	}, {
+		name: "the previous stage is not deployed",
+		objs: []client.Object{createPromotion(nil), staging.DeepCopy(),
+			createArgoApp("dev", "main", "", v1alpha1.SyncStatusUnknown, v1alpha1.HealthStatusUnknown)},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the previous stage is not healthy",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{HealthyPreviousStage: true}), staging.DeepCopy(),
+			createArgoApp("dev", "main", "abc", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusDegraded)},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the previous stage is healthy",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{HealthyPreviousStage: true}),
+			deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:        v1alpha1.PromotionPhasePromoted,
+		wantRevision:     "abc",
+		wantLastPromoted: "abc",
+	}, {
+		name: "the previous stage is not deployed since the last promotion",
+		objs: []client.Object{func() *v1alpha1.Promotion {
+			promotion := createPromotion(&v1alpha1.PromotionGates{HealthyPreviousStage: true})
+			promotion.Status.Stages = []v1alpha1.PromotionStageStatus{{
+				Name:          "dev",
+				LastPromotion: &v1alpha1.PromotionRecord{Value: "abc", PromotedAt: metav1.NewTime(now)},
+			}}
+			return promotion
+		}(), deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "waiting for the approval",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{ManualApproval: true}),
+			deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:    v1alpha1.PromotionPhaseWaitingForApproval,
+		wantRevision: "old",
+	}, {
+		name: "approved",
+		objs: []client.Object{func() *v1alpha1.Promotion {
+			promotion := createPromotion(&v1alpha1.PromotionGates{ManualApproval: true})
+			promotion.Spec.Operation = &v1alpha1.PromotionOperation{
+				Type:        v1alpha1.PromotionOperationApprove,
+				Stage:       "staging",
+				Value:       "abc",
+				InitiatedBy: v1alpha1.OperationInitiator{Username: "admin"},
+			}
+			return promotion
+		}(), deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:        v1alpha1.PromotionPhasePromoted,
+		wantRevision:     "abc",
+		wantLastPromoted: "abc",
+	}, {
+		name: "another value was approved",
+		objs: []client.Object{func() *v1alpha1.Promotion {
+			promotion := createPromotion(&v1alpha1.PromotionGates{ManualApproval: true})
+			promotion.Status.Stages = []v1alpha1.PromotionStageStatus{{
+				Name:     "staging",
+				Approval: &v1alpha1.PromotionOperation{Type: v1alpha1.PromotionOperationApprove, Stage: "staging", Value: "xyz"},
+			}}
+			return promotion
+		}(), deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:    v1alpha1.PromotionPhaseWaitingForApproval,
+		wantRevision: "old",
+	}, {
+		name: "no PipelineRun",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy()},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the latest PipelineRun failed",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy(),
+			createPipelineRun("run-1", v1alpha3.Succeeded, now.Add(-time.Minute*30), now.Add(-time.Minute*20)),
+			createPipelineRun("run-2", v1alpha3.Failed, now.Add(-time.Minute*10), now)},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the latest PipelineRun was completed before the deployment",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy(),
+			createPipelineRun("run-1", v1alpha3.Succeeded, now.Add(-time.Hour*3), now.Add(-time.Hour*2))},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the latest PipelineRun succeeded",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy(),
+			createPipelineRun("run-1", v1alpha3.Failed, now.Add(-time.Minute*30), now.Add(-time.Minute*20)),
+			createPipelineRun("run-2", v1alpha3.Succeeded, now.Add(-time.Minute*10), now)},
+		wantPhase:        v1alpha1.PromotionPhasePromoted,
+		wantRevision:     "abc",
+		wantLastPromoted: "abc",
+	}, {
+		name: "the latest PipelineRun built another value",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy(),
+			createPipelineRun("run-1", v1alpha3.Failed, now.Add(-time.Minute*30), now.Add(-time.Minute*20)),
+			func() *v1alpha3.PipelineRun {
+				pipelineRun := createPipelineRun("run-2", v1alpha3.Succeeded, now.Add(-time.Minute*10), now)
+				pipelineRun.Spec.SCM.RefName = "xyz"
+				return pipelineRun
+			}()},
+		wantPhase:    v1alpha1.PromotionPhaseWaiting,
+		wantRevision: "old",
+	}, {
+		name: "the PipelineRun is matched by the parameter",
+		objs: []client.Object{createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify", Parameter: "TAG"}}),
+			deployedDev.DeepCopy(), staging.DeepCopy(),
+			func() *v1alpha3.PipelineRun {
+				pipelineRun := createPipelineRun("run-1", v1alpha3.Succeeded, now.Add(-time.Minute*10), now)
+				pipelineRun.Spec.SCM.RefName = "main"
+				return pipelineRun
+			}()},
+		wantPhase:        v1alpha1.PromotionPhasePromoted,
+		wantRevision:     "abc",
+		wantLastPromoted: "abc",
+	}, {
+		name: "the Application is generated by an ApplicationSet",
+		objs: []client.Object{createPromotion(nil), deployedDev.DeepCopy(), func() *v1alpha1.Application {
+			app := staging.DeepCopy()
+			app.Labels = map[string]string{v1alpha1.ApplicationSetLabelKey: "guestbook"}
+			return app
+		}()},
+		wantPhase:    v1alpha1.PromotionPhaseFailed,
+		wantRevision: "old",
+	}, {
+		name:      "the Application is not found",
+		objs:      []client.Object{createPromotion(nil), deployedDev.DeepCopy()},
+		wantPhase: v1alpha1.PromotionPhaseFailed,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(tt.objs...).Build()
+			r := &Reconciler{
+				Client:   c,
+				log:      logr.New(log.NullLogSink{}),
+				recorder: &record.FakeRecorder{},
+			}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"},
+			})
+			assert.Nil(t, err)
+
+			promotion := &v1alpha1.Promotion{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"}, promotion))
+			assert.Nil(t, promotion.Spec.Operation)
+			stageStatus := getStageStatus(promotion.Status.Stages, "staging")
+			if assert.NotNil(t, stageStatus) {
+				assert.Equal(t, tt.wantPhase, stageStatus.Phase, stageStatus.Message)
+				if tt.wantLastPromoted != "" && assert.NotNil(t, stageStatus.LastPromotion) {
+					assert.Equal(t, tt.wantLastPromoted, stageStatus.LastPromotion.Value)
+				}
+			}
+
+			if tt.wantRevision != "" {
+				app := &v1alpha1.Application{}
+				assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "staging"}, app))
+				assert.Equal(t, tt.wantRevision, app.Spec.ArgoApp.Spec.Source.TargetRevision)
+			}
+		})
+	}
+}
+
+func TestReconciler_promoteFluxApp(t *testing.T) {
+	createFluxApp := func(name string, chart *v1alpha1.HelmChartTemplateSpec, revision string) *v1alpha1.Application {
+		app := &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: name},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.FluxCD,
+				FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+					Config: &v1alpha1.FluxApplicationConfig{},
+				}},
+			},
+			Status: v1alpha1.ApplicationStatus{Revision: revision},
+		}
+		if chart != nil {
+			app.Spec.FluxApp.Spec.Config.HelmRelease = &v1alpha1.HelmReleaseSpec{Chart: chart}
+		} else {
+			app.Spec.FluxApp.Spec.Config.Kustomization = []*v1alpha1.KustomizationSpec{{}}
+		}
+		return app
+	}
+
+	t.Run("chart version", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(createPromotion(nil),
+			createFluxApp("dev", &v1alpha1.HelmChartTemplateSpec{Version: "*"}, "1.2.0"),
+			createFluxApp("staging", &v1alpha1.HelmChartTemplateSpec{Version: "1.1.0"}, "1.1.0")).Build()
+		r := &Reconciler{Client: c, log: logr.New(log.NullLogSink{}), recorder: &record.FakeRecorder{}}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"},
+		})
+		assert.Nil(t, err)
+
+		app := &v1alpha1.Application{}
+		assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "staging"}, app))
+		assert.Equal(t, "1.2.0", app.Spec.FluxApp.Spec.Config.HelmRelease.Chart.Version)
+	})
+
+	t.Run("kustomization is not supported", func(t *testing.T) {
+		c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(createPromotion(nil),
+			createFluxApp("dev", nil, "main@sha1:abc"),
+			createFluxApp("staging", nil, "main@sha1:old")).Build()
+		r := &Reconciler{Client: c, log: logr.New(log.NullLogSink{}), recorder: &record.FakeRecorder{}}
+		_, err := r.Reconcile(context.Background(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"},
+		})
+		assert.Nil(t, err)
+
+		promotion := &v1alpha1.Promotion{}
+		assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"}, promotion))
+		assert.Equal(t, v1alpha1.PromotionPhaseFailed, promotion.Status.Stages[1].Phase)
+	})
+}
+
+func TestReconciler_promoteGit(t *testing.T) {
+	gitClient, data := fakescm.NewDefault()
+	data.ContentDir = t.TempDir()
+	for env, tag := range map[string]string{"dev": "1.21", "staging": "1.20"} {
+		dir := filepath.Join(data.ContentDir, "fake", "repo", "envs", env)
+		assert.Nil(t, os.MkdirAll(dir, 0o755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("image:\n  tag: \""+tag+"\"\n"), 0o644))
+	}
+
+	repo := &v1alpha3.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-repo"},
+		Spec:       v1alpha3.GitRepositorySpec{Owner: "fake", Repo: "repo"},
+	}
+	promotion := createPromotion(nil)
+	for i, env := range []string{"dev", "staging"} {
+		promotion.Spec.Stages[i].Git = &v1alpha1.PromotionGitTarget{
+			Repository: v1.LocalObjectReference{Name: "fake-repo"},
+			Path:       "envs/" + env + "/values.yaml",
+			Key:        "image.tag",
+		}
+	}
+	c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(promotion, repo,
+		createArgoApp("dev", "main", "abc", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusHealthy),
+		createArgoApp("staging", "main", "abc", v1alpha1.SyncStatusSynced, v1alpha1.HealthStatusHealthy)).Build()
+	r := &Reconciler{
+		Client:   c,
+		log:      logr.New(log.NullLogSink{}),
+		recorder: &record.FakeRecorder{},
+		newGitClient: func(*v1alpha3.GitRepository) (*goscm.Client, error) {
+			return gitClient, nil
+		},
+	}
+	result, err := r.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, gitRequeuePeriod, result.RequeueAfter)
+
+	values, err := os.ReadFile(filepath.Join(data.ContentDir, "fake", "repo", "envs", "staging", "values.yaml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "image:\n  tag: \"1.21\"\n", string(values))
+
+	latest := &v1alpha1.Promotion{}
+	assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"}, latest))
+	assert.Equal(t, []v1alpha1.PromotionStageStatus{{
+		Name:  "dev",
+		Value: "1.21",
+	}, {
+		Name:          "staging",
+		Phase:         v1alpha1.PromotionPhasePromoted,
+		Value:         "1.21",
+		LastPromotion: latest.Status.Stages[1].LastPromotion,
+	}}, latest.Status.Stages)
+}
+
+func TestReconciler_mapFuncs(t *testing.T) {
+	promotion := createPromotion(&v1alpha1.PromotionGates{PipelineRun: &v1alpha1.PipelineRunGate{Pipeline: "verify"}})
+	r := &Reconciler{
+		Client: fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(promotion).Build(),
+		log:    logr.New(log.NullLogSink{}),
+	}
+	fakeRequests := []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"}}}
+
+	assert.Equal(t, fakeRequests, r.promotionsOfApplication(createArgoApp("staging", "", "", "", "")))
+	assert.Empty(t, r.promotionsOfApplication(createArgoApp("prod", "", "", "", "")))
+	assert.Equal(t, fakeRequests, r.promotionsOfPipelineRun(createPipelineRun("run", v1alpha3.Succeeded, time.Now(), time.Now())))
+	assert.Empty(t, r.promotionsOfPipelineRun(&v1alpha3.PipelineRun{}))
+}
+
+func TestReconciler_GetName(t *testing.T) {
+	r := &Reconciler{}
+	assert.Equal(t, "PromotionController", r.GetName())
+	assert.Equal(t, "promotion", r.GetGroupName())
+}
+
+func TestReconciler_SetupWithManager(t *testing.T) {
+	schema := newScheme(t)
+	r := &Reconciler{}
+	err := r.SetupWithManager(&core.FakeManager{
+		Client: fake.NewClientBuilder().WithScheme(schema).Build(),
+		Scheme: schema,
+	})
+	assert.Nil(t, err)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"context"
+	"fmt"
+
+	goscm "github.com/jenkins-x/go-scm/scm"
+	"k8s.io/apimachinery/pkg/types"
+	utilretry "k8s.io/client-go/util/retry"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/client/git"
+)
+
+// stageValue is the value of a stage
+type stageValue struct {
+	// deployed is the value which could be promoted to the next stage
+	deployed string
+	// desired is the value which is configured, it's compared with the value of the previous stage
+	desired string
+}
+
+// getStageValue returns the value in the Git file of the stage, or the revision of its Application
+func (r *Reconciler) getStageValue(ctx context.Context, promotion *v1alpha1.Promotion,
+	stage *v1alpha1.PromotionStage, app *v1alpha1.Application) (value stageValue, err error) {
+	if stage.Git != nil {
+		var file *goscm.Content
+		if _, _, file, err = r.getGitFile(ctx, promotion.Namespace, stage.Git); err != nil {
+			return
+		}
+		value.deployed, err = getYAMLValue(file.Data, stage.Git.Key)
+		value.desired = value.deployed
+		return
+	}
+
+	value.deployed = app.Status.Revision
+	switch {
+	case app.Spec.ArgoApp != nil:
+		value.desired = app.Spec.ArgoApp.Spec.Source.TargetRevision
+	case getHelmChart(app) != nil:
+		value.desired = getHelmChart(app).Version
+	}
+	return
+}
+
+// promote writes the value into the Git file of the stage, or the Application
+func (r *Reconciler) promote(ctx context.Context, promotion *v1alpha1.Promotion,
+	stage *v1alpha1.PromotionStage, value string) (err error) {
+	if stage.Git != nil {
+		return r.commitGitFile(ctx, promotion.Namespace, stage, value)
+	}
+
+	return utilretry.RetryOnConflict(utilretry.DefaultRetry, func() (err error) {
+		app := &v1alpha1.Application{}
+		if err = r.Get(ctx, types.NamespacedName{Namespace: promotion.Namespace, Name: stage.Application.Name}, app); err != nil {
+			return
+		}
+		if appSet := app.Labels[v1alpha1.ApplicationSetLabelKey]; appSet != "" {
+			// the ApplicationSet controller would revert the changes
+			return fmt.Errorf("the Application %s is generated by ApplicationSet %s, please promote it via Git", app.Name, appSet)
+		}
+		switch {
+		case app.Spec.ArgoApp != nil:
+			app.Spec.ArgoApp.Spec.Source.TargetRevision = value
+		case getHelmChart(app) != nil:
+			getHelmChart(app).Version = value
+		default:
+			return fmt.Errorf("the revision of Application %s cannot be changed, please promote it via Git", app.Name)
+		}
+		return r.Update(ctx, app)
+	})
+}
+
+func getHelmChart(app *v1alpha1.Application) *v1alpha1.HelmChartTemplateSpec {
+	if app.Spec.FluxApp == nil || app.Spec.FluxApp.Spec.Config == nil || app.Spec.FluxApp.Spec.Config.HelmRelease == nil {
+		return nil
+	}
+	return app.Spec.FluxApp.Spec.Config.HelmRelease.Chart
+}
+
+func (r *Reconciler) getGitFile(ctx context.Context, namespace string, target *v1alpha1.PromotionGitTarget) (
+	gitClient *goscm.Client, repoName string, file *goscm.Content, err error) {
+	repo := &v1alpha3.GitRepository{}
+	if err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: target.Repository.Name}, repo); err != nil {
+		return
+	}
+
+	newGitClient := r.newGitClient
+	if newGitClient == nil {
+		newGitClient = r.getGitClient
+	}
+	if gitClient, err = newGitClient(repo); err != nil {
+		return
+	}
+	repoName = git.GetRepositoryName(repo)
+	if file, _, err = gitClient.Contents.Find(ctx, repoName, target.Path, target.Branch); err != nil {
+		err = fmt.Errorf("failed to read %s: %v", target.Path, err)
+	}
+	return
+}
+
+func (r *Reconciler) commitGitFile(ctx context.Context, namespace string, stage *v1alpha1.PromotionStage, value string) (err error) {
+	var gitClient *goscm.Client
+	var repoName string
+	var file *goscm.Content
+	if gitClient, repoName, file, err = r.getGitFile(ctx, namespace, stage.Git); err != nil {
+		return
+	}
+	var data []byte
+	if data, err = setYAMLValue(file.Data, stage.Git.Key, value); err != nil {
+		return
+	}
+
+	message := stage.Git.Message
+	if message == "" {
+		message = fmt.Sprintf("promote %s to %s", value, stage.Name)
+	}
+	if _, err = gitClient.Contents.Update(ctx, repoName, stage.Git.Path, &goscm.ContentParams{
+		Branch:  stage.Git.Branch,
+		Message: message,
+		Data:    data,
+		Sha:     file.Sha,
+	}); err != nil {
+		err = fmt.Errorf("failed to commit %s: %v", stage.Git.Path, err)
+	}
+	return
+}
+
+func (r *Reconciler) getGitClient(repo *v1alpha3.GitRepository) (*goscm.Client, error) {
+	return git.NewRepositoryClientFactory(repo, r.Client).GetClient()
+}
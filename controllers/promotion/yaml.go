@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// getYAMLValue returns the scalar value of a dot-separated key in a YAML document
+func getYAMLValue(data []byte, key string) (value string, err error) {
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(data, doc); err != nil {
+		return
+	}
+	var node *yaml.Node
+	if node, err = findYAMLNode(doc, key); err == nil {
+		value = node.Value
+	}
+	return
+}
+
+// setYAMLValue sets the scalar value of a dot-separated key in a YAML document, the comments are kept
+func setYAMLValue(data []byte, key, value string) (result []byte, err error) {
+	doc := &yaml.Node{}
+	if err = yaml.Unmarshal(data, doc); err != nil {
+		return
+	}
+	var node *yaml.Node
+	if node, err = findYAMLNode(doc, key); err != nil {
+		return
+	}
+	node.Value = value
+	node.Tag = "!!str"
+
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(doc); err == nil {
+		err = encoder.Close()
+	}
+	result = buf.Bytes()
+	return
+}
+
+func findYAMLNode(doc *yaml.Node, key string) (node *yaml.Node, err error) {
+	node = doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, name := range strings.Split(key, ".") {
+		var child *yaml.Node
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == name {
+					child = node.Content[i+1]
+					break
+				}
+			}
+		}
+		if child == nil {
+			return nil, fmt.Errorf("the key %s is not found", key)
+		}
+		node = child
+	}
+	if node.Kind != yaml.ScalarNode {
+		err = fmt.Errorf("the value of the key %s is not a scalar", key)
+	}
+	return
+}
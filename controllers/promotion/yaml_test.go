@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package promotion
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const values = `# the values of staging
+image:
+  repository: nginx
+  tag: "1.20" # the promoted tag
+replicas: 2
+`
+
+func Test_getYAMLValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr bool
+	}{{
+		name: "nested key",
+		key:  "image.tag",
+		want: "1.20",
+	}, {
+		name: "top level key",
+		key:  "replicas",
+		want: "2",
+	}, {
+		name:    "not found",
+		key:     "image.digest",
+		wantErr: true,
+	}, {
+		name:    "not a scalar",
+		key:     "image",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := getYAMLValue([]byte(values), tt.key)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+
+	_, err := getYAMLValue([]byte("{"), "image")
+	assert.NotNil(t, err)
+}
+
+func Test_setYAMLValue(t *testing.T) {
+	result, err := setYAMLValue([]byte(values), "image.tag", "1.21")
+	assert.Nil(t, err)
+	assert.Equal(t, `# the values of staging
+image:
+  repository: nginx
+  tag: "1.21" # the promoted tag
+replicas: 2
+`, string(result))
+
+	result, err = setYAMLValue([]byte(values), "replicas", "v3")
+	assert.Nil(t, err)
+	assert.Contains(t, string(result), "replicas: v3\n")
+
+	_, err = setYAMLValue([]byte(values), "image.digest", "sha256:abc")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// argoRollouts drives the Rollout of Argo Rollouts, see also https://argoproj.github.io/argo-rollouts/
+// The Rollout references the Deployment by the workloadRef, Argo Rollouts scales the Deployment down to zero
+// once the Rollout becomes healthy
+type argoRollouts struct{}
+
+// argoRolloutsScaleDownOnSuccess is the scaleDown policy of the workloadRef, it requires Argo Rollouts v1.5 or later
+const argoRolloutsScaleDownOnSuccess = "onsuccess"
+
+func (a *argoRollouts) groupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Group:   "argoproj.io",
+		Version: "v1alpha1",
+		Kind:    "Rollout",
+	}
+}
+
+func (a *argoRollouts) build(ctx context.Context, c client.Reader, obj, existing *unstructured.Unstructured,
+	strategy *v1alpha1.RolloutStrategy) (err error) {
+	workloadRef := getTargetRef(strategy)
+	workloadRef["scaleDown"] = argoRolloutsScaleDownOnSuccess
+	spec := map[string]interface{}{
+		"workloadRef": workloadRef,
+	}
+
+	// the Rollout requires the same selector of the Deployment
+	deploy := &appsv1.Deployment{}
+	if err = c.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: strategy.TargetRef.Name}, deploy); err == nil {
+		if deploy.Spec.Selector != nil {
+			var selector map[string]interface{}
+			if selector, err = runtime.DefaultUnstructuredConverter.ToUnstructured(deploy.Spec.Selector); err != nil {
+				return
+			}
+			spec["selector"] = selector
+		}
+	} else if err = client.IgnoreNotFound(err); err != nil {
+		return
+	}
+
+	switch {
+	case strategy.Canary != nil:
+		steps := make([]interface{}, 0, len(strategy.Canary.Steps))
+		for _, step := range strategy.Canary.Steps {
+			switch {
+			case step.SetWeight != nil:
+				steps = append(steps, map[string]interface{}{"setWeight": int64(*step.SetWeight)})
+			case step.Pause != nil:
+				pause := map[string]interface{}{}
+				if step.Pause.Duration != nil {
+					pause["duration"] = step.Pause.Duration.Duration.String()
+				}
+				steps = append(steps, map[string]interface{}{"pause": pause})
+			}
+		}
+		spec["strategy"] = map[string]interface{}{
+			"canary": map[string]interface{}{"steps": steps},
+		}
+	case strategy.BlueGreen != nil:
+		blueGreen := map[string]interface{}{
+			"activeService":        strategy.BlueGreen.ActiveService,
+			"autoPromotionEnabled": strategy.BlueGreen.AutoPromotion,
+		}
+		if strategy.BlueGreen.PreviewService != "" {
+			blueGreen["previewService"] = strategy.BlueGreen.PreviewService
+		}
+		spec["strategy"] = map[string]interface{}{"blueGreen": blueGreen}
+	default:
+		err = fmt.Errorf("either canary or blueGreen strategy is required")
+		return
+	}
+
+	if existing != nil {
+		// keep the pause state which is managed by Argo Rollouts
+		if paused, found, _ := unstructured.NestedBool(existing.Object, "spec", "paused"); found {
+			spec["paused"] = paused
+		}
+	}
+	obj.Object["spec"] = spec
+	return
+}
+
+func (a *argoRollouts) operate(ctx context.Context, c client.Client, obj *unstructured.Unstructured,
+	operation v1alpha1.RolloutOperationType) (err error) {
+	switch operation {
+	case v1alpha1.RolloutOperationPromote:
+		// same as the promote command of the kubectl plugin, it unpauses the rollout
+		unstructured.RemoveNestedField(obj.Object, "status", "pauseConditions")
+		_ = unstructured.SetNestedField(obj.Object, false, "status", "controllerPause")
+		if err = c.Status().Update(ctx, obj); err == nil {
+			_ = unstructured.SetNestedField(obj.Object, false, "spec", "paused")
+			err = c.Update(ctx, obj)
+		}
+	case v1alpha1.RolloutOperationAbort:
+		_ = unstructured.SetNestedField(obj.Object, true, "status", "abort")
+		err = c.Status().Update(ctx, obj)
+	default:
+		err = fmt.Errorf("operation %q is not supported", operation)
+	}
+	return
+}
+
+func (a *argoRollouts) status(obj *unstructured.Unstructured, strategy *v1alpha1.RolloutStrategy) (
+	status *v1alpha1.RolloutStatus) {
+	status = &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseProgressing}
+	if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != "" {
+		status.Phase = v1alpha1.RolloutPhase(phase)
+	}
+	if aborted, _, _ := unstructured.NestedBool(obj.Object, "status", "abort"); aborted {
+		status.Phase = v1alpha1.RolloutPhaseAborted
+	}
+	status.Message, _, _ = unstructured.NestedString(obj.Object, "status", "message")
+
+	if strategy.Canary == nil {
+		return
+	}
+	status.TotalSteps = int32(len(strategy.Canary.Steps))
+	if index, found, _ := unstructured.NestedInt64(obj.Object, "status", "currentStepIndex"); found {
+		status.CurrentStep = int32(index)
+	}
+	if status.Phase == v1alpha1.RolloutPhaseHealthy {
+		status.Weight = 100
+	} else if status.Phase != v1alpha1.RolloutPhaseAborted {
+		status.Weight = getCurrentWeight(strategy.Canary.Steps, status.CurrentStep)
+	}
+	return
+}
+
+// getCurrentWeight returns the last weight which was set before the current step
+func getCurrentWeight(steps []v1alpha1.CanaryStep, current int32) (weight int32) {
+	for i := 0; i < len(steps) && int32(i) <= current; i++ {
+		if steps[i].SetWeight != nil {
+			weight = *steps[i].SetWeight
+		}
+	}
+	return
+}
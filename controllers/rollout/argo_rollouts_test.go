@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_argoRollouts_build(t *testing.T) {
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "workload-ns", Name: "fake-deploy"},
+		Spec: appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "fake"},
+		}},
+	}
+	targetRef := v1alpha1.RolloutTargetReference{Name: "fake-deploy"}
+
+	tests := []struct {
+		name     string
+		objects  []client.Object
+		strategy *v1alpha1.RolloutStrategy
+		existing *unstructured.Unstructured
+		wantSpec map[string]interface{}
+		wantErr  bool
+	}{{
+		name:    "canary with the selector of the Deployment",
+		objects: []client.Object{deploy},
+		strategy: &v1alpha1.RolloutStrategy{TargetRef: targetRef, Canary: &v1alpha1.CanaryStrategy{
+			Steps: []v1alpha1.CanaryStep{
+				{SetWeight: int32Ptr(20)},
+				{Pause: &v1alpha1.RolloutPause{Duration: &metav1.Duration{Duration: time.Minute}}},
+				{Pause: &v1alpha1.RolloutPause{}},
+			},
+		}},
+		wantSpec: map[string]interface{}{
+			"workloadRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "fake-deploy", "scaleDown": "onsuccess"},
+			"selector":    map[string]interface{}{"matchLabels": map[string]interface{}{"app": "fake"}},
+			"strategy": map[string]interface{}{"canary": map[string]interface{}{"steps": []interface{}{
+				map[string]interface{}{"setWeight": int64(20)},
+				map[string]interface{}{"pause": map[string]interface{}{"duration": "1m0s"}},
+				map[string]interface{}{"pause": map[string]interface{}{}},
+			}}},
+		},
+	}, {
+		name: "blue-green keeps the pause state",
+		strategy: &v1alpha1.RolloutStrategy{TargetRef: targetRef, BlueGreen: &v1alpha1.BlueGreenStrategy{
+			ActiveService:  "active",
+			PreviewService: "preview",
+		}},
+		existing: &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"paused": true},
+		}},
+		wantSpec: map[string]interface{}{
+			"workloadRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "fake-deploy", "scaleDown": "onsuccess"},
+			"strategy": map[string]interface{}{"blueGreen": map[string]interface{}{
+				"activeService":        "active",
+				"previewService":       "preview",
+				"autoPromotionEnabled": false,
+			}},
+			"paused": true,
+		},
+	}, {
+		name:     "no strategy",
+		strategy: &v1alpha1.RolloutStrategy{TargetRef: targetRef},
+		wantErr:  true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(tt.objects...).Build()
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			obj.SetNamespace("workload-ns")
+			err := (&argoRollouts{}).build(context.Background(), c, obj, tt.existing, tt.strategy)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantSpec, obj.Object["spec"])
+		})
+	}
+}
+
+func Test_argoRollouts_status(t *testing.T) {
+	strategy := &v1alpha1.RolloutStrategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+		{SetWeight: int32Ptr(20)},
+		{Pause: &v1alpha1.RolloutPause{}},
+		{SetWeight: int32Ptr(50)},
+		{Pause: &v1alpha1.RolloutPause{}},
+	}}}
+
+	tests := []struct {
+		name   string
+		status map[string]interface{}
+		want   *v1alpha1.RolloutStatus
+	}{{
+		name:   "not reconciled yet",
+		status: nil,
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseProgressing, TotalSteps: 4, Weight: 20},
+	}, {
+		name: "paused at the second weight",
+		status: map[string]interface{}{
+			"phase":            "Paused",
+			"currentStepIndex": int64(3),
+			"message":          "CanaryPauseStep",
+		},
+		want: &v1alpha1.RolloutStatus{
+			Phase:       v1alpha1.RolloutPhasePaused,
+			CurrentStep: 3,
+			TotalSteps:  4,
+			Weight:      50,
+			Message:     "CanaryPauseStep",
+		},
+	}, {
+		name:   "finished",
+		status: map[string]interface{}{"phase": "Healthy", "currentStepIndex": int64(4)},
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseHealthy, CurrentStep: 4, TotalSteps: 4, Weight: 100},
+	}, {
+		name:   "aborted",
+		status: map[string]interface{}{"phase": "Degraded", "abort": true, "currentStepIndex": int64(1)},
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseAborted, CurrentStep: 1, TotalSteps: 4},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			if tt.status != nil {
+				obj.Object["status"] = tt.status
+			}
+			assert.Equal(t, tt.want, (&argoRollouts{}).status(obj, strategy))
+		})
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/utils/k8sutil"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications,verbs=get;list;watch;update
+//+kubebuilder:rbac:groups=gitops.kubesphere.io,resources=applications/status,verbs=get;update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get
+//+kubebuilder:rbac:groups=argoproj.io,resources=rollouts;rollouts/status,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups=flagger.app,resources=canaries,verbs=get;list;create;update;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+const groupName = "rollout"
+
+// progressingRequeuePeriod is the period to refresh the status of a rollout which is not finished
+const progressingRequeuePeriod = 30 * time.Second
+
+// Reconciler drives the Argo Rollouts or Flagger resources according to the rollout strategy of the Application,
+// and reports the progress of the rollout into the status of the Application
+type Reconciler struct {
+	client.Client
+	// FlaggerLoadTester is the base URL of the Flagger load tester which serves the manual promotion gate
+	FlaggerLoadTester string
+
+	log      logr.Logger
+	recorder record.EventRecorder
+}
+
+// Reconcile makes sure the rollout object is expected, handles the promote or abort operations
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	r.log.Info(fmt.Sprintf("start to reconcile application rollout: %s", req.String()))
+
+	app := &v1alpha1.Application{}
+	if err = r.Get(ctx, req.NamespacedName, app); err != nil {
+		err = client.IgnoreNotFound(err)
+		return
+	}
+
+	// the Application was deleted, or the rollout strategy was removed
+	if !app.ObjectMeta.DeletionTimestamp.IsZero() || app.Spec.Rollout == nil {
+		err = r.cleanRollout(ctx, app)
+		return
+	}
+	if k8sutil.AddFinalizer(&app.ObjectMeta, v1alpha1.RolloutFinalizerName) {
+		if err = r.Update(ctx, app); err != nil {
+			return
+		}
+	}
+
+	strategy := app.Spec.Rollout
+	providerName := strategy.Provider
+	if providerName == "" {
+		providerName = v1alpha1.RolloutProviderArgoRollouts
+	}
+	p := r.getProvider(providerName)
+	if p == nil {
+		r.recorder.Eventf(app, corev1.EventTypeWarning, "Invalid", "rollout provider %q is not supported", providerName)
+		return
+	}
+
+	var namespace string
+	if namespace, err = getDestinationNamespace(app); err != nil {
+		err = r.updateStatusMessage(ctx, app, providerName, err.Error())
+		return
+	}
+
+	obj := createRolloutObject(p, app, namespace)
+	var existing *unstructured.Unstructured
+	if existing, err = r.getRolloutObject(ctx, p, namespace, app.GetName()); err != nil {
+		return
+	}
+	if existing != nil && !isOwnedBy(existing, app) {
+		message := fmt.Sprintf("%s %s/%s does not belong to the Application", existing.GetKind(), namespace, app.GetName())
+		r.recorder.Event(app, corev1.EventTypeWarning, "Conflict", message)
+		err = r.updateStatusCondition(ctx, app, providerName, metav1.Condition{
+			Type:    v1alpha1.RolloutConditionTypeOwned,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Conflict",
+			Message: message,
+		})
+		return
+	}
+	if err = p.build(ctx, r.Client, obj, existing, strategy); err != nil {
+		err = r.updateStatusMessage(ctx, app, providerName, err.Error())
+		return
+	}
+	if existing, err = r.createOrUpdate(ctx, obj, existing); err != nil {
+		return
+	}
+
+	status := p.status(existing, strategy)
+	status.Provider = providerName
+	if app.Status.Rollout != nil {
+		status.LastOperation = app.Status.Rollout.LastOperation
+		status.Conditions = app.Status.Rollout.Conditions
+	}
+	// the conflict was resolved
+	meta.RemoveStatusCondition(&status.Conditions, v1alpha1.RolloutConditionTypeOwned)
+
+	if op := strategy.Operation; op != nil {
+		if err = p.operate(ctx, r.Client, existing, op.Type); err != nil {
+			r.recorder.Eventf(app, corev1.EventTypeWarning, "FailedOperation", "failed to %s the rollout: %v", op.Type, err)
+			status.Message = err.Error()
+		} else {
+			r.recorder.Eventf(app, corev1.EventTypeNormal, string(op.Type), "the rollout was requested to %s", op.Type)
+			if op.Type == v1alpha1.RolloutOperationAbort {
+				status.Phase = v1alpha1.RolloutPhaseAborted
+			}
+		}
+		status.LastOperation = op.DeepCopy()
+
+		// the operation is handled, remove it from the spec
+		app.Spec.Rollout.Operation = nil
+		if err = r.Update(ctx, app); err != nil {
+			return
+		}
+	}
+
+	app.Status.Rollout = status
+	if err = r.Status().Update(ctx, app); err != nil {
+		return
+	}
+
+	if status.Phase == v1alpha1.RolloutPhaseProgressing || status.Phase == v1alpha1.RolloutPhasePaused {
+		// the rollout objects are not watched, refresh the status periodically until it's finished
+		result = ctrl.Result{RequeueAfter: progressingRequeuePeriod}
+	}
+	return
+}
+
+func (r *Reconciler) updateStatusMessage(ctx context.Context, app *v1alpha1.Application,
+	provider v1alpha1.RolloutProvider, message string) error {
+	if app.Status.Rollout == nil {
+		app.Status.Rollout = &v1alpha1.RolloutStatus{}
+	}
+	app.Status.Rollout.Provider = provider
+	app.Status.Rollout.Message = message
+	return r.Status().Update(ctx, app)
+}
+
+func (r *Reconciler) updateStatusCondition(ctx context.Context, app *v1alpha1.Application,
+	provider v1alpha1.RolloutProvider, condition metav1.Condition) error {
+	if app.Status.Rollout == nil {
+		app.Status.Rollout = &v1alpha1.RolloutStatus{}
+	}
+	meta.SetStatusCondition(&app.Status.Rollout.Conditions, condition)
+	return r.updateStatusMessage(ctx, app, provider, condition.Message)
+}
+
+func (r *Reconciler) getRolloutObject(ctx context.Context, p provider, namespace, name string) (
+	obj *unstructured.Unstructured, err error) {
+	obj = &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(p.groupVersionKind())
+	if err = r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+		obj = nil
+		err = client.IgnoreNotFound(err)
+	}
+	return
+}
+
+// createOrUpdate creates or updates the rollout object, returns the latest one
+func (r *Reconciler) createOrUpdate(ctx context.Context, obj, existing *unstructured.Unstructured) (
+	result *unstructured.Unstructured, err error) {
+	if existing == nil {
+		r.log.Info(fmt.Sprintf("create %s", obj.GetKind()), "namespace", obj.GetNamespace(), "name", obj.GetName())
+		err = r.Create(ctx, obj)
+		result = obj
+		return
+	}
+
+	existing.SetLabels(obj.GetLabels())
+	existing.Object["spec"] = obj.Object["spec"]
+	err = r.Update(ctx, existing)
+	result = existing
+	return
+}
+
+// cleanRollout deletes the rollout objects after the rollout strategy was removed or the Application was deleted
+func (r *Reconciler) cleanRollout(ctx context.Context, app *v1alpha1.Application) (err error) {
+	if !hasFinalizer(app, v1alpha1.RolloutFinalizerName) && app.Status.Rollout == nil {
+		return
+	}
+
+	// the remote destinations are not supported, there is nothing to clean
+	if namespace, nsErr := getDestinationNamespace(app); nsErr == nil {
+		// the provider might be changed, clean the objects of all the providers
+		for _, name := range []v1alpha1.RolloutProvider{v1alpha1.RolloutProviderArgoRollouts, v1alpha1.RolloutProviderFlagger} {
+			if err = r.deleteRolloutObjects(ctx, r.getProvider(name), app, namespace); err != nil {
+				return
+			}
+		}
+	}
+
+	if hasFinalizer(app, v1alpha1.RolloutFinalizerName) {
+		k8sutil.RemoveFinalizer(&app.ObjectMeta, v1alpha1.RolloutFinalizerName)
+		if err = r.Update(ctx, app); err != nil || !app.ObjectMeta.DeletionTimestamp.IsZero() {
+			return
+		}
+	}
+	if app.Status.Rollout != nil {
+		app.Status.Rollout = nil
+		err = r.Status().Update(ctx, app)
+	}
+	return
+}
+
+// deleteRolloutObjects deletes the rollout objects of the Application which are found by the labels
+func (r *Reconciler) deleteRolloutObjects(ctx context.Context, p provider, app *v1alpha1.Application, namespace string) (err error) {
+	list := &unstructured.UnstructuredList{}
+	gvk := p.groupVersionKind()
+	gvk.Kind += "List"
+	list.SetGroupVersionKind(gvk)
+	if err = r.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{
+		v1alpha1.AppNamespaceLabelKey: app.GetNamespace(),
+		v1alpha1.AppNameLabelKey:      app.GetName(),
+	}); err != nil {
+		// the provider might not be installed
+		if meta.IsNoMatchError(err) {
+			err = nil
+		}
+		return
+	}
+
+	for i := range list.Items {
+		r.log.Info(fmt.Sprintf("delete %s", list.Items[i].GetKind()), "name", list.Items[i].GetName())
+		if err = r.Delete(ctx, &list.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return
+		}
+	}
+	err = nil
+	return
+}
+
+// isOwnedBy checks if the rollout object was created for the Application by the labels
+func isOwnedBy(obj *unstructured.Unstructured, app *v1alpha1.Application) bool {
+	labels := obj.GetLabels()
+	return labels[v1alpha1.AppNamespaceLabelKey] == app.GetNamespace() && labels[v1alpha1.AppNameLabelKey] == app.GetName()
+}
+
+func hasFinalizer(app *v1alpha1.Application, finalizer string) bool {
+	for _, item := range app.GetFinalizers() {
+		if item == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// getDestinationNamespace returns the namespace of the workloads of the Application,
+// only the workloads in the cluster of this controller are supported
+func getDestinationNamespace(app *v1alpha1.Application) (namespace string, err error) {
+	namespace = app.GetNamespace()
+	switch {
+	case app.Spec.ArgoApp != nil:
+		dest := app.Spec.ArgoApp.Spec.Destination
+		if (dest.Server != "" && dest.Server != inClusterServer) || (dest.Name != "" && dest.Name != inClusterName) {
+			err = fmt.Errorf("rollout of the remote destination %s%s is not supported", dest.Name, dest.Server)
+			return
+		}
+		if dest.Namespace != "" {
+			namespace = dest.Namespace
+		}
+	case app.Spec.FluxApp != nil && app.Spec.FluxApp.Spec.Config != nil:
+		var destinations []v1alpha1.FluxApplicationDestination
+		config := app.Spec.FluxApp.Spec.Config
+		if config.HelmRelease != nil {
+			for _, deploy := range config.HelmRelease.Deploy {
+				if deploy != nil {
+					destinations = append(destinations, deploy.Destination)
+				}
+			}
+		}
+		for _, kus := range config.Kustomization {
+			if kus != nil {
+				destinations = append(destinations, kus.Destination)
+			}
+		}
+
+		for _, dest := range destinations {
+			if dest.KubeConfig != nil {
+				continue
+			}
+			if dest.TargetNamespace != "" {
+				namespace = dest.TargetNamespace
+			}
+			return
+		}
+		if len(destinations) > 0 {
+			err = fmt.Errorf("rollout of the remote destinations is not supported")
+		}
+	}
+	return
+}
+
+const (
+	inClusterServer = "https://kubernetes.default.svc"
+	inClusterName   = "in-cluster"
+)
+
+func createRolloutObject(p provider, app *v1alpha1.Application, namespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(p.groupVersionKind())
+	obj.SetNamespace(namespace)
+	obj.SetName(app.GetName())
+	// the owner reference does not work across namespaces, the labels are used to find the objects
+	obj.SetLabels(map[string]string{
+		"app.kubernetes.io/managed-by": v1alpha1.GroupName,
+		v1alpha1.AppNamespaceLabelKey:  app.GetNamespace(),
+		v1alpha1.AppNameLabelKey:       app.GetName(),
+	})
+	return obj
+}
+
+// GetName returns the name of this controller
+func (r *Reconciler) GetName() string {
+	return "ApplicationRolloutController"
+}
+
+// GetGroupName returns the group name of this controller
+func (r *Reconciler) GetGroupName() string {
+	return groupName
+}
+
+// SetupWithManager setups the log and recorder
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.log = ctrl.Log.WithName(r.GetName())
+	r.recorder = mgr.GetEventRecorderFor(r.GetName())
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("application_rollout").
+		For(&v1alpha1.Application{}).
+		Complete(r)
+}
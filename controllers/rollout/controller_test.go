@@ -0,0 +1,366 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"kubesphere.io/devops/controllers/core"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	schema := runtime.NewScheme()
+	assert.Nil(t, v1alpha1.AddToScheme(schema))
+	assert.Nil(t, appsv1.AddToScheme(schema))
+	return schema
+}
+
+func int32Ptr(val int32) *int32 {
+	return &val
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	canary := &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+		{SetWeight: int32Ptr(20)},
+		{Pause: &v1alpha1.RolloutPause{}},
+		{SetWeight: int32Ptr(50)},
+	}}
+	createApp := func(rollout *v1alpha1.RolloutStrategy) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "fake-ns",
+				Name:      "fake-app",
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.ArgoCD,
+				ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+					Destination: v1alpha1.ApplicationDestination{
+						Server:    inClusterServer,
+						Namespace: "workload-ns",
+					},
+				}},
+				Rollout: rollout,
+			},
+		}
+	}
+	createArgoRollout := func(phase string, step int64) *unstructured.Unstructured {
+		obj := createRolloutObject(&argoRollouts{}, createApp(nil), "workload-ns")
+		obj.Object["spec"] = map[string]interface{}{"paused": true}
+		obj.Object["status"] = map[string]interface{}{
+			"phase":            phase,
+			"currentStepIndex": step,
+			"pauseConditions":  []interface{}{map[string]interface{}{"reason": "CanaryPauseStep"}},
+		}
+		return obj
+	}
+	getRollout := func(c client.Client, p provider) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(p.groupVersionKind())
+		if err := c.Get(context.Background(), types.NamespacedName{Namespace: "workload-ns", Name: "fake-app"}, obj); err != nil {
+			return nil
+		}
+		return obj
+	}
+	operation := &v1alpha1.RolloutOperation{
+		InitiatedBy: v1alpha1.OperationInitiator{Username: "fake-user"},
+		RequestedAt: metav1.Now(),
+	}
+	withOperation := func(strategy v1alpha1.RolloutStrategy, operationType v1alpha1.RolloutOperationType) *v1alpha1.RolloutStrategy {
+		strategy.Operation = operation.DeepCopy()
+		strategy.Operation.Type = operationType
+		return &strategy
+	}
+
+	tests := []struct {
+		name       string
+		objects    []client.Object
+		wantResult ctrl.Result
+		verify     func(t *testing.T, c client.Client)
+	}{{
+		name:    "application not found",
+		objects: []client.Object{},
+		verify:  func(t *testing.T, c client.Client) {},
+	}, {
+		name:    "no rollout strategy",
+		objects: []client.Object{createApp(nil)},
+		verify: func(t *testing.T, c client.Client) {
+			assert.Nil(t, getRollout(c, &argoRollouts{}))
+		},
+	}, {
+		name: "create the Argo Rollout",
+		objects: []client.Object{createApp(&v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary:    canary,
+		})},
+		wantResult: ctrl.Result{RequeueAfter: progressingRequeuePeriod},
+		verify: func(t *testing.T, c client.Client) {
+			obj := getRollout(c, &argoRollouts{})
+			if assert.NotNil(t, obj) {
+				assert.Equal(t, "fake-app", obj.GetLabels()[v1alpha1.AppNameLabelKey])
+				steps, _, _ := unstructured.NestedSlice(obj.Object, "spec", "strategy", "canary", "steps")
+				assert.Equal(t, 3, len(steps))
+			}
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Contains(t, app.Finalizers, v1alpha1.RolloutFinalizerName)
+			assert.Equal(t, &v1alpha1.RolloutStatus{
+				Provider:   v1alpha1.RolloutProviderArgoRollouts,
+				Phase:      v1alpha1.RolloutPhaseProgressing,
+				TotalSteps: 3,
+				Weight:     20,
+			}, app.Status.Rollout)
+		},
+	}, {
+		name: "promote the Argo Rollout",
+		objects: []client.Object{createApp(withOperation(v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary:    canary,
+		}, v1alpha1.RolloutOperationPromote)), createArgoRollout("Paused", 1)},
+		wantResult: ctrl.Result{RequeueAfter: progressingRequeuePeriod},
+		verify: func(t *testing.T, c client.Client) {
+			obj := getRollout(c, &argoRollouts{})
+			paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused")
+			assert.False(t, paused)
+			_, found, _ := unstructured.NestedSlice(obj.Object, "status", "pauseConditions")
+			assert.False(t, found)
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Nil(t, app.Spec.Rollout.Operation)
+			if assert.NotNil(t, app.Status.Rollout) && assert.NotNil(t, app.Status.Rollout.LastOperation) {
+				assert.Equal(t, v1alpha1.RolloutPhasePaused, app.Status.Rollout.Phase)
+				assert.Equal(t, v1alpha1.RolloutOperationPromote, app.Status.Rollout.LastOperation.Type)
+				assert.Equal(t, "fake-user", app.Status.Rollout.LastOperation.InitiatedBy.Username)
+			}
+		},
+	}, {
+		name: "abort the Argo Rollout",
+		objects: []client.Object{createApp(withOperation(v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary:    canary,
+		}, v1alpha1.RolloutOperationAbort)), createArgoRollout("Paused", 1)},
+		verify: func(t *testing.T, c client.Client) {
+			obj := getRollout(c, &argoRollouts{})
+			aborted, _, _ := unstructured.NestedBool(obj.Object, "status", "abort")
+			assert.True(t, aborted)
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Equal(t, v1alpha1.RolloutPhaseAborted, app.Status.Rollout.Phase)
+		},
+	}, {
+		name: "abort is not supported by Flagger",
+		objects: []client.Object{createApp(withOperation(v1alpha1.RolloutStrategy{
+			Provider:  v1alpha1.RolloutProviderFlagger,
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary:    canary,
+		}, v1alpha1.RolloutOperationAbort))},
+		wantResult: ctrl.Result{RequeueAfter: progressingRequeuePeriod},
+		verify: func(t *testing.T, c client.Client) {
+			assert.NotNil(t, getRollout(c, &flagger{}))
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Nil(t, app.Spec.Rollout.Operation)
+			assert.Contains(t, app.Status.Rollout.Message, "not supported")
+		},
+	}, {
+		name: "refuse to take over the Argo Rollout of others",
+		objects: []client.Object{createApp(&v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary:    canary,
+		}), func() *unstructured.Unstructured {
+			obj := createArgoRollout("Healthy", 3)
+			obj.SetLabels(map[string]string{v1alpha1.AppNameLabelKey: "another-app"})
+			return obj
+		}()},
+		verify: func(t *testing.T, c client.Client) {
+			obj := getRollout(c, &argoRollouts{})
+			if assert.NotNil(t, obj) {
+				assert.Equal(t, "another-app", obj.GetLabels()[v1alpha1.AppNameLabelKey])
+				paused, _, _ := unstructured.NestedBool(obj.Object, "spec", "paused")
+				assert.True(t, paused)
+			}
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			if assert.NotNil(t, app.Status.Rollout) {
+				condition := meta.FindStatusCondition(app.Status.Rollout.Conditions, v1alpha1.RolloutConditionTypeOwned)
+				if assert.NotNil(t, condition) {
+					assert.Equal(t, metav1.ConditionFalse, condition.Status)
+					assert.Equal(t, "Conflict", condition.Reason)
+				}
+			}
+		},
+	}, {
+		name: "remote destination is not supported",
+		objects: []client.Object{func() *v1alpha1.Application {
+			app := createApp(&v1alpha1.RolloutStrategy{
+				TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+				Canary:    canary,
+			})
+			app.Spec.ArgoApp.Spec.Destination.Server = "https://remote"
+			return app
+		}()},
+		verify: func(t *testing.T, c client.Client) {
+			assert.Nil(t, getRollout(c, &argoRollouts{}))
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Contains(t, app.Status.Rollout.Message, "remote destination")
+		},
+	}, {
+		name: "clean the rollout after the strategy was removed",
+		objects: []client.Object{func() *v1alpha1.Application {
+			app := createApp(nil)
+			app.Finalizers = []string{v1alpha1.RolloutFinalizerName}
+			app.Status.Rollout = &v1alpha1.RolloutStatus{Provider: v1alpha1.RolloutProviderArgoRollouts}
+			return app
+		}(), createArgoRollout("Healthy", 3)},
+		verify: func(t *testing.T, c client.Client) {
+			assert.Nil(t, getRollout(c, &argoRollouts{}))
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Nil(t, app.Status.Rollout)
+			assert.NotContains(t, app.Finalizers, v1alpha1.RolloutFinalizerName)
+		},
+	}, {
+		name: "clean the rollout after the Application was deleted",
+		objects: []client.Object{func() *v1alpha1.Application {
+			app := createApp(&v1alpha1.RolloutStrategy{
+				TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+				Canary:    canary,
+			})
+			now := metav1.Now()
+			app.DeletionTimestamp = &now
+			app.Finalizers = []string{v1alpha1.RolloutFinalizerName, "fake-finalizer"}
+			app.Status.Rollout = &v1alpha1.RolloutStatus{Provider: v1alpha1.RolloutProviderArgoRollouts}
+			return app
+		}(), createArgoRollout("Healthy", 3)},
+		verify: func(t *testing.T, c client.Client) {
+			assert.Nil(t, getRollout(c, &argoRollouts{}))
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			assert.Equal(t, []string{"fake-finalizer"}, app.Finalizers)
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(newScheme(t)).WithObjects(tt.objects...).Build()
+			r := &Reconciler{
+				Client:            c,
+				FlaggerLoadTester: "http://flagger-loadtester.test",
+				log:               logr.New(log.NullLogSink{}),
+				recorder:          &record.FakeRecorder{},
+			}
+			result, err := r.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantResult, result)
+			tt.verify(t, c)
+		})
+	}
+}
+
+func Test_getDestinationNamespace(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    v1alpha1.ApplicationSpec
+		want    string
+		wantErr bool
+	}{{
+		name: "Argo CD application without namespace",
+		spec: v1alpha1.ApplicationSpec{ArgoApp: &v1alpha1.ArgoApplication{}},
+		want: "fake-ns",
+	}, {
+		name: "Argo CD application in the cluster",
+		spec: v1alpha1.ApplicationSpec{ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+			Destination: v1alpha1.ApplicationDestination{Name: inClusterName, Namespace: "target"},
+		}}},
+		want: "target",
+	}, {
+		name: "Argo CD application in a remote cluster",
+		spec: v1alpha1.ApplicationSpec{ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+			Destination: v1alpha1.ApplicationDestination{Name: "remote"},
+		}}},
+		wantErr: true,
+	}, {
+		name: "FluxCD application in the cluster",
+		spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+			Config: &v1alpha1.FluxApplicationConfig{Kustomization: []*v1alpha1.KustomizationSpec{{
+				Destination: v1alpha1.FluxApplicationDestination{TargetNamespace: "target"},
+			}}},
+		}}},
+		want: "target",
+	}, {
+		name: "FluxCD application in a remote cluster",
+		spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+			Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{Deploy: []*v1alpha1.Deploy{{
+				Destination: v1alpha1.FluxApplicationDestination{KubeConfig: &helmv2.KubeConfig{}},
+			}}}},
+		}}},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &v1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns"},
+				Spec:       tt.spec,
+			}
+			namespace, err := getDestinationNamespace(app)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, namespace)
+		})
+	}
+}
+
+func TestReconciler_SetupWithManager(t *testing.T) {
+	schema := newScheme(t)
+
+	r := &Reconciler{}
+	assert.Equal(t, "ApplicationRolloutController", r.GetName())
+	assert.Equal(t, groupName, r.GetGroupName())
+	err := r.SetupWithManager(&core.FakeManager{
+		Client: fake.NewFakeClientWithScheme(schema),
+		Scheme: schema,
+	})
+	assert.Nil(t, err)
+}
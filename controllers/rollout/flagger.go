@@ -0,0 +1,240 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultFlaggerServicePort = 80
+	defaultFlaggerInterval    = "1m"
+	defaultFlaggerThreshold   = 5
+	// defaultFlaggerIterations is the number of the analysis iterations of the blue-green rollout
+	defaultFlaggerIterations = 10
+	// flaggerPromotionGate is the name of the confirm-promotion webhook which holds the rollout until it's promoted
+	flaggerPromotionGate = "promotion-gate"
+	// flaggerGateTimeout is the timeout of opening or closing the promotion gate
+	flaggerGateTimeout = 10 * time.Second
+)
+
+// flagger drives the Canary of Flagger, see also https://docs.flagger.app/
+// Flagger runs the analysis automatically, the timed pause steps are converted into the analysis interval
+// and the promotion skips the rest of the analysis.
+// A blue-green rollout without the auto promotion, or a canary rollout with an indefinite pause, waits for the
+// promotion through a confirm-promotion webhook served by the Flagger load tester, see also
+// https://docs.flagger.app/usage/webhooks#manual-gating
+type flagger struct {
+	// loadTester is the base URL of the Flagger load tester, the manual promotion is not supported if it's empty
+	loadTester string
+}
+
+func (f *flagger) groupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Group:   "flagger.app",
+		Version: "v1beta1",
+		Kind:    "Canary",
+	}
+}
+
+func (f *flagger) build(ctx context.Context, c client.Reader, obj, existing *unstructured.Unstructured,
+	strategy *v1alpha1.RolloutStrategy) (err error) {
+	port := int64(defaultFlaggerServicePort)
+	analysis := map[string]interface{}{
+		"interval":  defaultFlaggerInterval,
+		"threshold": int64(defaultFlaggerThreshold),
+	}
+
+	var manualPromotion bool
+	switch {
+	case strategy.Canary != nil:
+		if strategy.Canary.Port > 0 {
+			port = int64(strategy.Canary.Port)
+		}
+		var weights []interface{}
+		var interval time.Duration
+		for _, step := range strategy.Canary.Steps {
+			switch {
+			case step.SetWeight != nil:
+				weights = append(weights, int64(*step.SetWeight))
+			case step.Pause != nil && step.Pause.Duration == nil:
+				// Flagger only confirms the promotion after all the steps
+				manualPromotion = true
+			case step.Pause != nil && step.Pause.Duration.Duration > interval:
+				// the longest pause is taken as the interval between the steps
+				interval = step.Pause.Duration.Duration
+			}
+		}
+		if interval > 0 {
+			analysis["interval"] = interval.String()
+		}
+		if len(weights) == 0 {
+			err = fmt.Errorf("at least one weight is required by the canary strategy of Flagger")
+			return
+		}
+		analysis["stepWeights"] = weights
+	case strategy.BlueGreen != nil:
+		analysis["iterations"] = int64(defaultFlaggerIterations)
+		manualPromotion = !strategy.BlueGreen.AutoPromotion
+	default:
+		err = fmt.Errorf("either canary or blueGreen strategy is required")
+		return
+	}
+	if manualPromotion {
+		if f.loadTester == "" {
+			err = fmt.Errorf("the manual promotion of Flagger requires the Flagger load tester, " +
+				"please set autoPromotion or remove the indefinite pause steps")
+			return
+		}
+		analysis["webhooks"] = []interface{}{map[string]interface{}{
+			"name": flaggerPromotionGate,
+			"type": "confirm-promotion",
+			"url":  f.gateURL("check"),
+		}}
+	}
+
+	spec := map[string]interface{}{
+		"targetRef": getTargetRef(strategy),
+		"service":   map[string]interface{}{"port": port},
+		"analysis":  analysis,
+	}
+	if existing != nil {
+		// keep skipping the analysis until the promoted rollout is finished
+		skip, _, _ := unstructured.NestedBool(existing.Object, "spec", "skipAnalysis")
+		phase, _, _ := unstructured.NestedString(existing.Object, "status", "phase")
+		if skip && phase != "Succeeded" && phase != "Failed" {
+			spec["skipAnalysis"] = true
+		} else if skip && hasPromotionGate(existing) {
+			// the promoted rollout is finished, hold the next one until it's promoted again
+			if err = f.requestGate(ctx, "close", existing); err != nil {
+				return
+			}
+		}
+	}
+	obj.Object["spec"] = spec
+	return
+}
+
+func (f *flagger) operate(ctx context.Context, c client.Client, obj *unstructured.Unstructured,
+	operation v1alpha1.RolloutOperationType) (err error) {
+	if operation != v1alpha1.RolloutOperationPromote {
+		return fmt.Errorf("operation %q is not supported by Flagger", operation)
+	}
+	if hasPromotionGate(obj) {
+		if err = f.requestGate(ctx, "open", obj); err != nil {
+			return
+		}
+	}
+	_ = unstructured.SetNestedField(obj.Object, true, "spec", "skipAnalysis")
+	return c.Update(ctx, obj)
+}
+
+func (f *flagger) gateURL(action string) string {
+	return strings.TrimSuffix(f.loadTester, "/") + "/gate/" + action
+}
+
+// requestGate opens or closes the promotion gate of the Canary in the Flagger load tester
+func (f *flagger) requestGate(ctx context.Context, action string, obj *unstructured.Unstructured) (err error) {
+	if f.loadTester == "" {
+		return fmt.Errorf("the Flagger load tester is not configured")
+	}
+	var payload []byte
+	if payload, err = json.Marshal(map[string]string{
+		"name":      obj.GetName(),
+		"namespace": obj.GetNamespace(),
+	}); err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, flaggerGateTimeout)
+	defer cancel()
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, f.gateURL(action), bytes.NewReader(payload)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var resp *http.Response
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return fmt.Errorf("failed to %s the promotion gate: %v", action, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		err = fmt.Errorf("failed to %s the promotion gate, status code: %d", action, resp.StatusCode)
+	}
+	return
+}
+
+// hasPromotionGate checks if the Canary waits for the promotion through the gate
+func hasPromotionGate(obj *unstructured.Unstructured) bool {
+	webhooks, _, _ := unstructured.NestedSlice(obj.Object, "spec", "analysis", "webhooks")
+	for _, item := range webhooks {
+		if webhook, ok := item.(map[string]interface{}); ok && webhook["name"] == flaggerPromotionGate {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *flagger) status(obj *unstructured.Unstructured, strategy *v1alpha1.RolloutStrategy) (
+	status *v1alpha1.RolloutStatus) {
+	status = &v1alpha1.RolloutStatus{}
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Initialized", "Succeeded":
+		status.Phase = v1alpha1.RolloutPhaseHealthy
+	case "Failed":
+		status.Phase = v1alpha1.RolloutPhaseDegraded
+	case "Waiting", "WaitingPromotion":
+		status.Phase = v1alpha1.RolloutPhasePaused
+	default:
+		status.Phase = v1alpha1.RolloutPhaseProgressing
+	}
+
+	weight, _, _ := unstructured.NestedInt64(obj.Object, "status", "canaryWeight")
+	status.Weight = int32(weight)
+	if conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions"); len(conditions) > 0 {
+		if condition, ok := conditions[0].(map[string]interface{}); ok {
+			status.Message, _, _ = unstructured.NestedString(condition, "message")
+		}
+	}
+
+	if strategy.Canary != nil {
+		for _, step := range strategy.Canary.Steps {
+			if step.SetWeight == nil {
+				continue
+			}
+			status.TotalSteps++
+			if weight > 0 && int64(*step.SetWeight) <= weight {
+				status.CurrentStep++
+			}
+		}
+	}
+	return
+}
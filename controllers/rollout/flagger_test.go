@@ -0,0 +1,264 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_flagger_build(t *testing.T) {
+	targetRef := map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "fake-deploy"}
+	canary := &v1alpha1.RolloutStrategy{
+		TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+		Canary: &v1alpha1.CanaryStrategy{
+			Port: 8080,
+			Steps: []v1alpha1.CanaryStep{
+				{SetWeight: int32Ptr(10)},
+				{Pause: &v1alpha1.RolloutPause{Duration: &metav1.Duration{Duration: 5 * time.Minute}}},
+				{SetWeight: int32Ptr(50)},
+				{Pause: &v1alpha1.RolloutPause{Duration: &metav1.Duration{Duration: 2 * time.Minute}}},
+			},
+		},
+	}
+
+	gate := []interface{}{map[string]interface{}{
+		"name": flaggerPromotionGate,
+		"type": "confirm-promotion",
+		"url":  "http://flagger-loadtester.test/gate/check",
+	}}
+
+	tests := []struct {
+		name         string
+		strategy     *v1alpha1.RolloutStrategy
+		existing     *unstructured.Unstructured
+		noLoadTester bool
+		wantSpec     map[string]interface{}
+		wantErr      bool
+	}{{
+		name:     "canary takes the longest pause as the interval",
+		strategy: canary,
+		wantSpec: map[string]interface{}{
+			"targetRef": targetRef,
+			"service":   map[string]interface{}{"port": int64(8080)},
+			"analysis": map[string]interface{}{
+				"interval":    "5m0s",
+				"threshold":   int64(defaultFlaggerThreshold),
+				"stepWeights": []interface{}{int64(10), int64(50)},
+			},
+		},
+	}, {
+		name: "canary with an indefinite pause waits for the promotion",
+		strategy: &v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+				{SetWeight: int32Ptr(10)},
+				{Pause: &v1alpha1.RolloutPause{}},
+			}},
+		},
+		wantSpec: map[string]interface{}{
+			"targetRef": targetRef,
+			"service":   map[string]interface{}{"port": int64(defaultFlaggerServicePort)},
+			"analysis": map[string]interface{}{
+				"interval":    defaultFlaggerInterval,
+				"threshold":   int64(defaultFlaggerThreshold),
+				"stepWeights": []interface{}{int64(10)},
+				"webhooks":    gate,
+			},
+		},
+	}, {
+		name: "blue-green waits for the promotion",
+		strategy: &v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			BlueGreen: &v1alpha1.BlueGreenStrategy{ActiveService: "active"},
+		},
+		wantSpec: map[string]interface{}{
+			"targetRef": targetRef,
+			"service":   map[string]interface{}{"port": int64(defaultFlaggerServicePort)},
+			"analysis": map[string]interface{}{
+				"interval":   defaultFlaggerInterval,
+				"threshold":  int64(defaultFlaggerThreshold),
+				"iterations": int64(defaultFlaggerIterations),
+				"webhooks":   gate,
+			},
+		},
+	}, {
+		name: "blue-green with the auto promotion",
+		strategy: &v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			BlueGreen: &v1alpha1.BlueGreenStrategy{ActiveService: "active", AutoPromotion: true},
+		},
+		noLoadTester: true,
+		wantSpec: map[string]interface{}{
+			"targetRef": targetRef,
+			"service":   map[string]interface{}{"port": int64(defaultFlaggerServicePort)},
+			"analysis": map[string]interface{}{
+				"interval":   defaultFlaggerInterval,
+				"threshold":  int64(defaultFlaggerThreshold),
+				"iterations": int64(defaultFlaggerIterations),
+			},
+		},
+	}, {
+		name: "manual promotion without the load tester",
+		strategy: &v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			BlueGreen: &v1alpha1.BlueGreenStrategy{ActiveService: "active"},
+		},
+		noLoadTester: true,
+		wantErr:      true,
+	}, {
+		name: "keep skipping the analysis of the promoted canary",
+		strategy: &v1alpha1.RolloutStrategy{
+			TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+			BlueGreen: &v1alpha1.BlueGreenStrategy{ActiveService: "active", AutoPromotion: true},
+		},
+		existing: &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec":   map[string]interface{}{"skipAnalysis": true},
+			"status": map[string]interface{}{"phase": "Progressing"},
+		}},
+		wantSpec: map[string]interface{}{
+			"targetRef": targetRef,
+			"service":   map[string]interface{}{"port": int64(defaultFlaggerServicePort)},
+			"analysis": map[string]interface{}{
+				"interval":   defaultFlaggerInterval,
+				"threshold":  int64(defaultFlaggerThreshold),
+				"iterations": int64(defaultFlaggerIterations),
+			},
+			"skipAnalysis": true,
+		},
+	}, {
+		name: "canary without weights",
+		strategy: &v1alpha1.RolloutStrategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+			{Pause: &v1alpha1.RolloutPause{}},
+		}}},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			f := &flagger{loadTester: "http://flagger-loadtester.test"}
+			if tt.noLoadTester {
+				f.loadTester = ""
+			}
+			err := f.build(context.Background(), nil, obj, tt.existing, tt.strategy)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantSpec, obj.Object["spec"])
+		})
+	}
+}
+
+func Test_flagger_status(t *testing.T) {
+	strategy := &v1alpha1.RolloutStrategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{
+		{SetWeight: int32Ptr(10)},
+		{SetWeight: int32Ptr(30)},
+		{SetWeight: int32Ptr(50)},
+	}}}
+
+	tests := []struct {
+		name   string
+		status map[string]interface{}
+		want   *v1alpha1.RolloutStatus
+	}{{
+		name: "progressing",
+		status: map[string]interface{}{
+			"phase":        "Progressing",
+			"canaryWeight": int64(30),
+			"conditions":   []interface{}{map[string]interface{}{"message": "Canary analysis in progress"}},
+		},
+		want: &v1alpha1.RolloutStatus{
+			Phase:       v1alpha1.RolloutPhaseProgressing,
+			CurrentStep: 2,
+			TotalSteps:  3,
+			Weight:      30,
+			Message:     "Canary analysis in progress",
+		},
+	}, {
+		name:   "waiting for the promotion",
+		status: map[string]interface{}{"phase": "WaitingPromotion", "canaryWeight": int64(50)},
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhasePaused, CurrentStep: 3, TotalSteps: 3, Weight: 50},
+	}, {
+		name:   "succeeded",
+		status: map[string]interface{}{"phase": "Succeeded"},
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseHealthy, TotalSteps: 3},
+	}, {
+		name:   "failed",
+		status: map[string]interface{}{"phase": "Failed"},
+		want:   &v1alpha1.RolloutStatus{Phase: v1alpha1.RolloutPhaseDegraded, TotalSteps: 3},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{"status": tt.status}}
+			assert.Equal(t, tt.want, (&flagger{}).status(obj, strategy))
+		})
+	}
+}
+
+func Test_flagger_promotionGate(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.URL.Path+" "+string(data))
+	}))
+	defer server.Close()
+
+	f := &flagger{loadTester: server.URL}
+	strategy := &v1alpha1.RolloutStrategy{
+		TargetRef: v1alpha1.RolloutTargetReference{Name: "fake-deploy"},
+		BlueGreen: &v1alpha1.BlueGreenStrategy{ActiveService: "active"},
+	}
+	canary := &unstructured.Unstructured{}
+	canary.SetGroupVersionKind(f.groupVersionKind())
+	canary.SetNamespace("fake-ns")
+	canary.SetName("fake-app")
+	assert.Nil(t, f.build(context.Background(), nil, canary, nil, strategy))
+	assert.True(t, hasPromotionGate(canary))
+
+	schema := runtime.NewScheme()
+	c := fake.NewClientBuilder().WithScheme(schema).WithObjects(canary.DeepCopy()).Build()
+	assert.Nil(t, c.Get(context.Background(), client.ObjectKeyFromObject(canary), canary))
+	assert.Nil(t, f.operate(context.Background(), c, canary, v1alpha1.RolloutOperationPromote))
+	assert.Equal(t, []string{`/gate/open {"name":"fake-app","namespace":"fake-ns"}`}, requests)
+
+	// keep the gate open until the promoted rollout is finished
+	_ = unstructured.SetNestedField(canary.Object, "Progressing", "status", "phase")
+	obj := canary.DeepCopy()
+	assert.Nil(t, f.build(context.Background(), nil, obj, canary, strategy))
+	assert.Equal(t, 1, len(requests))
+
+	_ = unstructured.SetNestedField(canary.Object, "Succeeded", "status", "phase")
+	obj = canary.DeepCopy()
+	assert.Nil(t, f.build(context.Background(), nil, obj, canary, strategy))
+	assert.Equal(t, `/gate/close {"name":"fake-app","namespace":"fake-ns"}`, requests[len(requests)-1])
+	skip, _, _ := unstructured.NestedBool(obj.Object, "spec", "skipAnalysis")
+	assert.False(t, skip)
+}
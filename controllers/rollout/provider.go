@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rollout
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// provider is the abstraction of a progressive delivery controller
+type provider interface {
+	// groupVersionKind returns the GVK of the rollout object
+	groupVersionKind() schema.GroupVersionKind
+	// build sets the spec of the rollout object according to the strategy, existing is nil if it was not created
+	build(ctx context.Context, c client.Reader, obj, existing *unstructured.Unstructured, strategy *v1alpha1.RolloutStrategy) error
+	// operate promotes or aborts the rollout
+	operate(ctx context.Context, c client.Client, obj *unstructured.Unstructured, operation v1alpha1.RolloutOperationType) error
+	// status returns the progress of the rollout
+	status(obj *unstructured.Unstructured, strategy *v1alpha1.RolloutStrategy) *v1alpha1.RolloutStatus
+}
+
+// getProvider returns the provider, nil means it's not supported
+func (r *Reconciler) getProvider(name v1alpha1.RolloutProvider) provider {
+	switch name {
+	case v1alpha1.RolloutProviderArgoRollouts:
+		return &argoRollouts{}
+	case v1alpha1.RolloutProviderFlagger:
+		return &flagger{loadTester: r.FlaggerLoadTester}
+	}
+	return nil
+}
+
+func getTargetRef(strategy *v1alpha1.RolloutStrategy) map[string]interface{} {
+	ref := strategy.TargetRef
+	if ref.APIVersion == "" {
+		ref.APIVersion = "apps/v1"
+	}
+	if ref.Kind == "" {
+		ref.Kind = "Deployment"
+	}
+	return map[string]interface{}{
+		"apiVersion": ref.APIVersion,
+		"kind":       ref.Kind,
+		"name":       ref.Name,
+	}
+}
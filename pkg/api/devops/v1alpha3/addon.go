@@ -31,12 +31,51 @@ type AddonSpec struct {
 
 // AddonStatus represents the status of an addon
 type AddonStatus struct {
-	Phase string `json:"phase,omitempty"`
+	Phase AddonPhase `json:"phase,omitempty"`
+	// Conditions are the latest observations of the addon installation
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Resources are the objects installed by the addon, they will be removed once the addon is deleted
+	Resources []v1.ObjectReference `json:"resources,omitempty"`
+	// InstalledVersion is the version which was installed lately, it might be a step of the upgrade path
+	InstalledVersion string `json:"installedVersion,omitempty"`
+	// RunningVersion is the version reported by the health check
+	RunningVersion string `json:"runningVersion,omitempty"`
 }
 
+// AddonPhase represents the phase of an addon
+type AddonPhase string
+
+const (
+	// AddonPhaseInstalled indicates that all resources of the addon were installed or upgraded
+	AddonPhaseInstalled AddonPhase = "Installed"
+	// AddonPhaseReady indicates that the addon passed the health check
+	AddonPhaseReady AddonPhase = "Ready"
+	// AddonPhaseUpgrading indicates that the addon is being upgraded to the desired version
+	AddonPhaseUpgrading AddonPhase = "Upgrading"
+	// AddonPhaseDegraded indicates that the installed addon does not work
+	AddonPhaseDegraded AddonPhase = "Degraded"
+	// AddonPhaseFailed indicates that the addon failed to be installed or upgraded
+	AddonPhaseFailed AddonPhase = "Failed"
+	// AddonPhaseTerminating indicates that the resources of the addon are being removed
+	AddonPhaseTerminating AddonPhase = "Terminating"
+)
+
+const (
+	// AddonConditionTypeInstalled is the condition type which indicates whether the addon was installed
+	AddonConditionTypeInstalled = "Installed"
+	// AddonConditionTypeReady is the condition type which indicates whether the addon passed the health check
+	AddonConditionTypeReady = "Ready"
+	// AddonConditionTypeUpgradeInProgress is the condition type which indicates whether the running version
+	// is different from the desired one
+	AddonConditionTypeUpgradeInProgress = "UpgradeInProgress"
+	// AddonConditionTypeDegraded is the condition type which indicates whether the installed addon does not work
+	AddonConditionTypeDegraded = "Degraded"
+)
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`,description="The version of target addon"
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="The phase of target addon"
 // +kubebuilder:object:root=true
 // +k8s:openapi-gen=true
 
@@ -31,6 +31,35 @@ type AddStrategySpec struct {
 	HelmRepo       string               `json:"helmRepo,omitempty"`
 	Template       string               `json:"template,omitempty"`
 	Parameters     map[string]string    `json:"parameters,omitempty"`
+	// Chart is the name of the chart in HelmRepo. The last element of HelmRepo
+	// is taken as the chart name if it is empty, e.g. https://charts.jenkins.io/jenkins
+	Chart string `json:"chart,omitempty"`
+	// HealthCheck describes how to check the readiness and the running version through the ExternalAddress of an addon
+	HealthCheck *AddonHealthCheck `json:"healthCheck,omitempty"`
+	// UpgradePath is the ordered versions of the addon. An upgrade goes through every version between the
+	// installed one and the desired one, and each of them should be ready before moving to the next one.
+	// The HealthCheck needs to report the running version, otherwise the upgrade waits at the installed version
+	UpgradePath []string `json:"upgradePath,omitempty"`
+	// AllowClusterScoped indicates if the YAML could contain the cluster-scoped resources. The namespaced resources
+	// are always installed into the namespace of the addon. Please notice that the controller only has the
+	// permissions of a few common kinds, the extra ones need to be granted by the cluster administrator
+	AllowClusterScoped bool `json:"allowClusterScoped,omitempty"`
+}
+
+// AddonHealthCheck is the readiness probe of an addon
+type AddonHealthCheck struct {
+	// Path of the readiness probe, the addon is ready if the response status code is 2xx
+	Path string `json:"path,omitempty"`
+	// VersionHeader is the response header of the readiness probe which contains the running version, e.g. X-Jenkins
+	VersionHeader string `json:"versionHeader,omitempty"`
+	// VersionPath is the path to get the running version, the response body is taken as the version
+	VersionPath string `json:"versionPath,omitempty"`
+	// VersionField is the dot-separated field of the JSON response of VersionPath which contains the version
+	VersionField string `json:"versionField,omitempty"`
+	// PeriodSeconds is how often to perform the probe, defaults to 60 seconds
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// TimeoutSeconds is the timeout of the probe, defaults to 10 seconds
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
 }
 
 // AddonInstallStrategy represents the addon installation strategy
@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AgentTemplateSpec is the specification of a Jenkins agent template
+type AgentTemplateSpec struct {
+	// Labels are the Jenkins agent labels which could be used to select this agent in a Pipeline
+	Labels []string `json:"labels,omitempty"`
+	// Containers are the containers of the agent pod
+	Containers []AgentContainer `json:"containers"`
+	// NodeSelector is the node selector of the agent pod
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// Tolerations are the tolerations of the agent pod
+	Tolerations []v1.Toleration `json:"tolerations,omitempty"`
+	// Volumes are the volumes of the agent pod, they could be mounted by the containers
+	Volumes []AgentVolume `json:"volumes,omitempty"`
+	// IdleMinutes is how long the agent pod will be kept after a build, it will be removed immediately by default
+	IdleMinutes int `json:"idleMinutes,omitempty"`
+	// InheritFrom is the name of a cluster-wide template which this template inherits from
+	InheritFrom string `json:"inheritFrom,omitempty"`
+}
+
+// AgentContainer is a container of the Jenkins agent pod
+type AgentContainer struct {
+	Name       string   `json:"name"`
+	Image      string   `json:"image"`
+	Command    []string `json:"command,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	Privileged bool     `json:"privileged,omitempty"`
+	// Resources are the compute resources of the container
+	Resources    v1.ResourceRequirements `json:"resources,omitempty"`
+	VolumeMounts []v1.VolumeMount        `json:"volumeMounts,omitempty"`
+}
+
+// AgentVolume is a volume of the Jenkins agent pod. It is an empty dir if no source is set.
+type AgentVolume struct {
+	Name string `json:"name"`
+	// HostPath is the path of the host directory
+	HostPath string `json:"hostPath,omitempty"`
+	// PersistentVolumeClaim is the name of a PersistentVolumeClaim in the agent namespace
+	PersistentVolumeClaim string `json:"persistentVolumeClaim,omitempty"`
+	// ConfigMap is the name of a ConfigMap in the agent namespace
+	ConfigMap string `json:"configMap,omitempty"`
+	// Secret is the name of a Secret in the agent namespace
+	Secret string `json:"secret,omitempty"`
+}
+
+// AgentTemplateStatus represents the status of an agent template
+type AgentTemplateStatus struct {
+	Phase AgentTemplatePhase `json:"phase,omitempty"`
+	// Message is the reason of the failure
+	Message string `json:"message,omitempty"`
+	// TemplateName is the name of the pod template in Jenkins
+	TemplateName string `json:"templateName,omitempty"`
+	// Labels are the Jenkins agent labels of the pod template
+	Labels []string `json:"labels,omitempty"`
+}
+
+// AgentTemplatePhase represents the phase of an agent template
+type AgentTemplatePhase string
+
+const (
+	// AgentTemplatePhaseSynced indicates that the template was rendered into the Jenkins configuration
+	AgentTemplatePhaseSynced AgentTemplatePhase = "Synced"
+	// AgentTemplatePhaseFailed indicates that the template could not be rendered into the Jenkins configuration
+	AgentTemplatePhaseFailed AgentTemplatePhase = "Failed"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Labels",type=string,JSONPath=`.status.labels`,description="The Jenkins agent labels"
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`,description="The phase of the agent template"
+
+// AgentTemplate is the Schema for the agenttemplates API. A template in the system namespace is
+// available to all DevOpsProjects, a template in a DevOpsProject is available to the project only.
+type AgentTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AgentTemplateSpec   `json:"spec,omitempty"`
+	Status AgentTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AgentTemplateList contains a list of AgentTemplate
+type AgentTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AgentTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AgentTemplate{}, &AgentTemplateList{})
+}
@@ -67,6 +67,74 @@ const (
 	SecretTypeKubeConfig v1.SecretType = DevOpsCredentialPrefix + "kubeconfig"
 	// KubeConfigSecretKey is the key of the secret for SecretTypeKubeConfig secrets
 	KubeConfigSecretKey = "content"
+
+	// SecretTypeGitHubApp contains data needed for authenticating as a GitHub App.
+	//
+	// Required fields:
+	// - Secret.Data["app_id"] - the ID of the GitHub App
+	// - Secret.Data["private_key"] - the PEM encoded private key of the GitHub App
+	// Optional fields:
+	// - Secret.Data["owner"] - the organization or user which the App is installed to
+	// - Secret.Data["api_url"] - the GitHub API endpoint, for GitHub Enterprise
+	SecretTypeGitHubApp v1.SecretType = DevOpsCredentialPrefix + "github-app"
+	// GitHubAppIDKey is the key of the App ID for SecretTypeGitHubApp secrets
+	GitHubAppIDKey = "app_id"
+	// GitHubAppPrivateKey is the key of the private key for SecretTypeGitHubApp secrets
+	GitHubAppPrivateKey = "private_key"
+	// GitHubAppOwnerKey is the key of the owner for SecretTypeGitHubApp secrets
+	GitHubAppOwnerKey = "owner"
+	// GitHubAppAPIURLKey is the key of the API endpoint for SecretTypeGitHubApp secrets
+	GitHubAppAPIURLKey = "api_url"
+
+	// SecretTypeDockerConfig contains a Docker registry config.
+	//
+	// Required fields:
+	// - Secret.Data[".dockerconfigjson"] - the content of a Docker config.json file
+	SecretTypeDockerConfig v1.SecretType = DevOpsCredentialPrefix + "docker-config"
+	// DockerConfigJSONKey is the key of the Docker config for SecretTypeDockerConfig secrets
+	DockerConfigJSONKey = v1.DockerConfigJsonKey
+
+	// SecretTypeCertificate contains an X.509 client certificate.
+	//
+	// Required one of the following groups of fields:
+	// - Secret.Data["keystore"] - a PKCS#12 keystore, with Secret.Data["password"] as its password
+	// - Secret.Data["certificate"] and Secret.Data["private_key"] - a PEM encoded certificate chain and private key
+	SecretTypeCertificate v1.SecretType = DevOpsCredentialPrefix + "certificate"
+	// CertificateKeyStoreKey is the key of the PKCS#12 keystore for SecretTypeCertificate secrets
+	CertificateKeyStoreKey = "keystore"
+	// CertificatePasswordKey is the key of the keystore password for SecretTypeCertificate secrets
+	CertificatePasswordKey = "password"
+	// CertificateCertKey is the key of the PEM encoded certificate chain for SecretTypeCertificate secrets
+	CertificateCertKey = "certificate"
+	// CertificatePrivateKey is the key of the PEM encoded private key for SecretTypeCertificate secrets
+	CertificatePrivateKey = "private_key"
+
+	// SecretTypeAWSAccessKey contains data needed for AWS authentication.
+	//
+	// Required fields:
+	// - Secret.Data["access_key_id"] - the access key ID
+	// - Secret.Data["secret_access_key"] - the secret access key
+	// Optional fields:
+	// - Secret.Data["role_arn"] - the ARN of an IAM role to assume
+	SecretTypeAWSAccessKey v1.SecretType = DevOpsCredentialPrefix + "aws-access-key"
+	// AWSAccessKeyIDKey is the key of the access key ID for SecretTypeAWSAccessKey secrets
+	AWSAccessKeyIDKey = "access_key_id"
+	// AWSSecretAccessKey is the key of the secret access key for SecretTypeAWSAccessKey secrets
+	AWSSecretAccessKey = "secret_access_key"
+	// AWSRoleARNKey is the key of the IAM role ARN for SecretTypeAWSAccessKey secrets
+	AWSRoleARNKey = "role_arn"
+
+	// SecretTypeFile contains a file.
+	//
+	// Required fields:
+	// - Secret.Data["content"] - the content of the file
+	// Optional fields:
+	// - Secret.Data["filename"] - the name of the file, the secret name will be used if it's empty
+	SecretTypeFile v1.SecretType = DevOpsCredentialPrefix + "file"
+	// FileContentKey is the key of the file content for SecretTypeFile secrets
+	FileContentKey = "content"
+	// FileNameKey is the key of the file name for SecretTypeFile secrets
+	FileNameKey = "filename"
 	//	CredentialAutoSyncAnnoKey is used to indicate whether the secret is automatically synchronized to devops.
 	//	In the old version, the credential is stored in jenkins and cannot be obtained.
 	//	This field is set to ensure that the secret is not overwritten by a nil value.
@@ -81,6 +149,11 @@ var supportedCredentialTypes = []v1.SecretType{
 	SecretTypeSSHAuth,
 	SecretTypeSecretText,
 	SecretTypeKubeConfig,
+	SecretTypeGitHubApp,
+	SecretTypeDockerConfig,
+	SecretTypeCertificate,
+	SecretTypeAWSAccessKey,
+	SecretTypeFile,
 }
 
 // GetSupportedCredentialTypes gets all supported credential types. The return value is unmodifiable.
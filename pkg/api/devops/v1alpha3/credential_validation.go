@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha3
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// ValidateCredential checks if the data of a credential matches its type. The data in stringData is taken into account.
+// Only the types which were added along with the validation are checked, the other ones keep being accepted as before.
+func ValidateCredential(secret *v1.Secret) error {
+	if secret == nil || !strings.HasPrefix(string(secret.Type), DevOpsCredentialPrefix) {
+		return nil
+	}
+	secret = mergeStringData(secret)
+
+	switch secret.Type {
+	case SecretTypeGitHubApp:
+		return validateGitHubApp(secret)
+	case SecretTypeDockerConfig:
+		return validateDockerConfig(secret)
+	case SecretTypeCertificate:
+		return validateCertificate(secret)
+	case SecretTypeAWSAccessKey:
+		return validateAWSAccessKey(secret)
+	case SecretTypeFile:
+		return validateFile(secret)
+	}
+	return nil
+}
+
+// mergeStringData returns a copy of the Secret which contains the stringData in its data, the same as the API server does
+func mergeStringData(secret *v1.Secret) *v1.Secret {
+	if len(secret.StringData) == 0 {
+		return secret
+	}
+	merged := secret.DeepCopy()
+	if merged.Data == nil {
+		merged.Data = map[string][]byte{}
+	}
+	for key, val := range merged.StringData {
+		merged.Data[key] = []byte(val)
+	}
+	merged.StringData = nil
+	return merged
+}
+
+func requireAll(secret *v1.Secret, keys ...string) error {
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			return fmt.Errorf("field %s is required by credential type %s", key, secret.Type)
+		}
+	}
+	return nil
+}
+
+func validateGitHubApp(secret *v1.Secret) (err error) {
+	if err = requireAll(secret, GitHubAppIDKey, GitHubAppPrivateKey); err != nil {
+		return
+	}
+	if _, err = strconv.ParseUint(string(secret.Data[GitHubAppIDKey]), 10, 64); err != nil {
+		return fmt.Errorf("field %s must be a number", GitHubAppIDKey)
+	}
+	if block, _ := pem.Decode(secret.Data[GitHubAppPrivateKey]); block == nil {
+		return fmt.Errorf("field %s must be a PEM encoded private key", GitHubAppPrivateKey)
+	}
+	return
+}
+
+func validateDockerConfig(secret *v1.Secret) (err error) {
+	if err = requireAll(secret, DockerConfigJSONKey); err != nil {
+		return
+	}
+	config := struct {
+		Auths map[string]json.RawMessage `json:"auths"`
+	}{}
+	if err = json.Unmarshal(secret.Data[DockerConfigJSONKey], &config); err != nil {
+		return fmt.Errorf("field %s is not a valid Docker config: %v", DockerConfigJSONKey, err)
+	}
+	if len(config.Auths) == 0 {
+		return fmt.Errorf("field %s must contain at least one registry in auths", DockerConfigJSONKey)
+	}
+	return
+}
+
+func validateCertificate(secret *v1.Secret) (err error) {
+	if len(secret.Data[CertificateKeyStoreKey]) > 0 {
+		if len(secret.Data[CertificateCertKey]) > 0 || len(secret.Data[CertificatePrivateKey]) > 0 {
+			return fmt.Errorf("field %s cannot be used together with %s or %s",
+				CertificateKeyStoreKey, CertificateCertKey, CertificatePrivateKey)
+		}
+		return
+	}
+
+	if err = requireAll(secret, CertificateCertKey, CertificatePrivateKey); err != nil {
+		return fmt.Errorf("credential type %s requires either field %s or fields %s and %s",
+			secret.Type, CertificateKeyStoreKey, CertificateCertKey, CertificatePrivateKey)
+	}
+	if block, _ := pem.Decode(secret.Data[CertificateCertKey]); block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("field %s must be a PEM encoded certificate", CertificateCertKey)
+	}
+	if block, _ := pem.Decode(secret.Data[CertificatePrivateKey]); block == nil {
+		return fmt.Errorf("field %s must be a PEM encoded private key", CertificatePrivateKey)
+	}
+	return
+}
+
+func validateAWSAccessKey(secret *v1.Secret) (err error) {
+	if err = requireAll(secret, AWSAccessKeyIDKey, AWSSecretAccessKey); err != nil {
+		return
+	}
+	if roleARN := string(secret.Data[AWSRoleARNKey]); roleARN != "" && !strings.HasPrefix(roleARN, "arn:") {
+		return fmt.Errorf("field %s must be an ARN", AWSRoleARNKey)
+	}
+	return
+}
+
+func validateFile(secret *v1.Secret) (err error) {
+	if err = requireAll(secret, FileContentKey); err != nil {
+		return
+	}
+	if strings.ContainsAny(string(secret.Data[FileNameKey]), `/\`) {
+		return fmt.Errorf("field %s cannot contain path separators", FileNameKey)
+	}
+	return
+}
@@ -36,6 +36,25 @@ const (
 // DevOpsProjectSpec defines the desired state of DevOpsProject
 type DevOpsProjectSpec struct {
 	Argo *Argo `json:"argo,omitempty"`
+	// SyncWindows controls when the Applications of this project can be synced,
+	// they are enforced for both Argo CD and FluxCD Applications
+	SyncWindows SyncWindows `json:"syncWindows,omitempty"`
+	// ChangeFreezes are the periods during which the Applications of this project cannot be synced
+	ChangeFreezes []ChangeFreeze `json:"changeFreezes,omitempty"`
+}
+
+// ChangeFreeze is a period during which all the syncs of the matched Applications are blocked
+type ChangeFreeze struct {
+	// Name is the name of this change freeze
+	Name string `json:"name,omitempty"`
+	// Reason explains why the changes are frozen
+	Reason string `json:"reason,omitempty"`
+	// Start is the time the change freeze begins
+	Start metav1.Time `json:"start"`
+	// End is the time the change freeze ends
+	End metav1.Time `json:"end"`
+	// Applications contains a list of applications that the change freeze will apply to, all the applications by default
+	Applications []string `json:"applications,omitempty"`
 }
 
 // Argo represents the Argo CD specification
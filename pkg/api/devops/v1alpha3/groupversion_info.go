@@ -30,12 +30,26 @@ const (
 	JenkinsPipelineRunStatusAnnoKey = devops.GroupName + "/jenkins-pipelinerun-status"
 	// JenkinsPipelineRunStagesStatusAnnoKey is annotation key of Jenkins stages' status of Jenkins PipelineRun.
 	JenkinsPipelineRunStagesStatusAnnoKey = devops.GroupName + "/jenkins-pipelinerun-stages-status"
+	// JenkinsPipelineRunEventAnnoKey is annotation key of the latest Jenkins event type received by the PipelineRun.
+	JenkinsPipelineRunEventAnnoKey = devops.GroupName + "/jenkins-pipelinerun-event"
 	// PipelineRunOrphanLabelKey is label key of orphan Jenkins PipelineRun which type of value is bool.
 	PipelineRunOrphanLabelKey = devops.GroupName + "/jenkins-pipelinerun-orphan"
 	// PipelineNameLabelKey is label key of Pipeline name.
 	PipelineNameLabelKey = devops.GroupName + "/pipeline"
 	// PipelineRunCreatorAnnoKey is annotation key of PipelineRun's creator
 	PipelineRunCreatorAnnoKey = devops.GroupName + "/creator"
+	// PipelineRunRerunOfAnnoKey is annotation key of the original PipelineRun name which the PipelineRun reruns.
+	PipelineRunRerunOfAnnoKey = devops.GroupName + "/rerun-of"
+	// PipelineRunRerunOfLabelKey is label key of the original PipelineRun name which the PipelineRun reruns, it's used
+	// to select the reruns. A name longer than the limit of a label value is truncated and ends with its hash.
+	PipelineRunRerunOfLabelKey = devops.GroupName + "/rerun-of"
+	// PipelineRunRestartStageAnnoKey is annotation key of the stage name from which the PipelineRun restarts.
+	PipelineRunRestartStageAnnoKey = devops.GroupName + "/restart-stage"
+	// PipelineRunRestartRunIDAnnoKey is annotation key of the Jenkins run ID which the PipelineRun restarts from.
+	PipelineRunRestartRunIDAnnoKey = devops.GroupName + "/restart-run-id"
+	// PipelineRunRestartLocationAnnoKey is annotation key of the location which Jenkins redirects to after restarting,
+	// it's the queue item or the build of the restarted PipelineRun.
+	PipelineRunRestartLocationAnnoKey = devops.GroupName + "/restart-location"
 	// PipelineRunSCMRefNameField is the field name of SCM reference name in PipelineRun spec.
 	PipelineRunSCMRefNameField = "spec.scm.ref-name"
 	// PipelineRunIdentifierIndexerName is an indexer name of PipelineRun identifier.
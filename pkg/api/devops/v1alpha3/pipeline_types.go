@@ -64,6 +64,63 @@ type PipelineSpec struct {
 	Type                PipelineType         `json:"type" description:"type of devops pipeline, in scm or no scm"`
 	Pipeline            *NoScmPipeline       `json:"pipeline,omitempty" description:"no scm pipeline structs"`
 	MultiBranchPipeline *MultiBranchPipeline `json:"multi_branch_pipeline,omitempty" description:"in scm pipeline structs"`
+	// ConcurrencyPolicy specifies how to treat concurrent PipelineRuns of this Pipeline.
+	// +optional
+	ConcurrencyPolicy *ConcurrencyPolicy `json:"concurrency_policy,omitempty" description:"concurrency policy of PipelineRuns"`
+}
+
+// ConcurrencyPolicyType describes how to treat a new PipelineRun when there are still PipelineRuns running.
+// +kubebuilder:validation:Enum=Allow;Forbid;Replace;Queue
+type ConcurrencyPolicyType string
+
+const (
+	// AllowConcurrent allows PipelineRuns to run concurrently.
+	AllowConcurrent ConcurrencyPolicyType = "Allow"
+	// ForbidConcurrent forbids concurrent runs, skipping the new PipelineRun if the previous one hasn't finished yet.
+	ForbidConcurrent ConcurrencyPolicyType = "Forbid"
+	// ReplaceConcurrent cancels the running PipelineRuns and replaces them with the new one.
+	ReplaceConcurrent ConcurrencyPolicyType = "Replace"
+	// QueueConcurrent keeps the new PipelineRun pending until the previous ones have finished.
+	QueueConcurrent ConcurrencyPolicyType = "Queue"
+)
+
+// ConcurrencyPolicy specifies how to treat concurrent PipelineRuns. PipelineRuns of different SCM references,
+// such as the branches of a multi-branch Pipeline or the pull requests which trigger a Pipeline, are not considered as concurrent.
+type ConcurrencyPolicy struct {
+	// Type is the type of the concurrency policy, Allow is the default one.
+	// +optional
+	Type ConcurrencyPolicyType `json:"type,omitempty" description:"type of concurrency policy, Allow, Forbid, Replace or Queue"`
+	// MaxQueueDepth is the maximum number of queued PipelineRuns, only works with Queue type.
+	// The new PipelineRuns will be skipped when the queue is full. Zero means no limit.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxQueueDepth int `json:"max_queue_depth,omitempty" description:"maximum number of queued PipelineRuns, zero means no limit"`
+}
+
+// GetConcurrencyPolicyType returns the type of the concurrency policy, Allow is the default one.
+func (p *PipelineSpec) GetConcurrencyPolicyType() ConcurrencyPolicyType {
+	if p == nil || p.ConcurrencyPolicy == nil || p.ConcurrencyPolicy.Type == "" {
+		return AllowConcurrent
+	}
+	return p.ConcurrencyPolicy.Type
+}
+
+// GetDiscarder returns the discarder of the Pipeline according to its type, nil means no discarder.
+func (p *PipelineSpec) GetDiscarder() *DiscarderProperty {
+	if p == nil {
+		return nil
+	}
+	switch p.Type {
+	case NoScmPipelineType:
+		if p.Pipeline != nil {
+			return p.Pipeline.Discarder
+		}
+	case MultiBranchPipelineType:
+		if p.MultiBranchPipeline != nil {
+			return p.MultiBranchPipeline.Discarder
+		}
+	}
+	return nil
 }
 
 // PipelineStatus defines the observed state of Pipeline
@@ -124,3 +124,61 @@ func TestMultiBranchPipeline_GetGitURL(t *testing.T) {
 		})
 	}
 }
+
+func TestPipelineSpec_GetConcurrencyPolicyType(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *PipelineSpec
+		want ConcurrencyPolicyType
+	}{{
+		name: "nil spec",
+		want: AllowConcurrent,
+	}, {
+		name: "nil policy",
+		spec: &PipelineSpec{},
+		want: AllowConcurrent,
+	}, {
+		name: "empty type",
+		spec: &PipelineSpec{ConcurrencyPolicy: &ConcurrencyPolicy{MaxQueueDepth: 1}},
+		want: AllowConcurrent,
+	}, {
+		name: "queue",
+		spec: &PipelineSpec{ConcurrencyPolicy: &ConcurrencyPolicy{Type: QueueConcurrent}},
+		want: QueueConcurrent,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.spec.GetConcurrencyPolicyType())
+		})
+	}
+}
+
+func TestPipelineSpec_GetDiscarder(t *testing.T) {
+	discarder := &DiscarderProperty{DaysToKeep: "7", NumToKeep: "10"}
+	tests := []struct {
+		name string
+		spec *PipelineSpec
+		want *DiscarderProperty
+	}{{
+		name: "nil spec",
+	}, {
+		name: "pipeline without discarder",
+		spec: &PipelineSpec{Type: NoScmPipelineType, Pipeline: &NoScmPipeline{}},
+	}, {
+		name: "pipeline",
+		spec: &PipelineSpec{Type: NoScmPipelineType, Pipeline: &NoScmPipeline{Discarder: discarder}},
+		want: discarder,
+	}, {
+		name: "multi-branch pipeline",
+		spec: &PipelineSpec{Type: MultiBranchPipelineType, MultiBranchPipeline: &MultiBranchPipeline{Discarder: discarder}},
+		want: discarder,
+	}, {
+		name: "mismatched type",
+		spec: &PipelineSpec{Type: MultiBranchPipelineType, Pipeline: &NoScmPipeline{Discarder: discarder}},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.spec.GetDiscarder())
+		})
+	}
+}
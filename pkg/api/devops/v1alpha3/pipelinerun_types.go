@@ -47,6 +47,10 @@ type PipelineRunSpec struct {
 	// Action indicates what we need to do with current PipelineRun.
 	// +optional
 	Action *Action `json:"action,omitempty"`
+
+	// CancelRequested indicates that the PipelineRun is requested to be cancelled.
+	// +optional
+	CancelRequested bool `json:"cancelRequested,omitempty"`
 }
 
 // PipelineRunStatus defines the observed state of PipelineRun
@@ -163,6 +167,11 @@ func (prSpec *PipelineRunSpec) IsMultiBranchPipeline() bool {
 	return prSpec.PipelineSpec != nil && prSpec.PipelineSpec.Type == MultiBranchPipelineType
 }
 
+// IsCancelRequested indicates if the PipelineRun is requested to be cancelled by the cancelRequested field or the Stop action.
+func (prSpec *PipelineRunSpec) IsCancelRequested() bool {
+	return prSpec.CancelRequested || (prSpec.Action != nil && *prSpec.Action == Stop)
+}
+
 // GetRefName get refName
 func (pr *PipelineRun) GetRefName() string {
 	var refName string
@@ -336,6 +345,22 @@ const (
 	TriggerFailed string = "TriggerFailed"
 	// RetrieveFailed indicates that it failed to retrieve the latest running data
 	RetrieveFailed string = "RetrieveFailed"
+	// Queued indicates that PipelineRun is waiting for the previous PipelineRuns due to the concurrency policy
+	Queued string = "Queued"
+	// QueueFull indicates that PipelineRun was skipped due to the queue of PipelineRuns is full
+	QueueFull string = "QueueFull"
+	// ConcurrencyForbidden indicates that PipelineRun was skipped due to the concurrent runs are forbidden
+	ConcurrencyForbidden string = "ConcurrencyForbidden"
+	// Replaced indicates that PipelineRun was cancelled and replaced by a newer one
+	Replaced string = "Replaced"
+	// Cancelling indicates that the build of a cancelled PipelineRun is being stopped
+	Cancelling string = "Cancelling"
+	// CancelFailed indicates that it failed to stop the build of a cancelled PipelineRun
+	CancelFailed string = "CancelFailed"
+	// Pruned indicates that PipelineRun was deleted due to the retention policy of the Pipeline
+	Pruned string = "Pruned"
+	// PruneFailed indicates that it failed to delete a PipelineRun due to the retention policy of the Pipeline
+	PruneFailed string = "PruneFailed"
 )
 
 func init() {
@@ -315,3 +315,35 @@ func TestPipelineRun_GetRefName(t *testing.T) {
 		})
 	}
 }
+
+func TestPipelineRunSpec_IsCancelRequested(t *testing.T) {
+	stop, pause := Stop, Pause
+	tests := []struct {
+		name   string
+		prSpec *PipelineRunSpec
+		want   bool
+	}{{
+		name:   "empty spec",
+		prSpec: &PipelineRunSpec{},
+		want:   false,
+	}, {
+		name:   "cancelRequested field",
+		prSpec: &PipelineRunSpec{CancelRequested: true},
+		want:   true,
+	}, {
+		name:   "Stop action",
+		prSpec: &PipelineRunSpec{Action: &stop},
+		want:   true,
+	}, {
+		name:   "Pause action",
+		prSpec: &PipelineRunSpec{Action: &pause},
+		want:   false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.prSpec.IsCancelRequested(); got != tt.want {
+				t.Errorf("IsCancelRequested() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
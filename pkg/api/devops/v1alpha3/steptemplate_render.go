@@ -46,7 +46,7 @@ func (t *StepTemplateSpec) Render(param map[string]interface{}, secret *v1.Secre
 	}
 
 	if t.Secret.Wrap && secret != nil {
-		output = wrapWithCredential(t.Secret.Type, secret.Name, output)
+		output = wrapWithCredential(t.Secret.Type, secret.Name, output, t.Secret.Mapping)
 	}
 
 	if err == nil && t.Container != "" {
@@ -73,48 +73,54 @@ func jsonFormat(content string) string {
 	return strings.TrimSpace(content)
 }
 
-func wrapWithCredential(secretType, secretName, target string) string {
+func wrapWithCredential(secretType, secretName, target string, mapping map[string]string) string {
+	var binding string
 	switch secretType {
-	case string(v1.SecretTypeBasicAuth), string(SecretTypeBasicAuth):
-		target = fmt.Sprintf(`{
-      "arguments": {
-        "isLiteral": false,
-        "value": "${[usernamePassword(credentialsId: '%s', passwordVariable: 'PASSWORDVARIABLE' ,usernameVariable : 'USERNAMEVARIABLE')]}"
-      },
-      "children": [%s],
-      "name": "withCredentials"
-    }`, secretName, target)
+	case string(v1.SecretTypeBasicAuth), string(SecretTypeBasicAuth), string(SecretTypeGitHubApp):
+		binding = fmt.Sprintf("usernamePassword(credentialsId: '%s', passwordVariable: '%s' ,usernameVariable : '%s')",
+			secretName, secretVariable(mapping, "passwordVariable"), secretVariable(mapping, "usernameVariable"))
 	case string(v1.SecretTypeBootstrapToken), string(SecretTypeSecretText):
-		target = fmt.Sprintf(`{
-  "arguments": {
-    "isLiteral": false,
-    "value": "${[string(credentialsId: '%s', variable: 'VARIABLE')]}"
-  },
-  "children": [%s],
-  "name": "withCredentials"
-}`, secretName, target)
+		binding = fmt.Sprintf("string(credentialsId: '%s', variable: '%s')",
+			secretName, secretVariable(mapping, "variable"))
 	case string(SecretTypeKubeConfig):
-		target = fmt.Sprintf(`{
-  "arguments": {
-    "isLiteral": false,
-    "value": "${[kubeconfigContent(credentialsId: '%s', variable: 'VARIABLE')]}"
-  },
-  "children": [%s],
-  "name": "withCredentials"
-}`, secretName, target)
+		binding = fmt.Sprintf("kubeconfigContent(credentialsId: '%s', variable: '%s')",
+			secretName, secretVariable(mapping, "variable"))
 	case string(SecretTypeSSHAuth):
-		target = fmt.Sprintf(`{
+		binding = fmt.Sprintf("sshUserPrivateKey(credentialsId: '%s', keyFileVariable : '%s' ,passphraseVariable : '%s' ,usernameVariable : '%s')",
+			secretName, secretVariable(mapping, "keyFileVariable"), secretVariable(mapping, "passphraseVariable"),
+			secretVariable(mapping, "sshUserPrivateKey"))
+	case string(SecretTypeDockerConfig), string(SecretTypeFile):
+		binding = fmt.Sprintf("file(credentialsId: '%s', variable: '%s')",
+			secretName, secretVariable(mapping, "variable"))
+	case string(SecretTypeCertificate):
+		binding = fmt.Sprintf("certificate(credentialsId: '%s', keystoreVariable: '%s' ,passwordVariable: '%s')",
+			secretName, secretVariable(mapping, "keystoreVariable"), secretVariable(mapping, "passwordVariable"))
+	case string(SecretTypeAWSAccessKey):
+		binding = fmt.Sprintf("aws(credentialsId: '%s', accessKeyVariable: '%s' ,secretKeyVariable: '%s')",
+			secretName, secretVariable(mapping, "accessKeyVariable"), secretVariable(mapping, "secretKeyVariable"))
+	default:
+		return jsonFormat(target)
+	}
+
+	target = fmt.Sprintf(`{
   "arguments": {
     "isLiteral": false,
-    "value": "${[sshUserPrivateKey(credentialsId: '%s', keyFileVariable : 'KEYFILEVARIABLE' ,passphraseVariable : 'PASSPHRASEVARIABLE' ,usernameVariable : 'SSHUSERPRIVATEKEY')]}"
+    "value": "${[%s]}"
   },
   "children": [%s],
   "name": "withCredentials"
-}`, secretName, target)
-	}
+}`, binding, target)
 	return jsonFormat(target)
 }
 
+// secretVariable returns the variable name of a credential binding, the mapping takes precedence over the default one
+func secretVariable(mapping map[string]string, key string) string {
+	if variable, ok := mapping[key]; ok && variable != "" {
+		return variable
+	}
+	return DefaultSecretKeyMapping[key]
+}
+
 func dslRender(dslTpl string, param map[string]interface{}, secret *v1.Secret) (output string, err error) {
 	output = dslTpl
 
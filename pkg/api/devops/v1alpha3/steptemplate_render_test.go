@@ -136,6 +136,7 @@ func Test_wrapWithCredential(t *testing.T) {
 		secretType string
 		secretName string
 		target     string
+		mapping    map[string]string
 	}
 	tests := []struct {
 		name string
@@ -172,10 +173,73 @@ func Test_wrapWithCredential(t *testing.T) {
 			target:     "echo 1",
 		},
 		want: readFile("testdata/credential-ssh.json"),
+	}, {
+		name: "secret as ssh auth type with mapping",
+		args: args{
+			secretType: string(SecretTypeSSHAuth),
+			secretName: "config",
+			target:     "echo 1",
+			mapping: map[string]string{
+				"keyFileVariable":   "KEY_FILE",
+				"sshUserPrivateKey": "",
+			},
+		},
+		want: readFile("testdata/credential-ssh-mapping.json"),
+	}, {
+		name: "secret as GitHub App type",
+		args: args{
+			secretType: string(SecretTypeGitHubApp),
+			secretName: "app",
+			target:     "echo 1",
+			mapping: map[string]string{
+				"usernameVariable": "GITHUB_APP",
+				"passwordVariable": "GITHUB_TOKEN",
+			},
+		},
+		want: readFile("testdata/credential-github-app.json"),
+	}, {
+		name: "secret as docker config type",
+		args: args{
+			secretType: string(SecretTypeDockerConfig),
+			secretName: "registry",
+			target:     "echo 1",
+			mapping: map[string]string{
+				"variable": "DOCKER_CONFIG_FILE",
+			},
+		},
+		want: readFile("testdata/credential-docker-config.json"),
+	}, {
+		name: "secret as file type",
+		args: args{
+			secretType: string(SecretTypeFile),
+			secretName: "settings",
+			target:     "echo 1",
+		},
+		want: readFile("testdata/credential-file.json"),
+	}, {
+		name: "secret as certificate type",
+		args: args{
+			secretType: string(SecretTypeCertificate),
+			secretName: "cert",
+			target:     "echo 1",
+		},
+		want: readFile("testdata/credential-certificate.json"),
+	}, {
+		name: "secret as AWS access key type",
+		args: args{
+			secretType: string(SecretTypeAWSAccessKey),
+			secretName: "aws",
+			target:     "echo 1",
+			mapping: map[string]string{
+				"accessKeyVariable": "AWS_ACCESS_KEY_ID",
+				"secretKeyVariable": "AWS_SECRET_ACCESS_KEY",
+			},
+		},
+		want: readFile("testdata/credential-aws.json"),
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := wrapWithCredential(tt.args.secretType, tt.args.secretName, tt.args.target); got != tt.want {
+			if got := wrapWithCredential(tt.args.secretType, tt.args.secretName, tt.args.target, tt.args.mapping); got != tt.want {
 				t.Errorf("wrapWithCredential() = %v, want %v", got, tt.want)
 			}
 		})
@@ -120,6 +120,9 @@ var DefaultSecretKeyMapping = map[string]string{
 	"sshUserPrivateKey":  "SSHUSERPRIVATEKEY",
 	"keyFileVariable":    "KEYFILEVARIABLE",
 	"passphraseVariable": "PASSPHRASEVARIABLE",
+	"keystoreVariable":   "KEYSTOREVARIABLE",
+	"accessKeyVariable":  "ACCESSKEYVARIABLE",
+	"secretKeyVariable":  "SECRETKEYVARIABLE",
 }
 
 func init() {
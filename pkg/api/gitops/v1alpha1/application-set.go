@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ApplicationSetSpec is the specification of the ApplicationSet
+type ApplicationSetSpec struct {
+	// Generators produce the parameters, one Application is generated for each set of the parameters
+	Generators []ApplicationSetGenerator `json:"generators"`
+	// Template is the template of the generated Applications.
+	// The parameters could be referenced in any string field, such as '{{name}}'
+	Template ApplicationSetTemplate `json:"template"`
+	// PreserveOnDeletion keeps the generated Applications when they are not generated anymore,
+	// or the ApplicationSet is deleted. Defaults to false.
+	PreserveOnDeletion bool `json:"preserveOnDeletion,omitempty"`
+}
+
+// ApplicationSetGenerator produces the parameters of the generated Applications, only one generator is expected
+type ApplicationSetGenerator struct {
+	List           *ListGenerator         `json:"list,omitempty"`
+	Clusters       *ClusterGenerator      `json:"clusters,omitempty"`
+	GitDirectories *GitDirectoryGenerator `json:"gitDirectories,omitempty"`
+}
+
+// ListGenerator produces the parameters from a fixed list
+type ListGenerator struct {
+	// Elements are the parameter sets, the keys are the parameter names
+	Elements []map[string]string `json:"elements"`
+}
+
+// ClusterGenerator produces the parameters from the KubeSphere clusters.
+// The available parameters are 'name', 'server' and 'metadata.labels.<key>'.
+type ClusterGenerator struct {
+	// Selector selects the clusters by labels, all clusters are selected if it's empty
+	Selector metav1.LabelSelector `json:"selector,omitempty"`
+	// Values are the additional parameters, available as 'values.<key>'. The values could reference the cluster
+	// parameters as well
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// GitDirectoryGenerator produces the parameters from the directories of a Git repository.
+// The available parameters are 'path' and 'path.basename'.
+type GitDirectoryGenerator struct {
+	// Repository is a GitRepository (devops.kubesphere.io/v1alpha3) in the same namespace
+	Repository v1.LocalObjectReference `json:"repository"`
+	// Revision is the branch, tag or commit to read, defaults to the default branch of the repository
+	Revision string `json:"revision,omitempty"`
+	// Directories are the path patterns of the directories, such as 'apps/*'.
+	// The wildcards are only supported in the last element of the path
+	Directories []GitDirectoryGeneratorItem `json:"directories"`
+}
+
+// GitDirectoryGeneratorItem is a path pattern of the directories
+type GitDirectoryGeneratorItem struct {
+	Path string `json:"path"`
+	// Exclude removes the matched directories from the result
+	Exclude bool `json:"exclude,omitempty"`
+}
+
+// ApplicationSetTemplate is the template of the generated Applications
+type ApplicationSetTemplate struct {
+	Metadata ApplicationSetTemplateMeta `json:"metadata"`
+	Spec     ApplicationSpec            `json:"spec"`
+}
+
+// ApplicationSetTemplateMeta is the metadata of the generated Applications
+type ApplicationSetTemplateMeta struct {
+	// Name must be unique for each set of the parameters, such as '{{name}}-guestbook'
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ApplicationSetStatus is the status of the ApplicationSet
+type ApplicationSetStatus struct {
+	// Applications are the names of the generated Applications
+	Applications []string `json:"applications,omitempty"`
+	// Conditions represent the latest available observations of the ApplicationSet
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +k8s:openapi-gen=true
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ApplicationSet generates Applications from a template for each target, such as a cluster or a Git directory
+type ApplicationSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ApplicationSetSpec   `json:"spec"`
+	Status ApplicationSetStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ApplicationSetList represents a set of the ApplicationSets
+type ApplicationSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ApplicationSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ApplicationSet{}, &ApplicationSetList{})
+}
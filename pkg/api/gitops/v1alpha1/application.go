@@ -27,6 +27,33 @@ import (
 // FluxApplication is an abstraction of FluxCD HelmRelease and FluxCD Kustomization
 type FluxApplication struct {
 	Spec FluxApplicationSpec `json:"spec,omitempty"`
+	// Operation is the last operation which was requested manually
+	Operation *FluxOperation `json:"operation,omitempty"`
+}
+
+// FluxOperationType is the type of the manual operations of a FluxCD Application
+type FluxOperationType string
+
+const (
+	// FluxOperationSync requests FluxCD to reconcile the Application immediately
+	FluxOperationSync FluxOperationType = "Sync"
+	// FluxOperationSuspend suspends the reconciliation of the Application
+	FluxOperationSuspend FluxOperationType = "Suspend"
+	// FluxOperationResume resumes the reconciliation of the Application
+	FluxOperationResume FluxOperationType = "Resume"
+	// FluxOperationRollback pins the Application to a revision of its history
+	FluxOperationRollback FluxOperationType = "Rollback"
+)
+
+// FluxOperation contains information about a manual operation of a FluxCD Application
+type FluxOperation struct {
+	Type FluxOperationType `json:"type"`
+	// InitiatedBy contains information about who initiated the operation
+	InitiatedBy OperationInitiator `json:"initiatedBy,omitempty"`
+	// RequestedAt is the time of requesting the operation, it's also the token of the reconcile request
+	RequestedAt metav1.Time `json:"requestedAt"`
+	// Revision is the revision which the Application was rolled back to
+	Revision string `json:"revision,omitempty"`
 }
 
 // FluxApplicationSpec contains three important elements that a GitOps Application needs.
@@ -46,7 +73,33 @@ type FluxApplicationSpec struct {
 // FluxApplicationSource is the definition of FluxCD Application Source
 type FluxApplicationSource struct {
 	// SourceRef is the reference to the Source
-	SourceRef helmv2.CrossNamespaceObjectReference `json:"sourceRef"`
+	SourceRef FluxSourceReference `json:"sourceRef"`
+}
+
+// FluxSourceReference is the reference to a FluxCD source. A HelmRelease supports the HelmRepository (including
+// the OCI type), GitRepository and Bucket, and a Kustomization supports the GitRepository, OCIRepository and Bucket.
+type FluxSourceReference struct {
+	// APIVersion of the referent.
+	// +optional
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Kind of the referent.
+	// +kubebuilder:validation:Enum=HelmRepository;GitRepository;OCIRepository;Bucket
+	// +required
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the referent.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=253
+	// +required
+	Name string `json:"name"`
+
+	// Namespace of the referent.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Optional
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // FluxApplicationDestination indicates where the Application should be deployed
@@ -251,6 +304,8 @@ type ApplicationSpec struct {
 	Kind    Engine           `json:"kind,omitempty"`
 	ArgoApp *ArgoApplication `json:"argoApp,omitempty"`
 	FluxApp *FluxApplication `json:"fluxApp,omitempty"`
+	// Rollout is the optional progressive delivery strategy
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
 }
 
 // ArgoApplication is a definition of Argo Application resource.
@@ -599,7 +654,111 @@ type ApplicationStatus struct {
 	Kind    Engine                `json:"kind,omitempty"`
 	ArgoApp string                `json:"argoApp,omitempty"`
 	FluxApp FluxApplicationStatus `json:"fluxApp,omitempty"`
-}
+
+	// The following fields are engine-neutral, they are filled by the status controllers of all the GitOps engines
+
+	// SyncStatus indicates whether the live state matches the desired state
+	SyncStatus SyncStatusCode `json:"syncStatus,omitempty"`
+	// HealthStatus is the aggregated health of the Application
+	HealthStatus HealthStatusCode `json:"healthStatus,omitempty"`
+	// Revision is the revision of the source which was deployed lastly
+	Revision string `json:"revision,omitempty"`
+	// LastOperation is the result of the last sync or reconciliation
+	LastOperation *OperationResult `json:"lastOperation,omitempty"`
+	// Resources is the summary of the resources which are managed by the Application
+	Resources *ResourcesSummary `json:"resources,omitempty"`
+	// Conditions represent the latest available observations of the Application
+	// +optional
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+	// History contains the revisions which were deployed, the latest one is the last
+	History []RevisionHistory `json:"history,omitempty"`
+	// Rollout is the progress of the progressive delivery
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+// RevisionHistory contains information about a deployed revision
+type RevisionHistory struct {
+	// ID is the identifier of the history, it's used to roll back to this revision
+	ID int64 `json:"id"`
+	// Revision is the revision (Git) or chart version (Helm) which was deployed
+	Revision string `json:"revision"`
+	// Source is the source which was deployed, it's only available with Argo CD
+	Source *ApplicationSource `json:"source,omitempty"`
+	// DeployedAt is the time when the revision was deployed
+	DeployedAt metav1.Time `json:"deployedAt"`
+	// InitiatedBy contains information about who initiated the deployment
+	InitiatedBy *OperationInitiator `json:"initiatedBy,omitempty"`
+}
+
+// SyncStatusCode is the engine-neutral sync status
+type SyncStatusCode string
+
+const (
+	// SyncStatusUnknown indicates the sync status could not be determined
+	SyncStatusUnknown SyncStatusCode = "Unknown"
+	// SyncStatusSynced indicates the live state matches the desired state
+	SyncStatusSynced SyncStatusCode = "Synced"
+	// SyncStatusOutOfSync indicates the live state differs from the desired state
+	SyncStatusOutOfSync SyncStatusCode = "OutOfSync"
+)
+
+// HealthStatusCode is the engine-neutral health status
+type HealthStatusCode string
+
+const (
+	// HealthStatusUnknown indicates the health could not be determined
+	HealthStatusUnknown HealthStatusCode = "Unknown"
+	// HealthStatusProgressing indicates the Application is not healthy yet but might be healthy soon
+	HealthStatusProgressing HealthStatusCode = "Progressing"
+	// HealthStatusHealthy indicates the Application is healthy
+	HealthStatusHealthy HealthStatusCode = "Healthy"
+	// HealthStatusSuspended indicates the reconciliation of the Application is suspended
+	HealthStatusSuspended HealthStatusCode = "Suspended"
+	// HealthStatusDegraded indicates the Application is failed or unable to be healthy
+	HealthStatusDegraded HealthStatusCode = "Degraded"
+	// HealthStatusMissing indicates the resources of the Application are missing
+	HealthStatusMissing HealthStatusCode = "Missing"
+)
+
+// OperationPhase is the phase of an operation
+type OperationPhase string
+
+const (
+	// OperationRunning indicates the operation is in progress
+	OperationRunning OperationPhase = "Running"
+	// OperationSucceeded indicates the operation is successful
+	OperationSucceeded OperationPhase = "Succeeded"
+	// OperationFailed indicates the operation is failed
+	OperationFailed OperationPhase = "Failed"
+)
+
+// OperationResult is the result of a sync (Argo CD) or a reconciliation (FluxCD)
+type OperationResult struct {
+	Phase OperationPhase `json:"phase,omitempty"`
+	// Message is the human-readable message about the operation
+	Message string `json:"message,omitempty"`
+	// Revision is the revision which the operation deployed
+	Revision   string       `json:"revision,omitempty"`
+	StartedAt  *metav1.Time `json:"startedAt,omitempty"`
+	FinishedAt *metav1.Time `json:"finishedAt,omitempty"`
+}
+
+// ResourcesSummary is the summary of the resource tree of an Application
+type ResourcesSummary struct {
+	// Total is the number of resources
+	Total int `json:"total"`
+	// OutOfSync is the number of resources which do not match the desired state
+	OutOfSync int `json:"outOfSync,omitempty"`
+	// Unhealthy is the number of resources which are not healthy
+	Unhealthy int `json:"unhealthy,omitempty"`
+	// Kinds is the number of resources of each kind
+	Kinds map[string]int `json:"kinds,omitempty"`
+}
+
+// ConditionTypeReady indicates whether the Application is synced and healthy
+const ConditionTypeReady = "Ready"
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
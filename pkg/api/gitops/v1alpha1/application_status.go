@@ -0,0 +1,130 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// UpdateConditions replaces the conditions with the given ones and the Ready condition which is derived
+// from the sync and health status. The transition time of a condition is kept if its status was not changed.
+func (s *ApplicationStatus) UpdateConditions(conditions ...metav1.Condition) {
+	desired := append([]metav1.Condition{s.readyCondition()}, conditions...)
+	now := metav1.Now()
+	result := make([]metav1.Condition, 0, len(desired))
+	for _, condition := range desired {
+		if existing := meta.FindStatusCondition(s.Conditions, condition.Type); existing != nil && existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = now
+		}
+		result = append(result, condition)
+	}
+	s.Conditions = result
+}
+
+func (s *ApplicationStatus) readyCondition() (condition metav1.Condition) {
+	condition = metav1.Condition{
+		Type:   ConditionTypeReady,
+		Status: metav1.ConditionFalse,
+	}
+	if s.LastOperation != nil {
+		condition.Message = s.LastOperation.Message
+	}
+
+	switch {
+	case s.SyncStatus == SyncStatusSynced && s.HealthStatus == HealthStatusHealthy:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = string(HealthStatusHealthy)
+	case s.HealthStatus != "" && s.HealthStatus != HealthStatusHealthy && s.HealthStatus != HealthStatusUnknown:
+		condition.Reason = string(s.HealthStatus)
+	case s.SyncStatus == SyncStatusOutOfSync:
+		condition.Reason = string(SyncStatusOutOfSync)
+	default:
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = string(HealthStatusUnknown)
+	}
+	return
+}
+
+// SetStatusLabels sets the sync and health status into the labels, then the Applications can be filtered by them
+func (a *Application) SetStatusLabels() {
+	if a.Labels == nil {
+		a.Labels = map[string]string{}
+	}
+	if a.Status.SyncStatus != "" {
+		a.Labels[SyncStatusLabelKey] = string(a.Status.SyncStatus)
+	}
+	if a.Status.HealthStatus != "" {
+		a.Labels[HealthStatusLabelKey] = string(a.Status.HealthStatus)
+	}
+}
+
+// DefaultHistoryLimit is the number of revisions kept in the history by default
+const DefaultHistoryLimit = 10
+
+// AddHistory appends a record of the revision into the history unless it is the latest one already.
+// The oldest records are dropped if there are more than limit records, a non-positive limit means unlimited.
+func (s *ApplicationStatus) AddHistory(revision string, deployedAt metav1.Time, initiatedBy *OperationInitiator, limit int) bool {
+	var id int64
+	if count := len(s.History); count > 0 {
+		latest := s.History[count-1]
+		if latest.Revision == revision {
+			return false
+		}
+		id = latest.ID + 1
+	}
+	s.History = append(s.History, RevisionHistory{
+		ID:          id,
+		Revision:    revision,
+		DeployedAt:  deployedAt,
+		InitiatedBy: initiatedBy,
+	})
+	if limit > 0 && len(s.History) > limit {
+		s.History = s.History[len(s.History)-limit:]
+	}
+	return true
+}
+
+// FindHistory returns the record of the history by its ID, or nil if it does not exist
+func (s *ApplicationStatus) FindHistory(id int64) *RevisionHistory {
+	for i := range s.History {
+		if s.History[i].ID == id {
+			return &s.History[i]
+		}
+	}
+	return nil
+}
+
+// IsDrifted checks if the Application went OutOfSync while the target revision was the deployed one,
+// it means the live state was changed outside the GitOps engine instead of a new commit
+func (s *ApplicationStatus) IsDrifted(previous *ApplicationStatus, targetRevision string) bool {
+	return previous.SyncStatus == SyncStatusSynced && s.SyncStatus == SyncStatusOutOfSync &&
+		targetRevision != "" && targetRevision == previous.Revision
+}
+
+// IsDriftAlertEnabled checks if the warning event should be sent when the Application drifts
+func (a *Application) IsDriftAlertEnabled() bool {
+	return a.Annotations[AnnoKeyDriftAlert] == "true"
+}
+
+// IsSuspended checks if the whole Application is suspended by the suspend operation
+func (a *Application) IsSuspended() bool {
+	return a.Annotations[AnnoKeySuspended] == "true"
+}
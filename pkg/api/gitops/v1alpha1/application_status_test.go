@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplicationStatus_UpdateConditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     ApplicationStatus
+		wantStatus metav1.ConditionStatus
+		wantReason string
+	}{{
+		name:       "unknown",
+		wantStatus: metav1.ConditionUnknown,
+		wantReason: "Unknown",
+	}, {
+		name:       "synced and healthy",
+		status:     ApplicationStatus{SyncStatus: SyncStatusSynced, HealthStatus: HealthStatusHealthy},
+		wantStatus: metav1.ConditionTrue,
+		wantReason: "Healthy",
+	}, {
+		name:       "degraded",
+		status:     ApplicationStatus{SyncStatus: SyncStatusSynced, HealthStatus: HealthStatusDegraded},
+		wantStatus: metav1.ConditionFalse,
+		wantReason: "Degraded",
+	}, {
+		name:       "out of sync",
+		status:     ApplicationStatus{SyncStatus: SyncStatusOutOfSync, HealthStatus: HealthStatusHealthy},
+		wantStatus: metav1.ConditionFalse,
+		wantReason: "OutOfSync",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.status.UpdateConditions(metav1.Condition{Type: "SyncError", Status: metav1.ConditionTrue, Reason: "SyncError"})
+			ready := meta.FindStatusCondition(tt.status.Conditions, ConditionTypeReady)
+			if assert.NotNil(t, ready) {
+				assert.Equal(t, tt.wantStatus, ready.Status)
+				assert.Equal(t, tt.wantReason, ready.Reason)
+			}
+			assert.NotNil(t, meta.FindStatusCondition(tt.status.Conditions, "SyncError"))
+		})
+	}
+}
+
+func TestApplicationStatus_UpdateConditions_keepTransitionTime(t *testing.T) {
+	transitionTime := metav1.NewTime(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	status := ApplicationStatus{
+		SyncStatus:   SyncStatusSynced,
+		HealthStatus: HealthStatusHealthy,
+		Conditions: []metav1.Condition{{
+			Type: ConditionTypeReady, Status: metav1.ConditionTrue, LastTransitionTime: transitionTime,
+		}, {
+			Type: "ComparisonError", Status: metav1.ConditionTrue, LastTransitionTime: transitionTime,
+		}},
+	}
+	status.UpdateConditions()
+	assert.Len(t, status.Conditions, 1)
+	assert.Equal(t, transitionTime, status.Conditions[0].LastTransitionTime)
+
+	status.HealthStatus = HealthStatusProgressing
+	status.UpdateConditions()
+	assert.NotEqual(t, transitionTime, status.Conditions[0].LastTransitionTime)
+}
+
+func TestApplication_SetStatusLabels(t *testing.T) {
+	app := &Application{}
+	app.SetStatusLabels()
+	assert.Empty(t, app.Labels)
+
+	app.Status.SyncStatus = SyncStatusSynced
+	app.Status.HealthStatus = HealthStatusHealthy
+	app.SetStatusLabels()
+	assert.Equal(t, map[string]string{
+		SyncStatusLabelKey:   "Synced",
+		HealthStatusLabelKey: "Healthy",
+	}, app.Labels)
+}
+
+func TestApplicationStatus_AddHistory(t *testing.T) {
+	status := &ApplicationStatus{}
+	now := metav1.Now()
+
+	assert.True(t, status.AddHistory("v1", now, nil, 2))
+	assert.False(t, status.AddHistory("v1", now, nil, 2))
+	assert.True(t, status.AddHistory("v2", now, &OperationInitiator{Username: "admin"}, 2))
+	assert.True(t, status.AddHistory("v1", now, nil, 2))
+	if assert.Len(t, status.History, 2) {
+		assert.Equal(t, int64(1), status.History[0].ID)
+		assert.Equal(t, "v2", status.History[0].Revision)
+		assert.Equal(t, "admin", status.History[0].InitiatedBy.Username)
+		assert.Equal(t, int64(2), status.History[1].ID)
+		assert.Equal(t, "v1", status.History[1].Revision)
+	}
+
+	assert.Nil(t, status.FindHistory(0))
+	if history := status.FindHistory(2); assert.NotNil(t, history) {
+		assert.Equal(t, "v1", history.Revision)
+	}
+
+	// unlimited
+	for _, revision := range []string{"v3", "v4", "v5"} {
+		status.AddHistory(revision, now, nil, 0)
+	}
+	assert.Len(t, status.History, 5)
+}
+
+func TestApplicationStatus_IsDrifted(t *testing.T) {
+	synced := &ApplicationStatus{SyncStatus: SyncStatusSynced, Revision: "v1"}
+	tests := []struct {
+		name     string
+		previous *ApplicationStatus
+		current  *ApplicationStatus
+		target   string
+		want     bool
+	}{{
+		name:     "out of sync without a new revision",
+		previous: synced,
+		current:  &ApplicationStatus{SyncStatus: SyncStatusOutOfSync, Revision: "v1"},
+		target:   "v1",
+		want:     true,
+	}, {
+		name:     "out of sync due to a new revision",
+		previous: synced,
+		current:  &ApplicationStatus{SyncStatus: SyncStatusOutOfSync, Revision: "v2"},
+		target:   "v2",
+	}, {
+		name:     "unknown target revision",
+		previous: synced,
+		current:  &ApplicationStatus{SyncStatus: SyncStatusOutOfSync},
+	}, {
+		name:     "out of sync already",
+		previous: &ApplicationStatus{SyncStatus: SyncStatusOutOfSync, Revision: "v1"},
+		current:  &ApplicationStatus{SyncStatus: SyncStatusOutOfSync, Revision: "v1"},
+		target:   "v1",
+	}, {
+		name:     "still synced",
+		previous: synced,
+		current:  synced,
+		target:   "v1",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.current.IsDrifted(tt.previous, tt.target))
+		})
+	}
+
+	app := &Application{}
+	assert.False(t, app.IsDriftAlertEnabled())
+	app.Annotations = map[string]string{AnnoKeyDriftAlert: "true"}
+	assert.True(t, app.IsDriftAlertEnabled())
+
+	assert.False(t, app.IsSuspended())
+	app.Annotations[AnnoKeySuspended] = "true"
+	assert.True(t, app.IsSuspended())
+}
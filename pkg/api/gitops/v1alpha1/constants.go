@@ -24,16 +24,33 @@ const (
 	ArgoCDAppControlByLabelKey = GroupName + "/argocd-application-control-by"
 	AppNamespaceLabelKey       = GroupName + "/application-namespace"
 	AppNameLabelKey            = GroupName + "/application-name"
+	ApplicationSetLabelKey     = GroupName + "/application-set"
 )
 
 const (
 	// AnnoKeyImages is the key for the image list
 	AnnoKeyImages = GroupName + "/images"
+	// AnnoKeyDriftAlert enables the warning event when the Application drifts from the deployed revision,
+	// the value is expected to be "true"
+	AnnoKeyDriftAlert = GroupName + "/drift-alert"
+	// AnnoKeyPinnedSource is the name of the FluxCD GitRepository which is pinned to a commit by the rollback of
+	// an Application, it's in the namespace of the Application and only used by it
+	AnnoKeyPinnedSource = GroupName + "/pinned-source"
+	// AnnoKeyOriginalChartVersion is the chart version of a FluxCD Application before it was pinned by a rollback,
+	// it's restored by the sync operation. An empty value means the latest chart version
+	AnnoKeyOriginalChartVersion = GroupName + "/original-chart-version"
+	// AnnoKeySuspended marks the FluxCD Application as suspended by the suspend operation, the value is "true".
+	// It suspends all the HelmReleases and Kustomizations without touching the suspend flag of each one
+	AnnoKeySuspended = GroupName + "/suspended"
 )
 
 // ApplicationFinalizerName is the name of PipelineRun finalizer
 const ApplicationFinalizerName = "application." + GroupName
 
+// RolloutFinalizerName is the name of the finalizer which cleans the rollout objects of an Application,
+// they are in the destination namespace so the owner reference does not work
+const RolloutFinalizerName = "rollout." + GroupName
+
 // ArgoCDResourcesFinalizer is the name of Argo CD resource finalizer
 const ArgoCDResourcesFinalizer = "resources-finalizer.argocd.argoproj.io"
 
@@ -41,6 +58,30 @@ const ArgoCDResourcesFinalizer = "resources-finalizer.argocd.argoproj.io"
 // the Repository is a ArtifactRepository
 const ArtifactRepoLabelKey = GroupName + "/is-artifact-repository"
 
+// ArtifactRepoTypeLabelKey is the label key that indicates which kind of FluxCD source
+// should be generated from an ArtifactRepository, it is treated as git if absent
+const ArtifactRepoTypeLabelKey = GroupName + "/artifact-repository-type"
+
+// ArtifactRepoRefAnnoKey is the annotation key of the artifact which is pulled from an ArtifactRepository of the oci
+// type. The value is one of tag:<tag>, semver:<range> and digest:<digest>, the latest tag is pulled if absent
+const ArtifactRepoRefAnnoKey = GroupName + "/artifact-repository-ref"
+
+// ArtifactRepoType is the type of ArtifactRepository
+type ArtifactRepoType string
+
+const (
+	// ArtifactRepoTypeGit generates a FluxCD GitRepository
+	ArtifactRepoTypeGit ArtifactRepoType = "git"
+	// ArtifactRepoTypeHelm generates a FluxCD HelmRepository
+	ArtifactRepoTypeHelm ArtifactRepoType = "helm"
+	// ArtifactRepoTypeOCIHelm generates a FluxCD HelmRepository of the oci type
+	ArtifactRepoTypeOCIHelm ArtifactRepoType = "oci-helm"
+	// ArtifactRepoTypeOCI generates a FluxCD OCIRepository
+	ArtifactRepoTypeOCI ArtifactRepoType = "oci"
+	// ArtifactRepoTypeBucket generates a FluxCD Bucket which is S3-compatible
+	ArtifactRepoTypeBucket ArtifactRepoType = "bucket"
+)
+
 // Engine is the backend GitOps Solutions type
 type Engine string
 
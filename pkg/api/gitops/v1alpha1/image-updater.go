@@ -28,6 +28,7 @@ type ImageUpdaterSpec struct {
 	Kind   string            `json:"kind,omitempty"`
 	Images []string          `json:"images,omitempty"`
 	Argo   *ArgoImageUpdater `json:"argo,omitempty"`
+	Flux   *FluxImageUpdater `json:"flux,omitempty"`
 }
 
 // ArgoImageUpdater is the specification of the Argo image updater
@@ -64,6 +65,38 @@ func (w WriteMethod) GetValue() string {
 	return ""
 }
 
+// FluxImageUpdater is the specification of the FluxCD image automation.
+// The keys of the maps are the aliases of the images, same as ArgoImageUpdater.
+type FluxImageUpdater struct {
+	// App is a FluxCD Application, the updated images are committed back to its GitRepository
+	App v1.LocalObjectReference `json:"app"`
+	// Interval is the interval of scanning the images and updating the Git repository
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// UpdateStrategy is the strategy to select the latest image, available values are semver, name and latest.
+	// The semver strategy takes the version constraint of the image, such as nginx:~1.20
+	UpdateStrategy map[string]string `json:"updateStrategy,omitempty"`
+	// AllowTags are the regular expressions of the allowed tags
+	AllowTags map[string]string `json:"allowTags,omitempty"`
+	// Secrets are the names of the docker-registry secrets to access the images
+	Secrets map[string]string `json:"secrets,omitempty"`
+	// Git describes how to commit the updated images back to the Git repository
+	Git FluxImageUpdaterGit `json:"git,omitempty"`
+}
+
+// FluxImageUpdaterGit describes how to commit the updated images back to the Git repository
+type FluxImageUpdaterGit struct {
+	// Branch is the branch to checkout and push to, defaults to the branch of the GitRepository
+	Branch string `json:"branch,omitempty"`
+	// Path is the path of the manifests which have the image policy markers, defaults to the path of the Kustomization
+	Path string `json:"path,omitempty"`
+	// AuthorName is the name of the commit author
+	AuthorName string `json:"authorName,omitempty"`
+	// AuthorEmail is the email of the commit author
+	AuthorEmail string `json:"authorEmail,omitempty"`
+	// MessageTemplate is the template of the commit message
+	MessageTemplate string `json:"messageTemplate,omitempty"`
+}
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 // +kubebuilder:object:root=true
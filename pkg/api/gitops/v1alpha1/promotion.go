@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PromotionSpec is the specification of the Promotion
+type PromotionSpec struct {
+	// Stages are the ordered environments, such as dev, staging and prod.
+	// The revision of a stage is promoted to the next one once the gates of the next stage pass
+	Stages []PromotionStage `json:"stages"`
+	// Operation is the last operation which was requested manually, it's removed once it's handled
+	Operation *PromotionOperation `json:"operation,omitempty"`
+}
+
+// PromotionStage is an environment of the Promotion
+type PromotionStage struct {
+	// Name is the unique name of the stage
+	Name string `json:"name"`
+	// Application is the Application in the same namespace which deploys this stage
+	Application v1.LocalObjectReference `json:"application"`
+	// Gates must pass before a revision is promoted into this stage, they're ignored by the first stage
+	Gates *PromotionGates `json:"gates,omitempty"`
+	// Git writes the promoted value into a file of a Git repository. If it's empty, the promoted revision is
+	// written into the target revision of an Argo CD Application, or the chart version of a FluxCD HelmRelease.
+	// The value of the previous stage is read from its file if it has one, or the deployed revision of its Application.
+	Git *PromotionGitTarget `json:"git,omitempty"`
+}
+
+// PromotionGates are the conditions to promote a revision into a stage
+type PromotionGates struct {
+	// ManualApproval requires the revision to be approved before promoting
+	ManualApproval bool `json:"manualApproval,omitempty"`
+	// HealthyPreviousStage requires the Application of the previous stage to be synced and healthy
+	HealthyPreviousStage bool `json:"healthyPreviousStage,omitempty"`
+	// PipelineRun requires the latest PipelineRun of the Pipeline which built the pending value to succeed after
+	// the previous stage was deployed
+	PipelineRun *PipelineRunGate `json:"pipelineRun,omitempty"`
+}
+
+// PipelineRunGate requires a successful PipelineRun
+type PipelineRunGate struct {
+	// Pipeline is the name of a Pipeline (devops.kubesphere.io/v1alpha3) in the same namespace
+	Pipeline string `json:"pipeline"`
+	// Parameter is the name of the PipelineRun parameter which holds the built value, e.g. an image tag.
+	// The PipelineRuns are matched by the SCM reference name if it's empty
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// PromotionGitTarget describes a value in a YAML file of a Git repository
+type PromotionGitTarget struct {
+	// Repository is a GitRepository (devops.kubesphere.io/v1alpha3) in the same namespace
+	Repository v1.LocalObjectReference `json:"repository"`
+	// Branch is the branch to read and commit to, defaults to the default branch of the repository
+	Branch string `json:"branch,omitempty"`
+	// Path is the path of the YAML file, such as 'envs/staging/values.yaml'
+	Path string `json:"path"`
+	// Key is the dot-separated path of the value in the YAML file, such as 'image.tag'
+	Key string `json:"key"`
+	// Message is the commit message, defaults to 'promote <value> to <stage>'
+	Message string `json:"message,omitempty"`
+}
+
+// PromotionOperationType is the type of the manual operations of a Promotion
+type PromotionOperationType string
+
+const (
+	// PromotionOperationApprove approves the pending revision of a stage
+	PromotionOperationApprove PromotionOperationType = "Approve"
+)
+
+// PromotionOperation contains information about a manual operation of a Promotion
+type PromotionOperation struct {
+	Type PromotionOperationType `json:"type"`
+	// Stage is the name of the stage to operate
+	Stage string `json:"stage"`
+	// Value is the pending value which is approved, it's ignored if it's not pending anymore
+	Value string `json:"value"`
+	// InitiatedBy contains information about who initiated the operation
+	InitiatedBy OperationInitiator `json:"initiatedBy,omitempty"`
+	// RequestedAt is the time of requesting the operation
+	RequestedAt metav1.Time `json:"requestedAt"`
+}
+
+// PromotionPhase is the phase of a stage
+type PromotionPhase string
+
+const (
+	// PromotionPhasePromoted indicates the stage has the value of the previous stage
+	PromotionPhasePromoted PromotionPhase = "Promoted"
+	// PromotionPhaseWaiting indicates the gates of the stage do not pass
+	PromotionPhaseWaiting PromotionPhase = "Waiting"
+	// PromotionPhaseWaitingForApproval indicates the pending value needs to be approved
+	PromotionPhaseWaitingForApproval PromotionPhase = "WaitingForApproval"
+	// PromotionPhaseFailed indicates the value cannot be read or promoted
+	PromotionPhaseFailed PromotionPhase = "Failed"
+)
+
+// PromotionStatus is the status of the Promotion
+type PromotionStatus struct {
+	Stages []PromotionStageStatus `json:"stages,omitempty"`
+}
+
+// PromotionStageStatus is the status of a stage
+type PromotionStageStatus struct {
+	Name  string         `json:"name"`
+	Phase PromotionPhase `json:"phase,omitempty"`
+	// Value is the current revision or value of the stage
+	Value string `json:"value,omitempty"`
+	// Pending is the value of the previous stage which is not promoted yet
+	Pending string `json:"pending,omitempty"`
+	// Message is the human-readable message about the phase
+	Message string `json:"message,omitempty"`
+	// Approval is the last approval of the stage
+	Approval *PromotionOperation `json:"approval,omitempty"`
+	// LastPromotion is the last value which was promoted into the stage
+	LastPromotion *PromotionRecord `json:"lastPromotion,omitempty"`
+}
+
+// PromotionRecord is a promotion of a stage
+type PromotionRecord struct {
+	Value      string      `json:"value"`
+	PromotedAt metav1.Time `json:"promotedAt"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +k8s:openapi-gen=true
+
+// Promotion promotes the revisions of the Applications from one environment to the next
+type Promotion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PromotionSpec   `json:"spec"`
+	Status PromotionStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PromotionList represents a set of the Promotions
+type PromotionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Promotion `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Promotion{}, &PromotionList{})
+}
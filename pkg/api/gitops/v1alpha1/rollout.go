@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RolloutProvider is the controller of the progressive delivery
+type RolloutProvider string
+
+const (
+	// RolloutProviderArgoRollouts represents Argo Rollouts, see also https://argoproj.github.io/argo-rollouts/
+	RolloutProviderArgoRollouts RolloutProvider = "argo-rollouts"
+	// RolloutProviderFlagger represents Flagger, see also https://flagger.app/
+	RolloutProviderFlagger RolloutProvider = "flagger"
+)
+
+// RolloutStrategy is the progressive delivery strategy of an Application.
+// Only the workloads in the same cluster of the controller are supported.
+type RolloutStrategy struct {
+	// +kubebuilder:default:=argo-rollouts
+	// +kubebuilder:validation:Enum=argo-rollouts;flagger
+	Provider RolloutProvider `json:"provider,omitempty"`
+	// TargetRef is the Deployment which belongs to the Application in the destination namespace
+	TargetRef RolloutTargetReference `json:"targetRef"`
+	// Canary shifts the traffic to the new version step by step
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+	// BlueGreen switches the traffic to the new version at once after the promotion
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+	// Operation is the promote or abort request of the current rollout
+	Operation *RolloutOperation `json:"operation,omitempty"`
+}
+
+// RolloutTargetReference references the workload to roll out
+type RolloutTargetReference struct {
+	// +kubebuilder:default:=apps/v1
+	APIVersion string `json:"apiVersion,omitempty"`
+	// +kubebuilder:default:=Deployment
+	Kind string `json:"kind,omitempty"`
+	Name string `json:"name"`
+}
+
+// CanaryStrategy contains the steps of a canary rollout
+type CanaryStrategy struct {
+	Steps []CanaryStep `json:"steps,omitempty"`
+	// Port is the port of the Service which is generated by Flagger, defaults to 80
+	Port int32 `json:"port,omitempty"`
+}
+
+// CanaryStep is a step of the canary rollout, only one of the fields should be set
+type CanaryStep struct {
+	// SetWeight sets the percentage of the traffic to the new version
+	SetWeight *int32 `json:"setWeight,omitempty"`
+	// Pause pauses the rollout for the duration, or until it's promoted if the duration is absent
+	Pause *RolloutPause `json:"pause,omitempty"`
+}
+
+// RolloutPause pauses a rollout
+type RolloutPause struct {
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// BlueGreenStrategy contains the services of a blue-green rollout
+type BlueGreenStrategy struct {
+	// ActiveService is the Service which serves the production traffic
+	ActiveService string `json:"activeService"`
+	// PreviewService is the Service which serves the new version before the promotion
+	PreviewService string `json:"previewService,omitempty"`
+	// AutoPromotion promotes the new version without the manual promotion
+	AutoPromotion bool `json:"autoPromotion,omitempty"`
+}
+
+// RolloutOperationType is the type of the operations of a rollout
+type RolloutOperationType string
+
+const (
+	// RolloutOperationPromote promotes the rollout to the next step, or finishes the blue-green rollout
+	RolloutOperationPromote RolloutOperationType = "Promote"
+	// RolloutOperationAbort aborts the rollout and shifts the traffic back to the stable version
+	RolloutOperationAbort RolloutOperationType = "Abort"
+)
+
+// RolloutOperation is a manual operation of a rollout
+type RolloutOperation struct {
+	Type RolloutOperationType `json:"type"`
+	// InitiatedBy contains information about who initiated the operation
+	InitiatedBy OperationInitiator `json:"initiatedBy,omitempty"`
+	RequestedAt metav1.Time        `json:"requestedAt"`
+}
+
+// RolloutPhase is the phase of a rollout
+type RolloutPhase string
+
+const (
+	// RolloutPhaseProgressing indicates the rollout is in progress
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhasePaused indicates the rollout is waiting for the promotion
+	RolloutPhasePaused RolloutPhase = "Paused"
+	// RolloutPhaseHealthy indicates the rollout is finished
+	RolloutPhaseHealthy RolloutPhase = "Healthy"
+	// RolloutPhaseDegraded indicates the rollout is failed
+	RolloutPhaseDegraded RolloutPhase = "Degraded"
+	// RolloutPhaseAborted indicates the rollout was aborted
+	RolloutPhaseAborted RolloutPhase = "Aborted"
+)
+
+// RolloutStatus is the progress of the rollout
+type RolloutStatus struct {
+	Provider RolloutProvider `json:"provider,omitempty"`
+	Phase    RolloutPhase    `json:"phase,omitempty"`
+	// CurrentStep is the index of the current step of the canary rollout
+	CurrentStep int32 `json:"currentStep,omitempty"`
+	// TotalSteps is the number of the steps of the canary rollout
+	TotalSteps int32 `json:"totalSteps,omitempty"`
+	// Weight is the percentage of the traffic to the new version
+	Weight  int32  `json:"weight,omitempty"`
+	Message string `json:"message,omitempty"`
+	// LastOperation is the last promote or abort operation which was handled
+	LastOperation *RolloutOperation `json:"lastOperation,omitempty"`
+	// Conditions represent the latest available observations of the rollout
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// RolloutConditionTypeOwned is false if the rollout object in the destination namespace does not belong to the
+// Application, the controller never takes over an object which was created by others
+const RolloutConditionTypeOwned = "Owned"
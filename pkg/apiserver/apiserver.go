@@ -61,6 +61,7 @@ import (
 	"kubesphere.io/devops/pkg/informers"
 	devopsv1alpha2 "kubesphere.io/devops/pkg/kapis/devops/v1alpha2"
 	devopsv1alpha3 "kubesphere.io/devops/pkg/kapis/devops/v1alpha3"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 	utilnet "kubesphere.io/devops/pkg/utils/net"
 )
 
@@ -157,7 +158,8 @@ func (s *APIServer) installKubeSphereAPIs() {
 		jenkinsCore)
 	utilruntime.Must(err)
 	wss = append(wss, v1alpha2WSS...)
-	wss = append(wss, devopsv1alpha3.AddToContainer(s.container, s.DevopsClient, s.KubernetesClient, s.Client, tokenIssue, jenkinsCore)...)
+	wss = append(wss, devopsv1alpha3.AddToContainer(s.container, s.DevopsClient, s.KubernetesClient, s.Client, tokenIssue, jenkinsCore,
+		storefactory.NewFactory(s.Config.PipelineRunDataStore, s.Client, s.S3Client))...)
 	wss = append(wss, oauth.AddToContainer(s.container,
 		auth.NewTokenOperator(
 			s.CacheClient,
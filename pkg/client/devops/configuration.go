@@ -16,6 +16,12 @@ limitations under the License.
 
 package devops
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
 // ConfigurationOperator provides APIs for operating devops configuration, like reloading.
 type ConfigurationOperator interface {
 	// ReloadConfiguration reload devops configuration
@@ -24,3 +30,25 @@ type ConfigurationOperator interface {
 	// ApplyNewSource applies a new config file
 	ApplyNewSource(string) error
 }
+
+// ConfigurationRejectedError indicates that Jenkins has responded that it failed to apply the new config file.
+type ConfigurationRejectedError struct {
+	Source     string
+	StatusCode int
+}
+
+func (e *ConfigurationRejectedError) Error() string {
+	return fmt.Sprintf("Jenkins failed to apply the config file %s, status code: %d", e.Source, e.StatusCode)
+}
+
+// IsConfigurationRejectedCode returns true if the status code means that Jenkins failed to apply the config file.
+// The other ones, like the authentication errors or the gateway errors, are not reported by the config file.
+func IsConfigurationRejectedCode(statusCode int) bool {
+	return statusCode == http.StatusBadRequest || statusCode == http.StatusInternalServerError
+}
+
+// IsConfigurationRejected returns true if Jenkins has responded that it failed to apply the config file.
+func IsConfigurationRejected(err error) bool {
+	var rejectedErr *ConfigurationRejectedError
+	return errors.As(err, &rejectedErr)
+}
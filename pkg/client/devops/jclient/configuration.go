@@ -16,7 +16,61 @@ limitations under the License.
 
 package jclient
 
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jenkins-zh/jenkins-client/pkg/core"
+	"kubesphere.io/devops/pkg/client/devops"
+)
+
 // ReloadConfiguration reloads the Jenkins configuration
 func (j *JenkinsClient) ReloadConfiguration() error {
 	return j.jenkins.ReloadConfiguration()
 }
+
+// ApplyNewSource apply a new source, a devops.ConfigurationRejectedError is returned if Jenkins fails to apply it
+func (j *JenkinsClient) ApplyNewSource(s string) (err error) {
+	var jenkinsCore core.JenkinsCore
+	if j != nil {
+		jenkinsCore = j.Core
+	}
+
+	checkForm := url.Values{}
+	checkForm.Set("newSource", s)
+	if err = postCasCForm(&jenkinsCore, "/configuration-as-code/checkNewSource", s, checkForm); err != nil {
+		return
+	}
+
+	replaceForm := url.Values{}
+	replaceForm.Set("json", fmt.Sprintf(`{"newSource": "%s"}`, s))
+	replaceForm.Set("_.newSource", s)
+	err = postCasCForm(&jenkinsCore, "/configuration-as-code/replace", s, replaceForm)
+	return
+}
+
+// postCasCForm submits a form to the configuration-as-code plugin.
+// Jenkins does not have a standard API, the form submit might be redirected, so the expected code is 200 or 302.
+func postCasCForm(jenkinsCore *core.JenkinsCore, api, source string, form url.Values) (err error) {
+	var statusCode int
+	statusCode, _, err = jenkinsCore.Request(http.MethodPost, api,
+		map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, strings.NewReader(form.Encode()))
+	if urlErr, ok := err.(*url.Error); ok && urlErr.Err.Error() == "302 response missing Location header" {
+		statusCode, err = http.StatusFound, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to request %s, error: %v", api, err)
+		return
+	}
+
+	switch {
+	case statusCode == http.StatusOK || statusCode == http.StatusFound:
+	case devops.IsConfigurationRejectedCode(statusCode):
+		err = &devops.ConfigurationRejectedError{Source: source, StatusCode: statusCode}
+	default:
+		err = fmt.Errorf("failed to request %s, status code: %d", api, statusCode)
+	}
+	return
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/jenkins-zh/jenkins-client/pkg/casc"
+	"github.com/jenkins-zh/jenkins-client/pkg/core"
+	"github.com/jenkins-zh/jenkins-client/pkg/mock/mhttp"
+	"github.com/stretchr/testify/assert"
+	"kubesphere.io/devops/pkg/client/devops"
+)
+
+func TestApplyNewSource(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	roundTripper := mhttp.NewMockRoundTripper(ctrl)
+	casc.PrepareForCheckNewSource(roundTripper, "http://localhost", "", "")
+	casc.PrepareForReplaceSource(roundTripper, "http://localhost", "", "")
+
+	client := &JenkinsClient{Core: core.JenkinsCore{URL: "http://localhost", RoundTripper: roundTripper}}
+	assert.Nil(t, client.ApplyNewSource("source"))
+}
+
+func TestApplyNewSource_failed(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		wantRejected bool
+	}{{
+		name:         "Jenkins fails to load the source",
+		statusCode:   http.StatusInternalServerError,
+		wantRejected: true,
+	}, {
+		name:       "unauthorized",
+		statusCode: http.StatusUnauthorized,
+	}, {
+		name:       "Jenkins is unavailable",
+		statusCode: http.StatusServiceUnavailable,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/configuration-as-code/checkNewSource":
+					w.WriteHeader(http.StatusOK)
+				case "/configuration-as-code/replace":
+					w.WriteHeader(tt.statusCode)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			client := &JenkinsClient{Core: core.JenkinsCore{URL: server.URL}}
+			err := client.ApplyNewSource("source")
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.wantRejected, devops.IsConfigurationRejected(err))
+		})
+	}
+
+	// Jenkins is not reachable
+	client := &JenkinsClient{Core: core.JenkinsCore{URL: "http://127.0.0.1:1"}}
+	err := client.ApplyNewSource("source")
+	assert.NotNil(t, err)
+	assert.False(t, devops.IsConfigurationRejected(err))
+}
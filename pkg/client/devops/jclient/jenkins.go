@@ -17,7 +17,6 @@ limitations under the License.
 package jclient
 
 import (
-	"github.com/jenkins-zh/jenkins-client/pkg/casc"
 	"github.com/jenkins-zh/jenkins-client/pkg/core"
 	"kubesphere.io/devops/pkg/client/devops"
 	"kubesphere.io/devops/pkg/client/devops/jenkins"
@@ -29,18 +28,6 @@ type JenkinsClient struct {
 	jenkins *jenkins.Jenkins // For refactor purpose only
 }
 
-// ApplyNewSource apply a new source
-func (j *JenkinsClient) ApplyNewSource(s string) (err error) {
-	client := casc.Manager{}
-	if j != nil {
-		client.JenkinsCore = j.Core
-	}
-	if err = client.CheckNewSource(s); err == nil {
-		err = client.Replace(s)
-	}
-	return
-}
-
 var _ devops.Interface = &JenkinsClient{}
 
 // NewJenkinsClient creates a Jenkins client
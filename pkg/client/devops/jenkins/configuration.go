@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+
+	"kubesphere.io/devops/pkg/client/devops"
 )
 
 // According to: https://github.com/jenkinsci/configuration-as-code-plugin/blob/master/docs/features/configurationReload.md
@@ -46,7 +48,11 @@ func (j *Jenkins) CheckNewSource(source string) (err error) {
 	if response, err = j.Requester.PostForm(checkNewSourceEndpoint, nil, nil, map[string]string{
 		"newSource:": source,
 	}); err == nil && response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("failed to check the new CasC source: %s, status code is: %d", source, response.StatusCode)
+		if devops.IsConfigurationRejectedCode(response.StatusCode) {
+			err = &devops.ConfigurationRejectedError{Source: source, StatusCode: response.StatusCode}
+		} else {
+			err = fmt.Errorf("failed to check the new CasC source: %s, status code is: %d", source, response.StatusCode)
+		}
 	}
 	return
 }
@@ -54,14 +60,18 @@ func (j *Jenkins) CheckNewSource(source string) (err error) {
 // ApplyNewSource applies a new config file
 func (j *Jenkins) ApplyNewSource(source string) (err error) {
 	if err = j.CheckNewSource(source); err != nil {
-		err = fmt.Errorf("failed to check the new source: %s, error: %v", source, err)
+		if !devops.IsConfigurationRejected(err) {
+			err = fmt.Errorf("failed to check the new source: %s, error: %v", source, err)
+		}
 		return
 	}
 	var response *http.Response
 	if response, err = j.Requester.PostForm(replaceEndpoint, nil, nil, map[string]string{
 		"json":        fmt.Sprintf(`{"newSource": "%s"}`, source),
 		"_.newSource": source,
-	}); err == nil && response.StatusCode != http.StatusFound {
+	}); err == nil && devops.IsConfigurationRejectedCode(response.StatusCode) {
+		err = &devops.ConfigurationRejectedError{Source: source, StatusCode: response.StatusCode}
+	} else if err == nil && response.StatusCode != http.StatusFound {
 		// Jenkins does not have a standard API. This is a form submit, so the expected code is not 200
 		err = fmt.Errorf("failed to replace the new CasC source: %s, expected status code is: %d, got: %d",
 			source, http.StatusFound, response.StatusCode)
@@ -34,7 +34,9 @@ type Options struct {
 	Namespace       string        `json:"namespace,omitempty" yaml:"namespace"`
 	WorkerNamespace string        `json:"workerNamespace,omitempty" yaml:"workerNamespace"`
 	ReloadCasCDelay time.Duration `json:"reloadCasCDelay,omitempty" yaml:"reloadCasCDelay"`
-	SkipVerify      bool
+	// CasCHistoryLimit is the number of the applied Jenkins CasC revisions to keep
+	CasCHistoryLimit int `json:"cascHistoryLimit,omitempty" yaml:"cascHistoryLimit"`
+	SkipVerify       bool
 }
 
 // NewJenkinsOptions returns a `zero` instance
@@ -49,7 +51,8 @@ func NewJenkinsOptions() *Options {
 		// Default syncFrequency of Kubernetes is "1m", and increasing it will result in longer refresh times for
 		// ConfigMap, so we use 70s as the default value of ReloadCasCDelay. Please see also:
 		// https://kubernetes.io/docs/reference/config-api/kubelet-config.v1beta1/#kubelet-config-k8s-io-v1beta1-KubeletConfiguration
-		ReloadCasCDelay: 70 * time.Second,
+		ReloadCasCDelay:  70 * time.Second,
+		CasCHistoryLimit: 10,
 	}
 }
 
@@ -105,4 +108,7 @@ func (s *Options) AddFlags(fs *pflag.FlagSet, c *Options) {
 	fs.DurationVar(&s.ReloadCasCDelay, "reload-casc-delay", c.ReloadCasCDelay,
 		"ReloadCasCDelay specifies the total duration that controller should delay the reload action for "+
 			"jenkins-casc-config ConfigMap change, and it is only valid for controller manager.")
+	fs.IntVar(&s.CasCHistoryLimit, "casc-history-limit", c.CasCHistoryLimit,
+		"CasCHistoryLimit specifies how many applied revisions of jenkins-casc-config should be kept for rollback, "+
+			"and it is only valid for controller manager.")
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package util
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 
@@ -46,8 +47,135 @@ func ConvertSecretToCredential(secret *v1.Secret) (interface{}, error) {
 	case devopsv1alpha3.SecretTypeKubeConfig:
 		secretContent := string(secret.Data[devopsv1alpha3.KubeConfigSecretKey])
 		return jcredential.NewKubeConfigCredential(name, secretContent), nil
+	case devopsv1alpha3.SecretTypeGitHubApp:
+		return newGitHubAppCredential(name, secret), nil
+	case devopsv1alpha3.SecretTypeDockerConfig:
+		return newFileCredential(name, "config.json", secret.Data[devopsv1alpha3.DockerConfigJSONKey]), nil
+	case devopsv1alpha3.SecretTypeCertificate:
+		return newCertificateCredential(name, secret), nil
+	case devopsv1alpha3.SecretTypeAWSAccessKey:
+		return newAWSCredential(name, secret), nil
+	case devopsv1alpha3.SecretTypeFile:
+		fileName := string(secret.Data[devopsv1alpha3.FileNameKey])
+		if fileName == "" {
+			fileName = name
+		}
+		return newFileCredential(name, fileName, secret.Data[devopsv1alpha3.FileContentKey]), nil
 	default:
 		err := fmt.Errorf("error unsupport credential type")
 		return nil, restful.NewError(http.StatusBadRequest, err.Error())
 	}
 }
+
+const (
+	// GitHubAppCredentialStaplerClass is the Jenkins class
+	GitHubAppCredentialStaplerClass = "org.jenkinsci.plugins.github_branch_source.GitHubAppCredentials"
+	// FileCredentialStaplerClass is the Jenkins class
+	FileCredentialStaplerClass = "org.jenkinsci.plugins.plaincredentials.impl.FileCredentialsImpl"
+	// CertificateCredentialStaplerClass is the Jenkins class
+	CertificateCredentialStaplerClass = "com.cloudbees.plugins.credentials.impl.CertificateCredentialsImpl"
+	// UploadedKeyStoreSourceStaplerClass is the Jenkins class
+	UploadedKeyStoreSourceStaplerClass = CertificateCredentialStaplerClass + "$UploadedKeyStoreSource"
+	// PEMEntryKeyStoreSourceStaplerClass is the Jenkins class
+	PEMEntryKeyStoreSourceStaplerClass = CertificateCredentialStaplerClass + "$PEMEntryKeyStoreSource"
+	// AWSCredentialStaplerClass is the Jenkins class
+	AWSCredentialStaplerClass = "com.cloudbees.jenkins.plugins.awscredentials.AWSCredentialsImpl"
+)
+
+// GitHubAppCredential represents a GitHub App type of credential
+type GitHubAppCredential struct {
+	jcredential.Credential `json:",inline"`
+	AppID                  string `json:"appID"`
+	PrivateKey             string `json:"privateKey"`
+	Owner                  string `json:"owner,omitempty"`
+	APIURI                 string `json:"apiUri,omitempty"`
+}
+
+// FileCredential represents a secret file type of credential
+type FileCredential struct {
+	jcredential.Credential `json:",inline"`
+	FileName               string `json:"fileName"`
+	// SecretBytes is the base64 encoded file content
+	SecretBytes string `json:"secretBytes"`
+}
+
+// CertificateCredential represents a certificate type of credential
+type CertificateCredential struct {
+	jcredential.Credential `json:",inline"`
+	Password               string         `json:"password"`
+	KeyStoreSource         KeyStoreSource `json:"keyStoreSource"`
+}
+
+// KeyStoreSource is the source of a certificate credential
+type KeyStoreSource struct {
+	StaplerClass string `json:"stapler-class"`
+	// UploadedKeystore is the base64 encoded PKCS#12 keystore
+	UploadedKeystore string `json:"uploadedKeystore,omitempty"`
+	CertChain        string `json:"certChain,omitempty"`
+	PrivateKey       string `json:"privateKey,omitempty"`
+}
+
+// AWSCredential represents an AWS access key type of credential
+type AWSCredential struct {
+	jcredential.Credential `json:",inline"`
+	AccessKey              string `json:"accessKey"`
+	SecretKey              string `json:"secretKey"`
+	IAMRoleArn             string `json:"iamRoleArn,omitempty"`
+}
+
+func newCredential(id, class string) jcredential.Credential {
+	return jcredential.Credential{
+		Scope:        jcredential.GLOBALScope,
+		ID:           id,
+		Class:        class,
+		StaplerClass: class,
+	}
+}
+
+func newGitHubAppCredential(id string, secret *v1.Secret) *GitHubAppCredential {
+	return &GitHubAppCredential{
+		Credential: newCredential(id, GitHubAppCredentialStaplerClass),
+		AppID:      string(secret.Data[devopsv1alpha3.GitHubAppIDKey]),
+		PrivateKey: string(secret.Data[devopsv1alpha3.GitHubAppPrivateKey]),
+		Owner:      string(secret.Data[devopsv1alpha3.GitHubAppOwnerKey]),
+		APIURI:     string(secret.Data[devopsv1alpha3.GitHubAppAPIURLKey]),
+	}
+}
+
+func newFileCredential(id, fileName string, content []byte) *FileCredential {
+	return &FileCredential{
+		Credential:  newCredential(id, FileCredentialStaplerClass),
+		FileName:    fileName,
+		SecretBytes: base64.StdEncoding.EncodeToString(content),
+	}
+}
+
+func newCertificateCredential(id string, secret *v1.Secret) *CertificateCredential {
+	var source KeyStoreSource
+	if keystore := secret.Data[devopsv1alpha3.CertificateKeyStoreKey]; len(keystore) > 0 {
+		source = KeyStoreSource{
+			StaplerClass:     UploadedKeyStoreSourceStaplerClass,
+			UploadedKeystore: base64.StdEncoding.EncodeToString(keystore),
+		}
+	} else {
+		source = KeyStoreSource{
+			StaplerClass: PEMEntryKeyStoreSourceStaplerClass,
+			CertChain:    string(secret.Data[devopsv1alpha3.CertificateCertKey]),
+			PrivateKey:   string(secret.Data[devopsv1alpha3.CertificatePrivateKey]),
+		}
+	}
+	return &CertificateCredential{
+		Credential:     newCredential(id, CertificateCredentialStaplerClass),
+		Password:       string(secret.Data[devopsv1alpha3.CertificatePasswordKey]),
+		KeyStoreSource: source,
+	}
+}
+
+func newAWSCredential(id string, secret *v1.Secret) *AWSCredential {
+	return &AWSCredential{
+		Credential: newCredential(id, AWSCredentialStaplerClass),
+		AccessKey:  string(secret.Data[devopsv1alpha3.AWSAccessKeyIDKey]),
+		SecretKey:  string(secret.Data[devopsv1alpha3.AWSSecretAccessKey]),
+		IAMRoleArn: string(secret.Data[devopsv1alpha3.AWSRoleARNKey]),
+	}
+}
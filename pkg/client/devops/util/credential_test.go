@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	jcredential "github.com/jenkins-zh/jenkins-client/pkg/credential"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	devopsv1alpha3 "kubesphere.io/devops/pkg/api/devops/v1alpha3"
+)
+
+func TestConvertSecretToCredential(t *testing.T) {
+	newSecret := func(secretType v1.SecretType, data map[string]string) *v1.Secret {
+		secret := &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "fake"},
+			Type:       secretType,
+			Data:       map[string][]byte{},
+		}
+		for key, val := range data {
+			secret.Data[key] = []byte(val)
+		}
+		return secret
+	}
+
+	tests := []struct {
+		name    string
+		secret  *v1.Secret
+		want    interface{}
+		wantErr bool
+	}{{
+		name:    "unknown type",
+		secret:  newSecret("fake", nil),
+		wantErr: true,
+	}, {
+		name: "basic auth",
+		secret: newSecret(devopsv1alpha3.SecretTypeBasicAuth, map[string]string{
+			devopsv1alpha3.BasicAuthUsernameKey: "admin",
+			devopsv1alpha3.BasicAuthPasswordKey: "password",
+		}),
+		want: jcredential.NewUsernamePasswordCredential("fake", "admin", "password"),
+	}, {
+		name: "GitHub App",
+		secret: newSecret(devopsv1alpha3.SecretTypeGitHubApp, map[string]string{
+			devopsv1alpha3.GitHubAppIDKey:      "12345",
+			devopsv1alpha3.GitHubAppPrivateKey: "key",
+			devopsv1alpha3.GitHubAppOwnerKey:   "kubesphere",
+		}),
+		want: &GitHubAppCredential{
+			Credential: newCredential("fake", GitHubAppCredentialStaplerClass),
+			AppID:      "12345",
+			PrivateKey: "key",
+			Owner:      "kubesphere",
+		},
+	}, {
+		name: "Docker config",
+		secret: newSecret(devopsv1alpha3.SecretTypeDockerConfig, map[string]string{
+			devopsv1alpha3.DockerConfigJSONKey: "{}",
+		}),
+		want: &FileCredential{
+			Credential:  newCredential("fake", FileCredentialStaplerClass),
+			FileName:    "config.json",
+			SecretBytes: "e30=",
+		},
+	}, {
+		name: "file without a file name",
+		secret: newSecret(devopsv1alpha3.SecretTypeFile, map[string]string{
+			devopsv1alpha3.FileContentKey: "{}",
+		}),
+		want: &FileCredential{
+			Credential:  newCredential("fake", FileCredentialStaplerClass),
+			FileName:    "fake",
+			SecretBytes: "e30=",
+		},
+	}, {
+		name: "file with a file name",
+		secret: newSecret(devopsv1alpha3.SecretTypeFile, map[string]string{
+			devopsv1alpha3.FileNameKey:    "settings.json",
+			devopsv1alpha3.FileContentKey: "{}",
+		}),
+		want: &FileCredential{
+			Credential:  newCredential("fake", FileCredentialStaplerClass),
+			FileName:    "settings.json",
+			SecretBytes: "e30=",
+		},
+	}, {
+		name: "certificate with keystore",
+		secret: newSecret(devopsv1alpha3.SecretTypeCertificate, map[string]string{
+			devopsv1alpha3.CertificateKeyStoreKey: "{}",
+			devopsv1alpha3.CertificatePasswordKey: "password",
+		}),
+		want: &CertificateCredential{
+			Credential: newCredential("fake", CertificateCredentialStaplerClass),
+			Password:   "password",
+			KeyStoreSource: KeyStoreSource{
+				StaplerClass:     UploadedKeyStoreSourceStaplerClass,
+				UploadedKeystore: "e30=",
+			},
+		},
+	}, {
+		name: "certificate with PEM entries",
+		secret: newSecret(devopsv1alpha3.SecretTypeCertificate, map[string]string{
+			devopsv1alpha3.CertificateCertKey:    "cert",
+			devopsv1alpha3.CertificatePrivateKey: "key",
+		}),
+		want: &CertificateCredential{
+			Credential: newCredential("fake", CertificateCredentialStaplerClass),
+			KeyStoreSource: KeyStoreSource{
+				StaplerClass: PEMEntryKeyStoreSourceStaplerClass,
+				CertChain:    "cert",
+				PrivateKey:   "key",
+			},
+		},
+	}, {
+		name: "AWS access key",
+		secret: newSecret(devopsv1alpha3.SecretTypeAWSAccessKey, map[string]string{
+			devopsv1alpha3.AWSAccessKeyIDKey:  "id",
+			devopsv1alpha3.AWSSecretAccessKey: "secret",
+			devopsv1alpha3.AWSRoleARNKey:      "arn:aws:iam::123456789012:role/deploy",
+		}),
+		want: &AWSCredential{
+			Credential: newCredential("fake", AWSCredentialStaplerClass),
+			AccessKey:  "id",
+			SecretKey:  "secret",
+			IAMRoleArn: "arn:aws:iam::123456789012:role/deploy",
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertSecretToCredential(tt.secret)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
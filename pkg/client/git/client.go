@@ -19,6 +19,8 @@ package git
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
 	goscm "github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/factory"
@@ -46,6 +48,30 @@ func NewClientFactory(provider string, secretRef *v1.SecretReference, k8sClient
 	}
 }
 
+// NewRepositoryClientFactory creates an instance of the ClientFactory for a GitRepository,
+// the namespace of the secret defaults to the namespace of the GitRepository
+func NewRepositoryClientFactory(repo *v1alpha3.GitRepository, k8sClient ResourceGetter) *ClientFactory {
+	secretRef := repo.Spec.Secret.DeepCopy()
+	if secretRef != nil && secretRef.Namespace == "" {
+		secretRef.Namespace = repo.Namespace
+	}
+	factory := NewClientFactory(repo.Spec.Provider, secretRef, k8sClient)
+	factory.Server = repo.Spec.Server
+	return factory
+}
+
+// GetRepositoryName returns the full name of a GitRepository, such as 'kubesphere/ks-devops'
+func GetRepositoryName(repo *v1alpha3.GitRepository) string {
+	if repo.Spec.Owner != "" && repo.Spec.Repo != "" {
+		return repo.Spec.Owner + "/" + repo.Spec.Repo
+	}
+	address := repo.Spec.URL
+	if repoURL, err := url.Parse(address); err == nil && repoURL.Host != "" {
+		address = repoURL.Path
+	}
+	return strings.TrimSuffix(strings.Trim(address, "/"), ".git")
+}
+
 // GetClient returns the git client with auth
 func (c *ClientFactory) GetClient() (client *goscm.Client, err error) {
 	provider := c.provider
@@ -198,3 +198,45 @@ func TestGetClient(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRepositoryName(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1alpha3.GitRepositorySpec
+		want string
+	}{{
+		name: "owner and repo",
+		spec: v1alpha3.GitRepositorySpec{Owner: "kubesphere", Repo: "ks-devops", URL: "https://github.com/fake/fake"},
+		want: "kubesphere/ks-devops",
+	}, {
+		name: "https URL",
+		spec: v1alpha3.GitRepositorySpec{URL: "https://github.com/kubesphere/ks-devops.git"},
+		want: "kubesphere/ks-devops",
+	}, {
+		name: "URL without scheme",
+		spec: v1alpha3.GitRepositorySpec{URL: "kubesphere/ks-devops"},
+		want: "kubesphere/ks-devops",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GetRepositoryName(&v1alpha3.GitRepository{Spec: tt.spec}))
+		})
+	}
+}
+
+func TestNewRepositoryClientFactory(t *testing.T) {
+	repo := &v1alpha3.GitRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "repo"},
+		Spec: v1alpha3.GitRepositorySpec{
+			Provider: "gitlab",
+			Server:   "https://gitlab.com",
+			Secret:   &v1.SecretReference{Name: "secret"},
+		},
+	}
+	factory := NewRepositoryClientFactory(repo, nil)
+	assert.Equal(t, "gitlab", factory.provider)
+	assert.Equal(t, "https://gitlab.com", factory.Server)
+	assert.Equal(t, &v1.SecretReference{Namespace: "ns", Name: "secret"}, factory.secretRef)
+	// the GitRepository is not changed
+	assert.Equal(t, "", repo.Spec.Secret.Namespace)
+}
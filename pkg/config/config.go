@@ -29,6 +29,7 @@ import (
 
 	"kubesphere.io/devops/pkg/client/devops/jenkins"
 	"kubesphere.io/devops/pkg/client/s3"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 )
 
 // Package config saves configuration for running KubeSphere components
@@ -89,18 +90,20 @@ type Config struct {
 	AuthenticationOptions *authoptions.AuthenticationOptions `json:"authentication,omitempty" yaml:"authentication,omitempty" mapstructure:"authentication"`
 	AuthMode              AuthMode                           `json:"authMode,omitempty" yaml:"authMode,omitempty" mapstructure:"authMode"`
 	JWTSecret             string                             `json:"jwtSecret,omitempty" yaml:"jwtSecret,omitempty" mapstructure:"jwtSecret"`
+	PipelineRunDataStore  *storefactory.Options              `json:"pipelineRunDataStore,omitempty" yaml:"pipelineRunDataStore,omitempty" mapstructure:"pipelineRunDataStore"`
 }
 
 // New creates a default non-empty Config
 func New() *Config {
 	return &Config{
-		SonarQubeOptions:  sonarqube.NewSonarQubeOptions(),
-		JenkinsOptions:    jenkins.NewJenkinsOptions(),
-		KubernetesOptions: k8s.NewKubernetesOptions(),
-		S3Options:         s3.NewS3Options(),
-		AuthMode:          AuthModeToken,
-		ArgoCDOption:      &ArgoCDOption{},
-		FluxCDOption:      &FluxCDOption{},
+		SonarQubeOptions:     sonarqube.NewSonarQubeOptions(),
+		JenkinsOptions:       jenkins.NewJenkinsOptions(),
+		KubernetesOptions:    k8s.NewKubernetesOptions(),
+		S3Options:            s3.NewS3Options(),
+		AuthMode:             AuthModeToken,
+		ArgoCDOption:         &ArgoCDOption{},
+		FluxCDOption:         &FluxCDOption{},
+		PipelineRunDataStore: storefactory.NewOptions(),
 	}
 }
 
@@ -25,6 +25,9 @@ import (
 type ArgoCDOption struct {
 	Enabled   bool   `json:"enabled,omitempty" yaml:"enabled,omitempty" description:"enabled FluxCD"`
 	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty" description:"Which namespace the ArgoCD located"`
+	// Server is the address of the Argo CD API server, the target states of the resources come from it
+	Server string `json:"server,omitempty" yaml:"server,omitempty" description:"The address of the ArgoCD API server"`
+	Token  string `json:"token,omitempty" yaml:"token,omitempty" description:"The token to access the ArgoCD API server"`
 }
 
 // AddFlags adds the flags which related to argocd
@@ -32,6 +35,9 @@ func (o *ArgoCDOption) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&o.Enabled, "argocd-enabled", false, "Enable ArgoCD APIs")
 	// see also https://argo-cd.readthedocs.io/en/stable/getting_started/
 	fs.StringVarP(&o.Namespace, "argocd-namespace", o.Namespace, "argocd", "Which namespace the ArgoCD located")
+	fs.StringVar(&o.Server, "argocd-server", o.Server,
+		"The address of the ArgoCD API server, the diff API compares the live objects with the target states from it")
+	fs.StringVar(&o.Token, "argocd-token", o.Token, "The token to access the ArgoCD API server")
 }
 
 // FluxCDOption as the FluxCD integration configuration
@@ -16,6 +16,13 @@ limitations under the License.
 
 package meta
 
+const (
+	// ReconcileRequestAnnotation is the annotation used for triggering a reconciliation
+	// outside of a defined schedule. The value is interpreted as a token, and any change
+	// in value SHOULD trigger a reconciliation.
+	ReconcileRequestAnnotation string = "reconcile.fluxcd.io/requestedAt"
+)
+
 // ReconcileRequestStatus is a struct to embed in a status type, so that all types using the mechanism have the same
 // field. Use it like this:
 //
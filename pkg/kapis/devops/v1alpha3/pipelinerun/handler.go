@@ -23,9 +23,12 @@ import (
 	"fmt"
 	"io"
 	"k8s.io/apimachinery/pkg/types"
-	cmstore "kubesphere.io/devops/pkg/store/configmap"
+	"k8s.io/client-go/util/retry"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
+	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"kubesphere.io/devops/pkg/kapis"
 
@@ -43,8 +46,11 @@ import (
 
 // apiHandlerOption holds some useful tools for API handler.
 type apiHandlerOption struct {
-	devopsClient devopsClient.Interface
-	client       client.Client
+	devopsClient     devopsClient.Interface
+	client           client.Client
+	dataStoreFactory *storefactory.Factory
+	// logInterval is the interval of polling the log output, the default value is used if it's zero
+	logInterval time.Duration
 }
 
 // apiHandler contains functions to handle coming request and give a response.
@@ -54,6 +60,9 @@ type apiHandler struct {
 
 // newAPIHandler creates an APIHandler.
 func newAPIHandler(o apiHandlerOption) *apiHandler {
+	if o.dataStoreFactory == nil {
+		o.dataStoreFactory = storefactory.NewFactory(nil, o.client, nil)
+	}
 	return &apiHandler{o}
 }
 
@@ -165,6 +174,71 @@ func (h *apiHandler) getPipelineRun(request *restful.Request, response *restful.
 	_ = response.WriteEntity(&pr)
 }
 
+func (h *apiHandler) cancelPipelineRun(request *restful.Request, response *restful.Response) {
+	nsName := request.PathParameter("namespace")
+	prName := request.PathParameter("pipelinerun")
+
+	// request to cancel the PipelineRun, the controller will stop the build and update the status
+	pr := &v1alpha3.PipelineRun{}
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := h.client.Get(context.Background(), client.ObjectKey{Namespace: nsName, Name: prName}, pr); err != nil {
+			return err
+		}
+		if pr.HasCompleted() {
+			return restful.NewError(http.StatusConflict, fmt.Sprintf("PipelineRun %s/%s has already completed", nsName, prName))
+		}
+		if pr.Spec.CancelRequested {
+			return nil
+		}
+		pr.Spec.CancelRequested = true
+		return h.client.Update(context.Background(), pr)
+	})
+	if err != nil {
+		kapis.HandleError(request, response, err)
+		return
+	}
+	_ = response.WriteEntity(pr)
+}
+
+func (h *apiHandler) rerunPipelineRun(request *restful.Request, response *restful.Response) {
+	nsName := request.PathParameter("namespace")
+	prName := request.PathParameter("pipelinerun")
+	stage := request.QueryParameter("stage")
+
+	original := &v1alpha3.PipelineRun{}
+	if err := h.client.Get(context.Background(), client.ObjectKey{Namespace: nsName, Name: prName}, original); err != nil {
+		kapis.HandleError(request, response, err)
+		return
+	}
+	if stage != "" {
+		// Jenkins only allows restarting a completed build from a stage
+		if _, ok := original.GetPipelineRunID(); !ok || !original.HasCompleted() {
+			kapis.HandleBadRequest(response, request, fmt.Errorf("cannot restart PipelineRun %s/%s from stage %s "+
+				"before it has completed", nsName, prName, stage))
+			return
+		}
+	}
+
+	// get current login user from request context
+	user, ok := apiserverrequest.UserFrom(request.Request.Context())
+	if !ok || user == nil {
+		// should never happen
+		err := fmt.Errorf("unauthenticated user entered to rerun PipelineRun '%s/%s'", nsName, prName)
+		kapis.HandleUnauthorized(response, request, err)
+		return
+	}
+	pr := CreateRerunPipelineRun(original, stage)
+	if user.GetName() != "" {
+		pr.GetAnnotations()[v1alpha3.PipelineRunCreatorAnnoKey] = user.GetName()
+	}
+	if err := h.client.Create(context.Background(), pr); err != nil {
+		kapis.HandleError(request, response, err)
+		return
+	}
+
+	_ = response.WriteEntity(pr)
+}
+
 func (h *apiHandler) getNodeDetails(request *restful.Request, response *restful.Response) {
 	namespaceName := request.PathParameter("namespace")
 	pipelineRunName := request.PathParameter("pipelinerun")
@@ -180,10 +254,10 @@ func (h *apiHandler) getNodeDetails(request *restful.Request, response *restful.
 	// get stage status
 	stagesJSON, ok := pr.Annotations[v1alpha3.JenkinsPipelineRunStagesStatusAnnoKey]
 	if !ok {
-		if pipelineRunStore, err := cmstore.NewConfigMapStore(ctx, types.NamespacedName{
+		if pipelineRunStore, err := h.dataStoreFactory.New(ctx, types.NamespacedName{
 			Namespace: namespaceName,
 			Name:      pipelineRunName,
-		}, h.client); err != nil {
+		}); err != nil {
 			// If the stages status does not exist, set it as an empty array
 			stagesJSON = "[]"
 		} else {
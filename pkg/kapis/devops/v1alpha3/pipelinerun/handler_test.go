@@ -22,6 +22,7 @@ import (
 	"io"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/apiserver/request"
@@ -34,6 +35,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"kubesphere.io/devops/pkg/apiserver/runtime"
 	fakedevops "kubesphere.io/devops/pkg/client/devops/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -50,7 +52,7 @@ func TestApis(t *testing.T) {
 		Spec: v1alpha3.PipelineSpec{
 			Type: v1alpha3.NoScmPipelineType,
 		},
-	}))
+	}), nil)
 	restful.DefaultContainer.Add(wsWithGroup)
 
 	type args struct {
@@ -142,13 +144,11 @@ func TestGetNodeDetails(t *testing.T) {
 	cm.SetNamespace(pipelineRun.GetNamespace())
 	cm.Data["stage"] = `[{"id":"id","steps":[{"approvable":true}]}]`
 
-	handler := &apiHandler{
-		apiHandlerOption: apiHandlerOption{
-			client: fake.NewClientBuilder().WithScheme(schema).
-				WithObjects(pipelineRun.DeepCopy()).
-				WithObjects(cm.DeepCopy()).Build(),
-		},
-	}
+	handler := newAPIHandler(apiHandlerOption{
+		client: fake.NewClientBuilder().WithScheme(schema).
+			WithObjects(pipelineRun.DeepCopy()).
+			WithObjects(cm.DeepCopy()).Build(),
+	})
 
 	recorder := httptest.NewRecorder()
 	req := restful.NewRequest(&http.Request{
@@ -177,3 +177,146 @@ func TestGetNodeDetails(t *testing.T) {
  }
 ]`, string(body))
 }
+
+func TestCancelPipelineRun(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	now := metav1.Now()
+	running := &v1alpha3.PipelineRun{}
+	running.SetName("running")
+	running.SetNamespace("ns")
+	completed := running.DeepCopy()
+	completed.SetName("completed")
+	completed.Status.CompletionTime = &now
+
+	tests := []struct {
+		name                string
+		pipelineRun         string
+		wantCode            int
+		wantCancelRequested bool
+	}{{
+		name:                "cancel a running PipelineRun",
+		pipelineRun:         "running",
+		wantCode:            http.StatusOK,
+		wantCancelRequested: true,
+	}, {
+		name:        "cancel a completed PipelineRun",
+		pipelineRun: "completed",
+		wantCode:    http.StatusConflict,
+	}, {
+		name:        "cancel a non-existing PipelineRun",
+		pipelineRun: "fake",
+		wantCode:    http.StatusNotFound,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithObjects(running.DeepCopy(), completed.DeepCopy()).Build()
+			handler := newAPIHandler(apiHandlerOption{client: c})
+
+			recorder := httptest.NewRecorder()
+			req := restful.NewRequest(&http.Request{})
+			req.PathParameters()["namespace"] = "ns"
+			req.PathParameters()["pipelinerun"] = tt.pipelineRun
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			handler.cancelPipelineRun(req, resp)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+
+			pr := &v1alpha3.PipelineRun{}
+			if err := c.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: tt.pipelineRun}, pr); err == nil {
+				assert.Equal(t, tt.wantCancelRequested, pr.Spec.CancelRequested)
+			}
+		})
+	}
+}
+
+func TestRerunPipelineRun(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	now := metav1.Now()
+	completed := &v1alpha3.PipelineRun{}
+	completed.SetName("completed")
+	completed.SetNamespace("ns")
+	completed.SetLabels(map[string]string{v1alpha3.PipelineNameLabelKey: "pipeline"})
+	completed.SetAnnotations(map[string]string{v1alpha3.JenkinsPipelineRunIDAnnoKey: "1"})
+	completed.Spec.PipelineRef = &v1.ObjectReference{Name: "pipeline"}
+	completed.Status.CompletionTime = &now
+	pending := completed.DeepCopy()
+	pending.SetName("pending")
+	pending.SetAnnotations(nil)
+	pending.Status.CompletionTime = nil
+
+	bob := &user.DefaultInfo{Name: "bob"}
+	tests := []struct {
+		name        string
+		pipelineRun string
+		stage       string
+		user        user.Info
+		wantCode    int
+	}{{
+		name:        "rerun a completed PipelineRun",
+		pipelineRun: "completed",
+		user:        bob,
+		wantCode:    http.StatusOK,
+	}, {
+		name:        "restart a completed PipelineRun from a stage",
+		pipelineRun: "completed",
+		stage:       "build",
+		user:        bob,
+		wantCode:    http.StatusOK,
+	}, {
+		name:        "restart a pending PipelineRun from a stage",
+		pipelineRun: "pending",
+		stage:       "build",
+		user:        bob,
+		wantCode:    http.StatusBadRequest,
+	}, {
+		name:        "rerun without a user",
+		pipelineRun: "completed",
+		wantCode:    http.StatusUnauthorized,
+	}, {
+		name:        "rerun a non-existing PipelineRun",
+		pipelineRun: "fake",
+		user:        bob,
+		wantCode:    http.StatusNotFound,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).WithObjects(completed.DeepCopy(), pending.DeepCopy()).Build()
+			handler := newAPIHandler(apiHandlerOption{client: c})
+
+			ctx := request.NewContext()
+			if tt.user != nil {
+				ctx = request.WithUser(ctx, tt.user)
+			}
+			httpRequest, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/?stage="+tt.stage, nil)
+			recorder := httptest.NewRecorder()
+			req := restful.NewRequest(httpRequest)
+			req.PathParameters()["namespace"] = "ns"
+			req.PathParameters()["pipelinerun"] = tt.pipelineRun
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			handler.rerunPipelineRun(req, resp)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			prs := &v1alpha3.PipelineRunList{}
+			assert.Nil(t, c.List(context.Background(), prs, client.InNamespace("ns")))
+			var reruns []v1alpha3.PipelineRun
+			for _, item := range prs.Items {
+				if item.Annotations[v1alpha3.PipelineRunRerunOfAnnoKey] == tt.pipelineRun {
+					reruns = append(reruns, item)
+				}
+			}
+			if assert.Equal(t, 1, len(reruns)) {
+				pr := reruns[0]
+				assert.Equal(t, "bob", pr.Annotations[v1alpha3.PipelineRunCreatorAnnoKey])
+				assert.Equal(t, tt.stage, pr.Annotations[v1alpha3.PipelineRunRestartStageAnnoKey])
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/client/devops"
+	"kubesphere.io/devops/pkg/kapis"
+	"kubesphere.io/devops/pkg/store/store"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultLogPollInterval is the interval of polling Jenkins for the new log output
+	defaultLogPollInterval = 2 * time.Second
+
+	// headerTextSize is the Jenkins header which tells the offset of the next piece of the log
+	headerTextSize = "X-Text-Size"
+	// headerMoreData is the Jenkins header which tells if there is more log output
+	headerMoreData = "X-More-Data"
+
+	mimeEventStream = "text/event-stream"
+	mimeTextPlain   = "text/plain"
+)
+
+// logFetcher fetches the log output from the start offset
+type logFetcher func(start int64) (data []byte, header http.Header, err error)
+
+// nextLogOffset returns the offset of the next piece of the log, and whether there is more log output.
+// The X-Text-Size header is preferred, but the Blue Ocean API of the whole log does not return headers.
+func nextLogOffset(header http.Header, start int64, size int) (next int64, more bool) {
+	next = start + int64(size)
+	if header == nil {
+		return
+	}
+	if textSize, err := strconv.ParseInt(header.Get(headerTextSize), 10, 64); err == nil && textSize >= start {
+		next = textSize
+	}
+	more = strings.ToLower(header.Get(headerMoreData)) == "true"
+	return
+}
+
+// logWriter writes the log output into a response progressively
+type logWriter struct {
+	response *restful.Response
+	sse      bool
+	started  bool
+}
+
+func newLogWriter(request *restful.Request, response *restful.Response) *logWriter {
+	return &logWriter{
+		response: response,
+		sse:      strings.Contains(request.HeaderParameter("Accept"), mimeEventStream),
+	}
+}
+
+func (w *logWriter) begin() {
+	if w.started {
+		return
+	}
+	w.started = true
+	header := w.response.Header()
+	if w.sse {
+		header.Set(restful.HEADER_ContentType, mimeEventStream)
+	} else {
+		header.Set(restful.HEADER_ContentType, mimeTextPlain+"; charset=utf-8")
+	}
+	header.Set("Cache-Control", "no-cache")
+	// disable the buffering of the reverse proxies, such as Nginx
+	header.Set("X-Accel-Buffering", "no")
+	w.response.WriteHeader(http.StatusOK)
+}
+
+// Write sends a piece of the log, each line is an event in the SSE mode
+func (w *logWriter) Write(data []byte) (err error) {
+	w.begin()
+	if w.sse {
+		buf := &bytes.Buffer{}
+		for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+			buf.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+		}
+		buf.WriteString("\n")
+		data = buf.Bytes()
+	}
+	if _, err = w.response.Write(data); err == nil {
+		w.flush()
+	}
+	return
+}
+
+// End tells the client that there is no more log output
+func (w *logWriter) End() (err error) {
+	w.begin()
+	if w.sse {
+		if _, err = w.response.Write([]byte("event: end\ndata: \n\n")); err != nil {
+			return
+		}
+	}
+	w.flush()
+	return
+}
+
+func (w *logWriter) flush() {
+	if flusher, ok := w.response.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// followLog writes the log output until the PipelineRun completes or the context is done
+func followLog(ctx context.Context, writer *logWriter, fetch logFetcher, start int64,
+	completed func() bool, interval time.Duration) (err error) {
+	for {
+		// check it before fetching, so the last piece of the log is not missed
+		done := completed()
+
+		var data []byte
+		var header http.Header
+		if data, header, err = fetch(start); err != nil {
+			return
+		}
+		if len(data) > 0 {
+			if err = writer.Write(data); err != nil {
+				return
+			}
+		}
+
+		var more bool
+		start, more = nextLogOffset(header, start, len(data))
+		if more && len(data) > 0 {
+			continue
+		}
+		if done {
+			return writer.End()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// newLogFetcher returns a fetcher of the whole log, or the log of a step if the node and step are given
+func (h *apiHandler) newLogFetcher(pr *v1alpha3.PipelineRun, nodeID, stepID string) logFetcher {
+	projectName := pr.Namespace
+	pipelineName := pr.Labels[v1alpha3.PipelineNameLabelKey]
+	runID, _ := pr.GetPipelineRunID()
+	branchName := pr.GetRefName()
+
+	return func(start int64) (data []byte, header http.Header, err error) {
+		httpParameters := &devops.HttpParameters{
+			Method: http.MethodGet,
+			Header: http.Header{},
+			Url:    &url.URL{RawQuery: fmt.Sprintf("start=%d", start)},
+		}
+		switch {
+		case nodeID != "" && branchName != "":
+			data, header, err = h.devopsClient.GetBranchStepLog(projectName, pipelineName, branchName, runID, nodeID, stepID, httpParameters)
+		case nodeID != "":
+			data, header, err = h.devopsClient.GetStepLog(projectName, pipelineName, runID, nodeID, stepID, httpParameters)
+		case branchName != "":
+			data, err = h.devopsClient.GetBranchRunLog(projectName, pipelineName, branchName, runID, httpParameters)
+		default:
+			data, err = h.devopsClient.GetRunLog(projectName, pipelineName, runID, httpParameters)
+		}
+		return
+	}
+}
+
+// getStoredLog returns the log from the PipelineRun data store, it's available once the PipelineRun completes
+func (h *apiHandler) getStoredLog(ctx context.Context, pr *v1alpha3.PipelineRun, nodeID, stepID string) string {
+	dataStore, err := h.dataStoreFactory.New(ctx, client.ObjectKeyFromObject(pr))
+	if err != nil {
+		klog.V(4).Infof("failed to create the data store of PipelineRun %s/%s, error: %v", pr.Namespace, pr.Name, err)
+		return ""
+	}
+	if nodeID == "" {
+		return dataStore.Get(store.DataKeyAllLog)
+	}
+	stage, stageErr := strconv.Atoi(nodeID)
+	step, stepErr := strconv.Atoi(stepID)
+	if stageErr != nil || stepErr != nil {
+		return ""
+	}
+	return dataStore.GetStepLog(stage, step)
+}
+
+func (h *apiHandler) getPipelineRunLog(request *restful.Request, response *restful.Response) {
+	namespaceName := request.PathParameter("namespace")
+	pipelineRunName := request.PathParameter("pipelinerun")
+	nodeID := request.QueryParameter("node")
+	stepID := request.QueryParameter("step")
+	follow, _ := strconv.ParseBool(request.QueryParameter("follow"))
+	ctx := request.Request.Context()
+
+	var start int64
+	if startParam := request.QueryParameter("start"); startParam != "" {
+		var err error
+		if start, err = strconv.ParseInt(startParam, 10, 64); err != nil || start < 0 {
+			kapis.HandleBadRequest(response, request, fmt.Errorf("invalid start offset: %s", startParam))
+			return
+		}
+	}
+	if (nodeID == "") != (stepID == "") {
+		kapis.HandleBadRequest(response, request, fmt.Errorf("node and step should be given together"))
+		return
+	}
+
+	key := client.ObjectKey{Namespace: namespaceName, Name: pipelineRunName}
+	pr := &v1alpha3.PipelineRun{}
+	if err := h.client.Get(ctx, key, pr); err != nil {
+		kapis.HandleError(request, response, err)
+		return
+	}
+	if !pr.HasStarted() {
+		kapis.HandleBadRequest(response, request, fmt.Errorf("the PipelineRun %s has not started yet", key))
+		return
+	}
+
+	writer := newLogWriter(request, response)
+	// the log is not changed anymore once the PipelineRun completes
+	if pr.HasCompleted() && start == 0 {
+		if log := h.getStoredLog(ctx, pr, nodeID, stepID); log != "" {
+			if err := writer.Write([]byte(log)); err == nil {
+				_ = writer.End()
+			}
+			return
+		}
+	}
+
+	fetch := h.newLogFetcher(pr, nodeID, stepID)
+	if !follow {
+		data, header, err := fetch(start)
+		if err != nil {
+			kapis.HandleError(request, response, err)
+			return
+		}
+		next, more := nextLogOffset(header, start, len(data))
+		response.AddHeader(headerTextSize, strconv.FormatInt(next, 10))
+		response.AddHeader(headerMoreData, strconv.FormatBool(more || !pr.HasCompleted()))
+		_ = writer.Write(data)
+		return
+	}
+
+	completed := func() bool {
+		latest := &v1alpha3.PipelineRun{}
+		if err := h.client.Get(ctx, key, latest); err != nil {
+			// stop following if the PipelineRun is gone
+			return client.IgnoreNotFound(err) == nil
+		}
+		return latest.HasCompleted()
+	}
+	if err := followLog(ctx, writer, fetch, start, completed, h.logPollInterval()); err != nil {
+		if !writer.started {
+			kapis.HandleError(request, response, err)
+			return
+		}
+		klog.Errorf("failed to follow the log of PipelineRun %s, error: %v", key, err)
+	}
+}
+
+func (h *apiHandler) logPollInterval() time.Duration {
+	if h.logInterval > 0 {
+		return h.logInterval
+	}
+	return defaultLogPollInterval
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pipelinerun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	fakedevops "kubesphere.io/devops/pkg/client/devops/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_nextLogOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		start    int64
+		size     int
+		wantNext int64
+		wantMore bool
+	}{{
+		name:     "without headers",
+		start:    10,
+		size:     5,
+		wantNext: 15,
+	}, {
+		name: "with headers",
+		header: http.Header{
+			"X-Text-Size": []string{"20"},
+			"X-More-Data": []string{"true"},
+		},
+		start:    10,
+		size:     5,
+		wantNext: 20,
+		wantMore: true,
+	}, {
+		name:     "invalid text size",
+		header:   http.Header{"X-Text-Size": []string{"invalid"}},
+		start:    10,
+		size:     5,
+		wantNext: 15,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, more := nextLogOffset(tt.header, tt.start, tt.size)
+			assert.Equal(t, tt.wantNext, next)
+			assert.Equal(t, tt.wantMore, more)
+		})
+	}
+}
+
+// fakeLogFetcher returns a piece of the log output every time, the PipelineRun completes after all the pieces are fetched
+type fakeLogFetcher struct {
+	pieces []string
+	starts []int64
+	index  int
+}
+
+func (f *fakeLogFetcher) fetch(start int64) ([]byte, http.Header, error) {
+	f.starts = append(f.starts, start)
+	if f.index >= len(f.pieces) {
+		return nil, nil, nil
+	}
+	piece := f.pieces[f.index]
+	f.index++
+	return []byte(piece), nil, nil
+}
+
+func (f *fakeLogFetcher) completed() bool {
+	return f.index >= len(f.pieces)
+}
+
+func Test_followLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     string
+		pieces     []string
+		wantBody   string
+		wantType   string
+		wantStarts []int64
+	}{{
+		name:       "chunked HTTP",
+		pieces:     []string{"first\n", "", "second\n"},
+		wantBody:   "first\nsecond\n",
+		wantType:   "text/plain; charset=utf-8",
+		wantStarts: []int64{0, 6, 6, 13},
+	}, {
+		name:       "server-sent events",
+		accept:     "text/event-stream",
+		pieces:     []string{"first\nsecond\n", "third"},
+		wantBody:   "data: first\ndata: second\n\ndata: third\n\nevent: end\ndata: \n\n",
+		wantType:   "text/event-stream",
+		wantStarts: []int64{0, 13, 18},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpRequest := httptest.NewRequest(http.MethodGet, "/", nil)
+			httpRequest.Header.Set("Accept", tt.accept)
+			recorder := httptest.NewRecorder()
+			writer := newLogWriter(restful.NewRequest(httpRequest), restful.NewResponse(recorder))
+
+			fetcher := &fakeLogFetcher{pieces: tt.pieces}
+			err := followLog(context.Background(), writer, fetcher.fetch, 0, fetcher.completed, time.Millisecond)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantBody, recorder.Body.String())
+			assert.Equal(t, tt.wantType, recorder.Header().Get(restful.HEADER_ContentType))
+			assert.Equal(t, tt.wantStarts, fetcher.starts)
+		})
+	}
+
+	t.Run("stop following if failed to fetch", func(t *testing.T) {
+		recorder := httptest.NewRecorder()
+		writer := newLogWriter(restful.NewRequest(httptest.NewRequest(http.MethodGet, "/", nil)), restful.NewResponse(recorder))
+		err := followLog(context.Background(), writer, func(start int64) ([]byte, http.Header, error) {
+			return nil, nil, errors.New("fake")
+		}, 0, func() bool { return false }, time.Millisecond)
+		assert.NotNil(t, err)
+		assert.False(t, writer.started)
+	})
+
+	t.Run("stop following if the context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		recorder := httptest.NewRecorder()
+		writer := newLogWriter(restful.NewRequest(httptest.NewRequest(http.MethodGet, "/", nil)), restful.NewResponse(recorder))
+		err := followLog(ctx, writer, func(start int64) ([]byte, http.Header, error) {
+			return nil, nil, nil
+		}, 0, func() bool { return false }, time.Minute)
+		assert.Nil(t, err)
+	})
+}
+
+func TestGetPipelineRunLog(t *testing.T) {
+	schema, err := v1alpha3.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+	err = v1.SchemeBuilder.AddToScheme(schema)
+	assert.Nil(t, err)
+
+	now := metav1.Now()
+	pending := &v1alpha3.PipelineRun{}
+	pending.SetName("pending")
+	pending.SetNamespace("ns")
+	pending.SetLabels(map[string]string{v1alpha3.PipelineNameLabelKey: "pipeline"})
+	running := pending.DeepCopy()
+	running.SetName("running")
+	running.SetAnnotations(map[string]string{v1alpha3.JenkinsPipelineRunIDAnnoKey: "1"})
+	completed := running.DeepCopy()
+	completed.SetName("completed")
+	completed.Status.CompletionTime = &now
+	storedLog := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "completed"},
+		Data:       map[string]string{"log-all": "stored log", "log-step-1-2": "stored step log"},
+	}
+
+	tests := []struct {
+		name        string
+		pipelineRun string
+		query       string
+		wantCode    int
+		wantBody    string
+		wantHeaders map[string]string
+	}{{
+		name:        "not found",
+		pipelineRun: "fake",
+		wantCode:    http.StatusNotFound,
+	}, {
+		name:        "not started",
+		pipelineRun: "pending",
+		wantCode:    http.StatusBadRequest,
+	}, {
+		name:        "invalid start offset",
+		pipelineRun: "running",
+		query:       "start=-1",
+		wantCode:    http.StatusBadRequest,
+	}, {
+		name:        "node without step",
+		pipelineRun: "running",
+		query:       "node=1",
+		wantCode:    http.StatusBadRequest,
+	}, {
+		name:        "a piece of the log from Jenkins",
+		pipelineRun: "running",
+		query:       "start=5",
+		wantCode:    http.StatusOK,
+		wantHeaders: map[string]string{"X-Text-Size": "5", "X-More-Data": "true"},
+	}, {
+		name:        "stored log of a completed PipelineRun",
+		pipelineRun: "completed",
+		query:       "follow=true",
+		wantCode:    http.StatusOK,
+		wantBody:    "stored log",
+	}, {
+		name:        "stored step log of a completed PipelineRun",
+		pipelineRun: "completed",
+		query:       "node=1&step=2",
+		wantCode:    http.StatusOK,
+		wantBody:    "stored step log",
+	}, {
+		name:        "follow the log of a completed PipelineRun from an offset",
+		pipelineRun: "completed",
+		query:       "follow=true&start=10",
+		wantCode:    http.StatusOK,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().WithScheme(schema).
+				WithObjects(pending.DeepCopy(), running.DeepCopy(), completed.DeepCopy(), storedLog.DeepCopy()).Build()
+			handler := newAPIHandler(apiHandlerOption{
+				client:       c,
+				devopsClient: fakedevops.NewFakeDevops(nil),
+				logInterval:  time.Millisecond,
+			})
+
+			recorder := httptest.NewRecorder()
+			req := restful.NewRequest(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			req.PathParameters()["namespace"] = "ns"
+			req.PathParameters()["pipelinerun"] = tt.pipelineRun
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			handler.getPipelineRunLog(req, resp)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, recorder.Body.String())
+			}
+			for key, value := range tt.wantHeaders {
+				assert.Equal(t, value, recorder.Header().Get(key), key)
+			}
+		})
+	}
+}
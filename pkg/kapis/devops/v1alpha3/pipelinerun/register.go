@@ -29,14 +29,18 @@ import (
 	"kubesphere.io/devops/pkg/api"
 	"kubesphere.io/devops/pkg/client/devops"
 	devopsClient "kubesphere.io/devops/pkg/client/devops"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // RegisterRoutes register routes into web service.
-func RegisterRoutes(ws *restful.WebService, devopsClient devopsClient.Interface, c client.Client) {
+// The PipelineRun data is read from ConfigMaps if the data store factory is nil.
+func RegisterRoutes(ws *restful.WebService, devopsClient devopsClient.Interface, c client.Client,
+	dataStoreFactory *storefactory.Factory) {
 	handler := newAPIHandler(apiHandlerOption{
-		devopsClient: devopsClient,
-		client:       c,
+		devopsClient:     devopsClient,
+		client:           c,
+		dataStoreFactory: dataStoreFactory,
 	})
 
 	ws.Route(ws.GET("/namespaces/{namespace}/pipelines/{pipeline}/pipelineruns").
@@ -75,6 +79,39 @@ func RegisterRoutes(ws *restful.WebService, devopsClient devopsClient.Interface,
 		Param(ws.PathParameter("pipelinerun", "Name of the PipelineRun")).
 		Returns(http.StatusOK, api.StatusOK, []pipelinerun.NodeDetail{}))
 
+	ws.Route(ws.GET("/namespaces/{namespace}/pipelineruns/{pipelinerun}/log").
+		To(handler.getPipelineRunLog).
+		Doc("Get the log of a PipelineRun, or the log of a step if both node and step are given. "+
+			"The log is streamed with chunked HTTP, or Server-Sent Events if the Accept header is text/event-stream").
+		Param(ws.PathParameter("namespace", "Namespace of the PipelineRun")).
+		Param(ws.PathParameter("pipelinerun", "Name of the PipelineRun")).
+		Param(ws.QueryParameter("follow", "Keep streaming the log output until the PipelineRun completes").
+			DataType("bool").
+			DefaultValue("false")).
+		Param(ws.QueryParameter("start", "The offset of the log to start from, it's the X-Text-Size header of the previous response").
+			DataType("integer").
+			DefaultValue("0")).
+		Param(ws.QueryParameter("node", "The node ID of the step")).
+		Param(ws.QueryParameter("step", "The step ID")).
+		Produces(mimeTextPlain, mimeEventStream).
+		Returns(http.StatusOK, api.StatusOK, nil).
+		Metadata(restfulspec.KeyOpenAPITags, []string{constants.DevOpsPipelineTag}))
+
+	ws.Route(ws.POST("/namespaces/{namespace}/pipelineruns/{pipelinerun}/cancel").
+		To(handler.cancelPipelineRun).
+		Doc("Cancel a PipelineRun, the Jenkins build will be stopped if it has started").
+		Param(ws.PathParameter("namespace", "Namespace of the PipelineRun")).
+		Param(ws.PathParameter("pipelinerun", "Name of the PipelineRun")).
+		Returns(http.StatusOK, api.StatusOK, v1alpha3.PipelineRun{}))
+
+	ws.Route(ws.POST("/namespaces/{namespace}/pipelineruns/{pipelinerun}/rerun").
+		To(handler.rerunPipelineRun).
+		Doc("Rerun a PipelineRun with the same parameters and SCM reference as a new PipelineRun").
+		Param(ws.PathParameter("namespace", "Namespace of the PipelineRun")).
+		Param(ws.PathParameter("pipelinerun", "Name of the PipelineRun")).
+		Param(ws.QueryParameter("stage", "The stage name to restart from, only for a completed PipelineRun")).
+		Returns(http.StatusOK, api.StatusOK, v1alpha3.PipelineRun{}))
+
 	// download PipelineRun artifact
 	ws.Route(ws.GET("/namespaces/{namespace}/pipelineruns/{pipelinerun}/artifacts/download").
 		Param(ws.PathParameter("namespace", "Namespace of the PipelineRun")).
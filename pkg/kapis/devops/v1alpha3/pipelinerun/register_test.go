@@ -36,7 +36,7 @@ func TestAPIsExist(t *testing.T) {
 	schema, err := v1alpha1.SchemeBuilder.Register().Build()
 	assert.Nil(t, err)
 
-	RegisterRoutes(wsWithGroup, fakedevops.NewFakeDevops(nil), fake.NewFakeClientWithScheme(schema))
+	RegisterRoutes(wsWithGroup, fakedevops.NewFakeDevops(nil), fake.NewFakeClientWithScheme(schema), nil)
 	restful.DefaultContainer.Add(wsWithGroup)
 
 	type args struct {
@@ -70,6 +70,24 @@ func TestAPIsExist(t *testing.T) {
 			method: http.MethodGet,
 			uri:    "/namespaces/fake/pipelineruns/fake/nodedetails",
 		},
+	}, {
+		name: "get the log of a pipelinerun",
+		args: args{
+			method: http.MethodGet,
+			uri:    "/namespaces/fake/pipelineruns/fake/log",
+		},
+	}, {
+		name: "cancel a pipelinerun",
+		args: args{
+			method: http.MethodPost,
+			uri:    "/namespaces/fake/pipelineruns/fake/cancel",
+		},
+	}, {
+		name: "rerun a pipelinerun",
+		args: args{
+			method: http.MethodPost,
+			uri:    "/namespaces/fake/pipelineruns/fake/rerun",
+		},
 	}, {
 		name: "receive pipeline event",
 		args: args{
@@ -29,6 +29,7 @@ import (
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/apiserver/query"
 	"kubesphere.io/devops/pkg/client/devops"
+	"kubesphere.io/devops/pkg/utils/k8sutil"
 )
 
 func buildLabelSelector(queryParam *query.Query, pipelineName string) (labels.Selector, error) {
@@ -122,3 +123,43 @@ func CreateBarePipelineRun(pipeline *v1alpha3.Pipeline, parameters []v1alpha3.Pa
 	}
 	return pipelineRun
 }
+
+// CreateRerunPipelineRun creates a PipelineRun which reruns the original one with the same specification.
+// The new PipelineRun restarts from the given stage of the original Jenkins build if the stage is not empty.
+func CreateRerunPipelineRun(original *v1alpha3.PipelineRun, stage string) *v1alpha3.PipelineRun {
+	spec := original.Spec.DeepCopy()
+	// the actions on the original PipelineRun should not be inherited
+	spec.Action = nil
+	spec.CancelRequested = false
+
+	generateName := original.GenerateName
+	if generateName == "" {
+		if spec.PipelineRef != nil && spec.PipelineRef.Name != "" {
+			generateName = spec.PipelineRef.Name + "-"
+		} else {
+			generateName = original.Name + "-"
+		}
+	}
+	pipelineRun := &v1alpha3.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName:    generateName,
+			Namespace:       original.Namespace,
+			OwnerReferences: original.OwnerReferences,
+			Annotations: map[string]string{
+				v1alpha3.PipelineRunRerunOfAnnoKey: original.Name,
+			},
+			Labels: map[string]string{
+				v1alpha3.PipelineRunRerunOfLabelKey: k8sutil.LabelValue(original.Name),
+			},
+		},
+		Spec: *spec,
+	}
+	if pipelineName, ok := original.Labels[v1alpha3.PipelineNameLabelKey]; ok {
+		pipelineRun.Labels[v1alpha3.PipelineNameLabelKey] = pipelineName
+	}
+	if runID, ok := original.GetPipelineRunID(); ok && stage != "" {
+		pipelineRun.Annotations[v1alpha3.PipelineRunRestartStageAnnoKey] = stage
+		pipelineRun.Annotations[v1alpha3.PipelineRunRestartRunIDAnnoKey] = runID
+	}
+	return pipelineRun
+}
@@ -20,11 +20,14 @@ import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"reflect"
+	"strings"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/apiserver/query"
 	"kubesphere.io/devops/pkg/client/devops"
@@ -227,3 +230,73 @@ func TestCreatePipelineRun(t *testing.T) {
 	assert.Equal(t, pipelineRun.Namespace, pipeline.Namespace)
 	assert.NotNil(t, pipelineRun.Annotations)
 }
+
+func TestCreateRerunPipelineRun(t *testing.T) {
+	stop := v1alpha3.Stop
+	original := &v1alpha3.PipelineRun{
+		ObjectMeta: v1.ObjectMeta{
+			Name:         "pipeline-abcde",
+			GenerateName: "pipeline-",
+			Namespace:    "ns",
+			Labels: map[string]string{
+				v1alpha3.PipelineNameLabelKey: "pipeline",
+			},
+			Annotations: map[string]string{
+				v1alpha3.JenkinsPipelineRunIDAnnoKey: "2",
+				v1alpha3.PipelineRunCreatorAnnoKey:   "alice",
+			},
+		},
+		Spec: v1alpha3.PipelineRunSpec{
+			PipelineRef:     &corev1.ObjectReference{Name: "pipeline"},
+			Parameters:      []v1alpha3.Parameter{{Name: "name", Value: "value"}},
+			SCM:             &v1alpha3.SCM{RefType: "branch", RefName: "master"},
+			Action:          &stop,
+			CancelRequested: true,
+		},
+	}
+
+	t.Run("rerun", func(t *testing.T) {
+		pr := CreateRerunPipelineRun(original, "")
+		assert.Equal(t, "pipeline-", pr.GenerateName)
+		assert.Equal(t, "ns", pr.Namespace)
+		assert.Equal(t, map[string]string{
+			v1alpha3.PipelineNameLabelKey:       "pipeline",
+			v1alpha3.PipelineRunRerunOfLabelKey: "pipeline-abcde",
+		}, pr.Labels)
+		assert.Equal(t, map[string]string{
+			v1alpha3.PipelineRunRerunOfAnnoKey: "pipeline-abcde",
+		}, pr.Annotations)
+		assert.Equal(t, original.Spec.Parameters, pr.Spec.Parameters)
+		assert.Equal(t, original.Spec.SCM, pr.Spec.SCM)
+		assert.Nil(t, pr.Spec.Action)
+		assert.False(t, pr.Spec.CancelRequested)
+	})
+
+	t.Run("restart from a stage", func(t *testing.T) {
+		pr := CreateRerunPipelineRun(original, "build")
+		assert.Equal(t, map[string]string{
+			v1alpha3.PipelineRunRerunOfAnnoKey:      "pipeline-abcde",
+			v1alpha3.PipelineRunRestartStageAnnoKey: "build",
+			v1alpha3.PipelineRunRestartRunIDAnnoKey: "2",
+		}, pr.Annotations)
+	})
+
+	t.Run("long name without generate name", func(t *testing.T) {
+		longOriginal := original.DeepCopy()
+		longOriginal.Name = strings.Repeat("a", 70)
+		longOriginal.GenerateName = ""
+		longOriginal.Spec.PipelineRef = nil
+		pr := CreateRerunPipelineRun(longOriginal, "")
+		assert.Equal(t, longOriginal.Name+"-", pr.GenerateName)
+		assert.Equal(t, longOriginal.Name, pr.Annotations[v1alpha3.PipelineRunRerunOfAnnoKey])
+		assert.LessOrEqual(t, len(pr.Labels[v1alpha3.PipelineRunRerunOfLabelKey]), validation.LabelValueMaxLength)
+		assert.Empty(t, validation.IsValidLabelValue(pr.Labels[v1alpha3.PipelineRunRerunOfLabelKey]))
+	})
+
+	t.Run("fall back to the pipeline name", func(t *testing.T) {
+		noGenerateName := original.DeepCopy()
+		noGenerateName.GenerateName = ""
+		pr := CreateRerunPipelineRun(noGenerateName, "")
+		assert.Equal(t, "pipeline-", pr.GenerateName)
+	})
+}
@@ -44,6 +44,7 @@ import (
 	devopsClient "kubesphere.io/devops/pkg/client/devops"
 	"kubesphere.io/devops/pkg/constants"
 	"kubesphere.io/devops/pkg/server/params"
+	storefactory "kubesphere.io/devops/pkg/store/factory"
 )
 
 // TODO perhaps we can find a better way to declaim the permission needs of the apiserver
@@ -56,7 +57,8 @@ var GroupVersion = schema.GroupVersion{Group: api.GroupName, Version: "v1alpha3"
 
 // AddToContainer adds web service into container.
 func AddToContainer(container *restful.Container, devopsClient devopsClient.Interface, k8sClient k8s.Client,
-	client client.Client, tokenIssue token.Issuer, jenkins core.JenkinsCore) (wss []*restful.WebService) {
+	client client.Client, tokenIssue token.Issuer, jenkins core.JenkinsCore,
+	dataStoreFactory *storefactory.Factory) (wss []*restful.WebService) {
 
 	services := []*restful.WebService{
 		runtime.NewWebService(v1alpha3.GroupVersion),
@@ -65,7 +67,7 @@ func AddToContainer(container *restful.Container, devopsClient devopsClient.Inte
 
 	for _, service := range services {
 		registerRoutes(devopsClient, k8sClient, client, service)
-		pipelinerun.RegisterRoutes(service, devopsClient, client)
+		pipelinerun.RegisterRoutes(service, devopsClient, client, dataStoreFactory)
 		pipeline.RegisterRoutes(service, client)
 		template.RegisterRoutes(service, &common.Options{
 			GenericClient: client,
@@ -61,7 +61,7 @@ func TestAPIsExist(t *testing.T) {
 		ObjectMeta: metav1.ObjectMeta{
 			Name: "fake", Namespace: "fake",
 		},
-	}), &token.FakeIssuer{}, core.JenkinsCore{})
+	}), &token.FakeIssuer{}, core.JenkinsCore{}, nil)
 
 	type args struct {
 		method string
@@ -271,7 +271,7 @@ func TestGetDevOpsProject(t *testing.T) {
 					constants.WorkspaceLabelKey: "ws",
 				},
 			},
-		})), fake.NewFakeClientWithScheme(schema), &token.FakeIssuer{}, core.JenkinsCore{})
+		})), fake.NewFakeClientWithScheme(schema), &token.FakeIssuer{}, core.JenkinsCore{}, nil)
 
 	type args struct {
 		method string
@@ -34,6 +34,7 @@ import (
 
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
@@ -190,6 +191,42 @@ func TestSCMWebhook(t *testing.T) {
 		scmAnnotationKey:    "https://gitlab.com/linuxsuren/test",
 	})
 
+	gitRepoSecret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "gitlab", Namespace: "default"},
+		Type:       v1alpha3.SecretTypeSecretText,
+		Data:       map[string][]byte{v1alpha3.SecretTextSecretKey: []byte("repo-token")},
+	}
+	webhookSecret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{Name: "webhook", Namespace: "default"},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{corev1.ServiceAccountTokenKey: []byte("webhook-token")},
+	}
+	gitRepo := &v1alpha3.GitRepository{
+		ObjectMeta: v1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: v1alpha3.GitRepositorySpec{
+			Provider: "gitlab",
+			URL:      "https://gitlab.com/linuxsuren/test",
+			Secret:   &corev1.SecretReference{Name: "gitlab"},
+		},
+	}
+	gitRepoWithWebhook := gitRepo.DeepCopy()
+	gitRepoWithWebhook.Spec.Webhooks = []corev1.LocalObjectReference{{Name: "webhook"}}
+	webhook := &v1alpha3.Webhook{
+		ObjectMeta: v1.ObjectMeta{Name: "webhook", Namespace: "default"},
+		Spec: v1alpha3.WebhookSpec{
+			Secret: &corev1.SecretReference{Name: "webhook"},
+		},
+	}
+
+	// another project has the same repository with a different secret
+	otherPipeline := defaultPipeline.DeepCopy()
+	otherPipeline.SetNamespace("other")
+	otherGitRepoSecret := gitRepoSecret.DeepCopy()
+	otherGitRepoSecret.SetNamespace("other")
+	otherGitRepoSecret.Data = map[string][]byte{v1alpha3.SecretTextSecretKey: []byte("other-token")}
+	otherGitRepo := gitRepo.DeepCopy()
+	otherGitRepo.SetNamespace("other")
+
 	type args struct {
 		method     string
 		uri        string
@@ -200,6 +237,7 @@ func TestSCMWebhook(t *testing.T) {
 	tests := []struct {
 		name      string
 		args      args
+		wantCode  int
 		assertion func(t *testing.T, c client.Client, body string)
 	}{{
 		name: "unknown SCM webhook",
@@ -208,6 +246,7 @@ func TestSCMWebhook(t *testing.T) {
 			uri:        "/webhooks/scm",
 			initObject: []runtime.Object{},
 		},
+		wantCode: http.StatusOK,
 		assertion: func(t *testing.T, c client.Client, body string) {
 			assert.Equal(t, "unknown SCM type", body)
 		},
@@ -216,12 +255,14 @@ func TestSCMWebhook(t *testing.T) {
 		args: args{
 			method:     http.MethodPost,
 			uri:        "/webhooks/scm",
-			initObject: []runtime.Object{},
+			initObject: []runtime.Object{gitRepo.DeepCopy(), gitRepoSecret.DeepCopy()},
 			bodyJSON:   gitlabWebhookBody,
 			header: map[string]string{
 				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "repo-token",
 			},
 		},
+		wantCode: http.StatusOK,
 		assertion: func(t *testing.T, c client.Client, body string) {
 			assert.Equal(t, "no pipeline matched", body)
 		},
@@ -230,14 +271,95 @@ func TestSCMWebhook(t *testing.T) {
 		args: args{
 			method:     http.MethodPost,
 			uri:        "/webhooks/scm",
-			initObject: []runtime.Object{defaultPipeline.DeepCopy()},
+			initObject: []runtime.Object{defaultPipeline.DeepCopy(), gitRepo.DeepCopy(), gitRepoSecret.DeepCopy()},
 			bodyJSON:   gitlabWebhookBody,
 			header: map[string]string{
 				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "repo-token",
+			},
+		},
+		wantCode: http.StatusOK,
+		assertion: func(t *testing.T, c client.Client, body string) {
+			assert.Equal(t, "ok", body)
+		},
+	}, {
+		name: "gitlab webhook verified by the secret of Webhook",
+		args: args{
+			method:     http.MethodPost,
+			uri:        "/webhooks/scm",
+			initObject: []runtime.Object{defaultPipeline.DeepCopy(), gitRepoWithWebhook.DeepCopy(), webhook.DeepCopy(), gitRepoSecret.DeepCopy(), webhookSecret.DeepCopy()},
+			bodyJSON:   gitlabWebhookBody,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "webhook-token",
+			},
+		},
+		wantCode: http.StatusOK,
+		assertion: func(t *testing.T, c client.Client, body string) {
+			assert.Equal(t, "ok", body)
+		},
+	}, {
+		name: "gitlab webhook only triggers the pipelines in the verified namespaces",
+		args: args{
+			method: http.MethodPost,
+			uri:    "/webhooks/scm",
+			initObject: []runtime.Object{defaultPipeline.DeepCopy(), gitRepo.DeepCopy(), gitRepoSecret.DeepCopy(),
+				otherPipeline, otherGitRepo, otherGitRepoSecret},
+			bodyJSON: gitlabWebhookBody,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "other-token",
 			},
 		},
+		wantCode: http.StatusOK,
 		assertion: func(t *testing.T, c client.Client, body string) {
 			assert.Equal(t, "ok", body)
+
+			pipelineRuns := &v1alpha3.PipelineRunList{}
+			assert.Nil(t, c.List(context.Background(), pipelineRuns))
+			if assert.Equal(t, 1, len(pipelineRuns.Items)) {
+				assert.Equal(t, "other", pipelineRuns.Items[0].Namespace)
+			}
+		},
+	}, {
+		name: "gitlab webhook with a wrong token",
+		args: args{
+			method:     http.MethodPost,
+			uri:        "/webhooks/scm",
+			initObject: []runtime.Object{defaultPipeline.DeepCopy(), gitRepo.DeepCopy(), gitRepoSecret.DeepCopy()},
+			bodyJSON:   gitlabWebhookBody,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+				"X-Gitlab-Token": "wrong-token",
+			},
+		},
+		wantCode: http.StatusUnauthorized,
+		assertion: func(t *testing.T, c client.Client, body string) {
+			pipelineRuns := &v1alpha3.PipelineRunList{}
+			assert.Nil(t, c.List(context.Background(), pipelineRuns))
+			assert.Equal(t, 0, len(pipelineRuns.Items))
+
+			events := &corev1.EventList{}
+			assert.Nil(t, c.List(context.Background(), events))
+			if assert.Equal(t, 1, len(events.Items)) {
+				assert.Equal(t, reasonInvalidWebhookSignature, events.Items[0].Reason)
+				assert.Equal(t, "test", events.Items[0].InvolvedObject.Name)
+			}
+		},
+	}, {
+		name: "gitlab webhook without any secrets",
+		args: args{
+			method:     http.MethodPost,
+			uri:        "/webhooks/scm",
+			initObject: []runtime.Object{defaultPipeline.DeepCopy()},
+			bodyJSON:   gitlabWebhookBody,
+			header: map[string]string{
+				"X-Gitlab-Event": "Push Hook",
+			},
+		},
+		wantCode: http.StatusUnauthorized,
+		assertion: func(t *testing.T, c client.Client, body string) {
+			assert.Contains(t, body, errWebhookSecretNotFound.Error())
 		},
 	}}
 	for _, tt := range tests {
@@ -263,7 +385,7 @@ func TestSCMWebhook(t *testing.T) {
 			}
 			httpWriter := httptest.NewRecorder()
 			container.Dispatch(httpWriter, httpRequest)
-			assert.Equal(t, 200, httpWriter.Code)
+			assert.Equal(t, tt.wantCode, httpWriter.Code)
 			if tt.assertion != nil {
 				body := httpWriter.Body
 				var bodyResponse string
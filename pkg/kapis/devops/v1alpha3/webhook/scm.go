@@ -23,13 +23,13 @@ import (
 	"github.com/emicklei/go-restful"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/driver/bitbucket"
+	"github.com/jenkins-x/go-scm/scm/driver/gitea"
 	"github.com/jenkins-x/go-scm/scm/driver/github"
 	"github.com/jenkins-x/go-scm/scm/driver/gitlab"
 	"github.com/jenkins-zh/jenkins-client/pkg/core"
 	"github.com/jenkins-zh/jenkins-client/pkg/job"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
-	"kubesphere.io/devops/pkg/client/devops"
 	"kubesphere.io/devops/pkg/jwt/token"
 	"kubesphere.io/devops/pkg/kapis/devops/v1alpha3/pipelinerun"
 	"net/http"
@@ -62,6 +62,11 @@ func NewSCMHandler(genericClient client.Client, issue token.Issuer, jenkins core
 }
 
 func getSCMClient(request *http.Request) *scm.Client {
+	// Gitea sends the GitHub event header as well, so it must be checked before GitHub
+	if request.Header.Get("X-Gitea-Event") != "" {
+		return &scm.Client{Driver: scm.DriverGitea, Webhooks: gitea.NewWebHookService()}
+	}
+
 	if request.Header.Get("X-Gitlab-Event") != "" {
 		return gitlab.NewDefault()
 	}
@@ -83,25 +88,28 @@ func (h *SCMHandler) scmWebhook(request *restful.Request, response *restful.Resp
 		return
 	}
 
-	webhook, err := scmClient.Webhooks.Parse(request.Request, func(webhook scm.Webhook) (string, error) {
-		return "", nil
-	})
+	webhook, namespaces, rejected, err := h.verifyWebhook(scmClient, request.Request)
 	if err != nil {
+		if err == scm.ErrSignatureInvalid || err == errWebhookSecretNotFound {
+			h.rejectWebhook(rejected, webhook, err)
+			_ = response.WriteErrorString(http.StatusUnauthorized, err.Error())
+			return
+		}
 		_, _ = response.Write([]byte(err.Error()))
 		return
 	}
 
 	ctx := context.TODO()
 	found := false
-	if webhook.Kind() == scm.WebhookKindPush {
+	if event := newSCMEvent(scmClient.Driver, webhook); event != nil {
 		repo := webhook.Repository()
-		pushHook := webhook.(*scm.PushHook)
 
 		pipelineList := &v1alpha3.PipelineList{}
 		if err = h.List(ctx, pipelineList); err == nil {
 			for i := range pipelineList.Items {
 				pipeline := pipelineList.Items[i]
-				if !branchMatch(pipeline, pushHook.Ref) {
+				// only the namespaces whose secret verified the delivery are trusted
+				if !namespaces[pipeline.Namespace] || !branchMatch(pipeline, event.ref, event.fullRef) {
 					continue
 				}
 				found = true
@@ -114,7 +122,7 @@ func (h *SCMHandler) scmWebhook(request *restful.Request, response *restful.Resp
 					}
 				} else if gitURL != "" {
 					if gitRepoMatch(gitURL, repo.Link, repo.Clone, repo.CloneSSH) {
-						err = h.createPipelineRun(pipeline, pushHook)
+						err = h.createPipelineRun(pipeline, event)
 					} else {
 						err = fmt.Errorf("expect URL: %s, got: %v", gitURL, []string{repo.Link, repo.Clone, repo.CloneSSH})
 					}
@@ -133,15 +141,10 @@ func (h *SCMHandler) scmWebhook(request *restful.Request, response *restful.Resp
 	}
 }
 
-func (h *SCMHandler) createPipelineRun(pipeline v1alpha3.Pipeline, hook *scm.PushHook) (err error) {
-	branch := strings.TrimPrefix(hook.Ref, "refs/heads/")
-
-	var scmObj *v1alpha3.SCM
-	if scmObj, err = pipelinerun.CreateScm(&pipeline.Spec, branch); err == nil {
-		run := pipelinerun.CreatePipelineRun(&pipeline, &devops.RunPayload{}, scmObj)
-		run.Annotations[triggerAnnotationKey] = "webhook"
-		err = h.Create(context.Background(), run)
-	}
+func (h *SCMHandler) createPipelineRun(pipeline v1alpha3.Pipeline, event *scmEvent) (err error) {
+	run := pipelinerun.CreateBarePipelineRun(&pipeline, event.parameters, event.scm)
+	run.Annotations[triggerAnnotationKey] = "webhook"
+	err = h.Create(context.Background(), run)
 	return
 }
 
@@ -165,7 +168,7 @@ func scanJenkinsMultiBranchPipeline(pipeline v1alpha3.Pipeline, jenkins core.Jen
 
 // branchMatch matches the branch rules from annotation.
 // It supports regexp pattern, or returns true if no annotation found
-func branchMatch(pipeline v1alpha3.Pipeline, branch string) (ok bool) {
+func branchMatch(pipeline v1alpha3.Pipeline, refs ...string) (ok bool) {
 	branchRules := pipeline.Annotations[scmRefAnnotationKey]
 	if branchRules == "" {
 		ok = true
@@ -176,8 +179,13 @@ func branchMatch(pipeline v1alpha3.Pipeline, branch string) (ok bool) {
 		for i := range branchSlice {
 			rule := branchSlice[i]
 
-			if ok, _ = regexp.Match(rule, []byte(branch)); ok {
-				return
+			for _, ref := range refs {
+				if ref == "" {
+					continue
+				}
+				if ok, _ = regexp.Match(rule, []byte(ref)); ok {
+					return
+				}
 			}
 		}
 	}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jenkins-x/go-scm/scm"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+)
+
+// The parameter names are the same as the environment variables of a Jenkins multi-branch Pipeline,
+// so that a Jenkinsfile works well with both a multi-branch Pipeline and a webhook triggered one.
+const (
+	paramGitCommit    = "GIT_COMMIT"
+	paramTagName      = "TAG_NAME"
+	paramChangeID     = "CHANGE_ID"
+	paramChangeBranch = "CHANGE_BRANCH"
+	paramChangeTarget = "CHANGE_TARGET"
+	paramChangeAuthor = "CHANGE_AUTHOR"
+)
+
+// scmEvent represents a webhook delivery which is able to trigger PipelineRuns.
+type scmEvent struct {
+	// ref is the short name of the reference to match the branch rules of a Pipeline, e.g. master rather than
+	// refs/heads/master. It's the target branch for a pull request.
+	ref string
+	// fullRef is the full name of the reference, e.g. refs/heads/master, the rules written against it keep working
+	fullRef    string
+	scm        *v1alpha3.SCM
+	parameters []v1alpha3.Parameter
+}
+
+// newSCMEvent returns nil if the webhook is not able to trigger PipelineRuns.
+func newSCMEvent(driver scm.Driver, webhook scm.Webhook) *scmEvent {
+	switch hook := webhook.(type) {
+	case *scm.PushHook:
+		return newPushEvent(hook)
+	case *scm.PullRequestHook:
+		return newPullRequestEvent(driver, hook)
+	}
+	return nil
+}
+
+func newPushEvent(hook *scm.PushHook) *scmEvent {
+	if hook.Deleted {
+		return nil
+	}
+
+	event := &scmEvent{
+		ref:     scm.TrimRef(hook.Ref),
+		fullRef: hook.Ref,
+		parameters: []v1alpha3.Parameter{{
+			Name:  paramGitCommit,
+			Value: hook.After,
+		}},
+	}
+	if scm.IsTag(hook.Ref) {
+		tag := scm.TrimRef(hook.Ref)
+		event.scm = &v1alpha3.SCM{RefType: v1alpha3.Tag, RefName: tag}
+		event.parameters = append(event.parameters, v1alpha3.Parameter{Name: paramTagName, Value: tag})
+	} else {
+		event.scm = &v1alpha3.SCM{RefType: v1alpha3.Branch, RefName: event.ref}
+	}
+	return event
+}
+
+func newPullRequestEvent(driver scm.Driver, hook *scm.PullRequestHook) *scmEvent {
+	action := hook.Action
+	if action == scm.ActionUpdate && hook.Changes.Base.Sha.From != "" {
+		// Gitlab sends an update with the previous head commit when new commits are pushed, the other updates like
+		// editing the title must not trigger PipelineRuns
+		action = scm.ActionSync
+	}
+	switch action {
+	case scm.ActionOpen, scm.ActionReopen, scm.ActionSync:
+	default:
+		return nil
+	}
+
+	pr := hook.PullRequest
+	refType, refPrefix := v1alpha3.PullRequest, "PR"
+	if driver == scm.DriverGitlab {
+		refType, refPrefix = v1alpha3.MergeRequest, "MR"
+	}
+	headSHA := pr.Sha
+	if headSHA == "" {
+		headSHA = pr.Head.Sha
+	}
+	target := pr.Target
+	if target == "" {
+		target = pr.Base.Ref
+	}
+	// some providers send the full reference of the target branch
+	target = scm.TrimRef(target)
+	source := pr.Source
+	if source == "" {
+		source = pr.Head.Ref
+	}
+
+	return &scmEvent{
+		ref:     target,
+		fullRef: "refs/heads/" + target,
+		scm: &v1alpha3.SCM{
+			RefType: refType,
+			RefName: fmt.Sprintf("%s-%d", refPrefix, pr.Number),
+		},
+		parameters: []v1alpha3.Parameter{{
+			Name:  paramGitCommit,
+			Value: headSHA,
+		}, {
+			Name:  paramChangeID,
+			Value: strconv.Itoa(pr.Number),
+		}, {
+			Name:  paramChangeBranch,
+			Value: source,
+		}, {
+			Name:  paramChangeTarget,
+			Value: target,
+		}, {
+			Name:  paramChangeAuthor,
+			Value: pr.Author.Login,
+		}},
+	}
+}
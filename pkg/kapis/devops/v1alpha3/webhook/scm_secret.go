@@ -0,0 +1,196 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/jenkins-x/go-scm/scm"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+)
+
+// errWebhookSecretNotFound indicates that there is no secret to verify the deliveries of a repository.
+var errWebhookSecretNotFound = errors.New("no webhook secret found for the repository")
+
+// maxWebhookPayloadSize is the same as the limit of the SCM drivers
+const maxWebhookPayloadSize = 10000000
+
+const (
+	// reasonInvalidWebhookSignature is the event reason of rejecting a delivery due to an invalid signature.
+	reasonInvalidWebhookSignature = "InvalidWebhookSignature"
+	// eventSourceComponent is the component name of the Kubernetes events from the webhook handler.
+	eventSourceComponent = "devops-apiserver"
+)
+
+// repoSecrets are the secrets of a GitRepository to verify the deliveries of its repository.
+type repoSecrets struct {
+	gitRepo *v1alpha3.GitRepository
+	secrets []string
+}
+
+// getWebhookSecrets returns the secrets of all the GitRepositories which match the given repository.
+// The secrets of the Webhooks referenced by a GitRepository come before the one of the GitRepository.
+func (h *SCMHandler) getWebhookSecrets(repo scm.Repository) (candidates []repoSecrets, err error) {
+	gitRepoList := &v1alpha3.GitRepositoryList{}
+	if err = h.List(context.Background(), gitRepoList); err != nil {
+		return
+	}
+
+	for i := range gitRepoList.Items {
+		item := &gitRepoList.Items[i]
+		if item.Spec.URL == "" || !gitRepoMatch(item.Spec.URL, repo.Link, repo.Clone, repo.CloneSSH) {
+			continue
+		}
+		candidate := repoSecrets{gitRepo: item}
+
+		for _, webhookRef := range item.Spec.Webhooks {
+			webhook := &v1alpha3.Webhook{}
+			if err := h.Get(context.Background(), types.NamespacedName{
+				Namespace: item.Namespace, Name: webhookRef.Name,
+			}, webhook); err != nil || webhook.Spec.Secret == nil {
+				continue
+			}
+			if secret := h.getSecretToken(webhook.Spec.Secret, item.Namespace); secret != "" {
+				candidate.secrets = append(candidate.secrets, secret)
+			}
+		}
+
+		if item.Spec.Secret != nil {
+			if secret := h.getSecretToken(item.Spec.Secret, item.Namespace); secret != "" {
+				candidate.secrets = append(candidate.secrets, secret)
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return
+}
+
+// verifyWebhook parses the delivery and verifies it with the secrets of all the GitRepositories which match its
+// repository. The GitRepositories of different namespaces may have different secrets, so it returns the namespaces
+// whose secret verified the delivery. The rejected GitRepositories are returned if no secret verified it.
+func (h *SCMHandler) verifyWebhook(scmClient *scm.Client, request *http.Request) (
+	webhook scm.Webhook, namespaces map[string]bool, rejected []*v1alpha3.GitRepository, err error) {
+	var body []byte
+	if body, err = io.ReadAll(io.LimitReader(request.Body, maxWebhookPayloadSize)); err != nil {
+		return
+	}
+	parse := func(secret string) (scm.Webhook, error) {
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		return scmClient.Webhooks.Parse(request, func(scm.Webhook) (string, error) {
+			return secret, nil
+		})
+	}
+
+	// the delivery is not verified without a secret, it's only parsed to find the repository
+	if webhook, err = parse(""); err != nil || webhook == nil {
+		return
+	}
+
+	var candidates []repoSecrets
+	if candidates, err = h.getWebhookSecrets(webhook.Repository()); err != nil {
+		return
+	}
+
+	namespaces = map[string]bool{}
+	err = errWebhookSecretNotFound
+	for _, candidate := range candidates {
+		rejected = append(rejected, candidate.gitRepo)
+		for _, secret := range candidate.secrets {
+			err = scm.ErrSignatureInvalid
+			if _, parseErr := parse(secret); parseErr == nil {
+				namespaces[candidate.gitRepo.Namespace] = true
+				break
+			}
+		}
+	}
+	if len(namespaces) > 0 {
+		err = nil
+		rejected = nil
+	}
+	return
+}
+
+// getSecretToken returns the token from the secret in the namespace of the GitRepository,
+// the secrets in other namespaces are ignored
+func (h *SCMHandler) getSecretToken(ref *corev1.SecretReference, namespace string) (token string) {
+	if ref.Namespace != "" && ref.Namespace != namespace {
+		klog.V(4).Infof("ignore secret %s/%s which is not in namespace %s", ref.Namespace, ref.Name, namespace)
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		klog.V(4).Infof("cannot get secret %s/%s, error is: %v", namespace, ref.Name, err)
+		return
+	}
+
+	switch secret.Type {
+	case corev1.SecretTypeBasicAuth, v1alpha3.SecretTypeBasicAuth:
+		token = string(secret.Data[corev1.BasicAuthPasswordKey])
+	case v1alpha3.SecretTypeSecretText:
+		token = string(secret.Data[v1alpha3.SecretTextSecretKey])
+	case corev1.SecretTypeOpaque:
+		token = string(secret.Data[corev1.ServiceAccountTokenKey])
+	}
+	return
+}
+
+// rejectWebhook records a warning event to each GitRepository which rejected a delivery.
+func (h *SCMHandler) rejectWebhook(gitRepos []*v1alpha3.GitRepository, webhook scm.Webhook, reason error) {
+	message := fmt.Sprintf("rejected the webhook delivery, error: %v", reason)
+	if webhook != nil {
+		message = fmt.Sprintf("rejected the webhook delivery of kind %s from %s, error: %v",
+			webhook.Kind(), webhook.Repository().Link, reason)
+	}
+	klog.Warning(message)
+
+	now := metav1.Now()
+	for _, gitRepo := range gitRepos {
+		event := &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: gitRepo.Name + ".",
+				Namespace:    gitRepo.Namespace,
+			},
+			InvolvedObject: corev1.ObjectReference{
+				APIVersion: v1alpha3.GroupVersion.String(),
+				Kind:       "GitRepository",
+				Namespace:  gitRepo.Namespace,
+				Name:       gitRepo.Name,
+				UID:        gitRepo.UID,
+			},
+			Reason:         reasonInvalidWebhookSignature,
+			Message:        message,
+			Type:           corev1.EventTypeWarning,
+			Source:         corev1.EventSource{Component: eventSourceComponent},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		}
+		if err := h.Create(context.Background(), event); err != nil {
+			klog.Errorf("failed to record event for GitRepository %s/%s, error: %v", gitRepo.Namespace, gitRepo.Name, err)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package webhook
 import (
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/go-scm/scm/driver/bitbucket"
+	"github.com/jenkins-x/go-scm/scm/driver/gitea"
 	"github.com/jenkins-x/go-scm/scm/driver/github"
 	"github.com/jenkins-x/go-scm/scm/driver/gitlab"
 	"github.com/stretchr/testify/assert"
@@ -69,6 +70,18 @@ func Test_getSCMClient(t *testing.T) {
 			},
 		},
 		want: bitbucket.NewDefault(),
+	}, {
+		name: "gitea",
+		args: args{
+			request: func() *http.Request {
+				defaultRequest := &http.Request{}
+				defaultRequest.Header = map[string][]string{}
+				defaultRequest.Header.Add("X-Gitea-Event", "push")
+				defaultRequest.Header.Add("X-GitHub-Event", "push")
+				return defaultRequest
+			},
+		},
+		want: &scm.Client{Driver: scm.DriverGitea, Webhooks: gitea.NewWebHookService()},
 	}, {
 		name: "unknown SCM provider",
 		args: args{
@@ -88,7 +101,7 @@ func Test_getSCMClient(t *testing.T) {
 func Test_branchMatch(t *testing.T) {
 	type args struct {
 		pipeline v1alpha3.Pipeline
-		branch   string
+		refs     []string
 	}
 	tests := []struct {
 		name   string
@@ -98,7 +111,7 @@ func Test_branchMatch(t *testing.T) {
 		name: "no any annotations",
 		args: args{
 			pipeline: v1alpha3.Pipeline{},
-			branch:   "master",
+			refs:     []string{"master"},
 		},
 		wantOk: true,
 	}, {
@@ -111,7 +124,7 @@ func Test_branchMatch(t *testing.T) {
 					},
 				},
 			},
-			branch: "master",
+			refs: []string{"master"},
 		},
 		wantOk: true,
 	}, {
@@ -124,13 +137,177 @@ func Test_branchMatch(t *testing.T) {
 					},
 				},
 			},
-			branch: "feat-login",
+			refs: []string{"feat-login"},
 		},
 		wantOk: true,
+	}, {
+		name: "anchored rule",
+		args: args{
+			pipeline: v1alpha3.Pipeline{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{
+						scmRefAnnotationKey: `["^master$"]`,
+					},
+				},
+			},
+			refs: []string{"master"},
+		},
+		wantOk: true,
+	}, {
+		name: "rule against the full reference",
+		args: args{
+			pipeline: v1alpha3.Pipeline{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{
+						scmRefAnnotationKey: `["^refs/heads/release-.*"]`,
+					},
+				},
+			},
+			refs: []string{"release-1.0", "refs/heads/release-1.0"},
+		},
+		wantOk: true,
+	}, {
+		name: "rule against the full reference of another branch",
+		args: args{
+			pipeline: v1alpha3.Pipeline{
+				ObjectMeta: v1.ObjectMeta{
+					Annotations: map[string]string{
+						scmRefAnnotationKey: `["^refs/heads/release-.*"]`,
+					},
+				},
+			},
+			refs: []string{"master", "refs/heads/master"},
+		},
+		wantOk: false,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equalf(t, tt.wantOk, branchMatch(tt.args.pipeline, tt.args.refs...), "branchMatch(%v, %v)", tt.args.pipeline, tt.args.refs)
+		})
+	}
+}
+
+func Test_newSCMEvent(t *testing.T) {
+	pullRequest := scm.PullRequest{
+		Number: 1,
+		Sha:    "head-sha",
+		Source: "feature",
+		Target: "master",
+		Author: scm.User{Login: "linuxsuren"},
+	}
+	tests := []struct {
+		name    string
+		driver  scm.Driver
+		webhook scm.Webhook
+		want    *scmEvent
+	}{{
+		name:    "branch push",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PushHook{Ref: "refs/heads/master", After: "sha"},
+		want: &scmEvent{
+			ref:        "master",
+			fullRef:    "refs/heads/master",
+			scm:        &v1alpha3.SCM{RefType: v1alpha3.Branch, RefName: "master"},
+			parameters: []v1alpha3.Parameter{{Name: paramGitCommit, Value: "sha"}},
+		},
+	}, {
+		name:    "tag push",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PushHook{Ref: "refs/tags/v1.0.0", After: "sha"},
+		want: &scmEvent{
+			ref:     "v1.0.0",
+			fullRef: "refs/tags/v1.0.0",
+			scm:     &v1alpha3.SCM{RefType: v1alpha3.Tag, RefName: "v1.0.0"},
+			parameters: []v1alpha3.Parameter{
+				{Name: paramGitCommit, Value: "sha"},
+				{Name: paramTagName, Value: "v1.0.0"},
+			},
+		},
+	}, {
+		name:    "branch deleted",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PushHook{Ref: "refs/heads/master", Deleted: true},
+		want:    nil,
+	}, {
+		name:    "pull request opened",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PullRequestHook{Action: scm.ActionOpen, PullRequest: pullRequest},
+		want: &scmEvent{
+			ref:     "master",
+			fullRef: "refs/heads/master",
+			scm:     &v1alpha3.SCM{RefType: v1alpha3.PullRequest, RefName: "PR-1"},
+			parameters: []v1alpha3.Parameter{
+				{Name: paramGitCommit, Value: "head-sha"},
+				{Name: paramChangeID, Value: "1"},
+				{Name: paramChangeBranch, Value: "feature"},
+				{Name: paramChangeTarget, Value: "master"},
+				{Name: paramChangeAuthor, Value: "linuxsuren"},
+			},
+		},
+	}, {
+		name:   "merge request with new commits",
+		driver: scm.DriverGitlab,
+		webhook: &scm.PullRequestHook{Action: scm.ActionUpdate, PullRequest: pullRequest, Changes: scm.PullRequestHookChanges{
+			Base: scm.PullRequestHookBranch{Sha: scm.PullRequestHookBranchFrom{From: "previous-sha"}},
+		}},
+		want: &scmEvent{
+			ref:     "master",
+			fullRef: "refs/heads/master",
+			scm:     &v1alpha3.SCM{RefType: v1alpha3.MergeRequest, RefName: "MR-1"},
+			parameters: []v1alpha3.Parameter{
+				{Name: paramGitCommit, Value: "head-sha"},
+				{Name: paramChangeID, Value: "1"},
+				{Name: paramChangeBranch, Value: "feature"},
+				{Name: paramChangeTarget, Value: "master"},
+				{Name: paramChangeAuthor, Value: "linuxsuren"},
+			},
+		},
+	}, {
+		name:   "pull request with the full reference of the target branch",
+		driver: scm.DriverGithub,
+		webhook: &scm.PullRequestHook{Action: scm.ActionSync, PullRequest: scm.PullRequest{
+			Number: 1,
+			Sha:    "head-sha",
+			Source: "feature",
+			Target: "refs/heads/master",
+			Author: scm.User{Login: "linuxsuren"},
+		}},
+		want: &scmEvent{
+			ref:     "master",
+			fullRef: "refs/heads/master",
+			scm:     &v1alpha3.SCM{RefType: v1alpha3.PullRequest, RefName: "PR-1"},
+			parameters: []v1alpha3.Parameter{
+				{Name: paramGitCommit, Value: "head-sha"},
+				{Name: paramChangeID, Value: "1"},
+				{Name: paramChangeBranch, Value: "feature"},
+				{Name: paramChangeTarget, Value: "master"},
+				{Name: paramChangeAuthor, Value: "linuxsuren"},
+			},
+		},
+	}, {
+		name:    "merge request title edited",
+		driver:  scm.DriverGitlab,
+		webhook: &scm.PullRequestHook{Action: scm.ActionUpdate, PullRequest: pullRequest},
+		want:    nil,
+	}, {
+		name:    "pull request edited",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PullRequestHook{Action: scm.ActionEdited, PullRequest: pullRequest},
+		want:    nil,
+	}, {
+		name:    "pull request closed",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PullRequestHook{Action: scm.ActionClose, PullRequest: pullRequest},
+		want:    nil,
+	}, {
+		name:    "unsupported webhook",
+		driver:  scm.DriverGithub,
+		webhook: &scm.PingHook{},
+		want:    nil,
 	}}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			assert.Equalf(t, tt.wantOk, branchMatch(tt.args.pipeline, tt.args.branch), "branchMatch(%v, %v)", tt.args.pipeline, tt.args.branch)
+			assert.Equal(t, tt.want, newSCMEvent(tt.driver, tt.webhook))
 		})
 	}
 }
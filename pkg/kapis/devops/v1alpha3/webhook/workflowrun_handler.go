@@ -23,6 +23,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/event/common"
 	"kubesphere.io/devops/pkg/event/workflowrun"
 	"strings"
 	"time"
@@ -164,3 +165,113 @@ func (handler *Handler) createPipelineRun(identifier *pipelineRunIdentifier, par
 	}
 	return pipelineRun, nil
 }
+
+// workflowRunResultPhases maps the result of Jenkins WorkflowRun to the phase of PipelineRun.
+var workflowRunResultPhases = map[string]v1alpha3.RunPhase{
+	"SUCCESS":   v1alpha3.Succeeded,
+	"UNSTABLE":  v1alpha3.Failed,
+	"FAILURE":   v1alpha3.Failed,
+	"ABORTED":   v1alpha3.Cancelled,
+	"NOT_BUILT": v1alpha3.Unknown,
+}
+
+// handleWorkflowRunEvent creates a handler which updates the corresponding PipelineRun with the given event type.
+// The PipelineRun controller will be notified via the event annotation, and then retrieve the details from Jenkins.
+func (handler *Handler) handleWorkflowRunEvent(eventType string) workflowrun.Handler {
+	return func(workflowRunData *workflowrun.Data) error {
+		identifier := extractPipelineRunIdentifier(workflowRunData)
+		if identifier == nil {
+			// we should skip this event if the Pipeline is not a standard Pipeline in ks-devops.
+			return nil
+		}
+
+		pipelineRun, err := handler.findPipelineRun(identifier)
+		if err != nil || pipelineRun == nil {
+			// the PipelineRun controller will catch up with the missed event by polling
+			return err
+		}
+		key := client.ObjectKey{Namespace: pipelineRun.Namespace, Name: pipelineRun.Name}
+
+		// status is a subresource of PipelineRun, we have to update it separately
+		if err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			prToUpdate := &v1alpha3.PipelineRun{}
+			if err := handler.Get(context.Background(), key, prToUpdate); err != nil {
+				return err
+			}
+			prToUpdate = prToUpdate.DeepCopy()
+			if !applyWorkflowRunData(eventType, workflowRunData, &prToUpdate.Status) {
+				return nil
+			}
+			return handler.Status().Update(context.Background(), prToUpdate)
+		}); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			prToUpdate := &v1alpha3.PipelineRun{}
+			if err := handler.Get(context.Background(), key, prToUpdate); err != nil {
+				return err
+			}
+			if prToUpdate.Annotations[v1alpha3.JenkinsPipelineRunEventAnnoKey] == eventType {
+				return nil
+			}
+			prToUpdate = prToUpdate.DeepCopy()
+			if prToUpdate.Annotations == nil {
+				prToUpdate.Annotations = map[string]string{}
+			}
+			prToUpdate.Annotations[v1alpha3.JenkinsPipelineRunEventAnnoKey] = eventType
+			return handler.Update(context.Background(), prToUpdate)
+		})
+		if err == nil {
+			klog.V(4).Infof("PipelineRun %s was notified with event %s", key, eventType)
+		}
+		return client.IgnoreNotFound(err)
+	}
+}
+
+func (handler *Handler) findPipelineRun(identifier *pipelineRunIdentifier) (*v1alpha3.PipelineRun, error) {
+	pipelineRunList := &v1alpha3.PipelineRunList{}
+	if err := handler.List(context.Background(), pipelineRunList,
+		client.InNamespace(identifier.namespaceName),
+		client.MatchingFields{v1alpha3.PipelineRunIdentifierIndexerName: identifier.String()}); err != nil {
+		return nil, err
+	}
+	for i := range pipelineRunList.Items {
+		if pipelineRunList.Items[i].GetPipelineRunIdentifier() == identifier.String() {
+			return &pipelineRunList.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// applyWorkflowRunData applies the WorkflowRun data of an event to the PipelineRun status.
+// The completion time is left to the PipelineRun controller, which stores the final running data.
+func applyWorkflowRunData(eventType string, workflowRunData *workflowrun.Data, status *v1alpha3.PipelineRunStatus) (changed bool) {
+	if status.CompletionTime != nil {
+		// never touch a completed PipelineRun
+		return
+	}
+
+	phase := status.Phase
+	switch eventType {
+	case common.RunStarted:
+		phase = v1alpha3.Running
+		if status.StartTime == nil && workflowRunData.Timestamp > 0 {
+			status.StartTime = &metav1.Time{Time: time.UnixMilli(workflowRunData.Timestamp)}
+			changed = true
+		}
+	case common.RunFinalized, common.RunCompleted:
+		if resultPhase, ok := workflowRunResultPhases[workflowRunData.Result]; ok {
+			phase = resultPhase
+		}
+	}
+
+	if phase != status.Phase {
+		status.Phase = phase
+		changed = true
+	}
+	if changed {
+		status.UpdateTime = &metav1.Time{Time: time.Now()}
+	}
+	return
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"k8s.io/client-go/util/retry"
+	"kubesphere.io/devops/pkg/event/common"
 	"kubesphere.io/devops/pkg/event/workflowrun"
 	"reflect"
 	"testing"
@@ -291,3 +292,107 @@ func TestHandler_handleWorkflowRunInitialize(t *testing.T) {
 		})
 	}
 }
+
+func Test_applyWorkflowRunData(t *testing.T) {
+	now := v1.Now()
+	tests := []struct {
+		name        string
+		eventType   string
+		data        *workflowrun.Data
+		status      *v1alpha3.PipelineRunStatus
+		wantChanged bool
+		wantPhase   v1alpha3.RunPhase
+	}{{
+		name:        "run started",
+		eventType:   common.RunStarted,
+		data:        &workflowrun.Data{Timestamp: 1644126495293},
+		status:      &v1alpha3.PipelineRunStatus{},
+		wantChanged: true,
+		wantPhase:   v1alpha3.Running,
+	}, {
+		name:        "run completed successfully",
+		eventType:   common.RunCompleted,
+		data:        &workflowrun.Data{Result: "SUCCESS"},
+		status:      &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running},
+		wantChanged: true,
+		wantPhase:   v1alpha3.Succeeded,
+	}, {
+		name:        "run finalized with failure",
+		eventType:   common.RunFinalized,
+		data:        &workflowrun.Data{Result: "FAILURE"},
+		status:      &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running},
+		wantChanged: true,
+		wantPhase:   v1alpha3.Failed,
+	}, {
+		name:        "run aborted",
+		eventType:   common.RunFinalized,
+		data:        &workflowrun.Data{Result: "ABORTED"},
+		status:      &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running},
+		wantChanged: true,
+		wantPhase:   v1alpha3.Cancelled,
+	}, {
+		name:        "unknown result",
+		eventType:   common.RunCompleted,
+		data:        &workflowrun.Data{Result: "fake"},
+		status:      &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Running},
+		wantChanged: false,
+		wantPhase:   v1alpha3.Running,
+	}, {
+		name:        "PipelineRun has already completed",
+		eventType:   common.RunCompleted,
+		data:        &workflowrun.Data{Result: "FAILURE"},
+		status:      &v1alpha3.PipelineRunStatus{Phase: v1alpha3.Succeeded, CompletionTime: &now},
+		wantChanged: false,
+		wantPhase:   v1alpha3.Succeeded,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantChanged, applyWorkflowRunData(tt.eventType, tt.data, tt.status))
+			assert.Equal(t, tt.wantPhase, tt.status.Phase)
+			if tt.eventType == common.RunStarted {
+				assert.NotNil(t, tt.status.StartTime)
+			}
+		})
+	}
+}
+
+func TestHandler_handleWorkflowRunEvent(t *testing.T) {
+	pipelineRun := &v1alpha3.PipelineRun{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      "fake-pipeline-abc",
+			Namespace: "fake-namespace",
+			Labels: map[string]string{
+				v1alpha3.PipelineNameLabelKey: "fake-pipeline",
+			},
+			Annotations: map[string]string{
+				v1alpha3.JenkinsPipelineRunIDAnnoKey: "1",
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	_ = v1alpha3.AddToScheme(scheme)
+
+	t.Run("Should skip if PipelineRun not found", func(t *testing.T) {
+		handler := &Handler{Client: fake.NewFakeClientWithScheme(scheme)}
+		err := handler.handleWorkflowRunEvent(common.RunStarted)(createWorkflowRun("fake-namespace", "fake-pipeline", "1", false))
+		assert.Nil(t, err)
+	})
+
+	t.Run("Should update PipelineRun status and event annotation", func(t *testing.T) {
+		fakeClient := fake.NewFakeClientWithScheme(scheme, pipelineRun.DeepCopy())
+		handler := &Handler{Client: fakeClient}
+
+		data := createWorkflowRun("fake-namespace", "fake-pipeline", "1", false)
+		data.Result = "SUCCESS"
+		err := handler.handleWorkflowRunEvent(common.RunCompleted)(data)
+		assert.Nil(t, err)
+
+		updated := &v1alpha3.PipelineRun{}
+		err = fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pipelineRun), updated)
+		assert.Nil(t, err)
+		assert.Equal(t, v1alpha3.Succeeded, updated.Status.Phase)
+		assert.Nil(t, updated.Status.CompletionTime)
+		assert.Equal(t, common.RunCompleted, updated.Annotations[v1alpha3.JenkinsPipelineRunEventAnnoKey])
+	})
+}
@@ -17,6 +17,8 @@ package argocd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/emicklei/go-restful"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -28,7 +30,9 @@ import (
 	"kubesphere.io/devops/pkg/kapis/common"
 	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"net/http"
+	"net/url"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
 )
 
 var argoAppNotConfiguredError = restful.NewError(http.StatusBadRequest,
@@ -39,6 +43,8 @@ var invalidRequestBodyError = restful.NewError(http.StatusBadRequest,
 	"invalid application sync request")
 var unauthenticatedError = restful.NewError(http.StatusUnauthorized,
 	"unauthenticated request")
+var autoSyncEnabledError = restful.NewError(http.StatusBadRequest,
+	"rollback cannot be initiated when auto-sync is enabled")
 
 func (h *handler) createApplication(req *restful.Request, res *restful.Response) {
 	var err error
@@ -56,40 +62,6 @@ func (h *handler) createApplication(req *restful.Request, res *restful.Response)
 	common.Response(req, res, application, err)
 }
 
-func (h *handler) applicationSummary(request *restful.Request, response *restful.Response) {
-	namespace := common.GetPathParameter(request, common.NamespacePathParameter)
-
-	summary, err := h.populateApplicationSummary(namespace)
-	common.Response(request, response, summary, err)
-}
-
-func (h *handler) populateApplicationSummary(namespace string) (*ApplicationsSummary, error) {
-	applicationList := &v1alpha1.ApplicationList{}
-	if err := h.List(context.Background(), applicationList, client.InNamespace(namespace)); err != nil {
-		return nil, err
-	}
-	summary := &ApplicationsSummary{
-		HealthStatus: map[string]int{},
-		SyncStatus:   map[string]int{},
-	}
-	summary.Total = len(applicationList.Items)
-
-	for i := range applicationList.Items {
-		app := &applicationList.Items[i]
-		// accumulate health status
-		healthStatus := app.GetLabels()[v1alpha1.HealthStatusLabelKey]
-		if healthStatus != "" {
-			summary.HealthStatus[healthStatus]++
-		}
-		// accumulate sync status
-		syncStatus := app.GetLabels()[v1alpha1.SyncStatusLabelKey]
-		if syncStatus != "" {
-			summary.SyncStatus[syncStatus]++
-		}
-	}
-	return summary, nil
-}
-
 func (h *handler) handleSyncApplication(req *restful.Request, res *restful.Response) {
 	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
 	name := common.GetPathParameter(req, pathParameterApplication)
@@ -120,6 +92,9 @@ func (h *handler) syncApplication(namespace, name string, syncRequest *Applicati
 	if app.Spec.ArgoApp == nil {
 		return nil, argoAppNotConfiguredError
 	}
+	if err := h.CheckSyncWindows(ctx, app); err != nil {
+		return nil, err
+	}
 
 	argoApp := app.Spec.ArgoApp
 
@@ -157,6 +132,61 @@ func (h *handler) syncApplication(namespace, name string, syncRequest *Applicati
 	return h.updateOperation(namespace, name, operation)
 }
 
+func (h *handler) handleRollbackApplication(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	rollbackRequest := &gitops.ApplicationRollbackRequest{}
+	if err := req.ReadEntity(rollbackRequest); err != nil {
+		common.Response(req, res, nil, gitops.InvalidRollbackRequestError)
+		return
+	}
+
+	currentUser, ok := apiserverrequest.UserFrom(req.Request.Context())
+	if !ok || currentUser == nil {
+		common.Response(req, res, nil, unauthenticatedError)
+		return
+	}
+
+	app, err := h.rollbackApplication(namespace, name, rollbackRequest.ID, currentUser)
+	common.Response(req, res, app, err)
+}
+
+// rollbackApplication syncs the application to the revision and source of a history
+func (h *handler) rollbackApplication(namespace, name string, id int64, currentUser user.Info) (*v1alpha1.Application, error) {
+	app := &v1alpha1.Application{}
+	if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+		return nil, err
+	}
+	if app.Spec.ArgoApp == nil {
+		return nil, argoAppNotConfiguredError
+	}
+	// the automated sync will sync the application back to the target revision
+	if syncPolicy := app.Spec.ArgoApp.Spec.SyncPolicy; syncPolicy != nil && syncPolicy.Automated != nil {
+		return nil, autoSyncEnabledError
+	}
+	history := app.Status.FindHistory(id)
+	if history == nil {
+		return nil, gitops.HistoryNotFoundError
+	}
+	if err := h.CheckSyncWindows(context.Background(), app); err != nil {
+		return nil, err
+	}
+
+	operation := &v1alpha1.Operation{
+		Sync: &v1alpha1.SyncOperation{
+			Revision: history.Revision,
+			Source:   history.Source.DeepCopy(),
+		},
+		InitiatedBy: v1alpha1.OperationInitiator{Username: currentUser.GetName()},
+		Info: []*v1alpha1.Info{{
+			Name:  "Reason",
+			Value: fmt.Sprintf("Rollback to the history %d", id),
+		}},
+	}
+	return h.updateOperation(namespace, name, operation)
+}
+
 func (h *handler) updateOperation(namespace, name string, operation *v1alpha1.Operation) (*v1alpha1.Application, error) {
 	var app *v1alpha1.Application
 	return app, utilretry.RetryOnConflict(utilretry.DefaultRetry, func() error {
@@ -212,14 +242,179 @@ func (h *handler) getClusters(req *restful.Request, res *restful.Response) {
 	common.Response(req, res, argoClusters, err)
 }
 
+// argoCDManagers are the field managers of Argo CD, for the client-side apply and server-side apply
+var argoCDManagers = []string{"argocd-application-controller", "argocd-controller"}
+
+// argoResourceStatus is the sync status of a resource which is reported by Argo CD
+type argoResourceStatus struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+}
+
+func (h *handler) applicationDiff(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	ctx := context.Background()
+	app := &v1alpha1.Application{}
+	if err := h.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+		common.Response(req, res, nil, err)
+		return
+	}
+	if app.Spec.ArgoApp == nil {
+		common.Response(req, res, nil, argoAppNotConfiguredError)
+		return
+	}
+
+	diffs, err := h.diffApplication(ctx, app)
+	common.Response(req, res, diffs, err)
+}
+
+// diffApplication compares the resources which are reported by Argo CD with the live objects
+func (h *handler) diffApplication(ctx context.Context, app *v1alpha1.Application) (diffs []gitops.ResourceDiff, err error) {
+	status := &struct {
+		Resources []argoResourceStatus `json:"resources"`
+	}{}
+	if app.Status.ArgoApp != "" {
+		if err = json.Unmarshal([]byte(app.Status.ArgoApp), status); err != nil {
+			return
+		}
+	}
+
+	diffs = make([]gitops.ResourceDiff, 0, len(status.Resources))
+	for _, resource := range status.Resources {
+		diffs = append(diffs, gitops.ResourceDiff{
+			Group:     resource.Group,
+			Version:   resource.Version,
+			Kind:      resource.Kind,
+			Namespace: resource.Namespace,
+			Name:      resource.Name,
+			Status:    v1alpha1.SyncStatusCode(resource.Status),
+		})
+	}
+
+	argoApp := app.Spec.ArgoApp
+	if dest := argoApp.Spec.Destination; (dest.Server != "" && dest.Server != "https://kubernetes.default.svc") ||
+		(dest.Name != "" && dest.Name != "in-cluster") {
+		for i := range diffs {
+			diffs[i].Message = "the live object in the remote cluster is not available"
+		}
+		return
+	}
+
+	var targetStates map[string]map[string]interface{}
+	if targetStates, err = h.getTargetStates(ctx, app); err != nil {
+		return
+	}
+
+	err = h.DiffResources(ctx, diffs, func(resource *gitops.ResourceDiff) gitops.DiffOptions {
+		opts := gitops.DiffOptions{
+			EngineManagers: argoCDManagers,
+			TargetState:    targetStates[resourceKey(resource.Group, resource.Kind, resource.Namespace, resource.Name)],
+		}
+		for _, ignore := range argoApp.Spec.IgnoreDifferences {
+			if ignore.Group == resource.Group && ignore.Kind == resource.Kind &&
+				(ignore.Name == "" || ignore.Name == resource.Name) &&
+				(ignore.Namespace == "" || ignore.Namespace == resource.Namespace) {
+				// the jq path expressions are not supported
+				opts.IgnorePointers = append(opts.IgnorePointers, ignore.JSONPointers...)
+				opts.TrustedManagers = append(opts.TrustedManagers, ignore.ManagedFieldsManagers...)
+			}
+		}
+		return opts
+	})
+	return
+}
+
+// getTargetStates returns the manifests rendered from Git by Argo CD, the keys are generated by resourceKey.
+// Nothing is returned if the Argo CD API server is not configured.
+func (h *handler) getTargetStates(ctx context.Context, app *v1alpha1.Application) (
+	states map[string]map[string]interface{}, err error) {
+	if h.ArgoCDServer == "" {
+		return
+	}
+	argoNamespace := app.Labels[v1alpha1.ArgoCDLocationLabelKey]
+	if argoNamespace == "" {
+		argoNamespace = h.ArgoCDNamespace
+	}
+	argoName := app.Labels[v1alpha1.ArgoCDAppNameLabelKey]
+	if argoName == "" {
+		argoName = app.Name
+	}
+
+	var req *http.Request
+	api := fmt.Sprintf("%s/api/v1/applications/%s/managed-resources?appNamespace=%s",
+		strings.TrimSuffix(h.ArgoCDServer, "/"), url.PathEscape(argoName), url.QueryEscape(argoNamespace))
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, api, nil); err != nil {
+		return
+	}
+	if h.ArgoCDToken != "" {
+		req.Header.Set("Authorization", "Bearer "+h.ArgoCDToken)
+	}
+	var resp *http.Response
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("failed to get the managed resources from Argo CD, status code: %d", resp.StatusCode)
+		return
+	}
+
+	result := &struct {
+		Items []struct {
+			Group       string `json:"group"`
+			Kind        string `json:"kind"`
+			Namespace   string `json:"namespace"`
+			Name        string `json:"name"`
+			TargetState string `json:"targetState"`
+		} `json:"items"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return
+	}
+	states = map[string]map[string]interface{}{}
+	for _, item := range result.Items {
+		// the data of a Secret is masked by Argo CD, so it cannot be compared
+		if item.TargetState == "" || (item.Group == "" && item.Kind == "Secret") {
+			continue
+		}
+		var state map[string]interface{}
+		if err = json.Unmarshal([]byte(item.TargetState), &state); err != nil {
+			err = fmt.Errorf("invalid target state of %s %s: %v", item.Kind, item.Name, err)
+			return
+		}
+		// the state is null if the resource is going to be pruned
+		if state != nil {
+			states[resourceKey(item.Group, item.Kind, item.Namespace, item.Name)] = state
+		}
+	}
+	return
+}
+
+func resourceKey(group, kind, namespace, name string) string {
+	return strings.Join([]string{group, kind, namespace, name}, "/")
+}
+
 type handler struct {
 	*gitops.Handler
 	ArgoCDNamespace string
+	// ArgoCDServer is the address of the Argo CD API server, it's optional
+	ArgoCDServer string
+	ArgoCDToken  string
 }
 
 func newHandler(options *common.Options, argoOption *config.ArgoCDOption) *handler {
 	return &handler{
 		Handler:         gitops.NewHandler(options),
 		ArgoCDNamespace: argoOption.Namespace,
+		ArgoCDServer:    argoOption.Server,
+		ArgoCDToken:     argoOption.Token,
 	}
 }
@@ -17,14 +17,17 @@ package argocd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
 	"io"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/kubernetes/scheme"
+	devopsv1alpha3 "kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	"kubesphere.io/devops/pkg/apiserver/request"
 	"kubesphere.io/devops/pkg/kapis/common"
@@ -201,6 +204,7 @@ func Test_handler_handleSyncApplication(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
 			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, gitops.ToObjects(tt.fields.apps)...)
 			h := &handler{
 				Handler: &gitops.Handler{Client: fakeClient},
@@ -294,6 +298,7 @@ func Test_handler_updateOperation(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
 			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, tt.fields.app.DeepCopy())
 			h := &handler{
 				Handler: &gitops.Handler{Client: fakeClient},
@@ -303,3 +308,268 @@ func Test_handler_updateOperation(t *testing.T) {
 		})
 	}
 }
+
+func Test_handler_handleRollbackApplication(t *testing.T) {
+	createApp := func(automated bool) *v1alpha1.Application {
+		app := &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fake-app",
+				Namespace: "fake-namespace",
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				ArgoApp: &v1alpha1.ArgoApplication{},
+			},
+			Status: v1alpha1.ApplicationStatus{History: []v1alpha1.RevisionHistory{{
+				ID:       1,
+				Revision: "fake-revision",
+				Source:   &v1alpha1.ApplicationSource{RepoURL: "https://fake.com/repo.git"},
+			}}},
+		}
+		if automated {
+			app.Spec.ArgoApp.Spec.SyncPolicy = &v1alpha1.SyncPolicy{Automated: &v1alpha1.SyncPolicyAutomated{}}
+		}
+		return app
+	}
+	createRequest := func(body string, withUser bool) *restful.Request {
+		testReq := httptest.NewRequest(http.MethodPost, "/applications/app/rollback", bytes.NewBufferString(body))
+		testReq.Header.Set(restful.HEADER_ContentType, restful.MIME_JSON)
+		if withUser {
+			ctx := request.WithUser(testReq.Context(), &user.DefaultInfo{
+				Name: "fake-user",
+			})
+			testReq = testReq.WithContext(ctx)
+		}
+		req := restful.NewRequest(testReq)
+		req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-namespace"
+		req.PathParameters()[pathParameterApplication.Data().Name] = "fake-app"
+		return req
+	}
+
+	tests := []struct {
+		name             string
+		app              *v1alpha1.Application
+		req              *restful.Request
+		wantResponseCode int
+		verifyResponse   func(t *testing.T, response string)
+	}{{
+		name:             "invalid request body",
+		app:              createApp(false),
+		req:              createRequest("invalid", true),
+		wantResponseCode: http.StatusBadRequest,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, gitops.InvalidRollbackRequestError.Error())
+		},
+	}, {
+		name:             "unauthenticated request",
+		app:              createApp(false),
+		req:              createRequest(`{"id":1}`, false),
+		wantResponseCode: http.StatusUnauthorized,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, unauthenticatedError.Error())
+		},
+	}, {
+		name:             "auto-sync is enabled",
+		app:              createApp(true),
+		req:              createRequest(`{"id":1}`, true),
+		wantResponseCode: http.StatusBadRequest,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, autoSyncEnabledError.Error())
+		},
+	}, {
+		name:             "history not found",
+		app:              createApp(false),
+		req:              createRequest(`{"id":2}`, true),
+		wantResponseCode: http.StatusNotFound,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, gitops.HistoryNotFoundError.Error())
+		},
+	}, {
+		name:             "rollback to the revision and source of the history",
+		app:              createApp(false),
+		req:              createRequest(`{"id":1}`, true),
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			operation := app.Spec.ArgoApp.Operation
+			if assert.NotNil(t, operation) && assert.NotNil(t, operation.Sync) {
+				assert.Equal(t, "fake-revision", operation.Sync.Revision)
+				assert.Equal(t, "https://fake.com/repo.git", operation.Sync.Source.RepoURL)
+				assert.Equal(t, "fake-user", operation.InitiatedBy.Username)
+			}
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+			h := &handler{
+				Handler: &gitops.Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, tt.app)},
+			}
+
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.handleRollbackApplication(tt.req, resp)
+			assert.Equal(t, tt.wantResponseCode, recorder.Code)
+			tt.verifyResponse(t, recorder.Body.String())
+		})
+	}
+}
+
+func Test_handler_applicationDiff(t *testing.T) {
+	const argoStatus = `{"resources":[
+{"group":"apps","version":"v1","kind":"Deployment","namespace":"fake-ns","name":"fake-deploy","status":"Synced"},
+{"version":"v1","kind":"Service","namespace":"fake-ns","name":"fake-svc","status":"OutOfSync"}]}`
+	createApp := func(destination v1alpha1.ApplicationDestination, ignore ...v1alpha1.ResourceIgnoreDifferences) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fake-app",
+				Namespace: "fake-namespace",
+			},
+			Spec: v1alpha1.ApplicationSpec{
+				ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+					Destination:       destination,
+					IgnoreDifferences: ignore,
+				}},
+			},
+			Status: v1alpha1.ApplicationStatus{ArgoApp: argoStatus},
+		}
+	}
+	deploy := &unstructured.Unstructured{}
+	deploy.SetAPIVersion("apps/v1")
+	deploy.SetKind("Deployment")
+	deploy.SetNamespace("fake-ns")
+	deploy.SetName("fake-deploy")
+	deploy.SetAnnotations(map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": `{"spec":{"replicas":1}}`,
+	})
+	_ = unstructured.SetNestedField(deploy.Object, int64(2), "spec", "replicas")
+
+	tests := []struct {
+		name             string
+		app              *v1alpha1.Application
+		wantResponseCode int
+		verify           func(t *testing.T, diffs []gitops.ResourceDiff)
+	}{{
+		name:             "compare the live objects",
+		app:              createApp(v1alpha1.ApplicationDestination{Name: "in-cluster"}),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, diffs []gitops.ResourceDiff) {
+			if assert.Len(t, diffs, 2) {
+				assert.Equal(t, v1alpha1.SyncStatusOutOfSync, diffs[0].Status)
+				assert.Equal(t, []gitops.FieldDiff{{Path: "/spec/replicas", Desired: float64(1), Live: float64(2)}}, diffs[0].Diffs)
+				assert.Equal(t, v1alpha1.SyncStatusOutOfSync, diffs[1].Status)
+				assert.NotEmpty(t, diffs[1].Message)
+			}
+		},
+	}, {
+		name: "ignore the differences",
+		app: createApp(v1alpha1.ApplicationDestination{}, v1alpha1.ResourceIgnoreDifferences{
+			Group:        "apps",
+			Kind:         "Deployment",
+			JSONPointers: []string{"/spec/replicas"},
+		}),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, diffs []gitops.ResourceDiff) {
+			if assert.Len(t, diffs, 2) {
+				assert.Equal(t, v1alpha1.SyncStatusSynced, diffs[0].Status)
+				assert.Empty(t, diffs[0].Diffs)
+			}
+		},
+	}, {
+		name:             "remote cluster",
+		app:              createApp(v1alpha1.ApplicationDestination{Server: "https://remote"}),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, diffs []gitops.ResourceDiff) {
+			if assert.Len(t, diffs, 2) {
+				assert.Equal(t, v1alpha1.SyncStatusSynced, diffs[0].Status)
+				assert.Empty(t, diffs[0].Diffs)
+				assert.NotEmpty(t, diffs[0].Message)
+			}
+		},
+	}, {
+		name: "argo application is not configured",
+		app: &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-app",
+			Namespace: "fake-namespace",
+		}},
+		wantResponseCode: http.StatusBadRequest,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+			h := &handler{
+				Handler: &gitops.Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, tt.app, deploy.DeepCopy())},
+			}
+
+			req := restful.NewRequest(httptest.NewRequest(http.MethodGet, "/applications/app/diff", nil))
+			req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-namespace"
+			req.PathParameters()[pathParameterApplication.Data().Name] = "fake-app"
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.applicationDiff(req, resp)
+			assert.Equal(t, tt.wantResponseCode, recorder.Code)
+			if tt.verify != nil {
+				var diffs []gitops.ResourceDiff
+				assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &diffs))
+				tt.verify(t, diffs)
+			}
+		})
+	}
+}
+
+func Test_handler_diffApplication_targetState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/applications/fake-app/managed-resources" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		assert.Equal(t, "argocd", r.URL.Query().Get("appNamespace"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"items":[
+{"group":"apps","kind":"Deployment","namespace":"fake-ns","name":"fake-deploy","targetState":"{\"spec\":{\"replicas\":3}}"},
+{"kind":"Service","namespace":"fake-ns","name":"fake-svc","targetState":"null"}]}`))
+	}))
+	defer server.Close()
+
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-app",
+			Namespace: "fake-namespace",
+		},
+		Spec: v1alpha1.ApplicationSpec{ArgoApp: &v1alpha1.ArgoApplication{}},
+		Status: v1alpha1.ApplicationStatus{ArgoApp: `{"resources":[
+{"group":"apps","version":"v1","kind":"Deployment","namespace":"fake-ns","name":"fake-deploy","status":"OutOfSync"}]}`},
+	}
+	deploy := &unstructured.Unstructured{}
+	deploy.SetAPIVersion("apps/v1")
+	deploy.SetKind("Deployment")
+	deploy.SetNamespace("fake-ns")
+	deploy.SetName("fake-deploy")
+	deploy.SetAnnotations(map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": `{"spec":{"replicas":2}}`,
+	})
+	_ = unstructured.SetNestedField(deploy.Object, int64(2), "spec", "replicas")
+
+	utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+	h := &handler{
+		Handler:         &gitops.Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, app, deploy)},
+		ArgoCDNamespace: "argocd",
+		ArgoCDServer:    server.URL,
+		ArgoCDToken:     "token",
+	}
+	diffs, err := h.diffApplication(context.Background(), app)
+	assert.Nil(t, err)
+	if assert.Len(t, diffs, 1) {
+		// the change in Git is reported although it was not applied yet
+		assert.Equal(t, gitops.DiffBaselineTargetState, diffs[0].Baseline)
+		assert.Equal(t, []gitops.FieldDiff{{Path: "/spec/replicas", Desired: float64(3), Live: float64(2)}}, diffs[0].Diffs)
+	}
+
+	h.ArgoCDServer = server.URL + "/invalid"
+	_, err = h.diffApplication(context.Background(), app)
+	assert.NotNil(t, err)
+}
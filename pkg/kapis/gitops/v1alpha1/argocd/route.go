@@ -21,6 +21,7 @@ import (
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	"kubesphere.io/devops/pkg/config"
 	"kubesphere.io/devops/pkg/kapis/common"
+	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"net/http"
 )
 
@@ -40,13 +41,6 @@ type ApplicationPageResult struct {
 	TotalItems int                    `json:"totalItems"`
 }
 
-// ApplicationsSummary is the model of application summary response.
-type ApplicationsSummary struct {
-	Total        int            `json:"total"`
-	HealthStatus map[string]int `json:"healthStatus"`
-	SyncStatus   map[string]int `json:"syncStatus"`
-}
-
 // ApplicationSyncRequest is a request to apply an operation to change state.
 type ApplicationSyncRequest struct {
 	Revision      string                           `json:"revision"`
@@ -77,10 +71,10 @@ func RegisterRoutes(service *restful.WebService, options *common.Options, argoOp
 		Returns(http.StatusOK, api.StatusOK, ApplicationPageResult{}))
 
 	service.Route(service.GET("/namespaces/{namespace}/application-summary").
-		To(handler.applicationSummary).
+		To(handler.ApplicationSummary).
 		Param(common.NamespacePathParameter).
 		Doc("Fetch applications summary").
-		Returns(http.StatusOK, api.StatusOK, ApplicationsSummary{}))
+		Returns(http.StatusOK, api.StatusOK, gitops.ApplicationsSummary{}))
 
 	service.Route(service.POST("/namespaces/{namespace}/applications").
 		To(handler.createApplication).
@@ -104,6 +98,50 @@ func RegisterRoutes(service *restful.WebService, options *common.Options, argoOp
 		Doc("Sync a particular application manually").
 		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
 
+	service.Route(service.GET("/namespaces/{namespace}/applications/{application}/diff").
+		To(handler.applicationDiff).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Get the differences between the desired manifests and the live objects of a particular application").
+		Returns(http.StatusOK, api.StatusOK, []gitops.ResourceDiff{}))
+
+	service.Route(service.GET("/namespaces/{namespace}/applications/{application}/history").
+		To(handler.ApplicationHistory).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Get the deployed revisions of a particular application").
+		Returns(http.StatusOK, api.StatusOK, []v1alpha1.RevisionHistory{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/rollback").
+		To(handler.handleRollbackApplication).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Reads(gitops.ApplicationRollbackRequest{}).
+		Doc("Roll back a particular application to a deployed revision").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/promote").
+		To(handler.PromoteRollout).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Promote the rollout of a particular application to the next step").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/abort").
+		To(handler.AbortRollout).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Abort the rollout of a particular application").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/promotions/{promotion}/stages/{stage}/approve").
+		To(handler.ApprovePromotion).
+		Param(common.NamespacePathParameter).
+		Param(gitops.PromotionPathParameter).
+		Param(gitops.StagePathParameter).
+		Doc("Approve the pending revision of a particular stage of the promotion").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Promotion{}))
+
 	service.Route(service.DELETE("/namespaces/{namespace}/applications/{application}").
 		To(handler.DelApplication).
 		Param(common.NamespacePathParameter).
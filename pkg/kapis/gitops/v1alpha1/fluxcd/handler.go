@@ -17,10 +17,23 @@ package fluxcd
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
 	"github.com/emicklei/go-restful"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	utilretry "k8s.io/client-go/util/retry"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	apiserverrequest "kubesphere.io/devops/pkg/apiserver/request"
 	"kubesphere.io/devops/pkg/config"
+	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
 	"kubesphere.io/devops/pkg/kapis/common"
 	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -37,6 +50,322 @@ func (h *handler) createApplication(req *restful.Request, res *restful.Response)
 	common.Response(req, res, application, err)
 }
 
+var fluxAppNotConfiguredError = restful.NewError(http.StatusBadRequest,
+	"application is not a FluxCD application, please confirm you have already configured it")
+var unauthenticatedError = restful.NewError(http.StatusUnauthorized,
+	"unauthenticated request")
+var revisionNotPinnableError = restful.NewError(http.StatusBadRequest,
+	"the revision cannot be pinned, only the charts of HelmRepository and the Kustomizations of GitRepository are supported")
+
+func (h *handler) syncApplication(req *restful.Request, res *restful.Response) {
+	h.handleOperation(req, res, v1alpha1.FluxOperationSync)
+}
+
+func (h *handler) suspendApplication(req *restful.Request, res *restful.Response) {
+	h.handleOperation(req, res, v1alpha1.FluxOperationSuspend)
+}
+
+func (h *handler) resumeApplication(req *restful.Request, res *restful.Response) {
+	h.handleOperation(req, res, v1alpha1.FluxOperationResume)
+}
+
+func (h *handler) handleOperation(req *restful.Request, res *restful.Response, operationType v1alpha1.FluxOperationType) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	currentUser, ok := apiserverrequest.UserFrom(req.Request.Context())
+	if !ok || currentUser == nil {
+		common.Response(req, res, nil, unauthenticatedError)
+		return
+	}
+
+	app, err := h.updateOperation(namespace, name, &v1alpha1.FluxOperation{
+		Type:        operationType,
+		InitiatedBy: v1alpha1.OperationInitiator{Username: currentUser.GetName()},
+		RequestedAt: metav1.Now(),
+	})
+	common.Response(req, res, app, err)
+}
+
+// updateOperation records the operation into the Application, the FluxCD application controller
+// passes it to the HelmReleases and Kustomizations
+func (h *handler) updateOperation(namespace, name string, operation *v1alpha1.FluxOperation) (*v1alpha1.Application, error) {
+	var app *v1alpha1.Application
+	err := utilretry.RetryOnConflict(utilretry.DefaultRetry, func() error {
+		app = &v1alpha1.Application{}
+		if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+			return err
+		}
+		if app.Spec.Kind != v1alpha1.FluxCD || app.Spec.FluxApp == nil {
+			return fluxAppNotConfiguredError
+		}
+
+		fluxApp := app.Spec.FluxApp
+		switch operation.Type {
+		case v1alpha1.FluxOperationSync:
+			if err := h.CheckSyncWindows(context.Background(), app); err != nil {
+				return err
+			}
+			// sync to the latest revision which might be pinned by a rollback
+			unpinChartVersion(app)
+			if err := h.pinGitCommit(app, ""); err != nil {
+				return err
+			}
+		case v1alpha1.FluxOperationSuspend:
+			setSuspended(app, true)
+		case v1alpha1.FluxOperationResume:
+			setSuspended(app, false)
+		}
+		fluxApp.Operation = operation
+		return h.Update(context.Background(), app)
+	})
+	if err == nil && operation.Type == v1alpha1.FluxOperationSync {
+		err = h.syncPinnedSource(app, "")
+	}
+	return app, err
+}
+
+func (h *handler) rollbackApplication(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	rollbackRequest := &gitops.ApplicationRollbackRequest{}
+	if err := req.ReadEntity(rollbackRequest); err != nil {
+		common.Response(req, res, nil, gitops.InvalidRollbackRequestError)
+		return
+	}
+
+	currentUser, ok := apiserverrequest.UserFrom(req.Request.Context())
+	if !ok || currentUser == nil {
+		common.Response(req, res, nil, unauthenticatedError)
+		return
+	}
+
+	app, err := h.rollback(namespace, name, rollbackRequest.ID, currentUser)
+	common.Response(req, res, app, err)
+}
+
+// rollback pins the source of the application to the revision of a history, then records it as an operation
+func (h *handler) rollback(namespace, name string, id int64, currentUser user.Info) (*v1alpha1.Application, error) {
+	var app *v1alpha1.Application
+	var revision string
+	err := utilretry.RetryOnConflict(utilretry.DefaultRetry, func() error {
+		app = &v1alpha1.Application{}
+		if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+			return err
+		}
+		if app.Spec.Kind != v1alpha1.FluxCD || app.Spec.FluxApp == nil {
+			return fluxAppNotConfiguredError
+		}
+		history := app.Status.FindHistory(id)
+		if history == nil {
+			return gitops.HistoryNotFoundError
+		}
+		if err := h.CheckSyncWindows(context.Background(), app); err != nil {
+			return err
+		}
+		revision = history.Revision
+		if err := h.pinRevision(app, revision); err != nil {
+			return err
+		}
+
+		app.Spec.FluxApp.Operation = &v1alpha1.FluxOperation{
+			Type:        v1alpha1.FluxOperationRollback,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: currentUser.GetName()},
+			RequestedAt: metav1.Now(),
+			Revision:    history.Revision,
+		}
+		return h.Update(context.Background(), app)
+	})
+	if err == nil && app.GetAnnotations()[v1alpha1.AnnoKeyPinnedSource] != "" {
+		err = h.syncPinnedSource(app, getCommit(revision))
+	}
+	return app, err
+}
+
+// pinRevision pins the chart version of a HelmRepository, or the commit of a GitRepository.
+// The revision of a HelmRelease is the chart version, and the revision of a Kustomization is "<branch>/<commit>".
+func (h *handler) pinRevision(app *v1alpha1.Application, revision string) error {
+	fluxApp := app.Spec.FluxApp
+	if fluxApp.Spec.Source == nil || fluxApp.Spec.Config == nil {
+		return revisionNotPinnableError
+	}
+
+	config := fluxApp.Spec.Config
+	switch fluxApp.Spec.Source.SourceRef.Kind {
+	case "HelmRepository":
+		if config.HelmRelease == nil || config.HelmRelease.Chart == nil {
+			return revisionNotPinnableError
+		}
+		pinChartVersion(app, revision)
+		return nil
+	case "GitRepository":
+		// the chart version of a GitRepository cannot be pinned
+		if config.HelmRelease != nil || len(config.Kustomization) == 0 {
+			return revisionNotPinnableError
+		}
+		return h.pinGitCommit(app, getCommit(revision))
+	}
+	return revisionNotPinnableError
+}
+
+// getCommit returns the commit of a Kustomization revision "<branch>/<commit>"
+func getCommit(revision string) string {
+	return revision[strings.LastIndex(revision, "/")+1:]
+}
+
+// pinChartVersion pins the chart version of the HelmReleases, the original version is kept in an annotation
+func pinChartVersion(app *v1alpha1.Application, version string) {
+	chart := app.Spec.FluxApp.Spec.Config.HelmRelease.Chart
+	if app.Annotations == nil {
+		app.Annotations = map[string]string{}
+	}
+	// keep the version which was set by users rather than the one pinned by a previous rollback
+	if _, pinned := app.Annotations[v1alpha1.AnnoKeyOriginalChartVersion]; !pinned {
+		app.Annotations[v1alpha1.AnnoKeyOriginalChartVersion] = chart.Version
+	}
+	chart.Version = version
+}
+
+// unpinChartVersion restores the chart version which was pinned by a rollback
+func unpinChartVersion(app *v1alpha1.Application) {
+	version, pinned := app.GetAnnotations()[v1alpha1.AnnoKeyOriginalChartVersion]
+	if !pinned {
+		return
+	}
+	if config := app.Spec.FluxApp.Spec.Config; config != nil && config.HelmRelease != nil && config.HelmRelease.Chart != nil {
+		config.HelmRelease.Chart.Version = version
+	}
+	delete(app.Annotations, v1alpha1.AnnoKeyOriginalChartVersion)
+}
+
+// pinGitCommit pins the Kustomizations of the application to a commit, an empty commit unpins them.
+// The GitRepository might be shared by other applications, so it's copied into a dedicated GitRepository
+// which is only used by this application. It only records the dedicated GitRepository in the application,
+// the GitRepository is changed by syncPinnedSource once the application was updated.
+func (h *handler) pinGitCommit(app *v1alpha1.Application, commit string) error {
+	source := app.Spec.FluxApp.Spec.Source
+	if source == nil || source.SourceRef.Kind != "GitRepository" {
+		return nil
+	}
+	if commit == "" {
+		delete(app.Annotations, v1alpha1.AnnoKeyPinnedSource)
+		return nil
+	}
+
+	// the credential of the GitRepository is only available in its namespace
+	if source.SourceRef.Namespace != "" && source.SourceRef.Namespace != app.GetNamespace() {
+		return revisionNotPinnableError
+	}
+	ctx := context.Background()
+	if err := h.Get(ctx, types.NamespacedName{Namespace: app.GetNamespace(), Name: source.SourceRef.Name},
+		newFluxGitRepository()); err != nil {
+		return err
+	}
+	pinned := newFluxGitRepository()
+	if err := h.Get(ctx, types.NamespacedName{Namespace: app.GetNamespace(), Name: getPinnedSourceName(app)}, pinned); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else if pinned.GetLabels()[pinnedByLabelKey] != app.GetName() {
+		return restful.NewError(http.StatusConflict, fmt.Sprintf("the GitRepository %s already exists", pinned.GetName()))
+	}
+
+	if app.Annotations == nil {
+		app.Annotations = map[string]string{}
+	}
+	app.Annotations[v1alpha1.AnnoKeyPinnedSource] = getPinnedSourceName(app)
+	return nil
+}
+
+// syncPinnedSource creates or updates the dedicated GitRepository of the application with the commit, an empty
+// commit removes it. It's called after the application was updated, so that the GitRepository is not changed
+// if the application fails to be updated.
+func (h *handler) syncPinnedSource(app *v1alpha1.Application, commit string) error {
+	source := app.Spec.FluxApp.Spec.Source
+	if source == nil || source.SourceRef.Kind != "GitRepository" {
+		return nil
+	}
+
+	ctx := context.Background()
+	pinned := newFluxGitRepository()
+	err := h.Get(ctx, types.NamespacedName{Namespace: app.GetNamespace(), Name: getPinnedSourceName(app)}, pinned)
+	switch {
+	case apierrors.IsNotFound(err):
+		if commit == "" {
+			return nil
+		}
+	case err != nil:
+		return err
+	case pinned.GetLabels()[pinnedByLabelKey] != app.GetName():
+		if commit == "" {
+			// it's not created by this application
+			return nil
+		}
+		return restful.NewError(http.StatusConflict, fmt.Sprintf("the GitRepository %s already exists", pinned.GetName()))
+	case commit == "":
+		return client.IgnoreNotFound(h.Delete(ctx, pinned))
+	}
+
+	repo := newFluxGitRepository()
+	if err = h.Get(ctx, types.NamespacedName{Namespace: app.GetNamespace(), Name: source.SourceRef.Name}, repo); err != nil {
+		return err
+	}
+	spec, _, _ := unstructured.NestedMap(repo.Object, "spec")
+	if spec == nil {
+		spec = map[string]interface{}{}
+	}
+	if err = unstructured.SetNestedField(spec, commit, "ref", "commit"); err != nil {
+		return err
+	}
+
+	if pinned.GetResourceVersion() != "" {
+		pinned.Object["spec"] = spec
+		return h.Update(ctx, pinned)
+	}
+	pinned.SetNamespace(app.GetNamespace())
+	pinned.SetName(getPinnedSourceName(app))
+	pinned.SetLabels(map[string]string{pinnedByLabelKey: app.GetName()})
+	pinned.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: v1alpha1.GroupVersion.String(),
+		Kind:       "Application",
+		Name:       app.GetName(),
+		UID:        app.GetUID(),
+	}})
+	pinned.Object["spec"] = spec
+	return h.Create(ctx, pinned)
+}
+
+// pinnedByLabelKey is the label of the pinned FluxCD GitRepository, the value is the name of the application
+const pinnedByLabelKey = v1alpha1.GroupName + "/pinned-by"
+
+func getPinnedSourceName(app *v1alpha1.Application) string {
+	return app.GetName() + "-pinned"
+}
+
+func newFluxGitRepository() *unstructured.Unstructured {
+	repo := &unstructured.Unstructured{}
+	repo.SetGroupVersionKind(schema.GroupVersionKind{
+		Group:   "source.toolkit.fluxcd.io",
+		Version: "v1beta2",
+		Kind:    "GitRepository",
+	})
+	return repo
+}
+
+// setSuspended marks the whole Application as suspended or not, the suspend flag of each HelmRelease
+// or Kustomization is kept as it is, so that resuming the Application won't resume the ones suspended by users
+func setSuspended(app *v1alpha1.Application, suspended bool) {
+	if suspended {
+		if app.Annotations == nil {
+			app.Annotations = map[string]string{}
+		}
+		app.Annotations[v1alpha1.AnnoKeySuspended] = "true"
+	} else {
+		delete(app.Annotations, v1alpha1.AnnoKeySuspended)
+	}
+}
+
 func (h *handler) getClusters(req *restful.Request, res *restful.Response) {
 	ctx := context.Background()
 
@@ -58,6 +387,85 @@ func (h *handler) getClusters(req *restful.Request, res *restful.Response) {
 	common.Response(req, res, fluxClusters, err)
 }
 
+// fluxManagers are the field managers of FluxCD
+var fluxManagers = []string{"kustomize-controller", "helm-controller"}
+
+func (h *handler) applicationDiff(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	ctx := context.Background()
+	app := &v1alpha1.Application{}
+	if err := h.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+		common.Response(req, res, nil, err)
+		return
+	}
+	if app.Spec.FluxApp == nil {
+		common.Response(req, res, nil, fluxAppNotConfiguredError)
+		return
+	}
+
+	diffs, err := h.diffApplication(ctx, app)
+	common.Response(req, res, diffs, err)
+}
+
+// diffApplication compares the objects in the inventories of the Kustomizations with the live objects,
+// the HelmReleases do not have inventories
+func (h *handler) diffApplication(ctx context.Context, app *v1alpha1.Application) (diffs []gitops.ResourceDiff, err error) {
+	var local, remote []gitops.ResourceDiff
+	if config := app.Spec.FluxApp.Spec.Config; config != nil {
+		for _, kus := range config.Kustomization {
+			if kus == nil {
+				continue
+			}
+			// the same as the name of the Kustomization which is generated by the application controller
+			name := kus.Destination.TargetNamespace
+			if kus.Destination.KubeConfig != nil {
+				name = kus.Destination.KubeConfig.SecretRef.Name + "-" + name
+			}
+			status := app.Status.FluxApp.KustomizationStatus[name]
+			if status == nil || status.Inventory == nil {
+				continue
+			}
+
+			for _, entry := range status.Inventory.Entries {
+				diff, ok := parseInventoryEntry(entry)
+				if !ok {
+					continue
+				}
+				if kus.Destination.KubeConfig != nil {
+					diff.Message = "the live object in the remote cluster is not available"
+					remote = append(remote, diff)
+				} else {
+					local = append(local, diff)
+				}
+			}
+		}
+	}
+
+	if err = h.DiffResources(ctx, local, func(*gitops.ResourceDiff) gitops.DiffOptions {
+		return gitops.DiffOptions{EngineManagers: fluxManagers}
+	}); err == nil {
+		diffs = append(append(make([]gitops.ResourceDiff, 0, len(local)+len(remote)), local...), remote...)
+	}
+	return
+}
+
+func parseInventoryEntry(entry kusv1.ResourceRef) (diff gitops.ResourceDiff, ok bool) {
+	// the format of the ID is <namespace>_<name>_<group>_<kind>
+	items := strings.Split(entry.ID, "_")
+	if ok = len(items) == 4; ok {
+		diff = gitops.ResourceDiff{
+			Namespace: items[0],
+			Name:      items[1],
+			Group:     items[2],
+			Kind:      items[3],
+			Version:   entry.Version,
+		}
+	}
+	return
+}
+
 type handler struct {
 	*gitops.Handler
 }
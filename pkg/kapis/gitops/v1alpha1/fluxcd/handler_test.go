@@ -16,20 +16,35 @@
 package fluxcd
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/kubernetes/scheme"
+	devopsv1alpha3 "kubesphere.io/devops/pkg/api/devops/v1alpha3"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/apiserver/request"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	kusv1 "kubesphere.io/devops/pkg/external/fluxcd/kustomize/v1beta2"
+	"kubesphere.io/devops/pkg/external/fluxcd/meta"
+	"kubesphere.io/devops/pkg/kapis/common"
 	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"net/http"
 	"net/http/httptest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"testing"
+	"time"
 )
 
 func Test_handler_applicationGet(t *testing.T) {
@@ -99,6 +114,7 @@ func Test_handler_applicationGet(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
 			utilruntime.Must(v1.AddToScheme(scheme.Scheme))
 			fakeClient := fake.NewFakeClientWithScheme(scheme.Scheme, tt.args.secrets.DeepCopy())
 			h := handler{Handler: &gitops.Handler{Client: fakeClient}}
@@ -114,3 +130,523 @@ func Test_handler_applicationGet(t *testing.T) {
 		})
 	}
 }
+
+func Test_handler_handleOperation(t *testing.T) {
+	createApp := func(name string, kind v1alpha1.Engine) *v1alpha1.Application {
+		app := &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "fake-namespace",
+			},
+			Spec: v1alpha1.ApplicationSpec{Kind: kind},
+		}
+		if kind == v1alpha1.FluxCD {
+			app.Spec.FluxApp = &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+				Config: &v1alpha1.FluxApplicationConfig{
+					HelmRelease:   &v1alpha1.HelmReleaseSpec{Deploy: []*v1alpha1.Deploy{{}, {}}},
+					Kustomization: []*v1alpha1.KustomizationSpec{{}},
+				},
+			}}
+		}
+		return app
+	}
+	createRequest := func(name string, withUser bool) *restful.Request {
+		testReq := httptest.NewRequest(http.MethodPost, "/applications/app/operation", nil)
+		if withUser {
+			ctx := request.WithUser(testReq.Context(), &user.DefaultInfo{
+				Name: "fake-user",
+			})
+			testReq = testReq.WithContext(ctx)
+		}
+		req := restful.NewRequest(testReq)
+		req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-namespace"
+		req.PathParameters()[pathParameterApplication.Data().Name] = name
+		return req
+	}
+	suspended := func(app *v1alpha1.Application) (result []bool) {
+		for _, deploy := range app.Spec.FluxApp.Spec.Config.HelmRelease.Deploy {
+			result = append(result, deploy.Suspend)
+		}
+		for _, kus := range app.Spec.FluxApp.Spec.Config.Kustomization {
+			result = append(result, kus.Suspend)
+		}
+		return
+	}
+
+	freezeProject := &devopsv1alpha3.DevOpsProject{
+		ObjectMeta: metav1.ObjectMeta{Name: "fake-namespace"},
+		Spec: devopsv1alpha3.DevOpsProjectSpec{ChangeFreezes: []devopsv1alpha3.ChangeFreeze{{
+			Name:  "release",
+			Start: metav1.NewTime(time.Now().Add(-time.Hour)),
+			End:   metav1.NewTime(time.Now().Add(time.Hour)),
+		}}},
+	}
+
+	tests := []struct {
+		name             string
+		app              *v1alpha1.Application
+		project          *devopsv1alpha3.DevOpsProject
+		req              *restful.Request
+		operation        v1alpha1.FluxOperationType
+		wantResponseCode int
+		verifyResponse   func(t *testing.T, response string)
+	}{{
+		name:             "unauthenticated request",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		req:              createRequest("fake-app", false),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusUnauthorized,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, unauthenticatedError.Error())
+		},
+	}, {
+		name:             "application not found",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		req:              createRequest("another-fake-app", true),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusNotFound,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, "not found")
+		},
+	}, {
+		name:             "not a FluxCD application",
+		app:              createApp("fake-app", v1alpha1.ArgoCD),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusBadRequest,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, fluxAppNotConfiguredError.Error())
+		},
+	}, {
+		name:             "sync",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			if assert.NotNil(t, app.Spec.FluxApp.Operation) {
+				assert.Equal(t, v1alpha1.FluxOperationSync, app.Spec.FluxApp.Operation.Type)
+				assert.Equal(t, "fake-user", app.Spec.FluxApp.Operation.InitiatedBy.Username)
+				assert.False(t, app.Spec.FluxApp.Operation.RequestedAt.IsZero())
+			}
+			assert.Equal(t, []bool{false, false, false}, suspended(app))
+		},
+	}, {
+		name: "sync restores the chart version pinned by a rollback",
+		app: func() *v1alpha1.Application {
+			app := createApp("fake-app", v1alpha1.FluxCD)
+			app.Annotations = map[string]string{v1alpha1.AnnoKeyOriginalChartVersion: "*"}
+			app.Spec.FluxApp.Spec.Config.HelmRelease.Chart = &v1alpha1.HelmChartTemplateSpec{Chart: "fake-chart", Version: "0.1.0"}
+			return app
+		}(),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, "*", app.Spec.FluxApp.Spec.Config.HelmRelease.Chart.Version)
+			_, ok := app.Annotations[v1alpha1.AnnoKeyOriginalChartVersion]
+			assert.False(t, ok)
+		},
+	}, {
+		name:             "sync during a change freeze",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		project:          freezeProject.DeepCopy(),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSync,
+		wantResponseCode: http.StatusForbidden,
+		verifyResponse: func(t *testing.T, response string) {
+			assert.Contains(t, response, `the change freeze "release" is in progress`)
+		},
+	}, {
+		name:             "suspend during a change freeze",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		project:          freezeProject.DeepCopy(),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSuspend,
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.True(t, app.IsSuspended())
+			assert.Equal(t, []bool{false, false, false}, suspended(app))
+		},
+	}, {
+		name:             "suspend",
+		app:              createApp("fake-app", v1alpha1.FluxCD),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationSuspend,
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, v1alpha1.FluxOperationSuspend, app.Spec.FluxApp.Operation.Type)
+			assert.True(t, app.IsSuspended())
+			assert.Equal(t, []bool{false, false, false}, suspended(app))
+		},
+	}, {
+		name: "resume",
+		app: func() *v1alpha1.Application {
+			app := createApp("fake-app", v1alpha1.FluxCD)
+			app.Annotations = map[string]string{v1alpha1.AnnoKeySuspended: "true"}
+			// suspended by the user on purpose
+			app.Spec.FluxApp.Spec.Config.HelmRelease.Deploy[0].Suspend = true
+			return app
+		}(),
+		req:              createRequest("fake-app", true),
+		operation:        v1alpha1.FluxOperationResume,
+		wantResponseCode: http.StatusOK,
+		verifyResponse: func(t *testing.T, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, v1alpha1.FluxOperationResume, app.Spec.FluxApp.Operation.Type)
+			assert.False(t, app.IsSuspended())
+			assert.Equal(t, []bool{true, false, false}, suspended(app))
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+			objects := []runtime.Object{tt.app}
+			if tt.project != nil {
+				objects = append(objects, tt.project)
+			}
+			h := &handler{
+				Handler: &gitops.Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, objects...)},
+			}
+
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.handleOperation(tt.req, resp, tt.operation)
+			assert.Equal(t, tt.wantResponseCode, recorder.Code)
+			tt.verifyResponse(t, recorder.Body.String())
+		})
+	}
+}
+
+func Test_handler_rollbackApplication(t *testing.T) {
+	history := []v1alpha1.RevisionHistory{{ID: 1, Revision: "0.1.0"}, {ID: 2, Revision: "main/fake-commit"}}
+	createHelmApp := func() *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "fake-app", Namespace: "fake-namespace"},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.FluxCD,
+				FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+					Source: &v1alpha1.FluxApplicationSource{SourceRef: v1alpha1.FluxSourceReference{
+						Kind: "HelmRepository",
+						Name: "fake-repo",
+					}},
+					Config: &v1alpha1.FluxApplicationConfig{HelmRelease: &v1alpha1.HelmReleaseSpec{
+						Chart:  &v1alpha1.HelmChartTemplateSpec{Chart: "fake-chart", Version: "*"},
+						Deploy: []*v1alpha1.Deploy{{}},
+					}},
+				}},
+			},
+			Status: v1alpha1.ApplicationStatus{History: history},
+		}
+	}
+	createKusApp := func() *v1alpha1.Application {
+		app := createHelmApp()
+		app.Spec.FluxApp.Spec.Source.SourceRef.Kind = "GitRepository"
+		app.Spec.FluxApp.Spec.Config = &v1alpha1.FluxApplicationConfig{
+			Kustomization: []*v1alpha1.KustomizationSpec{{}},
+		}
+		return app
+	}
+	createGitRepo := func() *unstructured.Unstructured {
+		repo := &unstructured.Unstructured{}
+		repo.SetGroupVersionKind(schema.GroupVersionKind{
+			Group:   "source.toolkit.fluxcd.io",
+			Version: "v1beta2",
+			Kind:    "GitRepository",
+		})
+		repo.SetNamespace("fake-namespace")
+		repo.SetName("fake-repo")
+		_ = unstructured.SetNestedField(repo.Object, "main", "spec", "ref", "branch")
+		return repo
+	}
+	createRequest := func(body string, withUser bool) *restful.Request {
+		testReq := httptest.NewRequest(http.MethodPost, "/applications/app/rollback", bytes.NewBufferString(body))
+		testReq.Header.Set(restful.HEADER_ContentType, restful.MIME_JSON)
+		if withUser {
+			ctx := request.WithUser(testReq.Context(), &user.DefaultInfo{
+				Name: "fake-user",
+			})
+			testReq = testReq.WithContext(ctx)
+		}
+		req := restful.NewRequest(testReq)
+		req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-namespace"
+		req.PathParameters()[pathParameterApplication.Data().Name] = "fake-app"
+		return req
+	}
+
+	tests := []struct {
+		name             string
+		objects          []client.Object
+		req              *restful.Request
+		wantResponseCode int
+		verify           func(t *testing.T, c client.Client, response string)
+	}{{
+		name:             "invalid request body",
+		objects:          []client.Object{createHelmApp()},
+		req:              createRequest("invalid", true),
+		wantResponseCode: http.StatusBadRequest,
+		verify: func(t *testing.T, c client.Client, response string) {
+			assert.Contains(t, response, gitops.InvalidRollbackRequestError.Error())
+		},
+	}, {
+		name:             "unauthenticated request",
+		objects:          []client.Object{createHelmApp()},
+		req:              createRequest(`{"id":1}`, false),
+		wantResponseCode: http.StatusUnauthorized,
+		verify: func(t *testing.T, c client.Client, response string) {
+			assert.Contains(t, response, unauthenticatedError.Error())
+		},
+	}, {
+		name:             "history not found",
+		objects:          []client.Object{createHelmApp()},
+		req:              createRequest(`{"id":3}`, true),
+		wantResponseCode: http.StatusNotFound,
+		verify: func(t *testing.T, c client.Client, response string) {
+			assert.Contains(t, response, gitops.HistoryNotFoundError.Error())
+		},
+	}, {
+		name:             "pin the chart version",
+		objects:          []client.Object{createHelmApp()},
+		req:              createRequest(`{"id":1}`, true),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, c client.Client, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, "0.1.0", app.Spec.FluxApp.Spec.Config.HelmRelease.Chart.Version)
+			assert.Equal(t, "*", app.Annotations[v1alpha1.AnnoKeyOriginalChartVersion])
+			if assert.NotNil(t, app.Spec.FluxApp.Operation) {
+				assert.Equal(t, v1alpha1.FluxOperationRollback, app.Spec.FluxApp.Operation.Type)
+				assert.Equal(t, "0.1.0", app.Spec.FluxApp.Operation.Revision)
+				assert.Equal(t, "fake-user", app.Spec.FluxApp.Operation.InitiatedBy.Username)
+			}
+		},
+	}, {
+		name: "pin the chart version again",
+		objects: []client.Object{func() client.Object {
+			app := createHelmApp()
+			app.Annotations = map[string]string{v1alpha1.AnnoKeyOriginalChartVersion: ""}
+			app.Spec.FluxApp.Spec.Config.HelmRelease.Chart.Version = "0.2.0"
+			return app
+		}()},
+		req:              createRequest(`{"id":1}`, true),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, c client.Client, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, "0.1.0", app.Spec.FluxApp.Spec.Config.HelmRelease.Chart.Version)
+			// the version before the first rollback is kept
+			version, ok := app.Annotations[v1alpha1.AnnoKeyOriginalChartVersion]
+			assert.True(t, ok)
+			assert.Empty(t, version)
+		},
+	}, {
+		name:             "pin the commit of the GitRepository",
+		objects:          []client.Object{createKusApp(), createGitRepo()},
+		req:              createRequest(`{"id":2}`, true),
+		wantResponseCode: http.StatusOK,
+		verify: func(t *testing.T, c client.Client, response string) {
+			app := &v1alpha1.Application{}
+			assert.Nil(t, json.Unmarshal([]byte(response), app))
+			assert.Equal(t, "fake-app-pinned", app.Annotations[v1alpha1.AnnoKeyPinnedSource])
+
+			pinned := createGitRepo()
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-namespace", Name: "fake-app-pinned"}, pinned))
+			commit, _, _ := unstructured.NestedString(pinned.Object, "spec", "ref", "commit")
+			assert.Equal(t, "fake-commit", commit)
+			branch, _, _ := unstructured.NestedString(pinned.Object, "spec", "ref", "branch")
+			assert.Equal(t, "main", branch)
+			assert.Equal(t, "fake-app", pinned.GetLabels()[pinnedByLabelKey])
+
+			// the shared GitRepository is untouched
+			repo := createGitRepo()
+			assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "fake-namespace", Name: "fake-repo"}, repo))
+			_, found, _ := unstructured.NestedString(repo.Object, "spec", "ref", "commit")
+			assert.False(t, found)
+		},
+	}, {
+		name: "the pinned GitRepository belongs to another application",
+		objects: []client.Object{createKusApp(), createGitRepo(), func() client.Object {
+			repo := createGitRepo()
+			repo.SetName("fake-app-pinned")
+			return repo
+		}()},
+		req:              createRequest(`{"id":2}`, true),
+		wantResponseCode: http.StatusConflict,
+		verify: func(t *testing.T, c client.Client, response string) {
+			assert.Contains(t, response, "fake-app-pinned")
+		},
+	}, {
+		name: "the chart version of a GitRepository cannot be pinned",
+		objects: []client.Object{func() client.Object {
+			app := createHelmApp()
+			app.Spec.FluxApp.Spec.Source.SourceRef.Kind = "GitRepository"
+			return app
+		}(), createGitRepo()},
+		req:              createRequest(`{"id":1}`, true),
+		wantResponseCode: http.StatusBadRequest,
+		verify: func(t *testing.T, c client.Client, response string) {
+			assert.Contains(t, response, revisionNotPinnableError.Error())
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+			c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tt.objects...).Build()
+			h := &handler{Handler: &gitops.Handler{Client: c}}
+
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.rollbackApplication(tt.req, resp)
+			assert.Equal(t, tt.wantResponseCode, recorder.Code)
+			tt.verify(t, c, recorder.Body.String())
+		})
+	}
+}
+
+func Test_handler_pinGitCommit(t *testing.T) {
+	repo := newFluxGitRepository()
+	repo.SetNamespace("fake-namespace")
+	repo.SetName("fake-repo")
+	_ = unstructured.SetNestedField(repo.Object, "main", "spec", "ref", "branch")
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "fake-app", Namespace: "fake-namespace"},
+		Spec: v1alpha1.ApplicationSpec{FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+			Source: &v1alpha1.FluxApplicationSource{SourceRef: v1alpha1.FluxSourceReference{
+				Kind: "GitRepository",
+				Name: "fake-repo",
+			}},
+		}}},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(repo).Build()
+	h := &handler{Handler: &gitops.Handler{Client: c}}
+	pinnedKey := types.NamespacedName{Namespace: "fake-namespace", Name: "fake-app-pinned"}
+
+	// the pinned GitRepository is not changed until the application was updated
+	assert.Nil(t, h.pinGitCommit(app, "fake-commit"))
+	assert.Equal(t, "fake-app-pinned", app.Annotations[v1alpha1.AnnoKeyPinnedSource])
+	assert.True(t, apierrors.IsNotFound(c.Get(context.Background(), pinnedKey, newFluxGitRepository())))
+
+	// pin the commit twice
+	assert.Nil(t, h.syncPinnedSource(app, "fake-commit"))
+	assert.Nil(t, h.syncPinnedSource(app, "another-commit"))
+	pinned := newFluxGitRepository()
+	assert.Nil(t, c.Get(context.Background(), pinnedKey, pinned))
+	commit, _, _ := unstructured.NestedString(pinned.Object, "spec", "ref", "commit")
+	assert.Equal(t, "another-commit", commit)
+
+	// unpin the commit
+	assert.Nil(t, h.pinGitCommit(app, ""))
+	_, found := app.Annotations[v1alpha1.AnnoKeyPinnedSource]
+	assert.False(t, found)
+	assert.Nil(t, c.Get(context.Background(), pinnedKey, newFluxGitRepository()))
+	assert.Nil(t, h.syncPinnedSource(app, ""))
+	assert.True(t, apierrors.IsNotFound(c.Get(context.Background(), pinnedKey, newFluxGitRepository())))
+	assert.Nil(t, h.syncPinnedSource(app, ""))
+
+	// the GitRepository of another application is not removed
+	another := newFluxGitRepository()
+	another.SetNamespace("fake-namespace")
+	another.SetName("fake-app-pinned")
+	another.SetLabels(map[string]string{pinnedByLabelKey: "another-app"})
+	assert.Nil(t, c.Create(context.Background(), another))
+	assert.Nil(t, h.syncPinnedSource(app, ""))
+	assert.Nil(t, c.Get(context.Background(), pinnedKey, newFluxGitRepository()))
+	assert.NotNil(t, h.pinGitCommit(app, "fake-commit"))
+	assert.Nil(t, c.Delete(context.Background(), another))
+
+	// the GitRepository in another namespace
+	app.Spec.FluxApp.Spec.Source.SourceRef.Namespace = "another-namespace"
+	assert.Equal(t, revisionNotPinnableError, h.pinGitCommit(app, "fake-commit"))
+
+	// missing GitRepository
+	app.Spec.FluxApp.Spec.Source.SourceRef.Namespace = ""
+	app.Spec.FluxApp.Spec.Source.SourceRef.Name = "another-repo"
+	assert.NotNil(t, h.pinGitCommit(app, "fake-commit"))
+}
+
+func Test_handler_applicationDiff(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-app",
+			Namespace: "fake-namespace",
+		},
+		Spec: v1alpha1.ApplicationSpec{
+			FluxApp: &v1alpha1.FluxApplication{Spec: v1alpha1.FluxApplicationSpec{
+				Config: &v1alpha1.FluxApplicationConfig{Kustomization: []*v1alpha1.KustomizationSpec{{
+					Destination: v1alpha1.FluxApplicationDestination{TargetNamespace: "fake-ns"},
+				}, {
+					Destination: v1alpha1.FluxApplicationDestination{
+						TargetNamespace: "fake-ns",
+						KubeConfig:      &helmv2.KubeConfig{SecretRef: meta.SecretKeyReference{Name: "remote"}},
+					},
+				}}},
+			}},
+		},
+		Status: v1alpha1.ApplicationStatus{FluxApp: v1alpha1.FluxApplicationStatus{
+			KustomizationStatus: map[string]*kusv1.KustomizationStatus{
+				"fake-ns": {Inventory: &kusv1.ResourceInventory{Entries: []kusv1.ResourceRef{
+					{ID: "fake-ns_fake-deploy_apps_Deployment", Version: "v1"},
+					{ID: "fake-ns_fake-svc__Service", Version: "v1"},
+				}}},
+				"remote-fake-ns": {Inventory: &kusv1.ResourceInventory{Entries: []kusv1.ResourceRef{
+					{ID: "fake-ns_fake-deploy_apps_Deployment", Version: "v1"},
+				}}},
+			},
+		}},
+	}
+	deploy := &unstructured.Unstructured{}
+	deploy.SetAPIVersion("apps/v1")
+	deploy.SetKind("Deployment")
+	deploy.SetNamespace("fake-ns")
+	deploy.SetName("fake-deploy")
+	_ = unstructured.SetNestedField(deploy.Object, int64(2), "spec", "replicas")
+	deploy.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:   "kubectl-scale",
+		Operation: metav1.ManagedFieldsOperationUpdate,
+		FieldsV1:  &metav1.FieldsV1{Raw: []byte(`{"f:spec":{"f:replicas":{}}}`)},
+	}})
+
+	utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+	utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+	h := &handler{
+		Handler: &gitops.Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, app, deploy)},
+	}
+
+	req := restful.NewRequest(httptest.NewRequest(http.MethodGet, "/applications/app/diff", nil))
+	req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-namespace"
+	req.PathParameters()[pathParameterApplication.Data().Name] = "fake-app"
+	recorder := httptest.NewRecorder()
+	resp := restful.NewResponse(recorder)
+	resp.SetRequestAccepts(restful.MIME_JSON)
+	h.applicationDiff(req, resp)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var diffs []gitops.ResourceDiff
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &diffs))
+	if assert.Len(t, diffs, 3) {
+		assert.Equal(t, "fake-deploy", diffs[0].Name)
+		assert.Equal(t, v1alpha1.SyncStatusOutOfSync, diffs[0].Status)
+		assert.Equal(t, []gitops.FieldDiff{{Path: "/spec/replicas", Live: float64(2), Manager: "kubectl-scale"}}, diffs[0].Diffs)
+
+		assert.Equal(t, "fake-svc", diffs[1].Name)
+		assert.Equal(t, "", diffs[1].Group)
+		assert.Equal(t, v1alpha1.SyncStatusOutOfSync, diffs[1].Status)
+
+		assert.Equal(t, "fake-deploy", diffs[2].Name)
+		assert.NotEmpty(t, diffs[2].Message)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	"kubesphere.io/devops/pkg/config"
 	"kubesphere.io/devops/pkg/kapis/common"
+	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"net/http"
 )
 
@@ -58,6 +59,12 @@ func RegisterRoutes(service *restful.WebService, options *common.Options, fluxOp
 		Doc("Search applications").
 		Returns(http.StatusOK, api.StatusOK, ApplicationPageResult{}))
 
+	service.Route(service.GET("/namespaces/{namespace}/application-summary").
+		To(handler.ApplicationSummary).
+		Param(common.NamespacePathParameter).
+		Doc("Fetch applications summary").
+		Returns(http.StatusOK, api.StatusOK, gitops.ApplicationsSummary{}))
+
 	service.Route(service.GET("/namespaces/{namespace}/applications/{application}").
 		To(handler.GetApplication).
 		Param(common.NamespacePathParameter).
@@ -65,6 +72,71 @@ func RegisterRoutes(service *restful.WebService, options *common.Options, fluxOp
 		Doc("Get a particular application").
 		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
 
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/sync").
+		To(handler.syncApplication).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Request FluxCD to reconcile the application immediately").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/suspend").
+		To(handler.suspendApplication).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Suspend the reconciliation of the application").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/resume").
+		To(handler.resumeApplication).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Resume the reconciliation of the application").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.GET("/namespaces/{namespace}/applications/{application}/diff").
+		To(handler.applicationDiff).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Get the differences between the desired manifests and the live objects of a particular application").
+		Returns(http.StatusOK, api.StatusOK, []gitops.ResourceDiff{}))
+
+	service.Route(service.GET("/namespaces/{namespace}/applications/{application}/history").
+		To(handler.ApplicationHistory).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Get the deployed revisions of a particular application").
+		Returns(http.StatusOK, api.StatusOK, []v1alpha1.RevisionHistory{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/rollback").
+		To(handler.rollbackApplication).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Reads(gitops.ApplicationRollbackRequest{}).
+		Doc("Roll back a particular application to a deployed revision by pinning its source").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/promote").
+		To(handler.PromoteRollout).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Promote the rollout of a particular application to the next step").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/applications/{application}/abort").
+		To(handler.AbortRollout).
+		Param(common.NamespacePathParameter).
+		Param(pathParameterApplication).
+		Doc("Abort the rollout of a particular application").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Application{}))
+
+	service.Route(service.POST("/namespaces/{namespace}/promotions/{promotion}/stages/{stage}/approve").
+		To(handler.ApprovePromotion).
+		Param(common.NamespacePathParameter).
+		Param(gitops.PromotionPathParameter).
+		Param(gitops.StagePathParameter).
+		Doc("Approve the pending revision of a particular stage of the promotion").
+		Returns(http.StatusOK, api.StatusOK, v1alpha1.Promotion{}))
+
 	service.Route(service.DELETE("/namespaces/{namespace}/applications/{application}").
 		To(handler.DelApplication).
 		Param(common.NamespacePathParameter).
@@ -29,6 +29,7 @@ import (
 	"kubesphere.io/devops/pkg/apiserver/runtime"
 	"kubesphere.io/devops/pkg/config"
 	"kubesphere.io/devops/pkg/kapis/common"
+	"kubesphere.io/devops/pkg/kapis/gitops/v1alpha1/gitops"
 	"net/http"
 	"net/http/httptest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -112,6 +113,21 @@ func TestPublicAPIs(t *testing.T) {
 				assert.Nil(t, err)
 			},
 		},
+		{
+			name: "get the summary of the flux applications",
+			request: request{
+				method: http.MethodGet,
+				uri:    "/namespaces/ns/application-summary",
+			},
+			k8sclient:    fake.NewFakeClientWithScheme(schema, fluxApp.DeepCopy()),
+			responseCode: http.StatusOK,
+			verify: func(t *testing.T, body []byte) {
+				summary := &gitops.ApplicationsSummary{}
+				err := yaml.Unmarshal(body, summary)
+				assert.Nil(t, err)
+				assert.Equal(t, 1, summary.Total)
+			},
+		},
 		{
 			name: "get a normal flux application",
 			request: request{
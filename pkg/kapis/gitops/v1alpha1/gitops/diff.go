@@ -0,0 +1,419 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+)
+
+// secretMaskLength is the minimum length of the masks of the Secret data
+const secretMaskLength = 8
+
+// lastAppliedConfigAnnoKey is the annotation which contains the desired manifest, it's set by the client-side apply
+const lastAppliedConfigAnnoKey = "kubectl.kubernetes.io/last-applied-configuration"
+
+// DiffBaseline is what a live object is compared with
+type DiffBaseline string
+
+const (
+	// DiffBaselineTargetState is the manifest rendered from Git by the GitOps engine
+	DiffBaselineTargetState DiffBaseline = "TargetState"
+	// DiffBaselineLastApplied is the last applied manifest, the differences are the drift since the last apply
+	// rather than the changes in Git
+	DiffBaselineLastApplied DiffBaseline = "LastApplied"
+	// DiffBaselineManagedFields means the fields changed by the managers other than the GitOps engine are reported
+	DiffBaselineManagedFields DiffBaseline = "ManagedFields"
+)
+
+// ResourceDiff is the difference between the desired manifest and the live object of a resource
+type ResourceDiff struct {
+	Group     string `json:"group,omitempty"`
+	Version   string `json:"version"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Status is OutOfSync if there are differences or the live object is missing
+	Status  v1alpha1.SyncStatusCode `json:"status,omitempty"`
+	Message string                  `json:"message,omitempty"`
+	// Baseline is what the live object was compared with
+	Baseline DiffBaseline `json:"baseline,omitempty"`
+	Diffs    []FieldDiff  `json:"diffs,omitempty"`
+}
+
+// FieldDiff is a field whose live value is different from the desired one
+type FieldDiff struct {
+	// Path is the JSON pointer of the field
+	Path    string      `json:"path"`
+	Desired interface{} `json:"desired,omitempty"`
+	Live    interface{} `json:"live,omitempty"`
+	// Manager is the field manager which changed the field, it's set when the desired value is unknown
+	Manager string `json:"manager,omitempty"`
+}
+
+// DiffOptions controls how to compare a live object with its desired manifest
+type DiffOptions struct {
+	// EngineManagers are the field managers of the GitOps engine
+	EngineManagers []string
+	// IgnorePointers are the JSON pointers of the fields which should not be compared
+	IgnorePointers []string
+	// TrustedManagers are the field managers whose changes should not be taken as differences
+	TrustedManagers []string
+	// TargetState is the manifest rendered from Git, the last applied manifest is compared if it's nil
+	TargetState map[string]interface{}
+}
+
+// DiffResources compares the live objects with the desired manifests,
+// the resources are expected to be in the cluster of the API server.
+// The desired manifests are the target states if the GitOps engine provides them, otherwise the last applied ones,
+// which do not include the changes in Git that have not been applied yet. See also DiffBaseline.
+func (h *Handler) DiffResources(ctx context.Context, resources []ResourceDiff,
+	getOptions func(resource *ResourceDiff) DiffOptions) error {
+	for i := range resources {
+		resource := &resources[i]
+		live := &unstructured.Unstructured{}
+		live.SetGroupVersionKind(schema.GroupVersionKind{
+			Group:   resource.Group,
+			Version: resource.Version,
+			Kind:    resource.Kind,
+		})
+		if err := h.Get(ctx, types.NamespacedName{Namespace: resource.Namespace, Name: resource.Name}, live); err != nil {
+			switch {
+			case apierrors.IsNotFound(err):
+				resource.Status = v1alpha1.SyncStatusOutOfSync
+				resource.Message = "the live object is missing"
+			case meta.IsNoMatchError(err):
+				resource.Message = err.Error()
+			default:
+				return err
+			}
+			continue
+		}
+
+		var err error
+		if resource.Diffs, resource.Baseline, err = diffLiveObject(live, getOptions(resource)); err != nil {
+			resource.Message = err.Error()
+			continue
+		}
+		if len(resource.Diffs) > 0 {
+			resource.Status = v1alpha1.SyncStatusOutOfSync
+		} else if resource.Status == "" {
+			resource.Status = v1alpha1.SyncStatusSynced
+		}
+	}
+	return nil
+}
+
+// diffLiveObject returns the differences between the desired manifest and the live object.
+// The desired manifest is the target state, or comes from the last-applied-configuration annotation. If both are absent,
+// the fields which were changed by the managers other than the GitOps engine are taken as the differences.
+func diffLiveObject(live *unstructured.Unstructured, opts DiffOptions) (diffs []FieldDiff, baseline DiffBaseline, err error) {
+	// normalize the numbers of the live object to be the same as the desired one
+	var liveData []byte
+	var liveObj interface{}
+	if liveData, err = json.Marshal(live.Object); err != nil {
+		return
+	}
+	if err = json.Unmarshal(liveData, &liveObj); err != nil {
+		return
+	}
+	isSecret := live.GroupVersionKind().GroupKind() == schema.GroupKind{Kind: "Secret"}
+
+	trustedPaths := map[string]string{}
+	for _, entry := range live.GetManagedFields() {
+		if containsString(opts.TrustedManagers, entry.Manager) {
+			collectManagedPaths(entry, liveObj, trustedPaths)
+		}
+	}
+
+	var candidates []FieldDiff
+	desired := opts.TargetState
+	if desired != nil {
+		baseline = DiffBaselineTargetState
+	} else if desiredData := live.GetAnnotations()[lastAppliedConfigAnnoKey]; desiredData != "" {
+		if err = json.Unmarshal([]byte(desiredData), &desired); err != nil {
+			err = fmt.Errorf("invalid %s annotation: %v", lastAppliedConfigAnnoKey, err)
+			return
+		}
+		baseline = DiffBaselineLastApplied
+	}
+
+	if desired != nil {
+		if isSecret {
+			hideSecretData(desired, liveObj)
+		}
+		diffValues(desired, liveObj, "", &candidates)
+	} else {
+		baseline = DiffBaselineManagedFields
+		if isSecret {
+			hideSecretData(nil, liveObj)
+		}
+		changed := map[string]string{}
+		for _, entry := range live.GetManagedFields() {
+			if entry.Operation != metav1.ManagedFieldsOperationUpdate || entry.Subresource != "" ||
+				containsString(opts.EngineManagers, entry.Manager) || containsString(opts.TrustedManagers, entry.Manager) {
+				continue
+			}
+			collectManagedPaths(entry, liveObj, changed)
+		}
+		for path, manager := range changed {
+			if hasPathPrefix(path, "/metadata") || hasPathPrefix(path, "/status") {
+				continue
+			}
+			candidates = append(candidates, FieldDiff{
+				Path:    path,
+				Live:    getValue(liveObj, path),
+				Manager: manager,
+			})
+		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Path < candidates[j].Path
+		})
+	}
+
+	for _, diff := range candidates {
+		if !isIgnoredPath(diff.Path, opts.IgnorePointers, trustedPaths) {
+			diffs = append(diffs, diff)
+		}
+	}
+	return
+}
+
+// hideSecretData replaces the values of the Secret data with '+' characters the way Argo CD does. The same values of
+// a key are replaced with the same mask, so the differences are still visible without revealing the data.
+// The stringData of the desired manifest is merged into the data, which is how the API server stores it.
+func hideSecretData(desired map[string]interface{}, live interface{}) {
+	liveObj, _ := live.(map[string]interface{})
+	if desired != nil {
+		if stringData, ok := desired["stringData"].(map[string]interface{}); ok {
+			data, _ := desired["data"].(map[string]interface{})
+			if data == nil {
+				data = map[string]interface{}{}
+			}
+			for key, value := range stringData {
+				if str, ok := value.(string); ok {
+					data[key] = base64.StdEncoding.EncodeToString([]byte(str))
+				}
+			}
+			desired["data"] = data
+			delete(desired, "stringData")
+		}
+	}
+
+	masks := map[string]map[string]string{}
+	for _, obj := range []map[string]interface{}{desired, liveObj} {
+		data, _ := obj["data"].(map[string]interface{})
+		for key, value := range data {
+			if masks[key] == nil {
+				masks[key] = map[string]string{}
+			}
+			mask, ok := masks[key][fmt.Sprint(value)]
+			if !ok {
+				mask = strings.Repeat("+", secretMaskLength+len(masks[key]))
+				masks[key][fmt.Sprint(value)] = mask
+			}
+			data[key] = mask
+		}
+	}
+}
+
+// diffValues compares the fields which exist in the desired value only, the live object has the default values
+func diffValues(desired, live interface{}, path string, diffs *[]FieldDiff) {
+	switch desiredVal := desired.(type) {
+	case map[string]interface{}:
+		if liveVal, ok := live.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(desiredVal))
+			for key := range desiredVal {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				diffValues(desiredVal[key], liveVal[key], path+"/"+escapePointer(key), diffs)
+			}
+			return
+		}
+	case []interface{}:
+		if liveVal, ok := live.([]interface{}); ok && len(liveVal) == len(desiredVal) {
+			for i := range desiredVal {
+				diffValues(desiredVal[i], liveVal[i], path+"/"+strconv.Itoa(i), diffs)
+			}
+			return
+		}
+	default:
+		if reflect.DeepEqual(desired, live) {
+			return
+		}
+	}
+	*diffs = append(*diffs, FieldDiff{Path: path, Desired: desired, Live: live})
+}
+
+// collectManagedPaths collects the JSON pointers of the leaf fields which are managed by the entry
+func collectManagedPaths(entry metav1.ManagedFieldsEntry, live interface{}, paths map[string]string) {
+	if entry.FieldsV1 == nil {
+		return
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err == nil {
+		walkManagedFields(fields, live, "", func(path string) {
+			paths[path] = entry.Manager
+		})
+	}
+}
+
+// walkManagedFields walks the fields in the FieldsV1 format, see also
+// https://kubernetes.io/docs/reference/using-api/server-side-apply/#field-management
+func walkManagedFields(fields map[string]interface{}, live interface{}, path string, visit func(path string)) {
+	for key, child := range fields {
+		var segment string
+		var value interface{}
+		switch {
+		case strings.HasPrefix(key, "f:"):
+			name := strings.TrimPrefix(key, "f:")
+			segment = escapePointer(name)
+			if liveMap, ok := live.(map[string]interface{}); ok {
+				value = liveMap[name]
+			}
+		case strings.HasPrefix(key, "k:"), strings.HasPrefix(key, "v:"):
+			var selector interface{}
+			if err := json.Unmarshal([]byte(key[2:]), &selector); err != nil {
+				continue
+			}
+			index := findListItem(live, selector, strings.HasPrefix(key, "k:"))
+			if index < 0 {
+				continue
+			}
+			segment = strconv.Itoa(index)
+			value = live.([]interface{})[index]
+		case strings.HasPrefix(key, "i:"):
+			segment = strings.TrimPrefix(key, "i:")
+			index, err := strconv.Atoi(segment)
+			liveList, ok := live.([]interface{})
+			if err != nil || !ok || index >= len(liveList) {
+				continue
+			}
+			value = liveList[index]
+		default:
+			continue
+		}
+
+		childFields, _ := child.(map[string]interface{})
+		delete(childFields, ".")
+		if len(childFields) == 0 {
+			visit(path + "/" + segment)
+		} else {
+			walkManagedFields(childFields, value, path+"/"+segment, visit)
+		}
+	}
+}
+
+// findListItem returns the index of the item which matches the keys or the value, -1 means not found
+func findListItem(live interface{}, selector interface{}, byKeys bool) int {
+	items, _ := live.([]interface{})
+	for i, item := range items {
+		if !byKeys {
+			if reflect.DeepEqual(item, selector) {
+				return i
+			}
+			continue
+		}
+
+		itemMap, ok := item.(map[string]interface{})
+		keys, _ := selector.(map[string]interface{})
+		if !ok || len(keys) == 0 {
+			continue
+		}
+		matched := true
+		for key, val := range keys {
+			if !reflect.DeepEqual(itemMap[key], val) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
+
+func isIgnoredPath(path string, pointers []string, trustedPaths map[string]string) bool {
+	for _, pointer := range pointers {
+		if hasPathPrefix(path, pointer) {
+			return true
+		}
+	}
+	for trusted := range trustedPaths {
+		if hasPathPrefix(path, trusted) || hasPathPrefix(trusted, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func getValue(obj interface{}, path string) interface{} {
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		switch val := obj.(type) {
+		case map[string]interface{}:
+			obj = val[unescapePointer(segment)]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index >= len(val) {
+				return nil
+			}
+			obj = val[index]
+		default:
+			return nil
+		}
+	}
+	return obj
+}
+
+func escapePointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+}
+
+func containsString(items []string, item string) bool {
+	for _, val := range items {
+		if val == item {
+			return true
+		}
+	}
+	return false
+}
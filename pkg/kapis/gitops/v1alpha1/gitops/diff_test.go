@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func createLiveObject(lastApplied string, managedFields ...metav1.ManagedFieldsEntry) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"namespace": "fake-ns",
+			"name":      "fake-deploy",
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(3),
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{
+						"name":                     "nginx",
+						"image":                    "nginx:1.21",
+						"terminationMessagePolicy": "File",
+					}},
+				},
+			},
+		},
+	}}
+	if lastApplied != "" {
+		obj.SetAnnotations(map[string]string{lastAppliedConfigAnnoKey: lastApplied})
+	}
+	obj.SetManagedFields(managedFields)
+	return obj
+}
+
+func managedFieldsEntry(manager, fields string) metav1.ManagedFieldsEntry {
+	return metav1.ManagedFieldsEntry{
+		Manager:    manager,
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(fields)},
+	}
+}
+
+func Test_diffLiveObject(t *testing.T) {
+	const lastApplied = `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"fake-deploy","namespace":"fake-ns"},
+"spec":{"replicas":1,"template":{"spec":{"containers":[{"name":"nginx","image":"nginx:1.20"}]}}}}`
+	const scaledFields = `{"f:spec":{"f:replicas":{}}}`
+	const imageFields = `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"nginx\"}":{".":{},"f:image":{}}}}}}}`
+
+	tests := []struct {
+		name         string
+		live         *unstructured.Unstructured
+		opts         DiffOptions
+		want         []FieldDiff
+		wantBaseline DiffBaseline
+		wantErr      bool
+	}{{
+		name:         "compare with the last applied configuration",
+		live:         createLiveObject(lastApplied),
+		wantBaseline: DiffBaselineLastApplied,
+		want: []FieldDiff{
+			{Path: "/spec/replicas", Desired: float64(1), Live: float64(3)},
+			{Path: "/spec/template/spec/containers/0/image", Desired: "nginx:1.20", Live: "nginx:1.21"},
+		},
+	}, {
+		name: "compare with the target state rather than the last applied configuration",
+		live: createLiveObject(lastApplied),
+		opts: DiffOptions{TargetState: map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": float64(2)},
+		}},
+		wantBaseline: DiffBaselineTargetState,
+		want: []FieldDiff{
+			{Path: "/spec/replicas", Desired: float64(2), Live: float64(3)},
+		},
+	}, {
+		name:         "ignore the JSON pointers",
+		live:         createLiveObject(lastApplied),
+		opts:         DiffOptions{IgnorePointers: []string{"/spec/template"}},
+		wantBaseline: DiffBaselineLastApplied,
+		want: []FieldDiff{
+			{Path: "/spec/replicas", Desired: float64(1), Live: float64(3)},
+		},
+	}, {
+		name:         "ignore the fields of the trusted managers",
+		live:         createLiveObject(lastApplied, managedFieldsEntry("hpa", scaledFields)),
+		opts:         DiffOptions{TrustedManagers: []string{"hpa"}},
+		wantBaseline: DiffBaselineLastApplied,
+		want: []FieldDiff{
+			{Path: "/spec/template/spec/containers/0/image", Desired: "nginx:1.20", Live: "nginx:1.21"},
+		},
+	}, {
+		name: "the fields changed by other managers",
+		live: createLiveObject("",
+			managedFieldsEntry("kustomize-controller", imageFields),
+			managedFieldsEntry("kubectl-edit", imageFields),
+			managedFieldsEntry("kubectl-scale", scaledFields),
+			managedFieldsEntry("kube-controller-manager", `{"f:metadata":{"f:annotations":{"f:revision":{}}}}`)),
+		opts:         DiffOptions{EngineManagers: []string{"kustomize-controller"}},
+		wantBaseline: DiffBaselineManagedFields,
+		want: []FieldDiff{
+			{Path: "/spec/replicas", Live: float64(3), Manager: "kubectl-scale"},
+			{Path: "/spec/template/spec/containers/0/image", Live: "nginx:1.21", Manager: "kubectl-edit"},
+		},
+	}, {
+		name:    "invalid last applied configuration",
+		live:    createLiveObject("invalid"),
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, baseline, err := diffLiveObject(tt.live, tt.opts)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, diffs)
+			assert.Equal(t, tt.wantBaseline, baseline)
+		})
+	}
+}
+
+func Test_diffLiveObject_secret(t *testing.T) {
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"namespace": "fake-ns",
+			"name":      "fake-secret",
+		},
+		"data": map[string]interface{}{
+			"username": "YWRtaW4=",
+			"password": "Y2hhbmdlZA==",
+			"token":    "dG9rZW4=",
+		},
+	}}
+	live.SetAnnotations(map[string]string{lastAppliedConfigAnnoKey: `{"apiVersion":"v1","kind":"Secret",
+"metadata":{"name":"fake-secret","namespace":"fake-ns"},"data":{"password":"c2VjcmV0","token":"dG9rZW4="},
+"stringData":{"username":"admin"}}`})
+
+	diffs, _, err := diffLiveObject(live, DiffOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []FieldDiff{
+		{Path: "/data/password", Desired: "++++++++", Live: "+++++++++"},
+	}, diffs)
+
+	t.Run("without the last applied configuration", func(t *testing.T) {
+		live.SetAnnotations(nil)
+		live.SetManagedFields([]metav1.ManagedFieldsEntry{managedFieldsEntry("kubectl-edit", `{"f:data":{"f:password":{}}}`)})
+		diffs, _, err := diffLiveObject(live, DiffOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []FieldDiff{
+			{Path: "/data/password", Live: "++++++++", Manager: "kubectl-edit"},
+		}, diffs)
+	})
+}
+
+func TestHandler_DiffResources(t *testing.T) {
+	h := &Handler{Client: fake.NewClientBuilder().WithObjects(
+		createLiveObject(`{"spec":{"replicas":3}}`)).Build()}
+
+	resources := []ResourceDiff{{
+		Group:     "apps",
+		Version:   "v1",
+		Kind:      "Deployment",
+		Namespace: "fake-ns",
+		Name:      "fake-deploy",
+	}, {
+		Group:     "apps",
+		Version:   "v1",
+		Kind:      "Deployment",
+		Namespace: "fake-ns",
+		Name:      "missing",
+	}}
+	assert.Nil(t, h.DiffResources(context.Background(), resources, func(*ResourceDiff) DiffOptions {
+		return DiffOptions{}
+	}))
+	assert.Equal(t, v1alpha1.SyncStatusSynced, resources[0].Status)
+	assert.Empty(t, resources[0].Diffs)
+	assert.Equal(t, v1alpha1.SyncStatusOutOfSync, resources[1].Status)
+	assert.NotEmpty(t, resources[1].Message)
+}
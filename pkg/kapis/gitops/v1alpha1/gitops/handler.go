@@ -17,10 +17,15 @@ package gitops
 
 import (
 	"context"
+	"net/http"
+
 	"github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilretry "k8s.io/client-go/util/retry"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
 	"kubesphere.io/devops/pkg/apiserver/query"
+	apiserverrequest "kubesphere.io/devops/pkg/apiserver/request"
 	"kubesphere.io/devops/pkg/kapis/common"
 	"kubesphere.io/devops/pkg/models/resources/v1alpha3"
 	"kubesphere.io/devops/pkg/utils/k8sutil"
@@ -61,6 +66,54 @@ func (h *Handler) ApplicationList(req *restful.Request, res *restful.Response) {
 	common.Response(req, res, list, nil)
 }
 
+// ApplicationsSummary is the model of application summary response.
+type ApplicationsSummary struct {
+	Total        int            `json:"total"`
+	HealthStatus map[string]int `json:"healthStatus"`
+	SyncStatus   map[string]int `json:"syncStatus"`
+}
+
+// ApplicationSummary returns the summary of the sync and health status of Applications
+func (h *Handler) ApplicationSummary(request *restful.Request, response *restful.Response) {
+	namespace := common.GetPathParameter(request, common.NamespacePathParameter)
+
+	summary, err := h.populateApplicationSummary(namespace)
+	common.Response(request, response, summary, err)
+}
+
+func (h *Handler) populateApplicationSummary(namespace string) (*ApplicationsSummary, error) {
+	applicationList := &v1alpha1.ApplicationList{}
+	if err := h.List(context.Background(), applicationList, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	summary := &ApplicationsSummary{
+		HealthStatus: map[string]int{},
+		SyncStatus:   map[string]int{},
+	}
+	summary.Total = len(applicationList.Items)
+
+	for i := range applicationList.Items {
+		app := &applicationList.Items[i]
+		// accumulate health status, the labels are used if the status was not normalized
+		healthStatus := string(app.Status.HealthStatus)
+		if healthStatus == "" {
+			healthStatus = app.GetLabels()[v1alpha1.HealthStatusLabelKey]
+		}
+		if healthStatus != "" {
+			summary.HealthStatus[healthStatus]++
+		}
+		// accumulate sync status
+		syncStatus := string(app.Status.SyncStatus)
+		if syncStatus == "" {
+			syncStatus = app.GetLabels()[v1alpha1.SyncStatusLabelKey]
+		}
+		if syncStatus != "" {
+			summary.SyncStatus[syncStatus]++
+		}
+	}
+	return summary, nil
+}
+
 func (h *Handler) GetApplication(req *restful.Request, res *restful.Response) {
 	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
 	name := common.GetPathParameter(req, pathParameterApplication)
@@ -73,6 +126,104 @@ func (h *Handler) GetApplication(req *restful.Request, res *restful.Response) {
 	common.Response(req, res, application, err)
 }
 
+// ApplicationRollbackRequest is the request to roll back an Application to a revision of its history
+type ApplicationRollbackRequest struct {
+	// ID is the identifier of the revision history
+	ID int64 `json:"id"`
+}
+
+// InvalidRollbackRequestError indicates the body of the rollback request is invalid
+var InvalidRollbackRequestError = restful.NewError(http.StatusBadRequest,
+	"invalid application rollback request")
+
+// HistoryNotFoundError indicates the revision history to roll back to does not exist
+var HistoryNotFoundError = restful.NewError(http.StatusNotFound,
+	"revision history not found")
+
+// ApplicationHistory returns the deployed revisions of an Application, the latest one is the first
+func (h *Handler) ApplicationHistory(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	application := &v1alpha1.Application{}
+	if err := h.Get(context.Background(), types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}, application); err != nil {
+		common.Response(req, res, nil, err)
+		return
+	}
+
+	history := make([]v1alpha1.RevisionHistory, 0, len(application.Status.History))
+	for i := len(application.Status.History) - 1; i >= 0; i-- {
+		history = append(history, application.Status.History[i])
+	}
+	common.Response(req, res, history, nil)
+}
+
+// RolloutNotConfiguredError indicates the Application has no rollout strategy
+var RolloutNotConfiguredError = restful.NewError(http.StatusBadRequest,
+	"rollout strategy of the application is not configured")
+
+// RolloutOperationNotSupportedError indicates the rollout provider does not support the operation
+var RolloutOperationNotSupportedError = restful.NewError(http.StatusBadRequest,
+	"the operation is not supported by the rollout provider")
+
+var unauthenticatedError = restful.NewError(http.StatusUnauthorized,
+	"unauthenticated request")
+
+// PromoteRollout promotes the rollout of an Application to the next step, or finishes it
+func (h *Handler) PromoteRollout(req *restful.Request, res *restful.Response) {
+	h.handleRolloutOperation(req, res, v1alpha1.RolloutOperationPromote)
+}
+
+// AbortRollout aborts the rollout of an Application, the traffic goes back to the stable version
+func (h *Handler) AbortRollout(req *restful.Request, res *restful.Response) {
+	h.handleRolloutOperation(req, res, v1alpha1.RolloutOperationAbort)
+}
+
+func (h *Handler) handleRolloutOperation(req *restful.Request, res *restful.Response,
+	operationType v1alpha1.RolloutOperationType) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, pathParameterApplication)
+
+	currentUser, ok := apiserverrequest.UserFrom(req.Request.Context())
+	if !ok || currentUser == nil {
+		common.Response(req, res, nil, unauthenticatedError)
+		return
+	}
+
+	app, err := h.updateRolloutOperation(namespace, name, &v1alpha1.RolloutOperation{
+		Type:        operationType,
+		InitiatedBy: v1alpha1.OperationInitiator{Username: currentUser.GetName()},
+		RequestedAt: metav1.Now(),
+	})
+	common.Response(req, res, app, err)
+}
+
+// updateRolloutOperation records the operation into the rollout strategy, the rollout controller handles it
+func (h *Handler) updateRolloutOperation(namespace, name string, operation *v1alpha1.RolloutOperation) (
+	*v1alpha1.Application, error) {
+	var app *v1alpha1.Application
+	return app, utilretry.RetryOnConflict(utilretry.DefaultRetry, func() error {
+		app = &v1alpha1.Application{}
+		if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, app); err != nil {
+			return err
+		}
+		if app.Spec.Rollout == nil {
+			return RolloutNotConfiguredError
+		}
+		// Flagger rolls back the canary only when the analysis failed
+		if app.Spec.Rollout.Provider == v1alpha1.RolloutProviderFlagger &&
+			operation.Type == v1alpha1.RolloutOperationAbort {
+			return RolloutOperationNotSupportedError
+		}
+
+		app.Spec.Rollout.Operation = operation
+		return h.Update(context.Background(), app)
+	})
+}
+
 func (h *Handler) DelApplication(req *restful.Request, res *restful.Response) {
 	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
 	name := common.GetPathParameter(req, pathParameterApplication)
@@ -17,14 +17,18 @@ package gitops
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"github.com/emicklei/go-restful"
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
 	"k8s.io/client-go/kubernetes/scheme"
 	"kubesphere.io/devops/pkg/api"
 	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/apiserver/request"
 	"kubesphere.io/devops/pkg/kapis/common"
 	"net/http"
 	"net/http/httptest"
@@ -379,6 +383,168 @@ func Test_handler_applicationGet(t *testing.T) {
 	}
 }
 
+func TestHandler_ApplicationHistory(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "fake-app",
+			Namespace: "fake-ns",
+		},
+		Status: v1alpha1.ApplicationStatus{History: []v1alpha1.RevisionHistory{
+			{ID: 0, Revision: "a"},
+			{ID: 1, Revision: "b"},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		app          string
+		wantCode     int
+		wantRevision []string
+	}{{
+		name:         "the latest revision is the first",
+		app:          "fake-app",
+		wantCode:     http.StatusOK,
+		wantRevision: []string{"b", "a"},
+	}, {
+		name:     "application not found",
+		app:      "another-app",
+		wantCode: http.StatusNotFound,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			h := &Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, app.DeepCopy())}
+
+			req := restful.NewRequest(httptest.NewRequest(http.MethodGet, "/history", nil))
+			req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-ns"
+			req.PathParameters()[pathParameterApplication.Data().Name] = tt.app
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.ApplicationHistory(req, resp)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var history []v1alpha1.RevisionHistory
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &history))
+			var revisions []string
+			for _, item := range history {
+				revisions = append(revisions, item.Revision)
+			}
+			assert.Equal(t, tt.wantRevision, revisions)
+		})
+	}
+}
+
+func TestHandler_RolloutOperation(t *testing.T) {
+	createApp := func(name string, rollout *v1alpha1.RolloutStrategy) *v1alpha1.Application {
+		return &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "fake-ns",
+			},
+			Spec: v1alpha1.ApplicationSpec{Rollout: rollout},
+		}
+	}
+	createRequest := func(name string, withUser bool) *restful.Request {
+		testReq := httptest.NewRequest(http.MethodPost, "/applications/app/promote", nil)
+		if withUser {
+			testReq = testReq.WithContext(request.WithUser(testReq.Context(), &user.DefaultInfo{
+				Name: "fake-user",
+			}))
+		}
+		req := restful.NewRequest(testReq)
+		req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-ns"
+		req.PathParameters()[pathParameterApplication.Data().Name] = name
+		return req
+	}
+	argoRollouts := &v1alpha1.RolloutStrategy{Provider: v1alpha1.RolloutProviderArgoRollouts}
+	flagger := &v1alpha1.RolloutStrategy{Provider: v1alpha1.RolloutProviderFlagger}
+
+	tests := []struct {
+		name          string
+		app           *v1alpha1.Application
+		req           *restful.Request
+		operation     v1alpha1.RolloutOperationType
+		wantCode      int
+		wantOperation bool
+	}{{
+		name:          "promote the Argo Rollouts",
+		app:           createApp("fake-app", argoRollouts),
+		req:           createRequest("fake-app", true),
+		operation:     v1alpha1.RolloutOperationPromote,
+		wantCode:      http.StatusOK,
+		wantOperation: true,
+	}, {
+		name:          "abort the Argo Rollouts",
+		app:           createApp("fake-app", argoRollouts),
+		req:           createRequest("fake-app", true),
+		operation:     v1alpha1.RolloutOperationAbort,
+		wantCode:      http.StatusOK,
+		wantOperation: true,
+	}, {
+		name:          "promote the Flagger canary",
+		app:           createApp("fake-app", flagger),
+		req:           createRequest("fake-app", true),
+		operation:     v1alpha1.RolloutOperationPromote,
+		wantCode:      http.StatusOK,
+		wantOperation: true,
+	}, {
+		name:      "abort is not supported by Flagger",
+		app:       createApp("fake-app", flagger),
+		req:       createRequest("fake-app", true),
+		operation: v1alpha1.RolloutOperationAbort,
+		wantCode:  http.StatusBadRequest,
+	}, {
+		name:      "rollout is not configured",
+		app:       createApp("fake-app", nil),
+		req:       createRequest("fake-app", true),
+		operation: v1alpha1.RolloutOperationPromote,
+		wantCode:  http.StatusBadRequest,
+	}, {
+		name:      "application not found",
+		app:       createApp("fake-app", argoRollouts),
+		req:       createRequest("another-app", true),
+		operation: v1alpha1.RolloutOperationPromote,
+		wantCode:  http.StatusNotFound,
+	}, {
+		name:      "unauthenticated request",
+		app:       createApp("fake-app", argoRollouts),
+		req:       createRequest("fake-app", false),
+		operation: v1alpha1.RolloutOperationPromote,
+		wantCode:  http.StatusUnauthorized,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			h := &Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, tt.app.DeepCopy())}
+
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			if tt.operation == v1alpha1.RolloutOperationAbort {
+				h.AbortRollout(tt.req, resp)
+			} else {
+				h.PromoteRollout(tt.req, resp)
+			}
+			assert.Equal(t, tt.wantCode, recorder.Code)
+
+			app := &v1alpha1.Application{}
+			assert.Nil(t, h.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-app"}, app))
+			if !tt.wantOperation {
+				assert.True(t, app.Spec.Rollout == nil || app.Spec.Rollout.Operation == nil)
+				return
+			}
+			if assert.NotNil(t, app.Spec.Rollout.Operation) {
+				assert.Equal(t, tt.operation, app.Spec.Rollout.Operation.Type)
+				assert.Equal(t, "fake-user", app.Spec.Rollout.Operation.InitiatedBy.Username)
+			}
+		})
+	}
+}
+
 func Test_handler_applicationDel(t *testing.T) {
 	createRequest := func(uri, name, namespace string) *restful.Request {
 		fakeRequest := httptest.NewRequest(http.MethodDelete, uri, nil)
@@ -557,3 +723,32 @@ func Test_handler_applicationUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_populateApplicationSummary(t *testing.T) {
+	schema, err := v1alpha1.SchemeBuilder.Register().Build()
+	assert.Nil(t, err)
+
+	argoApp := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "argo", Labels: map[string]string{
+			v1alpha1.SyncStatusLabelKey:   "Synced",
+			v1alpha1.HealthStatusLabelKey: "Healthy",
+		}},
+	}
+	fluxApp := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "flux"},
+		Status: v1alpha1.ApplicationStatus{
+			SyncStatus:   v1alpha1.SyncStatusOutOfSync,
+			HealthStatus: v1alpha1.HealthStatusDegraded,
+		},
+	}
+	otherApp := &v1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "app"}}
+
+	handler := &Handler{Client: fake.NewClientBuilder().WithScheme(schema).WithObjects(argoApp, fluxApp, otherApp).Build()}
+	summary, err := handler.populateApplicationSummary("ns")
+	assert.Nil(t, err)
+	assert.Equal(t, &ApplicationsSummary{
+		Total:        2,
+		HealthStatus: map[string]int{"Healthy": 1, "Degraded": 1},
+		SyncStatus:   map[string]int{"Synced": 1, "OutOfSync": 1},
+	}, summary)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilretry "k8s.io/client-go/util/retry"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	apiserverrequest "kubesphere.io/devops/pkg/apiserver/request"
+	"kubesphere.io/devops/pkg/kapis/common"
+)
+
+var (
+	// PromotionPathParameter is a path parameter definition for promotion.
+	PromotionPathParameter = restful.PathParameter("promotion", "The promotion name")
+	// StagePathParameter is a path parameter definition for the stage of a promotion.
+	StagePathParameter = restful.PathParameter("stage", "The stage name of the promotion")
+)
+
+// StageNotWaitingForApprovalError indicates there is no pending revision of the stage to approve
+var StageNotWaitingForApprovalError = restful.NewError(http.StatusBadRequest,
+	"the stage is not waiting for approval")
+
+// ApprovePromotion approves the pending revision of a stage, the promotion controller promotes it
+func (h *Handler) ApprovePromotion(req *restful.Request, res *restful.Response) {
+	namespace := common.GetPathParameter(req, common.NamespacePathParameter)
+	name := common.GetPathParameter(req, PromotionPathParameter)
+	stage := common.GetPathParameter(req, StagePathParameter)
+
+	currentUser, ok := apiserverrequest.UserFrom(req.Request.Context())
+	if !ok || currentUser == nil {
+		common.Response(req, res, nil, unauthenticatedError)
+		return
+	}
+
+	var promotion *v1alpha1.Promotion
+	err := utilretry.RetryOnConflict(utilretry.DefaultRetry, func() error {
+		promotion = &v1alpha1.Promotion{}
+		if err := h.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: name}, promotion); err != nil {
+			return err
+		}
+
+		var stageStatus *v1alpha1.PromotionStageStatus
+		for i := range promotion.Status.Stages {
+			if promotion.Status.Stages[i].Name == stage {
+				stageStatus = &promotion.Status.Stages[i]
+			}
+		}
+		if stageStatus == nil || stageStatus.Phase != v1alpha1.PromotionPhaseWaitingForApproval {
+			return StageNotWaitingForApprovalError
+		}
+
+		promotion.Spec.Operation = &v1alpha1.PromotionOperation{
+			Type:        v1alpha1.PromotionOperationApprove,
+			Stage:       stage,
+			Value:       stageStatus.Pending,
+			InitiatedBy: v1alpha1.OperationInitiator{Username: currentUser.GetName()},
+			RequestedAt: metav1.Now(),
+		}
+		return h.Update(context.Background(), promotion)
+	})
+	common.Response(req, res, promotion, err)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/client-go/kubernetes/scheme"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/apiserver/request"
+	"kubesphere.io/devops/pkg/kapis/common"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHandler_ApprovePromotion(t *testing.T) {
+	promotion := &v1alpha1.Promotion{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-promotion"},
+		Status: v1alpha1.PromotionStatus{Stages: []v1alpha1.PromotionStageStatus{{
+			Name:  "dev",
+			Value: "abc",
+		}, {
+			Name:    "staging",
+			Phase:   v1alpha1.PromotionPhaseWaitingForApproval,
+			Value:   "old",
+			Pending: "abc",
+		}, {
+			Name:    "prod",
+			Phase:   v1alpha1.PromotionPhaseWaiting,
+			Pending: "old",
+		}}},
+	}
+	createRequest := func(name, stage string, withUser bool) *restful.Request {
+		testReq := httptest.NewRequest(http.MethodPost, "/promotions/fake-promotion/stages/staging/approve", nil)
+		if withUser {
+			testReq = testReq.WithContext(request.WithUser(testReq.Context(), &user.DefaultInfo{
+				Name: "fake-user",
+			}))
+		}
+		req := restful.NewRequest(testReq)
+		req.PathParameters()[common.NamespacePathParameter.Data().Name] = "fake-ns"
+		req.PathParameters()[PromotionPathParameter.Data().Name] = name
+		req.PathParameters()[StagePathParameter.Data().Name] = stage
+		return req
+	}
+
+	tests := []struct {
+		name          string
+		req           *restful.Request
+		wantCode      int
+		wantOperation bool
+	}{{
+		name:          "approve the pending revision",
+		req:           createRequest("fake-promotion", "staging", true),
+		wantCode:      http.StatusOK,
+		wantOperation: true,
+	}, {
+		name:     "the stage is not waiting for approval",
+		req:      createRequest("fake-promotion", "prod", true),
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "the stage is not found",
+		req:      createRequest("fake-promotion", "test", true),
+		wantCode: http.StatusBadRequest,
+	}, {
+		name:     "promotion not found",
+		req:      createRequest("another-promotion", "staging", true),
+		wantCode: http.StatusNotFound,
+	}, {
+		name:     "unauthenticated request",
+		req:      createRequest("fake-promotion", "staging", false),
+		wantCode: http.StatusUnauthorized,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			h := &Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, promotion.DeepCopy())}
+
+			recorder := httptest.NewRecorder()
+			resp := restful.NewResponse(recorder)
+			resp.SetRequestAccepts(restful.MIME_JSON)
+			h.ApprovePromotion(tt.req, resp)
+			assert.Equal(t, tt.wantCode, recorder.Code)
+
+			latest := &v1alpha1.Promotion{}
+			assert.Nil(t, h.Get(context.Background(), types.NamespacedName{Namespace: "fake-ns", Name: "fake-promotion"}, latest))
+			if !tt.wantOperation {
+				assert.Nil(t, latest.Spec.Operation)
+				return
+			}
+			if assert.NotNil(t, latest.Spec.Operation) {
+				assert.Equal(t, v1alpha1.PromotionOperationApprove, latest.Spec.Operation.Type)
+				assert.Equal(t, "staging", latest.Spec.Operation.Stage)
+				assert.Equal(t, "abc", latest.Spec.Operation.Value)
+				assert.Equal(t, "fake-user", latest.Spec.Operation.InitiatedBy.Username)
+			}
+		})
+	}
+}
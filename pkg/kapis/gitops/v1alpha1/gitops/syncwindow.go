@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/apimachinery/pkg/types"
+	devopsv1alpha3 "kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/syncwindow"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CheckSyncWindows returns an error if a manual sync of the application is blocked by the sync windows
+// or the change freezes of its DevOpsProject, the name of a DevOpsProject is the same as its namespace
+func (h *Handler) CheckSyncWindows(ctx context.Context, app *v1alpha1.Application) error {
+	project := &devopsv1alpha3.DevOpsProject{}
+	if err := h.Get(ctx, types.NamespacedName{Name: app.GetNamespace()}, project); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	result, err := syncwindow.Evaluate(&project.Spec, syncwindow.TargetOf(app), time.Now(), true)
+	if err != nil {
+		return restful.NewError(http.StatusInternalServerError,
+			fmt.Sprintf("failed to evaluate the sync windows of DevOpsProject %s: %v", project.GetName(), err))
+	}
+	if !result.Allowed {
+		return restful.NewError(http.StatusForbidden,
+			fmt.Sprintf("the sync of application %s is blocked, %s", app.GetName(), result.Message))
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitops
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	devopsv1alpha3 "kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHandler_CheckSyncWindows(t *testing.T) {
+	app := &v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "fake-ns", Name: "fake-app"},
+		Spec: v1alpha1.ApplicationSpec{
+			Kind: v1alpha1.ArgoCD,
+			ArgoApp: &v1alpha1.ArgoApplication{Spec: v1alpha1.ArgoApplicationSpec{
+				Destination: v1alpha1.ApplicationDestination{Server: "https://kubernetes.default.svc", Namespace: "prod"},
+			}},
+		},
+	}
+	createProject := func(windows ...*devopsv1alpha3.SyncWindow) *devopsv1alpha3.DevOpsProject {
+		return &devopsv1alpha3.DevOpsProject{
+			ObjectMeta: metav1.ObjectMeta{Name: "fake-ns"},
+			Spec:       devopsv1alpha3.DevOpsProjectSpec{SyncWindows: windows},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		project  *devopsv1alpha3.DevOpsProject
+		wantCode int
+	}{{
+		name: "no DevOpsProject",
+	}, {
+		name:    "no sync windows",
+		project: createProject(),
+	}, {
+		name: "active deny window",
+		project: createProject(&devopsv1alpha3.SyncWindow{
+			Kind: "deny", Schedule: "* * * * *", Duration: "1h", Namespaces: []string{"prod"},
+		}),
+		wantCode: http.StatusForbidden,
+	}, {
+		name: "active deny window which enables the manual sync",
+		project: createProject(&devopsv1alpha3.SyncWindow{
+			Kind: "deny", Schedule: "* * * * *", Duration: "1h", Clusters: []string{"*"}, ManualSync: true,
+		}),
+	}, {
+		name: "invalid sync window",
+		project: createProject(&devopsv1alpha3.SyncWindow{
+			Kind: "deny", Schedule: "every minute", Duration: "1h", Applications: []string{"*"},
+		}),
+		wantCode: http.StatusInternalServerError,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			utilruntime.Must(v1alpha1.AddToScheme(scheme.Scheme))
+			utilruntime.Must(devopsv1alpha3.AddToScheme(scheme.Scheme))
+			objects := []runtime.Object{app.DeepCopy()}
+			if tt.project != nil {
+				objects = append(objects, tt.project)
+			}
+			h := &Handler{Client: fake.NewFakeClientWithScheme(scheme.Scheme, objects...)}
+
+			err := h.CheckSyncWindows(context.Background(), app)
+			if tt.wantCode == 0 {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, tt.wantCode, err.(restful.ServiceError).Code)
+			}
+		})
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/emicklei/go-restful"
 	"kubesphere.io/devops/pkg/constants"
 
 	v1 "k8s.io/api/core/v1"
@@ -388,6 +389,9 @@ func (d devopsOperator) ListPipelineObj(projectName string, queryParam *query.Qu
 
 // CreateCredentialObj creates a secret
 func (d devopsOperator) CreateCredentialObj(projectName string, secret *v1.Secret) (*v1.Secret, error) {
+	if err := devopsv1alpha3.ValidateCredential(secret); err != nil {
+		return nil, restful.NewError(http.StatusBadRequest, err.Error())
+	}
 	projectObj, err := d.ksclient.DevopsV1alpha3().DevOpsProjects().Get(d.context, projectName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
@@ -426,6 +430,9 @@ func (d devopsOperator) DeleteCredentialObj(projectName string, secret string) e
 }
 
 func (d devopsOperator) UpdateCredentialObj(projectName string, secret *v1.Secret) (*v1.Secret, error) {
+	if err := devopsv1alpha3.ValidateCredential(secret); err != nil {
+		return nil, restful.NewError(http.StatusBadRequest, err.Error())
+	}
 	projectObj, err := d.ksclient.DevopsV1alpha3().DevOpsProjects().Get(d.context, projectName, metav1.GetOptions{})
 	if err != nil {
 		return nil, err
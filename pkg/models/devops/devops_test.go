@@ -673,3 +673,93 @@ func Test_devopsOperator_CheckDevopsName(t *testing.T) {
 		})
 	}
 }
+
+func Test_devopsOperator_CreateCredentialObj(t *testing.T) {
+	project := &v1alpha3.DevOpsProject{}
+	project.SetName("ns")
+	project.Status.AdminNamespace = "ns"
+
+	secret := &v12.Secret{
+		Type: v1alpha3.SecretTypeAWSAccessKey,
+		Data: map[string][]byte{
+			v1alpha3.AWSAccessKeyIDKey:  []byte("id"),
+			v1alpha3.AWSSecretAccessKey: []byte("secret"),
+		},
+	}
+	secret.SetName("aws")
+	secret.SetNamespace("ns")
+
+	invalidSecret := secret.DeepCopy()
+	delete(invalidSecret.Data, v1alpha3.AWSSecretAccessKey)
+
+	tests := []struct {
+		name   string
+		secret *v12.Secret
+		verify func(t *testing.T, created *v12.Secret, err error)
+	}{{
+		name:   "invalid credential",
+		secret: invalidSecret.DeepCopy(),
+		verify: func(t *testing.T, created *v12.Secret, err error) {
+			assert.NotNil(t, err)
+			assert.Nil(t, created)
+		},
+	}, {
+		name:   "normal case",
+		secret: secret.DeepCopy(),
+		verify: func(t *testing.T, created *v12.Secret, err error) {
+			assert.Nil(t, err)
+			if assert.NotNil(t, created) {
+				assert.Equal(t, "id", string(created.Data[v1alpha3.AWSAccessKeyIDKey]))
+				assert.Empty(t, created.Data[v1alpha3.AWSSecretAccessKey])
+				assert.Equal(t, StatusPending, created.Annotations[v1alpha3.CredentialSyncStatusAnnoKey])
+			}
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := devopsOperator{
+				k8sclient: k8sfake.NewSimpleClientset(),
+				ksclient:  fakeclientset.NewSimpleClientset(project.DeepCopy()),
+				context:   context.TODO(),
+			}
+			created, err := d.CreateCredentialObj("ns", tt.secret)
+			tt.verify(t, created, err)
+		})
+	}
+}
+
+func Test_devopsOperator_UpdateCredentialObj(t *testing.T) {
+	project := &v1alpha3.DevOpsProject{}
+	project.SetName("ns")
+	project.Status.AdminNamespace = "ns"
+
+	secret := &v12.Secret{
+		Type: v1alpha3.SecretTypeFile,
+		Data: map[string][]byte{
+			v1alpha3.FileContentKey: []byte("content"),
+		},
+	}
+	secret.SetName("file")
+	secret.SetNamespace("ns")
+
+	d := devopsOperator{
+		k8sclient: k8sfake.NewSimpleClientset(secret.DeepCopy()),
+		ksclient:  fakeclientset.NewSimpleClientset(project.DeepCopy()),
+		context:   context.TODO(),
+	}
+
+	// update with an invalid file name
+	invalidSecret := secret.DeepCopy()
+	invalidSecret.Data[v1alpha3.FileNameKey] = []byte("../file")
+	_, err := d.UpdateCredentialObj("ns", invalidSecret)
+	assert.NotNil(t, err)
+
+	updatedSecret := secret.DeepCopy()
+	updatedSecret.Data[v1alpha3.FileNameKey] = []byte("settings.xml")
+	updated, err := d.UpdateCredentialObj("ns", updatedSecret)
+	assert.Nil(t, err)
+	if assert.NotNil(t, updated) {
+		assert.Equal(t, "settings.xml", string(updated.Data[v1alpha3.FileNameKey]))
+		assert.Empty(t, updated.Data[v1alpha3.FileContentKey])
+	}
+}
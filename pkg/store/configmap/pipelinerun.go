@@ -18,40 +18,117 @@ package configmap
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubesphere.io/devops/pkg/api/devops"
 	"kubesphere.io/devops/pkg/store/store"
 	"kubesphere.io/devops/pkg/utils/k8sutil"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// ConfigMapStore represents a key-value store base on ConfigMap
+const (
+	// DefaultChunkSize is the max size of the data in one ConfigMap.
+	// It leaves some space for the metadata, because the size of a ConfigMap is limited to 1MiB.
+	DefaultChunkSize = 900 * 1024
+
+	// ChunksAnnoKey is the annotation key of the number of ConfigMaps which hold the data
+	ChunksAnnoKey = devops.GroupName + "/data-chunks"
+	// ChunkOfLabelKey is the label key of the first ConfigMap name which a chunk belongs to
+	ChunkOfLabelKey = devops.GroupName + "/data-chunk-of"
+
+	// partKeySeparator separates the key and the index of a part of a large value
+	partKeySeparator = ".part-"
+	// chunkNameSeparator separates the name and the index of a chunk
+	chunkNameSeparator = ".chunk-"
+)
+
+// ConfigMapStore represents a key-value store base on ConfigMap.
+// The data is split into multiple ConfigMaps named as <name>, <name>.chunk-1, <name>.chunk-2 and so on,
+// if it is larger than the chunk size.
 type ConfigMapStore struct {
 	ctx       context.Context
 	k8sClient client.Client
+	key       client.ObjectKey
+	chunkSize int
 
-	cache *v1.ConfigMap
-	owner metav1.OwnerReference
+	data       map[string]string
+	configMaps []*v1.ConfigMap
+	owner      metav1.OwnerReference
 }
 
 // NewConfigMapStore creates a PipelineRun data store
 func NewConfigMapStore(ctx context.Context, key client.ObjectKey, k8sClient client.Client) (
 	result store.ConfigMapStore, err error) {
-	cm := &v1.ConfigMap{Data: map[string]string{}}
-	cm.Namespace = key.Namespace
-	cm.Name = key.Name
-	if err = k8sClient.Get(ctx, key, cm); err != nil {
-		err = client.IgnoreNotFound(err)
+	cmStore := &ConfigMapStore{
+		ctx:       ctx,
+		k8sClient: k8sClient,
+		key:       key,
+		chunkSize: DefaultChunkSize,
+		data:      map[string]string{},
+	}
+	if err = cmStore.load(); err == nil {
+		result = cmStore
 	}
+	return
+}
 
-	result = &ConfigMapStore{
-		cache:     cm,
-		k8sClient: k8sClient,
-		ctx:       ctx,
+// load reads all the chunks of the data
+func (s *ConfigMapStore) load() (err error) {
+	cm := &v1.ConfigMap{}
+	if err = s.k8sClient.Get(s.ctx, s.key, cm); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	s.configMaps = []*v1.ConfigMap{cm}
+
+	chunks, _ := strconv.Atoi(cm.Annotations[ChunksAnnoKey])
+	for i := 1; i < chunks; i++ {
+		chunk := &v1.ConfigMap{}
+		if err = s.k8sClient.Get(s.ctx, s.chunkKey(i), chunk); err != nil {
+			return
+		}
+		if chunk.Labels[ChunkOfLabelKey] != k8sutil.LabelValue(s.key.Name) {
+			err = fmt.Errorf("ConfigMap %s/%s is not a chunk of %s", chunk.Namespace, chunk.Name, s.key.Name)
+			return
+		}
+		s.configMaps = append(s.configMaps, chunk)
+	}
+
+	parts := map[string]map[int]string{}
+	for _, item := range s.configMaps {
+		for key, value := range item.Data {
+			if name, index, ok := parsePartKey(key); ok {
+				if parts[name] == nil {
+					parts[name] = map[int]string{}
+				}
+				parts[name][index] = value
+			} else {
+				s.data[key] = value
+			}
+		}
+	}
+	for name, values := range parts {
+		builder := strings.Builder{}
+		for i := 0; i < len(values); i++ {
+			builder.WriteString(values[i])
+		}
+		s.data[name] = builder.String()
 	}
 	return
 }
 
+func (s *ConfigMapStore) chunkKey(index int) client.ObjectKey {
+	if index == 0 {
+		return s.key
+	}
+	return client.ObjectKey{Namespace: s.key.Namespace, Name: fmt.Sprintf("%s%s%d", s.key.Name, chunkNameSeparator, index)}
+}
+
 // GetStages returns the stage data
 func (s *ConfigMapStore) GetStages() string {
 	return s.Get(store.DataKeyStage)
@@ -94,23 +171,77 @@ func (s *ConfigMapStore) SetAllLog(log string) {
 
 // Get returns the value by a key
 func (s *ConfigMapStore) Get(key string) string {
-	return s.cache.Data[key]
+	return s.data[key]
 }
 
 // Set puts a key and value
 func (s *ConfigMapStore) Set(key, value string) {
-	s.cache.Data[key] = value
+	s.data[key] = value
+}
+
+// Keys returns the keys of all the stored data
+func (s *ConfigMapStore) Keys() (keys []string) {
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
 }
 
-// Save puts the data into ConfigMap via Kubernetes client
+// Save puts the data into ConfigMaps via Kubernetes client
 func (s *ConfigMapStore) Save() (err error) {
-	// it might be a new ConfigMap or not
-	if s.cache.GetResourceVersion() == "" {
-		k8sutil.SetOwnerReference(s.cache, s.owner)
-		err = s.k8sClient.Create(s.ctx, s.cache)
-	} else {
-		err = s.k8sClient.Update(s.ctx, s.cache)
+	chunks := splitIntoChunks(s.data, s.chunkSize)
+	for i, data := range chunks {
+		var cm *v1.ConfigMap
+		if i < len(s.configMaps) {
+			cm = s.configMaps[i]
+		} else {
+			key := s.chunkKey(i)
+			cm = &v1.ConfigMap{}
+			cm.Namespace = key.Namespace
+			cm.Name = key.Name
+			cm.Labels = map[string]string{ChunkOfLabelKey: k8sutil.LabelValue(s.key.Name)}
+			s.configMaps = append(s.configMaps, cm)
+		}
+		cm.Data = data
+		if i == 0 {
+			if cm.Annotations == nil {
+				cm.Annotations = map[string]string{}
+			}
+			cm.Annotations[ChunksAnnoKey] = strconv.Itoa(len(chunks))
+		}
+
+		// it might be a new ConfigMap or not
+		if cm.GetResourceVersion() == "" {
+			k8sutil.SetOwnerReference(cm, s.owner)
+			err = s.k8sClient.Create(s.ctx, cm)
+		} else {
+			err = s.k8sClient.Update(s.ctx, cm)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// remove the chunks which are not needed anymore
+	for i := len(chunks); i < len(s.configMaps); i++ {
+		if err = client.IgnoreNotFound(s.k8sClient.Delete(s.ctx, s.configMaps[i])); err != nil {
+			return
+		}
+	}
+	s.configMaps = s.configMaps[:len(chunks)]
+	return
+}
+
+// Delete removes all the ConfigMaps of the data
+func (s *ConfigMapStore) Delete() (err error) {
+	for _, cm := range s.configMaps {
+		if err = client.IgnoreNotFound(s.k8sClient.Delete(s.ctx, cm)); err != nil {
+			return
+		}
 	}
+	s.configMaps = nil
+	s.data = map[string]string{}
 	return
 }
 
@@ -118,3 +249,71 @@ func (s *ConfigMapStore) Save() (err error) {
 func (s *ConfigMapStore) SetOwnerReference(owner metav1.OwnerReference) {
 	s.owner = owner
 }
+
+// splitIntoChunks splits the data into chunks, the size of each chunk is not larger than the chunk size.
+// A value larger than the chunk size is split into parts with keys like <key>.part-0, <key>.part-1.
+// There is always one chunk at least.
+func splitIntoChunks(data map[string]string, chunkSize int) (chunks []map[string]string) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	current, currentSize := map[string]string{}, 0
+	add := func(key, value string) {
+		size := len(key) + len(value)
+		if currentSize > 0 && currentSize+size > chunkSize {
+			chunks = append(chunks, current)
+			current, currentSize = map[string]string{}, 0
+		}
+		current[key] = value
+		currentSize += size
+	}
+	for _, key := range keys {
+		parts := splitValue(data[key], chunkSize-len(key)-len(partKeySeparator)-4)
+		if len(parts) == 1 {
+			add(key, parts[0])
+			continue
+		}
+		for i, part := range parts {
+			add(fmt.Sprintf("%s%s%d", key, partKeySeparator, i), part)
+		}
+	}
+	return append(chunks, current)
+}
+
+// splitValue splits the value into parts at the rune boundaries
+func splitValue(value string, size int) (parts []string) {
+	if size <= 0 {
+		size = 1
+	}
+	for len(value) > size {
+		end := size
+		for end > 0 && !utf8.RuneStart(value[end]) {
+			end--
+		}
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(value)
+		}
+		parts = append(parts, value[:end])
+		value = value[end:]
+	}
+	if value != "" || len(parts) == 0 {
+		parts = append(parts, value)
+	}
+	return
+}
+
+// parsePartKey parses a key like <key>.part-<index>
+func parsePartKey(key string) (name string, index int, ok bool) {
+	i := strings.LastIndex(key, partKeySeparator)
+	if i < 0 {
+		return
+	}
+	var err error
+	if index, err = strconv.Atoi(key[i+len(partKeySeparator):]); err == nil && index >= 0 {
+		name, ok = key[:i], true
+	}
+	return
+}
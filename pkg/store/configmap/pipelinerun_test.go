@@ -18,7 +18,12 @@ package configmap
 
 import (
 	"context"
+	"strconv"
+	"strings"
+
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"kubesphere.io/devops/pkg/store/store"
@@ -57,3 +62,118 @@ func TestConfigMapStore(t *testing.T) {
 
 	assert.Nil(t, cmStore.Save())
 }
+
+func TestConfigMapStore_chunks(t *testing.T) {
+	k8sClient := fake.NewClientBuilder().Build()
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+	largeLog := strings.Repeat("日志", 300)
+
+	cmStore, err := NewConfigMapStore(context.Background(), key, k8sClient)
+	assert.Nil(t, err)
+	cmStore.(*ConfigMapStore).chunkSize = 256
+	cmStore.SetStages("stages")
+	cmStore.SetAllLog(largeLog)
+	assert.Nil(t, cmStore.Save())
+
+	// the data is split into multiple ConfigMaps
+	cm := &corev1.ConfigMap{}
+	assert.Nil(t, k8sClient.Get(context.Background(), key, cm))
+	chunks, _ := strconv.Atoi(cm.Annotations[ChunksAnnoKey])
+	assert.True(t, chunks > 1)
+	for i := 0; i < chunks; i++ {
+		chunk := &corev1.ConfigMap{}
+		assert.Nil(t, k8sClient.Get(context.Background(), cmStore.(*ConfigMapStore).chunkKey(i), chunk))
+		size := 0
+		for dataKey, value := range chunk.Data {
+			size += len(dataKey) + len(value)
+		}
+		assert.True(t, size <= 256, "chunk %d is too large: %d", i, size)
+		if i > 0 {
+			assert.Equal(t, "name", chunk.Labels[ChunkOfLabelKey])
+		}
+	}
+
+	// read the data from the chunks
+	cmStore, err = NewConfigMapStore(context.Background(), key, k8sClient)
+	assert.Nil(t, err)
+	assert.Equal(t, "stages", cmStore.GetStages())
+	assert.Equal(t, largeLog, cmStore.GetAllLog())
+	assert.Equal(t, []string{store.DataKeyAllLog, store.DataKeyStage}, cmStore.Keys())
+
+	// the unused chunks are removed
+	cmStore.SetAllLog("log")
+	assert.Nil(t, cmStore.Save())
+	assert.Nil(t, k8sClient.Get(context.Background(), key, cm))
+	assert.Equal(t, "1", cm.Annotations[ChunksAnnoKey])
+	assert.True(t, apierrors.IsNotFound(k8sClient.Get(context.Background(),
+		cmStore.(*ConfigMapStore).chunkKey(1), &corev1.ConfigMap{})))
+
+	assert.Nil(t, cmStore.Delete())
+	assert.True(t, apierrors.IsNotFound(k8sClient.Get(context.Background(), key, cm)))
+}
+
+func TestConfigMapStore_foreignChunk(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+	k8sClient := fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{
+			Namespace:   key.Namespace,
+			Name:        key.Name,
+			Annotations: map[string]string{ChunksAnnoKey: "2"},
+		},
+	}, &corev1.ConfigMap{
+		ObjectMeta: v1.ObjectMeta{Namespace: key.Namespace, Name: "name.chunk-1"},
+		Data:       map[string]string{"key": "value"},
+	}).Build()
+
+	// a ConfigMap without the label is not a chunk of the data
+	_, err := NewConfigMapStore(context.Background(), key, k8sClient)
+	assert.NotNil(t, err)
+	assert.Nil(t, k8sClient.Get(context.Background(), types.NamespacedName{
+		Namespace: key.Namespace, Name: "name.chunk-1"}, &corev1.ConfigMap{}))
+}
+
+func Test_splitValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		size  int
+		want  []string
+	}{{
+		name:  "smaller than the size",
+		value: "abc",
+		size:  4,
+		want:  []string{"abc"},
+	}, {
+		name:  "larger than the size",
+		value: "abcde",
+		size:  2,
+		want:  []string{"ab", "cd", "e"},
+	}, {
+		name:  "split at the rune boundaries",
+		value: "a日志",
+		size:  4,
+		want:  []string{"a日", "志"},
+	}, {
+		name:  "the size is smaller than a rune",
+		value: "日志",
+		size:  2,
+		want:  []string{"日", "志"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitValue(tt.value, tt.size))
+		})
+	}
+}
+
+func Test_parsePartKey(t *testing.T) {
+	name, index, ok := parsePartKey("log-all.part-2")
+	assert.True(t, ok)
+	assert.Equal(t, "log-all", name)
+	assert.Equal(t, 2, index)
+
+	_, _, ok = parsePartKey("log-all")
+	assert.False(t, ok)
+	_, _, ok = parsePartKey("log-all.part-x")
+	assert.False(t, ok)
+}
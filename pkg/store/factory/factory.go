@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/client/s3"
+	"kubesphere.io/devops/pkg/store/configmap"
+	"kubesphere.io/devops/pkg/store/filesystem"
+	s3store "kubesphere.io/devops/pkg/store/s3"
+	"kubesphere.io/devops/pkg/store/store"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// TypeAnnotation stores the stage data in the annotations of PipelineRuns
+	TypeAnnotation = ""
+	// TypeConfigMap stores the data in ConfigMaps
+	TypeConfigMap = "configmap"
+	// TypeS3 stores the data in an S3-compatible object storage
+	TypeS3 = "s3"
+	// TypeFileSystem stores the data in a local directory, such as a mounted PersistentVolume
+	TypeFileSystem = "filesystem"
+
+	// DefaultRootDir is the default root directory of the filesystem data store
+	DefaultRootDir = "/var/lib/devops/pipelineruns"
+)
+
+// Options is the options of the PipelineRun data store
+type Options struct {
+	// Type is the type of the data store, could be empty, configmap, s3 or filesystem
+	Type string `json:"type,omitempty" yaml:"type,omitempty" mapstructure:"type"`
+	// RootDir is the root directory of the filesystem data store
+	RootDir string `json:"rootDir,omitempty" yaml:"rootDir,omitempty" mapstructure:"rootDir"`
+}
+
+// NewOptions creates the default options
+func NewOptions() *Options {
+	return &Options{Type: TypeConfigMap, RootDir: DefaultRootDir}
+}
+
+// Factory creates the PipelineRun data stores according to the options
+type Factory struct {
+	Options
+
+	k8sClient client.Client
+	s3Client  s3.Interface
+}
+
+// NewFactory creates a PipelineRun data store factory, the S3 client is only required by the s3 data store
+func NewFactory(options *Options, k8sClient client.Client, s3Client s3.Interface) *Factory {
+	if options == nil {
+		options = NewOptions()
+	}
+	return &Factory{
+		Options:   *options,
+		k8sClient: k8sClient,
+		s3Client:  s3Client,
+	}
+}
+
+// New creates a data store of a PipelineRun for reading or deleting the data, it never moves any data.
+// The ConfigMap data store is used if the type is annotation, because the annotation is handled by the PipelineRun
+// itself, and the older data might be in a ConfigMap. The data in the legacy ConfigMap is returned instead if the
+// object or filesystem data store is empty, the data is not migrated yet.
+func (f *Factory) New(ctx context.Context, key client.ObjectKey) (result store.PipelineRunDataStore, err error) {
+	var legacy bool
+	if result, legacy, err = f.newStore(ctx, key); err != nil || legacy || f.k8sClient == nil || len(result.Keys()) > 0 {
+		return
+	}
+
+	var cmStore store.ConfigMapStore
+	if cmStore, err = configmap.NewConfigMapStore(ctx, key, f.k8sClient); err == nil && len(cmStore.Keys()) > 0 {
+		result = cmStore
+	}
+	return
+}
+
+// NewWithMigration creates a data store of a PipelineRun, the data in a ConfigMap is migrated into the object or
+// filesystem data store at the first time. It should only be called by the controller which writes the data.
+func (f *Factory) NewWithMigration(ctx context.Context, key client.ObjectKey) (result store.PipelineRunDataStore, err error) {
+	var legacy bool
+	if result, legacy, err = f.newStore(ctx, key); err == nil && !legacy {
+		err = f.migrateFromConfigMap(ctx, key, result)
+	}
+	return
+}
+
+// newStore creates the data store according to the type, legacy is true if it's the ConfigMap data store
+func (f *Factory) newStore(ctx context.Context, key client.ObjectKey) (result store.PipelineRunDataStore, legacy bool, err error) {
+	switch f.Type {
+	case TypeAnnotation, TypeConfigMap:
+		legacy = true
+		result, err = configmap.NewConfigMapStore(ctx, key, f.k8sClient)
+	case TypeS3:
+		if f.s3Client == nil {
+			err = fmt.Errorf("the s3 client is required by the pipelineRun data store type: %s", f.Type)
+			return
+		}
+		result = s3store.NewS3Store(key, f.s3Client)
+	case TypeFileSystem:
+		if f.RootDir == "" {
+			err = fmt.Errorf("the root directory is required by the pipelineRun data store type: %s", f.Type)
+			return
+		}
+		result = filesystem.NewFileSystemStore(key, f.RootDir)
+	default:
+		err = fmt.Errorf("unknown pipelineRun data store type: %s", f.Type)
+	}
+	return
+}
+
+// migrateFromConfigMap moves the data from the ConfigMap into the target store if the target store is empty
+func (f *Factory) migrateFromConfigMap(ctx context.Context, key client.ObjectKey, target store.PipelineRunDataStore) (err error) {
+	if f.k8sClient == nil || len(target.Keys()) > 0 {
+		return
+	}
+
+	var legacy store.ConfigMapStore
+	if legacy, err = configmap.NewConfigMapStore(ctx, key, f.k8sClient); err != nil {
+		return
+	}
+	keys := legacy.Keys()
+	if len(keys) == 0 {
+		return
+	}
+	for _, dataKey := range keys {
+		target.Set(dataKey, legacy.Get(dataKey))
+	}
+	if err = target.Save(); err == nil {
+		klog.V(4).Infof("migrated the data of PipelineRun %s from ConfigMap into %s", key, f.Type)
+		err = legacy.Delete()
+	}
+	return
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package factory
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	s3fake "kubesphere.io/devops/pkg/client/s3/fake"
+	"kubesphere.io/devops/pkg/store/configmap"
+	"kubesphere.io/devops/pkg/store/filesystem"
+	s3store "kubesphere.io/devops/pkg/store/s3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestFactory_New(t *testing.T) {
+	root, err := ioutil.TempDir("", "pipelineruns")
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(root)
+	}()
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+
+	tests := []struct {
+		name     string
+		options  *Options
+		withS3   bool
+		wantType interface{}
+		wantErr  bool
+	}{{
+		name:     "default options",
+		wantType: &configmap.ConfigMapStore{},
+	}, {
+		name:     "annotation",
+		options:  &Options{Type: TypeAnnotation},
+		wantType: &configmap.ConfigMapStore{},
+	}, {
+		name:     "s3",
+		options:  &Options{Type: TypeS3},
+		withS3:   true,
+		wantType: &s3store.S3Store{},
+	}, {
+		name:    "s3 without client",
+		options: &Options{Type: TypeS3},
+		wantErr: true,
+	}, {
+		name:     "filesystem",
+		options:  &Options{Type: TypeFileSystem, RootDir: root},
+		wantType: &filesystem.FileSystemStore{},
+	}, {
+		name:    "filesystem without root directory",
+		options: &Options{Type: TypeFileSystem},
+		wantErr: true,
+	}, {
+		name:    "unknown",
+		options: &Options{Type: "unknown"},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFactory(tt.options, fake.NewClientBuilder().Build(), nil)
+			if tt.withS3 {
+				f = NewFactory(tt.options, fake.NewClientBuilder().Build(), s3fake.NewFakeS3())
+			}
+			result, err := f.New(context.Background(), key)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.IsType(t, tt.wantType, result)
+		})
+	}
+}
+
+func TestFactory_NewWithMigration(t *testing.T) {
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+	legacy := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "name"},
+		Data:       map[string]string{"stage": "stages", "log-all": "log"},
+	}
+	k8sClient := fake.NewClientBuilder().WithObjects(legacy).Build()
+	s3Client := s3fake.NewFakeS3()
+	f := NewFactory(&Options{Type: TypeS3}, k8sClient, s3Client)
+
+	// the data is read from the legacy ConfigMap without being migrated
+	dataStore, err := f.New(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, "stages", dataStore.GetStages())
+	assert.Empty(t, s3Client.Storage)
+	assert.Nil(t, k8sClient.Get(context.Background(), key, &v1.ConfigMap{}))
+
+	dataStore, err = f.NewWithMigration(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, "stages", dataStore.GetStages())
+	assert.Equal(t, "log", dataStore.GetAllLog())
+	assert.Contains(t, s3Client.Storage, "pipelineruns/ns/name/stage")
+
+	// the legacy ConfigMap is removed after migrating
+	err = k8sClient.Get(context.Background(), key, &v1.ConfigMap{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// nothing to migrate
+	dataStore, err = f.NewWithMigration(context.Background(), key)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"log-all", "stage"}, dataStore.Keys())
+}
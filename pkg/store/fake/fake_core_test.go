@@ -46,6 +46,11 @@ func TestFakeStore(t *testing.T) {
 	store.SetStepLog(1, 1, "step")
 	assert.Equal(t, "step", store.GetStepLog(1, 1))
 
+	assert.Equal(t, []string{"fake", "log-all", "log-step-1-1", "stage", "status"}, store.Keys())
+
 	assert.Nil(t, store.Save())
+	assert.Nil(t, store.Delete())
+	assert.Empty(t, store.Keys())
 	assert.NotNil(t, store.WithError(errors.New("fake")).Save())
+	assert.NotNil(t, store.Delete())
 }
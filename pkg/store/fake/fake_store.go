@@ -16,7 +16,11 @@ limitations under the License.
 
 package fake
 
-import "kubesphere.io/devops/pkg/store/store"
+import (
+	"sort"
+
+	"kubesphere.io/devops/pkg/store/store"
+)
 
 // FakeStore is a fake store
 type FakeStore struct {
@@ -91,3 +95,20 @@ func (s *FakeStore) GetAllLog() string {
 func (s *FakeStore) SetAllLog(log string) {
 	s.data[store.DataKeyAllLog] = log
 }
+
+// Keys is a fake method
+func (s *FakeStore) Keys() (keys []string) {
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Delete is a fake method
+func (s *FakeStore) Delete() error {
+	if s.err == nil {
+		s.data = map[string]string{}
+	}
+	return s.err
+}
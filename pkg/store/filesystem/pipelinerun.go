@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/store/store"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tempFileExt is the extension of the temporary files, a value is written into a temporary file before renaming
+const tempFileExt = ".tmp"
+
+// FileSystemStore represents a key-value store base on a local directory, such as a mounted PersistentVolume.
+// Each value is stored as a file named as <root>/<namespace>/<name>/<key>.
+type FileSystemStore struct {
+	dir string
+
+	cache map[string]string
+	dirty map[string]bool
+}
+
+// NewFileSystemStore creates a PipelineRun data store
+func NewFileSystemStore(key client.ObjectKey, root string) store.PipelineRunDataStore {
+	return &FileSystemStore{
+		dir:   filepath.Join(root, key.Namespace, key.Name),
+		cache: map[string]string{},
+		dirty: map[string]bool{},
+	}
+}
+
+// GetStages returns the stage data
+func (s *FileSystemStore) GetStages() string {
+	return s.Get(store.DataKeyStage)
+}
+
+// SetStages stores the stage data
+func (s *FileSystemStore) SetStages(stages string) {
+	s.Set(store.DataKeyStage, stages)
+}
+
+// GetStatus returns the status
+func (s *FileSystemStore) GetStatus() string {
+	return s.Get(store.DataKeyStatus)
+}
+
+// SetStatus stores the status
+func (s *FileSystemStore) SetStatus(status string) {
+	s.Set(store.DataKeyStatus, status)
+}
+
+// GetStepLog returns the step log
+func (s *FileSystemStore) GetStepLog(stage, step int) string {
+	return s.Get(store.StepLogKey(stage, step))
+}
+
+// SetStepLog stores the step log
+func (s *FileSystemStore) SetStepLog(stage, step int, log string) {
+	s.Set(store.StepLogKey(stage, step), log)
+}
+
+// GetAllLog returns the whole log
+func (s *FileSystemStore) GetAllLog() string {
+	return s.Get(store.DataKeyAllLog)
+}
+
+// SetAllLog store the whole log
+func (s *FileSystemStore) SetAllLog(log string) {
+	s.Set(store.DataKeyAllLog, log)
+}
+
+// Get returns the value by a key, the file is read only once
+func (s *FileSystemStore) Get(key string) string {
+	if value, ok := s.cache[key]; ok {
+		return value
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.Base(key)))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("failed to read %s from %s, error: %v", key, s.dir, err)
+		}
+		return ""
+	}
+	s.cache[key] = string(data)
+	return s.cache[key]
+}
+
+// Set puts a key and value
+func (s *FileSystemStore) Set(key, value string) {
+	s.cache[key] = value
+	s.dirty[key] = true
+}
+
+// Keys returns the keys of all the stored data
+func (s *FileSystemStore) Keys() (keys []string) {
+	all := map[string]bool{}
+	for key := range s.cache {
+		all[key] = true
+	}
+	if files, err := ioutil.ReadDir(s.dir); err == nil {
+		for _, file := range files {
+			if !file.IsDir() && filepath.Ext(file.Name()) != tempFileExt {
+				all[file.Name()] = true
+			}
+		}
+	}
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Save writes the changed values into files
+func (s *FileSystemStore) Save() (err error) {
+	if len(s.dirty) == 0 {
+		return
+	}
+	if err = os.MkdirAll(s.dir, 0755); err != nil {
+		return
+	}
+	for key := range s.dirty {
+		file := filepath.Join(s.dir, filepath.Base(key))
+		// write into a temporary file first, the readers never see a partial file
+		if err = ioutil.WriteFile(file+tempFileExt, []byte(s.cache[key]), 0644); err != nil {
+			return
+		}
+		if err = os.Rename(file+tempFileExt, file); err != nil {
+			return
+		}
+		delete(s.dirty, key)
+	}
+	return
+}
+
+// Delete removes the directory of the data
+func (s *FileSystemStore) Delete() (err error) {
+	if err = os.RemoveAll(s.dir); err == nil {
+		s.cache = map[string]string{}
+		s.dirty = map[string]bool{}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filesystem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	"kubesphere.io/devops/pkg/store/store"
+)
+
+func TestFileSystemStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "pipelineruns")
+	assert.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(root)
+	}()
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+
+	fsStore := NewFileSystemStore(key, root)
+	assert.Empty(t, fsStore.Keys())
+	assert.Empty(t, fsStore.GetStages())
+	// nothing to save
+	assert.Nil(t, fsStore.Save())
+	_, err = os.Stat(filepath.Join(root, "ns", "name"))
+	assert.True(t, os.IsNotExist(err))
+
+	fsStore.SetStages("stages")
+	fsStore.SetAllLog("log")
+	assert.Nil(t, fsStore.Save())
+	data, err := ioutil.ReadFile(filepath.Join(root, "ns", "name", store.DataKeyStage))
+	assert.Nil(t, err)
+	assert.Equal(t, "stages", string(data))
+
+	// read the data from the files
+	fsStore = NewFileSystemStore(key, root)
+	assert.Equal(t, []string{store.DataKeyAllLog, store.DataKeyStage}, fsStore.Keys())
+	assert.Equal(t, "stages", fsStore.GetStages())
+	assert.Equal(t, "log", fsStore.GetAllLog())
+	assert.Empty(t, fsStore.GetStatus())
+
+	assert.Nil(t, fsStore.Delete())
+	_, err = os.Stat(filepath.Join(root, "ns", "name"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, fsStore.Keys())
+}
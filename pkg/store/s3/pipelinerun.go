@@ -0,0 +1,188 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"k8s.io/klog/v2"
+	"kubesphere.io/devops/pkg/client/s3"
+	"kubesphere.io/devops/pkg/store/store"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// indexKey is the name of the object which holds the keys of all the stored data
+const indexKey = ".index"
+
+// S3Store represents a key-value store base on an S3-compatible object storage.
+// Each value is stored as an object named as pipelineruns/<namespace>/<name>/<key>.
+type S3Store struct {
+	s3Client s3.Interface
+	prefix   string
+
+	cache map[string]string
+	dirty map[string]bool
+	keys  map[string]bool
+}
+
+// NewS3Store creates a PipelineRun data store
+func NewS3Store(key client.ObjectKey, s3Client s3.Interface) (result store.PipelineRunDataStore) {
+	s3Store := &S3Store{
+		s3Client: s3Client,
+		prefix:   fmt.Sprintf("pipelineruns/%s/%s/", key.Namespace, key.Name),
+		cache:    map[string]string{},
+		dirty:    map[string]bool{},
+	}
+	s3Store.loadIndex()
+	return s3Store
+}
+
+func (s *S3Store) loadIndex() {
+	s.keys = map[string]bool{}
+	data, err := s.s3Client.Read(s.prefix + indexKey)
+	if err != nil {
+		klog.V(6).Infof("no index found in %s, error: %v", s.prefix, err)
+		return
+	}
+	var keys []string
+	if err = json.Unmarshal(data, &keys); err != nil {
+		klog.Errorf("failed to parse the index of %s, error: %v", s.prefix, err)
+		return
+	}
+	for _, key := range keys {
+		s.keys[key] = true
+	}
+}
+
+// GetStages returns the stage data
+func (s *S3Store) GetStages() string {
+	return s.Get(store.DataKeyStage)
+}
+
+// SetStages stores the stage data
+func (s *S3Store) SetStages(stages string) {
+	s.Set(store.DataKeyStage, stages)
+}
+
+// GetStatus returns the status
+func (s *S3Store) GetStatus() string {
+	return s.Get(store.DataKeyStatus)
+}
+
+// SetStatus stores the status
+func (s *S3Store) SetStatus(status string) {
+	s.Set(store.DataKeyStatus, status)
+}
+
+// GetStepLog returns the step log
+func (s *S3Store) GetStepLog(stage, step int) string {
+	return s.Get(store.StepLogKey(stage, step))
+}
+
+// SetStepLog stores the step log
+func (s *S3Store) SetStepLog(stage, step int, log string) {
+	s.Set(store.StepLogKey(stage, step), log)
+}
+
+// GetAllLog returns the whole log
+func (s *S3Store) GetAllLog() string {
+	return s.Get(store.DataKeyAllLog)
+}
+
+// SetAllLog store the whole log
+func (s *S3Store) SetAllLog(log string) {
+	s.Set(store.DataKeyAllLog, log)
+}
+
+// Get returns the value by a key, the object is read only once
+func (s *S3Store) Get(key string) string {
+	if value, ok := s.cache[key]; ok || !s.keys[key] {
+		return value
+	}
+	data, err := s.s3Client.Read(s.prefix + key)
+	if err != nil {
+		klog.Errorf("failed to read %s%s, error: %v", s.prefix, key, err)
+		return ""
+	}
+	s.cache[key] = string(data)
+	return s.cache[key]
+}
+
+// Set puts a key and value
+func (s *S3Store) Set(key, value string) {
+	s.cache[key] = value
+	s.dirty[key] = true
+}
+
+// Keys returns the keys of all the stored data
+func (s *S3Store) Keys() (keys []string) {
+	all := map[string]bool{}
+	for key := range s.keys {
+		all[key] = true
+	}
+	for key := range s.cache {
+		all[key] = true
+	}
+	for key := range all {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
+
+// Save uploads the changed values and the index
+func (s *S3Store) Save() (err error) {
+	if len(s.dirty) == 0 {
+		return
+	}
+	for key := range s.dirty {
+		if err = s.s3Client.Upload(s.prefix+key, key, bytes.NewBufferString(s.cache[key])); err != nil {
+			return
+		}
+	}
+
+	keys := s.Keys()
+	var index []byte
+	if index, err = json.Marshal(keys); err != nil {
+		return
+	}
+	if err = s.s3Client.Upload(s.prefix+indexKey, indexKey, bytes.NewBuffer(index)); err == nil {
+		for _, key := range keys {
+			s.keys[key] = true
+		}
+		s.dirty = map[string]bool{}
+	}
+	return
+}
+
+// Delete removes all the objects of the data
+func (s *S3Store) Delete() (err error) {
+	for _, key := range s.Keys() {
+		if err = s.s3Client.Delete(s.prefix + key); err != nil {
+			return
+		}
+	}
+	if err = s.s3Client.Delete(s.prefix + indexKey); err == nil {
+		s.cache = map[string]string{}
+		s.dirty = map[string]bool{}
+		s.keys = map[string]bool{}
+	}
+	return
+}
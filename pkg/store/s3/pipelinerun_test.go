@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+	s3fake "kubesphere.io/devops/pkg/client/s3/fake"
+	"kubesphere.io/devops/pkg/store/store"
+)
+
+func TestS3Store(t *testing.T) {
+	s3Client := s3fake.NewFakeS3()
+	key := types.NamespacedName{Namespace: "ns", Name: "name"}
+
+	s3Store := NewS3Store(key, s3Client)
+	assert.Empty(t, s3Store.Keys())
+	assert.Empty(t, s3Store.GetStages())
+	// nothing to save
+	assert.Nil(t, s3Store.Save())
+	assert.Empty(t, s3Client.Storage)
+
+	s3Store.SetStages("stages")
+	s3Store.SetStepLog(1, 2, "step")
+	assert.Equal(t, "stages", s3Store.GetStages())
+	assert.Nil(t, s3Store.Save())
+	assert.Contains(t, s3Client.Storage, "pipelineruns/ns/name/stage")
+	assert.Contains(t, s3Client.Storage, "pipelineruns/ns/name/.index")
+
+	// read the data from the object storage
+	s3Store = NewS3Store(key, s3Client)
+	assert.Equal(t, []string{store.StepLogKey(1, 2), store.DataKeyStage}, s3Store.Keys())
+	assert.Equal(t, "stages", s3Store.GetStages())
+	assert.Equal(t, "step", s3Store.GetStepLog(1, 2))
+	assert.Empty(t, s3Store.GetAllLog())
+
+	assert.Nil(t, s3Store.Delete())
+	assert.Empty(t, s3Client.Storage)
+	assert.Empty(t, s3Store.Keys())
+}
@@ -54,6 +54,11 @@ type PipelineRunDataStore interface {
 	SetStepLog(stage, step int, log string)
 	GetAllLog() string
 	SetAllLog(log string)
+
+	// Keys returns the keys of all the stored data
+	Keys() []string
+	// Delete removes all the stored data
+	Delete() error
 }
 
 // ConfigMapStore represents a store base on a ConfigMap
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncwindow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed cron expression in the standard format which has five fields:
+// minute, hour, day of month, month and day of week
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if the day of month or the day of week starts with a wildcard,
+	// a day matches both of the fields in this case, otherwise it matches any of them
+	domStar, dowStar bool
+}
+
+type fieldBounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds = fieldBounds{min: 0, max: 59}
+	hourBounds   = fieldBounds{min: 0, max: 23}
+	domBounds    = fieldBounds{min: 1, max: 31}
+	monthBounds  = fieldBounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// both 0 and 7 are Sunday
+	dowBounds = fieldBounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// parseSchedule parses a cron expression like "0 22 * * 1-5"
+func parseSchedule(expr string) (s *schedule, err error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		err = fmt.Errorf("invalid schedule %q, expected 5 fields but got %d", expr, len(fields))
+		return
+	}
+
+	s = &schedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	for i, item := range []struct {
+		bits   *uint64
+		bounds fieldBounds
+	}{
+		{&s.minute, minuteBounds},
+		{&s.hour, hourBounds},
+		{&s.dom, domBounds},
+		{&s.month, monthBounds},
+		{&s.dow, dowBounds},
+	} {
+		if *item.bits, err = parseField(fields[i], item.bounds); err != nil {
+			err = fmt.Errorf("invalid schedule %q: %v", expr, err)
+			return
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return
+}
+
+// parseField parses a field which is a comma-separated list of "*", "value", "low-high" with an optional "/step"
+func parseField(field string, bounds fieldBounds) (bits uint64, err error) {
+	for _, item := range strings.Split(field, ",") {
+		rangeAndStep := strings.SplitN(item, "/", 2)
+		low, high, step := bounds.min, bounds.max, 1
+
+		if rangeExpr := rangeAndStep[0]; rangeExpr != "*" {
+			lowAndHigh := strings.SplitN(rangeExpr, "-", 2)
+			if low, err = parseValue(lowAndHigh[0], bounds); err != nil {
+				return
+			}
+			if len(lowAndHigh) == 2 {
+				if high, err = parseValue(lowAndHigh[1], bounds); err != nil {
+					return
+				}
+			} else if len(rangeAndStep) == 1 {
+				// "5/10" means from 5 to the max value every 10 units
+				high = low
+			}
+		}
+		if len(rangeAndStep) == 2 {
+			if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+				err = fmt.Errorf("invalid step %q", rangeAndStep[1])
+				return
+			}
+		}
+		if low > high {
+			err = fmt.Errorf("invalid range %q", item)
+			return
+		}
+
+		for i := low; i <= high; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return
+}
+
+func parseValue(value string, bounds fieldBounds) (result int, err error) {
+	var ok bool
+	if result, ok = bounds.names[strings.ToLower(value)]; ok {
+		return
+	}
+	if result, err = strconv.Atoi(value); err != nil {
+		err = fmt.Errorf("invalid value %q", value)
+	} else if result < bounds.min || result > bounds.max {
+		err = fmt.Errorf("value %d out of range [%d, %d]", result, bounds.min, bounds.max)
+	}
+	return
+}
+
+// next returns the first time matching the schedule which is after the given time,
+// it returns a zero time if there is no matching time in five years
+func (s *schedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *schedule) dayMatches(t time.Time) bool {
+	domMatched := s.dom&(1<<uint(t.Day())) != 0
+	dowMatched := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatched && dowMatched
+	}
+	return domMatched || dowMatched
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncwindow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{{
+		name: "wildcards",
+		expr: "* * * * *",
+	}, {
+		name: "lists, ranges and steps",
+		expr: "0,30 9-17/2 1-15 */3 mon-fri",
+	}, {
+		name: "names",
+		expr: "0 0 1 Jan,jul SUN",
+	}, {
+		name:    "missing fields",
+		expr:    "0 22 * *",
+		wantErr: true,
+	}, {
+		name:    "out of range",
+		expr:    "60 22 * * *",
+		wantErr: true,
+	}, {
+		name:    "invalid step",
+		expr:    "*/0 22 * * *",
+		wantErr: true,
+	}, {
+		name:    "reversed range",
+		expr:    "0 22 * * 5-1",
+		wantErr: true,
+	}, {
+		name:    "invalid value",
+		expr:    "0 22 * * someday",
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSchedule(tt.expr)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func Test_schedule_next(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	assert.Nil(t, err)
+	// it's a Friday
+	now := time.Date(2022, 9, 2, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{{
+		name: "every minute",
+		expr: "* * * * *",
+		from: now,
+		want: time.Date(2022, 9, 2, 10, 31, 0, 0, time.UTC),
+	}, {
+		name: "later today",
+		expr: "0 22 * * *",
+		from: now,
+		want: time.Date(2022, 9, 2, 22, 0, 0, 0, time.UTC),
+	}, {
+		name: "tomorrow",
+		expr: "0 9 * * *",
+		from: now,
+		want: time.Date(2022, 9, 3, 9, 0, 0, 0, time.UTC),
+	}, {
+		name: "next Monday",
+		expr: "0 9 * * 1",
+		from: now,
+		want: time.Date(2022, 9, 5, 9, 0, 0, 0, time.UTC),
+	}, {
+		name: "Sunday is 7",
+		expr: "0 9 * * 7",
+		from: now,
+		want: time.Date(2022, 9, 4, 9, 0, 0, 0, time.UTC),
+	}, {
+		name: "day of month or day of week",
+		expr: "0 0 15 * 6",
+		from: now,
+		want: time.Date(2022, 9, 3, 0, 0, 0, 0, time.UTC),
+	}, {
+		name: "day of month and wildcard day of week",
+		expr: "0 0 15 * *",
+		from: now,
+		want: time.Date(2022, 9, 15, 0, 0, 0, 0, time.UTC),
+	}, {
+		name: "next year",
+		expr: "0 0 1 jan *",
+		from: now,
+		want: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, {
+		name: "time zone",
+		expr: "0 22 * * *",
+		from: now.In(shanghai),
+		want: time.Date(2022, 9, 2, 22, 0, 0, 0, shanghai),
+	}, {
+		name: "never",
+		expr: "0 0 30 2 *",
+		from: now,
+		want: time.Time{},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseSchedule(tt.expr)
+			assert.Nil(t, err)
+			assert.True(t, tt.want.Equal(s.next(tt.from)), s.next(tt.from))
+		})
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncwindow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	"kubesphere.io/devops/pkg/utils/sliceutil"
+)
+
+const (
+	// KindAllow is the kind of the sync windows which allow syncs when they are active
+	KindAllow = "allow"
+	// KindDeny is the kind of the sync windows which block syncs when they are active
+	KindDeny = "deny"
+	// InCluster is the cluster name of the FluxCD Applications which are deployed into the host cluster
+	InCluster = "in-cluster"
+)
+
+// Target is the deployment which the sync windows and change freezes are assigned to
+type Target struct {
+	// Application is the name of the Application
+	Application string
+	// Namespaces are the namespaces which the Application is deployed to
+	Namespaces []string
+	// Clusters are the names or the servers of the clusters which the Application is deployed to
+	Clusters []string
+}
+
+// TargetOf returns the target of an Argo CD or FluxCD Application
+func TargetOf(app *v1alpha1.Application) (target Target) {
+	target.Application = app.GetName()
+	switch app.Spec.Kind {
+	case v1alpha1.ArgoCD:
+		if app.Spec.ArgoApp == nil {
+			return
+		}
+		destination := app.Spec.ArgoApp.Spec.Destination
+		target.addNamespace(destination.Namespace)
+		target.addCluster(destination.Server)
+		target.addCluster(destination.Name)
+	case v1alpha1.FluxCD:
+		if app.Spec.FluxApp == nil || app.Spec.FluxApp.Spec.Config == nil {
+			return
+		}
+		var destinations []v1alpha1.FluxApplicationDestination
+		config := app.Spec.FluxApp.Spec.Config
+		if config.HelmRelease != nil {
+			for _, deploy := range config.HelmRelease.Deploy {
+				if deploy != nil {
+					destinations = append(destinations, deploy.Destination)
+				}
+			}
+		}
+		for _, kus := range config.Kustomization {
+			if kus != nil {
+				destinations = append(destinations, kus.Destination)
+			}
+		}
+
+		for _, destination := range destinations {
+			if destination.TargetNamespace == "" {
+				target.addNamespace(app.GetNamespace())
+			} else {
+				target.addNamespace(destination.TargetNamespace)
+			}
+			if destination.KubeConfig == nil {
+				target.addCluster(InCluster)
+			} else {
+				target.addCluster(destination.KubeConfig.SecretRef.Name)
+			}
+		}
+	}
+	return
+}
+
+func (t *Target) addNamespace(namespace string) {
+	if namespace != "" {
+		t.Namespaces = sliceutil.AddToSlice(namespace, t.Namespaces)
+	}
+}
+
+func (t *Target) addCluster(cluster string) {
+	if cluster != "" {
+		t.Clusters = sliceutil.AddToSlice(cluster, t.Clusters)
+	}
+}
+
+// Result is the result of evaluating the sync windows and change freezes
+type Result struct {
+	// Allowed is true if the sync is allowed
+	Allowed bool
+	// Message explains why the sync is blocked
+	Message string
+	// NextTransition is the next time when a matched window or change freeze begins or ends,
+	// the result might change since then. It's zero if there is no transition.
+	NextTransition time.Time
+}
+
+func (r *Result) block(message string) {
+	if r.Allowed {
+		r.Allowed = false
+		r.Message = message
+	}
+}
+
+func (r *Result) addTransition(t time.Time) {
+	if !t.IsZero() && (r.NextTransition.IsZero() || t.Before(r.NextTransition)) {
+		r.NextTransition = t
+	}
+}
+
+// Evaluate checks if the target can be synced at the given time according to the sync windows and change freezes
+// of a DevOpsProject. Following the rules of Argo CD, a sync is blocked if any matched deny window is active,
+// or there are matched allow windows but none of them is active. A manual sync is not blocked by the windows
+// which enable the manual sync. The change freezes block all the syncs.
+func Evaluate(spec *v1alpha3.DevOpsProjectSpec, target Target, now time.Time, manual bool) (result Result, err error) {
+	result.Allowed = true
+
+	for _, freeze := range spec.ChangeFreezes {
+		if len(freeze.Applications) > 0 && !matchAny(freeze.Applications, target.Application) {
+			continue
+		}
+		start, end := freeze.Start.Time, freeze.End.Time
+		switch {
+		case now.Before(start):
+			result.addTransition(start)
+		case now.Before(end):
+			result.addTransition(end)
+			message := fmt.Sprintf("the change freeze %q is in progress until %s", freeze.Name, end.UTC().Format(time.RFC3339))
+			if freeze.Reason != "" {
+				message = fmt.Sprintf("%s: %s", message, freeze.Reason)
+			}
+			result.block(message)
+		}
+	}
+
+	var hasAllow, allowActive, allowManualSync bool
+	for _, window := range spec.SyncWindows {
+		if window == nil || !windowMatches(window, target) {
+			continue
+		}
+
+		var active bool
+		var transition time.Time
+		if active, transition, err = isActive(window, now); err != nil {
+			return
+		}
+		result.addTransition(transition)
+
+		switch window.Kind {
+		case KindAllow:
+			hasAllow = true
+			allowActive = allowActive || active
+			allowManualSync = allowManualSync || window.ManualSync
+		case KindDeny:
+			if active && !(manual && window.ManualSync) {
+				result.block(fmt.Sprintf("the deny window %q is active until %s", window.Schedule,
+					transition.UTC().Format(time.RFC3339)))
+			}
+		default:
+			err = fmt.Errorf("invalid kind %q of the sync window %q, it should be %s or %s",
+				window.Kind, window.Schedule, KindAllow, KindDeny)
+			return
+		}
+	}
+	if hasAllow && !allowActive && !(manual && allowManualSync) {
+		result.block("none of the allow windows is active")
+	}
+	return
+}
+
+// isActive returns true if the window is active at the given time. The transition is the end of the window
+// if it's active, otherwise it's the next beginning of the window.
+func isActive(window *v1alpha3.SyncWindow, now time.Time) (active bool, transition time.Time, err error) {
+	var s *schedule
+	if s, err = parseSchedule(window.Schedule); err != nil {
+		return
+	}
+	var duration time.Duration
+	if duration, err = time.ParseDuration(window.Duration); err != nil || duration <= 0 {
+		err = fmt.Errorf("invalid duration %q of the sync window %q", window.Duration, window.Schedule)
+		return
+	}
+	loc := time.UTC
+	if window.TimeZone != "" {
+		if loc, err = time.LoadLocation(window.TimeZone); err != nil {
+			err = fmt.Errorf("invalid time zone %q of the sync window %q: %v", window.TimeZone, window.Schedule, err)
+			return
+		}
+	}
+
+	// the window is active if it began within the duration, the latest beginning decides the end
+	now = now.In(loc)
+	for start := s.next(now.Add(-duration)); !start.IsZero() && !start.After(now); start = s.next(start) {
+		active, transition = true, start.Add(duration)
+	}
+	if !active {
+		transition = s.next(now)
+	}
+	return
+}
+
+func windowMatches(window *v1alpha3.SyncWindow, target Target) bool {
+	if matchAny(window.Applications, target.Application) {
+		return true
+	}
+	for _, namespace := range target.Namespaces {
+		if matchAny(window.Namespaces, namespace) {
+			return true
+		}
+	}
+	for _, cluster := range target.Clusters {
+		if matchAny(window.Clusters, cluster) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether the value matches the pattern in which "*" matches any sequence of characters
+func match(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
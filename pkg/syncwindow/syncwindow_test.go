@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The KubeSphere Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncwindow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubesphere.io/devops/pkg/api/devops/v1alpha3"
+	"kubesphere.io/devops/pkg/api/gitops/v1alpha1"
+	helmv2 "kubesphere.io/devops/pkg/external/fluxcd/helm/v2beta1"
+	apimeta "kubesphere.io/devops/pkg/external/fluxcd/meta"
+)
+
+func TestTargetOf(t *testing.T) {
+	tests := []struct {
+		name string
+		app  *v1alpha1.Application
+		want Target
+	}{{
+		name: "Argo CD Application",
+		app: &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "devops"},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.ArgoCD,
+				ArgoApp: &v1alpha1.ArgoApplication{
+					Spec: v1alpha1.ArgoApplicationSpec{
+						Destination: v1alpha1.ApplicationDestination{
+							Server:    "https://kubernetes.default.svc",
+							Namespace: "guestbook",
+						},
+					},
+				},
+			},
+		},
+		want: Target{
+			Application: "guestbook",
+			Namespaces:  []string{"guestbook"},
+			Clusters:    []string{"https://kubernetes.default.svc"},
+		},
+	}, {
+		name: "FluxCD Application",
+		app: &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "devops"},
+			Spec: v1alpha1.ApplicationSpec{
+				Kind: v1alpha1.FluxCD,
+				FluxApp: &v1alpha1.FluxApplication{
+					Spec: v1alpha1.FluxApplicationSpec{
+						Config: &v1alpha1.FluxApplicationConfig{
+							HelmRelease: &v1alpha1.HelmReleaseSpec{
+								Deploy: []*v1alpha1.Deploy{{
+									Destination: v1alpha1.FluxApplicationDestination{TargetNamespace: "podinfo"},
+								}, {
+									Destination: v1alpha1.FluxApplicationDestination{
+										KubeConfig: &helmv2.KubeConfig{
+											SecretRef: apimeta.SecretKeyReference{Name: "member"},
+										},
+									},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+		want: Target{
+			Application: "podinfo",
+			Namespaces:  []string{"podinfo", "devops"},
+			Clusters:    []string{InCluster, "member"},
+		},
+	}, {
+		name: "not configured",
+		app: &v1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: "podinfo", Namespace: "devops"},
+			Spec:       v1alpha1.ApplicationSpec{Kind: v1alpha1.FluxCD},
+		},
+		want: Target{Application: "podinfo"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, TargetOf(tt.app))
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	// it's a Friday
+	now := time.Date(2022, 9, 2, 22, 30, 0, 0, time.UTC)
+	target := Target{
+		Application: "guestbook",
+		Namespaces:  []string{"guestbook"},
+		Clusters:    []string{InCluster},
+	}
+	nightly := &v1alpha3.SyncWindow{Kind: KindDeny, Schedule: "0 22 * * *", Duration: "2h", Applications: []string{"*"}}
+	weekdays := &v1alpha3.SyncWindow{Kind: KindAllow, Schedule: "0 9 * * 1-5", Duration: "8h", Namespaces: []string{"guest*"}}
+
+	tests := []struct {
+		name    string
+		spec    v1alpha3.DevOpsProjectSpec
+		at      time.Time
+		manual  bool
+		want    Result
+		wantErr bool
+	}{{
+		name: "no windows",
+		want: Result{Allowed: true},
+	}, {
+		name: "active deny window",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{nightly}},
+		want: Result{
+			Message:        `the deny window "0 22 * * *" is active until 2022-09-03T00:00:00Z`,
+			NextTransition: time.Date(2022, 9, 3, 0, 0, 0, 0, time.UTC),
+		},
+	}, {
+		name: "active deny window which enables the manual sync",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{
+			Kind: KindDeny, Schedule: "0 22 * * *", Duration: "2h", Applications: []string{"*"}, ManualSync: true,
+		}}},
+		manual: true,
+		want: Result{
+			Allowed:        true,
+			NextTransition: time.Date(2022, 9, 3, 0, 0, 0, 0, time.UTC),
+		},
+	}, {
+		name: "deny window in another time zone",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{
+			Kind: KindDeny, Schedule: "0 22 * * *", Duration: "2h", Applications: []string{"*"}, TimeZone: "Asia/Shanghai",
+		}}},
+		want: Result{
+			Allowed:        true,
+			NextTransition: time.Date(2022, 9, 3, 14, 0, 0, 0, time.UTC),
+		},
+	}, {
+		name: "deny window of other applications",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{
+			Kind: KindDeny, Schedule: "0 22 * * *", Duration: "2h", Applications: []string{"podinfo"}, Clusters: []string{"member"},
+		}}},
+		want: Result{Allowed: true},
+	}, {
+		name: "inactive allow window",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{weekdays}},
+		want: Result{
+			Message:        "none of the allow windows is active",
+			NextTransition: time.Date(2022, 9, 5, 9, 0, 0, 0, time.UTC),
+		},
+	}, {
+		name: "active allow window",
+		spec: v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{weekdays}},
+		at:   time.Date(2022, 9, 5, 10, 0, 0, 0, time.UTC),
+		want: Result{
+			Allowed:        true,
+			NextTransition: time.Date(2022, 9, 5, 17, 0, 0, 0, time.UTC),
+		},
+	}, {
+		name: "change freeze in progress",
+		spec: v1alpha3.DevOpsProjectSpec{ChangeFreezes: []v1alpha3.ChangeFreeze{{
+			Name:   "release",
+			Reason: "release 3.4",
+			Start:  metav1.NewTime(now.Add(-time.Hour)),
+			End:    metav1.NewTime(now.Add(time.Hour)),
+		}}},
+		manual: true,
+		want: Result{
+			Message:        `the change freeze "release" is in progress until 2022-09-02T23:30:00Z: release 3.4`,
+			NextTransition: now.Add(time.Hour),
+		},
+	}, {
+		name: "upcoming change freeze",
+		spec: v1alpha3.DevOpsProjectSpec{ChangeFreezes: []v1alpha3.ChangeFreeze{{
+			Name:  "release",
+			Start: metav1.NewTime(now.Add(time.Hour)),
+			End:   metav1.NewTime(now.Add(2 * time.Hour)),
+		}, {
+			Name:         "others",
+			Start:        metav1.NewTime(now.Add(-time.Hour)),
+			End:          metav1.NewTime(now.Add(time.Hour)),
+			Applications: []string{"podinfo"},
+		}}},
+		want: Result{
+			Allowed:        true,
+			NextTransition: now.Add(time.Hour),
+		},
+	}, {
+		name:    "invalid schedule",
+		spec:    v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{Kind: KindDeny, Schedule: "0 22", Duration: "1h", Applications: []string{"*"}}}},
+		wantErr: true,
+	}, {
+		name:    "invalid duration",
+		spec:    v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{Kind: KindDeny, Schedule: "0 22 * * *", Duration: "1d", Applications: []string{"*"}}}},
+		wantErr: true,
+	}, {
+		name:    "invalid kind",
+		spec:    v1alpha3.DevOpsProjectSpec{SyncWindows: v1alpha3.SyncWindows{{Kind: "block", Schedule: "0 22 * * *", Duration: "1h", Applications: []string{"*"}}}},
+		wantErr: true,
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := tt.at
+			if at.IsZero() {
+				at = now
+			}
+			result, err := Evaluate(&tt.spec, target, at, tt.manual)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+			if !tt.wantErr {
+				assert.Equal(t, tt.want.Allowed, result.Allowed)
+				assert.Equal(t, tt.want.Message, result.Message)
+				assert.True(t, tt.want.NextTransition.Equal(result.NextTransition), result.NextTransition)
+			}
+		})
+	}
+}
+
+func Test_match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{pattern: "*", value: "https://kubernetes.default.svc", want: true},
+		{pattern: "guestbook", value: "guestbook", want: true},
+		{pattern: "guestbook", value: "guestbook-dev", want: false},
+		{pattern: "guest*", value: "guestbook", want: true},
+		{pattern: "*-prod", value: "guestbook-prod", want: true},
+		{pattern: "*-prod", value: "guestbook-dev", want: false},
+		{pattern: "a*b*c", value: "abc", want: true},
+		{pattern: "a*a", value: "a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.want, match(tt.pattern, tt.value))
+		})
+	}
+}
@@ -18,6 +18,8 @@ package k8sutil
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"kubesphere.io/devops/pkg/utils"
 	"kubesphere.io/devops/pkg/utils/sliceutil"
 )
 
@@ -33,3 +35,12 @@ func AddFinalizer(objectMeta *metav1.ObjectMeta, finalizer string) (added bool)
 func RemoveFinalizer(objectMeta *metav1.ObjectMeta, finalizer string) {
 	objectMeta.Finalizers = sliceutil.RemoveString(objectMeta.Finalizers, sliceutil.SameItem(finalizer))
 }
+
+// LabelValue returns a label value of a name, a name which is too long is truncated and ends with its hash
+func LabelValue(name string) string {
+	if len(name) <= validation.LabelValueMaxLength {
+		return name
+	}
+	hash := utils.ComputeHash(name)
+	return name[:validation.LabelValueMaxLength-len(hash)-1] + "-" + hash
+}
@@ -19,6 +19,8 @@ package k8sutil
 import (
 	"github.com/stretchr/testify/assert"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"strings"
 	"testing"
 )
 
@@ -103,3 +105,13 @@ func TestRemoveFinalizer(t *testing.T) {
 		})
 	}
 }
+
+func TestLabelValue(t *testing.T) {
+	assert.Equal(t, "name", LabelValue("name"))
+
+	long := strings.Repeat("a", 100)
+	value := LabelValue(long)
+	assert.Len(t, value, validation.LabelValueMaxLength)
+	assert.Empty(t, validation.IsValidLabelValue(value))
+	assert.NotEqual(t, value, LabelValue(strings.Repeat("a", 101)))
+}
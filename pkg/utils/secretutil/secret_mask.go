@@ -47,6 +47,33 @@ func kubeconfigCredentialMask(secret *v1.Secret) *v1.Secret {
 	return secret
 }
 
+func gitHubAppCredentialMask(secret *v1.Secret) *v1.Secret {
+	secret.Data[v1alpha3.GitHubAppPrivateKey] = defaultMasque
+	return secret
+}
+
+func dockerConfigCredentialMask(secret *v1.Secret) *v1.Secret {
+	secret.Data[v1alpha3.DockerConfigJSONKey] = defaultMasque
+	return secret
+}
+
+func certificateCredentialMask(secret *v1.Secret) *v1.Secret {
+	secret.Data[v1alpha3.CertificateKeyStoreKey] = defaultMasque
+	secret.Data[v1alpha3.CertificatePasswordKey] = defaultMasque
+	secret.Data[v1alpha3.CertificatePrivateKey] = defaultMasque
+	return secret
+}
+
+func awsAccessKeyCredentialMask(secret *v1.Secret) *v1.Secret {
+	secret.Data[v1alpha3.AWSSecretAccessKey] = defaultMasque
+	return secret
+}
+
+func fileCredentialMask(secret *v1.Secret) *v1.Secret {
+	secret.Data[v1alpha3.FileContentKey] = defaultMasque
+	return secret
+}
+
 // MaskCredential masks sensetive data inside credential.
 func MaskCredential(secret *v1.Secret) *v1.Secret {
 	if secret == nil || secret.Data == nil {
@@ -65,4 +92,9 @@ func init() {
 	credentialMaskHolder[v1alpha3.SecretTypeSSHAuth] = sshAuthCredentialMask
 	credentialMaskHolder[v1alpha3.SecretTypeSecretText] = secretTextCredentialMask
 	credentialMaskHolder[v1alpha3.SecretTypeKubeConfig] = kubeconfigCredentialMask
+	credentialMaskHolder[v1alpha3.SecretTypeGitHubApp] = gitHubAppCredentialMask
+	credentialMaskHolder[v1alpha3.SecretTypeDockerConfig] = dockerConfigCredentialMask
+	credentialMaskHolder[v1alpha3.SecretTypeCertificate] = certificateCredentialMask
+	credentialMaskHolder[v1alpha3.SecretTypeAWSAccessKey] = awsAccessKeyCredentialMask
+	credentialMaskHolder[v1alpha3.SecretTypeFile] = fileCredentialMask
 }
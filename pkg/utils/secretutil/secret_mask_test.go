@@ -102,6 +102,44 @@ func Test_maskCredential(t *testing.T) {
 				v1alpha3.KubeConfigSecretKey: []byte(""),
 			},
 		},
+	}, {
+		name: "Mask certificate secret",
+		args: args{
+			secret: &v1.Secret{
+				Type: v1alpha3.SecretTypeCertificate,
+				Data: map[string][]byte{
+					v1alpha3.CertificateCertKey:    []byte("fake certificate"),
+					v1alpha3.CertificatePrivateKey: []byte("fake private key"),
+				},
+			},
+		},
+		want: &v1.Secret{
+			Type: v1alpha3.SecretTypeCertificate,
+			Data: map[string][]byte{
+				v1alpha3.CertificateCertKey:     []byte("fake certificate"),
+				v1alpha3.CertificatePrivateKey:  []byte(""),
+				v1alpha3.CertificateKeyStoreKey: []byte(""),
+				v1alpha3.CertificatePasswordKey: []byte(""),
+			},
+		},
+	}, {
+		name: "Mask AWS access key secret",
+		args: args{
+			secret: &v1.Secret{
+				Type: v1alpha3.SecretTypeAWSAccessKey,
+				Data: map[string][]byte{
+					v1alpha3.AWSAccessKeyIDKey:  []byte("fake access key id"),
+					v1alpha3.AWSSecretAccessKey: []byte("fake secret access key"),
+				},
+			},
+		},
+		want: &v1.Secret{
+			Type: v1alpha3.SecretTypeAWSAccessKey,
+			Data: map[string][]byte{
+				v1alpha3.AWSAccessKeyIDKey:  []byte("fake access key id"),
+				v1alpha3.AWSSecretAccessKey: []byte(""),
+			},
+		},
 	}, {
 		name: "Nil secret",
 		args: args{